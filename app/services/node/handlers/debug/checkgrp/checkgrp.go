@@ -6,28 +6,40 @@ import (
 	"net/http"
 	"os"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/health"
 	"go.uber.org/zap"
 )
 
 // Handlers manages the set of check endpoints.
 type Handlers struct {
-	Build string
-	Log   *zap.SugaredLogger
+	Build  string
+	Log    *zap.SugaredLogger
+	Health *health.Checker
 }
 
-// Readiness checks if the database is ready and if not will return a 500 status.
-// Do not respond by just returning an error because further up in the call
-// stack it will interpret that as a non-trusted error.
+// Readiness checks if the node is keeping up with the network and if not will
+// return a 500 status. Do not respond by just returning an error because
+// further up in the call stack it will interpret that as a non-trusted error.
 func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
+	hs := h.Health.Check()
+
 	status := "ok"
 	statusCode := http.StatusOK
 
-	// TODO: NOT SURE WHAT TO DO RIGHT NOW
+	switch {
+	case !hs.Ready:
+		status = "not ready"
+		statusCode = http.StatusInternalServerError
+	case hs.Degraded:
+		status = "degraded"
+	}
 
 	data := struct {
-		Status string `json:"status"`
+		State string `json:"status"`
+		health.Status
 	}{
-		Status: status,
+		State:  status,
+		Status: hs,
 	}
 
 	if err := response(w, statusCode, data); err != nil {
@@ -37,7 +49,8 @@ func (h Handlers) Readiness(w http.ResponseWriter, r *http.Request) {
 	h.Log.Infow("readiness", "statusCode", statusCode, "method", r.Method, "path", r.URL.Path, "remoteaddr", r.RemoteAddr)
 }
 
-// Liveness returns simple status info if the service is alive. If the
+// Liveness returns simple status info if the service is alive and will return
+// a 500 status if the worker stopped running any of its operations. If the
 // app is deployed to a Kubernetes cluster, it will also return pod, node, and
 // namespace details via the Downward API. The Kubernetes environment variables
 // need to be set within your Pod/Deployment manifest.
@@ -47,17 +60,28 @@ func (h Handlers) Liveness(w http.ResponseWriter, r *http.Request) {
 		host = "unavailable"
 	}
 
+	status := "up"
+	statusCode := http.StatusOK
+
+	hs := h.Health.Check()
+	if !hs.Live {
+		status = "down"
+		statusCode = http.StatusInternalServerError
+	}
+
 	data := struct {
-		Status string `json:"status,omitempty"`
-		Build  string `json:"build,omitempty"`
-		Host   string `json:"host,omitempty"`
+		Status  string   `json:"status,omitempty"`
+		Build   string   `json:"build,omitempty"`
+		Host    string   `json:"host,omitempty"`
+		Reasons []string `json:"reasons,omitempty"`
 	}{
-		Status: "up",
+		Status: status,
 		Build:  h.Build,
 		Host:   host,
 	}
-
-	statusCode := http.StatusOK
+	if !hs.Live {
+		data.Reasons = hs.Reasons
+	}
 	if err := response(w, statusCode, data); err != nil {
 		h.Log.Errorw("liveness", "ERROR", err)
 	}
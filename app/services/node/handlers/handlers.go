@@ -4,14 +4,23 @@ package handlers
 import (
 	"context"
 	"expvar"
+	"fmt"
 	"net/http"
 	"net/http/pprof"
 	"os"
+	"strconv"
+	"strings"
 
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/debug/checkgrp"
 	v1 "github.com/ardanlabs/blockchain/app/services/node/handlers/v1"
+	"github.com/ardanlabs/blockchain/business/sys/auth"
 	"github.com/ardanlabs/blockchain/business/web/v1/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/health"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/index"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/policy"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/eventlog"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
 	"github.com/ardanlabs/blockchain/foundation/web"
@@ -25,18 +34,34 @@ type MuxConfig struct {
 	State    *state.State
 	NS       *nameservice.NameService
 	Evts     *events.Events
+	EventLog *eventlog.Log
+	Policy   *policy.AccountPolicy
+	Auth     *auth.Auth
+	Antispam *antispam.Guard
+	Origins  []string // Origins browsers can call the public API from, * allows any.
+	CorsPath string   // Path prefix the origins can call, unset allows the whole public API.
+	Index    *index.Index
 }
 
 // PublicMux constructs a http.Handler with all application routes defined.
 func PublicMux(cfg MuxConfig) http.Handler {
 
+	// The browsers on other origins can be limited to part of the public
+	// API, like the routes a web wallet needs.
+	cors := mid.Cors(cfg.Origins...)
+	if cfg.CorsPath != "" {
+		cors = mid.CorsPath(cfg.CorsPath, cfg.Origins...)
+	}
+
 	// Construct the web.App which holds all routes as well as common Middleware.
 	app := web.NewApp(
 		cfg.Shutdown,
 		mid.Logger(cfg.Log),
+		mid.Trace(cfg.State.Tracer()),
 		mid.Errors(cfg.Log),
 		mid.Metrics(),
-		mid.Cors("*"),
+		cors,
+		mid.Authenticate(cfg.Auth, auth.RoleRead),
 		mid.Panics(),
 	)
 
@@ -46,14 +71,17 @@ func PublicMux(cfg MuxConfig) http.Handler {
 	h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 		return nil
 	}
-	app.Handle(http.MethodOptions, "", "/*", h, mid.Cors("*"))
+	app.Handle(http.MethodOptions, "", "/*", h, cors)
 
 	// Load the v1 routes.
 	v1.PublicRoutes(app, v1.Config{
-		Log:   cfg.Log,
-		State: cfg.State,
-		NS:    cfg.NS,
-		Evts:  cfg.Evts,
+		Log:      cfg.Log,
+		State:    cfg.State,
+		NS:       cfg.NS,
+		Evts:     cfg.Evts,
+		Auth:     cfg.Auth,
+		Antispam: cfg.Antispam,
+		Index:    cfg.Index,
 	})
 
 	return app
@@ -66,10 +94,12 @@ func PrivateMux(cfg MuxConfig) http.Handler {
 	app := web.NewApp(
 		cfg.Shutdown,
 		mid.Logger(cfg.Log),
+		mid.Trace(cfg.State.Tracer()),
 		mid.Errors(cfg.Log),
 		mid.Metrics(),
 		mid.Cors("*"),
 		mid.Panics(),
+		mid.Envelope(),
 	)
 
 	// Accept CORS 'OPTIONS' preflight requests if config has been provided.
@@ -90,6 +120,32 @@ func PrivateMux(cfg MuxConfig) http.Handler {
 	return app
 }
 
+// AdminMux constructs a http.Handler with all admin routes defined. Every
+// route requires a caller with the admin role.
+func AdminMux(cfg MuxConfig) http.Handler {
+
+	// Construct the web.App which holds all routes as well as common Middleware.
+	app := web.NewApp(
+		cfg.Shutdown,
+		mid.Logger(cfg.Log),
+		mid.Errors(cfg.Log),
+		mid.Metrics(),
+		mid.Authenticate(cfg.Auth, auth.RoleAdmin),
+		mid.Panics(),
+	)
+
+	// Load the v1 routes.
+	v1.AdminRoutes(app, v1.Config{
+		Log:      cfg.Log,
+		State:    cfg.State,
+		EventLog: cfg.EventLog,
+		Policy:   cfg.Policy,
+		Index:    cfg.Index,
+	})
+
+	return app
+}
+
 // DebugStandardLibraryMux registers all the debug routes from the standard library
 // into a new mux bypassing the use of the DefaultServerMux. Using the
 // DefaultServerMux would be a security risk since a dependency could inject a
@@ -112,16 +168,55 @@ func DebugStandardLibraryMux() *http.ServeMux {
 // debug application routes for the service. This bypassing the use of the
 // DefaultServerMux. Using the DefaultServerMux would be a security risk since
 // a dependency could inject a handler into our service without us knowing it.
-func DebugMux(build string, log *zap.SugaredLogger) http.Handler {
+func DebugMux(build string, log *zap.SugaredLogger, checker *health.Checker) http.Handler {
 	mux := DebugStandardLibraryMux()
 
 	// Register debug check endpoints.
 	cgh := checkgrp.Handlers{
-		Build: build,
-		Log:   log,
+		Build:  build,
+		Log:    log,
+		Health: checker,
 	}
 	mux.HandleFunc("/debug/readiness", cgh.Readiness)
 	mux.HandleFunc("/debug/liveness", cgh.Liveness)
 
 	return mux
 }
+
+// ChainMux routes the requests for /v1/chains/:id/... to the handler of the
+// chain with that id, with the chain removed from the path so the chain's
+// own routes match. Every other request goes to the handler of the primary
+// chain, so a node hosting a single chain keeps its existing URLs.
+func ChainMux(primary http.Handler, chains map[uint16]http.Handler) http.Handler {
+	const chainPrefix = "/v1/chains/"
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.URL.Path, chainPrefix) {
+			primary.ServeHTTP(w, r)
+			return
+		}
+
+		rest := strings.TrimPrefix(r.URL.Path, chainPrefix)
+		id, path, _ := strings.Cut(rest, "/")
+
+		chainID, err := strconv.ParseUint(id, 10, 16)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("chain id %q is invalid", id), http.StatusBadRequest)
+			return
+		}
+
+		handler, exists := chains[uint16(chainID)]
+		if !exists {
+			http.Error(w, fmt.Sprintf("chain %d is not hosted by this node", chainID), http.StatusNotFound)
+			return
+		}
+
+		r2 := r.Clone(r.Context())
+		r2.URL.Path = "/v1/" + path
+		r2.URL.RawPath = ""
+		r2.RequestURI = r2.URL.RequestURI()
+		handler.ServeHTTP(w, r2)
+	}
+
+	return http.HandlerFunc(h)
+}
@@ -0,0 +1,417 @@
+// Package admin maintains the group of handlers for operators to manage
+// a running node.
+package admin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	v1 "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/index"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/policy"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/eventlog"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Handlers manages the set of admin endpoints.
+type Handlers struct {
+	Log      *zap.SugaredLogger
+	State    *state.State
+	EventLog *eventlog.Log
+	Policy   *policy.AccountPolicy
+	Index    *index.Index
+}
+
+// AddPeer adds a peer to the known peer list.
+func (h Handlers) AddPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var pr peer.Peer
+	if err := web.Decode(r, &pr); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := h.State.AddPeer(pr); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	h.Log.Infow("admin: add peer", "traceid", v.TraceID, "host", pr.Host)
+
+	return web.Respond(ctx, w, status{Status: "peer added"}, http.StatusOK)
+}
+
+// Peers returns the known peers with their scores, best first.
+func (h Handlers) Peers(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.PeerScores(), http.StatusOK)
+}
+
+// ReplayBlock returns the changes each transaction in the block made to the
+// accounts, found by applying the block again.
+func (h Handlers) ReplayBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	blockNum, err := blockNumber(r)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	replay, err := h.State.ReplayBlock(ctx, blockNum)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, replay, http.StatusOK)
+}
+
+// ExportState returns a versioned snapshot of the accounts after the block
+// was applied, which can be audited or imported into another database.
+func (h Handlers) ExportState(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	blockNum, err := blockNumber(r)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	var buf bytes.Buffer
+	if err := h.State.ExportState(ctx, &buf, blockNum); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.RespondBytes(ctx, w, buf.Bytes(), "application/json", http.StatusOK)
+}
+
+// ExportChain returns the block headers or transactions for a range of blocks
+// as CSV, for loading the chain history into analytics tools. The range is
+// from block 1 to the latest block unless from and to are provided.
+func (h Handlers) ExportChain(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	table := web.Param(r, "table")
+	if _, err := database.ExportColumns(table); err != nil {
+		return v1.NewRequestError(err, http.StatusNotFound)
+	}
+
+	values := r.URL.Query()
+
+	from := uint64(1)
+	if fromStr := values.Get("from"); fromStr != "" {
+		n, err := strconv.ParseUint(fromStr, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(fmt.Errorf("invalid from %q", fromStr), http.StatusBadRequest)
+		}
+		from = n
+	}
+
+	to := state.QueryLastest
+	switch toStr := values.Get("to"); toStr {
+	case "", "latest":
+	case "finalized":
+		to = state.QueryFinalized
+	default:
+		n, err := strconv.ParseUint(toStr, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(fmt.Errorf("invalid to %q", toStr), http.StatusBadRequest)
+		}
+		to = n
+	}
+
+	var buf bytes.Buffer
+	if err := h.State.ExportCSV(ctx, &buf, table, from, to); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	w.Header().Set("X-Export-Version", strconv.Itoa(database.ExportVersion))
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", fmt.Sprintf("%s.v%d.csv", table, database.ExportVersion)))
+
+	return web.RespondBytes(ctx, w, buf.Bytes(), "text/csv", http.StatusOK)
+}
+
+// ForkGenesis returns a genesis for a new chain starting from the accounts
+// after the block was applied. The chain id and network of the new chain can
+// be provided, otherwise they're kept.
+func (h Handlers) ForkGenesis(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	blockNum, err := blockNumber(r)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	fork, err := h.State.ForkGenesis(ctx, blockNum)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	values := r.URL.Query()
+	if chainID := values.Get("chain_id"); chainID != "" {
+		n, err := strconv.ParseUint(chainID, 10, 16)
+		if err != nil {
+			return v1.NewRequestError(fmt.Errorf("invalid chain_id %q", chainID), http.StatusBadRequest)
+		}
+		fork.ChainID = uint16(n)
+	}
+	if network := values.Get("network"); network != "" {
+		fork.Network = network
+	}
+
+	if err := fork.ValidateNetwork(); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, fork, http.StatusOK)
+}
+
+// RemovePeer removes a peer from the known peer list.
+func (h Handlers) RemovePeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	pr := peer.New(web.Param(r, "host"))
+	if err := h.State.RemovePeer(pr); err != nil {
+		return v1.NewRequestError(err, http.StatusNotFound)
+	}
+
+	h.Log.Infow("admin: remove peer", "traceid", v.TraceID, "host", pr.Host)
+
+	return web.Respond(ctx, w, status{Status: "peer removed"}, http.StatusOK)
+}
+
+// ForceSync starts a sync of the blockchain with the known peers.
+func (h Handlers) ForceSync(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	h.State.ForceSync()
+
+	h.Log.Infow("admin: force sync", "traceid", v.TraceID)
+
+	return web.Respond(ctx, w, status{Status: "sync started"}, http.StatusAccepted)
+}
+
+// SyncStatus returns the progress of the sync with the peers.
+func (h Handlers) SyncStatus(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.SyncStatus(), http.StatusOK)
+}
+
+// WatchedAccounts returns the accounts on the watch list.
+func (h Handlers) WatchedAccounts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.WatchedAccounts(), http.StatusOK)
+}
+
+// WatchAccount adds the account to the watch list so each block that changes
+// it sends a watch event.
+func (h Handlers) WatchAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	h.State.WatchAccount(accountID)
+
+	h.Log.Infow("admin: watch account", "traceid", v.TraceID, "account", accountID)
+
+	return web.Respond(ctx, w, status{Status: "account watched"}, http.StatusOK)
+}
+
+// UnwatchAccount removes the account from the watch list.
+func (h Handlers) UnwatchAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if !h.State.UnwatchAccount(accountID) {
+		return v1.NewRequestError(fmt.Errorf("account %s is not watched", accountID), http.StatusNotFound)
+	}
+
+	h.Log.Infow("admin: unwatch account", "traceid", v.TraceID, "account", accountID)
+
+	return web.Respond(ctx, w, status{Status: "account unwatched"}, http.StatusOK)
+}
+
+// Sinks returns the activity of the sinks receiving the events.
+func (h Handlers) Sinks(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.Sinks(), http.StatusOK)
+}
+
+// SetMining turns mining on or off for the node.
+func (h Handlers) SetMining(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req mining
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	h.State.SetMining(req.On)
+
+	h.Log.Infow("admin: set mining", "traceid", v.TraceID, "on", req.On)
+
+	resp := mining{
+		On:      req.On,
+		Allowed: h.State.IsMiningAllowed(),
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// DropMempoolTx removes a transaction from the mempool.
+func (h Handlers) DropMempoolTx(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	nonce, err := strconv.ParseUint(web.Param(r, "nonce"), 10, 64)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	if err := h.State.DropMempoolTx(accountID, nonce); err != nil {
+		return v1.NewRequestError(err, http.StatusNotFound)
+	}
+
+	h.Log.Infow("admin: drop mempool tx", "traceid", v.TraceID, "account", accountID, "nonce", nonce)
+
+	return web.Respond(ctx, w, status{Status: "transaction dropped"}, http.StatusOK)
+}
+
+// PolicyLists returns the accounts the node's policy allows and denies.
+func (h Handlers) PolicyLists(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.Policy.Lists(), http.StatusOK)
+}
+
+// UpdatePolicy replaces the accounts the node's policy allows and denies.
+// Transactions already in the mempool are checked again before they are
+// mined.
+func (h Handlers) UpdatePolicy(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var lists policy.Lists
+	if err := web.Decode(r, &lists); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := h.Policy.Update(lists); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	h.Log.Infow("admin: update policy", "traceid", v.TraceID, "allow", len(lists.Allow), "deny", len(lists.Deny))
+
+	return web.Respond(ctx, w, h.Policy.Lists(), http.StatusOK)
+}
+
+// Events returns the latest events of the node. The events can be filtered
+// by kind and by the sequence number of the last event already seen.
+func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var q eventlog.Query
+
+	values := r.URL.Query()
+	q.Kind = values.Get("kind")
+
+	if since := values.Get("since"); since != "" {
+		n, err := strconv.ParseUint(since, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(fmt.Errorf("invalid since %q", since), http.StatusBadRequest)
+		}
+		q.Since = n
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 0 {
+			return v1.NewRequestError(fmt.Errorf("invalid limit %q", limit), http.StatusBadRequest)
+		}
+		q.Limit = n
+	}
+
+	return web.Respond(ctx, w, h.EventLog.Query(q), http.StatusOK)
+}
+
+// VerifyStorage walks the blockchain in storage and reports the first
+// corrupted block if one exists.
+func (h Handlers) VerifyStorage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	result, err := h.State.VerifyStorage(ctx, false)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	return web.Respond(ctx, w, result, http.StatusOK)
+}
+
+// RepairStorage walks the blockchain in storage and truncates the chain to
+// the last valid block if a corrupted block is found.
+func (h Handlers) RepairStorage(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	result, err := h.State.VerifyStorage(ctx, true)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusInternalServerError)
+	}
+
+	return web.Respond(ctx, w, result, http.StatusOK)
+}
+
+// QueryIndex runs an ad-hoc SQL query against the index. The index is read
+// only for the query.
+func (h Handlers) QueryIndex(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var req indexQuery
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	h.Log.Infow("admin: query index", "traceid", v.TraceID, "query", req.Query)
+
+	result, err := h.Index.Query(ctx, req.Query, req.Args...)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, result, http.StatusOK)
+}
+
+// =============================================================================
+
+// blockNumber returns the block number in the request path, which can also
+// be latest or finalized.
+func blockNumber(r *http.Request) (uint64, error) {
+	switch numberStr := web.Param(r, "number"); numberStr {
+	case "latest":
+		return state.QueryLastest, nil
+	case "finalized":
+		return state.QueryFinalized, nil
+	default:
+		return strconv.ParseUint(numberStr, 10, 64)
+	}
+}
@@ -0,0 +1,15 @@
+package admin
+
+type status struct {
+	Status string `json:"status"`
+}
+
+type mining struct {
+	On      bool `json:"on"`
+	Allowed bool `json:"allowed"`
+}
+
+type indexQuery struct {
+	Query string `json:"query"`
+	Args  []any  `json:"args"`
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"strconv"
 
@@ -53,14 +54,74 @@ func (h Handlers) SubmitNodeTransaction(ctx context.Context, w http.ResponseWrit
 	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
+// SubmitVote adds a vote from a validator for the latest block so it can be
+// aggregated into the next block.
+func (h Handlers) SubmitVote(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var vote database.Vote
+	if err := web.Decode(r, &vote); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := h.State.AddVote(vote); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusOK)
+}
+
+// Checkpoints returns the checkpoints this node holds.
+func (h Handlers) Checkpoints(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	return web.Respond(ctx, w, h.State.Checkpoints(), http.StatusOK)
+}
+
+// SubmitCheckpoint adds a checkpoint signed by a trusted key.
+func (h Handlers) SubmitCheckpoint(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var sc database.SignedCheckpoint
+	if err := web.Decode(r, &sc); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	if err := h.State.AddCheckpoint(sc); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, nil, http.StatusOK)
+}
+
+// AnnounceBlock tells a peer announcing a new block if this node wants the
+// block to be sent.
+func (h Handlers) AnnounceBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var ba state.BlockAnnouncement
+	if err := web.Decode(r, &ba); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	return web.Respond(ctx, w, h.State.ProcessBlockAnnouncement(ba), http.StatusOK)
+}
+
 // ProposeBlock takes a block received from a peer, validates it and
 // if that passes, adds the block to the local blockchain.
 func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 
-	// Decode the JSON in the post call into a file system block.
+	// Decode the post call into a file system block. Peers send the block
+	// using the binary encoding or JSON.
 	var blockData database.BlockData
-	if err := web.Decode(r, &blockData); err != nil {
-		return fmt.Errorf("unable to decode payload: %w", err)
+	switch r.Header.Get("Content-Type") {
+	case database.BinaryContentType:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("unable to read payload: %w", err)
+		}
+
+		blockData, err = database.DecodeBlockData(data)
+		if err != nil {
+			return fmt.Errorf("unable to decode payload: %w", err)
+		}
+
+	default:
+		if err := web.Decode(r, &blockData); err != nil {
+			return fmt.Errorf("unable to decode payload: %w", err)
+		}
 	}
 
 	// Convert the block data into a block. This action will create a merkle
@@ -72,7 +133,8 @@ func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *ht
 
 	// Ask the state package to validate the proposed block. If the block
 	// passes validation, it will be added to the blockchain database.
-	if err := h.State.ProcessProposedBlock(block); err != nil {
+	status, err := h.State.ProcessProposedBlock(block)
+	if err != nil {
 		if errors.Is(err, database.ErrChainForked) {
 			h.State.Reorganize()
 		}
@@ -83,12 +145,34 @@ func (h Handlers) ProposeBlock(ctx context.Context, w http.ResponseWriter, r *ht
 	resp := struct {
 		Status string `json:"status"`
 	}{
-		Status: "accepted",
+		Status: status,
 	}
 
 	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
+// CompactBlock takes a block received from a peer as the header and the
+// hashes of its transactions, rebuilds it from the mempool and processes it
+// the same as a proposed block. The peer is told which transactions are
+// missing if the block can't be rebuilt.
+func (h Handlers) CompactBlock(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var cb database.CompactBlock
+	if err := web.Decode(r, &cb); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	status, err := h.State.ProcessCompactBlock(cb)
+	if err != nil {
+		if errors.Is(err, database.ErrChainForked) {
+			h.State.Reorganize()
+		}
+
+		return v1.NewRequestError(errors.New("block not accepted"), http.StatusNotAcceptable)
+	}
+
+	return web.Respond(ctx, w, status, http.StatusOK)
+}
+
 // SubmitPeer is called by a node so they can be added to the known peer list.
 func (h Handlers) SubmitPeer(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
@@ -101,21 +185,30 @@ func (h Handlers) SubmitPeer(ctx context.Context, w http.ResponseWriter, r *http
 		return fmt.Errorf("unable to decode payload: %w", err)
 	}
 
-	if !h.State.AddKnownPeer(peer) {
+	if !h.State.AddInboundPeer(peer) {
 		h.Log.Infow("adding peer", "traceid", v.TraceID, "host", peer.Host)
 	}
 
 	return web.Respond(ctx, w, nil, http.StatusOK)
 }
 
-// Status returns the current status of the node.
+// Status returns the current status of the node. When asked with the peers
+// token from a previous status, only the peers changed since then are
+// returned.
 func (h Handlers) Status(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	latestBlock := h.State.LatestBlock()
+	delta := h.State.KnownExternalPeersSince(r.URL.Query().Get("since"))
 
 	status := peer.PeerStatus{
-		LatestBlockHash:   latestBlock.Hash(),
-		LatestBlockNumber: latestBlock.Header.Number,
-		KnownPeers:        h.State.KnownExternalPeers(),
+		ChainID:              h.State.Genesis().ChainID,
+		LatestBlockHash:      latestBlock.Hash(),
+		LatestBlockNumber:    latestBlock.Header.Number,
+		FinalizedBlockNumber: h.State.LatestFinalizedBlock().Header.Number,
+		KnownPeers:           delta.Peers,
+		NodeID:               h.State.NodeID(),
+		PeersToken:           delta.Token,
+		PeersDelta:           !delta.Full,
+		RemovedPeers:         delta.Removed,
 	}
 
 	return web.Respond(ctx, w, status, http.StatusOK)
@@ -124,13 +217,19 @@ func (h Handlers) Status(ctx context.Context, w http.ResponseWriter, r *http.Req
 // BlocksByNumber returns all the blocks based on the specified to/from values.
 func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	fromStr := web.Param(r, "from")
-	if fromStr == "latest" || fromStr == "" {
+	switch fromStr {
+	case "latest", "":
 		fromStr = fmt.Sprintf("%d", state.QueryLastest)
+	case "finalized":
+		fromStr = fmt.Sprintf("%d", state.QueryFinalized)
 	}
 
 	toStr := web.Param(r, "to")
-	if toStr == "latest" || toStr == "" {
+	switch toStr {
+	case "latest", "":
 		toStr = fmt.Sprintf("%d", state.QueryLastest)
+	case "finalized":
+		toStr = fmt.Sprintf("%d", state.QueryFinalized)
 	}
 
 	from, err := strconv.ParseUint(fromStr, 10, 64)
@@ -146,7 +245,7 @@ func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *
 		return v1.NewRequestError(errors.New("from greater than to"), http.StatusBadRequest)
 	}
 
-	blocks := h.State.QueryBlocksByNumber(from, to)
+	blocks := h.State.QueryBlocksByNumber(ctx, from, to)
 	if len(blocks) == 0 {
 		return web.Respond(ctx, w, nil, http.StatusNoContent)
 	}
@@ -156,6 +255,16 @@ func (h Handlers) BlocksByNumber(ctx context.Context, w http.ResponseWriter, r *
 		blockData[i] = database.NewBlockData(block)
 	}
 
+	// Respond with the binary encoding if the peer asked for it.
+	if r.Header.Get("Accept") == database.BinaryContentType {
+		data, err := database.EncodeBlocksData(blockData)
+		if err != nil {
+			return err
+		}
+
+		return web.RespondBytes(ctx, w, data, database.BinaryContentType, http.StatusOK)
+	}
+
 	return web.Respond(ctx, w, blockData, http.StatusOK)
 }
 
@@ -2,13 +2,19 @@ package public
 
 import (
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 )
 
 type act struct {
-	Account database.AccountID `json:"account"`
-	Name    string             `json:"name"`
-	Balance uint64             `json:"balance"`
-	Nonce   uint64             `json:"nonce"`
+	Account   database.AccountID `json:"account"`
+	Name      string             `json:"name"`
+	Balance   uint64             `json:"balance"`
+	Locked    uint64             `json:"locked,omitempty"`
+	Immature  uint64             `json:"immature,omitempty"`
+	Bonded    uint64             `json:"bonded,omitempty"`
+	Unbonding uint64             `json:"unbonding,omitempty"`
+	Nonce     uint64             `json:"nonce"`
+	Escrow    *database.Escrow   `json:"escrow,omitempty"`
 }
 
 type actInfo struct {
@@ -27,6 +33,8 @@ type tx struct {
 	Value       uint64             `json:"value"`
 	Tip         uint64             `json:"tip"`
 	Data        []byte             `json:"data"`
+	ValidUntil  uint64             `json:"valid_until,omitempty"`
+	FeePayer    database.AccountID `json:"fee_payer,omitempty"`
 	TimeStamp   uint64             `json:"timestamp"`
 	GasPrice    uint64             `json:"gas_price"`
 	GasUnits    uint64             `json:"gas_units"`
@@ -35,15 +43,55 @@ type tx struct {
 	ProofOrder  []int64            `json:"proof_order"`
 }
 
-type block struct {
+type blockHeader struct {
 	Number        uint64             `json:"number"`
 	PrevBlockHash string             `json:"prev_block_hash"`
 	TimeStamp     uint64             `json:"timestamp"`
 	BeneficiaryID database.AccountID `json:"beneficiary"`
 	Difficulty    uint16             `json:"difficulty"`
 	MiningReward  uint64             `json:"mining_reward"`
+	BaseFee       uint64             `json:"base_fee"`
+	GasUsed       uint64             `json:"gas_used"`
 	StateRoot     string             `json:"state_root"`
 	TransRoot     string             `json:"trans_root"`
 	Nonce         uint64             `json:"nonce"`
-	Transactions  []tx               `json:"txs"`
+	Signature     string             `json:"signature,omitempty"`
+	Votes         int                `json:"votes,omitempty"` // Number of validators who voted for the parent block.
+}
+
+type block struct {
+	blockHeader
+	Transactions []tx `json:"txs"`
+}
+
+type rawTx struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+type rawTxResult struct {
+	Status string `json:"status"`
+	TxHash string `json:"tx_hash"`
+}
+
+type alias struct {
+	Name    string             `json:"name"`
+	Account database.AccountID `json:"account"`
+}
+
+type governance struct {
+	Governors     []string            `json:"governors"`
+	NextBlock     uint64              `json:"next_block"`
+	TransPerBlock uint16              `json:"trans_per_block"`
+	MiningReward  uint64              `json:"mining_reward"`
+	GasPrice      uint64              `json:"gas_price"`
+	BlockGasLimit uint64              `json:"block_gas_limit,omitempty"`
+	Proposals     []database.Proposal `json:"proposals"`
+}
+
+type supply struct {
+	TotalSupply     uint64 `json:"total_supply"`
+	SupplyCap       uint64 `json:"supply_cap"`
+	HalvingInterval uint64 `json:"halving_interval"`
+	NextBlock       uint64 `json:"next_block"`
+	NextReward      uint64 `json:"next_reward"`
 }
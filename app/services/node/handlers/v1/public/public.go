@@ -3,14 +3,24 @@ package public
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/ardanlabs/blockchain/business/sys/auth"
 	v1 "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/explorer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/index"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/rpc"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/events"
+	"github.com/ardanlabs/blockchain/foundation/graphql"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
 	"github.com/ardanlabs/blockchain/foundation/web"
 	"github.com/ethereum/go-ethereum/common/hexutil"
@@ -20,11 +30,16 @@ import (
 
 // Handlers manages the set of bar ledger endpoints.
 type Handlers struct {
-	Log   *zap.SugaredLogger
-	State *state.State
-	NS    *nameservice.NameService
-	WS    websocket.Upgrader
-	Evts  *events.Events
+	Log      *zap.SugaredLogger
+	State    *state.State
+	NS       *nameservice.NameService
+	WS       websocket.Upgrader
+	Evts     *events.Events
+	RPC      *rpc.Server
+	GQL      *explorer.Explorer
+	Auth     *auth.Auth
+	Antispam *antispam.Guard
+	Index    *index.Index
 }
 
 // Events handles a web socket to provide events to a client.
@@ -73,6 +88,90 @@ func (h Handlers) Events(ctx context.Context, w http.ResponseWriter, r *http.Req
 	}
 }
 
+// Stream provides the new blocks, mempool changes and peer changes to a
+// client as Server-Sent Events. The kinds of events can be selected with a
+// comma separated types query parameter.
+func (h Handlers) Stream(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	kinds := map[string]bool{
+		state.EventBlock:   true,
+		state.EventMempool: true,
+		state.EventPeer:    true,
+	}
+
+	// The watch events are only sent when asked for.
+	if types := r.URL.Query().Get("types"); types != "" {
+		selected := make(map[string]bool)
+		for _, kind := range strings.Split(types, ",") {
+			if !kinds[kind] && kind != state.EventWatch {
+				return v1.NewRequestError(fmt.Errorf("invalid event type %q", kind), http.StatusBadRequest)
+			}
+			selected[kind] = true
+		}
+		kinds = selected
+	}
+
+	// Each write to the client must complete within this time.
+	const writeTimeout = 10 * time.Second
+
+	es, err := web.NewEventStream(ctx, w, writeTimeout)
+	if err != nil {
+		return err
+	}
+	defer es.Close()
+
+	// This provides a channel for receiving events from the blockchain.
+	ch := h.Evts.Acquire(v.TraceID)
+	defer h.Evts.Release(v.TraceID)
+
+	// Starting a ticker to send a ping to detect when the client goes away.
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+
+	// Block waiting for events from the blockchain or ticker.
+	for {
+		select {
+		case msg, wd := <-ch:
+
+			// If the channel is closed, release the stream.
+			if !wd {
+				return nil
+			}
+
+			kind, data, ok := parseEvent(msg)
+			if !ok || !kinds[kind] {
+				continue
+			}
+
+			if err := es.Send(kind, data); err != nil {
+				return nil
+			}
+
+		case <-ticker.C:
+			if err := es.Ping(); err != nil {
+				return nil
+			}
+		}
+	}
+}
+
+// parseEvent splits a "viewer: <kind>: <json>" message sent by the state
+// into the kind and the JSON document. Other viewer messages are not events.
+func parseEvent(msg string) (string, string, bool) {
+	msg = strings.TrimPrefix(msg, "viewer: ")
+
+	kind, data, ok := strings.Cut(msg, ": ")
+	if !ok || !strings.HasPrefix(data, "{") {
+		return "", "", false
+	}
+
+	return kind, data, true
+}
+
 // SubmitWalletTransaction adds new transactions to the mempool.
 func (h Handlers) SubmitWalletTransaction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	v, err := web.GetValues(ctx)
@@ -105,24 +204,185 @@ func (h Handlers) SubmitWalletTransaction(ctx context.Context, w http.ResponseWr
 	return web.Respond(ctx, w, resp, http.StatusOK)
 }
 
+// SubmitRawTransaction adds a transaction in the raw encoding, such as one
+// signed offline, to the mempool.
+func (h Handlers) SubmitRawTransaction(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var req rawTx
+	if err := web.Decode(r, &req); err != nil {
+		return fmt.Errorf("unable to decode payload: %w", err)
+	}
+
+	txHash, err := h.State.SubmitRawTx(req.Raw)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := rawTxResult{
+		Status: "transactions added to mempool",
+		TxHash: txHash,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// JSONRPC executes JSON-RPC requests with Ethereum style methods. Errors are
+// reported inside the JSON-RPC response so the status is OK once a request
+// submitting a transaction passes the antispam check.
+func (h Handlers) JSONRPC(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	data, err := io.ReadAll(r.Body)
+	if err != nil {
+		return fmt.Errorf("unable to read payload: %w", err)
+	}
+
+	// Only the requests submitting a transaction need a writer or a token
+	// or proof of work, the rest are reads. A proof of work only pays for
+	// one transaction, a batch submitting more needs a token.
+	if submits := rpc.Submits(data); submits > 0 {
+		claims, _ := auth.GetClaims(ctx)
+		writer := claims.Allows(auth.RoleWrite)
+
+		if !writer && h.Auth.Required(auth.RoleWrite) {
+			err := errors.New("a caller with the write role is required to submit a transaction")
+			return v1.NewRequestError(err, http.StatusForbidden)
+		}
+
+		if !writer {
+			if err := h.Antispam.CheckBatch(r, data, submits); err != nil {
+				if bits := h.Antispam.WorkBits(); bits > 0 {
+					w.Header().Set(antispam.WorkBitsHeader, strconv.Itoa(bits))
+				}
+				return v1.NewRequestError(err, http.StatusForbidden)
+			}
+		}
+	}
+
+	resp := h.RPC.Process(ctx, data)
+
+	return web.RespondBytes(ctx, w, resp, "application/json", http.StatusOK)
+}
+
+// GraphQL executes a GraphQL query over the blocks, transactions and
+// accounts. Query errors are reported inside the GraphQL response so the
+// status is OK once the request is decoded.
+func (h Handlers) GraphQL(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	r.Body = http.MaxBytesReader(w, r.Body, graphql.MaxRequestSize)
+
+	var req graphql.Request
+	if err := web.Decode(r, &req); err != nil {
+		return v1.NewRequestError(fmt.Errorf("unable to decode payload: %w", err), http.StatusBadRequest)
+	}
+
+	resp := h.GQL.Execute(ctx, req)
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
 // Genesis returns the genesis information.
 func (h Handlers) Genesis(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	gen := h.State.Genesis()
 	return web.Respond(ctx, w, gen, http.StatusOK)
 }
 
-// Mempool returns the set of uncommitted transactions.
+// EstimateFee returns the suggested tips for slow, normal and fast inclusion.
+func (h Handlers) EstimateFee(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	est := h.State.EstimateFee()
+	return web.Respond(ctx, w, est, http.StatusOK)
+}
+
+// Evidence returns the accounts this node has seen produce two different
+// blocks for the same block number.
+func (h Handlers) Evidence(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	evidence := h.State.Evidence()
+	return web.Respond(ctx, w, evidence, http.StatusOK)
+}
+
+// ChainStats returns the rolling statistics for the blockchain.
+func (h Handlers) ChainStats(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	stats := h.State.QueryChainStats()
+	return web.Respond(ctx, w, stats, http.StatusOK)
+}
+
+// Supply returns the total supply of coins and the monetary policy.
+func (h Handlers) Supply(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	total := h.State.QueryTotalSupply()
+	nextBlock := h.State.LatestBlock().Header.Number + 1
+	gen := h.State.QueryGenesisAt(nextBlock)
+
+	sup := supply{
+		TotalSupply:     total,
+		SupplyCap:       gen.SupplyCap,
+		HalvingInterval: gen.HalvingInterval,
+		NextBlock:       nextBlock,
+		NextReward:      gen.MiningRewardAt(nextBlock, total),
+	}
+
+	return web.Respond(ctx, w, sup, http.StatusOK)
+}
+
+// Proposals returns the governance proposals and the parameters in effect
+// for the next block.
+func (h Handlers) Proposals(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	nextBlock := h.State.LatestBlock().Header.Number + 1
+	gen := h.State.QueryGenesisAt(nextBlock)
+
+	resp := governance{
+		Governors:     gen.Governors,
+		NextBlock:     nextBlock,
+		TransPerBlock: gen.TransPerBlock,
+		MiningReward:  gen.MiningReward,
+		GasPrice:      gen.GasPrice,
+		BlockGasLimit: gen.BlockGasLimit,
+		Proposals:     h.State.QueryProposals(),
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// TopAccounts returns the accounts with the largest balances from the index.
+func (h Handlers) TopAccounts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	limit, err := countParam(r, "limit", 10)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	accounts, err := h.Index.TopAccounts(ctx, limit)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, accounts, http.StatusOK)
+}
+
+// DailyFees returns the fees paid per day from the index, most recent first.
+func (h Handlers) DailyFees(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	days, err := countParam(r, "days", 30)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	fees, err := h.Index.FeesPerDay(ctx, days)
+	if err != nil {
+		return err
+	}
+
+	return web.Respond(ctx, w, fees, http.StatusOK)
+}
+
+// Mempool returns a page of the uncommitted transactions. The cursor for the
+// next page is returned in the X-Next-Cursor header.
 func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
-	acct := web.Param(r, "account")
+	page, err := pageParams(r)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
 
-	mempool := h.State.Mempool()
+	mempool, next, err := h.State.QueryUncommitted(database.AccountID(web.Param(r, "account")), page)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
 
 	trans := []tx{}
 	for _, tran := range mempool {
-		if acct != "" && ((acct != string(tran.FromID)) && (acct != string(tran.ToID))) {
-			continue
-		}
-
 		trans = append(trans, tx{
 			FromAccount: tran.FromID,
 			FromName:    h.NS.Lookup(tran.FromID),
@@ -133,6 +393,8 @@ func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Re
 			Value:       tran.Value,
 			Tip:         tran.Tip,
 			Data:        tran.Data,
+			ValidUntil:  tran.ValidUntil,
+			FeePayer:    tran.FeePayerID,
 			TimeStamp:   tran.TimeStamp,
 			GasPrice:    tran.GasPrice,
 			GasUnits:    tran.GasUnits,
@@ -140,37 +402,129 @@ func (h Handlers) Mempool(ctx context.Context, w http.ResponseWriter, r *http.Re
 		})
 	}
 
+	setNextCursor(w, next)
+
 	return web.Respond(ctx, w, trans, http.StatusOK)
 }
 
-// Accounts returns the current balances for all users.
+// CancelTx returns the unsigned transaction that cancels the pending
+// transaction from the account with the specified nonce. The wallet signs it
+// and submits it like any other transaction.
+func (h Handlers) CancelTx(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	nonce, err := strconv.ParseUint(web.Param(r, "nonce"), 10, 64)
+	if err != nil {
+		return v1.NewRequestError(fmt.Errorf("invalid nonce: %w", err), http.StatusBadRequest)
+	}
+
+	tx, err := h.State.CancelTx(accountID, nonce)
+	if err != nil {
+		if errors.Is(err, state.ErrTxNotPending) {
+			return v1.NewRequestError(err, http.StatusNotFound)
+		}
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, tx, http.StatusOK)
+}
+
+// PendingTxs returns a page of the transactions waiting in the mempool along
+// with why each one can or can't be mined into the next block.
+func (h Handlers) PendingTxs(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	values := r.URL.Query()
+
+	filter := state.MempoolFilter{
+		Account: database.AccountID(values.Get("account")),
+		Status:  values.Get("status"),
+		SortBy:  values.Get("sort"),
+	}
+
+	switch order := values.Get("order"); order {
+	case "", "asc":
+	case "desc":
+		filter.Desc = true
+	default:
+		return v1.NewRequestError(fmt.Errorf("invalid order %q", order), http.StatusBadRequest)
+	}
+
+	if minTip := values.Get("min_tip"); minTip != "" {
+		n, err := strconv.ParseUint(minTip, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(fmt.Errorf("invalid min_tip %q", minTip), http.StatusBadRequest)
+		}
+		filter.MinTip = n
+	}
+
+	filter.Cursor = values.Get("cursor")
+	for name, dest := range map[string]*int{"offset": &filter.Offset, "limit": &filter.Limit} {
+		if value := values.Get(name); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil {
+				return v1.NewRequestError(fmt.Errorf("invalid %s %q", name, value), http.StatusBadRequest)
+			}
+			*dest = n
+		}
+	}
+
+	page, err := h.State.QueryMempool(filter)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, page, http.StatusOK)
+}
+
+// Accounts returns the current balances for a page of the users ordered by
+// their account id. The cursor for the next page is returned in the
+// X-Next-Cursor header.
 func (h Handlers) Accounts(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	accountStr := web.Param(r, "account")
 
-	var accounts map[database.AccountID]database.Account
+	var accounts []database.Account
 	switch accountStr {
 	case "":
-		accounts = h.State.Accounts()
+		page, err := pageParams(r)
+		if err != nil {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
+
+		var next string
+		accounts, next, err = h.State.QueryAccounts(page)
+		if err != nil {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
+		setNextCursor(w, next)
 
 	default:
 		accountID, err := database.ToAccountID(accountStr)
 		if err != nil {
-			return err
+			return v1.NewRequestError(err, http.StatusBadRequest)
 		}
 		account, err := h.State.QueryAccount(accountID)
 		if err != nil {
-			return err
+			return v1.NewRequestError(err, http.StatusNotFound)
 		}
-		accounts = map[database.AccountID]database.Account{accountID: account}
+		accounts = []database.Account{account}
 	}
 
+	nextBlock := h.State.LatestBlock().Header.Number + 1
+
 	resp := make([]act, 0, len(accounts))
-	for account, info := range accounts {
+	for _, info := range accounts {
 		act := act{
-			Account: account,
-			Name:    h.NS.Lookup(account),
-			Balance: info.Balance,
-			Nonce:   info.Nonce,
+			Account:   info.AccountID,
+			Name:      h.NS.Lookup(info.AccountID),
+			Balance:   info.Balance,
+			Locked:    info.Balance - info.Spendable(nextBlock),
+			Immature:  info.Rewards.ImmatureAt(nextBlock),
+			Bonded:    info.Bonded,
+			Unbonding: info.Unbonding,
+			Nonce:     info.Nonce,
+			Escrow:    info.Escrow,
 		}
 		resp = append(resp, act)
 	}
@@ -184,7 +538,87 @@ func (h Handlers) Accounts(ctx context.Context, w http.ResponseWriter, r *http.R
 	return web.Respond(ctx, w, ai, http.StatusOK)
 }
 
-// BlocksByAccount returns all the blocks and their details.
+// AccountProof returns a merkle proof of the account's balance and nonce
+// against the state root of the specified block.
+func (h Handlers) AccountProof(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	blockNum := state.QueryLastest
+	switch blockStr := web.Param(r, "block"); blockStr {
+	case "", "latest":
+	case "finalized":
+		blockNum = state.QueryFinalized
+	default:
+		blockNum, err = strconv.ParseUint(blockStr, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
+	}
+
+	proof, err := h.State.GenerateAccountProof(ctx, accountID, blockNum)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	return web.Respond(ctx, w, proof, http.StatusOK)
+}
+
+// ResolveName returns the account that owns the registered name.
+func (h Handlers) ResolveName(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	name := web.Param(r, "name")
+
+	accountID, err := h.State.Resolve(name)
+	switch {
+	case errors.Is(err, database.ErrNameNotFound):
+		return v1.NewRequestError(err, http.StatusNotFound)
+	case err != nil:
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := alias{
+		Name:    name,
+		Account: accountID,
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// BlockByNumber returns the block for the specified number. The latest and
+// finalized blocks can be requested by name.
+func (h Handlers) BlockByNumber(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	var number uint64
+	switch numberStr := web.Param(r, "number"); numberStr {
+	case "latest":
+		number = h.State.LatestBlock().Header.Number
+	case "finalized":
+		number = h.State.LatestFinalizedBlock().Header.Number
+	default:
+		var err error
+		number, err = strconv.ParseUint(numberStr, 10, 64)
+		if err != nil {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
+	}
+
+	if number == 0 || number > h.State.LatestBlock().Header.Number {
+		return v1.NewRequestError(fmt.Errorf("block %d not found", number), http.StatusNotFound)
+	}
+
+	blocks := h.State.QueryBlocksByNumber(ctx, number, number)
+	if len(blocks) == 0 {
+		return v1.NewRequestError(fmt.Errorf("block %d not found", number), http.StatusNotFound)
+	}
+
+	return web.Respond(ctx, w, database.NewBlockData(blocks[0]), http.StatusOK)
+}
+
+// BlocksByAccount returns a page of the blocks and their details. Only
+// finalized blocks are returned if the finalized query parameter is true and
+// only their headers if the fields query parameter is header. The cursor for
+// the next page is returned in the X-Next-Cursor header.
 func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
 	var accountID database.AccountID
 	accountStr := web.Param(r, "account")
@@ -196,17 +630,48 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 		}
 	}
 
-	dbBlocks, err := h.State.QueryBlocksByAccount(accountID)
+	page, err := pageParams(r)
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	headerOnly, err := headerOnlyParam(r)
 	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	filter := state.BlockFilter{
+		Account:   accountID,
+		Finalized: r.URL.Query().Get("finalized") == "true",
+		Cursor:    page.Cursor,
+		Limit:     page.Limit,
+	}
+
+	blockPage, err := h.State.QueryBlocks(ctx, filter)
+	if err != nil {
+		if errors.Is(err, state.ErrInvalidCursor) {
+			return v1.NewRequestError(err, http.StatusBadRequest)
+		}
 		return err
 	}
 
-	if len(dbBlocks) == 0 {
+	setNextCursor(w, blockPage.Next)
+
+	if len(blockPage.Blocks) == 0 {
 		return web.Respond(ctx, w, nil, http.StatusNoContent)
 	}
 
-	blocks := make([]block, len(dbBlocks))
-	for j, blk := range dbBlocks {
+	if headerOnly {
+		headers := make([]blockHeader, len(blockPage.Blocks))
+		for i, blk := range blockPage.Blocks {
+			headers[i] = newBlockHeader(blk)
+		}
+
+		return web.Respond(ctx, w, headers, http.StatusOK)
+	}
+
+	blocks := make([]block, len(blockPage.Blocks))
+	for j, blk := range blockPage.Blocks {
 		values := blk.MerkleTree.Values()
 
 		trans := make([]tx, len(values))
@@ -230,6 +695,8 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 				Value:       tran.Value,
 				Tip:         tran.Tip,
 				Data:        tran.Data,
+				ValidUntil:  tran.ValidUntil,
+				FeePayer:    tran.FeePayerID,
 				TimeStamp:   tran.TimeStamp,
 				GasPrice:    tran.GasPrice,
 				GasUnits:    tran.GasUnits,
@@ -239,21 +706,93 @@ func (h Handlers) BlocksByAccount(ctx context.Context, w http.ResponseWriter, r
 			}
 		}
 
-		b := block{
-			Number:        blk.Header.Number,
-			PrevBlockHash: blk.Header.PrevBlockHash,
-			TimeStamp:     blk.Header.TimeStamp,
-			BeneficiaryID: blk.Header.BeneficiaryID,
-			Difficulty:    blk.Header.Difficulty,
-			MiningReward:  blk.Header.MiningReward,
-			Nonce:         blk.Header.Nonce,
-			StateRoot:     blk.Header.StateRoot,
-			TransRoot:     blk.Header.TransRoot,
-			Transactions:  trans,
+		blocks[j] = block{
+			blockHeader:  newBlockHeader(blk),
+			Transactions: trans,
 		}
-
-		blocks[j] = b
 	}
 
 	return web.Respond(ctx, w, blocks, http.StatusOK)
 }
+
+// =============================================================================
+
+// pageParams returns the page requested by the cursor and limit query
+// parameters.
+func pageParams(r *http.Request) (state.Page, error) {
+	values := r.URL.Query()
+
+	page := state.Page{
+		Cursor: values.Get("cursor"),
+	}
+
+	if limit := values.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return state.Page{}, fmt.Errorf("invalid limit %q", limit)
+		}
+		page.Limit = n
+	}
+
+	return page, nil
+}
+
+// countParam returns the number of rows asked for in the query parameter,
+// which is between 1 and the most rows the index returns.
+func countParam(r *http.Request, name string, def int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return def, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 || n > index.MaxRows {
+		return 0, fmt.Errorf("invalid %s %q, must be between 1 and %d", name, value, index.MaxRows)
+	}
+
+	return n, nil
+}
+
+// headerOnlyParam reports if the fields query parameter trims the blocks
+// down to their headers.
+func headerOnlyParam(r *http.Request) (bool, error) {
+	switch fields := r.URL.Query().Get("fields"); fields {
+	case "", "all":
+		return false, nil
+	case "header":
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid fields %q", fields)
+	}
+}
+
+// setNextCursor sets the cursor for the next page of a list in the response,
+// which isn't set on the last page.
+func setNextCursor(w http.ResponseWriter, next string) {
+	if next != "" {
+		w.Header().Set(v1.NextCursorHeader, next)
+	}
+}
+
+// newBlockHeader constructs the header view of the block.
+func newBlockHeader(blk database.Block) blockHeader {
+	header := blockHeader{
+		Number:        blk.Header.Number,
+		PrevBlockHash: blk.Header.PrevBlockHash,
+		TimeStamp:     blk.Header.TimeStamp,
+		BeneficiaryID: blk.Header.BeneficiaryID,
+		Difficulty:    blk.Header.Difficulty,
+		MiningReward:  blk.Header.MiningReward,
+		BaseFee:       blk.Header.BaseFee,
+		GasUsed:       blk.Header.GasUsed,
+		Nonce:         blk.Header.Nonce,
+		StateRoot:     blk.Header.StateRoot,
+		TransRoot:     blk.Header.TransRoot,
+		Signature:     blk.Signature,
+	}
+	if blk.Votes != nil {
+		header.Votes = blk.Votes.Count()
+	}
+
+	return header
+}
@@ -5,9 +5,19 @@ package v1
 import (
 	"net/http"
 
+	"github.com/ardanlabs/blockchain/app/services/node/handlers/v1/admin"
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/v1/private"
 	"github.com/ardanlabs/blockchain/app/services/node/handlers/v1/public"
+	"github.com/ardanlabs/blockchain/app/services/node/handlers/v1/wallet"
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/v1/mid"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/explorer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/index"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/policy"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/rpc"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/eventlog"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
 	"github.com/ardanlabs/blockchain/foundation/web"
@@ -19,32 +29,82 @@ const version = "v1"
 
 // Config contains all the mandatory systems required by handlers.
 type Config struct {
-	Log   *zap.SugaredLogger
-	State *state.State
-	NS    *nameservice.NameService
-	Evts  *events.Events
+	Log      *zap.SugaredLogger
+	State    *state.State
+	NS       *nameservice.NameService
+	Evts     *events.Events
+	EventLog *eventlog.Log
+	Policy   *policy.AccountPolicy
+	Auth     *auth.Auth
+	Antispam *antispam.Guard
+	Index    *index.Index // Unset when the node doesn't index the chain.
 }
 
 // PublicRoutes binds all the version 1 public routes.
 func PublicRoutes(app *web.App, cfg Config) {
 	pbl := public.Handlers{
-		Log:   cfg.Log,
-		State: cfg.State,
-		NS:    cfg.NS,
-		WS:    websocket.Upgrader{},
-		Evts:  cfg.Evts,
+		Log:      cfg.Log,
+		State:    cfg.State,
+		NS:       cfg.NS,
+		WS:       websocket.Upgrader{},
+		Evts:     cfg.Evts,
+		RPC:      rpc.New(cfg.State),
+		GQL:      explorer.New(cfg.State),
+		Auth:     cfg.Auth,
+		Antispam: cfg.Antispam,
+		Index:    cfg.Index,
 	}
 
+	// Submitting a transaction takes a caller with the write role when the
+	// node requires one, and an API token or a proof of work from any other
+	// caller when the node requires that. The JSON-RPC handler checks the
+	// requests that submit a transaction itself.
+	write := mid.Authenticate(cfg.Auth, auth.RoleWrite)
+	guard := mid.Antispam(cfg.Antispam)
+
+	// Blocks don't change once mined, so a caller polling for them can ask
+	// for them only if they changed.
+	etag := mid.ETag()
+
 	app.Handle(http.MethodGet, version, "/events", pbl.Events)
+	app.Handle(http.MethodGet, version, "/events/stream", pbl.Stream)
 	app.Handle(http.MethodGet, version, "/genesis/list", pbl.Genesis)
+	app.Handle(http.MethodGet, version, "/chain/stats", pbl.ChainStats)
+	app.Handle(http.MethodGet, version, "/chain/supply", pbl.Supply)
+	app.Handle(http.MethodGet, version, "/governance/proposals", pbl.Proposals)
+	app.Handle(http.MethodGet, version, "/chain/evidence", pbl.Evidence)
 	app.Handle(http.MethodGet, version, "/accounts/list", pbl.Accounts)
 	app.Handle(http.MethodGet, version, "/accounts/list/:account", pbl.Accounts)
-	app.Handle(http.MethodGet, version, "/blocks/list", pbl.BlocksByAccount)
-	app.Handle(http.MethodGet, version, "/blocks/list/:account", pbl.BlocksByAccount)
+	app.Handle(http.MethodGet, version, "/accounts/proof/:account", pbl.AccountProof)
+	app.Handle(http.MethodGet, version, "/accounts/proof/:account/:block", pbl.AccountProof)
+	app.Handle(http.MethodGet, version, "/names/:name", pbl.ResolveName)
+	app.Handle(http.MethodGet, version, "/blocks/list", pbl.BlocksByAccount, etag)
+	app.Handle(http.MethodGet, version, "/blocks/list/:account", pbl.BlocksByAccount, etag)
+	app.Handle(http.MethodGet, version, "/blocks/number/:number", pbl.BlockByNumber, etag)
 	app.Handle(http.MethodGet, version, "/tx/uncommitted/list", pbl.Mempool)
 	app.Handle(http.MethodGet, version, "/tx/uncommitted/list/:account", pbl.Mempool)
-	app.Handle(http.MethodPost, version, "/tx/submit", pbl.SubmitWalletTransaction)
-	app.Handle(http.MethodPost, version, "/tx/proof/:block/", pbl.SubmitWalletTransaction)
+	app.Handle(http.MethodGet, version, "/tx/pending", pbl.PendingTxs)
+	app.Handle(http.MethodGet, version, "/tx/fees", pbl.EstimateFee)
+	app.Handle(http.MethodGet, version, "/tx/cancel/:account/:nonce", pbl.CancelTx)
+	app.Handle(http.MethodPost, version, "/tx/submit", pbl.SubmitWalletTransaction, write, guard)
+	app.Handle(http.MethodPost, version, "/tx/raw", pbl.SubmitRawTransaction, write, guard)
+	app.Handle(http.MethodPost, version, "/tx/proof/:block/", pbl.SubmitWalletTransaction, write, guard)
+
+	wlt := wallet.Handlers{
+		Log:   cfg.Log,
+		State: cfg.State,
+	}
+
+	app.Handle(http.MethodGet, version, "/wallet/accounts/:account", wlt.Account)
+	app.Handle(http.MethodPost, version, "/wallet/tx", wlt.SubmitTx, write, guard)
+	app.Handle(http.MethodGet, version, "/wallet/tx/:hash", wlt.TxStatus)
+	app.Handle(http.MethodPost, version, "/rpc", pbl.JSONRPC)
+	app.Handle(http.MethodPost, version, "/graphql", pbl.GraphQL)
+
+	if cfg.Index != nil {
+		app.Handle(http.MethodGet, version, "/index/accounts/top", pbl.TopAccounts)
+		app.Handle(http.MethodGet, version, "/index/fees/daily", pbl.DailyFees)
+	}
 }
 
 // PrivateRoutes binds all the version 1 private routes.
@@ -55,10 +115,55 @@ func PrivateRoutes(app *web.App, cfg Config) {
 		NS:    cfg.NS,
 	}
 
+	// Peers keep polling for the status, blocks and checkpoints of this node
+	// and get no body back when nothing changed since their last poll.
+	etag := mid.ETag()
+
 	app.Handle(http.MethodPost, version, "/node/peers", prv.SubmitPeer)
-	app.Handle(http.MethodGet, version, "/node/status", prv.Status)
-	app.Handle(http.MethodGet, version, "/node/block/list/:from/:to", prv.BlocksByNumber)
+	app.Handle(http.MethodGet, version, "/node/status", prv.Status, etag)
+	app.Handle(http.MethodGet, version, "/node/block/list/:from/:to", prv.BlocksByNumber, etag)
+	app.Handle(http.MethodPost, version, "/node/block/announce", prv.AnnounceBlock)
 	app.Handle(http.MethodPost, version, "/node/block/propose", prv.ProposeBlock)
+	app.Handle(http.MethodPost, version, "/node/block/compact", prv.CompactBlock)
 	app.Handle(http.MethodPost, version, "/node/tx/submit", prv.SubmitNodeTransaction)
+	app.Handle(http.MethodPost, version, "/node/vote", prv.SubmitVote)
+	app.Handle(http.MethodGet, version, "/node/checkpoints", prv.Checkpoints, etag)
+	app.Handle(http.MethodPost, version, "/node/checkpoints", prv.SubmitCheckpoint)
 	app.Handle(http.MethodGet, version, "/node/tx/list", prv.Mempool)
 }
+
+// AdminRoutes binds all the version 1 admin routes.
+func AdminRoutes(app *web.App, cfg Config) {
+	adm := admin.Handlers{
+		Log:      cfg.Log,
+		State:    cfg.State,
+		EventLog: cfg.EventLog,
+		Policy:   cfg.Policy,
+		Index:    cfg.Index,
+	}
+
+	app.Handle(http.MethodGet, version, "/admin/peers", adm.Peers)
+	app.Handle(http.MethodPost, version, "/admin/peers", adm.AddPeer)
+	app.Handle(http.MethodDelete, version, "/admin/peers/:host", adm.RemovePeer)
+	app.Handle(http.MethodPost, version, "/admin/sync", adm.ForceSync)
+	app.Handle(http.MethodGet, version, "/admin/sync", adm.SyncStatus)
+	app.Handle(http.MethodPut, version, "/admin/mining", adm.SetMining)
+	app.Handle(http.MethodDelete, version, "/admin/tx/:account/:nonce", adm.DropMempoolTx)
+	app.Handle(http.MethodGet, version, "/admin/events", adm.Events)
+	app.Handle(http.MethodGet, version, "/admin/sinks", adm.Sinks)
+	app.Handle(http.MethodGet, version, "/admin/watch", adm.WatchedAccounts)
+	app.Handle(http.MethodPut, version, "/admin/watch/:account", adm.WatchAccount)
+	app.Handle(http.MethodDelete, version, "/admin/watch/:account", adm.UnwatchAccount)
+	app.Handle(http.MethodGet, version, "/admin/blocks/:number/replay", adm.ReplayBlock)
+	app.Handle(http.MethodGet, version, "/admin/blocks/:number/state", adm.ExportState)
+	app.Handle(http.MethodGet, version, "/admin/blocks/:number/genesis", adm.ForkGenesis)
+	app.Handle(http.MethodGet, version, "/admin/export/:table", adm.ExportChain)
+	app.Handle(http.MethodGet, version, "/admin/policy", adm.PolicyLists)
+	app.Handle(http.MethodPut, version, "/admin/policy", adm.UpdatePolicy)
+	app.Handle(http.MethodGet, version, "/admin/verify", adm.VerifyStorage)
+	app.Handle(http.MethodPost, version, "/admin/verify/repair", adm.RepairStorage)
+
+	if cfg.Index != nil {
+		app.Handle(http.MethodPost, version, "/admin/index/query", adm.QueryIndex)
+	}
+}
@@ -0,0 +1,33 @@
+package wallet
+
+import "github.com/ardanlabs/blockchain/foundation/blockchain/database"
+
+// Set of statuses for a transaction.
+const (
+	statusPending = "pending" // Waiting in the mempool.
+	statusMined   = "mined"   // Mined into a block on the chain.
+	statusRemoved = "removed" // Mined into a block a reorganization removed.
+	statusUnknown = "unknown" // Not seen by the node.
+)
+
+type account struct {
+	Account   database.AccountID `json:"account"`
+	Balance   uint64             `json:"balance"`
+	Nonce     uint64             `json:"nonce"`
+	NextNonce uint64             `json:"next_nonce"` // Nonce for the next transaction, after the ones in the mempool.
+	Pending   int                `json:"pending"`
+}
+
+type submitResult struct {
+	Status string `json:"status"`
+	TxHash string `json:"tx_hash"`
+}
+
+type txStatus struct {
+	TxHash        string `json:"tx_hash"`
+	Status        string `json:"status"`
+	Block         uint64 `json:"block,omitempty"`
+	BlockHash     string `json:"block_hash,omitempty"`
+	Confirmations uint64 `json:"confirmations,omitempty"`
+	Finalized     bool   `json:"finalized"`
+}
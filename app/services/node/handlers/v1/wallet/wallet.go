@@ -0,0 +1,127 @@
+// Package wallet maintains the group of handlers a web wallet uses to talk to
+// a node straight from the browser. They only cover what a wallet needs: the
+// balance and nonce of an account, submitting a signed transaction and
+// following its status.
+package wallet
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	v1 "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/web"
+	"go.uber.org/zap"
+)
+
+// Handlers manages the set of browser wallet endpoints.
+type Handlers struct {
+	Log   *zap.SugaredLogger
+	State *state.State
+}
+
+// Account returns the balance of the account and the nonce its next
+// transaction should use.
+func (h Handlers) Account(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	accountID, err := database.ToAccountID(web.Param(r, "account"))
+	if err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	// An account the chain hasn't seen yet has no balance and starts at the
+	// first nonce.
+	act := account{
+		Account: accountID,
+	}
+
+	if info, err := h.State.QueryAccount(accountID); err == nil {
+		act.Balance = info.Balance
+		act.Nonce = info.Nonce
+	}
+
+	next := act.Nonce
+	for _, tx := range h.State.Mempool() {
+		if tx.FromID != accountID {
+			continue
+		}
+
+		act.Pending++
+		if tx.Nonce > next {
+			next = tx.Nonce
+		}
+	}
+	act.NextNonce = next + 1
+
+	return web.Respond(ctx, w, act, http.StatusOK)
+}
+
+// SubmitTx adds the signed transaction to the mempool and returns its hash
+// so the wallet can follow its status.
+func (h Handlers) SubmitTx(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	v, err := web.GetValues(ctx)
+	if err != nil {
+		return web.NewShutdownError("web value missing from context")
+	}
+
+	var signedTx database.SignedTx
+	if err := web.Decode(r, &signedTx); err != nil {
+		return v1.NewRequestError(fmt.Errorf("unable to decode payload: %w", err), http.StatusBadRequest)
+	}
+
+	h.Log.Infow("wallet add tran", "traceid", v.TraceID, "from", signedTx.FromID, "to", signedTx.ToID, "nonce", signedTx.Nonce, "value", signedTx.Value)
+
+	if err := h.State.UpsertWalletTransaction(signedTx); err != nil {
+		return v1.NewRequestError(err, http.StatusBadRequest)
+	}
+
+	resp := submitResult{
+		Status: "transactions added to mempool",
+		TxHash: signedTx.TxHash(),
+	}
+
+	return web.Respond(ctx, w, resp, http.StatusOK)
+}
+
+// TxStatus returns whether the transaction is waiting in the mempool, mined
+// into a block or was removed with its block by a reorganization.
+func (h Handlers) TxStatus(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+	hash := web.Param(r, "hash")
+
+	status := txStatus{
+		TxHash: hash,
+		Status: statusUnknown,
+	}
+
+	for _, tx := range h.State.Mempool() {
+		if tx.TxHash() == hash {
+			status.Status = statusPending
+			return web.Respond(ctx, w, status, http.StatusOK)
+		}
+	}
+
+	_, block, canonical, err := h.State.QueryReceipt(ctx, hash)
+	switch {
+	case errors.Is(err, state.ErrTxNotFound):
+		return web.Respond(ctx, w, status, http.StatusOK)
+
+	case err != nil:
+		return err
+	}
+
+	status.Block = block.Header.Number
+	status.BlockHash = block.Hash()
+
+	if !canonical {
+		status.Status = statusRemoved
+		return web.Respond(ctx, w, status, http.StatusOK)
+	}
+
+	status.Status = statusMined
+	status.Confirmations = h.State.LatestBlock().Header.Number - block.Header.Number + 1
+	status.Finalized = block.Header.Number <= h.State.LatestFinalizedBlock().Header.Number
+
+	return web.Respond(ctx, w, status, http.StatusOK)
+}
@@ -7,17 +7,35 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/ardanlabs/blockchain/app/services/node/handlers"
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	"github.com/ardanlabs/blockchain/business/web/metrics"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/bridge"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/chaos"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/health"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/index"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/policy"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/proxy"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/reload"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/s3"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/segment"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/worker"
+	"github.com/ardanlabs/blockchain/foundation/eventlog"
 	"github.com/ardanlabs/blockchain/foundation/events"
 	"github.com/ardanlabs/blockchain/foundation/logger"
 	"github.com/ardanlabs/blockchain/foundation/nameservice"
@@ -31,8 +49,10 @@ var build = "develop"
 
 func main() {
 
-	// Construct the application logger.
-	log, err := logger.New("NODE")
+	// Construct the application logger. The level can be changed while the
+	// node is running through the reload file.
+	level := zap.NewAtomicLevelAt(zap.InfoLevel)
+	log, err := logger.NewWithLevel("NODE", level)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -40,14 +60,14 @@ func main() {
 	defer log.Sync()
 
 	// Perform the startup and shutdown sequence.
-	if err := run(log); err != nil {
+	if err := run(log, level); err != nil {
 		log.Errorw("startup", "ERROR", err)
 		log.Sync()
 		os.Exit(1)
 	}
 }
 
-func run(log *zap.SugaredLogger) error {
+func run(log *zap.SugaredLogger, level zap.AtomicLevel) error {
 
 	// =========================================================================
 	// Configuration
@@ -65,17 +85,107 @@ func run(log *zap.SugaredLogger) error {
 			DebugHost       string        `conf:"default:0.0.0.0:7080"`
 			PublicHost      string        `conf:"default:0.0.0.0:8080"`
 			PrivateHost     string        `conf:"default:0.0.0.0:9080"`
+			AdminHost       string        `conf:"default:127.0.0.1:6080"`
+			CorsOrigins     []string      `conf:"default:*"` // Origins browsers can call the public API from, * allows any
+			CorsWalletOnly  bool          // Only let browsers on other origins call the web wallet routes under /v1/wallet
+		}
+		Admin struct {
+			Token string `conf:"mask"` // The admin API is only started when a token, an admin key or a token secret is set
+		}
+		Auth struct {
+			Keys   []string `conf:"mask"` // API keys as name:role:key, the role is read, write or admin
+			Secret string   `conf:"mask"` // Secret of at least 32 characters the HS256 tokens with a role claim are signed with
+			Reads  bool     // Require a read key or token for the public API
+			Writes bool     // Require a write key or token to submit a transaction
+		}
+		Antispam struct {
+			Tokens   []string `conf:"mask"` // API tokens that submit transactions without the proof of work
+			WorkBits int      // Leading zero bits of the proof of work to submit a transaction, unset with no tokens leaves submission open
 		}
 		State struct {
-			Beneficiary    string   `conf:"default:miner1"`
-			DBPath         string   `conf:"default:zblock/miner1/"`
-			SelectStrategy string   `conf:"default:Tip"`
-			OriginPeers    []string `conf:"default:0.0.0.0:9080"` //
-			Consensus      string   `conf:"default:POW"`          // Change to POA to run Proof of Authority
+			Beneficiary    string        `conf:"default:miner1"`
+			DBPath         string        `conf:"default:zblock/miner1/"`
+			DBCodec        string        `conf:"default:none"` // Change to gzip or zlib to compress blocks on disk
+			Storage        string        `conf:"default:disk"` // Change to s3 to archive blocks in an object store or segment for segment files
+			SegmentSize    int           `conf:"default:100000"`
+			BlockCacheSize int           `conf:"default:1000"`
+			FinalityDepth  uint64        `conf:"default:6"` // Number of blocks on top of a block before it can't be reorganized
+			MiningTimeout  time.Duration // Longest a block is mined for, unset derives it from the difficulty and hash rate
+			MiningMinTrans int           // Number of pending transactions mining waits for, unset mines every transaction
+			MiningMaxWait  time.Duration // Longest transactions wait for the count before a partial block is mined
+			MiningMinTips  uint64        // Total of the pending tips that starts mining before the count is reached
+			MinTip         uint64        // Lowest tip accepted into the mempool for transactions from other accounts
+			EmptyBlocks    time.Duration // Time without a new block before an empty block is mined, unset only mines blocks with transactions
+			SelectStrategy string        `conf:"default:Tip"`
+			OriginPeers    []string      `conf:"default:0.0.0.0:9080"` // Other addresses of a peer follow its host separated by a |
+			Consensus      string        `conf:"default:POW"`          // Change to POA to run Proof of Authority or POS to run Proof of Stake
+			Journal        string        // Path of a journal recording the inputs to the node for replay
+			CompactRelay   bool          // Send new blocks to peers as the header and transaction hashes
+			Slash          bool          // Submit the evidence of a validator signing two blocks for the same number to slash its bond
+			Addrs          []string      // Other addresses peers can reach this node at, in order of preference
+			Identity       string        // File the node identity is kept in, unset keeps it next to the beneficiary's key
+			NodeState      string        // File the mempool, peers and sync position are kept in across restarts, unset keeps it in the db path
+			MaxInbound     int           `conf:"default:16"` // Number of peers that announced themselves kept, 0 keeps them all
+			MaxOutbound    int           `conf:"default:8"`  // Number of peers found by this node kept, 0 keeps them all
+			Chains         []string      // Other chains hosted by the node as genesis-file|db-path, served under /v1/chains/:id
+			Checkpoints    []string      // Accounts trusted to sign checkpoints, blocks contradicting their checkpoints are rejected
+			CheckpointFreq uint64        `conf:"default:100"` // Number of blocks between the checkpoints signed when the beneficiary is a trusted account
+			TrustedPeers   []string      // Hosts of the peers trusted for a fast sync, their blocks skip the proof of work, state root and signature rules
+		}
+		Chaos struct {
+			DropRate      float64       // Fraction of peer requests dropped to test resilience
+			BlockDelay    time.Duration // Time new blocks are held before they are proposed
+			DuplicateRate float64       // Fraction of shared transactions sent to peers twice
+			Seed          int64
+		}
+		Proxy struct {
+			URL    string   // Proxy peer traffic is sent through as http://, https:// or socks5:// host:port
+			Bypass []string // Peers reached directly as a host, host:port, .domain suffix, CIDR or *
+		}
+		Reload struct {
+			Path     string        // JSON file with the settings changed while the node runs, reloaded when it changes or on SIGHUP
+			Interval time.Duration `conf:"default:5s"` // How often the reload file is checked for changes
+		}
+		Events struct {
+			Path     string        // File the events are written to, unset only keeps the latest events in memory
+			MaxSize  int64         `conf:"default:10485760"` // Size in bytes an event file grows to before it's rotated
+			MaxAge   time.Duration // Age of an event file before it's rotated, unset doesn't rotate on age
+			MaxFiles int           `conf:"default:5"`    // Number of rotated event files kept
+			Buffer   int           `conf:"default:1000"` // Number of latest events kept for the admin API
+		}
+		Webhooks struct {
+			Path string // JSON file with the URLs notified of new blocks, large transfers, reorgs, removed peers and watched accounts
+		}
+		Bridge struct {
+			Bus    string // Message bus the new blocks and transactions are published to, nats or kafka, unset doesn't publish
+			URL    string // nats://host:4222 for NATS or the http:// URL of the REST proxy for Kafka
+			Prefix string `conf:"default:blockchain"` // Put in front of the blocks and transactions subjects
+		}
+		Index struct {
+			Path string // SQLite file the blocks, transactions and balances are indexed in for SQL queries, unset doesn't index
+		}
+		Policy struct {
+			Path   string // JSON file with the accounts the node allows and denies transactions for
+			Blocks bool   // Reject blocks from peers with denied transactions, this forks the node from peers without the policy
+		}
+		Tracing struct {
+			Enabled bool // Record spans for mining, syncing and gossip as span events
+		}
+		Health struct {
+			MaxBehind uint64 `conf:"default:2"` // Blocks the node can be behind the best known peer and still be ready
 		}
 		NameService struct {
 			Folder string `conf:"default:zblock/accounts/"`
 		}
+		S3 struct {
+			Endpoint  string `conf:"default:http://localhost:9000"`
+			Region    string `conf:"default:us-east-1"`
+			Bucket    string `conf:"default:blockchain"`
+			Prefix    string `conf:"default:miner1/"`
+			AccessKey string `conf:"mask"`
+			SecretKey string `conf:"mask"`
+			CacheSize int    `conf:"default:1000"`
+		}
 	}{
 		Version: conf.Version{
 			Build: build,
@@ -141,32 +251,79 @@ func run(log *zap.SugaredLogger) error {
 		return fmt.Errorf("unable to load private key for node: %w", err)
 	}
 
+	// The node identity lets peers recognize this node across restarts and
+	// address changes. It's generated the first time the node starts.
+	identityPath := cfg.State.Identity
+	if identityPath == "" {
+		identityPath = fmt.Sprintf("%s%s.node", cfg.NameService.Folder, cfg.State.Beneficiary)
+	}
+	identity, err := peer.LoadIdentity(identityPath)
+	if err != nil {
+		return fmt.Errorf("unable to load node identity: %w", err)
+	}
+	log.Infow("startup", "status", "node identity loaded", "nodeid", identity.ID)
+
 	// A peer set is a collection of known nodes in the network so transactions
 	// and blocks can be shared.
 	peerSet := peer.NewPeerSet()
-	for _, host := range cfg.State.OriginPeers {
-		peerSet.Add(peer.New(host))
+	for _, value := range cfg.State.OriginPeers {
+		pr, err := peer.Parse(value)
+		if err != nil {
+			return fmt.Errorf("unable to parse origin peer: %w", err)
+		}
+		peerSet.Add(pr)
 	}
-	peerSet.Add(peer.New(cfg.Web.PrivateHost))
+	self := peer.New(cfg.Web.PrivateHost, cfg.State.Addrs...)
+	self.ID = identity.ID
+	peerSet.Add(self)
+
+	// The event log keeps the latest events in memory for the admin API and
+	// writes them to rotating files when a path is configured.
+	evlog, err := eventlog.New(eventlog.Config{
+		Path:     cfg.Events.Path,
+		MaxSize:  cfg.Events.MaxSize,
+		MaxAge:   cfg.Events.MaxAge,
+		MaxFiles: cfg.Events.MaxFiles,
+		Buffer:   cfg.Events.Buffer,
+	})
+	if err != nil {
+		return fmt.Errorf("constructing event log: %w", err)
+	}
+	defer evlog.Close()
 
 	// The blockchain packages accept a function of this signature to allow the
 	// application to log. For now, these raw messages are sent to any websocket
 	// client that is connected into the system through the events package.
 	evts := events.New()
-	ev := func(v string, args ...any) {
-		const websocketPrefix = "viewer:"
-
-		s := fmt.Sprintf(v, args...)
-		log.Infow(s, "traceid", "00000000-0000-0000-0000-000000000000")
-		if strings.HasPrefix(s, websocketPrefix) {
-			evts.Send(s)
-		}
+	ev := eventHandler(log, evts, evlog)
+
+	// Construct the storage for the blockchain with the configured compression
+	// codec. Archive nodes can offload the chain to an S3 compatible object store
+	// and long chains can be grouped into segment files.
+	var storage database.Storage
+	switch cfg.State.Storage {
+	case "s3":
+		storage, err = s3.New(s3.Config{
+			Endpoint:  cfg.S3.Endpoint,
+			Region:    cfg.S3.Region,
+			Bucket:    cfg.S3.Bucket,
+			Prefix:    cfg.S3.Prefix,
+			AccessKey: cfg.S3.AccessKey,
+			SecretKey: cfg.S3.SecretKey,
+			Codec:     cfg.State.DBCodec,
+			CacheSize: cfg.S3.CacheSize,
+		})
+	case "segment":
+		storage, err = segment.New(segment.Config{
+			DBPath:      cfg.State.DBPath,
+			SegmentSize: cfg.State.SegmentSize,
+			Codec:       cfg.State.DBCodec,
+		})
+	default:
+		storage, err = disk.NewWithCodec(cfg.State.DBPath, cfg.State.DBCodec)
 	}
-
-	// Construct the use of disk storage.
-	storage, err := disk.New(cfg.State.DBPath)
 	if err != nil {
-		return err
+		return fmt.Errorf("unable to construct %s storage: %w", cfg.State.Storage, err)
 	}
 
 	// Load the genesis file for blockchain settings and origin balances.
@@ -175,27 +332,270 @@ func run(log *zap.SugaredLogger) error {
 		return err
 	}
 
+	// Record the inputs to the node when a journal is configured so a problem
+	// can be reproduced by replaying them.
+	var jrnl *journal.Journal
+	if cfg.State.Journal != "" {
+		jrnl, err = journal.Open(cfg.State.Journal)
+		if err != nil {
+			return fmt.Errorf("unable to open journal: %w", err)
+		}
+		defer jrnl.Close()
+	}
+
+	// Inject network faults when chaos testing is turned on.
+	var faults *chaos.Faults
+	if chaosCfg := chaos.Config(cfg.Chaos); chaosCfg.Enabled() {
+		log.Warnw("startup", "status", "chaos faults enabled", "drop-rate", chaosCfg.DropRate, "block-delay", chaosCfg.BlockDelay, "duplicate-rate", chaosCfg.DuplicateRate)
+		faults = chaos.New(chaosCfg)
+	}
+
+	// Send the requests to peers through the proxy when one is configured.
+	var transport http.RoundTripper
+	if proxyCfg := proxy.Config(cfg.Proxy); proxyCfg.Enabled() {
+		prx, err := proxy.New(proxyCfg)
+		if err != nil {
+			return fmt.Errorf("unable to configure proxy: %w", err)
+		}
+		log.Infow("startup", "status", "peer traffic sent through proxy", "bypass", proxyCfg.Bypass)
+		transport = prx.Transport()
+	}
+
+	// The policy decides which transactions this node accepts. Without a file
+	// the lists start empty and can be changed over the admin API.
+	accountPolicy, err := policy.New(policy.Lists{})
+	if cfg.Policy.Path != "" {
+		accountPolicy, err = policy.Load(cfg.Policy.Path)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to load policy: %w", err)
+	}
+
+	// Record spans for mining, syncing and gossip when tracing is turned on.
+	// The trace context is passed to peers so a block can be followed across
+	// the nodes.
+	var tracer *tracing.Tracer
+	if cfg.Tracing.Enabled {
+		tracer = tracing.New(cfg.Web.PrivateHost, state.SpanExporter(ev))
+	}
+
+	// Validators vote for blocks under PoS with a BLS key derived from the
+	// beneficiary's key, the same key the wallet registers with --bond-bls.
+	var blsKey *signature.BLSPrivateKey
+	if cfg.State.Consensus == state.ConsensusPOS {
+		blsKey, err = signature.DeriveBLSKey(crypto.FromECDSA(privateKey))
+		if err != nil {
+			return fmt.Errorf("unable to derive bls key: %w", err)
+		}
+	}
+
+	// Blocks contradicting the checkpoints signed by these accounts are
+	// rejected.
+	var checkpointKeys []database.AccountID
+	for _, signer := range cfg.State.Checkpoints {
+		accountID, err := database.ToAccountID(signer)
+		if err != nil {
+			return fmt.Errorf("checkpoint signer %q: %w", signer, err)
+		}
+		checkpointKeys = append(checkpointKeys, accountID)
+	}
+
+	// The pending transactions, peers and sync position are saved on shutdown
+	// and picked up again on the next start.
+	nodeStatePath := cfg.State.NodeState
+	if nodeStatePath == "" {
+		nodeStatePath = filepath.Join(cfg.State.DBPath, nodeStateFile)
+	}
+
 	// The state value represents the blockchain node and manages the blockchain
 	// database and provides an API for application support.
-	state, err := state.New(state.Config{
+	stateCfg := state.Config{
 		BeneficiaryID:  database.PublicKeyToAccountID(privateKey.PublicKey),
 		Host:           cfg.Web.PrivateHost,
+		NodeID:         identity.ID,
 		Storage:        storage,
 		Genesis:        genesis,
 		SelectStrategy: cfg.State.SelectStrategy,
 		KnownPeers:     peerSet,
 		Consensus:      cfg.State.Consensus,
+		BlockCacheSize: cfg.State.BlockCacheSize,
+		FinalityDepth:  cfg.State.FinalityDepth,
+		MiningTimeout:  cfg.State.MiningTimeout,
+		MiningMinTrans: cfg.State.MiningMinTrans,
+		MiningMaxWait:  cfg.State.MiningMaxWait,
+		MiningMinTips:  cfg.State.MiningMinTips,
+		EmptyBlocks:    cfg.State.EmptyBlocks,
+		PrivateKey:     privateKey,
+		BLSKey:         blsKey,
 		EvHandler:      ev,
-	})
+		Journal:        jrnl,
+		Faults:         faults,
+		Transport:      transport,
+		CompactRelay:   cfg.State.CompactRelay,
+		Slash:          cfg.State.Slash,
+		MaxInbound:     cfg.State.MaxInbound,
+		MaxOutbound:    cfg.State.MaxOutbound,
+		MinTip:         cfg.State.MinTip,
+		Tracer:         tracer,
+		Policy:         accountPolicy,
+		PolicyBlocks:   cfg.Policy.Blocks,
+		NodeStatePath:  nodeStatePath,
+		CheckpointKeys: checkpointKeys,
+		CheckpointFreq: cfg.State.CheckpointFreq,
+		TrustedPeers:   cfg.State.TrustedPeers,
+		Sinks: []state.Sink{
+			{Name: "metrics", Handle: func(ev state.Event) { metrics.AddEvent(ev.Kind) }},
+		},
+	}
+	state, err := state.New(stateCfg)
 	if err != nil {
 		return err
 	}
 	defer state.Shutdown()
 
+	// Webhooks notify external systems of the events on this chain.
+	if cfg.Webhooks.Path != "" {
+		hooks, err := webhook.Load(cfg.Webhooks.Path)
+		if err != nil {
+			return fmt.Errorf("unable to load webhooks: %w", err)
+		}
+
+		for _, hook := range hooks {
+			wh, err := webhook.New(hook, nil, ev)
+			if err != nil {
+				return err
+			}
+
+			if err := state.AddSink(wh.Sink()); err != nil {
+				return err
+			}
+
+			// The notifications waiting when the node shuts down are tried once
+			// without waiting to retry them.
+			defer wh.Stop()
+		}
+		log.Infow("startup", "status", "webhooks registered", "count", len(hooks))
+	}
+
+	// The bridge publishes the new blocks and transactions to a message bus.
+	if cfg.Bridge.Bus != "" {
+		brg, err := bridge.New(bridge.Config{Bus: cfg.Bridge.Bus, URL: cfg.Bridge.URL, Prefix: cfg.Bridge.Prefix}, nil, ev)
+		if err != nil {
+			return fmt.Errorf("unable to construct bridge: %w", err)
+		}
+		sink := brg.Sink()
+		if err := state.AddSink(sink); err != nil {
+			return err
+		}
+
+		// The messages waiting are published before the bus is closed, without
+		// waiting to retry the ones that fail.
+		defer func() {
+			brg.Stop()
+			state.RemoveSink(sink.Name)
+			brg.Close()
+		}()
+		log.Infow("startup", "status", "bridge registered", "bus", cfg.Bridge.Bus, "prefix", cfg.Bridge.Prefix)
+	}
+
+	// The index writes the chain into SQLite as blocks are applied. It catches
+	// up with the blocks on disk before the worker starts.
+	var idx *index.Index
+	if cfg.Index.Path != "" {
+		idx, err = index.Open(cfg.Index.Path, state, ev)
+		if err != nil {
+			return fmt.Errorf("unable to open index: %w", err)
+		}
+		sink := idx.Sink()
+		if err := state.AddSink(sink); err != nil {
+			idx.Close()
+			return err
+		}
+
+		// The events waiting are indexed before the index is closed.
+		defer func() {
+			state.RemoveSink(sink.Name)
+			idx.Close()
+		}()
+
+		if err := idx.Sync(context.Background()); err != nil {
+			return fmt.Errorf("unable to sync index: %w", err)
+		}
+		log.Infow("startup", "status", "index synced", "path", cfg.Index.Path)
+	}
+
+	// Report the block cache statistics with the other metrics.
+	metrics.PublishBlockCache(func() any { return state.BlockCacheStats() })
+
+	// Report the time spent in each stage of producing a block.
+	metrics.PublishProduction(func() any { return state.ProductionStats() })
+
+	// Report the time spent in each rule validating a block.
+	metrics.PublishValidation(func() any { return state.ValidationStats() })
+
 	// The worker package implements the different workflows such as mining,
 	// transaction peer sharing, and peer updates. The worker will register
 	// itself with the state.
-	worker.Run(state, ev)
+	wrk := worker.Run(state, ev)
+
+	// Report the transaction sharing statistics with the other metrics.
+	metrics.PublishTxShare(func() any { return wrk.ShareStats() })
+
+	// Start the other chains hosted by the node. Each chain has its own
+	// genesis, storage, mempool and worker and is served under its chain id.
+	chains := map[uint16]hostedChain{genesis.ChainID: {state: state, evts: evts, index: idx}}
+	for _, value := range cfg.State.Chains {
+		hc, err := startChain(log, value, stateCfg, cfg.State.DBCodec, evlog)
+		if err != nil {
+			return fmt.Errorf("unable to start chain %q: %w", value, err)
+		}
+		defer hc.state.Shutdown()
+		defer hc.evts.Shutdown()
+
+		chainID := hc.state.Genesis().ChainID
+		if _, exists := chains[chainID]; exists {
+			return fmt.Errorf("chain id %d is hosted more than once", chainID)
+		}
+		chains[chainID] = hc
+
+		log.Infow("startup", "status", "chain started", "chainid", chainID, "chain", value)
+	}
+
+	// =========================================================================
+	// Reload Support
+
+	// The reload file lets an operator change the settings that are safe to
+	// change without restarting the node. It's read at startup, each time it
+	// changes and when the node receives a SIGHUP.
+	if cfg.Reload.Path != "" {
+		watcher, err := reload.New(reload.Config{
+			Path:     cfg.Reload.Path,
+			Interval: cfg.Reload.Interval,
+			Node:     reloadNode{State: state, wrk: wrk, level: level},
+		})
+		if err != nil {
+			return fmt.Errorf("unable to construct reload watcher: %w", err)
+		}
+
+		if err := watcher.Reload(); err != nil {
+			return fmt.Errorf("unable to load reload file: %w", err)
+		}
+		watcher.Start()
+		defer watcher.Shutdown()
+
+		hangup := make(chan os.Signal, 1)
+		signal.Notify(hangup, syscall.SIGHUP)
+		defer signal.Stop(hangup)
+
+		go func() {
+			for range hangup {
+				log.Infow("reload", "status", "reloading settings", "path", cfg.Reload.Path)
+				watcher.Reload()
+			}
+		}()
+
+		log.Infow("startup", "status", "reload file loaded", "path", cfg.Reload.Path, "interval", cfg.Reload.Interval)
+	}
 
 	// =========================================================================
 	// Start Debug Service
@@ -206,7 +606,15 @@ func run(log *zap.SugaredLogger) error {
 	// related endpoints. This includes the standard library endpoints.
 
 	// Construct the mux for the debug calls.
-	debugMux := handlers.DebugMux(build, log)
+	// The health checker reports if the node is live and keeping up with the
+	// network for the readiness and liveness checks.
+	checker := health.New(health.Config{
+		State:     state,
+		Worker:    wrk,
+		MaxBehind: cfg.Health.MaxBehind,
+	})
+
+	debugMux := handlers.DebugMux(build, log, checker)
 
 	// Start the service listening for debug requests.
 	// Not concerned with shutting this down with load shedding.
@@ -233,14 +641,66 @@ func run(log *zap.SugaredLogger) error {
 
 	log.Infow("startup", "status", "initializing V1 public API support")
 
-	// Construct the mux for the public API calls.
-	publicMux := handlers.PublicMux(handlers.MuxConfig{
-		Shutdown: shutdown,
-		Log:      log,
-		State:    state,
-		NS:       ns,
-		Evts:     evts,
+	// Submitting a transaction takes an API token or a proof of work when
+	// either is configured.
+	guard, err := antispam.New(antispam.Config{
+		Tokens:   cfg.Antispam.Tokens,
+		WorkBits: cfg.Antispam.WorkBits,
 	})
+	if err != nil {
+		return fmt.Errorf("unable to configure antispam: %w", err)
+	}
+
+	// The admin token and the antispam tokens are keys for the admin and
+	// write roles, next to the keys configured for each role.
+	var keys []auth.Key
+	if cfg.Admin.Token != "" {
+		keys = append(keys, auth.Key{Name: "admin-token", Role: auth.RoleAdmin, Key: cfg.Admin.Token})
+	}
+	for i, token := range cfg.Antispam.Tokens {
+		keys = append(keys, auth.Key{Name: fmt.Sprintf("antispam-token-%d", i+1), Role: auth.RoleWrite, Key: token})
+	}
+	for _, s := range cfg.Auth.Keys {
+		key, err := auth.ParseKey(s)
+		if err != nil {
+			return fmt.Errorf("unable to parse api key: %w", err)
+		}
+		keys = append(keys, key)
+	}
+
+	authn, err := auth.New(auth.Config{
+		Keys:   keys,
+		Secret: cfg.Auth.Secret,
+		Reads:  cfg.Auth.Reads,
+		Writes: cfg.Auth.Writes,
+	})
+	if err != nil {
+		return fmt.Errorf("unable to configure auth: %w", err)
+	}
+
+	// A web wallet can call the node from the browser without a proxy.
+	var corsPath string
+	if cfg.Web.CorsWalletOnly {
+		corsPath = "/v1/wallet/"
+	}
+
+	// Construct the mux for the public API calls.
+	publicMuxes := make(map[uint16]http.Handler)
+	for chainID, hc := range chains {
+		publicMuxes[chainID] = handlers.PublicMux(handlers.MuxConfig{
+			Shutdown: shutdown,
+			Log:      log,
+			State:    hc.state,
+			NS:       ns,
+			Evts:     hc.evts,
+			Auth:     authn,
+			Antispam: guard,
+			Origins:  cfg.Web.CorsOrigins,
+			CorsPath: corsPath,
+			Index:    hc.index,
+		})
+	}
+	publicMux := handlers.ChainMux(publicMuxes[genesis.ChainID], publicMuxes)
 
 	// Construct a server to service the requests against the mux.
 	public := http.Server{
@@ -264,11 +724,15 @@ func run(log *zap.SugaredLogger) error {
 	log.Infow("startup", "status", "initializing V1 private API support")
 
 	// Construct the mux for the private API calls.
-	privateMux := handlers.PrivateMux(handlers.MuxConfig{
-		Shutdown: shutdown,
-		Log:      log,
-		State:    state,
-	})
+	privateMuxes := make(map[uint16]http.Handler)
+	for chainID, hc := range chains {
+		privateMuxes[chainID] = handlers.PrivateMux(handlers.MuxConfig{
+			Shutdown: shutdown,
+			Log:      log,
+			State:    hc.state,
+		})
+	}
+	privateMux := handlers.ChainMux(privateMuxes[genesis.ChainID], privateMuxes)
 
 	// Construct a server to service the requests against the mux.
 	private := http.Server{
@@ -286,6 +750,47 @@ func run(log *zap.SugaredLogger) error {
 		serverErrors <- private.ListenAndServe()
 	}()
 
+	// =========================================================================
+	// Start Admin Service
+
+	// The admin API lets an operator manage the running node. It's only started
+	// when an admin caller can be authenticated.
+	var admin *http.Server
+	if authn.Accepts(auth.RoleAdmin) {
+		log.Infow("startup", "status", "initializing V1 admin API support")
+
+		// Construct the mux for the admin API calls.
+		adminMuxes := make(map[uint16]http.Handler)
+		for chainID, hc := range chains {
+			adminMuxes[chainID] = handlers.AdminMux(handlers.MuxConfig{
+				Shutdown: shutdown,
+				Log:      log,
+				State:    hc.state,
+				EventLog: evlog,
+				Policy:   accountPolicy,
+				Auth:     authn,
+				Index:    hc.index,
+			})
+		}
+		adminMux := handlers.ChainMux(adminMuxes[genesis.ChainID], adminMuxes)
+
+		// Construct a server to service the requests against the mux.
+		admin = &http.Server{
+			Addr:         cfg.Web.AdminHost,
+			Handler:      adminMux,
+			ReadTimeout:  cfg.Web.ReadTimeout,
+			WriteTimeout: cfg.Web.WriteTimeout,
+			IdleTimeout:  cfg.Web.IdleTimeout,
+			ErrorLog:     zap.NewStdLog(log.Desugar()),
+		}
+
+		// Start the service listening for api requests.
+		go func() {
+			log.Infow("startup", "status", "admin api router started", "host", admin.Addr)
+			serverErrors <- admin.ListenAndServe()
+		}()
+	}
+
 	// =========================================================================
 	// Shutdown
 
@@ -302,6 +807,18 @@ func run(log *zap.SugaredLogger) error {
 		log.Infow("shutdown", "status", "shutdown web socket channels")
 		evts.Shutdown()
 
+		// Asking the admin listener to shut down and shed load.
+		if admin != nil {
+			ctx, cancelAdm := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
+			defer cancelAdm()
+
+			log.Infow("shutdown", "status", "shutdown admin API started")
+			if err := admin.Shutdown(ctx); err != nil {
+				admin.Close()
+				return fmt.Errorf("could not stop admin service gracefully: %w", err)
+			}
+		}
+
 		// Give outstanding requests a deadline for completion.
 		ctx, cancelPub := context.WithTimeout(context.Background(), cfg.Web.ShutdownTimeout)
 		defer cancelPub()
@@ -327,3 +844,102 @@ func run(log *zap.SugaredLogger) error {
 
 	return nil
 }
+
+// =============================================================================
+
+// reloadNode applies the settings from the reload file to the primary chain
+// and the logger of the node.
+type reloadNode struct {
+	*state.State
+	wrk   *worker.Worker
+	level zap.AtomicLevel
+}
+
+// SetPeerInterval changes how often the worker looks for peers and missing
+// blocks.
+func (rn reloadNode) SetPeerInterval(d time.Duration) {
+	rn.wrk.SetPeerInterval(d)
+}
+
+// SetLogLevel changes the level the node logs at.
+func (rn reloadNode) SetLogLevel(level string) error {
+	return rn.level.UnmarshalText([]byte(level))
+}
+
+// nodeStateFile is the name of the file in the db path the node state is
+// kept in across restarts, unless another file is configured.
+const nodeStateFile = "node-state.json"
+
+// hostedChain represents a chain hosted by the node.
+type hostedChain struct {
+	state *state.State
+	evts  *events.Events
+	index *index.Index // Only set for the primary chain when it's indexed.
+}
+
+// startChain constructs the state and worker for another chain hosted by the
+// node from its genesis-file|db-path value. The chain shares the node's keys,
+// peers and policy with the primary chain, and reaches its peers on the URLs
+// for its chain id.
+func startChain(log *zap.SugaredLogger, value string, base state.Config, codec string, evlog *eventlog.Log) (hostedChain, error) {
+	genesisPath, dbPath, found := strings.Cut(value, "|")
+	if !found || genesisPath == "" || dbPath == "" {
+		return hostedChain{}, errors.New("chain must be given as genesis-file|db-path")
+	}
+
+	gen, err := genesis.LoadFile(genesisPath)
+	if err != nil {
+		return hostedChain{}, err
+	}
+
+	storage, err := disk.NewWithCodec(dbPath, codec)
+	if err != nil {
+		return hostedChain{}, err
+	}
+
+	peerSet := peer.NewPeerSet()
+	for _, pr := range base.KnownPeers.Copy("") {
+		peerSet.Add(pr)
+	}
+
+	evts := events.New()
+
+	cfg := base
+	cfg.Genesis = gen
+	cfg.Storage = storage
+	cfg.KnownPeers = peerSet
+	cfg.NodeStatePath = filepath.Join(dbPath, nodeStateFile)
+	cfg.ChainScoped = true
+	cfg.EvHandler = eventHandler(log.With("chainid", gen.ChainID), evts, evlog)
+	cfg.Journal = nil
+	cfg.Tracer = nil
+
+	st, err := state.New(cfg)
+	if err != nil {
+		evts.Shutdown()
+		return hostedChain{}, err
+	}
+
+	worker.Run(st, cfg.EvHandler)
+
+	return hostedChain{state: st, evts: evts}, nil
+}
+
+// eventHandler constructs the function the blockchain packages log through.
+// For now, these raw messages are sent to any websocket client that is
+// connected into the system through the events package.
+func eventHandler(log *zap.SugaredLogger, evts *events.Events, evlog *eventlog.Log) state.EventHandler {
+	return func(v string, args ...any) {
+		const websocketPrefix = "viewer:"
+
+		s := fmt.Sprintf(v, args...)
+		log.Infow(s, "traceid", "00000000-0000-0000-0000-000000000000")
+		if strings.HasPrefix(s, websocketPrefix) {
+			evts.Send(s)
+		}
+
+		if err := evlog.Record(s); err != nil {
+			log.Errorw("event log", "ERROR", err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+// This program reads the output of go test -bench from stdin and reports the
+// results as JSON. The results can be saved as a baseline and later runs
+// compared against it so performance regressions are caught.
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+var (
+	baselinePath string
+	savePath     string
+	threshold    float64
+)
+
+func init() {
+	flag.StringVar(&baselinePath, "baseline", "", "path to saved results to compare against")
+	flag.StringVar(&savePath, "save", "", "path to save the results to as the new baseline")
+	flag.Float64Var(&threshold, "threshold", 20, "percent a result can get worse before it's reported as a regression")
+}
+
+// Result represents the measurements of a single benchmark.
+type Result struct {
+	Name        string  `json:"name"`
+	Iterations  int64   `json:"iterations"`
+	NsPerOp     float64 `json:"ns_per_op"`
+	BytesPerOp  float64 `json:"bytes_per_op"`
+	AllocsPerOp float64 `json:"allocs_per_op"`
+}
+
+// Regression represents a measurement that got worse than the threshold.
+type Regression struct {
+	Name     string  `json:"name"`
+	Metric   string  `json:"metric"`
+	Baseline float64 `json:"baseline"`
+	Current  float64 `json:"current"`
+	Change   float64 `json:"change"` // Percent the measurement got worse.
+}
+
+// Report represents the results and any regressions against the baseline.
+type Report struct {
+	Results     []Result     `json:"results"`
+	Regressions []Regression `json:"regressions,omitempty"`
+}
+
+func main() {
+	flag.Parse()
+
+	results, err := parse(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if len(results) == 0 {
+		log.Fatal("no benchmark results found in the input")
+	}
+
+	report := Report{
+		Results: results,
+	}
+
+	if baselinePath != "" {
+		baseline, err := load(baselinePath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		report.Regressions = compare(baseline, results, threshold)
+	}
+
+	if savePath != "" {
+		if err := save(savePath, results); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	data, err := json.MarshalIndent(report, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+
+	if len(report.Regressions) > 0 {
+		os.Exit(1)
+	}
+}
+
+// =============================================================================
+
+// procsSuffix matches the GOMAXPROCS suffix go test adds to benchmark names.
+var procsSuffix = regexp.MustCompile(`-\d+$`)
+
+// parse reads the benchmark lines from the go test output. The package is
+// added to the name of each benchmark so the names are unique.
+func parse(r io.Reader) ([]Result, error) {
+	var results []Result
+	var pkg string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		if strings.HasPrefix(line, "pkg: ") {
+			pkg = strings.TrimPrefix(line, "pkg: ")
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) < 4 || !strings.HasPrefix(fields[0], "Benchmark") {
+			continue
+		}
+
+		iterations, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			continue
+		}
+
+		result := Result{
+			Name:       pkg + "." + procsSuffix.ReplaceAllString(fields[0], ""),
+			Iterations: iterations,
+		}
+
+		for i := 2; i+1 < len(fields); i += 2 {
+			value, err := strconv.ParseFloat(fields[i], 64)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %q: %w", line, err)
+			}
+
+			switch fields[i+1] {
+			case "ns/op":
+				result.NsPerOp = value
+			case "B/op":
+				result.BytesPerOp = value
+			case "allocs/op":
+				result.AllocsPerOp = value
+			}
+		}
+
+		results = append(results, result)
+	}
+
+	return results, scanner.Err()
+}
+
+// compare returns the measurements that got worse than the baseline by more
+// than the threshold percent. Benchmarks without a baseline are skipped.
+func compare(baseline []Result, results []Result, threshold float64) []Regression {
+	base := make(map[string]Result)
+	for _, result := range baseline {
+		base[result.Name] = result
+	}
+
+	var regressions []Regression
+	for _, result := range results {
+		old, exists := base[result.Name]
+		if !exists {
+			continue
+		}
+
+		metrics := []struct {
+			name    string
+			old     float64
+			current float64
+		}{
+			{"ns/op", old.NsPerOp, result.NsPerOp},
+			{"B/op", old.BytesPerOp, result.BytesPerOp},
+			{"allocs/op", old.AllocsPerOp, result.AllocsPerOp},
+		}
+
+		for _, m := range metrics {
+			if m.old == 0 {
+				continue
+			}
+
+			change := (m.current - m.old) / m.old * 100
+			if change > threshold {
+				regressions = append(regressions, Regression{
+					Name:     result.Name,
+					Metric:   m.name,
+					Baseline: m.old,
+					Current:  m.current,
+					Change:   change,
+				})
+			}
+		}
+	}
+
+	sort.Slice(regressions, func(i, j int) bool { return regressions[i].Change > regressions[j].Change })
+
+	return regressions
+}
+
+// load reads the results saved as a baseline.
+func load(path string) ([]Result, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, fmt.Errorf("decoding baseline %s: %w", path, err)
+	}
+
+	return results, nil
+}
+
+// save writes the results as the new baseline.
+func save(path string, results []Result) error {
+	data, err := json.MarshalIndent(results, "", "    ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, data, 0644)
+}
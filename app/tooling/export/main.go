@@ -0,0 +1,84 @@
+// This program exports the block headers or transactions of a blockchain
+// stored on disk as CSV, so the chain history can be loaded into analytics
+// tools without running a node.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+var (
+	dbPath string
+	table  string
+	from   uint64
+	to     uint64
+	out    string
+)
+
+func init() {
+	flag.StringVar(&dbPath, "db-path", "zblock/miner1/", "path to the blockchain on disk")
+	flag.StringVar(&table, "table", database.ExportTransactions, "table to export, blocks or transactions")
+	flag.Uint64Var(&from, "from", 1, "first block to export")
+	flag.Uint64Var(&to, "to", 0, "last block to export, 0 exports to the latest block")
+	flag.StringVar(&out, "out", "", "file to write the CSV to, unset writes to stdout")
+}
+
+func main() {
+	flag.Parse()
+
+	storage, err := disk.New(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+
+	// Allow a long export to be stopped with ctrl-c.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if to == 0 {
+		if to, err = latestBlock(ctx, storage); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	w := os.Stdout
+	if out != "" {
+		f, err := os.Create(out)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if err := database.ExportStorageCSV(ctx, w, storage, table, from, to); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Fprintf(os.Stderr, "exported %s from block %d to %d, schema version %d\n", table, from, to, database.ExportVersion)
+}
+
+// latestBlock walks the blocks in storage to find the number of the last one.
+func latestBlock(ctx context.Context, storage database.Storage) (uint64, error) {
+	var latest uint64
+
+	iter := database.IteratorCtx(ctx, storage.ForEach())
+	for blockData, err := iter.Next(); !iter.Done(); blockData, err = iter.Next() {
+		if err != nil {
+			return 0, err
+		}
+		latest = blockData.Header.Number
+	}
+
+	return latest, nil
+}
@@ -0,0 +1,93 @@
+// This program generates a genesis file for a new chain from the accounts of
+// a blockchain stored on disk at a block, for a planned network restart or a
+// spinoff.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+var (
+	dbPath  string
+	block   uint64
+	chainID uint
+	network string
+	out     string
+)
+
+func init() {
+	flag.StringVar(&dbPath, "db-path", "zblock/miner1/", "path to the blockchain on disk")
+	flag.Uint64Var(&block, "block", 0, "block to take the accounts from, 0 for the latest block")
+	flag.UintVar(&chainID, "chain-id", 0, "chain id for the new chain, 0 keeps the chain id")
+	flag.StringVar(&network, "network", "", "network name for the new chain, empty keeps the network")
+	flag.StringVar(&out, "out", "", "file to write the genesis to, empty writes to stdout")
+}
+
+func main() {
+	flag.Parse()
+
+	gen, err := genesis.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := disk.New(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+
+	db, err := database.New(gen, storage, func(v string, args ...any) {})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if block == 0 {
+		block = db.LatestBlock().Header.Number
+	}
+
+	// Allow a long replay to be stopped with ctrl-c.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	fork, err := db.ForkGenesis(ctx, block)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if chainID != 0 {
+		fork.ChainID = uint16(chainID)
+	}
+	if network != "" {
+		fork.Network = network
+	}
+
+	if err := fork.ValidateNetwork(); err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(fork, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if out == "" {
+		fmt.Println(string(data))
+		return
+	}
+
+	if err := os.WriteFile(out, append(data, '\n'), 0644); err != nil {
+		log.Fatal(err)
+	}
+}
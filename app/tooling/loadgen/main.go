@@ -0,0 +1,118 @@
+// This program generates signed transaction traffic from many accounts
+// against one or more nodes and reports the throughput and latency.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/loadgen"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	urls       string
+	funderPath string
+	fundAmount uint64
+	accounts   int
+	seed       int64
+	rate       float64
+	duration   time.Duration
+	count      int
+	workers    int
+	minValue   uint64
+	maxValue   uint64
+	valueDist  string
+	skew       float64
+	tip        uint64
+	verbose    bool
+)
+
+func init() {
+	flag.StringVar(&urls, "urls", "http://localhost:8080", "comma separated list of node urls to send transactions to")
+	flag.StringVar(&funderPath, "funder", "zblock/accounts/kennedy.ecdsa", "path to the key of the account funding the generated accounts, empty skips funding")
+	flag.Uint64Var(&fundAmount, "fund-amount", 1_000_000, "amount sent to each generated account")
+	flag.IntVar(&accounts, "accounts", 10, "number of sending accounts")
+	flag.Int64Var(&seed, "seed", 1, "seed for the accounts and the traffic")
+	flag.Float64Var(&rate, "rate", 10, "transactions per second, 0 sends as fast as possible")
+	flag.DurationVar(&duration, "duration", 30*time.Second, "time to generate traffic, 0 runs until the count is reached")
+	flag.IntVar(&count, "count", 0, "number of transactions to send, 0 has no limit")
+	flag.IntVar(&workers, "workers", 4, "number of workers signing and submitting transactions")
+	flag.Uint64Var(&minValue, "min-value", 1, "smallest value sent in a transaction")
+	flag.Uint64Var(&maxValue, "max-value", 100, "largest value sent in a transaction")
+	flag.StringVar(&valueDist, "dist", loadgen.DistUniform, "distribution of the values, uniform or exponential")
+	flag.Float64Var(&skew, "skew", 0, "zipf skew above 1 concentrates traffic on a few accounts")
+	flag.Uint64Var(&tip, "tip", 0, "tip offered on every transaction")
+	flag.BoolVar(&verbose, "verbose", false, "show the progress of the run")
+}
+
+func main() {
+	flag.Parse()
+
+	gen, err := genesis.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg := loadgen.Config{
+		URLs:       strings.Split(urls, ","),
+		ChainID:    gen.ChainID,
+		FundAmount: fundAmount,
+		Accounts:   accounts,
+		Seed:       seed,
+		Rate:       rate,
+		Duration:   duration,
+		Count:      count,
+		Workers:    workers,
+		MinValue:   minValue,
+		MaxValue:   maxValue,
+		ValueDist:  valueDist,
+		Skew:       skew,
+		Tip:        tip,
+		Log: func(v string, args ...any) {
+			if verbose {
+				fmt.Printf(v+"\n", args...)
+			}
+		},
+	}
+
+	if funderPath != "" {
+		if cfg.Funder, err = crypto.LoadECDSA(funderPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	g, err := loadgen.New(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Allow a long run to be stopped with ctrl-c and still report the stats.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if cfg.Funder != nil {
+		if err := g.Fund(ctx); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	stats, err := g.Run(ctx)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(stats, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+}
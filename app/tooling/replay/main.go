@@ -0,0 +1,105 @@
+// This program replays a journal recorded by a node against a fresh node in
+// memory and reports every input that produced a different result than when
+// it was recorded.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	journalPath    string
+	consensus      string
+	selectStrategy string
+	finalityDepth  uint64
+	until          uint64
+	verbose        bool
+)
+
+func init() {
+	flag.StringVar(&journalPath, "journal", "zblock/miner1.journal", "path to the journal to replay")
+	flag.StringVar(&consensus, "consensus", state.ConsensusPOW, "consensus protocol used by the node")
+	flag.StringVar(&selectStrategy, "select-strategy", "Tip", "mempool select strategy used by the node")
+	flag.Uint64Var(&finalityDepth, "finality-depth", 6, "finality depth used by the node")
+	flag.Uint64Var(&until, "until", 0, "stop after the entry with this sequence, 0 replays everything")
+	flag.BoolVar(&verbose, "verbose", false, "show each replay step")
+}
+
+func main() {
+	flag.Parse()
+
+	gen, err := genesis.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	f, err := os.Open(journalPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer f.Close()
+
+	storage, err := memory.New()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ev := func(v string, args ...any) {
+		if verbose {
+			fmt.Printf(v+"\n", args...)
+		}
+	}
+
+	// The replay never proposes blocks, but a node running PoS must have a
+	// key to start.
+	privateKey, err := crypto.GenerateKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	st, err := state.New(state.Config{
+		Storage:        storage,
+		Genesis:        gen,
+		SelectStrategy: selectStrategy,
+		KnownPeers:     peer.NewPeerSet(),
+		EvHandler:      ev,
+		Consensus:      consensus,
+		FinalityDepth:  finalityDepth,
+		PrivateKey:     privateKey,
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// Allow a long replay to be stopped with ctrl-c.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := st.Replay(ctx, f, until)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+
+	if len(result.Divergences) > 0 {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,64 @@
+// This program issues the API keys and signed tokens that authenticate the
+// callers of a node, so an operator can hand out access without editing the
+// node's code.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+)
+
+var (
+	subject string
+	role    string
+	ttl     time.Duration
+	key     bool
+)
+
+func init() {
+	flag.StringVar(&subject, "subject", "", "caller the key or token is issued to")
+	flag.StringVar(&role, "role", string(auth.RoleRead), "role of the caller, read, write or admin")
+	flag.DurationVar(&ttl, "ttl", 24*time.Hour, "time the token is valid for")
+	flag.BoolVar(&key, "key", false, "generate an API key for the node's auth-keys instead of a token")
+}
+
+func main() {
+	flag.Parse()
+
+	if subject == "" {
+		log.Fatal("a subject is required")
+	}
+
+	if key {
+		k, err := auth.NewKey(subject, auth.Role(role))
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if _, err := auth.New(auth.Config{Keys: []auth.Key{k}}); err != nil {
+			log.Fatal(err)
+		}
+
+		fmt.Println(k)
+		return
+	}
+
+	// The secret is read from the environment so it isn't kept in the
+	// shell's history.
+	a, err := auth.New(auth.Config{Secret: os.Getenv("NODE_AUTH_SECRET")})
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	token, err := a.GenerateToken(subject, auth.Role(role), ttl)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(token)
+}
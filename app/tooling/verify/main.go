@@ -0,0 +1,70 @@
+// This program verifies the integrity of a blockchain stored on disk and
+// optionally repairs it by truncating the chain to the last valid block.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+var (
+	dbPath  string
+	repair  bool
+	verbose bool
+)
+
+func init() {
+	flag.StringVar(&dbPath, "db-path", "zblock/miner1/", "path to the blockchain on disk")
+	flag.BoolVar(&repair, "repair", false, "truncate the chain to the last valid block")
+	flag.BoolVar(&verbose, "verbose", false, "show each validation step")
+}
+
+func main() {
+	flag.Parse()
+
+	gen, err := genesis.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := disk.New(dbPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer storage.Close()
+
+	ev := func(v string, args ...any) {
+		if verbose {
+			fmt.Printf(v+"\n", args...)
+		}
+	}
+
+	// Allow a long verification to be stopped with ctrl-c.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	result, err := database.VerifyStorage(ctx, gen, storage, repair, ev)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	data, err := json.MarshalIndent(result, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	fmt.Println(string(data))
+
+	if result.CorruptBlock != 0 && !result.Repaired {
+		os.Exit(1)
+	}
+}
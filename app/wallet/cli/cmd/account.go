@@ -9,6 +9,8 @@ import (
 	"github.com/spf13/cobra"
 )
 
+var bech32 bool
+
 var accountCmd = &cobra.Command{
 	Use:   "account",
 	Short: "Print account for the specific wallet",
@@ -17,6 +19,7 @@ var accountCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(accountCmd)
+	accountCmd.Flags().BoolVar(&bech32, "bech32", false, "Print the account encoded with bech32.")
 }
 
 func accountRun(cmd *cobra.Command, args []string) {
@@ -26,5 +29,9 @@ func accountRun(cmd *cobra.Command, args []string) {
 	}
 
 	accountID := database.PublicKeyToAccountID(privateKey.PublicKey)
+	if bech32 {
+		fmt.Println(accountID.Bech32())
+		return
+	}
 	fmt.Println(accountID)
 }
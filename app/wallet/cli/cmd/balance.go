@@ -1,27 +1,16 @@
 package cmd
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
-	"net/http"
+	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
 )
 
-type balance struct {
-	Account string `json:"account"`
-	Balance uint   `json:"balance"`
-}
-
-type balances struct {
-	LastestBlock string    `json:"lastest_block"`
-	Uncommitted  int       `json:"uncommitted"`
-	Balances     []balance `json:"balances"`
-}
-
 var balanceCmd = &cobra.Command{
 	Use:   "balance",
 	Short: "Print your balance.",
@@ -42,19 +31,20 @@ func balanceRun(cmd *cobra.Command, args []string) {
 	accountID := database.PublicKeyToAccountID(privateKey.PublicKey)
 	fmt.Println("For Account:", accountID)
 
-	resp, err := http.Get(fmt.Sprintf("%s/v1/accounts/list/%s", url, accountID))
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	account, err := newClient().GetAccount(ctx, accountID)
 	if err != nil {
 		log.Fatal(err)
 	}
-	defer resp.Body.Close()
 
-	decoder := json.NewDecoder(resp.Body)
-	var balances balances
-	if err := decoder.Decode(&balances); err != nil {
-		log.Fatal(err)
+	fmt.Println(account.Balance)
+	if account.Locked > 0 {
+		fmt.Println("locked:", account.Locked)
 	}
-
-	if len(balances.Balances) > 0 {
-		fmt.Println(balances.Balances[0].Balance)
+	if account.Immature > 0 {
+		fmt.Println("immature rewards:", account.Immature)
 	}
+	fmt.Println("next nonce:", account.Nonce+1)
 }
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var cancelCmd = &cobra.Command{
+	Use:   "cancel",
+	Short: "Cancel a pending transaction",
+	Run:   cancelRun,
+}
+
+func init() {
+	rootCmd.AddCommand(cancelCmd)
+	cancelCmd.Flags().StringVarP(&url, "url", "u", "http://localhost:8080", "Url of the node.")
+	cancelCmd.Flags().Uint64VarP(&nonce, "nonce", "n", 0, "Nonce of the pending transaction to cancel.")
+	cancelCmd.Flags().Uint64VarP(&tip, "tip", "c", 0, "Tip for the cancellation, defaults to the least needed to replace the pending transaction.")
+}
+
+func cancelRun(cmd *cobra.Command, args []string) {
+	privateKey, err := crypto.LoadECDSA(getPrivateKeyPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	accountID := database.PublicKeyToAccountID(privateKey.PublicKey)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	client := newClient()
+
+	// The node builds the cancellation so it offers a high enough tip to
+	// replace the pending transaction.
+	tx, err := client.CancelTx(ctx, accountID, nonce)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if tip > 0 {
+		if tip < tx.Tip {
+			log.Fatalf("tip %d is too low to replace the pending transaction, need %d", tip, tx.Tip)
+		}
+		tx.Tip = tip
+	}
+
+	signedTx, err := tx.Sign(privateKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := client.SubmitTx(ctx, signedTx); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("cancellation:", signedTx.TxHash(), "tip:", tx.Tip)
+}
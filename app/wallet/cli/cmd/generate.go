@@ -1,8 +1,10 @@
 package cmd
 
 import (
+	"fmt"
 	"log"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
 )
@@ -31,4 +33,6 @@ func generateRun(cmd *cobra.Command, args []string) {
 	if err := crypto.SaveECDSA(getPrivateKeyPath(), privateKey); err != nil {
 		log.Fatal(err)
 	}
+
+	fmt.Println(database.PublicKeyToAccountID(privateKey.PublicKey))
 }
@@ -6,12 +6,15 @@ import (
 	"path/filepath"
 	"strings"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/client"
 	"github.com/spf13/cobra"
 )
 
 var (
 	accountName string
 	accountPath string
+	apiToken    string
+	workBits    int
 )
 
 const (
@@ -22,6 +25,8 @@ func init() {
 	rootCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	rootCmd.PersistentFlags().StringVarP(&accountName, "account", "a", "private.ecdsa", "The account to use.")
 	rootCmd.PersistentFlags().StringVarP(&accountPath, "account-path", "p", "zblock/accounts/", "Path to the directory with private keys.")
+	rootCmd.PersistentFlags().StringVar(&apiToken, "api-token", "", "API token for a node that requires one to submit transactions.")
+	rootCmd.PersistentFlags().IntVar(&workBits, "work-bits", 0, "Bits of proof of work to solve for a node that requires it to submit transactions.")
 }
 
 var rootCmd = &cobra.Command{
@@ -37,9 +42,18 @@ func Execute() {
 }
 
 func getPrivateKeyPath() string {
-	if !strings.HasSuffix(accountName, keyExtenstion) {
-		accountName += keyExtenstion
+	return getKeyPath(accountName)
+}
+
+func getKeyPath(name string) string {
+	if !strings.HasSuffix(name, keyExtenstion) {
+		name += keyExtenstion
 	}
 
-	return filepath.Join(accountPath, accountName)
+	return filepath.Join(accountPath, name)
+}
+
+// newClient constructs a client for the node at the url flag.
+func newClient() *client.Client {
+	return client.New(client.Config{URL: url, Token: apiToken, WorkBits: workBits})
 }
@@ -1,14 +1,19 @@
 package cmd
 
 import (
-	"bytes"
+	"context"
 	"crypto/ecdsa"
 	"encoding/json"
 	"fmt"
 	"log"
-	"net/http"
+	"os"
+	"strings"
+	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/client"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/spf13/cobra"
 )
@@ -20,7 +25,31 @@ var (
 	to    string
 	value uint64
 	tip   uint64
+	fee   string
 	data  []byte
+
+	chainID    uint16
+	validUntil uint64
+	feePayer   string
+	canonical  bool
+
+	escrow        string
+	escrowExpires uint64
+
+	propose    string
+	proposeVal uint64
+	activateAt uint64
+	vote       string
+
+	bond         string
+	bondAmount   uint64
+	bondBLS      bool
+	evidencePath string
+
+	registerName string
+	releaseName  string
+
+	signedPath string
 )
 
 var sendCmd = &cobra.Command{
@@ -32,53 +61,259 @@ var sendCmd = &cobra.Command{
 func init() {
 	rootCmd.AddCommand(sendCmd)
 	sendCmd.Flags().StringVarP(&url, "url", "u", "http://localhost:8080", "Url of the node.")
-	sendCmd.Flags().Uint64VarP(&nonce, "nonce", "n", 0, "id for the transaction.")
-	sendCmd.Flags().StringVarP(&from, "from", "f", "", "Who is sending the transaction.")
-	sendCmd.Flags().StringVarP(&to, "to", "t", "", "Who is receiving the transaction.")
-	sendCmd.Flags().Uint64VarP(&value, "value", "v", 0, "Value to send.")
-	sendCmd.Flags().Uint64VarP(&tip, "tip", "c", 0, "Tip to send.")
-	sendCmd.Flags().BytesHexVarP(&data, "data", "d", nil, "Data to send.")
+	sendCmd.Flags().StringVar(&signedPath, "signed", "", "Path to a JSON or raw file with a transaction signed by the sign command.")
+	addTxFlags(sendCmd)
+}
+
+// addTxFlags adds the flags that describe a transaction to the command.
+func addTxFlags(cmd *cobra.Command) {
+	cmd.Flags().Uint16Var(&chainID, "chain-id", 1, "Chain id the transaction is signed for.")
+	cmd.Flags().Uint64VarP(&nonce, "nonce", "n", 0, "id for the transaction.")
+	cmd.Flags().StringVarP(&from, "from", "f", "", "Who is sending the transaction.")
+	cmd.Flags().StringVarP(&to, "to", "t", "", "Who is receiving the transaction.")
+	cmd.Flags().Uint64VarP(&value, "value", "v", 0, "Value to send.")
+	cmd.Flags().Uint64VarP(&tip, "tip", "c", 0, "Tip to send.")
+	cmd.Flags().StringVar(&fee, "fee", "", "Use the tip the node suggests for slow, normal or fast inclusion instead of the tip flag.")
+	cmd.Flags().BytesHexVarP(&data, "data", "d", nil, "Data to send.")
+	cmd.Flags().Uint64VarP(&validUntil, "valid-until", "e", 0, "Last block number the transaction can be mined into.")
+	cmd.Flags().StringVarP(&feePayer, "fee-payer", "s", "", "Account that sponsors the fees for the transaction.")
+	cmd.Flags().BoolVar(&canonical, "canonical", false, "Sign with the canonical encoding, the chain must have switched to it.")
+	cmd.Flags().StringVarP(&escrow, "escrow", "w", "", "Escrow operation to perform: create, release or refund.")
+	cmd.Flags().Uint64Var(&escrowExpires, "escrow-expires", 0, "Block number after which the payer can refund a created escrow.")
+	cmd.Flags().StringVar(&propose, "propose", "", "Governance parameter to propose a change for.")
+	cmd.Flags().Uint64Var(&proposeVal, "propose-value", 0, "New value for the proposed parameter.")
+	cmd.Flags().Uint64Var(&activateAt, "activate-at", 0, "Block number the proposed change activates at.")
+	cmd.Flags().StringVar(&vote, "vote", "", "Governance proposal id to vote for.")
+	cmd.Flags().StringVar(&bond, "bond", "", "Bond operation to perform: lock, unlock, withdraw or evidence.")
+	cmd.Flags().Uint64Var(&bondAmount, "bond-amount", 0, "Amount of the bond to unlock.")
+	cmd.Flags().BoolVar(&bondBLS, "bond-bls", false, "Register the BLS key the node derives from the account key to vote for blocks, with a bond lock.")
+	cmd.Flags().StringVar(&evidencePath, "evidence", "", "Path to a JSON file with the evidence of a validator signing two blocks.")
+	cmd.Flags().StringVar(&registerName, "register-name", "", "Name to register for the sending account, the to field isn't needed.")
+	cmd.Flags().StringVar(&releaseName, "release-name", "", "Name owned by the sending account to release, the to field isn't needed.")
 }
 
 func sendRun(cmd *cobra.Command, args []string) {
-	privateKey, err := crypto.LoadECDSA(getPrivateKeyPath())
+	var signedTx database.SignedTx
+
+	switch signedPath {
+	case "":
+		privateKey, err := crypto.LoadECDSA(getPrivateKeyPath())
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		signedTx = signWithDetails(privateKey)
+
+	default:
+		content, err := os.ReadFile(signedPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		// The raw encoding is written as hex and the node decodes it.
+		if raw, err := hexutil.Decode(strings.TrimSpace(string(content))); err == nil {
+			sendRaw(raw)
+			return
+		}
+
+		if err := json.Unmarshal(content, &signedTx); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := newClient().SubmitTx(ctx, signedTx); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("transaction:", signedTx.TxHash())
+}
+
+// sendRaw submits the transaction in the raw encoding.
+func sendRaw(raw []byte) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	txHash, err := newClient().SubmitRawTx(ctx, raw)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sendWithDetails(privateKey)
+	fmt.Println("transaction:", txHash)
 }
 
-func sendWithDetails(privateKey *ecdsa.PrivateKey) {
+// signWithDetails constructs the transaction described by the flags and
+// signs it with the private key.
+func signWithDetails(privateKey *ecdsa.PrivateKey) database.SignedTx {
 	fromAccount, err := database.ToAccountID(from)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	toAccount, err := database.ToAccountID(to)
+	toAccount, err := resolveTo()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	const chainID = 1
+	// An escrow operation replaces any data provided for the transaction.
+	if escrow != "" {
+		data, err = database.EscrowOp{Op: escrow, ExpiresAt: escrowExpires}.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if escrow == database.EscrowCreate {
+			fmt.Println("escrow account:", database.EscrowAccountID(fromAccount, nonce))
+		}
+	}
+
+	// A governance operation replaces any data provided for the transaction.
+	switch {
+	case propose != "":
+		data, err = database.GovOp{Op: database.GovPropose, Param: propose, Value: proposeVal, ActivateAt: activateAt}.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Println("proposal:", database.ProposalID(fromAccount, nonce))
+
+	case vote != "":
+		data, err = database.GovOp{Op: database.GovVote, ProposalID: vote}.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case bond != "":
+		op := database.BondOp{Op: bond, Amount: bondAmount}
+		if evidencePath != "" {
+			content, err := os.ReadFile(evidencePath)
+			if err != nil {
+				log.Fatal(err)
+			}
+
+			op.Evidence = new(database.Evidence)
+			if err := json.Unmarshal(content, op.Evidence); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		// The node derives the same BLS key from the account key when it
+		// runs PoS, so the key doesn't have to be managed separately.
+		if bondBLS {
+			blsKey, err := signature.DeriveBLSKey(crypto.FromECDSA(privateKey))
+			if err != nil {
+				log.Fatal(err)
+			}
+			op.BLSKey = blsKey.PublicKey()
+			op.BLSProof = blsKey.ProvePossession()
+		}
+
+		data, err = op.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+	case registerName != "" || releaseName != "":
+		op := database.NameOp{Op: database.NameRegister, Name: registerName}
+		if releaseName != "" {
+			op = database.NameOp{Op: database.NameRelease, Name: releaseName}
+		}
+
+		data, err = op.Data()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if fee != "" {
+		tip, err = suggestedTip()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
 	tx, err := database.NewTx(chainID, nonce, fromAccount, toAccount, value, tip, data)
 	if err != nil {
 		log.Fatal(err)
 	}
+	tx.ValidUntil = validUntil
+	if canonical {
+		tx.Encoding = signature.EncodingCanonical
+	}
+
+	// A sponsored transaction is also signed with the fee payer's key.
+	var feePayerKey *ecdsa.PrivateKey
+	if feePayer != "" {
+		feePayerKey, err = crypto.LoadECDSA(getKeyPath(feePayer))
+		if err != nil {
+			log.Fatal(err)
+		}
+		tx.FeePayerID = database.PublicKeyToAccountID(feePayerKey.PublicKey)
+	}
 
 	signedTx, err := tx.Sign(privateKey)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	data, err := json.Marshal(signedTx)
+	if feePayerKey != nil {
+		signedTx, err = signedTx.SignFeePayer(feePayerKey)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	return signedTx
+}
+
+// resolveTo returns the account the transaction is sent to. A name operation
+// is sent to the account for the name and a registered name is resolved to
+// its owner by the node.
+func resolveTo() (database.AccountID, error) {
+	switch {
+	case registerName != "":
+		return database.NameAccountID(registerName), nil
+	case releaseName != "":
+		return database.NameAccountID(releaseName), nil
+	case database.ValidateName(to) != nil:
+		return database.ToAccountID(to)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	accountID, err := newClient().Resolve(ctx, to)
 	if err != nil {
-		log.Fatal(err)
+		return "", fmt.Errorf("resolving name %q: %w", to, err)
 	}
+	fmt.Println("resolved:", to, "to", accountID)
 
-	resp, err := http.Post(fmt.Sprintf("%s/v1/tx/submit", url), "application/json", bytes.NewBuffer(data))
+	return accountID, nil
+}
+
+// suggestedTip returns the tip the node suggests for the fee tier.
+func suggestedTip() (uint64, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	est, err := newClient().EstimateFee(ctx)
 	if err != nil {
-		log.Fatal(err)
+		return 0, err
 	}
-	defer resp.Body.Close()
+
+	var tier client.FeeTier
+	switch fee {
+	case "slow":
+		tier = est.Slow
+	case "normal":
+		tier = est.Normal
+	case "fast":
+		tier = est.Fast
+	default:
+		return 0, fmt.Errorf("unknown fee tier %q", fee)
+	}
+	fmt.Printf("fee: %s tip %d, mined in about %d blocks\n", fee, tier.Tip, tier.Blocks)
+
+	return tier.Tip, nil
 }
@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var (
+	signOut string
+	signRaw bool
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign",
+	Short: "Sign a transaction without sending it",
+	Run:   signRun,
+}
+
+func init() {
+	rootCmd.AddCommand(signCmd)
+	signCmd.Flags().StringVarP(&signOut, "out", "o", "", "Path to write the signed transaction to instead of printing it.")
+	signCmd.Flags().BoolVar(&signRaw, "raw", false, "Write the signed transaction in the raw encoding as hex instead of JSON.")
+	addTxFlags(signCmd)
+}
+
+func signRun(cmd *cobra.Command, args []string) {
+	privateKey, err := crypto.LoadECDSA(getPrivateKeyPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	signedTx := signWithDetails(privateKey)
+
+	data, err := json.MarshalIndent(signedTx, "", "    ")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if signRaw {
+		raw, err := database.EncodeRawTx(signedTx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		data = []byte(hexutil.Encode(raw))
+	}
+
+	if signOut == "" {
+		fmt.Println(string(data))
+		return
+	}
+
+	if err := os.WriteFile(signOut, data, 0600); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("transaction:", signedTx.TxHash())
+}
@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/spf13/cobra"
+)
+
+var watchCmd = &cobra.Command{
+	Use:   "watch",
+	Short: "Print the transactions for your account as blocks are mined",
+	Run:   watchRun,
+}
+
+func init() {
+	rootCmd.AddCommand(watchCmd)
+	watchCmd.Flags().StringVarP(&url, "url", "u", "http://localhost:8080", "Url of the node.")
+}
+
+func watchRun(cmd *cobra.Command, args []string) {
+	privateKey, err := crypto.LoadECDSA(getPrivateKeyPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	accountID := database.PublicKeyToAccountID(privateKey.PublicKey)
+	fmt.Println("Watching Account:", accountID)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	f := func(block database.BlockData) error {
+		for _, tx := range block.Trans {
+			if tx.FromID != accountID && tx.ToID != accountID && tx.FeePayerID != accountID {
+				continue
+			}
+
+			fmt.Printf("block[%d] tx[%s] from[%s] to[%s] nonce[%d] value[%d] tip[%d]\n",
+				block.Header.Number, tx.TxHash(), tx.FromID, tx.ToID, tx.Nonce, tx.Value, tx.Tip)
+		}
+
+		return nil
+	}
+
+	if err := newClient().WatchBlocks(ctx, f); err != nil && ctx.Err() == nil {
+		log.Fatal(err)
+	}
+}
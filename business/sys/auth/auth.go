@@ -0,0 +1,319 @@
+// Package auth provides the API keys and signed tokens that authenticate the
+// callers of the node's APIs, with the role each caller is allowed to act in.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Role represents what a caller is allowed to do. Each role is allowed to do
+// everything the roles before it are.
+type Role string
+
+// Set of roles a caller can have.
+const (
+	RoleRead  Role = "read"  // Query the chain, accounts and mempool.
+	RoleWrite Role = "write" // Submit transactions.
+	RoleAdmin Role = "admin" // Manage the node's peers, sync, mining and mempool.
+)
+
+// rank orders the roles from the least to the most allowed.
+var rank = map[Role]int{
+	RoleRead:  1,
+	RoleWrite: 2,
+	RoleAdmin: 3,
+}
+
+// minSecret is the shortest secret accepted for signing tokens.
+const minSecret = 32
+
+// ErrUnauthenticated is returned when a token is not a known key or a valid
+// signed token.
+var ErrUnauthenticated = errors.New("not authorized")
+
+// =============================================================================
+
+// Key represents an API key and the role of the caller using it.
+type Key struct {
+	Name string
+	Role Role
+	Key  string
+}
+
+// ParseKey parses a key in the name:role:key form used in the configuration.
+func ParseKey(s string) (Key, error) {
+	parts := strings.SplitN(s, ":", 3)
+	if len(parts) != 3 {
+		return Key{}, errors.New("expected api key format: name:role:key")
+	}
+
+	key := Key{
+		Name: parts[0],
+		Role: Role(parts[1]),
+		Key:  parts[2],
+	}
+
+	return key, nil
+}
+
+// NewKey generates a random key for the caller with the role.
+func NewKey(name string, role Role) (Key, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return Key{}, err
+	}
+
+	key := Key{
+		Name: name,
+		Role: role,
+		Key:  hex.EncodeToString(b),
+	}
+
+	return key, nil
+}
+
+// String returns the key in the form used in the configuration.
+func (k Key) String() string {
+	return fmt.Sprintf("%s:%s:%s", k.Name, k.Role, k.Key)
+}
+
+// =============================================================================
+
+// Claims represents the caller a key or token was issued to.
+type Claims struct {
+	Subject   string `json:"sub"`
+	Role      Role   `json:"role"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty"`
+}
+
+// Allows reports if the caller is allowed to act in the role.
+func (c Claims) Allows(role Role) bool {
+	return rank[c.Role] > 0 && rank[c.Role] >= rank[role]
+}
+
+// ctxKey represents the type of value for the context key.
+type ctxKey int
+
+// key is used to store/retrieve the claims from a context.Context.
+const key ctxKey = 1
+
+// SetClaims stores the claims of the authenticated caller in the context.
+func SetClaims(ctx context.Context, claims Claims) context.Context {
+	return context.WithValue(ctx, key, claims)
+}
+
+// GetClaims returns the claims of the authenticated caller from the context.
+func GetClaims(ctx context.Context) (Claims, bool) {
+	claims, ok := ctx.Value(key).(Claims)
+	return claims, ok
+}
+
+// =============================================================================
+
+// Config represents the configuration for authenticating callers.
+type Config struct {
+	Keys   []Key
+	Secret string // Secret signing the tokens, unset only accepts the keys.
+	Reads  bool   // Require a caller with the read role for the public reads.
+	Writes bool   // Require a caller with the write role to submit transactions.
+}
+
+// CORE NOTE: The admin endpoints always need an admin caller, while the
+// public reads and the transaction submissions are open unless the node is
+// configured to require a caller for them. An API key is a secret the node
+// holds, so it's the simplest to hand out and revoke. A signed token is a
+// JWT signed with HS256 by whoever holds the secret, so callers can be
+// issued tokens that expire without the node's configuration changing. No
+// JWT library is vendored, and the one algorithm is all the node needs.
+
+// Auth authenticates the callers of the node's APIs.
+type Auth struct {
+	keys   []Key
+	secret []byte
+	reads  bool
+	writes bool
+}
+
+// New constructs an Auth for the configuration.
+func New(cfg Config) (*Auth, error) {
+	names := make(map[string]bool)
+	for _, k := range cfg.Keys {
+		switch {
+		case k.Name == "":
+			return nil, errors.New("api key name can't be empty")
+		case names[k.Name]:
+			return nil, fmt.Errorf("api key name %q is used twice", k.Name)
+		case rank[k.Role] == 0:
+			return nil, fmt.Errorf("api key %q has unknown role %q", k.Name, k.Role)
+		case k.Key == "":
+			return nil, fmt.Errorf("api key %q can't be empty", k.Name)
+		}
+		names[k.Name] = true
+	}
+
+	if cfg.Secret != "" && len(cfg.Secret) < minSecret {
+		return nil, fmt.Errorf("token secret must be at least %d characters", minSecret)
+	}
+
+	a := Auth{
+		keys:   cfg.Keys,
+		secret: []byte(cfg.Secret),
+		reads:  cfg.Reads,
+		writes: cfg.Writes,
+	}
+
+	return &a, nil
+}
+
+// Required reports if the callers need to be authenticated to act in the
+// role.
+func (a *Auth) Required(role Role) bool {
+	switch role {
+	case RoleRead:
+		return a.reads
+	case RoleWrite:
+		return a.writes
+	}
+
+	return true
+}
+
+// Accepts reports if a caller can be authenticated in the role, through a
+// key with the role or a signed token.
+func (a *Auth) Accepts(role Role) bool {
+	if len(a.secret) > 0 {
+		return true
+	}
+
+	for _, k := range a.keys {
+		if rank[k.Role] >= rank[role] {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticate returns the claims for the API key or signed token.
+func (a *Auth) Authenticate(token string) (Claims, error) {
+	for _, k := range a.keys {
+
+		// Compare in constant time so the key can't be guessed from the
+		// response times.
+		if subtle.ConstantTimeCompare([]byte(token), []byte(k.Key)) == 1 {
+			return Claims{Subject: k.Name, Role: k.Role}, nil
+		}
+	}
+
+	if len(a.secret) == 0 || strings.Count(token, ".") != 2 {
+		return Claims{}, ErrUnauthenticated
+	}
+
+	return a.verify(token)
+}
+
+// GenerateToken signs a token for the subject in the role that expires after
+// the duration.
+func (a *Auth) GenerateToken(subject string, role Role, ttl time.Duration) (string, error) {
+	if len(a.secret) == 0 {
+		return "", errors.New("no secret to sign the token")
+	}
+
+	if rank[role] == 0 {
+		return "", fmt.Errorf("unknown role %q", role)
+	}
+
+	now := time.Now().UTC()
+	claims := Claims{
+		Subject:   subject,
+		Role:      role,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(ttl).Unix(),
+	}
+
+	header, err := json.Marshal(tokenHeader{Alg: "HS256", Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signing := encode(header) + "." + encode(payload)
+
+	return signing + "." + encode(a.sign(signing)), nil
+}
+
+// =============================================================================
+
+// tokenHeader represents the header of a signed token.
+type tokenHeader struct {
+	Alg string `json:"alg"`
+	Typ string `json:"typ"`
+}
+
+// verify checks the signature and expiry of the token and returns its claims.
+func (a *Auth) verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+
+	var header tokenHeader
+	if err := decode(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return Claims{}, ErrUnauthenticated
+	}
+
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(sig, a.sign(parts[0]+"."+parts[1])) {
+		return Claims{}, ErrUnauthenticated
+	}
+
+	var claims Claims
+	if err := decode(parts[1], &claims); err != nil {
+		return Claims{}, ErrUnauthenticated
+	}
+
+	if claims.ExpiresAt == 0 || time.Now().Unix() >= claims.ExpiresAt {
+		return Claims{}, errors.New("token is expired")
+	}
+
+	if rank[claims.Role] == 0 {
+		return Claims{}, ErrUnauthenticated
+	}
+
+	return claims, nil
+}
+
+// sign returns the HMAC of the signing input.
+func (a *Auth) sign(signing string) []byte {
+	mac := hmac.New(sha256.New, a.secret)
+	mac.Write([]byte(signing))
+	return mac.Sum(nil)
+}
+
+// encode encodes the data as unpadded base64 for the URL.
+func encode(data []byte) string {
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decode decodes the unpadded base64 JSON into the value.
+func decode(s string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, v)
+}
@@ -22,6 +22,7 @@ type metrics struct {
 	requests   *expvar.Int
 	errors     *expvar.Int
 	panics     *expvar.Int
+	events     *expvar.Map
 }
 
 // init constructs the metrics value that will be used to capture metrics.
@@ -34,6 +35,7 @@ func init() {
 		requests:   expvar.NewInt("requests"),
 		errors:     expvar.NewInt("errors"),
 		panics:     expvar.NewInt("panics"),
+		events:     expvar.NewMap("events"),
 	}
 }
 
@@ -87,3 +89,34 @@ func AddPanics(ctx context.Context) {
 		v.panics.Add(1)
 	}
 }
+
+// AddEvent increments the count of the chain events of the specified kind.
+func AddEvent(kind string) {
+	m.events.Add(kind, 1)
+}
+
+// PublishTxShare registers a function that provides the statistics of the
+// queue of transactions waiting to be shared with peers so they are reported
+// with the other metrics.
+func PublishTxShare(stats func() any) {
+	expvar.Publish("txshare", expvar.Func(stats))
+}
+
+// PublishProduction registers a function that provides the time spent in
+// each stage of producing a block so they are reported with the other
+// metrics.
+func PublishProduction(stats func() any) {
+	expvar.Publish("production", expvar.Func(stats))
+}
+
+// PublishValidation registers a function that provides the time spent in
+// each rule validating a block so they are reported with the other metrics.
+func PublishValidation(stats func() any) {
+	expvar.Publish("validation", expvar.Func(stats))
+}
+
+// PublishBlockCache registers a function that provides the block cache
+// statistics so they are reported with the other metrics.
+func PublishBlockCache(stats func() any) {
+	expvar.Publish("blockcache", expvar.Func(stats))
+}
@@ -0,0 +1,59 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	v1Web "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// Antispam validates the request carries an API token or a proof of work for
+// its body as required by the guard. A caller authenticated with the write
+// role doesn't need either. A rejected request is told the bits of work
+// needed so the client can solve it.
+func Antispam(guard *antispam.Guard) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if !guard.Enabled() {
+				return handler(ctx, w, r)
+			}
+
+			if claims, ok := auth.GetClaims(ctx); ok && claims.Allows(auth.RoleWrite) {
+				return handler(ctx, w, r)
+			}
+
+			body, err := io.ReadAll(r.Body)
+			if err != nil {
+				return fmt.Errorf("unable to read payload: %w", err)
+			}
+
+			// Put the body back for the handler to decode.
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			if err := guard.Check(r, body); err != nil {
+				if bits := guard.WorkBits(); bits > 0 {
+					w.Header().Set(antispam.WorkBitsHeader, strconv.Itoa(bits))
+				}
+				return v1Web.NewRequestError(err, http.StatusForbidden)
+			}
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
@@ -0,0 +1,65 @@
+package mid
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/ardanlabs/blockchain/business/sys/auth"
+	v1Web "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// Authenticate validates the request carries an API key or signed token as a
+// bearer token for a caller allowed to act in the role. When the role doesn't
+// need a caller, a request without a valid token is let through but the
+// claims of a valid one are still kept for the handlers.
+func Authenticate(a *auth.Auth, role auth.Role) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+
+			// A CORS preflight request never carries the credentials.
+			if r.Method == http.MethodOptions {
+				return handler(ctx, w, r)
+			}
+
+			required := a.Required(role)
+
+			// Expecting: bearer <token>
+			parts := strings.Split(r.Header.Get("Authorization"), " ")
+			if len(parts) != 2 || strings.ToLower(parts[0]) != "bearer" {
+				if !required {
+					return handler(ctx, w, r)
+				}
+				err := errors.New("expected authorization header format: bearer <token>")
+				return v1Web.NewRequestError(err, http.StatusUnauthorized)
+			}
+
+			claims, err := a.Authenticate(parts[1])
+			if err != nil {
+				if !required {
+					return handler(ctx, w, r)
+				}
+				return v1Web.NewRequestError(err, http.StatusUnauthorized)
+			}
+
+			if required && !claims.Allows(role) {
+				err := fmt.Errorf("%s role is not allowed, %s role is required", claims.Role, role)
+				return v1Web.NewRequestError(err, http.StatusForbidden)
+			}
+
+			// Call the next handler with the caller's claims.
+			return handler(auth.SetClaims(ctx, claims), w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
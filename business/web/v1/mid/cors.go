@@ -3,23 +3,75 @@ package mid
 import (
 	"context"
 	"net/http"
+	"strings"
 
+	v1Web "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
 	"github.com/ardanlabs/blockchain/foundation/web"
 )
 
 // Cors sets the response headers needed for Cross-Origin Resource Sharing
-func Cors(origin string) web.Middleware {
+// for a request from one of the origins, where * allows any origin. A request
+// from another origin gets no CORS headers so the browser blocks it.
+func Cors(origins ...string) web.Middleware {
+	anyOrigin := false
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		if origin == "*" {
+			anyOrigin = true
+		}
+		allowed[strings.TrimSuffix(origin, "/")] = true
+	}
 
 	// This is the actual middleware function to be executed.
 	m := func(handler web.Handler) web.Handler {
 
 		// Create the handler that will be attached in the middleware chain.
 		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			origin := r.Header.Get("Origin")
+
+			switch {
+			case anyOrigin:
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+
+			case allowed[origin]:
+				w.Header().Set("Access-Control-Allow-Origin", origin)
+				w.Header().Set("Vary", "Origin")
+
+			default:
+				return handler(ctx, w, r)
+			}
 
 			// Set the CORS headers to the response.
-			w.Header().Set("Access-Control-Allow-Origin", origin)
 			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PATCH, PUT, DELETE, OPTIONS")
-			w.Header().Set("Access-Control-Allow-Headers", "Origin, Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization")
+			w.Header().Set("Access-Control-Allow-Headers", "Origin, Accept, Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, If-None-Match, "+antispam.WorkHeader)
+			w.Header().Set("Access-Control-Expose-Headers", "ETag, "+antispam.WorkBitsHeader+", "+v1Web.NextCursorHeader)
+			w.Header().Set("Access-Control-Max-Age", "600")
+
+			// Call the next handler.
+			return handler(ctx, w, r)
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// CorsPath sets the response headers needed for Cross-Origin Resource Sharing
+// like Cors, but only for the requests to paths with the prefix.
+func CorsPath(prefix string, origins ...string) web.Middleware {
+	cors := Cors(origins...)
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+		withCors := cors(handler)
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return withCors(ctx, w, r)
+			}
 
 			// Call the next handler.
 			return handler(ctx, w, r)
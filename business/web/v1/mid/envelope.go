@@ -0,0 +1,44 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+
+	v1Web "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// Envelope verifies the length and checksum of a request sent by a peer in an
+// envelope before the handler sees the payload, and sends the response in an
+// envelope when the peer asks for one.
+func Envelope() web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			enveloped, err := peer.OpenRequest(r)
+			if err != nil {
+				return v1Web.NewRequestError(err, http.StatusBadRequest)
+			}
+
+			if !enveloped {
+				return handler(ctx, w, r)
+			}
+
+			// Call the next handler with the response held back.
+			ew := peer.NewEnvelopeWriter(w)
+			if err := handler(ctx, ew, r); err != nil {
+				return err
+			}
+
+			return ew.Seal()
+		}
+
+		return h
+	}
+
+	return m
+}
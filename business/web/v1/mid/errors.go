@@ -7,6 +7,7 @@ import (
 
 	"github.com/ardanlabs/blockchain/business/sys/validate"
 	v1Web "github.com/ardanlabs/blockchain/business/web/v1"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
 	"github.com/ardanlabs/blockchain/foundation/web"
 	"go.uber.org/zap"
 )
@@ -52,6 +53,9 @@ func Errors(log *zap.SugaredLogger) web.Middleware {
 					er = v1Web.ErrorResponse{
 						Error: reqErr.Error(),
 					}
+					if code := errcode.Of(reqErr.Err); code != errcode.Unknown {
+						er.Code = code
+					}
 					status = reqErr.Status
 
 				default:
@@ -0,0 +1,107 @@
+package mid
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// ETag tags a successful GET response with an entity tag computed from its
+// content. When the request already carries the tag in If-None-Match, the
+// response is replaced with 304 Not Modified and no body, so a caller
+// polling for something that didn't change gets almost no data back.
+func ETag() web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			if r.Method != http.MethodGet {
+				return handler(ctx, w, r)
+			}
+
+			// Call the next handler with the response held back.
+			tw := etagWriter{ResponseWriter: w}
+			if err := handler(ctx, &tw, r); err != nil {
+				return err
+			}
+
+			if tw.statusCode != http.StatusOK {
+				return nil
+			}
+
+			sum := sha256.Sum256(append([]byte(w.Header().Get("Content-Type")+"\n"), tw.body.Bytes()...))
+			etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+			w.Header().Set("ETag", etag)
+
+			if matchETag(r.Header.Get("If-None-Match"), etag) {
+				web.SetStatusCode(ctx, http.StatusNotModified)
+				w.Header().Del("Content-Type")
+				w.WriteHeader(http.StatusNotModified)
+				return nil
+			}
+
+			w.WriteHeader(http.StatusOK)
+			_, err := w.Write(tw.body.Bytes())
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
+
+// matchETag reports if the If-None-Match header lists the entity tag.
+func matchETag(ifNoneMatch string, etag string) bool {
+	for _, value := range strings.Split(ifNoneMatch, ",") {
+		value = strings.TrimPrefix(strings.TrimSpace(value), "W/")
+		if value == etag || value == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// =============================================================================
+
+// etagWriter holds back a successful response so its entity tag can be
+// computed once the handler is done. Any other response is written as is.
+type etagWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// WriteHeader records the status code, sending it right away unless the
+// response is held back.
+func (tw *etagWriter) WriteHeader(statusCode int) {
+	if tw.statusCode != 0 {
+		return
+	}
+	tw.statusCode = statusCode
+
+	if statusCode != http.StatusOK {
+		tw.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+// Write holds back the data for a successful response.
+func (tw *etagWriter) Write(data []byte) (int, error) {
+	if tw.statusCode == 0 {
+		tw.WriteHeader(http.StatusOK)
+	}
+
+	if tw.statusCode != http.StatusOK {
+		return tw.ResponseWriter.Write(data)
+	}
+
+	return tw.body.Write(data)
+}
@@ -0,0 +1,43 @@
+package mid
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+	"github.com/ardanlabs/blockchain/foundation/web"
+)
+
+// Trace records a span for the request. A request from a peer carrying a
+// trace context continues the peer's trace. A nil tracer records nothing.
+func Trace(tracer *tracing.Tracer) web.Middleware {
+
+	// This is the actual middleware function to be executed.
+	m := func(handler web.Handler) web.Handler {
+
+		// Create the handler that will be attached in the middleware chain.
+		h := func(ctx context.Context, w http.ResponseWriter, r *http.Request) error {
+			ctx, span := tracer.Start(tracing.Extract(ctx, r.Header), "http.request",
+				tracing.String("method", r.Method),
+				tracing.String("path", r.URL.Path),
+				tracing.String("remote", r.RemoteAddr),
+			)
+			defer span.End()
+
+			// Call the next handler.
+			err := handler(ctx, w, r)
+
+			if v, verr := web.GetValues(ctx); verr == nil {
+				span.SetAttributes(tracing.Int("status", v.StatusCode))
+			}
+			span.RecordError(err)
+
+			// Return the error so it can be handled further up the chain.
+			return err
+		}
+
+		return h
+	}
+
+	return m
+}
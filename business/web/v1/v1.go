@@ -1,11 +1,20 @@
 // Package v1 represents types used by the web application for v1.
 package v1
 
-import "errors"
+import (
+	"errors"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+)
+
+// NextCursorHeader is the response header carrying the cursor for the next
+// page of a list, which is missing on the last page.
+const NextCursorHeader = "X-Next-Cursor"
 
 // ErrorResponse is the form used for API responses from failures in the API.
 type ErrorResponse struct {
 	Error  string            `json:"error"`
+	Code   errcode.Code      `json:"code,omitempty"` // Class of the failure for errors from the blockchain.
 	Fields map[string]string `json:"fields,omitempty"`
 }
 
@@ -0,0 +1,178 @@
+// Package antispam guards the transaction submission endpoints of a node
+// open to the public. A client either presents an API token the node trusts
+// or solves a small proof of work bound to the body of its request.
+package antispam
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/bits"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Set of headers used to pass the proof of work.
+const (
+	WorkHeader     = "X-Tx-Work"      // Nonce solving the proof of work for the request body.
+	WorkBitsHeader = "X-Tx-Work-Bits" // Bits of work the node requires, set on a rejected request.
+)
+
+// MaxWorkBits is the most bits of work a node can require. Each bit doubles
+// the hashes a client needs, so past this a wallet can't submit in time.
+const MaxWorkBits = 32
+
+// ErrRequired is returned when a request has no valid token or proof of work.
+var ErrRequired = errors.New("an api token or proof of work is required")
+
+// Config represents the configuration for the guard.
+type Config struct {
+	Tokens   []string // API tokens accepted in place of the proof of work.
+	WorkBits int      // Leading zero bits of the proof of work, 0 turns it off.
+}
+
+// Validate checks the configuration can be used.
+func (cfg Config) Validate() error {
+	if cfg.WorkBits < 0 || cfg.WorkBits > MaxWorkBits {
+		return fmt.Errorf("work bits %d must be between 0 and %d", cfg.WorkBits, MaxWorkBits)
+	}
+
+	for _, token := range cfg.Tokens {
+		if token == "" {
+			return errors.New("api tokens can't be empty")
+		}
+	}
+
+	return nil
+}
+
+// CORE NOTE: Every transaction with a valid signature is accepted into the
+// mempool and shared with the peers, even one from an account without the
+// funds to pay for it, so a node open to the public can be flooded for free.
+// The proof of work costs the client CPU for each submission while the node
+// checks it with one hash. It's bound to the body so a solution can't be
+// reused for another transaction, and resending the same body only resends
+// a transaction the mempool already holds. Known clients are given a token
+// instead.
+
+// Guard checks the submissions to a node.
+type Guard struct {
+	tokens   [][]byte
+	workBits int
+}
+
+// New constructs a guard for the configuration.
+func New(cfg Config) (*Guard, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	g := Guard{
+		tokens:   make([][]byte, len(cfg.Tokens)),
+		workBits: cfg.WorkBits,
+	}
+
+	for i, token := range cfg.Tokens {
+		g.tokens[i] = []byte(token)
+	}
+
+	return &g, nil
+}
+
+// Enabled reports if the guard requires anything from a submission.
+func (g *Guard) Enabled() bool {
+	return g != nil && (len(g.tokens) > 0 || g.workBits > 0)
+}
+
+// WorkBits returns the bits of work the guard requires, 0 when only a token
+// is accepted.
+func (g *Guard) WorkBits() int {
+	if g == nil {
+		return 0
+	}
+
+	return g.workBits
+}
+
+// Check validates the request carries a trusted API token as a bearer token
+// or a proof of work for its body. ErrRequired is returned when it has
+// neither.
+func (g *Guard) Check(r *http.Request, body []byte) error {
+	return g.CheckBatch(r, body, 1)
+}
+
+// CheckBatch validates a request submitting the specified number of
+// transactions. A proof of work pays for a single transaction, so a request
+// submitting more than one needs a trusted API token.
+func (g *Guard) CheckBatch(r *http.Request, body []byte, submits int) error {
+	if !g.Enabled() {
+		return nil
+	}
+
+	// Expecting: bearer <token>
+	if parts := strings.Split(r.Header.Get("Authorization"), " "); len(parts) == 2 && strings.ToLower(parts[0]) == "bearer" {
+		for _, token := range g.tokens {
+
+			// Compare in constant time so the token can't be guessed from
+			// the response times.
+			if subtle.ConstantTimeCompare([]byte(parts[1]), token) == 1 {
+				return nil
+			}
+		}
+	}
+
+	if g.workBits == 0 || submits > 1 {
+		return ErrRequired
+	}
+
+	nonce, err := strconv.ParseUint(r.Header.Get(WorkHeader), 10, 64)
+	if err != nil || !Verify(body, nonce, g.workBits) {
+		return ErrRequired
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Solve finds the nonce that proves the work for the body. It stops with an
+// error if the context is cancelled.
+func Solve(ctx context.Context, body []byte, workBits int) (uint64, error) {
+	if workBits < 0 || workBits > MaxWorkBits {
+		return 0, fmt.Errorf("work bits %d must be between 0 and %d", workBits, MaxWorkBits)
+	}
+
+	for nonce := uint64(0); ; nonce++ {
+		if nonce%4096 == 0 && ctx.Err() != nil {
+			return 0, ctx.Err()
+		}
+
+		if Verify(body, nonce, workBits) {
+			return nonce, nil
+		}
+	}
+}
+
+// Verify checks the hash of the body followed by the nonce starts with the
+// bits of work as zeros.
+func Verify(body []byte, nonce uint64, workBits int) bool {
+	h := sha256.New()
+	h.Write(body)
+	binary.Write(h, binary.BigEndian, nonce)
+	hash := h.Sum(nil)
+
+	var zeros int
+	for _, b := range hash {
+		if b != 0 {
+			zeros += bits.LeadingZeros8(b)
+			break
+		}
+		zeros += 8
+	}
+
+	return zeros >= workBits
+}
@@ -0,0 +1,119 @@
+package antispam_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
+)
+
+func Test_Work(t *testing.T) {
+	body := []byte(`{"nonce":1,"value":100}`)
+
+	nonce, err := antispam.Solve(context.Background(), body, 12)
+	if err != nil {
+		t.Fatalf("Should be able to solve the work: %v", err)
+	}
+
+	if !antispam.Verify(body, nonce, 12) {
+		t.Fatalf("Should verify the solved work.")
+	}
+
+	if antispam.Verify([]byte(`{"nonce":2,"value":100}`), nonce, 12) && antispam.Verify([]byte(`{"nonce":3,"value":100}`), nonce, 12) {
+		t.Fatalf("Should bind the work to the body.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := antispam.Solve(ctx, body, antispam.MaxWorkBits); !errors.Is(err, context.Canceled) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", context.Canceled)
+		t.Fatalf("Should stop solving when the context is cancelled.")
+	}
+}
+
+func Test_Check(t *testing.T) {
+	body := []byte(`{"nonce":1,"value":100}`)
+
+	nonce, err := antispam.Solve(context.Background(), body, 8)
+	if err != nil {
+		t.Fatalf("Should be able to solve the work: %v", err)
+	}
+
+	request := func(token string, work string) *http.Request {
+		r := httptest.NewRequest(http.MethodPost, "/v1/tx/submit", nil)
+		if token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		if work != "" {
+			r.Header.Set(antispam.WorkHeader, work)
+		}
+		return r
+	}
+
+	open, err := antispam.New(antispam.Config{})
+	if err != nil {
+		t.Fatalf("Should be able to construct the guard: %v", err)
+	}
+
+	guard, err := antispam.New(antispam.Config{Tokens: []string{"secret"}, WorkBits: 8})
+	if err != nil {
+		t.Fatalf("Should be able to construct the guard: %v", err)
+	}
+
+	tokens, err := antispam.New(antispam.Config{Tokens: []string{"secret"}})
+	if err != nil {
+		t.Fatalf("Should be able to construct the guard: %v", err)
+	}
+
+	tt := []struct {
+		name  string
+		guard *antispam.Guard
+		r     *http.Request
+		pass  bool
+	}{
+		{"open node", open, request("", ""), true},
+		{"token", guard, request("secret", ""), true},
+		{"wrong token", guard, request("guess", ""), false},
+		{"work", guard, request("", strconv.FormatUint(nonce, 10)), true},
+		{"wrong work", guard, request("", strconv.FormatUint(nonce+1, 10)), antispam.Verify(body, nonce+1, 8)},
+		{"nothing", guard, request("", ""), false},
+		{"work without the puzzle", tokens, request("", strconv.FormatUint(nonce, 10)), false},
+	}
+
+	for _, tst := range tt {
+		err := tst.guard.Check(tst.r, body)
+		if (err == nil) != tst.pass {
+			t.Logf("got: %v", err)
+			t.Logf("exp: pass %v", tst.pass)
+			t.Fatalf("Should check the request with %s.", tst.name)
+		}
+	}
+
+	// A proof of work pays for one transaction, not a batch of them.
+	batch := []byte(`[{"method":"eth_sendRawTransaction","params":["0x01"]},{"method":"eth_sendRawTransaction","params":["0x02"]}]`)
+
+	nonce, err = antispam.Solve(context.Background(), batch, 8)
+	if err != nil {
+		t.Fatalf("Should be able to solve the work: %v", err)
+	}
+
+	if err := guard.CheckBatch(request("", strconv.FormatUint(nonce, 10)), batch, 2); !errors.Is(err, antispam.ErrRequired) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", antispam.ErrRequired)
+		t.Fatalf("Should reject a batch of two submissions with a single proof.")
+	}
+
+	if err := guard.CheckBatch(request("secret", ""), batch, 2); err != nil {
+		t.Fatalf("Should accept a batch of submissions with a token: %v", err)
+	}
+
+	if _, err := antispam.New(antispam.Config{WorkBits: antispam.MaxWorkBits + 1}); err == nil {
+		t.Fatalf("Should reject more work than a client can solve.")
+	}
+}
@@ -0,0 +1,213 @@
+// Package bridge publishes the new blocks and their transactions from the
+// node to a message bus, so analytics pipelines can consume the chain without
+// polling the API. NATS is reached over its client protocol and Kafka through
+// its REST proxy, which keeps the node free of client libraries.
+package bridge
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// Set of message buses the bridge can publish to.
+const (
+	BusNATS  = "nats"  // A NATS server, with the URL as nats://[user:pass@]host:port.
+	BusKafka = "kafka" // A Kafka REST proxy, with the URL as http(s)://host:port.
+)
+
+// Set of subjects, or topics for Kafka, published to under the prefix.
+const (
+	SubjectBlocks       = "blocks"
+	SubjectTransactions = "transactions"
+)
+
+// Set of values used to publish the messages.
+const (
+	publishAttempts = 3                      // Attempts made to publish a message.
+	publishBackoff  = 500 * time.Millisecond // Wait before the first retry, doubled after each one.
+	publishTimeout  = 10 * time.Second       // Longest the bus is waited on for each attempt.
+)
+
+// Config represents the message bus the chain is published to.
+type Config struct {
+	Bus    string // One of the buses, such as nats or kafka.
+	URL    string
+	Prefix string // Put in front of the subjects, as prefix.blocks and prefix.transactions.
+}
+
+// Validate checks the bus is known and its URL has the scheme the bus uses.
+func (cfg Config) Validate() error {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("bridge %s: %w", cfg.Bus, err)
+	}
+
+	switch cfg.Bus {
+	case BusNATS:
+		if u.Scheme != "nats" || u.Host == "" {
+			return fmt.Errorf("bridge nats: url %q must be a nats://host:port URL", cfg.URL)
+		}
+
+	case BusKafka:
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("bridge kafka: url %q must be the http or https URL of a REST proxy", cfg.URL)
+		}
+
+	default:
+		return fmt.Errorf("unknown bridge bus %q", cfg.Bus)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Transaction represents a transaction in a new block as it's published.
+type Transaction struct {
+	Block     uint64           `json:"block"`
+	BlockHash string           `json:"block_hash"`
+	TxHash    string           `json:"tx_hash"`
+	Tx        database.BlockTx `json:"tx"`
+}
+
+// publisher represents a message bus the messages are published to.
+type publisher interface {
+	publish(subject string, data []byte) error
+	close() error
+}
+
+// Bridge turns the block events from the node into messages and publishes
+// them to the bus.
+type Bridge struct {
+	cfg    Config
+	pub    publisher
+	ev     func(v string, args ...any)
+	ctx    context.Context // Cancelled on shutdown to stop the waits between retries.
+	cancel context.CancelFunc
+}
+
+// New constructs a bridge for the configuration. The client is used to reach
+// a Kafka REST proxy, nil uses the default client. The NATS server is only
+// connected to when the first message is published.
+func New(cfg Config, client *http.Client, ev func(v string, args ...any)) (*Bridge, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if ev == nil {
+		ev = func(v string, args ...any) {}
+	}
+
+	var pub publisher
+	switch cfg.Bus {
+	case BusNATS:
+		pub = newNATS(cfg.URL, ev)
+	case BusKafka:
+		pub = newKafka(cfg.URL, client)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	b := Bridge{
+		cfg:    cfg,
+		pub:    pub,
+		ev:     ev,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	return &b, nil
+}
+
+// Sink returns the sink to register with the node. The messages are published
+// from the sink's goroutine, one at a time in the order of the blocks.
+func (b *Bridge) Sink() state.Sink {
+	return state.Sink{
+		Name:   "bridge:" + b.cfg.Bus,
+		Kinds:  []string{state.EventBlock},
+		Handle: b.handle,
+	}
+}
+
+// Stop cancels the waits between retries, so each message still waiting is
+// only tried once more before it's dropped. It's called before the sink is
+// removed so a bus that is down doesn't hold up the shutdown.
+func (b *Bridge) Stop() {
+	b.cancel()
+}
+
+// Close stops the retries and closes the connection to the bus.
+func (b *Bridge) Close() error {
+	b.cancel()
+	return b.pub.close()
+}
+
+// handle publishes the block and then each of its transactions.
+func (b *Bridge) handle(ev state.Event) {
+	block, ok := ev.Value.(database.BlockData)
+	if !ok {
+		return
+	}
+
+	b.send(SubjectBlocks, block)
+
+	for _, tx := range block.Trans {
+		b.send(SubjectTransactions, Transaction{
+			Block:     block.Header.Number,
+			BlockHash: block.Hash,
+			TxHash:    tx.TxHash(),
+			Tx:        tx,
+		})
+	}
+}
+
+// send publishes the message, retrying a failed publish with a growing wait
+// between attempts. A message that can't be published is dropped.
+func (b *Bridge) send(subject string, v any) {
+	if b.cfg.Prefix != "" {
+		subject = b.cfg.Prefix + "." + subject
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		b.ev("bridge: send: %s: %s: ERROR: %s", b.cfg.Bus, subject, err)
+		return
+	}
+
+	backoff := publishBackoff
+	for attempt := 1; ; attempt++ {
+		err := b.pub.publish(subject, data)
+		if err == nil {
+			return
+		}
+
+		b.ev("bridge: send: %s: %s: attempt[%d]: WARNING: %s", b.cfg.Bus, subject, attempt, err)
+
+		if attempt >= publishAttempts {
+			b.ev("bridge: send: %s: %s: dropped", b.cfg.Bus, subject)
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-b.ctx.Done():
+			timer.Stop()
+			b.ev("bridge: send: %s: %s: dropped, shutting down", b.cfg.Bus, subject)
+			return
+		}
+
+		backoff *= 2
+	}
+}
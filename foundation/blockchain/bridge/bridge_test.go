@@ -0,0 +1,258 @@
+package bridge_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/bridge"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+const (
+	kennedy = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	pavel   = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+)
+
+// message represents a message received by a test bus.
+type message struct {
+	subject string
+	data    []byte
+}
+
+// newBlockEvent returns the event for a block with two transactions.
+func newBlockEvent() state.Event {
+	tx := func(value uint64) database.BlockTx {
+		return database.BlockTx{SignedTx: database.SignedTx{Tx: database.Tx{FromID: kennedy, ToID: pavel, Value: value}}}
+	}
+
+	block := database.BlockData{
+		Hash:   "0x01",
+		Header: database.BlockHeader{Number: 7},
+		Trans:  []database.BlockTx{tx(10), tx(20)},
+	}
+
+	return state.Event{Kind: state.EventBlock, Value: block, Time: time.Now()}
+}
+
+// checkMessages checks the block was published followed by its transactions.
+func checkMessages(t *testing.T, msgs []message, prefix string) {
+	exp := []string{prefix + ".blocks", prefix + ".transactions", prefix + ".transactions"}
+	if len(msgs) != len(exp) {
+		t.Logf("got: %d", len(msgs))
+		t.Logf("exp: %d", len(exp))
+		t.Fatalf("Should publish the block and each of its transactions.")
+	}
+
+	for i := range exp {
+		if msgs[i].subject != exp[i] {
+			t.Logf("got: %s", msgs[i].subject)
+			t.Logf("exp: %s", exp[i])
+			t.Fatalf("Should publish to the subject for the message.")
+		}
+	}
+
+	var tx bridge.Transaction
+	if err := json.Unmarshal(msgs[2].data, &tx); err != nil {
+		t.Fatalf("Should be able to decode the transaction: %v", err)
+	}
+
+	if tx.Block != 7 || tx.BlockHash != "0x01" || tx.Tx.Value != 20 {
+		t.Logf("got: %+v", tx)
+		t.Fatalf("Should publish the transaction with its block.")
+	}
+}
+
+func Test_NATS(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Should be able to listen: %v", err)
+	}
+	defer l.Close()
+
+	var mu sync.Mutex
+	var msgs []message
+	var connect string
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		conn.Write([]byte("INFO {\"server_id\":\"test\"}\r\n"))
+
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+
+			fields := strings.Fields(line)
+			switch {
+			case len(fields) == 0:
+			case fields[0] == "CONNECT":
+				mu.Lock()
+				connect = strings.TrimSpace(strings.TrimPrefix(line, "CONNECT "))
+				mu.Unlock()
+
+			case fields[0] == "PING":
+				conn.Write([]byte("PONG\r\n"))
+
+			case fields[0] == "PUB" && len(fields) == 3:
+				size, _ := strconv.Atoi(fields[2])
+				data := make([]byte, size+2)
+				if _, err := io.ReadFull(r, data); err != nil {
+					return
+				}
+
+				mu.Lock()
+				msgs = append(msgs, message{subject: fields[1], data: data[:size]})
+				mu.Unlock()
+			}
+		}
+	}()
+
+	b, err := bridge.New(bridge.Config{Bus: bridge.BusNATS, URL: "nats://bill:secret@" + l.Addr().String(), Prefix: "chain"}, nil, nil)
+	if err != nil {
+		t.Fatalf("Should be able to construct the bridge: %v", err)
+	}
+	defer b.Close()
+
+	b.Sink().Handle(newBlockEvent())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var options struct {
+		User string `json:"user"`
+		Pass string `json:"pass"`
+	}
+	json.Unmarshal([]byte(connect), &options)
+	if options.User != "bill" || options.Pass != "secret" {
+		t.Logf("got: %s", connect)
+		t.Fatalf("Should connect with the credentials from the URL.")
+	}
+
+	checkMessages(t, msgs, "chain")
+}
+
+func Test_Kafka(t *testing.T) {
+	var mu sync.Mutex
+	var msgs []message
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var records struct {
+			Records []struct {
+				Value json.RawMessage `json:"value"`
+			} `json:"records"`
+		}
+
+		if r.Header.Get("Content-Type") != "application/vnd.kafka.json.v2+json" || json.NewDecoder(r.Body).Decode(&records) != nil {
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		}
+
+		mu.Lock()
+		for _, record := range records.Records {
+			msgs = append(msgs, message{subject: strings.TrimPrefix(r.URL.Path, "/topics/"), data: record.Value})
+		}
+		mu.Unlock()
+
+		w.Write([]byte(`{"offsets":[{"partition":0,"offset":1}]}`))
+	}))
+	defer srv.Close()
+
+	b, err := bridge.New(bridge.Config{Bus: bridge.BusKafka, URL: srv.URL, Prefix: "chain"}, srv.Client(), nil)
+	if err != nil {
+		t.Fatalf("Should be able to construct the bridge: %v", err)
+	}
+	defer b.Close()
+
+	b.Sink().Handle(newBlockEvent())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	checkMessages(t, msgs, "chain")
+}
+
+func Test_Stop(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	failed := make(chan struct{}, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	b, err := bridge.New(bridge.Config{Bus: bridge.BusKafka, URL: srv.URL, Prefix: "chain"}, srv.Client(), nil)
+	if err != nil {
+		t.Fatalf("Should be able to construct the bridge: %v", err)
+	}
+	defer b.Close()
+
+	done := make(chan struct{})
+	go func() {
+		b.Sink().Handle(newBlockEvent())
+		close(done)
+	}()
+
+	// Stopping the bridge while it waits to retry the block drops it, and the
+	// transactions are only tried once.
+	<-failed
+	b.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Should stop waiting between retries once stopped.")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if attempts != 3 {
+		t.Logf("got: %d", attempts)
+		t.Logf("exp: %d", 3)
+		t.Fatalf("Should try each message once after the bridge is stopped.")
+	}
+}
+
+func Test_Validate(t *testing.T) {
+	tt := []struct {
+		name string
+		cfg  bridge.Config
+	}{
+		{"unknown bus", bridge.Config{Bus: "rabbitmq", URL: "amqp://localhost:5672"}},
+		{"nats with an http url", bridge.Config{Bus: bridge.BusNATS, URL: "http://localhost:4222"}},
+		{"kafka with a broker address", bridge.Config{Bus: bridge.BusKafka, URL: "localhost:9092"}},
+	}
+
+	for _, tst := range tt {
+		if err := tst.cfg.Validate(); err == nil {
+			t.Fatalf("Should reject the bridge with %s.", tst.name)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package bridge
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// kafkaContentType is the content type of a record set with JSON values sent
+// to the REST proxy.
+const kafkaContentType = "application/vnd.kafka.json.v2+json"
+
+// kafka publishes the messages to Kafka through a REST proxy, with each
+// subject as the topic.
+type kafka struct {
+	url    string
+	client *http.Client
+}
+
+// newKafka constructs a publisher for the REST proxy at the URL.
+func newKafka(url string, client *http.Client) *kafka {
+	return &kafka{
+		url:    strings.TrimSuffix(url, "/"),
+		client: client,
+	}
+}
+
+// publish posts the message as a record to the topic. The proxy answers once
+// Kafka has accepted it.
+func (k *kafka) publish(topic string, data []byte) error {
+	records := struct {
+		Records []struct {
+			Value json.RawMessage `json:"value"`
+		} `json:"records"`
+	}{
+		Records: []struct {
+			Value json.RawMessage `json:"value"`
+		}{
+			{Value: data},
+		},
+	}
+
+	body, err := json.Marshal(records)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), publishTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.url+"/topics/"+topic, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", kafkaContentType)
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// The proxy reports a record Kafka didn't accept in the offsets of a
+	// successful response.
+	var result struct {
+		Offsets []struct {
+			ErrorCode *int   `json:"error_code"`
+			Error     string `json:"error"`
+		} `json:"offsets"`
+	}
+
+	content, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d: %s", resp.StatusCode, strings.TrimSpace(string(content)))
+	}
+
+	if err := json.Unmarshal(content, &result); err == nil {
+		for _, offset := range result.Offsets {
+			if offset.ErrorCode != nil || offset.Error != "" {
+				return fmt.Errorf("record rejected: %s", offset.Error)
+			}
+		}
+	}
+
+	return nil
+}
+
+// close has nothing to close since each message is its own request.
+func (k *kafka) close() error {
+	return nil
+}
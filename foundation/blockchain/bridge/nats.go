@@ -0,0 +1,217 @@
+package bridge
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// CORE NOTE: Publishing to NATS only takes a few lines of its text protocol:
+// the server introduces itself with INFO, the client answers with CONNECT
+// and then sends each message as a PUB. The server checks on the client with
+// PING, which has to be answered or the connection is closed, so a goroutine
+// reads from the connection for as long as it's open.
+
+// nats publishes the messages to a NATS server over its client protocol. The
+// connection is made on the first publish and made again after it fails.
+type nats struct {
+	url string
+	ev  func(v string, args ...any)
+
+	mu   sync.Mutex // Held for each publish.
+	wmu  sync.Mutex // Held for each write to the connection.
+	conn net.Conn
+	w    *bufio.Writer
+	pong chan error
+}
+
+// newNATS constructs a publisher for the NATS server at the URL.
+func newNATS(url string, ev func(v string, args ...any)) *nats {
+	return &nats{
+		url: url,
+		ev:  ev,
+	}
+}
+
+// publish sends the message to the subject and waits for the server to
+// acknowledge it with a PONG, so a message isn't lost in a dead connection.
+func (n *nats) publish(subject string, data []byte) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.conn == nil {
+		if err := n.connect(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(n.w, "PUB %s %d\r\n", subject, len(data))
+	n.w.Write(data)
+	n.w.WriteString("\r\nPING\r\n")
+
+	if err := n.flush(); err != nil {
+		n.disconnect()
+		return err
+	}
+
+	return nil
+}
+
+// close closes the connection to the server.
+func (n *nats) close() error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.disconnect()
+	return nil
+}
+
+// connect dials the server, reads its INFO and sends the CONNECT with the
+// credentials from the URL. The caller must hold the lock.
+func (n *nats) connect() error {
+	u, err := url.Parse(n.url)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", u.Host, publishTimeout)
+	if err != nil {
+		return err
+	}
+
+	conn.SetReadDeadline(time.Now().Add(publishTimeout))
+	r := bufio.NewReader(conn)
+
+	line, err := r.ReadString('\n')
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("reading info: %w", err)
+	}
+
+	if !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("unexpected greeting %q", strings.TrimSpace(line))
+	}
+
+	var info struct {
+		TLSRequired bool `json:"tls_required"`
+	}
+	json.Unmarshal([]byte(strings.TrimPrefix(line, "INFO ")), &info)
+	if info.TLSRequired {
+		conn.Close()
+		return errors.New("server requires tls")
+	}
+
+	options := struct {
+		Verbose  bool   `json:"verbose"`
+		Pedantic bool   `json:"pedantic"`
+		Name     string `json:"name"`
+		Lang     string `json:"lang"`
+		User     string `json:"user,omitempty"`
+		Pass     string `json:"pass,omitempty"`
+	}{
+		Name: "blockchain-node",
+		Lang: "go",
+	}
+	if u.User != nil {
+		options.User = u.User.Username()
+		options.Pass, _ = u.User.Password()
+	}
+
+	data, err := json.Marshal(options)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	conn.SetReadDeadline(time.Time{})
+
+	n.conn = conn
+	n.w = bufio.NewWriter(conn)
+	n.pong = make(chan error, 1)
+
+	go n.read(r, conn, n.pong)
+
+	fmt.Fprintf(n.w, "CONNECT %s\r\nPING\r\n", data)
+	if err := n.flush(); err != nil {
+		n.disconnect()
+		return err
+	}
+
+	n.ev("bridge: nats: connected: %s", u.Host)
+
+	return nil
+}
+
+// flush writes the buffered commands and waits for the PONG answering the
+// PING sent after them. The caller must hold the lock.
+func (n *nats) flush() error {
+	n.wmu.Lock()
+	n.conn.SetWriteDeadline(time.Now().Add(publishTimeout))
+	err := n.w.Flush()
+	n.wmu.Unlock()
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case err := <-n.pong:
+		return err
+	case <-time.After(publishTimeout):
+		return errors.New("timed out waiting for the server")
+	}
+}
+
+// disconnect closes the connection so the next publish makes a new one. The
+// caller must hold the lock.
+func (n *nats) disconnect() {
+	if n.conn == nil {
+		return
+	}
+
+	n.conn.Close()
+	n.conn = nil
+	n.w = nil
+}
+
+// read answers the PINGs from the server and reports the PONGs and errors
+// to the publish waiting for them, until the connection is closed.
+func (n *nats) read(r *bufio.Reader, conn net.Conn, pong chan error) {
+	report := func(err error) {
+		select {
+		case pong <- err:
+		default:
+		}
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			report(err)
+			return
+		}
+
+		switch line = strings.TrimSpace(line); {
+		case line == "PING":
+			n.wmu.Lock()
+			conn.SetWriteDeadline(time.Now().Add(publishTimeout))
+			conn.Write([]byte("PONG\r\n"))
+			n.wmu.Unlock()
+
+		case line == "PONG":
+			report(nil)
+
+		case strings.HasPrefix(line, "-ERR"):
+			err := errors.New(strings.Trim(strings.TrimPrefix(line, "-ERR"), " '"))
+			n.ev("bridge: nats: ERROR: %s", err)
+			report(err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+// Package chaos injects network faults into a node so the resilience of sync
+// and consensus can be tested without external tooling. A nil Faults value
+// injects nothing, so nodes only pay for the checks when chaos is turned on.
+package chaos
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+// ErrDropped is returned for a peer request that was dropped on purpose.
+var ErrDropped = errors.New("chaos: request dropped")
+
+// Config represents the faults to inject.
+type Config struct {
+	DropRate      float64       // Fraction of peer requests dropped, from 0 to 1.
+	BlockDelay    time.Duration // Time a new block is held before it's proposed to peers.
+	DuplicateRate float64       // Fraction of shared transactions sent to peers twice, from 0 to 1.
+	Seed          int64         // Seed for the random decisions, 0 uses the current time.
+}
+
+// Enabled reports if the configuration injects any faults.
+func (cfg Config) Enabled() bool {
+	return cfg.DropRate > 0 || cfg.BlockDelay > 0 || cfg.DuplicateRate > 0
+}
+
+// Faults decides when to inject the configured faults.
+type Faults struct {
+	mu  sync.Mutex
+	cfg Config
+	rnd *rand.Rand
+}
+
+// New constructs the faults for the configuration. The same seed always
+// produces the same sequence of decisions.
+func New(cfg Config) *Faults {
+	seed := cfg.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+
+	return &Faults{
+		cfg: cfg,
+		rnd: rand.New(rand.NewSource(seed)),
+	}
+}
+
+// Config returns a copy of the current configuration.
+func (f *Faults) Config() Config {
+	if f == nil {
+		return Config{}
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.cfg
+}
+
+// Update replaces the faults to inject. The sequence of random decisions
+// continues from where it was.
+func (f *Faults) Update(cfg Config) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.cfg = cfg
+}
+
+// DropRequest decides if the next peer request should be dropped.
+func (f *Faults) DropRequest() bool {
+	if f == nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.chance(f.cfg.DropRate)
+}
+
+// DuplicateTx decides if the next shared transaction should be sent twice.
+func (f *Faults) DuplicateTx() bool {
+	if f == nil {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.chance(f.cfg.DuplicateRate)
+}
+
+// BlockDelay returns the time a new block is held before it's proposed.
+func (f *Faults) BlockDelay() time.Duration {
+	if f == nil {
+		return 0
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.cfg.BlockDelay
+}
+
+// chance decides if an event with the rate happens. The random number is only
+// drawn for a rate between 0 and 1 so turning a fault off or on completely
+// doesn't change the sequence of the other decisions.
+func (f *Faults) chance(rate float64) bool {
+	switch {
+	case rate <= 0:
+		return false
+	case rate >= 1:
+		return true
+	}
+
+	return f.rnd.Float64() < rate
+}
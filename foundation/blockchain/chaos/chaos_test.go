@@ -0,0 +1,52 @@
+package chaos_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/chaos"
+)
+
+func Test_Faults(t *testing.T) {
+	var none *chaos.Faults
+	if none.DropRequest() || none.DuplicateTx() || none.BlockDelay() != 0 {
+		t.Fatalf("Should not inject faults without a configuration.")
+	}
+
+	always := chaos.New(chaos.Config{DropRate: 1, DuplicateRate: 1, BlockDelay: time.Second})
+	for i := 0; i < 10; i++ {
+		if !always.DropRequest() || !always.DuplicateTx() {
+			t.Fatalf("Should always inject the faults at a rate of 1.")
+		}
+	}
+	if always.BlockDelay() != time.Second {
+		t.Fatalf("Should return the block delay.")
+	}
+
+	always.Update(chaos.Config{})
+	if always.DropRequest() || always.DuplicateTx() {
+		t.Fatalf("Should stop injecting the faults once they are turned off.")
+	}
+
+	// The same seed makes the same decisions.
+	cfg := chaos.Config{DropRate: 0.5, Seed: 42}
+	f1 := chaos.New(cfg)
+	f2 := chaos.New(cfg)
+
+	var dropped int
+	for i := 0; i < 1000; i++ {
+		d := f1.DropRequest()
+		if d != f2.DropRequest() {
+			t.Fatalf("Should make the same decision for the same seed at %d.", i)
+		}
+		if d {
+			dropped++
+		}
+	}
+
+	if dropped < 400 || dropped > 600 {
+		t.Logf("got: %d", dropped)
+		t.Logf("exp: about %d", 500)
+		t.Fatalf("Should drop requests at the configured rate.")
+	}
+}
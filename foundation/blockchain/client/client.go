@@ -0,0 +1,379 @@
+// Package client provides a typed Go client for the public node API so
+// applications don't need to construct the HTTP calls themselves. Requests
+// that fail because of the network or the node being unavailable are retried.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/antispam"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+)
+
+// ErrNotFound is returned when the requested block or account doesn't exist.
+var ErrNotFound = errors.New("not found")
+
+// Set of default values used when the config doesn't provide them.
+const (
+	defaultRetries   = 3
+	defaultRetryWait = 250 * time.Millisecond
+	defaultTimeout   = 10 * time.Second
+)
+
+// Config represents the configuration for the client.
+type Config struct {
+	URL        string        // Url of the public node API like http://localhost:8080.
+	HTTPClient *http.Client  // Optional client to use for the requests.
+	Retries    int           // Number of times to retry a failed request, -1 turns it off.
+	RetryWait  time.Duration // Wait before the first retry which doubles for each retry.
+	Timeout    time.Duration // Time each request attempt has to complete.
+	Token      string        // Optional API token sent as a bearer token with each request.
+	WorkBits   int           // Bits of proof of work solved for each transaction submitted, for a node that requires it.
+}
+
+// Client provides access to the public node API.
+type Client struct {
+	url       string
+	http      *http.Client
+	retries   int
+	retryWait time.Duration
+	timeout   time.Duration
+	token     string
+	workBits  int
+}
+
+// New constructs a client for the node at the configured url.
+func New(cfg Config) *Client {
+	c := Client{
+		url:       strings.TrimSuffix(cfg.URL, "/"),
+		http:      cfg.HTTPClient,
+		retries:   cfg.Retries,
+		retryWait: cfg.RetryWait,
+		timeout:   cfg.Timeout,
+		token:     cfg.Token,
+		workBits:  cfg.WorkBits,
+	}
+
+	if c.http == nil {
+		c.http = &http.Client{}
+	}
+
+	switch {
+	case c.retries == 0:
+		c.retries = defaultRetries
+	case c.retries < 0:
+		c.retries = 0
+	}
+
+	if c.retryWait == 0 {
+		c.retryWait = defaultRetryWait
+	}
+
+	if c.timeout == 0 {
+		c.timeout = defaultTimeout
+	}
+
+	return &c
+}
+
+// SubmitTx submits the signed transaction to the mempool of the node.
+func (c *Client) SubmitTx(ctx context.Context, signedTx database.SignedTx) error {
+	return c.submit(ctx, "/v1/tx/submit", signedTx, nil)
+}
+
+// SubmitRawTx submits the transaction in the raw encoding, such as one signed
+// offline, to the mempool of the node and returns the transaction hash.
+func (c *Client) SubmitRawTx(ctx context.Context, raw []byte) (string, error) {
+	var result rawTxResult
+	if err := c.submit(ctx, "/v1/tx/raw", rawTx{Raw: raw}, &result); err != nil {
+		return "", err
+	}
+
+	return result.TxHash, nil
+}
+
+// GetBlock returns the block for the specified number. ErrNotFound is
+// returned if the block doesn't exist.
+func (c *Client) GetBlock(ctx context.Context, number uint64) (database.BlockData, error) {
+	return c.getBlock(ctx, fmt.Sprintf("%d", number))
+}
+
+// GetLatestBlock returns the latest block in the chain.
+func (c *Client) GetLatestBlock(ctx context.Context) (database.BlockData, error) {
+	return c.getBlock(ctx, "latest")
+}
+
+// GetAccount returns the account for the specified id. ErrNotFound is
+// returned if the account doesn't exist.
+func (c *Client) GetAccount(ctx context.Context, accountID database.AccountID) (Account, error) {
+	var info accountInfo
+	if err := c.do(ctx, http.MethodGet, "/v1/accounts/list/"+string(accountID), nil, &info); err != nil {
+		return Account{}, err
+	}
+
+	if len(info.Accounts) == 0 {
+		return Account{}, ErrNotFound
+	}
+
+	return info.Accounts[0], nil
+}
+
+// Resolve returns the account that owns the registered name. ErrNotFound is
+// returned if the name isn't registered.
+func (c *Client) Resolve(ctx context.Context, name string) (database.AccountID, error) {
+	var a alias
+	if err := c.do(ctx, http.MethodGet, "/v1/names/"+name, nil, &a); err != nil {
+		return "", err
+	}
+
+	return a.Account, nil
+}
+
+// EstimateFee returns the suggested tips for slow, normal and fast inclusion
+// of a transaction submitted now.
+func (c *Client) EstimateFee(ctx context.Context) (FeeEstimate, error) {
+	var est FeeEstimate
+	if err := c.do(ctx, http.MethodGet, "/v1/tx/fees", nil, &est); err != nil {
+		return FeeEstimate{}, err
+	}
+
+	return est, nil
+}
+
+// GetMempool returns the transactions in the mempool of the node sent from,
+// sent to or paid for by the account.
+func (c *Client) GetMempool(ctx context.Context, accountID database.AccountID) ([]MempoolTx, error) {
+	var txs []MempoolTx
+	if err := c.do(ctx, http.MethodGet, "/v1/tx/uncommitted/list/"+string(accountID), nil, &txs); err != nil {
+		return nil, err
+	}
+
+	return txs, nil
+}
+
+// CancelTx returns the unsigned transaction that cancels the pending
+// transaction from the account with the specified nonce. Once signed, it's
+// submitted with SubmitTx. ErrNotFound is returned if there is no pending
+// transaction for the nonce.
+func (c *Client) CancelTx(ctx context.Context, accountID database.AccountID, nonce uint64) (database.Tx, error) {
+	var tx database.Tx
+	if err := c.do(ctx, http.MethodGet, fmt.Sprintf("/v1/tx/cancel/%s/%d", accountID, nonce), nil, &tx); err != nil {
+		return database.Tx{}, err
+	}
+
+	return tx, nil
+}
+
+// NextNonce returns the nonce the next transaction from the account should
+// use, taking the transactions still in the mempool of the node into account.
+func (c *Client) NextNonce(ctx context.Context, accountID database.AccountID) (uint64, error) {
+	var nonce uint64
+
+	account, err := c.GetAccount(ctx, accountID)
+	switch {
+	case err == nil:
+		nonce = account.Nonce
+	case !errors.Is(err, ErrNotFound):
+		return 0, err
+	}
+
+	txs, err := c.GetMempool(ctx, accountID)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tx := range txs {
+		if tx.FromID == accountID && tx.Nonce > nonce {
+			nonce = tx.Nonce
+		}
+	}
+
+	return nonce + 1, nil
+}
+
+// getBlock returns the block for the number or name.
+func (c *Client) getBlock(ctx context.Context, number string) (database.BlockData, error) {
+	var blockData database.BlockData
+	if err := c.do(ctx, http.MethodGet, "/v1/blocks/number/"+number, nil, &blockData); err != nil {
+		return database.BlockData{}, err
+	}
+
+	return blockData, nil
+}
+
+// =============================================================================
+
+// Error represents an error response from the node.
+type Error struct {
+	StatusCode int
+	Message    string
+	Code       errcode.Code // Class of the failure when the node reported one.
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("node responded with %d: %s", e.StatusCode, e.Message)
+}
+
+// Unwrap returns the error with the code the node reported, so the code can
+// be checked with errcode.Is.
+func (e *Error) Unwrap() error {
+	if e.Code == "" {
+		return nil
+	}
+
+	return errcode.New(e.Code, e.Message)
+}
+
+// do executes the request and decodes the response, retrying the request if
+// it failed because of the network or the node being unavailable.
+func (c *Client) do(ctx context.Context, method string, path string, dataSend any, dataRecv any) error {
+	var body []byte
+	if dataSend != nil {
+		var err error
+		if body, err = json.Marshal(dataSend); err != nil {
+			return err
+		}
+	}
+
+	return c.retry(ctx, method, path, body, nil, dataRecv)
+}
+
+// submit executes the request submitting a transaction, with the proof of
+// work for the body when the client is configured to solve it.
+func (c *Client) submit(ctx context.Context, path string, dataSend any, dataRecv any) error {
+	body, err := json.Marshal(dataSend)
+	if err != nil {
+		return err
+	}
+
+	header := make(http.Header)
+	if c.workBits > 0 {
+		nonce, err := antispam.Solve(ctx, body, c.workBits)
+		if err != nil {
+			return err
+		}
+		header.Set(antispam.WorkHeader, strconv.FormatUint(nonce, 10))
+	}
+
+	return c.retry(ctx, http.MethodPost, path, body, header, dataRecv)
+}
+
+// retry executes the request until it succeeds or fails for a reason other
+// than the network or the node being unavailable.
+func (c *Client) retry(ctx context.Context, method string, path string, body []byte, header http.Header, dataRecv any) error {
+	wait := c.retryWait
+	for attempt := 0; ; attempt++ {
+		err := c.attempt(ctx, method, path, body, header, dataRecv)
+		if err == nil || attempt == c.retries || !retryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// attempt executes a single attempt of the request.
+func (c *Client) attempt(ctx context.Context, method string, path string, body []byte, header http.Header, dataRecv any) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	var r io.Reader
+	if body != nil {
+		r = bytes.NewReader(body)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.url+path, r)
+	if err != nil {
+		return err
+	}
+
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	for key, values := range header {
+		req.Header[key] = values
+	}
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+
+	case resp.StatusCode == http.StatusNoContent:
+		return nil
+
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return responseError(resp)
+	}
+
+	if dataRecv == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(dataRecv)
+}
+
+// responseError constructs an error from the error response of the node.
+func responseError(resp *http.Response) error {
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	var er struct {
+		Error string       `json:"error"`
+		Code  errcode.Code `json:"code"`
+	}
+	if err := json.Unmarshal(data, &er); err != nil || er.Error == "" {
+		er.Error = strings.TrimSpace(string(data))
+	}
+
+	return &Error{StatusCode: resp.StatusCode, Message: er.Error, Code: er.Code}
+}
+
+// retryable checks if the request can be tried again. Errors from the node
+// are only retried when the node is overloaded or failed.
+func retryable(err error) bool {
+	if errors.Is(err, ErrNotFound) || errors.Is(err, context.Canceled) {
+		return false
+	}
+
+	var re *Error
+	if errors.As(err, &re) {
+		return re.StatusCode == http.StatusTooManyRequests || re.StatusCode >= 500
+	}
+
+	var se *json.SyntaxError
+	var te *json.UnmarshalTypeError
+	if errors.As(err, &se) || errors.As(err, &te) {
+		return false
+	}
+
+	return true
+}
@@ -0,0 +1,192 @@
+package client_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/client"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	kennedyPrivateKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+	kennedyAccountID  = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	edAccountID       = "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"
+)
+
+func Test_Client(t *testing.T) {
+	var submits int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/tx/submit", func(w http.ResponseWriter, r *http.Request) {
+
+		// Fail the first attempt so the client has to retry.
+		if atomic.AddInt32(&submits, 1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var signedTx database.SignedTx
+		if err := json.NewDecoder(r.Body).Decode(&signedTx); err != nil || signedTx.Validate(1) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid transaction"}`)
+			return
+		}
+
+		fmt.Fprint(w, `{"status":"transactions added to mempool"}`)
+	})
+	mux.HandleFunc("/v1/accounts/list/", func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasSuffix(r.URL.Path, kennedyAccountID) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(w, `{"lastest_block":"0x0","uncommitted":0,"accounts":[{"account":%q,"name":"kennedy","balance":100,"nonce":2}]}`, kennedyAccountID)
+	})
+	mux.HandleFunc("/v1/blocks/number/", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(blockData(t, r.URL.Path[len("/v1/blocks/number/"):]))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := client.New(client.Config{URL: srv.URL, RetryWait: time.Millisecond})
+	ctx := context.Background()
+
+	pk, err := crypto.HexToECDSA(kennedyPrivateKey)
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	signedTx, err := database.Tx{ChainID: 1, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 10}.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := c.SubmitTx(ctx, signedTx); err != nil {
+		t.Fatalf("Should be able to submit the transaction after a retry: %v", err)
+	}
+
+	if n := atomic.LoadInt32(&submits); n != 2 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should have retried the failed request.")
+	}
+
+	signedTx.Value = 20
+	var re *client.Error
+	if err := c.SubmitTx(ctx, signedTx); !errors.As(err, &re) || re.StatusCode != http.StatusBadRequest || re.Message != "invalid transaction" {
+		t.Fatalf("Should return the error from the node: %v", err)
+	}
+
+	account, err := c.GetAccount(ctx, kennedyAccountID)
+	if err != nil {
+		t.Fatalf("Should be able to get the account: %v", err)
+	}
+	if account.Balance != 100 || account.Nonce != 2 {
+		t.Fatalf("Should decode the account: %+v", account)
+	}
+
+	if _, err := c.GetAccount(ctx, edAccountID); !errors.Is(err, client.ErrNotFound) {
+		t.Fatalf("Should not find an unknown account: %v", err)
+	}
+
+	block, err := c.GetBlock(ctx, 7)
+	if err != nil {
+		t.Fatalf("Should be able to get the block: %v", err)
+	}
+	if block.Header.Number != 7 {
+		t.Fatalf("Should decode the block, got number %d", block.Header.Number)
+	}
+}
+
+func Test_WatchBlocks(t *testing.T) {
+	var connects int32
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/events/stream", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+
+		// The first connection is lost after block 1 and the node mines blocks
+		// 2 to 4 before the client reconnects.
+		switch atomic.AddInt32(&connects, 1) {
+		case 1:
+			sendEvent(t, w, "1")
+		default:
+			fmt.Fprint(w, ": ping\n\n")
+			sendEvent(t, w, "4")
+			sendEvent(t, w, "5")
+		}
+	})
+	mux.HandleFunc("/v1/blocks/number/", func(w http.ResponseWriter, r *http.Request) {
+		number := r.URL.Path[len("/v1/blocks/number/"):]
+		if number == "latest" {
+			number = "4"
+		}
+
+		json.NewEncoder(w).Encode(blockData(t, number))
+	})
+
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	c := client.New(client.Config{URL: srv.URL, RetryWait: time.Millisecond})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	errDone := errors.New("done")
+
+	var got []uint64
+	err := c.WatchBlocks(ctx, func(block database.BlockData) error {
+		got = append(got, block.Header.Number)
+		if block.Header.Number == 5 {
+			return errDone
+		}
+		return nil
+	})
+
+	if !errors.Is(err, errDone) {
+		t.Fatalf("Should return the error from the function: %v", err)
+	}
+
+	exp := []uint64{1, 2, 3, 4, 5}
+	if fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should see every block in order once.")
+	}
+}
+
+// =============================================================================
+
+// blockData constructs a block with the specified number.
+func blockData(t *testing.T, number string) database.BlockData {
+	n, err := strconv.ParseUint(number, 10, 64)
+	if err != nil {
+		t.Fatalf("Should be able to parse the block number: %v", err)
+	}
+
+	return database.BlockData{Header: database.BlockHeader{Number: n}}
+}
+
+// sendEvent writes a block event to the stream.
+func sendEvent(t *testing.T, w http.ResponseWriter, number string) {
+	data, err := json.Marshal(blockData(t, number))
+	if err != nil {
+		t.Fatalf("Should be able to encode the block: %v", err)
+	}
+
+	fmt.Fprintf(w, "event: block\ndata: %s\n\n", data)
+	w.(http.Flusher).Flush()
+}
@@ -0,0 +1,76 @@
+package client
+
+import (
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Account represents the state of an account as reported by the node.
+type Account struct {
+	AccountID database.AccountID `json:"account"`
+	Name      string             `json:"name"`
+	Balance   uint64             `json:"balance"`
+	Locked    uint64             `json:"locked,omitempty"`
+	Immature  uint64             `json:"immature,omitempty"`
+	Bonded    uint64             `json:"bonded,omitempty"`
+	Unbonding uint64             `json:"unbonding,omitempty"`
+	Nonce     uint64             `json:"nonce"`
+	Escrow    *database.Escrow   `json:"escrow,omitempty"`
+}
+
+// MempoolTx represents a transaction waiting in the mempool of the node.
+type MempoolTx struct {
+	FromID     database.AccountID `json:"from"`
+	ToID       database.AccountID `json:"to"`
+	ChainID    uint16             `json:"chain_id"`
+	Nonce      uint64             `json:"nonce"`
+	Value      uint64             `json:"value"`
+	Tip        uint64             `json:"tip"`
+	ValidUntil uint64             `json:"valid_until,omitempty"`
+	FeePayerID database.AccountID `json:"fee_payer,omitempty"`
+	TimeStamp  uint64             `json:"timestamp"`
+	GasPrice   uint64             `json:"gas_price"`
+	GasUnits   uint64             `json:"gas_units"`
+	Sig        string             `json:"sig"`
+}
+
+// FeeTier represents a suggested tip and how long a transaction offering it
+// is expected to wait before it's mined.
+type FeeTier struct {
+	Tip    uint64  `json:"tip"`
+	Blocks uint64  `json:"blocks"`
+	Wait   float64 `json:"wait_secs"`
+}
+
+// FeeEstimate represents the suggested fees for a transaction as reported by
+// the node.
+type FeeEstimate struct {
+	GasPrice uint64  `json:"gas_price"`
+	BaseFee  uint64  `json:"base_fee"`
+	Slow     FeeTier `json:"slow"`
+	Normal   FeeTier `json:"normal"`
+	Fast     FeeTier `json:"fast"`
+}
+
+// rawTx represents the request to submit a raw transaction.
+type rawTx struct {
+	Raw hexutil.Bytes `json:"raw"`
+}
+
+// rawTxResult represents the response for a submitted raw transaction.
+type rawTxResult struct {
+	TxHash string `json:"tx_hash"`
+}
+
+// alias represents the response for a resolved name.
+type alias struct {
+	Name    string             `json:"name"`
+	Account database.AccountID `json:"account"`
+}
+
+// accountInfo represents the response for the list of accounts.
+type accountInfo struct {
+	LatestBlock string    `json:"lastest_block"`
+	Uncommitted int       `json:"uncommitted"`
+	Accounts    []Account `json:"accounts"`
+}
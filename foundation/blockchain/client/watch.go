@@ -0,0 +1,178 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// maxEventSize is the largest event that can be read from the stream.
+const maxEventSize = 16 * 1024 * 1024
+
+// WatchBlocks calls the function for each new block in the chain until the
+// context is cancelled or the function returns an error. The stream of events
+// is reconnected if it's lost, and any blocks missed while disconnected are
+// requested so the function sees every block in order.
+func (c *Client) WatchBlocks(ctx context.Context, fn func(block database.BlockData) error) error {
+	var last uint64
+
+	// deliver calls the function for the block after any blocks that were
+	// missed since the last block delivered.
+	deliver := func(block database.BlockData) error {
+		number := block.Header.Number
+		if number <= last {
+			return nil
+		}
+
+		for last != 0 && last+1 < number {
+			missed, err := c.GetBlock(ctx, last+1)
+			if err != nil {
+				return err
+			}
+
+			if err := fn(missed); err != nil {
+				return callbackError{err}
+			}
+			last++
+		}
+
+		if err := fn(block); err != nil {
+			return callbackError{err}
+		}
+		last = number
+
+		return nil
+	}
+
+	// onOpen catches up with the blocks produced while reconnecting.
+	onOpen := func() error {
+		if last == 0 {
+			return nil
+		}
+
+		latest, err := c.GetLatestBlock(ctx)
+		if err != nil {
+			return err
+		}
+
+		return deliver(latest)
+	}
+
+	onEvent := func(event string, data string) error {
+		var block database.BlockData
+		if err := json.Unmarshal([]byte(data), &block); err != nil {
+			return fmt.Errorf("decoding block event: %w", err)
+		}
+
+		return deliver(block)
+	}
+
+	wait := c.retryWait
+	failures := 0
+	for {
+		connected, err := c.stream(ctx, "/v1/events/stream?types=block", onOpen, onEvent)
+
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if ce, ok := err.(callbackError); ok {
+			return ce.err
+		}
+
+		if connected {
+			wait = c.retryWait
+			failures = 0
+		}
+
+		failures++
+		if failures > c.retries {
+			if err == nil {
+				err = fmt.Errorf("event stream closed by the node")
+			}
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(wait):
+		}
+		wait *= 2
+	}
+}
+
+// callbackError marks an error returned by the function provided by the
+// caller so it isn't retried.
+type callbackError struct {
+	err error
+}
+
+// Error implements the error interface.
+func (ce callbackError) Error() string {
+	return ce.err.Error()
+}
+
+// stream reads the Server-Sent Events from the path until the stream ends or
+// a function returns an error. It reports if the stream was opened.
+func (c *Client) stream(ctx context.Context, path string, onOpen func() error, onEvent func(event string, data string) error) (bool, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.url+path, nil)
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return false, responseError(resp)
+	}
+
+	if err := onOpen(); err != nil {
+		return true, err
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), maxEventSize)
+
+	var event string
+	var data []string
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		switch {
+		case line == "":
+			if len(data) > 0 {
+				if err := onEvent(event, strings.Join(data, "\n")); err != nil {
+					return true, err
+				}
+			}
+			event, data = "", nil
+
+		case strings.HasPrefix(line, ":"):
+			// Comments keep the connection alive.
+
+		case strings.HasPrefix(line, "event:"):
+			event = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+
+		case strings.HasPrefix(line, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(line, "data:"), " "))
+		}
+	}
+
+	return true, scanner.Err()
+}
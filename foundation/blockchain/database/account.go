@@ -2,8 +2,16 @@ package database
 
 import (
 	"crypto/ecdsa"
+	"crypto/ed25519"
+	"encoding/hex"
 	"errors"
+	"fmt"
+	"strings"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -12,6 +20,69 @@ type Account struct {
 	AccountID AccountID
 	Nonce     uint64
 	Balance   uint64
+
+	// The metadata is omitted from the JSON when not used so the hash of
+	// the account stays the same for the state root.
+	Vesting   *genesis.Vesting `json:",omitempty"` // Locks part of the balance until it's released.
+	Escrow    *Escrow          `json:",omitempty"` // Marks the account as holding funds in escrow.
+	Bonded    uint64           `json:",omitempty"` // Stake locked as a validator that can be slashed.
+	Unbonding uint64           `json:",omitempty"` // Stake being released that can still be slashed.
+	UnbondAt  uint64           `json:",omitempty"` // Block the unbonding stake can be withdrawn.
+	BLSKey    string           `json:",omitempty"` // Public key in hex the validator votes for blocks with.
+	Name      *Name            `json:",omitempty"` // Marks the account as holding a registered name.
+	Rewards   *Rewards         `json:",omitempty"` // Mining rewards that can't be spent until they mature.
+}
+
+// Rewards represents the mining rewards credited to an account that haven't
+// matured yet. Rewards that matured are dropped the next time a reward is
+// credited to the account.
+type Rewards struct {
+	Maturing []MaturingReward
+}
+
+// MaturingReward represents a mining reward that can be spent from the
+// block it matures at.
+type MaturingReward struct {
+	Amount   uint64
+	MatureAt uint64
+}
+
+// ImmatureAt returns the amount of the rewards that can't be spent at the
+// specified block number.
+func (r *Rewards) ImmatureAt(blockNum uint64) uint64 {
+	if r == nil {
+		return 0
+	}
+
+	var immature uint64
+	for _, reward := range r.Maturing {
+		if reward.MatureAt > blockNum {
+			immature += reward.Amount
+		}
+	}
+
+	return immature
+}
+
+// credit returns new rewards with the reward from the block added and the
+// rewards that matured by the block dropped. A new value is returned since
+// the accounts share the pointer with the undo history.
+func (r *Rewards) credit(blockNum uint64, amount uint64, maturity uint64) *Rewards {
+	var maturing []MaturingReward
+	if r != nil {
+		for _, reward := range r.Maturing {
+			if reward.MatureAt > blockNum {
+				maturing = append(maturing, reward)
+			}
+		}
+	}
+
+	maturing = append(maturing, MaturingReward{
+		Amount:   amount,
+		MatureAt: blockNum + maturity,
+	})
+
+	return &Rewards{Maturing: maturing}
 }
 
 // newAccount constructs a new account value for use.
@@ -22,6 +93,41 @@ func newAccount(accountID AccountID, balance uint64) Account {
 	}
 }
 
+// Spendable returns the part of the balance that isn't locked by a vesting
+// schedule or held back by immature mining rewards at the specified block
+// number.
+func (a Account) Spendable(blockNum uint64) uint64 {
+	if a.Vesting == nil && a.Rewards == nil {
+		return a.Balance
+	}
+
+	locked := a.Rewards.ImmatureAt(blockNum)
+	if a.Vesting != nil {
+		locked += a.Vesting.LockedAt(blockNum)
+	}
+
+	if locked >= a.Balance {
+		return 0
+	}
+
+	return a.Balance - locked
+}
+
+// Hash implements the merkle Hashable interface for providing a hash
+// of an account.
+func (a Account) Hash() ([]byte, error) {
+	str := signature.Hash(a)
+
+	// Need to remove the 0x prefix from the hash.
+	return hex.DecodeString(str[2:])
+}
+
+// Equals implements the merkle Hashable interface for providing an equality
+// check between two accounts. Each account id only exists once in the state.
+func (a Account) Equals(other Account) bool {
+	return a.AccountID == other.AccountID
+}
+
 // =============================================================================
 
 // AccountID represents an account id that is used to sign transactions and is
@@ -29,15 +135,48 @@ func newAccount(accountID AccountID, balance uint64) Account {
 // bytes of the public key.
 type AccountID string
 
-// ToAccountID converts a hex-encoded string to an account and validates the
-// hex-encoded string is formatted correctly.
-func ToAccountID(hex string) (AccountID, error) {
-	a := AccountID(hex)
+// ErrChecksum is returned for a mixed case account that doesn't match its
+// checksum, which usually means the account was mistyped.
+var ErrChecksum = errcode.New(errcode.InvalidTx, "invalid account checksum")
+
+// ToAccountID converts a hex-encoded or bech32 string to an account and
+// validates the string is formatted correctly. A mixed case hex-encoded
+// string must carry a valid EIP-55 checksum, while all lower or upper case
+// strings are accepted without one. The account is returned in its
+// checksummed form.
+func ToAccountID(s string) (AccountID, error) {
+	if strings.HasPrefix(strings.ToLower(s), AccountHRP+"1") {
+		return FromBech32(s)
+	}
+
+	a := AccountID(s)
 	if !a.IsAccountID() {
 		return "", errors.New("invalid account format")
 	}
 
-	return a, nil
+	if !a.HasValidChecksum() {
+		return "", fmt.Errorf("%w: %s", ErrChecksum, s)
+	}
+
+	return a.Checksum(), nil
+}
+
+// FromBech32 converts a bech32 string to an account.
+func FromBech32(s string) (AccountID, error) {
+	hrp, data, err := bech32Decode(s)
+	if err != nil {
+		return "", err
+	}
+
+	if hrp != AccountHRP {
+		return "", fmt.Errorf("bech32 prefix is %q, exp %q", hrp, AccountHRP)
+	}
+
+	if len(data) != common.AddressLength {
+		return "", fmt.Errorf("bech32 account is %d bytes, exp %d", len(data), common.AddressLength)
+	}
+
+	return AccountID(common.BytesToAddress(data).Hex()), nil
 }
 
 // PublicKeyToAccountID converts the public key to an account value.
@@ -45,6 +184,12 @@ func PublicKeyToAccountID(pk ecdsa.PublicKey) AccountID {
 	return AccountID(crypto.PubkeyToAddress(pk).String())
 }
 
+// Ed25519PublicKeyToAccountID converts the Ed25519 public key to an account
+// value.
+func Ed25519PublicKeyToAccountID(pk ed25519.PublicKey) AccountID {
+	return AccountID(signature.Ed25519Address(pk))
+}
+
 // IsAccountID verifies whether the underlying data represents a valid
 // hex-encoded account.
 func (a AccountID) IsAccountID() bool {
@@ -57,6 +202,35 @@ func (a AccountID) IsAccountID() bool {
 	return len(a) == 2*addressLength && isHex(a)
 }
 
+// Checksum returns the account in the EIP-55 mixed case form, where the case
+// of each letter is set by the hash of the account. The account must be
+// properly formatted.
+func (a AccountID) Checksum() AccountID {
+	return AccountID(common.HexToAddress(string(a)).Hex())
+}
+
+// HasValidChecksum reports if the account is in all lower or upper case, or
+// is in mixed case matching its EIP-55 checksum.
+func (a AccountID) HasValidChecksum() bool {
+	if has0xPrefix(a) {
+		a = a[2:]
+	}
+
+	hex := string(a)
+	if hex == strings.ToLower(hex) || hex == strings.ToUpper(hex) {
+		return true
+	}
+
+	return string(a.Checksum()[2:]) == hex
+}
+
+// Bech32 returns the account encoded with bech32. The account must be
+// properly formatted.
+func (a AccountID) Bech32() string {
+	s, _ := bech32Encode(AccountHRP, common.HexToAddress(string(a)).Bytes())
+	return s
+}
+
 // =============================================================================
 
 // has0xPrefix validates the account starts with a 0x.
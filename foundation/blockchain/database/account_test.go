@@ -0,0 +1,91 @@
+package database_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+func Test_ToAccountID(t *testing.T) {
+	const checksummed = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+
+	tt := []struct {
+		name  string
+		input string
+		err   error
+	}{
+		{name: "checksummed", input: checksummed},
+		{name: "lower", input: strings.ToLower(checksummed)},
+		{name: "upper", input: "0x" + strings.ToUpper(checksummed[2:])},
+		{name: "no-prefix", input: checksummed[2:]},
+		{name: "mistyped", input: "0xF01813E4B85e178A83e29B8E7bF26BD830a25F32", err: database.ErrChecksum},
+	}
+
+	for _, tst := range tt {
+		t.Run(tst.name, func(t *testing.T) {
+			accountID, err := database.ToAccountID(tst.input)
+			if tst.err != nil {
+				if !errors.Is(err, tst.err) {
+					t.Logf("got: %v", err)
+					t.Logf("exp: %v", tst.err)
+					t.Fatalf("Should reject the account.")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Should accept the account: %v", err)
+			}
+
+			if accountID != checksummed {
+				t.Logf("got: %s", accountID)
+				t.Logf("exp: %s", checksummed)
+				t.Fatalf("Should get back the checksummed account.")
+			}
+		})
+	}
+
+	if _, err := database.ToAccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f3"); err == nil {
+		t.Fatalf("Should reject an account that is too short.")
+	}
+}
+
+func Test_Bech32(t *testing.T) {
+	const accountID = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+
+	encoded := accountID.Bech32()
+	if !strings.HasPrefix(encoded, database.AccountHRP+"1") || encoded != strings.ToLower(encoded) {
+		t.Fatalf("Should encode the account in lower case with the prefix: %s", encoded)
+	}
+
+	for _, s := range []string{encoded, strings.ToUpper(encoded)} {
+		decoded, err := database.ToAccountID(s)
+		if err != nil {
+			t.Fatalf("Should be able to decode %s: %v", s, err)
+		}
+
+		if decoded != accountID {
+			t.Logf("got: %s", decoded)
+			t.Logf("exp: %s", accountID)
+			t.Fatalf("Should get back the same account.")
+		}
+	}
+
+	// Changing a single character breaks the checksum.
+	last := len(database.AccountHRP) + 5
+	typo := []byte(encoded)
+	if typo[last] == 'q' {
+		typo[last] = 'p'
+	} else {
+		typo[last] = 'q'
+	}
+	if _, err := database.ToAccountID(string(typo)); err == nil {
+		t.Fatalf("Should reject a mistyped bech32 account.")
+	}
+
+	if _, err := database.FromBech32(strings.Replace(encoded, "ardan1", "other1", 1)); err == nil {
+		t.Fatalf("Should reject a bech32 account with a different prefix.")
+	}
+}
@@ -0,0 +1,239 @@
+package database
+
+import (
+	"hash/fnv"
+	"sync"
+	"sync/atomic"
+)
+
+// accountShards is the number of shards the accounts are split across.
+const accountShards = 16
+
+// accountSet holds the accounts split across shards that each have their own
+// lock, so reading an account only contends with writes to the same shard.
+// Writes are made by the database while it holds its lock, which keeps the
+// changes of a transaction ordered and lets a snapshot taken under the read
+// lock see every shard at the same point.
+//
+// Each shard is copy-on-write so a snapshot can be taken without copying the
+// accounts. Taking a snapshot marks the shards as shared and the next write
+// to a shard copies it before changing it, so many snapshots taken between
+// writes share a single copy.
+//
+// A set can also be layered on top of another set to stage changes. Reads
+// fall through to the base set for accounts the layer hasn't changed and the
+// base set is never written to.
+type accountSet struct {
+	shards  [accountShards]*accountShard
+	base    *accountSet            // Set the layer is staged on, nil if not a layer.
+	removed map[AccountID]struct{} // Accounts of the base set the layer removed.
+}
+
+// accountShard holds the accounts for a single shard.
+type accountShard struct {
+	mu       sync.RWMutex
+	accounts map[AccountID]Account
+	shared   int32
+}
+
+// newAccountSet constructs an account set that holds the accounts.
+func newAccountSet(accounts map[AccountID]Account) accountSet {
+	var as accountSet
+	for i := range as.shards {
+		as.shards[i] = &accountShard{accounts: make(map[AccountID]Account)}
+	}
+
+	for accountID, account := range accounts {
+		as.shard(accountID).accounts[accountID] = account
+	}
+
+	return as
+}
+
+// newLayer constructs an empty set layered on top of the base set.
+func newLayer(base *accountSet) accountSet {
+	as := newAccountSet(nil)
+	as.base = base
+	as.removed = make(map[AccountID]struct{})
+
+	return as
+}
+
+// shardIndex returns the index of the shard holding the account.
+func shardIndex(accountID AccountID) int {
+	h := fnv.New32a()
+	h.Write([]byte(accountID))
+
+	return int(h.Sum32() % accountShards)
+}
+
+// shard returns the shard holding the account.
+func (as *accountSet) shard(accountID AccountID) *accountShard {
+	return as.shards[shardIndex(accountID)]
+}
+
+// lookup returns the account and if it exists.
+func (as *accountSet) lookup(accountID AccountID) (Account, bool) {
+	shard := as.shard(accountID)
+
+	shard.mu.RLock()
+	account, exists := shard.accounts[accountID]
+	shard.mu.RUnlock()
+
+	if exists || as.base == nil {
+		return account, exists
+	}
+
+	if _, removed := as.removed[accountID]; removed {
+		return Account{}, false
+	}
+
+	return as.base.lookup(accountID)
+}
+
+// get returns the account or an empty account if it doesn't exist.
+func (as *accountSet) get(accountID AccountID) Account {
+	account, _ := as.lookup(accountID)
+	return account
+}
+
+// set adds or replaces the account.
+func (as *accountSet) set(accountID AccountID, account Account) {
+	shard := as.shard(accountID)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.own()
+	shard.accounts[accountID] = account
+
+	if as.base != nil {
+		delete(as.removed, accountID)
+	}
+}
+
+// remove deletes the account.
+func (as *accountSet) remove(accountID AccountID) {
+	shard := as.shard(accountID)
+
+	shard.mu.Lock()
+	defer shard.mu.Unlock()
+
+	shard.own()
+	delete(shard.accounts, accountID)
+
+	if as.base != nil {
+		as.removed[accountID] = struct{}{}
+	}
+}
+
+// replace swaps the accounts for the accounts held by the other set. The
+// other set must not be used afterwards.
+func (as *accountSet) replace(other accountSet) {
+	for i, shard := range as.shards {
+		shard.mu.Lock()
+		shard.accounts = other.shards[i].accounts
+		atomic.StoreInt32(&shard.shared, atomic.LoadInt32(&other.shards[i].shared))
+		shard.mu.Unlock()
+	}
+}
+
+// forEach calls the function for every account in no particular order.
+func (as *accountSet) forEach(fn func(account Account)) {
+	if as.base != nil {
+		as.base.forEach(func(account Account) {
+			if _, removed := as.removed[account.AccountID]; removed {
+				return
+			}
+			if _, changed := as.shard(account.AccountID).accounts[account.AccountID]; changed {
+				return
+			}
+			fn(account)
+		})
+	}
+
+	for _, shard := range as.shards {
+		shard.mu.RLock()
+		for _, account := range shard.accounts {
+			fn(account)
+		}
+		shard.mu.RUnlock()
+	}
+}
+
+// changes calls the function for every account a layer changed or removed.
+func (as *accountSet) changes(fn func(accountID AccountID, account Account, removed bool)) {
+	for _, shard := range as.shards {
+		for accountID, account := range shard.accounts {
+			fn(accountID, account, false)
+		}
+	}
+
+	for accountID := range as.removed {
+		fn(accountID, Account{}, true)
+	}
+}
+
+// snapshot returns a read-only view of the current accounts. A layer can't
+// be snapshotted.
+func (as *accountSet) snapshot() AccountSnapshot {
+	var snapshot AccountSnapshot
+	for i, shard := range as.shards {
+		shard.mu.RLock()
+		atomic.StoreInt32(&shard.shared, 1)
+		snapshot.shards[i] = shard.accounts
+		shard.mu.RUnlock()
+	}
+
+	return snapshot
+}
+
+// own copies the accounts if they are shared with a snapshot so they can be
+// changed. The caller must hold the shard lock.
+func (shard *accountShard) own() {
+	if atomic.LoadInt32(&shard.shared) == 0 {
+		return
+	}
+
+	accounts := make(map[AccountID]Account, len(shard.accounts))
+	for accountID, account := range shard.accounts {
+		accounts[accountID] = account
+	}
+
+	shard.accounts = accounts
+	atomic.StoreInt32(&shard.shared, 0)
+}
+
+// =============================================================================
+
+// AccountSnapshot is a read-only view of the accounts at a point in time.
+// Taking a snapshot doesn't copy the accounts and the snapshot doesn't change
+// when the database does.
+type AccountSnapshot struct {
+	shards [accountShards]map[AccountID]Account
+}
+
+// Len returns the number of accounts.
+func (s AccountSnapshot) Len() int {
+	var n int
+	for _, accounts := range s.shards {
+		n += len(accounts)
+	}
+
+	return n
+}
+
+// Query returns the account and if it exists.
+func (s AccountSnapshot) Query(accountID AccountID) (Account, bool) {
+	account, exists := s.shards[shardIndex(accountID)][accountID]
+	return account, exists
+}
+
+// ForEach calls the function for every account in no particular order.
+func (s AccountSnapshot) ForEach(fn func(account Account)) {
+	for _, accounts := range s.shards {
+		for _, account := range accounts {
+			fn(account)
+		}
+	}
+}
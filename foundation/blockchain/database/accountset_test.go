@@ -0,0 +1,130 @@
+package database_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_Snapshot(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Balances: map[string]uint64{benchFromID: 1000}}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	before := db.Snapshot()
+	again := db.Snapshot()
+
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: benchMinerID}}
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: benchFromID, ToID: benchToID, Value: 100}
+	if err := db.ApplyTransaction(block, database.NewBlockTx(database.SignedTx{Tx: tx}, 1, 1)); err != nil {
+		t.Fatalf("Should be able to apply transaction: %v", err)
+	}
+
+	for _, snapshot := range []database.AccountSnapshot{before, again} {
+		if snapshot.Len() != 1 {
+			t.Logf("got: %d", snapshot.Len())
+			t.Logf("exp: %d", 1)
+			t.Fatalf("Should not see the accounts created after the snapshot.")
+		}
+
+		if account, _ := snapshot.Query(benchFromID); account.Balance != 1000 {
+			t.Logf("got: %d", account.Balance)
+			t.Logf("exp: %d", 1000)
+			t.Fatalf("Should not see the changes made after the snapshot.")
+		}
+	}
+
+	after := db.Snapshot()
+	if after.Len() != 3 {
+		t.Logf("got: %d", after.Len())
+		t.Logf("exp: %d", 3)
+		t.Fatalf("Should see the accounts created before the snapshot.")
+	}
+
+	if account, _ := after.Query(benchToID); account.Balance != 100 {
+		t.Logf("got: %d", account.Balance)
+		t.Logf("exp: %d", 100)
+		t.Fatalf("Should see the changes made before the snapshot.")
+	}
+}
+
+func Test_ConcurrentQuery(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Balances: map[string]uint64{benchFromID: 1_000_000}}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Query the accounts and take snapshots while transactions are applied.
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				db.Query(benchFromID)
+				db.Query(benchToID)
+				db.Snapshot().ForEach(func(database.Account) {})
+			}
+		}()
+	}
+
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: benchMinerID}}
+	for nonce := uint64(1); nonce <= 200; nonce++ {
+		tx := database.Tx{ChainID: 1, Nonce: nonce, FromID: benchFromID, ToID: benchToID, Value: 10}
+		if err := db.ApplyTransaction(block, database.NewBlockTx(database.SignedTx{Tx: tx}, 1, 1)); err != nil {
+			t.Fatalf("Should be able to apply transaction: %v", err)
+		}
+	}
+
+	close(done)
+	wg.Wait()
+
+	account, err := db.Query(benchToID)
+	if err != nil {
+		t.Fatalf("Should be able to query the account: %v", err)
+	}
+
+	if account.Balance != 2000 {
+		t.Logf("got: %d", account.Balance)
+		t.Logf("exp: %d", 2000)
+		t.Fatalf("Should apply every transaction.")
+	}
+}
+
+func Benchmark_Query(b *testing.B) {
+	balances := make(map[string]uint64)
+	ids := make([]database.AccountID, 1000)
+	for i := range ids {
+		ids[i] = database.AccountID(fmt.Sprintf("0x%040x", i))
+		balances[string(ids[i])] = 100
+	}
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, Balances: balances}, MockStorage{}, nil)
+	if err != nil {
+		b.Fatalf("Should be able to open database: %v", err)
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		for i := 0; pb.Next(); i++ {
+			if _, err := db.Query(ids[i%len(ids)]); err != nil {
+				b.Fatalf("Should be able to query the account: %v", err)
+			}
+		}
+	})
+}
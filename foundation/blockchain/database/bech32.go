@@ -0,0 +1,149 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AccountHRP is the human readable part of an account encoded with bech32.
+const AccountHRP = "ardan"
+
+// bech32Charset is the alphabet of the bech32 data part.
+const bech32Charset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+
+// CORE NOTE: Bech32 (BIP 173) encodes the account with a human readable
+// prefix, a separator and the 20 bytes in a 32 character alphabet that leaves
+// out characters that are easily confused, followed by a 6 character
+// checksum. The checksum detects any error in up to 4 characters, which is
+// stronger than the mixed case checksum of hex accounts, and bech32 accounts
+// are a single case so they are easier to read out and type.
+
+// bech32Encode encodes the data with the human readable part.
+func bech32Encode(hrp string, data []byte) (string, error) {
+	values, err := convertBits(data, 8, 5, true)
+	if err != nil {
+		return "", err
+	}
+
+	checksum := bech32Checksum(hrp, values)
+
+	var b strings.Builder
+	b.WriteString(hrp)
+	b.WriteByte('1')
+	for _, v := range append(values, checksum...) {
+		b.WriteByte(bech32Charset[v])
+	}
+
+	return b.String(), nil
+}
+
+// bech32Decode decodes the string and returns the human readable part and
+// the data after verifying the checksum.
+func bech32Decode(s string) (string, []byte, error) {
+	if strings.ToLower(s) != s && strings.ToUpper(s) != s {
+		return "", nil, errors.New("bech32 string is mixed case")
+	}
+	s = strings.ToLower(s)
+
+	sep := strings.LastIndexByte(s, '1')
+	if sep < 1 || sep+7 > len(s) {
+		return "", nil, errors.New("bech32 string is malformed")
+	}
+	hrp := s[:sep]
+
+	values := make([]byte, 0, len(s)-sep-1)
+	for i := sep + 1; i < len(s); i++ {
+		v := strings.IndexByte(bech32Charset, s[i])
+		if v < 0 {
+			return "", nil, fmt.Errorf("bech32 string has invalid character %q", s[i])
+		}
+		values = append(values, byte(v))
+	}
+
+	if bech32Polymod(append(bech32HRPExpand(hrp), values...)) != 1 {
+		return "", nil, errors.New("bech32 checksum is invalid")
+	}
+
+	data, err := convertBits(values[:len(values)-6], 5, 8, false)
+	if err != nil {
+		return "", nil, err
+	}
+
+	return hrp, data, nil
+}
+
+// bech32Checksum returns the 6 checksum values for the data.
+func bech32Checksum(hrp string, values []byte) []byte {
+	input := append(bech32HRPExpand(hrp), values...)
+	input = append(input, 0, 0, 0, 0, 0, 0)
+	mod := bech32Polymod(input) ^ 1
+
+	checksum := make([]byte, 6)
+	for i := range checksum {
+		checksum[i] = byte(mod>>uint(5*(5-i))) & 31
+	}
+
+	return checksum
+}
+
+// bech32Polymod computes the BCH checksum over the values.
+func bech32Polymod(values []byte) uint32 {
+	gen := [5]uint32{0x3b6a57b2, 0x26508e6d, 0x1ea119fa, 0x3d4233dd, 0x2a1462b3}
+
+	chk := uint32(1)
+	for _, v := range values {
+		top := chk >> 25
+		chk = (chk&0x1ffffff)<<5 ^ uint32(v)
+		for i := 0; i < 5; i++ {
+			if (top>>uint(i))&1 == 1 {
+				chk ^= gen[i]
+			}
+		}
+	}
+
+	return chk
+}
+
+// bech32HRPExpand expands the human readable part for the checksum.
+func bech32HRPExpand(hrp string) []byte {
+	values := make([]byte, 0, len(hrp)*2+1)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]>>5)
+	}
+	values = append(values, 0)
+	for i := 0; i < len(hrp); i++ {
+		values = append(values, hrp[i]&31)
+	}
+
+	return values
+}
+
+// convertBits regroups the data from groups of the specified bits to another.
+func convertBits(data []byte, from uint, to uint, pad bool) ([]byte, error) {
+	var acc uint32
+	var bits uint
+	maxv := uint32(1)<<to - 1
+
+	var out []byte
+	for _, v := range data {
+		if uint32(v)>>from != 0 {
+			return nil, errors.New("bech32 data value out of range")
+		}
+		acc = acc<<from | uint32(v)
+		bits += from
+		for bits >= to {
+			bits -= to
+			out = append(out, byte(acc>>bits&maxv))
+		}
+	}
+
+	switch {
+	case pad && bits > 0:
+		out = append(out, byte(acc<<(to-bits)&maxv))
+	case !pad && (bits >= from || acc<<(to-bits)&maxv != 0):
+		return nil, errors.New("bech32 data has invalid padding")
+	}
+
+	return out, nil
+}
@@ -0,0 +1,139 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+const (
+	benchFromID  = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+	benchToID    = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	benchMinerID = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+)
+
+func Benchmark_BlockHash(b *testing.B) {
+	block := database.Block{
+		Header: database.BlockHeader{
+			Number:        1,
+			PrevBlockHash: signature.ZeroHash,
+			TimeStamp:     1641042000000,
+			BeneficiaryID: benchMinerID,
+			Difficulty:    6,
+			MiningReward:  700,
+			StateRoot:     signature.ZeroHash,
+			TransRoot:     signature.ZeroHash,
+		},
+	}
+
+	for i := 0; i < b.N; i++ {
+		block.Header.Nonce = uint64(i)
+		block.Hash()
+	}
+}
+
+func Benchmark_TxValidate(b *testing.B) {
+	blockTx, err := sign(database.Tx{ChainID: 1, Nonce: 1, FromID: benchFromID, ToID: benchToID, Value: 10}, 1)
+	if err != nil {
+		b.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := blockTx.Validate(1); err != nil {
+			b.Fatalf("Should be able to validate transaction: %v", err)
+		}
+	}
+}
+
+func Benchmark_ApplyTransaction(b *testing.B) {
+	gen := genesis.Genesis{ChainID: 1, Balances: map[string]uint64{benchFromID: uint64(b.N) * 100}}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		b.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Applying a transaction doesn't check the signature so the transactions
+	// don't need to be signed, which keeps the setup cheap for a large b.N.
+	block := database.Block{Header: database.BlockHeader{BeneficiaryID: benchMinerID}}
+	txs := make([]database.BlockTx, b.N)
+	for i := range txs {
+		tx := database.Tx{ChainID: 1, Nonce: uint64(i + 1), FromID: benchFromID, ToID: benchToID, Value: 10}
+		txs[i] = database.NewBlockTx(database.SignedTx{Tx: tx}, 1, 1)
+	}
+
+	b.ResetTimer()
+	for _, tx := range txs {
+		if err := db.ApplyTransaction(block, tx); err != nil {
+			b.Fatalf("Should be able to apply transaction: %v", err)
+		}
+	}
+}
+
+// Benchmark_ApplyBlock measures the work a node does for a block received
+// from a peer: validating the block and the signatures of its transactions
+// and then applying them to the accounts.
+func Benchmark_ApplyBlock(b *testing.B) {
+	for _, n := range []int{10, 100} {
+		b.Run(fmt.Sprintf("txs=%d", n), func(b *testing.B) {
+			benchApplyBlock(b, n)
+		})
+	}
+}
+
+func benchApplyBlock(b *testing.B, trans int) {
+	ev := func(v string, args ...any) {}
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, MiningReward: 700, Balances: map[string]uint64{benchFromID: 1_000_000}}
+
+	db, err := database.New(gen, MockStorage{}, ev)
+	if err != nil {
+		b.Fatalf("Should be able to open database: %v", err)
+	}
+
+	txs := make([]database.BlockTx, trans)
+	for i := range txs {
+		tx := database.Tx{ChainID: 1, Nonce: uint64(i + 1), FromID: benchFromID, ToID: benchToID, Value: 10}
+		if txs[i], err = sign(tx, 1); err != nil {
+			b.Fatalf("Should be able to sign transaction: %v", err)
+		}
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: benchMinerID,
+		Difficulty:    gen.Difficulty,
+		MiningReward:  gen.MiningReward,
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashState(),
+		Trans:         txs,
+		EvHandler:     ev,
+	})
+	if err != nil {
+		b.Fatalf("Should be able to mine block: %v", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		db, err := database.New(gen, MockStorage{}, ev)
+		if err != nil {
+			b.Fatalf("Should be able to open database: %v", err)
+		}
+		b.StartTimer()
+
+		if err := db.ValidateBlock(block, ev); err != nil {
+			b.Fatalf("Should be able to validate block: %v", err)
+		}
+
+		for _, tx := range block.MerkleTree.Values() {
+			if err := db.ApplyTransaction(block, tx); err != nil {
+				b.Fatalf("Should be able to apply transaction: %v", err)
+			}
+		}
+		db.ApplyMiningReward(block)
+	}
+}
@@ -3,35 +3,77 @@ package database
 import (
 	"context"
 	"crypto/rand"
-	"errors"
 	"fmt"
 	"math"
 	"math/big"
 	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 )
 
 // ErrChainForked is returned from validateNextBlock if another node's chain
 // is two or more blocks ahead of ours.
-var ErrChainForked = errors.New("blockchain forked, start resync")
+var ErrChainForked = errcode.New(errcode.ChainForked, "blockchain forked, start resync")
+
+// Set of block header versions. The version decides which hash algorithm the
+// block header is hashed with.
+const (
+	BlockVersionSHA256 uint8 = 0 // Blocks produced before headers were versioned.
+	BlockVersionSHA3   uint8 = 1
+)
+
+// blockHashes maps the block header versions to their hash algorithm.
+var blockHashes = map[uint8]string{
+	BlockVersionSHA256: signature.SHA256,
+	BlockVersionSHA3:   signature.SHA3,
+}
+
+// CORE NOTE: Changing the hash algorithm changes every block hash from then
+// on, so the new version is scheduled in the genesis file to take effect at
+// a block number and every node switches at the same block. Blocks before
+// that block keep the version and hash they were produced with, so the chain
+// can still be validated from the start.
+
+// validateUpgrades checks the block header versions scheduled in the genesis
+// file are supported and only move forward.
+func validateUpgrades(upgrades []genesis.Upgrade) error {
+	var last genesis.Upgrade
+	for _, upgrade := range upgrades {
+		if _, exists := blockHashes[upgrade.Version]; !exists {
+			return fmt.Errorf("block version %d is not supported", upgrade.Version)
+		}
+
+		if upgrade.Block <= last.Block || upgrade.Version <= last.Version {
+			return fmt.Errorf("block version %d at block %d must follow version %d at block %d", upgrade.Version, upgrade.Block, last.Version, last.Block)
+		}
+		last = upgrade
+	}
+
+	return nil
+}
 
 // =============================================================================
 
 // BlockData represents what can be serialized to disk and over the network.
 type BlockData struct {
-	Hash   string      `json:"hash"`
-	Header BlockHeader `json:"block"`
-	Trans  []BlockTx   `json:"trans"`
+	Hash      string      `json:"hash"`
+	Header    BlockHeader `json:"block"`
+	Trans     []BlockTx   `json:"trans"`
+	Signature string      `json:"signature,omitempty"`
+	Votes     *Votes      `json:"votes,omitempty"`
 }
 
 // NewBlockData constructs block data from a block.
 func NewBlockData(block Block) BlockData {
 	blockData := BlockData{
-		Hash:   block.Hash(),
-		Header: block.Header,
-		Trans:  block.MerkleTree.Values(),
+		Hash:      block.Hash(),
+		Header:    block.Header,
+		Trans:     block.MerkleTree.Values(),
+		Signature: block.Signature,
+		Votes:     block.Votes,
 	}
 
 	return blockData
@@ -47,6 +89,8 @@ func ToBlock(blockData BlockData) (Block, error) {
 	block := Block{
 		Header:     blockData.Header,
 		MerkleTree: tree,
+		Signature:  blockData.Signature,
+		Votes:      blockData.Votes,
 	}
 
 	return block, nil
@@ -56,21 +100,33 @@ func ToBlock(blockData BlockData) (Block, error) {
 
 // BlockHeader represents common information required for each block.
 type BlockHeader struct {
-	Number        uint64    `json:"number"`          // Ethereum: Block number in the chain.
-	PrevBlockHash string    `json:"prev_block_hash"` // Bitcoin: Hash of the previous block in the chain.
-	TimeStamp     uint64    `json:"timestamp"`       // Bitcoin: Time the block was mined.
-	BeneficiaryID AccountID `json:"beneficiary"`     // Ethereum: The account who is receiving fees and tips.
-	Difficulty    uint16    `json:"difficulty"`      // Ethereum: Number of 0's needed to solve the hash solution.
-	MiningReward  uint64    `json:"mining_reward"`   // Ethereum: The reward for mining this block.
-	StateRoot     string    `json:"state_root"`      // Ethereum: Represents a hash of the accounts and their balances.
-	TransRoot     string    `json:"trans_root"`      // Both: Represents the merkle tree root hash for the transactions in this block.
-	Nonce         uint64    `json:"nonce"`           // Both: Value identified to solve the hash solution.
+	Number        uint64    `json:"number"`             // Ethereum: Block number in the chain.
+	PrevBlockHash string    `json:"prev_block_hash"`    // Bitcoin: Hash of the previous block in the chain.
+	TimeStamp     uint64    `json:"timestamp"`          // Bitcoin: Time the block was mined.
+	BeneficiaryID AccountID `json:"beneficiary"`        // Ethereum: The account who is receiving fees and tips.
+	Difficulty    uint16    `json:"difficulty"`         // Ethereum: Number of 0's needed to solve the hash solution.
+	MiningReward  uint64    `json:"mining_reward"`      // Ethereum: The reward for mining this block.
+	BaseFee       uint64    `json:"base_fee,omitempty"` // Ethereum: The fee per gas unit that is burned for each transaction.
+	StateRoot     string    `json:"state_root"`         // Ethereum: Represents a hash of the accounts and their balances.
+	TransRoot     string    `json:"trans_root"`         // Both: Represents the merkle tree root hash for the transactions in this block.
+	Nonce         uint64    `json:"nonce"`              // Both: Value identified to solve the hash solution.
+	Encoding      uint8     `json:"encoding,omitempty"` // Encoding the header is hashed and signed with, see signature.Versioned.
+	Version       uint8     `json:"version,omitempty"`  // Version of the header that decides the hash algorithm.
+	GasUsed       uint64    `json:"gas_used,omitempty"` // Ethereum: Total gas units used by the transactions in this block.
+}
+
+// EncodingVersion implements the signature Versioned interface so the block
+// is hashed with the encoding in effect when it was mined.
+func (h BlockHeader) EncodingVersion() uint8 {
+	return h.Encoding
 }
 
 // Block represents a group of transactions batched together.
 type Block struct {
 	Header     BlockHeader
 	MerkleTree *merkle.Tree[BlockTx]
+	Signature  string // Signature of the header by the proposer under PoS.
+	Votes      *Votes // Votes of the validators for the parent block under PoS.
 }
 
 // POWArgs represents the set of arguments required to run POW.
@@ -78,10 +134,14 @@ type POWArgs struct {
 	BeneficiaryID AccountID
 	Difficulty    uint16
 	MiningReward  uint64
+	BaseFee       uint64
 	PrevBlock     Block
 	StateRoot     string
+	Encoding      uint8
+	Version       uint8
 	Trans         []BlockTx
 	EvHandler     func(v string, args ...any)
+	HashRate      *HashRate // Optional, records how fast the block was hashed.
 }
 
 // POW constructs a new Block and performs the work to find a nonce that
@@ -110,15 +170,19 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 			BeneficiaryID: args.BeneficiaryID,
 			Difficulty:    args.Difficulty,
 			MiningReward:  args.MiningReward,
+			BaseFee:       args.BaseFee,
 			StateRoot:     args.StateRoot,
 			TransRoot:     tree.RootHex(), //
 			Nonce:         0,              // Will be identified by the POW algorithm.
+			Encoding:      args.Encoding,
+			Version:       args.Version,
+			GasUsed:       gasUsed(args.Trans),
 		},
 		MerkleTree: tree,
 	}
 
 	// Peform the proof of work mining operation.
-	if err := block.performPOW(ctx, args.EvHandler); err != nil {
+	if err := block.performPOW(ctx, args.HashRate, args.EvHandler); err != nil {
 		return Block{}, err
 	}
 
@@ -127,7 +191,8 @@ func POW(ctx context.Context, args POWArgs) (Block, error) {
 
 // performPOW does the work of mining to find a valid hash for a specified
 // block. Pointer semantics are being used since a nonce is being discovered.
-func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any)) error {
+// The attempts made are recorded in the hash rate if one is provided.
+func (b *Block) performPOW(ctx context.Context, hr *HashRate, ev func(v string, args ...any)) error {
 	ev("database: PerformPOW: MINING: started")
 	defer ev("database: PerformPOW: MINING: completed")
 
@@ -148,6 +213,13 @@ func (b *Block) performPOW(ctx context.Context, ev func(v string, args ...any))
 
 	// Loop until we or another node finds a solution for the next block.
 	var attempts uint64
+	if hr != nil {
+		start := time.Now()
+		defer func() {
+			hr.Record(attempts, time.Since(start))
+		}()
+	}
+
 	for {
 		attempts++
 		if attempts%1_000_000 == 0 {
@@ -191,77 +263,24 @@ func (b Block) Hash() string {
 	//   to follow the latest set of blocks being produced. The do not validate
 	//   blocks, but can prove a transaction is in a block.
 
-	return signature.Hash(b.Header)
-}
-
-// ValidateBlock takes a block and validates it to be included into the blockchain.
-func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler func(v string, args ...any)) error {
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: chain is not forked", b.Header.Number)
-
-	// The node who sent this block has a chain that is two or more blocks ahead
-	// of ours. This means there has been a fork and we are on the wrong side.
-	nextNumber := previousBlock.Header.Number + 1
-	if b.Header.Number >= (nextNumber + 2) {
-		return ErrChainForked
-	}
-
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: block difficulty is the same or greater than parent block difficulty", b.Header.Number)
-
-	if b.Header.Difficulty < previousBlock.Header.Difficulty {
-		return fmt.Errorf("block difficulty is less than previous block difficulty, parent %d, block %d", previousBlock.Header.Difficulty, b.Header.Difficulty)
-	}
-
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: block hash has been solved", b.Header.Number)
-
-	hash := b.Hash()
-	if !isHashSolved(b.Header.Difficulty, hash) {
-		return fmt.Errorf("%s invalid block hash", hash)
-	}
-
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: block number is the next number", b.Header.Number)
-
-	if b.Header.Number != nextNumber {
-		return fmt.Errorf("this block is not the next number, got %d, exp %d", b.Header.Number, nextNumber)
-	}
-
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: parent hash does match parent block", b.Header.Number)
-
-	if b.Header.PrevBlockHash != previousBlock.Hash() {
-		return fmt.Errorf("parent block hash doesn't match our known parent, got %s, exp %s", b.Header.PrevBlockHash, previousBlock.Hash())
-	}
-
-	if previousBlock.Header.TimeStamp > 0 {
-		evHandler("database: ValidateBlock: validate: blk[%d]: check: block's timestamp is greater than parent block's timestamp", b.Header.Number)
-
-		parentTime := time.Unix(int64(previousBlock.Header.TimeStamp), 0)
-		blockTime := time.Unix(int64(b.Header.TimeStamp), 0)
-		if blockTime.Before(parentTime) {
-			return fmt.Errorf("block timestamp is before parent block, parent %s, block %s", parentTime, blockTime)
-		}
-
-		// This is a check that Ethereum does but we can't because we don't run all the time.
-
-		// evHandler("database: ValidateBlock: validate: blk[%d]: check: block is less than 15 minutes apart from parent block", b.Header.Number)
-
-		// dur := blockTime.Sub(parentTime)
-		// if dur.Seconds() > time.Duration(15*time.Second).Seconds() {
-		// 	return fmt.Errorf("block is older than 15 minutes, duration %v", dur)
-		// }
-	}
-
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: state root hash does match current database", b.Header.Number)
-
-	if b.Header.StateRoot != stateRoot {
-		return fmt.Errorf("state of the accounts are wrong, current %s, expected %s", stateRoot, b.Header.StateRoot)
+	algorithm, exists := blockHashes[b.Header.Version]
+	if !exists {
+		return signature.ZeroHash
 	}
 
-	evHandler("database: ValidateBlock: validate: blk[%d]: check: merkle root does match transactions", b.Header.Number)
+	return signature.HashWith(b.Header, algorithm)
+}
 
-	if b.Header.TransRoot != b.MerkleTree.RootHex() {
-		return fmt.Errorf("merkle root does not match transactions, got %s, exp %s", b.MerkleTree.RootHex(), b.Header.TransRoot)
-	}
+// ValidateBlock takes a block and validates it to be included into the
+// blockchain with the header rules.
+func (b Block) ValidateBlock(previousBlock Block, stateRoot string, evHandler func(v string, args ...any)) error {
+	return NewPipeline(HeaderRules()...).Validate(BlockCheck{Block: b, Parent: previousBlock, StateRoot: stateRoot}, evHandler)
+}
 
-	return nil
+// IsSolved reports if the block hash solves the POW puzzle at the difficulty
+// in the block header.
+func (b Block) IsSolved() bool {
+	return isHashSolved(b.Header.Difficulty, b.Hash())
 }
 
 // isHashSolved checks the hash to make sure it complies with
@@ -276,3 +295,13 @@ func isHashSolved(difficulty uint16, hash string) bool {
 	difficulty += 2
 	return hash[:difficulty] == match[:difficulty]
 }
+
+// gasUsed returns the total gas units used by the transactions.
+func gasUsed(trans []BlockTx) uint64 {
+	var units uint64
+	for _, tx := range trans {
+		units += tx.GasUnits
+	}
+
+	return units
+}
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Set of bonding operations that can be carried in the transaction data.
+const (
+	BondLock     = "lock"
+	BondUnlock   = "unlock"
+	BondWithdraw = "withdraw"
+	BondEvidence = "evidence"
+)
+
+// BondOp represents a bonding operation carried in the transaction data. A
+// lock operation moves the transaction value into the sender's bond instead
+// of the to account. An unlock operation starts releasing the amount from the
+// bond, which can be withdrawn once the unbonding period passes. An evidence
+// operation can be submitted by anyone to slash a validator. A lock operation
+// can register the BLS key the validator votes for blocks with, along with a
+// proof the validator holds the private key.
+type BondOp struct {
+	Op       string    `json:"bond"`
+	Amount   uint64    `json:"amount,omitempty"`
+	Evidence *Evidence `json:"evidence,omitempty"`
+	BLSKey   []byte    `json:"bls_key,omitempty"`
+	BLSProof []byte    `json:"bls_proof,omitempty"`
+}
+
+// Data returns the encoded operation for use as transaction data.
+func (op BondOp) Data() ([]byte, error) {
+	return json.Marshal(op)
+}
+
+// ParseBondOp checks the transaction data for a bonding operation.
+func ParseBondOp(data []byte) (BondOp, bool) {
+	if len(data) == 0 || data[0] != '{' {
+		return BondOp{}, false
+	}
+
+	var op BondOp
+	if err := json.Unmarshal(data, &op); err != nil {
+		return BondOp{}, false
+	}
+
+	switch op.Op {
+	case BondLock, BondUnlock, BondWithdraw, BondEvidence:
+		return op, true
+	}
+
+	return BondOp{}, false
+}
+
+// =============================================================================
+
+// SignedHeader is a block header signed by the validator who produced it.
+type SignedHeader struct {
+	Header BlockHeader `json:"header"`
+	V      *big.Int    `json:"v"`
+	R      *big.Int    `json:"r"`
+	S      *big.Int    `json:"s"`
+}
+
+// Sign uses the specified private key to sign the block header for the chain.
+func (h BlockHeader) Sign(chainID uint16, privateKey *ecdsa.PrivateKey) (SignedHeader, error) {
+	v, r, s, err := signature.SignForChain(h, chainID, privateKey)
+	if err != nil {
+		return SignedHeader{}, err
+	}
+
+	signedHeader := SignedHeader{
+		Header: h,
+		V:      v,
+		R:      r,
+		S:      s,
+	}
+
+	return signedHeader, nil
+}
+
+// Signer returns the account that signed the header for the specified chain.
+func (sh SignedHeader) Signer(chainID uint16) (AccountID, error) {
+	if sh.V == nil || sh.R == nil || sh.S == nil {
+		return "", errors.New("header is not signed")
+	}
+
+	if sigChainID, bound := signature.ChainID(sh.V); !bound || sigChainID != chainID {
+		return "", fmt.Errorf("header signature is not bound to chain id %d", chainID)
+	}
+
+	if err := signature.VerifySignature(sh.V, sh.R, sh.S); err != nil {
+		return "", err
+	}
+
+	address, err := signature.FromAddress(sh.Header, sh.V, sh.R, sh.S)
+	if err != nil {
+		return "", err
+	}
+
+	return AccountID(address), nil
+}
+
+// Evidence represents two different block headers for the same block number
+// signed by the same validator, which proves the validator equivocated.
+type Evidence struct {
+	First  SignedHeader `json:"first"`
+	Second SignedHeader `json:"second"`
+}
+
+// Offender validates the evidence and returns the validator who signed both
+// block headers.
+func (e Evidence) Offender(chainID uint16) (AccountID, error) {
+	if e.First.Header.Number != e.Second.Header.Number {
+		return "", errors.New("evidence headers are not for the same block number")
+	}
+
+	if signature.Hash(e.First.Header) == signature.Hash(e.Second.Header) {
+		return "", errors.New("evidence headers are the same block")
+	}
+
+	first, err := e.First.Signer(chainID)
+	if err != nil {
+		return "", fmt.Errorf("first: %w", err)
+	}
+
+	second, err := e.Second.Signer(chainID)
+	if err != nil {
+		return "", fmt.Errorf("second: %w", err)
+	}
+
+	if first != second {
+		return "", errors.New("evidence headers are signed by different accounts")
+	}
+
+	if first != e.First.Header.BeneficiaryID || first != e.Second.Header.BeneficiaryID {
+		return "", errors.New("evidence headers are not signed by the beneficiary")
+	}
+
+	return first, nil
+}
+
+// =============================================================================
+
+// validateBond checks the bonding operation can be applied by the sender of
+// the transaction. The caller must hold the lock.
+func (db *Database) validateBond(block Block, tx BlockTx, op BondOp) error {
+	if op.Op != BondLock && tx.Value != 0 {
+		return fmt.Errorf("transaction invalid, bond %s can't carry a value", op.Op)
+	}
+
+	if op.Op != BondLock && (op.BLSKey != nil || op.BLSProof != nil) {
+		return fmt.Errorf("transaction invalid, bond %s can't register a bls key", op.Op)
+	}
+
+	from := db.accounts.get(tx.FromID)
+
+	switch op.Op {
+	case BondLock:
+		if tx.Value == 0 {
+			return errors.New("transaction invalid, bond requires a value")
+		}
+
+		if op.BLSKey != nil || op.BLSProof != nil {
+			if err := signature.VerifyBLSPossession(op.BLSKey, op.BLSProof); err != nil {
+				return fmt.Errorf("transaction invalid, %w", err)
+			}
+		}
+
+	case BondUnlock:
+		if op.Amount == 0 || op.Amount > from.Bonded {
+			return fmt.Errorf("transaction invalid, unlock amount %d, bonded %d", op.Amount, from.Bonded)
+		}
+
+	case BondWithdraw:
+		if from.Unbonding == 0 {
+			return errors.New("transaction invalid, nothing to withdraw")
+		}
+
+		if block.Header.Number < from.UnbondAt {
+			return fmt.Errorf("transaction invalid, unbonding until block %d", from.UnbondAt)
+		}
+
+	case BondEvidence:
+		if op.Evidence == nil {
+			return errors.New("transaction invalid, evidence is missing")
+		}
+
+		offender, err := op.Evidence.Offender(db.genesis.ChainID)
+		if err != nil {
+			return fmt.Errorf("transaction invalid, %w", err)
+		}
+
+		if account := db.accounts.get(offender); account.Bonded+account.Unbonding == 0 {
+			return fmt.Errorf("transaction invalid, %s has no bond to slash", offender)
+		}
+	}
+
+	return nil
+}
+
+// applyBond moves the funds for a validated bonding operation. Slashed stake
+// is burned and removed from the supply. The caller must hold the lock.
+func (db *Database) applyBond(block Block, tx BlockTx, op BondOp) {
+	from := db.accounts.get(tx.FromID)
+
+	switch op.Op {
+	case BondLock:
+		from.Balance -= tx.Value
+		from.Bonded += tx.Value
+		if op.BLSKey != nil {
+			from.BLSKey = hexutil.Encode(op.BLSKey)
+		}
+
+	case BondUnlock:
+		from.Bonded -= op.Amount
+		from.Unbonding += op.Amount
+		from.UnbondAt = block.Header.Number + db.genesis.UnbondingPeriod
+
+	case BondWithdraw:
+		from.Balance += from.Unbonding
+		from.Unbonding = 0
+		from.UnbondAt = 0
+
+	case BondEvidence:
+		offenderID, _ := op.Evidence.Offender(db.genesis.ChainID)
+
+		offender := db.accounts.get(offenderID)
+		db.supply -= offender.Bonded + offender.Unbonding
+		offender.Bonded = 0
+		offender.Unbonding = 0
+		offender.UnbondAt = 0
+		db.accounts.set(offenderID, offender)
+
+		// The offender could be the sender of the evidence.
+		if offenderID == tx.FromID {
+			return
+		}
+	}
+
+	db.accounts.set(tx.FromID, from)
+}
+
+// Bonded returns the stake locked by each validator.
+func (db *Database) Bonded() map[AccountID]uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.bonded()
+}
+
+// bonded returns the stake locked by each validator. The caller must hold
+// the lock.
+func (db *Database) bonded() map[AccountID]uint64 {
+	bonded := make(map[AccountID]uint64)
+	db.accounts.forEach(func(account Account) {
+		if account.Bonded > 0 {
+			bonded[account.AccountID] = account.Bonded
+		}
+	})
+
+	return bonded
+}
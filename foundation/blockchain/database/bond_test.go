@@ -0,0 +1,111 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func Test_Bond(t *testing.T) {
+	const (
+		validator = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		reporter  = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		miner     = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+	)
+
+	gen := genesis.Genesis{
+		ChainID:         1,
+		UnbondingPeriod: 10,
+		Balances:        map[string]uint64{validator: 1000, reporter: 1000},
+	}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	nonces := make(map[database.AccountID]uint64)
+
+	// apply submits the bonding operation from the account into the
+	// specified block. The signature isn't checked when applying.
+	apply := func(from database.AccountID, blockNum uint64, value uint64, op database.BondOp) error {
+		data, err := op.Data()
+		if err != nil {
+			t.Fatalf("Should be able to encode the bond operation: %v", err)
+		}
+
+		blockTx, err := sign(database.Tx{ChainID: 1, Nonce: nonces[from] + 1, FromID: from, ToID: miner, Value: value, Data: data}, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block := database.Block{Header: database.BlockHeader{Number: blockNum, BeneficiaryID: miner}}
+		if err := db.ApplyTransaction(block, blockTx); err != nil {
+			return err
+		}
+		nonces[from]++
+
+		return nil
+	}
+
+	if err := apply(validator, 1, 500, database.BondOp{Op: database.BondLock}); err != nil {
+		t.Fatalf("Should be able to lock a bond: %v", err)
+	}
+
+	if err := apply(validator, 2, 0, database.BondOp{Op: database.BondUnlock, Amount: 200}); err != nil {
+		t.Fatalf("Should be able to unlock part of the bond: %v", err)
+	}
+
+	if err := apply(validator, 5, 0, database.BondOp{Op: database.BondWithdraw}); err == nil {
+		t.Fatalf("Should not be able to withdraw during the unbonding period.")
+	}
+
+	account, _ := db.Query(validator)
+	if account.Balance != 500 || account.Bonded != 300 || account.Unbonding != 200 || account.UnbondAt != 12 {
+		t.Fatalf("Should have the stake bonded and unbonding: %+v", account)
+	}
+
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to load the validator key: %v", err)
+	}
+
+	header := database.BlockHeader{Number: 7, BeneficiaryID: validator}
+	first, err := header.Sign(1, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the header: %v", err)
+	}
+
+	header.Nonce++
+	second, err := header.Sign(1, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the header: %v", err)
+	}
+
+	if err := apply(reporter, 8, 0, database.BondOp{Op: database.BondEvidence, Evidence: &database.Evidence{First: first, Second: first}}); err == nil {
+		t.Fatalf("Should not accept the same header twice as evidence.")
+	}
+
+	supply := db.TotalSupply()
+
+	if err := apply(reporter, 8, 0, database.BondOp{Op: database.BondEvidence, Evidence: &database.Evidence{First: first, Second: second}}); err != nil {
+		t.Fatalf("Should be able to submit the evidence: %v", err)
+	}
+
+	account, _ = db.Query(validator)
+	if account.Balance != 500 || account.Bonded != 0 || account.Unbonding != 0 {
+		t.Fatalf("Should have slashed the bond: %+v", account)
+	}
+
+	if exp := supply - 500; db.TotalSupply() != exp {
+		t.Logf("got: %d", db.TotalSupply())
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should have burned the slashed stake.")
+	}
+
+	if err := apply(reporter, 9, 0, database.BondOp{Op: database.BondEvidence, Evidence: &database.Evidence{First: first, Second: second}}); err == nil {
+		t.Fatalf("Should not slash the same validator twice.")
+	}
+}
@@ -0,0 +1,106 @@
+package database
+
+import (
+	"container/list"
+	"sync"
+)
+
+// CacheStats represents the current statistics for the block cache.
+type CacheStats struct {
+	Size   int   `json:"size"`
+	Cap    int   `json:"cap"`
+	Hits   int64 `json:"hits"`
+	Misses int64 `json:"misses"`
+}
+
+// =============================================================================
+
+// blockCache is a least recently used cache of blocks by number that fronts
+// the storage so hot queries don't need to read from storage.
+type blockCache struct {
+	mu     sync.Mutex
+	cap    int
+	list   *list.List
+	items  map[uint64]*list.Element
+	hits   int64
+	misses int64
+}
+
+// newBlockCache constructs a block cache that can hold cap blocks. A cap
+// of zero or less disables the cache.
+func newBlockCache(cap int) *blockCache {
+	return &blockCache{
+		cap:   cap,
+		list:  list.New(),
+		items: make(map[uint64]*list.Element),
+	}
+}
+
+// get returns the block for the specified number if it's in the cache.
+func (bc *blockCache) get(num uint64) (Block, bool) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	elem, exists := bc.items[num]
+	if !exists {
+		bc.misses++
+		return Block{}, false
+	}
+
+	bc.hits++
+	bc.list.MoveToFront(elem)
+
+	return elem.Value.(Block), true
+}
+
+// add places the block in the cache, removing the least recently used
+// block if the cache is full.
+func (bc *blockCache) add(block Block) {
+	if bc.cap <= 0 {
+		return
+	}
+
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	num := block.Header.Number
+	if elem, exists := bc.items[num]; exists {
+		elem.Value = block
+		bc.list.MoveToFront(elem)
+		return
+	}
+
+	bc.items[num] = bc.list.PushFront(block)
+
+	if bc.list.Len() > bc.cap {
+		elem := bc.list.Back()
+		bc.list.Remove(elem)
+		delete(bc.items, elem.Value.(Block).Header.Number)
+	}
+}
+
+// removeAfter removes all the blocks after the specified block number.
+func (bc *blockCache) removeAfter(num uint64) {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	for blockNum, elem := range bc.items {
+		if blockNum > num {
+			bc.list.Remove(elem)
+			delete(bc.items, blockNum)
+		}
+	}
+}
+
+// stats returns the current statistics for the cache.
+func (bc *blockCache) stats() CacheStats {
+	bc.mu.Lock()
+	defer bc.mu.Unlock()
+
+	return CacheStats{
+		Size:   bc.list.Len(),
+		Cap:    bc.cap,
+		Hits:   bc.hits,
+		Misses: bc.misses,
+	}
+}
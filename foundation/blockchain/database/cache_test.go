@@ -0,0 +1,57 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_BlockCache(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.NewWithCache(genesis.Genesis{}, storage, 2, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Write directly to storage so the cache starts out empty.
+	for i := uint64(1); i <= 3; i++ {
+		blockTx, err := sign(database.Tx{ChainID: 1, Nonce: i}, 1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		blockData := database.BlockData{
+			Header: database.BlockHeader{Number: i},
+			Trans:  []database.BlockTx{blockTx},
+		}
+		if err := storage.Write(blockData); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	for _, num := range []uint64{1, 2, 3, 3, 2, 1} {
+		if _, err := db.GetBlock(num); err != nil {
+			t.Fatalf("Should be able to get block %d: %v", num, err)
+		}
+	}
+
+	stats := db.CacheStats()
+	if stats.Size != 2 || stats.Cap != 2 {
+		t.Fatalf("Should have a full cache of 2 blocks: %+v", stats)
+	}
+
+	// Blocks 3 and 2 are hits, block 1 was evicted when block 3 was added.
+	if stats.Hits != 2 || stats.Misses != 4 {
+		t.Logf("got: hits[%d] misses[%d]", stats.Hits, stats.Misses)
+		t.Logf("exp: hits[%d] misses[%d]", 2, 4)
+		t.Fatalf("Should have the correct hits and misses.")
+	}
+}
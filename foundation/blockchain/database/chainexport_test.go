@@ -0,0 +1,85 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ExportCSV(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	export := func(table string, from uint64, to uint64) [][]string {
+		var buf bytes.Buffer
+		if err := db.ExportCSV(context.Background(), &buf, table, from, to); err != nil {
+			t.Fatalf("Should be able to export the %s from %d to %d: %v", table, from, to, err)
+		}
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatalf("Should be able to read the exported %s: %v", table, err)
+		}
+
+		return records
+	}
+
+	blocks := export(database.ExportBlocks, 2, 3)
+	columns, _ := database.ExportColumns(database.ExportBlocks)
+	if len(blocks) != 3 || blocks[0][0] != columns[0] || blocks[1][0] != "2" || blocks[2][1] != db.LatestBlock().Hash() {
+		t.Logf("got: %v", blocks)
+		t.Fatalf("Should export a header row and a row for each block in the range.")
+	}
+
+	txs := export(database.ExportTransactions, 1, 3)
+	if len(txs) != 4 || txs[1][0] != "1" || txs[3][6] != "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4" || txs[3][8] != "10" {
+		t.Logf("got: %v", txs)
+		t.Fatalf("Should export a row for each transaction with its block.")
+	}
+
+	// Reading straight from the storage exports the same rows.
+	var buf bytes.Buffer
+	if err := database.ExportStorageCSV(context.Background(), &buf, storage, database.ExportTransactions, 1, 3); err != nil {
+		t.Fatalf("Should be able to export the transactions from storage: %v", err)
+	}
+
+	if records, _ := csv.NewReader(&buf).ReadAll(); len(records) != len(txs) || records[2][3] != txs[2][3] {
+		t.Logf("got: %v", records)
+		t.Logf("exp: %v", txs)
+		t.Fatalf("Should export the same rows from storage.")
+	}
+
+	if err := db.ExportCSV(context.Background(), &bytes.Buffer{}, database.ExportBlocks, 1, 4); !errcode.Is(err, errcode.NotFound) {
+		t.Fatalf("Should not export a block that doesn't exist: %v", err)
+	}
+
+	if err := db.ExportCSV(context.Background(), &bytes.Buffer{}, "accounts", 1, 3); err == nil {
+		t.Fatalf("Should not export an unknown table.")
+	}
+}
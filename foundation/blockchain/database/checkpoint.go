@@ -0,0 +1,75 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+// Checkpoint represents a block a trusted signer vouches is part of the
+// chain. The timestamp is when the checkpoint was signed.
+type Checkpoint struct {
+	Number    uint64 `json:"number"`
+	Hash      string `json:"hash"`
+	TimeStamp uint64 `json:"timestamp"`
+}
+
+// NewCheckpoint constructs a checkpoint for the block.
+func NewCheckpoint(block Block, timeStamp uint64) Checkpoint {
+	return Checkpoint{
+		Number:    block.Header.Number,
+		Hash:      block.Hash(),
+		TimeStamp: timeStamp,
+	}
+}
+
+// SignedCheckpoint is a checkpoint signed by the account vouching for it.
+type SignedCheckpoint struct {
+	Checkpoint
+	V *big.Int `json:"v"`
+	R *big.Int `json:"r"`
+	S *big.Int `json:"s"`
+}
+
+// Sign uses the specified private key to sign the checkpoint for the chain.
+func (c Checkpoint) Sign(chainID uint16, privateKey *ecdsa.PrivateKey) (SignedCheckpoint, error) {
+	v, r, s, err := signature.SignForChain(c, chainID, privateKey)
+	if err != nil {
+		return SignedCheckpoint{}, err
+	}
+
+	signedCheckpoint := SignedCheckpoint{
+		Checkpoint: c,
+		V:          v,
+		R:          r,
+		S:          s,
+	}
+
+	return signedCheckpoint, nil
+}
+
+// Signer returns the account that signed the checkpoint for the specified
+// chain.
+func (sc SignedCheckpoint) Signer(chainID uint16) (AccountID, error) {
+	if sc.V == nil || sc.R == nil || sc.S == nil {
+		return "", errors.New("checkpoint is not signed")
+	}
+
+	if sigChainID, bound := signature.ChainID(sc.V); !bound || sigChainID != chainID {
+		return "", fmt.Errorf("checkpoint signature is not bound to chain id %d", chainID)
+	}
+
+	if err := signature.VerifySignature(sc.V, sc.R, sc.S); err != nil {
+		return "", err
+	}
+
+	address, err := signature.FromAddress(sc.Checkpoint, sc.V, sc.R, sc.S)
+	if err != nil {
+		return "", err
+	}
+
+	return AccountID(address), nil
+}
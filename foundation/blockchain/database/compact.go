@@ -0,0 +1,103 @@
+package database
+
+import (
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
+)
+
+// CORE NOTE: A peer has usually seen most of the transactions in a new block
+// already since they were shared when they were submitted. Relaying the block
+// header with the transaction hashes lets the peer rebuild the block from its
+// mempool and only the transactions it's missing need to be sent. Bitcoin
+// does the same thing with compact blocks (BIP 152).
+
+// CompactBlock represents a block sent to a peer with the hashes of its
+// transactions in place of the transactions themselves. Trans holds the
+// transactions the peer asked for because they aren't in its mempool.
+type CompactBlock struct {
+	Hash      string      `json:"hash"`
+	Header    BlockHeader `json:"block"`
+	TxHashes  []string    `json:"tx_hashes"`
+	Signature string      `json:"signature,omitempty"`
+	Votes     *Votes      `json:"votes,omitempty"`
+	Trans     []BlockTx   `json:"trans,omitempty"`
+}
+
+// NewCompactBlock constructs a compact block from a block.
+func NewCompactBlock(block Block) CompactBlock {
+	values := block.MerkleTree.Values()
+
+	hashes := make([]string, len(values))
+	for i, tx := range values {
+		hashes[i] = tx.TxHash()
+	}
+
+	return CompactBlock{
+		Hash:      block.Hash(),
+		Header:    block.Header,
+		TxHashes:  hashes,
+		Signature: block.Signature,
+		Votes:     block.Votes,
+	}
+}
+
+// Missing returns the hashes of the transactions that can't be found in the
+// compact block or with the lookup function.
+func (cb CompactBlock) Missing(lookup func(hash string) (BlockTx, bool)) []string {
+	included := cb.included()
+
+	var missing []string
+	for _, hash := range cb.TxHashes {
+		if _, exists := included[hash]; exists {
+			continue
+		}
+		if _, exists := lookup(hash); !exists {
+			missing = append(missing, hash)
+		}
+	}
+
+	return missing
+}
+
+// ToBlock rebuilds the block using the transactions in the compact block and
+// the lookup function for the rest. An error is returned if a transaction
+// can't be found, use Missing to know which ones to ask for.
+func (cb CompactBlock) ToBlock(lookup func(hash string) (BlockTx, bool)) (Block, error) {
+	included := cb.included()
+
+	trans := make([]BlockTx, len(cb.TxHashes))
+	for i, hash := range cb.TxHashes {
+		tx, exists := included[hash]
+		if !exists {
+			if tx, exists = lookup(hash); !exists {
+				return Block{}, fmt.Errorf("transaction %s is missing", hash)
+			}
+		}
+		trans[i] = tx
+	}
+
+	tree, err := merkle.NewTree(trans)
+	if err != nil {
+		return Block{}, err
+	}
+
+	block := Block{
+		Header:     cb.Header,
+		MerkleTree: tree,
+		Signature:  cb.Signature,
+		Votes:      cb.Votes,
+	}
+
+	return block, nil
+}
+
+// included returns the transactions sent with the compact block by hash.
+func (cb CompactBlock) included() map[string]BlockTx {
+	included := make(map[string]BlockTx, len(cb.Trans))
+	for _, tx := range cb.Trans {
+		included[tx.TxHash()] = tx
+	}
+
+	return included
+}
@@ -0,0 +1,70 @@
+package database_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+func Test_CompactBlock(t *testing.T) {
+	var trans []database.BlockTx
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{ChainID: 1, Nonce: nonce, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100}
+		blockTx, err := sign(tx, 15)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		trans = append(trans, blockTx)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    1,
+		MiningReward:  700,
+		Trans:         trans,
+		EvHandler:     func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	cb := database.NewCompactBlock(block)
+
+	// The mempool of the peer only has the first transaction.
+	lookup := func(hash string) (database.BlockTx, bool) {
+		if hash == trans[0].TxHash() {
+			return trans[0], true
+		}
+		return database.BlockTx{}, false
+	}
+
+	missing := cb.Missing(lookup)
+	exp := []string{trans[1].TxHash(), trans[2].TxHash()}
+	if fmt.Sprint(missing) != fmt.Sprint(exp) {
+		t.Logf("got: %v", missing)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should report the transactions the peer doesn't have.")
+	}
+
+	if _, err := cb.ToBlock(lookup); err == nil {
+		t.Fatalf("Should not rebuild the block with transactions missing.")
+	}
+
+	cb.Trans = []database.BlockTx{trans[1], trans[2]}
+	if missing := cb.Missing(lookup); len(missing) != 0 {
+		t.Fatalf("Should not be missing transactions once they are included, got %v.", missing)
+	}
+
+	got, err := cb.ToBlock(lookup)
+	if err != nil {
+		t.Fatalf("Should be able to rebuild the block: %v", err)
+	}
+
+	if got.Hash() != block.Hash() || got.MerkleTree.RootHex() != block.Header.TransRoot {
+		t.Logf("got: %s %s", got.Hash(), got.MerkleTree.RootHex())
+		t.Logf("exp: %s %s", block.Hash(), block.Header.TransRoot)
+		t.Fatalf("Should rebuild the same block.")
+	}
+}
@@ -3,15 +3,24 @@
 package database
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"sort"
 	"sync"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 )
 
+// Set of errors returned when a transaction can't be applied to the accounts.
+var (
+	ErrWrongNonce        = errcode.New(errcode.BadNonce, "wrong nonce")
+	ErrInsufficientFunds = errcode.New(errcode.InsufficientFunds, "insufficient funds")
+)
+
 // Storage interface represents the behavior required to be implemented by any
 // package providing support for reading and writing the blockchain.
 type Storage interface {
@@ -22,6 +31,12 @@ type Storage interface {
 	Reset() error
 }
 
+// WriteChecker interface represents the behavior required to be implemented
+// by any storage package that can check blocks can still be written.
+type WriteChecker interface {
+	CheckWritable() error
+}
+
 // Iterator interface represents the behavior required to be implemented by any
 // package providing support to iterate over the blocks.
 type Iterator interface {
@@ -29,6 +44,42 @@ type Iterator interface {
 	Done() bool
 }
 
+// IteratorCtx constructs an iterator that stops walking the blocks once the
+// specified context is cancelled. The call to Next after the cancellation
+// returns the context error and the following call ends the iteration.
+func IteratorCtx(ctx context.Context, iter Iterator) Iterator {
+	return &ctxIterator{ctx: ctx, iterator: iter}
+}
+
+// ctxIterator wraps a storage iterator to support cancellation.
+type ctxIterator struct {
+	ctx      context.Context
+	iterator Iterator
+	canceled bool
+	done     bool
+}
+
+// Next retrieves the next block unless the context has been cancelled.
+func (ci *ctxIterator) Next() (BlockData, error) {
+	if ci.canceled {
+		ci.done = true
+		return BlockData{}, errors.New("end of chain")
+	}
+
+	if err := ci.ctx.Err(); err != nil {
+		ci.canceled = true
+		return BlockData{}, err
+	}
+
+	return ci.iterator.Next()
+}
+
+// Done returns the end of chain value or if the iteration was ended after
+// the context was cancelled.
+func (ci *ctxIterator) Done() bool {
+	return ci.done || ci.iterator.Done()
+}
+
 // =============================================================================
 
 // Database manages data related to accounts who have transacted on the blockchain.
@@ -36,26 +87,49 @@ type Database struct {
 	mu          sync.RWMutex
 	genesis     genesis.Genesis
 	latestBlock Block
-	accounts    map[AccountID]Account
+	accounts    accountSet
 	storage     Storage
+	cache       *blockCache
+	stats       *chainStats
+	supply      uint64
+	gov         *governance
+	undo        []undoRecord // State before each of the most recent committed blocks.
+	pipeline    *Pipeline    // Rules the blocks added to the chain are validated with.
 }
 
 // New constructs a new database and applies account genesis information and
 // reads/writes the blockchain database on disk if a dbPath is provided.
 func New(genesis genesis.Genesis, storage Storage, evHandler func(v string, args ...any)) (*Database, error) {
-	db := Database{
-		genesis:  genesis,
-		accounts: make(map[AccountID]Account),
-		storage:  storage,
+	return NewWithCache(genesis, storage, 0, evHandler)
+}
+
+// NewWithCache constructs a new database like New with a cache of the most
+// recently used blocks fronting the storage. A cacheSize of zero or less
+// disables the cache.
+func NewWithCache(genesis genesis.Genesis, storage Storage, cacheSize int, evHandler func(v string, args ...any)) (*Database, error) {
+	if err := validateUpgrades(genesis.Upgrades); err != nil {
+		return nil, err
+	}
+
+	if err := genesis.ValidateForks(); err != nil {
+		return nil, err
 	}
 
 	// Update the database with account balance information from genesis.
-	for accountStr, balance := range genesis.Balances {
-		accountID, err := ToAccountID(accountStr)
-		if err != nil {
-			return nil, err
-		}
-		db.accounts[accountID] = newAccount(accountID, balance)
+	accounts, err := genesisAccounts(genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	db := Database{
+		genesis:  genesis,
+		accounts: newAccountSet(accounts),
+		storage:  storage,
+		cache:    newBlockCache(cacheSize),
+		stats:    newChainStats(),
+		supply:   genesis.GenesisSupply(),
+		gov:      newGovernance(),
+		pipeline: newBlockPipeline(),
 	}
 
 	// Read all the blocks from storage.
@@ -65,8 +139,8 @@ func New(genesis genesis.Genesis, storage Storage, evHandler func(v string, args
 			return nil, err
 		}
 
-		// Validate the block values and cryptographic audit trail.
-		if err := block.ValidateBlock(db.latestBlock, db.HashState(), evHandler); err != nil {
+		// Validate the block values, monetary policy and cryptographic audit trail.
+		if err := db.ValidateBlock(block, evHandler); err != nil {
 			return nil, err
 		}
 
@@ -76,8 +150,9 @@ func New(genesis genesis.Genesis, storage Storage, evHandler func(v string, args
 		}
 		db.ApplyMiningReward(block)
 
-		// Update the current latest block.
+		// Update the current latest block and the chain statistics.
 		db.latestBlock = block
+		db.stats.apply(block)
 	}
 
 	return &db, nil
@@ -94,19 +169,21 @@ func (db *Database) Reset() error {
 	defer db.mu.Unlock()
 
 	db.storage.Reset()
+	db.cache.removeAfter(0)
 
 	// Initializes the database back to the genesis information.
-	db.latestBlock = Block{}
-	db.accounts = make(map[AccountID]Account)
-	for accountStr, balance := range db.genesis.Balances {
-		accountID, err := ToAccountID(accountStr)
-		if err != nil {
-			return err
-		}
-
-		db.accounts[accountID] = newAccount(accountID, balance)
+	accounts, err := genesisAccounts(db.genesis)
+	if err != nil {
+		return err
 	}
 
+	db.latestBlock = Block{}
+	db.accounts.replace(newAccountSet(accounts))
+	db.stats = newChainStats()
+	db.supply = db.genesis.GenesisSupply()
+	db.gov = newGovernance()
+	db.undo = nil
+
 	return nil
 }
 
@@ -115,15 +192,14 @@ func (db *Database) Remove(accountID AccountID) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	delete(db.accounts, accountID)
+	db.undo = nil
+	db.accounts.remove(accountID)
 }
 
-// Query retrieves an account from the database.
+// Query retrieves an account from the database. Only the shard holding the
+// account is locked so queries don't wait for blocks being applied.
 func (db *Database) Query(accountID AccountID) (Account, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	acount, exists := db.accounts[accountID]
+	acount, exists := db.accounts.lookup(accountID)
 	if !exists {
 		return Account{}, errors.New("account does not exist")
 	}
@@ -131,117 +207,369 @@ func (db *Database) Query(accountID AccountID) (Account, error) {
 	return acount, nil
 }
 
-// Copy makes a copy of the current accounts in the database.
-func (db *Database) Copy() map[AccountID]Account {
+// Snapshot returns a read-only view of the current accounts in the database.
+// The accounts aren't copied until the database changes after the snapshot
+// is taken, so snapshots are cheap to take.
+func (db *Database) Snapshot() AccountSnapshot {
 	db.mu.RLock()
 	defer db.mu.RUnlock()
 
-	accounts := make(map[AccountID]Account)
-	for accountID, account := range db.accounts {
-		accounts[accountID] = account
-	}
-	return accounts
+	return db.accounts.snapshot()
 }
 
-// HashState returns a hash based on the contents of the accounts and
-// their balances. This is added to each block and checked by peers.
+// HashState returns the merkle root of the accounts and their balances.
+// This is added to each block and checked by peers. The merkle root allows
+// a proof of an individual account to be checked against a block.
 func (db *Database) HashState() string {
-	accounts := make([]Account, 0, len(db.accounts))
-	db.mu.RLock()
-	{
-		for _, account := range db.accounts {
-			accounts = append(accounts, account)
-		}
+	return stateRoot(db.sortedAccounts())
+}
+
+// HashStateFor returns the state root in the same form the specified block
+// was produced with so the block can be validated.
+//
+// CORE NOTE: Blocks produced before the state root became a merkle root
+// carry a hash of the entire set of accounts. Both forms commit to the exact
+// same state so either is accepted, but only a merkle root can be used to
+// generate account proofs.
+func (db *Database) HashStateFor(block Block) string {
+	stateRoot := db.HashState()
+	if block.Header.StateRoot == stateRoot {
+		return stateRoot
+	}
+
+	if legacy := signature.Hash(db.sortedAccounts()); block.Header.StateRoot == legacy {
+		return legacy
+	}
+
+	return stateRoot
+}
+
+// stateRoot returns the merkle root of the accounts, which must be sorted by
+// account id.
+func stateRoot(accounts []Account) string {
+	tree, err := merkle.NewTree(accounts)
+	if err != nil {
+		return signature.Hash(accounts)
 	}
-	db.mu.RUnlock()
+
+	return tree.RootHex()
+}
+
+// sortedAccounts returns a copy of the accounts sorted by account id.
+func (db *Database) sortedAccounts() []Account {
+	snapshot := db.Snapshot()
+
+	accounts := make([]Account, 0, snapshot.Len())
+	snapshot.ForEach(func(account Account) {
+		accounts = append(accounts, account)
+	})
 
 	sort.Sort(byAccount(accounts))
-	return signature.Hash(accounts)
+	return accounts
 }
 
-// ApplyMiningReward gives the specififed account the mining reward.
+// ApplyMiningReward gives the specififed account the mining reward. The
+// reward is limited to what the monetary policy allows and can't be spent
+// until it matures when the chain has a reward maturity.
 func (db *Database) ApplyMiningReward(block Block) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
-	account := db.accounts[block.Header.BeneficiaryID]
-	account.Balance += block.Header.MiningReward
+	reward := block.Header.MiningReward
+	if allowed := db.genesisAt(block.Header.Number).MiningRewardAt(block.Header.Number, db.supply); reward > allowed {
+		reward = allowed
+	}
+
+	// Changes made outside of a delta can't be rolled back.
+	db.undo = nil
 
-	db.accounts[block.Header.BeneficiaryID] = account
+	account := db.accounts.get(block.Header.BeneficiaryID)
+	account.Balance += reward
+
+	if maturity := db.genesisAt(block.Header.Number).RewardMaturity; maturity > 0 && reward > 0 {
+		account.Rewards = account.Rewards.credit(block.Header.Number, reward, maturity)
+	}
+
+	db.accounts.set(block.Header.BeneficiaryID, account)
+	db.supply += reward
 }
 
 // ApplyTransaction performs the business logic for applying a transaction
-// to the database.
+// to the database. A sponsored transaction has the gas and tip paid by the
+// fee payer while the value is still paid by the sender. Balances locked by
+// a vesting schedule can't be spent and escrow operations in the transaction
+// data move the value in and out of escrow accounts. Governance operations in
+// the transaction data are recorded once the transaction is applied and
+// bonding operations move stake in and out of the sender's bond.
 func (db *Database) ApplyTransaction(block Block, tx BlockTx) error {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
+	// Changes made outside of a delta can't be rolled back.
+	db.undo = nil
+
 	// Capture these accounts from the database.
-	from, exists := db.accounts[tx.FromID]
+	from, exists := db.accounts.lookup(tx.FromID)
 	if !exists {
 		from = newAccount(tx.FromID, 0)
 	}
 
-	to, exists := db.accounts[tx.ToID]
+	to, exists := db.accounts.lookup(tx.ToID)
 	if !exists {
 		to = newAccount(tx.ToID, 0)
 	}
 
-	bnfc, exists := db.accounts[block.Header.BeneficiaryID]
+	bnfc, exists := db.accounts.lookup(block.Header.BeneficiaryID)
 	if !exists {
 		bnfc = newAccount(block.Header.BeneficiaryID, 0)
 	}
 
+	// The fees are paid by the sender unless the transaction is sponsored.
+	payer := from
+	if tx.IsSponsored() {
+		payer, exists = db.accounts.lookup(tx.FeePayerID)
+		if !exists {
+			payer = newAccount(tx.FeePayerID, 0)
+		}
+	}
+
+	// When the block has a base fee, the gas price is the most the account
+	// is willing to pay per gas unit and only the base fee is charged.
+	gasPrice := tx.GasPrice
+	if block.Header.BaseFee > 0 {
+		gasPrice = block.Header.BaseFee
+	}
+
 	// The account needs to pay the gas fee regardless. Take the
 	// remaining balance if the account doesn't hold enough for the
 	// full amount of gas. This is the only way to stop bad actors.
-	gasFee := tx.GasPrice * tx.GasUnits
-	if gasFee > from.Balance {
-		gasFee = from.Balance
+	gasFee := gasPrice * tx.GasUnits
+	if spendable := payer.Spendable(block.Header.Number); gasFee > spendable {
+		gasFee = spendable
+	}
+	payer.Balance -= gasFee
+
+	// The base fee is burned and removed from the supply so the beneficiary
+	// only earns the tip. Without a base fee the beneficiary gets the gas.
+	switch {
+	case block.Header.BaseFee > 0:
+		db.supply -= gasFee
+	default:
+		bnfc.Balance += gasFee
 	}
-	from.Balance -= gasFee
-	bnfc.Balance += gasFee
 
 	// Make sure these changes get applied.
-	db.accounts[tx.FromID] = from
-	db.accounts[block.Header.BeneficiaryID] = bnfc
+	if tx.IsSponsored() {
+		db.accounts.set(tx.FeePayerID, payer)
+	} else {
+		from = payer
+	}
+	db.accounts.set(tx.FromID, from)
+	db.accounts.set(block.Header.BeneficiaryID, bnfc)
 
 	// Perform basic accounting checks.
 	{
 		if tx.Nonce != (from.Nonce + 1) {
-			return fmt.Errorf("transaction invalid, wrong nonce, got %d, exp %d", tx.Nonce, from.Nonce+1)
+			return fmt.Errorf("transaction invalid, %w, got %d, exp %d", ErrWrongNonce, tx.Nonce, from.Nonce+1)
+		}
+
+		spendable := from.Spendable(block.Header.Number)
+
+		switch {
+		case tx.IsSponsored():
+			if spendable < tx.Value {
+				return fmt.Errorf("transaction invalid, %w, bal %d, needed %d", ErrInsufficientFunds, spendable, tx.Value)
+			}
+
+			if payerSpendable := payer.Spendable(block.Header.Number); payerSpendable < tx.Tip {
+				return fmt.Errorf("transaction invalid, fee payer has %w, bal %d, needed %d", ErrInsufficientFunds, payerSpendable, tx.Tip)
+			}
+
+		default:
+			if spendable == 0 || spendable < (tx.Value+tx.Tip) {
+				return fmt.Errorf("transaction invalid, %w, bal %d, needed %d", ErrInsufficientFunds, spendable, (tx.Value + tx.Tip))
+			}
+		}
+	}
+
+	// Escrow, governance, bonding and name operations are checked before
+	// any funds move. Only one operation can be carried by a transaction.
+	op, isEscrow := ParseEscrowOp(tx.Data)
+	govOp, isGov := ParseGovOp(tx.Data)
+	bondOp, isBond := ParseBondOp(tx.Data)
+	nameOp, isName := ParseNameOp(tx.Data)
+
+	var ops int
+	for _, is := range []bool{isEscrow, isGov, isBond, isName} {
+		if is {
+			ops++
+		}
+	}
+	if ops > 1 {
+		return errcode.New(errcode.InvalidTx, "transaction invalid, data holds more than one operation")
+	}
+
+	if isEscrow {
+		if err := db.validateEscrow(block, tx, op); err != nil {
+			return err
+		}
+	}
+
+	if isGov {
+		if err := db.validateGovernance(block, tx, govOp); err != nil {
+			return err
+		}
+	}
+
+	if isBond {
+		if err := db.validateBond(block, tx, bondOp); err != nil {
+			return err
 		}
+	}
 
-		if from.Balance == 0 || from.Balance < (tx.Value+tx.Tip) {
-			return fmt.Errorf("transaction invalid, insufficient funds, bal %d, needed %d", from.Balance, (tx.Value + tx.Tip))
+	if isName {
+		if err := db.validateName(tx, nameOp); err != nil {
+			return err
 		}
 	}
 
-	// Update the balances between the two parties.
-	from.Balance -= tx.Value
-	to.Balance += tx.Value
+	// Update the balances between the two parties. The value for an escrow
+	// or bond is moved once the other changes are applied. A cancellation
+	// has no value and the only party is the sender, and the account for a
+	// name is written by the name operation.
+	movesValue := !isEscrow && !isBond && !isName && !tx.IsCancel()
+	if movesValue {
+		from.Balance -= tx.Value
+		to.Balance += tx.Value
+	}
 
 	// Give the beneficiary the tip.
-	from.Balance -= tx.Tip
+	switch {
+	case tx.IsSponsored():
+		payer.Balance -= tx.Tip
+	default:
+		from.Balance -= tx.Tip
+	}
 	bnfc.Balance += tx.Tip
 
 	// Update the nonce for the next transaction check.
 	from.Nonce = tx.Nonce
 
 	// Update the final changes to these accounts.
-	db.accounts[tx.FromID] = from
-	db.accounts[tx.ToID] = to
-	db.accounts[block.Header.BeneficiaryID] = bnfc
+	if tx.IsSponsored() {
+		db.accounts.set(tx.FeePayerID, payer)
+	}
+	db.accounts.set(tx.FromID, from)
+	if movesValue {
+		db.accounts.set(tx.ToID, to)
+	}
+	db.accounts.set(block.Header.BeneficiaryID, bnfc)
+
+	if isEscrow {
+		db.applyEscrow(tx, op)
+	}
+
+	if isGov {
+		db.applyGovernance(tx, govOp)
+	}
+
+	if isBond {
+		db.applyBond(block, tx, bondOp)
+	}
+
+	if isName {
+		db.applyName(tx, nameOp)
+	}
 
 	return nil
 }
 
-// UpdateLatestBlock provides safe access to update the latest block.
+// UpdateLatestBlock provides safe access to update the latest block. The
+// chain statistics are updated with the block as well.
 func (db *Database) UpdateLatestBlock(block Block) {
 	db.mu.Lock()
 	defer db.mu.Unlock()
 
 	db.latestBlock = block
+	db.stats.apply(block)
+	db.undo = nil
+}
+
+// ChainStats returns the current statistics for the blockchain.
+func (db *Database) ChainStats() ChainStats {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	stats := db.stats.snapshot()
+	stats.TotalSupply = db.supply
+	stats.NextBaseFee = db.nextBaseFee()
+
+	return stats
+}
+
+// TotalSupply returns the number of coins that exist, which is the genesis
+// balances plus all the mining rewards minus the burned base fees.
+func (db *Database) TotalSupply() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.supply
+}
+
+// MiningReward returns the maximum mining reward allowed by the monetary
+// policy for the specified block given the current total supply.
+func (db *Database) MiningReward(blockNum uint64) uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.genesisAt(blockNum).MiningRewardAt(blockNum, db.supply)
+}
+
+// GasUnits returns the number of gas units the transaction costs when it's
+// mined into the specified block.
+func (db *Database) GasUnits(tx Tx, blockNum uint64) uint64 {
+	return db.genesis.GasUnitsAt(blockNum, len(tx.Data), tx.Value > 0)
+}
+
+// NextBaseFee returns the base fee per gas unit required for the next block
+// based on how full the latest block is.
+func (db *Database) NextBaseFee() uint64 {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.nextBaseFee()
+}
+
+// nextBaseFee calculates the base fee for the next block. The caller must
+// hold the lock.
+func (db *Database) nextBaseFee() uint64 {
+	header := db.latestBlock.Header
+	if header.Number == 0 {
+		return db.genesis.NextBaseFee(0, 0, 0, 0)
+	}
+
+	trans := db.latestBlock.MerkleTree.Values()
+	return db.genesisAt(header.Number+1).NextBaseFee(header.Number, header.BaseFee, len(trans), gasUsed(trans))
+}
+
+// ValidateBlock validates the block can be the next block in the chain. On
+// top of the block validation, the mining reward is checked against the
+// monetary policy, the base fee is checked against the parent block and
+// each transaction is checked to be for this chain and properly signed.
+func (db *Database) ValidateBlock(block Block, evHandler func(v string, args ...any)) error {
+	return db.pipeline.Validate(BlockCheck{Block: block, Parent: db.LatestBlock(), DB: db}, evHandler)
+}
+
+// ValidateTrustedBlock validates the block like ValidateBlock, skipping the
+// rules a block from a trusted fast sync doesn't need to pass.
+func (db *Database) ValidateTrustedBlock(block Block, evHandler func(v string, args ...any)) error {
+	return db.pipeline.Validate(BlockCheck{Block: block, Parent: db.LatestBlock(), DB: db, Trusted: true}, evHandler)
+}
+
+// Pipeline returns the rules the blocks added to the chain are validated
+// with, so a consensus engine can add its own.
+func (db *Database) Pipeline() *Pipeline {
+	return db.pipeline
 }
 
 // LatestBlock returns the latest block.
@@ -254,7 +582,13 @@ func (db *Database) LatestBlock() Block {
 
 // Write adds a new block to the chain.
 func (db *Database) Write(block Block) error {
-	return db.storage.Write(NewBlockData(block))
+	if err := db.storage.Write(NewBlockData(block)); err != nil {
+		return errcode.Wrap(errcode.StorageFailure, err)
+	}
+
+	db.cache.add(block)
+
+	return nil
 }
 
 // ForEach returns an iterator to walk through all the blocks
@@ -263,15 +597,37 @@ func (db *Database) ForEach() DatabaseIterator {
 	return DatabaseIterator{iterator: db.storage.ForEach()}
 }
 
+// ForEachCtx returns an iterator to walk through all the blocks starting
+// with block number 1 that stops when the specified context is cancelled.
+func (db *Database) ForEachCtx(ctx context.Context) DatabaseIterator {
+	return DatabaseIterator{iterator: IteratorCtx(ctx, db.storage.ForEach())}
+}
+
 // GetBlock searches the blockchain on disk to locate and return the
 // contents of the specified block by number.
 func (db *Database) GetBlock(num uint64) (Block, error) {
+	if block, exists := db.cache.get(num); exists {
+		return block, nil
+	}
+
 	blockData, err := db.storage.GetBlock(num)
 	if err != nil {
-		return Block{}, err
+		return Block{}, errcode.Wrap(errcode.StorageFailure, err)
 	}
 
-	return ToBlock(blockData)
+	block, err := ToBlock(blockData)
+	if err != nil {
+		return Block{}, errcode.Wrap(errcode.StorageCorrupt, err)
+	}
+
+	db.cache.add(block)
+
+	return block, nil
+}
+
+// CacheStats returns the current statistics for the block cache.
+func (db *Database) CacheStats() CacheStats {
+	return db.cache.stats()
 }
 
 // =============================================================================
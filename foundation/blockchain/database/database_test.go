@@ -1,11 +1,16 @@
 package database_test
 
 import (
+	"context"
+	"crypto/ed25519"
 	"errors"
+	"math/big"
 	"testing"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -77,19 +82,18 @@ func Test_Transactions(t *testing.T) {
 
 			db.ApplyMiningReward(database.Block{Header: database.BlockHeader{BeneficiaryID: tst.miner, MiningReward: tst.minerReward}})
 
-			accounts := db.Copy()
-			for account, info := range accounts {
-				finalValue, exists := tst.final[account]
+			db.Snapshot().ForEach(func(info database.Account) {
+				finalValue, exists := tst.final[info.AccountID]
 				if !exists {
-					t.Errorf("Test %s:\tShould have account %s in balances.", tst.name, account)
+					t.Errorf("Test %s:\tShould have account %s in balances.", tst.name, info.AccountID)
 				}
 
 				if finalValue != info.Balance {
-					t.Errorf("Test %s:\tShould have correct balances for %s.", tst.name, account)
+					t.Errorf("Test %s:\tShould have correct balances for %s.", tst.name, info.AccountID)
 					t.Logf("Test %s:\tgot: %d", tst.name, info.Balance)
 					t.Logf("Test %s:\texp: %d", tst.name, finalValue)
 				}
-			}
+			})
 		}
 
 		t.Run(tst.name, f)
@@ -132,8 +136,15 @@ func TestNonceValidation(t *testing.T) {
 					FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
 					ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
 				},
+				{
+					ChainID: 1,
+					Nonce:   3,
+					FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+					ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+					Value:   100,
+				},
 			},
-			results: []error{nil, errors.New("error"), nil},
+			results: []error{nil, database.ErrWrongNonce, nil, database.ErrInsufficientFunds},
 		},
 	}
 
@@ -153,6 +164,12 @@ func TestNonceValidation(t *testing.T) {
 			if (tst.results[i] == nil && err != nil) || (tst.results[i] != nil && err == nil) {
 				t.Fatalf("Test %s:\tShould be able to apply transaction : %s", tst.name, err)
 			}
+
+			if tst.results[i] != nil && !errors.Is(err, tst.results[i]) {
+				t.Logf("Test %s:\tgot: %v", tst.name, err)
+				t.Logf("Test %s:\texp: %v", tst.name, tst.results[i])
+				t.Fatalf("Test %s:\tShould return an error that can be told apart.", tst.name)
+			}
 		}
 	}
 }
@@ -173,6 +190,32 @@ func sign(tx database.Tx, gas uint64) (database.BlockTx, error) {
 	return database.NewBlockTx(signedTx, gas, 1), nil
 }
 
+// feePayerID is the account for the fee payer key used by sponsor.
+const feePayerID = "0x90F8bf6A479f320ead074411a4B0e7944Ea8c9C1"
+
+// sponsor signs the transaction and adds the fee payer signature.
+func sponsor(tx database.Tx, gas uint64) (database.BlockTx, error) {
+	tx.FeePayerID = feePayerID
+
+	blockTx, err := sign(tx, gas)
+	if err != nil {
+		return database.BlockTx{}, err
+	}
+
+	pk, err := crypto.HexToECDSA("4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d")
+	if err != nil {
+		return database.BlockTx{}, err
+	}
+
+	signedTx, err := blockTx.SignFeePayer(pk)
+	if err != nil {
+		return database.BlockTx{}, err
+	}
+	blockTx.SignedTx = signedTx
+
+	return blockTx, nil
+}
+
 // =============================================================================
 
 type MockIterator struct{}
@@ -206,3 +249,586 @@ func (ms MockStorage) Close() error {
 func (ms MockStorage) Reset() error {
 	return nil
 }
+
+func Test_IteratorCtx(t *testing.T) {
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 10; i++ {
+		if err := storage.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var count int
+	iter := database.IteratorCtx(ctx, storage.ForEach())
+	for _, err := iter.Next(); !iter.Done(); _, err = iter.Next() {
+		if err != nil {
+			if !errors.Is(err, context.Canceled) {
+				t.Fatalf("Should get back the context error: %v", err)
+			}
+			continue
+		}
+
+		count++
+		if count == 3 {
+			cancel()
+		}
+	}
+
+	if count != 3 {
+		t.Logf("got: %d", count)
+		t.Logf("exp: %d", 3)
+		t.Fatalf("Should have stopped iterating once the context was cancelled.")
+	}
+}
+
+func Test_TxExpiry(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 1)
+
+	tx := database.Tx{
+		ChainID:    1,
+		Nonce:      2,
+		FromID:     "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:       "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:      10,
+		ValidUntil: 1,
+	}
+
+	if !tx.IsExpired(2) || tx.IsExpired(1) {
+		t.Fatalf("Should only be expired after block 1.")
+	}
+
+	blockTx, err := sign(tx, 1)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    gen.Difficulty,
+		MiningReward:  db.MiningReward(2),
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashState(),
+		Trans:         []database.BlockTx{blockTx},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block 2: %v", err)
+	}
+
+	if err := db.ValidateBlock(block, ev); err == nil {
+		t.Fatalf("Should not accept a block with an expired transaction.")
+	}
+}
+
+func Test_GasUnits(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Gas:          &genesis.GasSchedule{Block: 2, Base: 21, PerByte: 1, Transfer: 9},
+		Balances:     map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// Block 1 is mined before the schedule charges more than one unit.
+	mineBlocks(t, db, gen, 1)
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   2,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   10,
+		Data:    []byte("memo"),
+	}
+
+	if units := db.GasUnits(tx, 2); units != 34 {
+		t.Logf("got: %d", units)
+		t.Logf("exp: %d", 34)
+		t.Fatalf("Should charge the base, data and transfer costs.")
+	}
+
+	mine := func(gasUnits uint64) database.Block {
+		blockTx, err := sign(tx, 1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		blockTx.GasUnits = gasUnits
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			Difficulty:    gen.Difficulty,
+			MiningReward:  db.MiningReward(2),
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block 2: %v", err)
+		}
+
+		return block
+	}
+
+	if err := db.ValidateBlock(mine(1), ev); err == nil {
+		t.Fatalf("Should not accept a block with gas units that don't match the computed cost.")
+	}
+
+	if err := db.ValidateBlock(mine(34), ev); err != nil {
+		t.Fatalf("Should accept a block with the computed gas units: %v", err)
+	}
+}
+
+func Test_BlockGasLimit(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:       1,
+		MiningReward:  700,
+		Gas:           &genesis.GasSchedule{Block: 1, Base: 10},
+		BlockGasLimit: 15,
+		Balances:      map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	db, err := database.New(gen, MockStorage{}, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	var trans []database.BlockTx
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   nonce,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, 1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		blockTx.GasUnits = db.GasUnits(tx, 1)
+
+		trans = append(trans, blockTx)
+	}
+
+	mine := func(trans []database.BlockTx) database.Block {
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			MiningReward:  db.MiningReward(1),
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         trans,
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block 1: %v", err)
+		}
+
+		return block
+	}
+
+	if err := db.ValidateBlock(mine(trans), ev); err == nil {
+		t.Fatalf("Should not accept a block using more gas than the block gas limit.")
+	}
+
+	block := mine(trans[:1])
+	if block.Header.GasUsed != 10 {
+		t.Logf("got: %d", block.Header.GasUsed)
+		t.Logf("exp: %d", 10)
+		t.Fatalf("Should record the gas used by the transactions in the header.")
+	}
+
+	if err := db.ValidateBlock(block, ev); err != nil {
+		t.Fatalf("Should accept a block within the block gas limit: %v", err)
+	}
+
+	block.Header.GasUsed = 0
+	if err := db.ValidateBlock(block, ev); err == nil {
+		t.Fatalf("Should not accept a block without the gas used when there is a block gas limit.")
+	}
+}
+
+func Test_SponsoredTx(t *testing.T) {
+	const miner = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+
+	balances := map[string]uint64{
+		"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 100,
+		feePayerID: 1000,
+	}
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, Balances: balances}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   1,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   100,
+		Tip:     50,
+	}
+
+	blockTx, err := sponsor(tx, 80)
+	if err != nil {
+		t.Fatalf("Should be able to sponsor transaction: %v", err)
+	}
+
+	if err := blockTx.Validate(1); err != nil {
+		t.Fatalf("Should be able to validate the sponsored transaction: %v", err)
+	}
+
+	unsigned := blockTx.SignedTx
+	unsigned.FeePayerV, unsigned.FeePayerR, unsigned.FeePayerS = nil, nil, nil
+	if err := unsigned.Validate(1); err == nil {
+		t.Fatalf("Should not validate without the fee payer signature.")
+	}
+
+	moved := blockTx.SignedTx
+	moved.FeePayerID = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	if err := moved.Validate(1); err == nil {
+		t.Fatalf("Should not validate when the fee payer is changed.")
+	}
+
+	if err := db.ApplyTransaction(database.Block{Header: database.BlockHeader{BeneficiaryID: miner}}, blockTx); err != nil {
+		t.Fatalf("Should be able to apply transaction: %v", err)
+	}
+
+	final := map[database.AccountID]uint64{
+		"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 0,
+		"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32": 100,
+		feePayerID: 870,
+		miner:      130,
+	}
+
+	for accountID, exp := range final {
+		account, err := db.Query(accountID)
+		if err != nil {
+			t.Fatalf("Should be able to query account %s: %v", accountID, err)
+		}
+
+		if account.Balance != exp {
+			t.Logf("got: %d", account.Balance)
+			t.Logf("exp: %d", exp)
+			t.Errorf("Should have correct balance for %s.", accountID)
+		}
+	}
+}
+
+func Test_CancelTx(t *testing.T) {
+	const miner = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+	const pavel = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, Balances: map[string]uint64{pavel: 100}}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	tx, err := database.NewCancelTx(1, 1, pavel, 10)
+	if err != nil {
+		t.Fatalf("Should be able to construct the cancellation: %v", err)
+	}
+
+	if !tx.IsCancel() {
+		t.Fatalf("Should recognize the cancellation.")
+	}
+
+	blockTx, err := sign(tx, 5)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := blockTx.Validate(1); err != nil {
+		t.Fatalf("Should be able to validate the cancellation: %v", err)
+	}
+
+	tx.Value = 1
+	withValue, err := sign(tx, 5)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := withValue.Validate(1); err == nil {
+		t.Fatalf("Should not validate sending value to the same account.")
+	}
+
+	if err := db.ApplyTransaction(database.Block{Header: database.BlockHeader{BeneficiaryID: miner}}, blockTx); err != nil {
+		t.Fatalf("Should be able to apply transaction: %v", err)
+	}
+
+	account, err := db.Query(pavel)
+	if err != nil {
+		t.Fatalf("Should be able to query account: %v", err)
+	}
+
+	if account.Balance != 85 || account.Nonce != 1 {
+		t.Logf("got: balance %d nonce %d", account.Balance, account.Nonce)
+		t.Logf("exp: balance %d nonce %d", 85, 1)
+		t.Fatalf("Should only charge the gas and tip and use the nonce.")
+	}
+}
+
+func Test_CanonicalTx(t *testing.T) {
+	tx := database.Tx{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100, Tip: 50}
+
+	legacyTx, err := sign(tx, 15)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	tx.Encoding = signature.EncodingCanonical
+	canonicalTx, err := sign(tx, 15)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := canonicalTx.Validate(1); err != nil {
+		t.Fatalf("Should be able to validate the canonical transaction: %v", err)
+	}
+
+	if canonicalTx.TxHash() == legacyTx.TxHash() {
+		t.Fatalf("Should hash the transaction with the encoding it was signed with.")
+	}
+
+	downgraded := canonicalTx
+	downgraded.Encoding = signature.EncodingJSON
+	if err := downgraded.Validate(1); err == nil {
+		t.Fatalf("Should not validate a transaction after its encoding changed.")
+	}
+
+	unknown := canonicalTx
+	unknown.Encoding = 2
+	if err := unknown.Validate(1); err == nil {
+		t.Fatalf("Should not validate a transaction with an unknown encoding.")
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    1,
+		MiningReward:  700,
+		Encoding:      signature.EncodingCanonical,
+		Trans:         []database.BlockTx{legacyTx, canonicalTx},
+		EvHandler:     func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	data, err := database.EncodeBlockData(database.NewBlockData(block))
+	if err != nil {
+		t.Fatalf("Should be able to encode the block: %v", err)
+	}
+
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode the block: %v", err)
+	}
+
+	got, err := database.ToBlock(blockData)
+	if err != nil {
+		t.Fatalf("Should be able to convert the block: %v", err)
+	}
+
+	if got.Hash() != block.Hash() || got.MerkleTree.RootHex() != block.Header.TransRoot {
+		t.Logf("got: %s", got.Hash())
+		t.Logf("exp: %s", block.Hash())
+		t.Fatalf("Should keep the encoding of the block and transactions in the binary encoding.")
+	}
+}
+
+func Test_BlockVersion(t *testing.T) {
+	gen := genesis.Genesis{ChainID: 1, Upgrades: []genesis.Upgrade{{Version: 2, Block: 5}}}
+	if _, err := database.New(gen, MockStorage{}, nil); err == nil {
+		t.Fatalf("Should not schedule an unknown block version.")
+	}
+
+	gen.Upgrades = []genesis.Upgrade{{Version: database.BlockVersionSHA3, Block: 5}, {Version: database.BlockVersionSHA3, Block: 10}}
+	if _, err := database.New(gen, MockStorage{}, nil); err == nil {
+		t.Fatalf("Should not schedule the same block version twice.")
+	}
+
+	header := database.BlockHeader{Number: 1, Difficulty: 1}
+	sha256Hash := database.Block{Header: header}.Hash()
+
+	header.Version = database.BlockVersionSHA3
+	sha3Hash := database.Block{Header: header}.Hash()
+
+	if sha3Hash != signature.HashWith(header, signature.SHA3) || sha3Hash == sha256Hash {
+		t.Logf("got: %s", sha3Hash)
+		t.Logf("exp: %s", signature.HashWith(header, signature.SHA3))
+		t.Fatalf("Should hash the header with the algorithm of its version.")
+	}
+
+	header.Version = 2
+	if hash := (database.Block{Header: header}).Hash(); hash != signature.ZeroHash {
+		t.Fatalf("Should not hash a header with an unknown version.")
+	}
+}
+
+func Test_Ed25519Tx(t *testing.T) {
+	pk := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	fromID := database.Ed25519PublicKeyToAccountID(pk.Public().(ed25519.PublicKey))
+
+	tx, err := database.NewTx(1, 1, fromID, "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", 100, 50, nil)
+	if err != nil {
+		t.Fatalf("Should be able to construct the transaction: %v", err)
+	}
+
+	signedTx, err := tx.SignEd25519(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := signedTx.Validate(1); err != nil {
+		t.Fatalf("Should be able to validate the transaction: %v", err)
+	}
+
+	tampered := signedTx
+	tampered.Value = 200
+	if err := tampered.Validate(1); err == nil {
+		t.Fatalf("Should not validate a changed transaction.")
+	}
+
+	withV := signedTx
+	withV.V = big.NewInt(29)
+	if err := withV.Validate(1); err == nil {
+		t.Fatalf("Should not validate a transaction carrying signature values of another scheme.")
+	}
+
+	blockTx := database.NewBlockTx(signedTx, 15, 1)
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    1,
+		MiningReward:  700,
+		Trans:         []database.BlockTx{blockTx},
+		EvHandler:     func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	data, err := database.EncodeBlockData(database.NewBlockData(block))
+	if err != nil {
+		t.Fatalf("Should be able to encode the block: %v", err)
+	}
+
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode the block: %v", err)
+	}
+
+	got := blockData.Trans[0]
+	if got.V != nil || got.TxHash() != blockTx.TxHash() || !got.Equals(blockTx) {
+		t.Logf("got: %s", got.TxHash())
+		t.Logf("exp: %s", blockTx.TxHash())
+		t.Fatalf("Should keep the Ed25519 signature in the binary encoding.")
+	}
+
+	if err := got.Validate(1); err != nil {
+		t.Fatalf("Should be able to validate the decoded transaction: %v", err)
+	}
+}
+
+func Test_RewardMaturity(t *testing.T) {
+	const (
+		miner = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+		other = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+	)
+
+	gen := genesis.Genesis{ChainID: 1, MiningReward: 100, RewardMaturity: 3, Balances: map[string]uint64{}}
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	db.ApplyMiningReward(database.Block{Header: database.BlockHeader{Number: 1, BeneficiaryID: miner, MiningReward: 100}})
+	db.ApplyMiningReward(database.Block{Header: database.BlockHeader{Number: 2, BeneficiaryID: miner, MiningReward: 100}})
+
+	account, _ := db.Query(miner)
+	if immature := account.Rewards.ImmatureAt(3); immature != 200 || account.Spendable(3) != 0 {
+		t.Logf("got: %d immature %d spendable", immature, account.Spendable(3))
+		t.Logf("exp: %d immature %d spendable", 200, 0)
+		t.Fatalf("Should hold back both rewards until they mature.")
+	}
+
+	// send applies a transfer from the miner in the block.
+	send := func(blockNum uint64, nonce uint64, value uint64) error {
+		blockTx, err := sign(database.Tx{ChainID: 1, Nonce: nonce, FromID: miner, ToID: other, Value: value}, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block := database.Block{Header: database.BlockHeader{Number: blockNum, BeneficiaryID: other}}
+		return db.ApplyTransaction(block, blockTx)
+	}
+
+	if err := send(3, 1, 50); err == nil {
+		t.Fatalf("Should not spend a reward before it matures.")
+	}
+
+	if err := send(4, 1, 100); err != nil {
+		t.Fatalf("Should be able to spend the reward that matured: %v", err)
+	}
+
+	if err := send(4, 2, 50); err == nil {
+		t.Fatalf("Should not spend the reward that hasn't matured.")
+	}
+
+	// Crediting a new reward drops the rewards that matured.
+	db.ApplyMiningReward(database.Block{Header: database.BlockHeader{Number: 5, BeneficiaryID: miner, MiningReward: 100}})
+
+	account, _ = db.Query(miner)
+	if n := len(account.Rewards.Maturing); n != 1 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should only keep the reward that hasn't matured.")
+	}
+
+	if spendable := account.Spendable(5); spendable != 100 {
+		t.Logf("got: %d", spendable)
+		t.Logf("exp: %d", 100)
+		t.Fatalf("Should be able to spend the reward from block 2.")
+	}
+}
@@ -0,0 +1,192 @@
+package database
+
+import (
+	"errors"
+	"sort"
+)
+
+// ErrStaleDelta is returned when a delta is committed after the database has
+// moved on from the block the delta was staged on.
+var ErrStaleDelta = errors.New("state delta was staged on a different block")
+
+// undoDepth is the number of the most recent committed blocks that can be
+// rolled back without replaying the chain from genesis.
+const undoDepth = 64
+
+// =============================================================================
+
+// StateDelta stages the changes of applying a block to the database. The
+// transactions are applied to a layer on top of the accounts so the database
+// doesn't change until the delta is committed, at which point every change
+// for the block becomes visible at once.
+//
+// CORE NOTE: A transaction that fails still pays for its gas. That charge is
+// part of the delta like any other change, so a failed transaction only
+// leaves the gas fee behind, the same as it always has.
+type StateDelta struct {
+	block  Block
+	parent Block
+	sdb    *Database
+}
+
+// Stage constructs a delta for applying the block on top of the current
+// state of the database.
+func (db *Database) Stage(block Block) *StateDelta {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	sdb := Database{
+		genesis:     db.genesis,
+		latestBlock: db.latestBlock,
+		accounts:    newLayer(&db.accounts),
+		storage:     db.storage,
+		cache:       newBlockCache(0),
+		stats:       newChainStats(),
+		supply:      db.supply,
+		gov:         db.gov.clone(),
+	}
+
+	return &StateDelta{
+		block:  block,
+		parent: db.latestBlock,
+		sdb:    &sdb,
+	}
+}
+
+// ApplyTransaction stages the changes for applying the transaction.
+func (d *StateDelta) ApplyTransaction(tx BlockTx) error {
+	return d.sdb.ApplyTransaction(d.block, tx)
+}
+
+// ApplyMiningReward stages the mining reward for the block.
+func (d *StateDelta) ApplyMiningReward() {
+	d.sdb.ApplyMiningReward(d.block)
+}
+
+// Query retrieves an account as it would be once the delta is committed.
+func (d *StateDelta) Query(accountID AccountID) (Account, error) {
+	return d.sdb.Query(accountID)
+}
+
+// Changes returns the balances the delta changes sorted by account id. An
+// account the delta removes ends with a balance of zero.
+func (d *StateDelta) Changes() []BalanceChange {
+	var changes []BalanceChange
+	d.sdb.accounts.changes(func(accountID AccountID, account Account, removed bool) {
+		before, _ := d.sdb.accounts.base.lookup(accountID)
+		if before.Balance != account.Balance {
+			changes = append(changes, BalanceChange{AccountID: accountID, Before: before.Balance, After: account.Balance})
+		}
+	})
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].AccountID < changes[j].AccountID
+	})
+
+	return changes
+}
+
+// BalanceChange represents the balance of an account before and after a
+// block is applied.
+type BalanceChange struct {
+	AccountID AccountID `json:"account"`
+	Before    uint64    `json:"before"`
+	After     uint64    `json:"after"`
+}
+
+// =============================================================================
+
+// undoRecord holds the state of the database from before a block was
+// committed so the block can be rolled back.
+type undoRecord struct {
+	number      uint64
+	accounts    []accountUndo
+	supply      uint64
+	gov         *governance
+	stats       *chainStats
+	latestBlock Block
+}
+
+// accountUndo holds the value of an account before it was changed.
+type accountUndo struct {
+	accountID AccountID
+	account   Account
+	existed   bool
+}
+
+// Commit applies the staged changes to the database and makes the block the
+// latest block. The delta must be staged on the current latest block.
+func (db *Database) Commit(d *StateDelta) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.latestBlock.Header.Number != d.parent.Header.Number || db.latestBlock.Hash() != d.parent.Hash() {
+		return ErrStaleDelta
+	}
+
+	record := undoRecord{
+		number:      d.block.Header.Number,
+		supply:      db.supply,
+		gov:         db.gov,
+		stats:       db.stats,
+		latestBlock: db.latestBlock,
+	}
+
+	d.sdb.accounts.changes(func(accountID AccountID, account Account, removed bool) {
+		prev, existed := db.accounts.lookup(accountID)
+		record.accounts = append(record.accounts, accountUndo{accountID: accountID, account: prev, existed: existed})
+
+		switch {
+		case removed:
+			db.accounts.remove(accountID)
+		default:
+			db.accounts.set(accountID, account)
+		}
+	})
+
+	stats := db.stats.clone()
+	stats.apply(d.block)
+
+	db.supply = d.sdb.supply
+	db.gov = d.sdb.gov
+	db.stats = stats
+	db.latestBlock = d.block
+
+	db.undo = append(db.undo, record)
+	if len(db.undo) > undoDepth {
+		db.undo = db.undo[len(db.undo)-undoDepth:]
+	}
+
+	return nil
+}
+
+// undoTo rolls the state back to the specified block using the undo records
+// of the blocks committed after it. False is returned and nothing changes if
+// the records don't reach back to the block. The caller must hold the lock.
+func (db *Database) undoTo(num uint64) bool {
+	latest := db.latestBlock.Header.Number
+	if num >= latest || uint64(len(db.undo)) < latest-num || db.undo[len(db.undo)-1].number != latest {
+		return false
+	}
+
+	for db.latestBlock.Header.Number > num {
+		record := db.undo[len(db.undo)-1]
+		db.undo = db.undo[:len(db.undo)-1]
+
+		for _, au := range record.accounts {
+			switch {
+			case au.existed:
+				db.accounts.set(au.accountID, au.account)
+			default:
+				db.accounts.remove(au.accountID)
+			}
+		}
+
+		db.supply = record.supply
+		db.gov = record.gov
+		db.stats = record.stats
+		db.latestBlock = record.latestBlock
+	}
+
+	return true
+}
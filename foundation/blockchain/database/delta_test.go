@@ -0,0 +1,218 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+func Test_StateDelta(t *testing.T) {
+	const fromID = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+	const toID = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	const minerID = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+
+	gen := genesis.Genesis{ChainID: 1, Balances: map[string]uint64{fromID: 1000}}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	good := database.NewBlockTx(database.SignedTx{Tx: database.Tx{ChainID: 1, Nonce: 1, FromID: fromID, ToID: toID, Value: 100}}, 1, 1)
+	bad := database.NewBlockTx(database.SignedTx{Tx: database.Tx{ChainID: 1, Nonce: 5, FromID: fromID, ToID: toID, Value: 100}}, 1, 1)
+
+	tree, err := merkle.NewTree([]database.BlockTx{good, bad})
+	if err != nil {
+		t.Fatalf("Should be able to construct merkle tree: %v", err)
+	}
+
+	block := database.Block{Header: database.BlockHeader{Number: 1, BeneficiaryID: minerID}, MerkleTree: tree}
+	delta := db.Stage(block)
+
+	if err := delta.ApplyTransaction(good); err != nil {
+		t.Fatalf("Should be able to stage transaction: %v", err)
+	}
+
+	// The nonce is wrong so the transaction fails after paying for its gas.
+	if err := delta.ApplyTransaction(bad); err == nil {
+		t.Fatalf("Should not be able to stage transaction with the wrong nonce.")
+	}
+
+	from, _ := db.Query(fromID)
+	if from.Balance != 1000 || from.Nonce != 0 {
+		t.Logf("got: %d, nonce %d", from.Balance, from.Nonce)
+		t.Logf("exp: %d, nonce %d", 1000, 0)
+		t.Fatalf("Should not change the database before the delta is committed.")
+	}
+	if _, err := db.Query(toID); err == nil {
+		t.Fatalf("Should not create accounts before the delta is committed.")
+	}
+	if n := db.Snapshot().Len(); n != 1 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should not add accounts to snapshots before the delta is committed.")
+	}
+
+	staged, err := delta.Query(fromID)
+	if err != nil {
+		t.Fatalf("Should be able to query the staged account: %v", err)
+	}
+	if staged.Balance != 898 || staged.Nonce != 1 {
+		t.Logf("got: %d, nonce %d", staged.Balance, staged.Nonce)
+		t.Logf("exp: %d, nonce %d", 898, 1)
+		t.Fatalf("Should only charge gas for the failed transaction.")
+	}
+
+	changes := delta.Changes()
+	if len(changes) != 3 || changes[2].AccountID != fromID || changes[2].Before != 1000 || changes[2].After != 898 {
+		t.Logf("got: %+v", changes)
+		t.Logf("exp: %s from %d to %d last of %d", fromID, 1000, 898, 3)
+		t.Fatalf("Should report the changed balances sorted by account.")
+	}
+
+	if err := db.Commit(delta); err != nil {
+		t.Fatalf("Should be able to commit the delta: %v", err)
+	}
+
+	exp := map[database.AccountID]uint64{fromID: 898, toID: 100, minerID: 2}
+	for accountID, balance := range exp {
+		account, err := db.Query(accountID)
+		if err != nil {
+			t.Fatalf("Should be able to query account %s: %v", accountID, err)
+		}
+		if account.Balance != balance {
+			t.Logf("got: %d", account.Balance)
+			t.Logf("exp: %d", balance)
+			t.Fatalf("Should have the committed balance for account %s.", accountID)
+		}
+	}
+
+	if db.LatestBlock().Header.Number != 1 {
+		t.Fatalf("Should make the block the latest block.")
+	}
+
+	if err := db.Commit(delta); !errors.Is(err, database.ErrStaleDelta) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", database.ErrStaleDelta)
+		t.Fatalf("Should not be able to commit a delta staged on an older block.")
+	}
+}
+
+func Test_RollbackUndo(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	open := func() (*database.Database, *disk.Disk) {
+		storage, err := disk.New(t.TempDir())
+		if err != nil {
+			t.Fatalf("Should be able to construct disk storage: %v", err)
+		}
+
+		db, err := database.New(gen, storage, ev)
+		if err != nil {
+			t.Fatalf("Should be able to open database: %v", err)
+		}
+
+		return db, storage
+	}
+
+	// The first database commits its blocks through deltas so a rollback can
+	// undo them, the second applies them directly so a rollback replays.
+	undoDB, storage := open()
+	commitBlocks(t, undoDB, gen, 2)
+	exp := undoDB.HashState()
+	commitBlocks(t, undoDB, gen, 3)
+
+	replayDB, _ := open()
+	mineBlocks(t, replayDB, gen, 5)
+
+	if undoDB.HashState() != replayDB.HashState() {
+		t.Fatalf("Should have the same state for the same blocks.")
+	}
+
+	for _, db := range []*database.Database{undoDB, replayDB} {
+		if err := db.Rollback(context.Background(), 2, ev); err != nil {
+			t.Fatalf("Should be able to roll back to block 2: %v", err)
+		}
+
+		if db.LatestBlock().Header.Number != 2 {
+			t.Logf("got: %d", db.LatestBlock().Header.Number)
+			t.Logf("exp: %d", 2)
+			t.Fatalf("Should have moved the latest block back.")
+		}
+
+		if got := db.HashState(); got != exp {
+			t.Logf("got: %s", got)
+			t.Logf("exp: %s", exp)
+			t.Fatalf("Should have the state of the chain at block 2.")
+		}
+	}
+
+	if _, err := storage.GetBlock(3); err == nil {
+		t.Fatalf("Should have truncated the chain.")
+	}
+
+	// The chain can grow again from the block it was rolled back to.
+	commitBlocks(t, undoDB, gen, 1)
+	if undoDB.LatestBlock().Header.Number != 3 {
+		t.Fatalf("Should be able to commit blocks after the rollback.")
+	}
+}
+
+// commitBlocks mines the specified number of blocks, each with a single
+// transaction, and commits them to the database through a delta.
+func commitBlocks(t *testing.T, db *database.Database, gen genesis.Genesis, blocks uint64) {
+	ev := func(v string, args ...any) {}
+
+	start := db.LatestBlock().Header.Number + 1
+	for i := start; i < start+blocks; i++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   i,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, gen.BaseFee+1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			Difficulty:    gen.Difficulty,
+			MiningReward:  db.MiningReward(i),
+			BaseFee:       db.NextBaseFee(),
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", i, err)
+		}
+
+		delta := db.Stage(block)
+		delta.ApplyTransaction(blockTx)
+		delta.ApplyMiningReward()
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+		if err := db.Commit(delta); err != nil {
+			t.Fatalf("Should be able to commit block %d: %v", i, err)
+		}
+	}
+}
@@ -0,0 +1,361 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/rlp"
+)
+
+// BinaryContentType is the content type used when block data is sent between
+// nodes using the binary encoding.
+const BinaryContentType = "application/vnd.ardan.block"
+
+// encodingVersion is the first byte of every binary encoded value so the
+// format can change without breaking chains or peers using an older version.
+const encodingVersion byte = 1
+
+// CORE NOTE: The binary encoding is used for disk storage and peer transfer.
+// Block hashes and transaction signatures are still calculated against the
+// JSON representation, either Go's JSON marshaling or the canonical JSON
+// encoding, so existing chains and wallets remain valid. The canonical
+// encoding is already the fork that makes hashes reproducible, and wallets
+// in other languages sign it without an RLP library, so hashing doesn't move
+// to this encoding. Decoding a block here gives the same hash as decoding
+// its JSON, since every field the hash covers round trips. JSON is also
+// retained for the public API.
+
+// =============================================================================
+
+// EncodeBlockData converts the block data into the versioned binary encoding.
+func EncodeBlockData(blockData BlockData) ([]byte, error) {
+	return encode(toBinaryBlock(blockData))
+}
+
+// DecodeBlockData converts data produced by EncodeBlockData back into block
+// data. Data that is JSON encoded is also accepted to support chains that were
+// written before the binary encoding existed.
+func DecodeBlockData(data []byte) (BlockData, error) {
+	if isJSON(data) {
+		var blockData BlockData
+		if err := json.Unmarshal(data, &blockData); err != nil {
+			return BlockData{}, err
+		}
+		return blockData, nil
+	}
+
+	var bb binaryBlock
+	if err := decode(data, &bb); err != nil {
+		return BlockData{}, err
+	}
+
+	return bb.toBlockData(), nil
+}
+
+// EncodeBlocksData converts a list of block data into the versioned
+// binary encoding.
+func EncodeBlocksData(blocksData []BlockData) ([]byte, error) {
+	bbs := make([]binaryBlock, len(blocksData))
+	for i, blockData := range blocksData {
+		bbs[i] = toBinaryBlock(blockData)
+	}
+
+	return encode(bbs)
+}
+
+// DecodeBlocksData converts data produced by EncodeBlocksData back into a
+// list of block data. Data that is JSON encoded is also accepted to support
+// peers that don't use the binary encoding.
+func DecodeBlocksData(data []byte) ([]BlockData, error) {
+	if isJSON(data) {
+		var blocksData []BlockData
+		if err := json.Unmarshal(data, &blocksData); err != nil {
+			return nil, err
+		}
+		return blocksData, nil
+	}
+
+	var bbs []binaryBlock
+	if err := decode(data, &bbs); err != nil {
+		return nil, err
+	}
+
+	blocksData := make([]BlockData, len(bbs))
+	for i, bb := range bbs {
+		blocksData[i] = bb.toBlockData()
+	}
+
+	return blocksData, nil
+}
+
+// =============================================================================
+
+// binaryHeader is the binary representation of a block header.
+type binaryHeader struct {
+	Number        uint64
+	PrevBlockHash string
+	TimeStamp     uint64
+	BeneficiaryID string
+	Difficulty    uint16
+	MiningReward  uint64
+	StateRoot     string
+	TransRoot     string
+	Nonce         uint64
+
+	// Fields added after version 1 must be optional so older data decodes.
+	BaseFee  uint64 `rlp:"optional"`
+	Encoding uint8  `rlp:"optional"`
+	Version  uint8  `rlp:"optional"`
+	GasUsed  uint64 `rlp:"optional"`
+}
+
+// binaryTx is the binary representation of a block transaction. NilData is
+// required since the JSON used for hashing distinguishes nil and empty data.
+type binaryTx struct {
+	ChainID   uint16
+	Nonce     uint64
+	FromID    string
+	ToID      string
+	Value     uint64
+	Tip       uint64
+	Data      []byte
+	NilData   bool
+	V         *big.Int
+	R         *big.Int
+	S         *big.Int
+	TimeStamp uint64
+	GasPrice  uint64
+	GasUnits  uint64
+
+	// Fields added after version 1 must be optional so older data decodes.
+	ValidUntil uint64   `rlp:"optional"`
+	FeePayerID string   `rlp:"optional"`
+	FeePayerV  *big.Int `rlp:"optional"`
+	FeePayerR  *big.Int `rlp:"optional"`
+	FeePayerS  *big.Int `rlp:"optional"`
+	Encoding   uint8    `rlp:"optional"`
+	Scheme     string   `rlp:"optional"`
+	PublicKey  []byte   `rlp:"optional"`
+	Sig        []byte   `rlp:"optional"`
+}
+
+// binaryBlock is the binary representation of block data.
+type binaryBlock struct {
+	Hash      string
+	Header    binaryHeader
+	Trans     []binaryTx
+	Signature string `rlp:"optional"`
+	Signers   []byte `rlp:"optional"`
+	VotesSig  []byte `rlp:"optional"`
+}
+
+// toBinaryBlock converts block data into its binary representation.
+func toBinaryBlock(blockData BlockData) binaryBlock {
+	h := blockData.Header
+
+	trans := make([]binaryTx, len(blockData.Trans))
+	for i, tx := range blockData.Trans {
+		trans[i] = toBinaryTx(tx)
+	}
+
+	bb := binaryBlock{
+		Hash: blockData.Hash,
+		Header: binaryHeader{
+			Number:        h.Number,
+			PrevBlockHash: h.PrevBlockHash,
+			TimeStamp:     h.TimeStamp,
+			BeneficiaryID: string(h.BeneficiaryID),
+			Difficulty:    h.Difficulty,
+			MiningReward:  h.MiningReward,
+			StateRoot:     h.StateRoot,
+			TransRoot:     h.TransRoot,
+			Nonce:         h.Nonce,
+			BaseFee:       h.BaseFee,
+			Encoding:      h.Encoding,
+			Version:       h.Version,
+			GasUsed:       h.GasUsed,
+		},
+		Trans:     trans,
+		Signature: blockData.Signature,
+	}
+
+	if blockData.Votes != nil {
+		bb.Signers = blockData.Votes.Signers
+		bb.VotesSig = blockData.Votes.Signature
+	}
+
+	return bb
+}
+
+// toBlockData converts the binary representation back into block data.
+func (bb binaryBlock) toBlockData() BlockData {
+	h := bb.Header
+
+	trans := make([]BlockTx, len(bb.Trans))
+	for i, btx := range bb.Trans {
+		trans[i] = btx.toBlockTx()
+	}
+
+	blockData := BlockData{
+		Hash: bb.Hash,
+		Header: BlockHeader{
+			Number:        h.Number,
+			PrevBlockHash: h.PrevBlockHash,
+			TimeStamp:     h.TimeStamp,
+			BeneficiaryID: AccountID(h.BeneficiaryID),
+			Difficulty:    h.Difficulty,
+			MiningReward:  h.MiningReward,
+			StateRoot:     h.StateRoot,
+			TransRoot:     h.TransRoot,
+			Nonce:         h.Nonce,
+			BaseFee:       h.BaseFee,
+			Encoding:      h.Encoding,
+			Version:       h.Version,
+			GasUsed:       h.GasUsed,
+		},
+		Trans:     trans,
+		Signature: bb.Signature,
+	}
+
+	if bb.VotesSig != nil {
+		blockData.Votes = &Votes{
+			Signers:   bb.Signers,
+			Signature: bb.VotesSig,
+		}
+	}
+
+	return blockData
+}
+
+// toBinaryTx converts a block transaction into its binary representation.
+func toBinaryTx(tx BlockTx) binaryTx {
+	return binaryTx{
+		ChainID:    tx.ChainID,
+		Nonce:      tx.Nonce,
+		FromID:     string(tx.FromID),
+		ToID:       string(tx.ToID),
+		Value:      tx.Value,
+		Tip:        tx.Tip,
+		Data:       tx.Data,
+		NilData:    tx.Data == nil,
+		V:          bigOrZero(tx.V),
+		R:          bigOrZero(tx.R),
+		S:          bigOrZero(tx.S),
+		TimeStamp:  tx.TimeStamp,
+		GasPrice:   tx.GasPrice,
+		GasUnits:   tx.GasUnits,
+		ValidUntil: tx.ValidUntil,
+		FeePayerID: string(tx.FeePayerID),
+		FeePayerV:  tx.FeePayerV,
+		FeePayerR:  tx.FeePayerR,
+		FeePayerS:  tx.FeePayerS,
+		Encoding:   tx.Encoding,
+		Scheme:     tx.Scheme,
+		PublicKey:  tx.PublicKey,
+		Sig:        tx.Sig,
+	}
+}
+
+// toBlockTx converts the binary representation back into a block transaction.
+func (btx binaryTx) toBlockTx() BlockTx {
+	data := btx.Data
+	switch {
+	case btx.NilData:
+		data = nil
+	case data == nil:
+		data = []byte{}
+	}
+
+	// Optional fields before the last one set are encoded as zero values,
+	// so the fee payer signature is only kept for sponsored transactions.
+	feePayerV, feePayerR, feePayerS := btx.FeePayerV, btx.FeePayerR, btx.FeePayerS
+	if btx.FeePayerID == "" {
+		feePayerV, feePayerR, feePayerS = nil, nil, nil
+	}
+
+	// V, R and S are only set for transactions signed with ECDSA.
+	v, r, s := btx.V, btx.R, btx.S
+	if btx.Scheme != "" {
+		v, r, s = nil, nil, nil
+	}
+
+	return BlockTx{
+		SignedTx: SignedTx{
+			Tx: Tx{
+				ChainID:    btx.ChainID,
+				Nonce:      btx.Nonce,
+				FromID:     AccountID(btx.FromID),
+				ToID:       AccountID(btx.ToID),
+				Value:      btx.Value,
+				Tip:        btx.Tip,
+				Data:       data,
+				ValidUntil: btx.ValidUntil,
+				FeePayerID: AccountID(btx.FeePayerID),
+				Encoding:   btx.Encoding,
+			},
+			V:         v,
+			R:         r,
+			S:         s,
+			FeePayerV: feePayerV,
+			FeePayerR: feePayerR,
+			FeePayerS: feePayerS,
+			Scheme:    btx.Scheme,
+			PublicKey: btx.PublicKey,
+			Sig:       btx.Sig,
+		},
+		TimeStamp: btx.TimeStamp,
+		GasPrice:  btx.GasPrice,
+		GasUnits:  btx.GasUnits,
+	}
+}
+
+// =============================================================================
+
+// encode produces the versioned binary encoding for the value.
+func encode(value any) ([]byte, error) {
+	data, err := rlp.EncodeToBytes(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return append([]byte{encodingVersion}, data...), nil
+}
+
+// decode validates the version and decodes the binary encoding into the value.
+func decode(data []byte, value any) error {
+	if len(data) == 0 {
+		return errors.New("binary data is empty")
+	}
+
+	if data[0] != encodingVersion {
+		return fmt.Errorf("binary encoding version %d is not supported", data[0])
+	}
+
+	return rlp.DecodeBytes(data[1:], value)
+}
+
+// isJSON identifies if the data represents a JSON document.
+func isJSON(data []byte) bool {
+	for _, c := range data {
+		switch c {
+		case ' ', '\t', '\r', '\n':
+			continue
+		case '{', '[':
+			return true
+		}
+		return false
+	}
+
+	return false
+}
+
+// bigOrZero returns a zero value when the big integer is nil since the binary
+// encoding requires a value.
+func bigOrZero(v *big.Int) *big.Int {
+	if v == nil {
+		return big.NewInt(0)
+	}
+	return v
+}
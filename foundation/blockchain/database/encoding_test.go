@@ -0,0 +1,148 @@
+package database_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func Test_BinaryEncoding(t *testing.T) {
+	txs := []database.Tx{
+		{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100, Tip: 50},
+		{ChainID: 1, Nonce: 2, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100, Data: []byte{}},
+		{ChainID: 1, Nonce: 3, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100, Data: []byte("hello")},
+		{ChainID: 1, Nonce: 4, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100, ValidUntil: 10},
+	}
+
+	var trans []database.BlockTx
+	for _, tx := range txs {
+		blockTx, err := sign(tx, 15)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		trans = append(trans, blockTx)
+	}
+
+	sponsoredTx, err := sponsor(database.Tx{ChainID: 1, Nonce: 5, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", Value: 100}, 15)
+	if err != nil {
+		t.Fatalf("Should be able to sponsor transaction: %v", err)
+	}
+	trans = append(trans, sponsoredTx)
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    1,
+		MiningReward:  700,
+		Trans:         trans,
+		EvHandler:     func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	data, err := database.EncodeBlockData(database.NewBlockData(block))
+	if err != nil {
+		t.Fatalf("Should be able to encode the block: %v", err)
+	}
+
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode the block: %v", err)
+	}
+
+	got, err := database.ToBlock(blockData)
+	if err != nil {
+		t.Fatalf("Should be able to convert the block: %v", err)
+	}
+
+	if got.Hash() != block.Hash() {
+		t.Logf("got: %s", got.Hash())
+		t.Logf("exp: %s", block.Hash())
+		t.Fatalf("Should get back the same block hash.")
+	}
+
+	if got.MerkleTree.RootHex() != block.Header.TransRoot {
+		t.Logf("got: %s", got.MerkleTree.RootHex())
+		t.Logf("exp: %s", block.Header.TransRoot)
+		t.Fatalf("Should get back the same transactions.")
+	}
+
+	blocksData, err := database.EncodeBlocksData([]database.BlockData{blockData, blockData})
+	if err != nil {
+		t.Fatalf("Should be able to encode the list of blocks: %v", err)
+	}
+
+	list, err := database.DecodeBlocksData(blocksData)
+	if err != nil {
+		t.Fatalf("Should be able to decode the list of blocks: %v", err)
+	}
+
+	if len(list) != 2 || list[1].Hash != blockData.Hash {
+		t.Fatalf("Should get back the list of blocks.")
+	}
+}
+
+func Test_RawTx(t *testing.T) {
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	args := database.RawTxArgs{
+		ChainID:    1,
+		Nonce:      7,
+		ToID:       "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:      100,
+		Tip:        5,
+		ValidUntil: 50,
+	}
+
+	raw, err := database.SignRawTx(args, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the raw transaction: %v", err)
+	}
+
+	signedTx, err := database.DecodeRawTx(raw)
+	if err != nil {
+		t.Fatalf("Should be able to decode the raw transaction: %v", err)
+	}
+
+	if err := signedTx.Validate(args.ChainID); err != nil {
+		t.Fatalf("Should have a valid signature after decoding: %v", err)
+	}
+
+	exp := database.PublicKeyToAccountID(pk.PublicKey)
+	if signedTx.FromID != exp || signedTx.Nonce != args.Nonce || signedTx.ValidUntil != args.ValidUntil {
+		t.Logf("got: %s %d %d", signedTx.FromID, signedTx.Nonce, signedTx.ValidUntil)
+		t.Logf("exp: %s %d %d", exp, args.Nonce, args.ValidUntil)
+		t.Fatalf("Should decode the details the transaction was signed with.")
+	}
+
+	// The JSON encoding of a signed transaction is accepted as well.
+	data, err := json.Marshal(signedTx)
+	if err != nil {
+		t.Fatalf("Should be able to marshal the transaction: %v", err)
+	}
+
+	fromJSON, err := database.DecodeRawTx(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode the JSON transaction: %v", err)
+	}
+
+	if fromJSON.TxHash() != signedTx.TxHash() {
+		t.Logf("got: %s", fromJSON.TxHash())
+		t.Logf("exp: %s", signedTx.TxHash())
+		t.Fatalf("Should decode the same transaction from JSON.")
+	}
+
+	if _, err := database.DecodeRawTx(append(raw, 0)); err == nil {
+		t.Fatalf("Should not decode a raw transaction with trailing bytes.")
+	}
+
+	if _, err := database.SignRawTx(database.RawTxArgs{ChainID: 1, ToID: exp, Value: 1}, pk); err == nil {
+		t.Fatalf("Should not sign a transaction sending money to yourself.")
+	}
+}
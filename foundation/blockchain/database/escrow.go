@@ -0,0 +1,149 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+// Set of escrow operations that can be carried in the transaction data.
+const (
+	EscrowCreate  = "create"
+	EscrowRelease = "release"
+	EscrowRefund  = "refund"
+)
+
+// Escrow represents the two parties for funds held in an escrow account. The
+// payer can release the funds to the payee and the payee can refund them back
+// to the payer. Once the escrow expires the payer can refund the funds too.
+type Escrow struct {
+	Payer     AccountID
+	Payee     AccountID
+	ExpiresAt uint64 `json:",omitempty"`
+}
+
+// EscrowOp represents an escrow operation carried in the transaction data.
+// A create transaction sends the value from the payer into a new escrow
+// account for the payee in the to field. Release and refund transactions
+// are sent to the escrow account with no value.
+type EscrowOp struct {
+	Op        string `json:"escrow"`
+	ExpiresAt uint64 `json:"expires_at,omitempty"`
+}
+
+// Data returns the encoded operation for use as transaction data.
+func (op EscrowOp) Data() ([]byte, error) {
+	return json.Marshal(op)
+}
+
+// ParseEscrowOp checks the transaction data for an escrow operation.
+func ParseEscrowOp(data []byte) (EscrowOp, bool) {
+	if len(data) == 0 || data[0] != '{' {
+		return EscrowOp{}, false
+	}
+
+	var op EscrowOp
+	if err := json.Unmarshal(data, &op); err != nil {
+		return EscrowOp{}, false
+	}
+
+	switch op.Op {
+	case EscrowCreate, EscrowRelease, EscrowRefund:
+		return op, true
+	}
+
+	return EscrowOp{}, false
+}
+
+// EscrowAccountID returns the account that holds the funds for the escrow
+// created by the specified payer and nonce.
+func EscrowAccountID(payer AccountID, nonce uint64) AccountID {
+	hash := signature.Hash(struct {
+		Payer AccountID
+		Nonce uint64
+	}{payer, nonce})
+
+	// Use the last 20 bytes of the hash like an address.
+	return AccountID("0x" + hash[len(hash)-40:])
+}
+
+// =============================================================================
+
+// validateEscrow checks the escrow operation can be applied by the sender of
+// the transaction. The caller must hold the lock.
+func (db *Database) validateEscrow(block Block, tx BlockTx, op EscrowOp) error {
+	if op.Op == EscrowCreate {
+		if tx.Value == 0 {
+			return errors.New("transaction invalid, escrow requires a value")
+		}
+
+		if _, exists := db.accounts.lookup(EscrowAccountID(tx.FromID, tx.Nonce)); exists {
+			return errors.New("transaction invalid, escrow account already exists")
+		}
+
+		return nil
+	}
+
+	if tx.Value != 0 {
+		return fmt.Errorf("transaction invalid, escrow %s can't carry a value", op.Op)
+	}
+
+	escrow := db.accounts.get(tx.ToID).Escrow
+	if escrow == nil {
+		return fmt.Errorf("transaction invalid, %s is not an escrow account", tx.ToID)
+	}
+
+	switch op.Op {
+	case EscrowRelease:
+		if tx.FromID != escrow.Payer {
+			return errors.New("transaction invalid, only the payer can release the escrow")
+		}
+
+	case EscrowRefund:
+		expired := escrow.ExpiresAt > 0 && block.Header.Number > escrow.ExpiresAt
+		if tx.FromID != escrow.Payee && !(tx.FromID == escrow.Payer && expired) {
+			return errors.New("transaction invalid, only the payee or the payer after expiry can refund the escrow")
+		}
+	}
+
+	return nil
+}
+
+// applyEscrow moves the funds for a validated escrow operation. The caller
+// must hold the lock.
+func (db *Database) applyEscrow(tx BlockTx, op EscrowOp) {
+	switch op.Op {
+	case EscrowCreate:
+		from := db.accounts.get(tx.FromID)
+		from.Balance -= tx.Value
+		db.accounts.set(tx.FromID, from)
+
+		escrowID := EscrowAccountID(tx.FromID, tx.Nonce)
+		account := newAccount(escrowID, tx.Value)
+		account.Escrow = &Escrow{
+			Payer:     tx.FromID,
+			Payee:     tx.ToID,
+			ExpiresAt: op.ExpiresAt,
+		}
+		db.accounts.set(escrowID, account)
+
+	case EscrowRelease, EscrowRefund:
+		account := db.accounts.get(tx.ToID)
+
+		partyID := account.Escrow.Payee
+		if op.Op == EscrowRefund {
+			partyID = account.Escrow.Payer
+		}
+
+		party, exists := db.accounts.lookup(partyID)
+		if !exists {
+			party = newAccount(partyID, 0)
+		}
+		party.Balance += account.Balance
+		db.accounts.set(partyID, party)
+
+		db.accounts.remove(tx.ToID)
+	}
+}
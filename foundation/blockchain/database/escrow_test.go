@@ -0,0 +1,157 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_Escrow(t *testing.T) {
+	const (
+		miner = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+		payer = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		payee = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	)
+
+	type table struct {
+		name    string
+		op      string
+		blockN  uint64
+		final   map[database.AccountID]uint64
+		success bool
+	}
+
+	tt := []table{
+		{
+			name:    "release",
+			op:      database.EscrowRelease,
+			blockN:  2,
+			final:   map[database.AccountID]uint64{payer: 900, payee: 100},
+			success: true,
+		},
+		{
+			name:    "refundearly",
+			op:      database.EscrowRefund,
+			blockN:  2,
+			final:   map[database.AccountID]uint64{payer: 900, payee: 0},
+			success: false,
+		},
+		{
+			name:    "refundexpired",
+			op:      database.EscrowRefund,
+			blockN:  6,
+			final:   map[database.AccountID]uint64{payer: 1000, payee: 0},
+			success: true,
+		},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			db, err := database.New(genesis.Genesis{ChainID: 1, Balances: map[string]uint64{payer: 1000}}, MockStorage{}, nil)
+			if err != nil {
+				t.Fatalf("Should be able to open database: %v", err)
+			}
+
+			create, err := database.EscrowOp{Op: database.EscrowCreate, ExpiresAt: 5}.Data()
+			if err != nil {
+				t.Fatalf("Should be able to encode the escrow operation: %v", err)
+			}
+
+			blockTx, err := sign(database.Tx{ChainID: 1, Nonce: 1, FromID: payer, ToID: payee, Value: 100, Data: create}, 0)
+			if err != nil {
+				t.Fatalf("Should be able to sign transaction: %v", err)
+			}
+
+			block := database.Block{Header: database.BlockHeader{Number: 1, BeneficiaryID: miner}}
+			if err := db.ApplyTransaction(block, blockTx); err != nil {
+				t.Fatalf("Should be able to create the escrow: %v", err)
+			}
+
+			escrowID := database.EscrowAccountID(payer, 1)
+			account, err := db.Query(escrowID)
+			if err != nil || account.Balance != 100 || account.Escrow == nil {
+				t.Fatalf("Should have an escrow account holding the value: %+v", account)
+			}
+
+			data, err := database.EscrowOp{Op: tst.op}.Data()
+			if err != nil {
+				t.Fatalf("Should be able to encode the escrow operation: %v", err)
+			}
+
+			blockTx, err = sign(database.Tx{ChainID: 1, Nonce: 2, FromID: payer, ToID: escrowID, Data: data}, 0)
+			if err != nil {
+				t.Fatalf("Should be able to sign transaction: %v", err)
+			}
+
+			block.Header.Number = tst.blockN
+			err = db.ApplyTransaction(block, blockTx)
+			if (err == nil) != tst.success {
+				t.Logf("got: %v", err)
+				t.Logf("exp: success %v", tst.success)
+				t.Fatalf("Should get the expected escrow result.")
+			}
+
+			for accountID, exp := range tst.final {
+				account, _ := db.Query(accountID)
+				if account.Balance != exp {
+					t.Logf("got: %d", account.Balance)
+					t.Logf("exp: %d", exp)
+					t.Errorf("Should have correct balance for %s.", accountID)
+				}
+			}
+
+			if _, err := db.Query(escrowID); tst.success && err == nil {
+				t.Fatalf("Should have removed the escrow account.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Vesting(t *testing.T) {
+	const (
+		from = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		to   = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	)
+
+	gen := genesis.Genesis{
+		ChainID:  1,
+		Balances: map[string]uint64{from: 1000},
+		Vesting:  map[string]genesis.Vesting{from: {Locked: 800, StartBlock: 10, EndBlock: 20}},
+	}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	block := database.Block{Header: database.BlockHeader{Number: 5, BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"}}
+
+	blockTx, err := sign(database.Tx{ChainID: 1, Nonce: 1, FromID: from, ToID: to, Value: 300}, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	if err := db.ApplyTransaction(block, blockTx); err == nil {
+		t.Fatalf("Should not be able to spend the locked balance.")
+	}
+
+	// Half the locked balance is released by block 15.
+	block.Header.Number = 15
+	if err := db.ApplyTransaction(block, blockTx); err != nil {
+		t.Fatalf("Should be able to spend the released balance: %v", err)
+	}
+
+	account, err := db.Query(from)
+	if err != nil {
+		t.Fatalf("Should be able to query the account: %v", err)
+	}
+
+	if account.Balance != 700 || account.Spendable(15) != 300 {
+		t.Logf("got: %d %d", account.Balance, account.Spendable(15))
+		t.Logf("exp: %d %d", 700, 300)
+		t.Fatalf("Should have the correct spendable balance.")
+	}
+}
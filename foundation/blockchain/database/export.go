@@ -0,0 +1,164 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+)
+
+// StateVersion is the version of the state snapshot format written by
+// ExportState. ImportState only reads snapshots with this version.
+const StateVersion = 1
+
+// StateSnapshot represents the accounts after the specified block was
+// applied in a portable form. The state root is the merkle root of the
+// accounts so a snapshot can be checked before it's trusted.
+type StateSnapshot struct {
+	Version   int       `json:"version"`
+	ChainID   uint16    `json:"chain_id"`
+	Block     uint64    `json:"block"`
+	BlockHash string    `json:"block_hash,omitempty"` // Not set for the genesis state.
+	StateRoot string    `json:"state_root"`
+	Supply    uint64    `json:"supply"`
+	Accounts  []Account `json:"accounts"` // Sorted by account id.
+}
+
+// =============================================================================
+
+// ExportState writes the accounts after the specified block was applied as
+// a versioned JSON snapshot. Block 0 is the genesis state. The state of a
+// block before the latest block is replayed from genesis, so the walk stops
+// with an error if the context is cancelled.
+func (db *Database) ExportState(ctx context.Context, w io.Writer, blockNum uint64) error {
+	snapshot, err := db.stateSnapshot(ctx, blockNum)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(snapshot)
+}
+
+// ImportState reads a snapshot written by ExportState and replaces the
+// accounts with the ones in the snapshot. The snapshot must be for this
+// chain and for the latest block in the database, and its accounts must
+// match its state root.
+func (db *Database) ImportState(r io.Reader) error {
+	snapshot, err := ReadStateSnapshot(r)
+	if err != nil {
+		return err
+	}
+
+	if snapshot.ChainID != db.genesis.ChainID {
+		return fmt.Errorf("state snapshot is for chain %d, database is for chain %d", snapshot.ChainID, db.genesis.ChainID)
+	}
+
+	accounts := make(map[AccountID]Account, len(snapshot.Accounts))
+	for _, account := range snapshot.Accounts {
+		accounts[account.AccountID] = account
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	latest := db.latestBlock
+	if snapshot.Block != latest.Header.Number {
+		return fmt.Errorf("state snapshot is for block %d, database is at block %d", snapshot.Block, latest.Header.Number)
+	}
+
+	if snapshot.Block > 0 && snapshot.BlockHash != latest.Hash() {
+		return fmt.Errorf("state snapshot is for block hash %s, database has %s", snapshot.BlockHash, latest.Hash())
+	}
+
+	// Changes made outside of a delta can't be rolled back.
+	db.undo = nil
+	db.accounts.replace(newAccountSet(accounts))
+	db.supply = snapshot.Supply
+
+	return nil
+}
+
+// ReadStateSnapshot decodes a snapshot written by ExportState and checks the
+// accounts match its state root.
+func ReadStateSnapshot(r io.Reader) (StateSnapshot, error) {
+	var snapshot StateSnapshot
+	if err := json.NewDecoder(r).Decode(&snapshot); err != nil {
+		return StateSnapshot{}, fmt.Errorf("decoding state snapshot: %w", err)
+	}
+
+	if snapshot.Version != StateVersion {
+		return StateSnapshot{}, fmt.Errorf("state snapshot version %d is not supported, need %d", snapshot.Version, StateVersion)
+	}
+
+	accounts := make([]Account, len(snapshot.Accounts))
+	copy(accounts, snapshot.Accounts)
+	sort.Sort(byAccount(accounts))
+
+	for i := 1; i < len(accounts); i++ {
+		if accounts[i].AccountID == accounts[i-1].AccountID {
+			return StateSnapshot{}, errcode.Errorf(errcode.StorageCorrupt, "state snapshot has account %s more than once", accounts[i].AccountID)
+		}
+	}
+
+	if root := stateRoot(accounts); root != snapshot.StateRoot {
+		return StateSnapshot{}, errcode.Errorf(errcode.StorageCorrupt, "state snapshot accounts don't match its state root, got %s, exp %s", root, snapshot.StateRoot)
+	}
+	snapshot.Accounts = accounts
+
+	return snapshot, nil
+}
+
+// =============================================================================
+
+// stateSnapshot returns the snapshot of the accounts after the specified
+// block was applied.
+func (db *Database) stateSnapshot(ctx context.Context, blockNum uint64) (StateSnapshot, error) {
+	db.mu.RLock()
+	latest := db.latestBlock
+	accounts := db.accounts.snapshot()
+	supply := db.supply
+	db.mu.RUnlock()
+
+	if blockNum > latest.Header.Number {
+		return StateSnapshot{}, errcode.Errorf(errcode.NotFound, "block %d is after the latest block %d", blockNum, latest.Header.Number)
+	}
+
+	snapshot := StateSnapshot{
+		Version: StateVersion,
+		ChainID: db.genesis.ChainID,
+		Block:   blockNum,
+	}
+
+	switch {
+	case blockNum == latest.Header.Number:
+		accounts.ForEach(func(account Account) {
+			snapshot.Accounts = append(snapshot.Accounts, account)
+		})
+		sort.Sort(byAccount(snapshot.Accounts))
+		snapshot.Supply = supply
+		if blockNum > 0 {
+			snapshot.BlockHash = latest.Hash()
+		}
+
+	default:
+		pdb, err := db.replayTo(ctx, blockNum+1)
+		if err != nil {
+			return StateSnapshot{}, err
+		}
+		snapshot.Accounts = pdb.sortedAccounts()
+		snapshot.Supply = pdb.supply
+		if blockNum > 0 {
+			snapshot.BlockHash = pdb.latestBlock.Hash()
+		}
+	}
+
+	snapshot.StateRoot = stateRoot(snapshot.Accounts)
+
+	return snapshot, nil
+}
@@ -0,0 +1,108 @@
+package database_test
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ExportState(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	export := func(blockNum uint64) (string, database.StateSnapshot) {
+		var buf bytes.Buffer
+		if err := db.ExportState(context.Background(), &buf, blockNum); err != nil {
+			t.Fatalf("Should be able to export the state at block %d: %v", blockNum, err)
+		}
+
+		snapshot, err := database.ReadStateSnapshot(strings.NewReader(buf.String()))
+		if err != nil {
+			t.Fatalf("Should be able to read the state at block %d: %v", blockNum, err)
+		}
+
+		return buf.String(), snapshot
+	}
+
+	latest, snapshot := export(3)
+	if snapshot.Version != database.StateVersion || snapshot.StateRoot != db.HashState() || snapshot.BlockHash != db.LatestBlock().Hash() {
+		t.Logf("got: %+v", snapshot)
+		t.Fatalf("Should export the current state for the latest block.")
+	}
+
+	// The state after block 1 is the state block 2 was built on.
+	block2, err := db.GetBlock(2)
+	if err != nil {
+		t.Fatalf("Should be able to get block 2: %v", err)
+	}
+
+	if _, snapshot := export(1); snapshot.StateRoot != block2.Header.StateRoot {
+		t.Logf("got: %s", snapshot.StateRoot)
+		t.Logf("exp: %s", block2.Header.StateRoot)
+		t.Fatalf("Should replay the state for an earlier block.")
+	}
+
+	if _, snapshot := export(0); len(snapshot.Accounts) != 1 || snapshot.BlockHash != "" {
+		t.Logf("got: %+v", snapshot)
+		t.Fatalf("Should export the genesis state for block 0.")
+	}
+
+	if err := db.ExportState(context.Background(), &bytes.Buffer{}, 4); !errcode.Is(err, errcode.NotFound) {
+		t.Fatalf("Should not export the state for a block that doesn't exist: %v", err)
+	}
+
+	// A second database for the same chain takes the snapshot for its latest
+	// block, but not one for an earlier block.
+	db2, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+	db2.Remove("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+
+	earlier, _ := export(2)
+	if err := db2.ImportState(strings.NewReader(earlier)); err == nil {
+		t.Fatalf("Should not import the state for a block the database isn't at.")
+	}
+
+	if err := db2.ImportState(strings.NewReader(latest)); err != nil {
+		t.Fatalf("Should be able to import the state: %v", err)
+	}
+
+	if db2.HashState() != db.HashState() {
+		t.Logf("got: %s", db2.HashState())
+		t.Logf("exp: %s", db.HashState())
+		t.Fatalf("Should restore the accounts from the snapshot.")
+	}
+
+	// A snapshot changed after it was exported is rejected.
+	tampered := strings.Replace(latest, `"Balance": `, `"Balance": 1`, 1)
+	if _, err := database.ReadStateSnapshot(strings.NewReader(tampered)); !errcode.Is(err, errcode.StorageCorrupt) {
+		t.Fatalf("Should reject a snapshot that doesn't match its state root: %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+// CORE NOTE: A fork genesis starts a new chain from the accounts of this
+// chain at a block, for a planned network restart or a spinoff. Only the
+// balances, the bonded stake and what's left of the vesting schedules carry
+// over. Nonces start over, immature mining rewards can be spent right away,
+// and escrows and registered names are released to the balance holding them.
+// The settings in effect at the block are used, with the block numbers that
+// are still to come moved so they're counted from the new genesis.
+
+// ForkGenesis returns a genesis for a new chain starting from the accounts
+// after the specified block was applied. The chain id is kept, so it should
+// be changed unless the new chain replaces this one.
+func (db *Database) ForkGenesis(ctx context.Context, blockNum uint64) (genesis.Genesis, error) {
+	snapshot, err := db.stateSnapshot(ctx, blockNum)
+	if err != nil {
+		return genesis.Genesis{}, err
+	}
+
+	gen := db.GenesisAt(blockNum + 1)
+
+	fork := gen
+	fork.MiningReward = gen.MiningRewardAt(blockNum+1, 0)
+	fork.Balances = make(map[string]uint64)
+	fork.Vesting = nil
+	fork.Bonds = nil
+	fork.Upgrades = forkUpgrades(gen.Upgrades, blockNum)
+
+	if blockNum > 0 {
+		block, err := db.GetBlock(blockNum)
+		if err != nil {
+			return genesis.Genesis{}, err
+		}
+
+		fork.Date = time.UnixMilli(int64(block.Header.TimeStamp)).UTC()
+		if gen.BaseFee > 0 {
+			fork.BaseFee = block.Header.BaseFee
+		}
+	}
+
+	if gen.CanonicalBlock > 0 {
+		fork.CanonicalBlock = forkBlock(gen.CanonicalBlock, blockNum, 1)
+	}
+
+	if gen.Gas != nil {
+		gas := *gen.Gas
+		gas.Block = forkBlock(gas.Block, blockNum, 0)
+		fork.Gas = &gas
+	}
+
+	if len(gen.Forks) > 0 {
+		fork.Forks = make(map[string]uint64, len(gen.Forks))
+		for name, block := range gen.Forks {
+			fork.Forks[name] = forkBlock(block, blockNum, 1)
+		}
+	}
+
+	for _, account := range snapshot.Accounts {
+		balance := account.Balance + account.Bonded + account.Unbonding
+		if balance == 0 {
+			continue
+		}
+
+		accountStr := string(account.AccountID)
+		fork.Balances[accountStr] = balance
+
+		if account.Bonded > 0 {
+			if fork.Bonds == nil {
+				fork.Bonds = make(map[string]uint64)
+			}
+			fork.Bonds[accountStr] = account.Bonded
+		}
+
+		if account.Vesting == nil {
+			continue
+		}
+
+		vesting, locked := forkVesting(*account.Vesting, blockNum)
+		if !locked {
+			continue
+		}
+
+		if fork.Vesting == nil {
+			fork.Vesting = make(map[string]genesis.Vesting)
+		}
+		fork.Vesting[accountStr] = vesting
+	}
+
+	return fork, nil
+}
+
+// =============================================================================
+
+// forkBlock returns the block number counted from the fork genesis for the
+// block number counted from the original genesis. A block at or before the
+// fork has already taken effect and the activated block number is returned.
+func forkBlock(block uint64, blockNum uint64, activated uint64) uint64 {
+	if block <= blockNum {
+		return activated
+	}
+
+	return block - blockNum
+}
+
+// forkUpgrades returns the block header versions for the fork genesis. The
+// version in effect at the fork is used from the first block.
+func forkUpgrades(upgrades []genesis.Upgrade, blockNum uint64) []genesis.Upgrade {
+	var fork []genesis.Upgrade
+	for _, upgrade := range upgrades {
+		upgrade.Block = forkBlock(upgrade.Block, blockNum, 1)
+
+		// An upgrade already in effect replaces the one before it.
+		if n := len(fork); n > 0 && fork[n-1].Block == upgrade.Block {
+			fork = fork[:n-1]
+		}
+		fork = append(fork, upgrade)
+	}
+
+	return fork
+}
+
+// forkVesting returns what's left of the vesting schedule for the fork
+// genesis, and false if nothing is locked anymore. A schedule already
+// releasing the balance continues from the fork at the same pace.
+func forkVesting(vesting genesis.Vesting, blockNum uint64) (genesis.Vesting, bool) {
+	locked := vesting.LockedAt(blockNum)
+	if locked == 0 {
+		return genesis.Vesting{}, false
+	}
+
+	fork := genesis.Vesting{
+		Locked:     locked,
+		StartBlock: forkBlock(vesting.StartBlock, blockNum, 0),
+		EndBlock:   forkBlock(vesting.EndBlock, blockNum, 0),
+	}
+
+	return fork, true
+}
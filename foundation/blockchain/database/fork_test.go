@@ -0,0 +1,90 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ForkGenesis(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	const sender = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+
+	gen := genesis.Genesis{
+		ChainID:         1,
+		Difficulty:      1,
+		MiningReward:    700,
+		HalvingInterval: 2,
+		Balances:        map[string]uint64{sender: 1000},
+		Vesting:         map[string]genesis.Vesting{sender: {Locked: 500, StartBlock: 0, EndBlock: 10}},
+		Upgrades:        []genesis.Upgrade{{Version: database.BlockVersionSHA3, Block: 2}},
+		Gas:             &genesis.GasSchedule{Block: 10, Base: 1},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	fork, err := db.ForkGenesis(context.Background(), 3)
+	if err != nil {
+		t.Fatalf("Should be able to fork the genesis: %v", err)
+	}
+
+	// The settings still to come are counted from the fork.
+	if fork.MiningReward != 350 || fork.Gas.Block != 7 || len(fork.Upgrades) != 1 || fork.Upgrades[0].Block != 1 {
+		t.Logf("got: %+v", fork)
+		t.Fatalf("Should move the settings to the fork.")
+	}
+
+	if exp := (genesis.Vesting{Locked: 350, StartBlock: 0, EndBlock: 7}); fork.Vesting[sender] != exp {
+		t.Logf("got: %+v", fork.Vesting[sender])
+		t.Logf("exp: %+v", exp)
+		t.Fatalf("Should keep what's left of the vesting schedule.")
+	}
+
+	if gen.Upgrades[0].Block != 2 {
+		t.Fatalf("Should not change the original genesis.")
+	}
+
+	storage2, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db2, err := database.New(fork, storage2, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open a database with the fork genesis: %v", err)
+	}
+
+	db.Snapshot().ForEach(func(account database.Account) {
+		got, err := db2.Query(account.AccountID)
+		if err != nil || got.Balance != account.Balance || got.Nonce != 0 {
+			t.Logf("got: %+v", got)
+			t.Logf("exp: %+v", account)
+			t.Fatalf("Should start the account %s with its balance.", account.AccountID)
+		}
+	})
+
+	// An upgrade after the fork keeps its place.
+	fork, err = db.ForkGenesis(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("Should be able to fork the genesis: %v", err)
+	}
+
+	if fork.Upgrades[0].Block != 1 || fork.Gas.Block != 9 {
+		t.Logf("got: %+v", fork)
+		t.Fatalf("Should move the settings to the fork.")
+	}
+}
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+// Set of governance operations that can be carried in the transaction data.
+const (
+	GovPropose = "propose"
+	GovVote    = "vote"
+)
+
+// GovOp represents a governance operation carried in the transaction data. A
+// propose operation names the parameter, the new value and the block the
+// change activates at. A vote operation names the proposal being voted for.
+type GovOp struct {
+	Op         string `json:"gov"`
+	Param      string `json:"param,omitempty"`
+	Value      uint64 `json:"value,omitempty"`
+	ActivateAt uint64 `json:"activate_at,omitempty"`
+	ProposalID string `json:"proposal,omitempty"`
+}
+
+// Data returns the encoded operation for use as transaction data.
+func (op GovOp) Data() ([]byte, error) {
+	return json.Marshal(op)
+}
+
+// ParseGovOp checks the transaction data for a governance operation.
+func ParseGovOp(data []byte) (GovOp, bool) {
+	if len(data) == 0 || data[0] != '{' {
+		return GovOp{}, false
+	}
+
+	var op GovOp
+	if err := json.Unmarshal(data, &op); err != nil {
+		return GovOp{}, false
+	}
+
+	switch op.Op {
+	case GovPropose, GovVote:
+		return op, true
+	}
+
+	return GovOp{}, false
+}
+
+// ProposalID returns the id for the proposal submitted by the specified
+// proposer and nonce.
+func ProposalID(proposer AccountID, nonce uint64) string {
+	return signature.Hash(struct {
+		Proposer AccountID
+		Nonce    uint64
+	}{proposer, nonce})
+}
+
+// =============================================================================
+
+// Proposal represents a parameter change submitted by a governor. The change
+// is approved once a majority of the governors vote for it and is applied to
+// every block from the activation block on.
+type Proposal struct {
+	ID         string      `json:"id"`
+	Proposer   AccountID   `json:"proposer"`
+	Param      string      `json:"param"`
+	Value      uint64      `json:"value"`
+	ActivateAt uint64      `json:"activate_at"`
+	Votes      []AccountID `json:"votes"`
+	Approved   bool        `json:"approved"`
+}
+
+// governance maintains the proposals replayed from the blockchain.
+type governance struct {
+	proposals map[string]Proposal
+	approved  []Proposal
+}
+
+// newGovernance constructs governance with no proposals.
+func newGovernance() *governance {
+	return &governance{
+		proposals: make(map[string]Proposal),
+	}
+}
+
+// clone returns a copy of the governance that can be changed separately.
+// Proposals are values that are never changed in place so they can be shared.
+func (g *governance) clone() *governance {
+	proposals := make(map[string]Proposal, len(g.proposals))
+	for id, proposal := range g.proposals {
+		proposals[id] = proposal
+	}
+
+	approved := make([]Proposal, len(g.approved))
+	copy(approved, g.approved)
+
+	return &governance{
+		proposals: proposals,
+		approved:  approved,
+	}
+}
+
+// genesisAt returns the genesis with the approved changes activated at or
+// before the specified block applied. The caller must hold the lock.
+func (db *Database) genesisAt(blockNum uint64) genesis.Genesis {
+	gen := db.genesis
+	for _, proposal := range db.gov.approved {
+		if proposal.ActivateAt > blockNum {
+			break
+		}
+
+		// The value was validated when the proposal was submitted.
+		if changed, err := gen.WithParam(proposal.Param, proposal.Value); err == nil {
+			gen = changed
+		}
+	}
+
+	return gen
+}
+
+// validateGovernance checks the governance operation can be applied by the
+// sender of the transaction. The caller must hold the lock.
+func (db *Database) validateGovernance(block Block, tx BlockTx, op GovOp) error {
+	if !db.genesis.IsGovernor(string(tx.FromID)) {
+		return fmt.Errorf("transaction invalid, %s is not a governor", tx.FromID)
+	}
+
+	switch op.Op {
+	case GovPropose:
+		if _, err := db.genesis.WithParam(op.Param, op.Value); err != nil {
+			return fmt.Errorf("transaction invalid, %w", err)
+		}
+
+		if op.ActivateAt <= block.Header.Number {
+			return fmt.Errorf("transaction invalid, activation block %d has passed", op.ActivateAt)
+		}
+
+	case GovVote:
+		proposal, exists := db.gov.proposals[op.ProposalID]
+		if !exists {
+			return fmt.Errorf("transaction invalid, proposal %s doesn't exist", op.ProposalID)
+		}
+
+		if proposal.ActivateAt <= block.Header.Number {
+			return errors.New("transaction invalid, voting for the proposal has closed")
+		}
+
+		for _, voter := range proposal.Votes {
+			if voter == tx.FromID {
+				return errors.New("transaction invalid, governor already voted for the proposal")
+			}
+		}
+	}
+
+	return nil
+}
+
+// applyGovernance records a validated governance operation. The proposer
+// votes for their own proposal. The caller must hold the lock.
+func (db *Database) applyGovernance(tx BlockTx, op GovOp) {
+	var proposal Proposal
+
+	switch op.Op {
+	case GovPropose:
+		proposal = Proposal{
+			ID:         ProposalID(tx.FromID, tx.Nonce),
+			Proposer:   tx.FromID,
+			Param:      op.Param,
+			Value:      op.Value,
+			ActivateAt: op.ActivateAt,
+		}
+
+	case GovVote:
+		proposal = db.gov.proposals[op.ProposalID]
+	}
+
+	proposal.Votes = append(proposal.Votes[:len(proposal.Votes):len(proposal.Votes)], tx.FromID)
+
+	if !proposal.Approved && len(proposal.Votes)*2 > len(db.genesis.Governors) {
+		proposal.Approved = true
+		db.gov.approved = append(db.gov.approved, proposal)
+
+		// Changes are applied in activation order with the id breaking ties
+		// so every node ends up with the same parameters.
+		sort.Slice(db.gov.approved, func(i, j int) bool {
+			a, b := db.gov.approved[i], db.gov.approved[j]
+			if a.ActivateAt != b.ActivateAt {
+				return a.ActivateAt < b.ActivateAt
+			}
+			return a.ID < b.ID
+		})
+	}
+
+	db.gov.proposals[proposal.ID] = proposal
+}
+
+// Proposals returns the governance proposals sorted by activation block.
+func (db *Database) Proposals() []Proposal {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	proposals := make([]Proposal, 0, len(db.gov.proposals))
+	for _, proposal := range db.gov.proposals {
+		proposals = append(proposals, proposal)
+	}
+
+	sort.Slice(proposals, func(i, j int) bool {
+		if proposals[i].ActivateAt != proposals[j].ActivateAt {
+			return proposals[i].ActivateAt < proposals[j].ActivateAt
+		}
+		return proposals[i].ID < proposals[j].ID
+	})
+
+	return proposals
+}
+
+// GenesisAt returns the genesis settings in effect for the specified block
+// number with the approved governance changes applied.
+func (db *Database) GenesisAt(blockNum uint64) genesis.Genesis {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return db.genesisAt(blockNum)
+}
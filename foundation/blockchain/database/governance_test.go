@@ -0,0 +1,107 @@
+package database_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_Governance(t *testing.T) {
+	const (
+		gov1  = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		gov2  = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+		gov3  = "0x90F8bf6A479f320ead074411a4B0e7944Ea8c9C1"
+		other = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+	)
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{gov1: 1000, gov2: 1000, gov3: 1000, other: 1000},
+		Governors:    []string{gov1, gov2, gov3},
+	}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	nonces := make(map[database.AccountID]uint64)
+
+	// apply submits the governance operation from the account into the
+	// specified block. The signature isn't checked when applying.
+	apply := func(from database.AccountID, blockNum uint64, op database.GovOp) error {
+		data, err := op.Data()
+		if err != nil {
+			t.Fatalf("Should be able to encode the governance operation: %v", err)
+		}
+
+		to := database.AccountID(other)
+		if from == other {
+			to = gov1
+		}
+
+		blockTx, err := sign(database.Tx{ChainID: 1, Nonce: nonces[from] + 1, FromID: from, ToID: to, Data: data}, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block := database.Block{Header: database.BlockHeader{Number: blockNum, BeneficiaryID: other}}
+		if err := db.ApplyTransaction(block, blockTx); err != nil {
+			return err
+		}
+		nonces[from]++
+
+		return nil
+	}
+
+	propose := database.GovOp{Op: database.GovPropose, Param: genesis.ParamMiningReward, Value: 100, ActivateAt: 5}
+
+	if err := apply(other, 1, propose); err == nil {
+		t.Fatalf("Should not accept a proposal from a non governor.")
+	}
+
+	if err := apply(gov1, 1, database.GovOp{Op: database.GovPropose, Param: "difficulty", Value: 1, ActivateAt: 5}); err == nil {
+		t.Fatalf("Should not accept a proposal for an unknown parameter.")
+	}
+
+	if err := apply(gov1, 1, propose); err != nil {
+		t.Fatalf("Should be able to submit a proposal: %v", err)
+	}
+	proposalID := database.ProposalID(gov1, nonces[gov1])
+
+	if db.Proposals()[0].Approved {
+		t.Fatalf("Should not approve the proposal with one of three votes.")
+	}
+
+	vote := database.GovOp{Op: database.GovVote, ProposalID: proposalID}
+
+	if err := apply(gov1, 2, vote); err == nil {
+		t.Fatalf("Should not accept a second vote from the same governor.")
+	}
+
+	if err := apply(gov2, 2, vote); err != nil {
+		t.Fatalf("Should be able to vote for the proposal: %v", err)
+	}
+
+	if !db.Proposals()[0].Approved {
+		t.Fatalf("Should approve the proposal with two of three votes.")
+	}
+
+	if err := apply(gov3, 5, vote); err == nil {
+		t.Fatalf("Should not accept a vote once the proposal activated.")
+	}
+
+	if got := db.GenesisAt(4).MiningReward; got != 700 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 700)
+		t.Fatalf("Should keep the mining reward before activation.")
+	}
+
+	if got := db.MiningReward(5); got != 100 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 100)
+		t.Fatalf("Should change the mining reward at activation.")
+	}
+}
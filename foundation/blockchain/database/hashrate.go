@@ -0,0 +1,64 @@
+package database
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// hashRateWeight is the weight given to the latest measurement when it's
+// blended into the hash rate, so a single slow or fast run doesn't swing it.
+const hashRateWeight = 0.3
+
+// HashRate measures how fast blocks are hashed during proof of work so the
+// time it takes to solve a block at a difficulty can be estimated. The zero
+// value is ready to use.
+type HashRate struct {
+	mu   sync.Mutex
+	rate float64 // Hashes per second.
+}
+
+// Record adds the measurement of a mining operation to the hash rate.
+func (hr *HashRate) Record(attempts uint64, elapsed time.Duration) {
+	if attempts == 0 || elapsed <= 0 {
+		return
+	}
+
+	rate := float64(attempts) / elapsed.Seconds()
+
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if hr.rate == 0 {
+		hr.rate = rate
+		return
+	}
+
+	hr.rate = hashRateWeight*rate + (1-hashRateWeight)*hr.rate
+}
+
+// Rate returns the number of hashes per second, 0 if nothing was measured.
+func (hr *HashRate) Rate() float64 {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	return hr.rate
+}
+
+// Expected returns the average time it takes to solve a block at the
+// difficulty. False is returned if the hash rate hasn't been measured yet.
+func (hr *HashRate) Expected(difficulty uint16) (time.Duration, bool) {
+	rate := hr.Rate()
+	if rate == 0 {
+		return 0, false
+	}
+
+	// Each unit of difficulty is another leading zero in the hex encoded
+	// hash, so on average 16^difficulty hashes are needed.
+	seconds := math.Pow(16, float64(difficulty)) / rate
+	if seconds >= float64(math.MaxInt64)/float64(time.Second) {
+		return time.Duration(math.MaxInt64), true
+	}
+
+	return time.Duration(seconds * float64(time.Second)), true
+}
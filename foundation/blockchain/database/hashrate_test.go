@@ -0,0 +1,42 @@
+package database_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+func Test_HashRate(t *testing.T) {
+	var hr database.HashRate
+
+	if _, measured := hr.Expected(2); measured {
+		t.Fatalf("Should not have an expected time before the hash rate is measured.")
+	}
+
+	hr.Record(1000, time.Second)
+	if rate := hr.Rate(); rate != 1000 {
+		t.Logf("got: %f", rate)
+		t.Logf("exp: %f", 1000.0)
+		t.Fatalf("Should use the first measurement as the hash rate.")
+	}
+
+	// On average 16^2 hashes are needed to solve a block at difficulty 2.
+	expected, measured := hr.Expected(2)
+	if !measured || expected != 256*time.Millisecond {
+		t.Logf("got: %v", expected)
+		t.Logf("exp: %v", 256*time.Millisecond)
+		t.Fatalf("Should estimate the time to solve a block.")
+	}
+
+	hr.Record(2000, time.Second)
+	if rate := hr.Rate(); rate <= 1000 || rate >= 2000 {
+		t.Logf("got: %f", rate)
+		t.Fatalf("Should blend new measurements into the hash rate.")
+	}
+
+	if expected, _ := hr.Expected(64); expected <= 0 {
+		t.Logf("got: %v", expected)
+		t.Fatalf("Should not overflow at a large difficulty.")
+	}
+}
@@ -0,0 +1,172 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+// Set of name operations that can be carried in the transaction data.
+const (
+	NameRegister = "register"
+	NameRelease  = "release"
+)
+
+// Set of limits on the length of a registered name.
+const (
+	minNameLength = 3
+	maxNameLength = 32
+)
+
+// ErrNameNotFound is returned when a name isn't registered.
+var ErrNameNotFound = errcode.New(errcode.NotFound, "name not found")
+
+// CORE NOTE: A name is stored in an account derived from the name, the same
+// way an escrow is stored in an account derived from its payer. The record
+// is part of the state root and rolls back with the rest of the accounts on
+// a reorg without any extra bookkeeping. Names are first come first served
+// and the owner can release a name so someone else can register it.
+
+// Name represents the owner of a registered name. Sending to the name sends
+// to the owner.
+type Name struct {
+	Name  string
+	Owner AccountID
+}
+
+// NameOp represents a name operation carried in the transaction data. The
+// transaction is sent to the account for the name with no value.
+type NameOp struct {
+	Op   string `json:"names"`
+	Name string `json:"name"`
+}
+
+// Data returns the encoded operation for use as transaction data.
+func (op NameOp) Data() ([]byte, error) {
+	return json.Marshal(op)
+}
+
+// ParseNameOp checks the transaction data for a name operation.
+func ParseNameOp(data []byte) (NameOp, bool) {
+	if len(data) == 0 || data[0] != '{' {
+		return NameOp{}, false
+	}
+
+	var op NameOp
+	if err := json.Unmarshal(data, &op); err != nil {
+		return NameOp{}, false
+	}
+
+	switch op.Op {
+	case NameRegister, NameRelease:
+		return op, true
+	}
+
+	return NameOp{}, false
+}
+
+// NameAccountID returns the account that holds the record for the name.
+func NameAccountID(name string) AccountID {
+	hash := signature.Hash(struct {
+		Name string
+	}{name})
+
+	// Use the last 20 bytes of the hash like an address.
+	return AccountID("0x" + hash[len(hash)-40:])
+}
+
+// ValidateName checks the name can be registered. Names are 3 to 32 lower
+// case letters, digits and hyphens and can't be mistaken for an account.
+func ValidateName(name string) error {
+	if len(name) < minNameLength || len(name) > maxNameLength {
+		return fmt.Errorf("name must be %d to %d characters", minNameLength, maxNameLength)
+	}
+
+	for _, c := range name {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') && c != '-' {
+			return fmt.Errorf("name has invalid character %q", c)
+		}
+	}
+
+	if name[0] == '-' || name[len(name)-1] == '-' {
+		return errors.New("name can't start or end with a hyphen")
+	}
+
+	if strings.HasPrefix(name, "0x") || strings.HasPrefix(name, AccountHRP+"1") {
+		return errors.New("name can't look like an account")
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Resolve returns the account that owns the registered name.
+func (db *Database) Resolve(name string) (AccountID, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	record := db.accounts.get(NameAccountID(name)).Name
+	if record == nil || record.Name != name {
+		return "", ErrNameNotFound
+	}
+
+	return record.Owner, nil
+}
+
+// validateName checks the name operation can be applied by the sender of the
+// transaction. The caller must hold the lock.
+func (db *Database) validateName(tx BlockTx, op NameOp) error {
+	if err := ValidateName(op.Name); err != nil {
+		return fmt.Errorf("transaction invalid, %w", err)
+	}
+
+	if tx.Value != 0 {
+		return fmt.Errorf("transaction invalid, name %s can't carry a value", op.Op)
+	}
+
+	if tx.ToID != NameAccountID(op.Name) {
+		return fmt.Errorf("transaction invalid, name %s must be sent to %s", op.Op, NameAccountID(op.Name))
+	}
+
+	record := db.accounts.get(tx.ToID).Name
+
+	switch op.Op {
+	case NameRegister:
+		if record != nil {
+			return fmt.Errorf("transaction invalid, name %q is already registered", op.Name)
+		}
+
+	case NameRelease:
+		if record == nil || record.Name != op.Name {
+			return fmt.Errorf("transaction invalid, name %q is not registered", op.Name)
+		}
+
+		if tx.FromID != record.Owner {
+			return errors.New("transaction invalid, only the owner can release the name")
+		}
+	}
+
+	return nil
+}
+
+// applyName records or removes the name for a validated name operation. The
+// caller must hold the lock.
+func (db *Database) applyName(tx BlockTx, op NameOp) {
+	switch op.Op {
+	case NameRegister:
+		account := newAccount(tx.ToID, 0)
+		account.Name = &Name{
+			Name:  op.Name,
+			Owner: tx.FromID,
+		}
+		db.accounts.set(tx.ToID, account)
+
+	case NameRelease:
+		db.accounts.remove(tx.ToID)
+	}
+}
@@ -0,0 +1,118 @@
+package database_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_Names(t *testing.T) {
+	const (
+		miner = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+		alice = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+		bob   = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	)
+
+	db, err := database.New(genesis.Genesis{ChainID: 1, Balances: map[string]uint64{alice: 1000, bob: 1000}}, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// apply sends the name operation from the account with the nonce.
+	apply := func(op database.NameOp, fromID database.AccountID, nonce uint64, value uint64) error {
+		data, err := op.Data()
+		if err != nil {
+			t.Fatalf("Should be able to encode the name operation: %v", err)
+		}
+
+		tx := database.Tx{ChainID: 1, Nonce: nonce, FromID: fromID, ToID: database.NameAccountID(op.Name), Value: value, Data: data}
+		blockTx, err := sign(tx, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block := database.Block{Header: database.BlockHeader{Number: nonce, BeneficiaryID: miner}}
+		return db.ApplyTransaction(block, blockTx)
+	}
+
+	register := database.NameOp{Op: database.NameRegister, Name: "alice"}
+
+	if err := apply(database.NameOp{Op: database.NameRegister, Name: "0xalice"}, alice, 1, 0); err == nil {
+		t.Fatalf("Should not register a name that looks like an account.")
+	}
+
+	if err := apply(register, alice, 1, 10); err == nil {
+		t.Fatalf("Should not register a name with a value.")
+	}
+
+	if err := apply(register, alice, 1, 0); err != nil {
+		t.Fatalf("Should be able to register the name: %v", err)
+	}
+
+	accountID, err := db.Resolve("alice")
+	if err != nil {
+		t.Fatalf("Should be able to resolve the name: %v", err)
+	}
+
+	if accountID != alice {
+		t.Logf("got: %s", accountID)
+		t.Logf("exp: %s", alice)
+		t.Fatalf("Should resolve the name to the account that registered it.")
+	}
+
+	if err := apply(register, bob, 1, 0); err == nil {
+		t.Fatalf("Should not register a name that is taken.")
+	}
+
+	if err := apply(database.NameOp{Op: database.NameRelease, Name: "alice"}, bob, 1, 0); err == nil {
+		t.Fatalf("Should not release a name owned by another account.")
+	}
+
+	if err := apply(database.NameOp{Op: database.NameRelease, Name: "alice"}, alice, 2, 0); err != nil {
+		t.Fatalf("Should be able to release the name: %v", err)
+	}
+
+	if _, err := db.Resolve("alice"); !errors.Is(err, database.ErrNameNotFound) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", database.ErrNameNotFound)
+		t.Fatalf("Should not resolve a released name.")
+	}
+
+	if err := apply(register, bob, 1, 0); err != nil {
+		t.Fatalf("Should be able to register a released name: %v", err)
+	}
+
+	if accountID, _ := db.Resolve("alice"); accountID != bob {
+		t.Logf("got: %s", accountID)
+		t.Logf("exp: %s", bob)
+		t.Fatalf("Should resolve the name to the new owner.")
+	}
+}
+
+func Test_ValidateName(t *testing.T) {
+	tt := []struct {
+		name    string
+		success bool
+	}{
+		{"alice", true},
+		{"bob-42", true},
+		{"al", false},
+		{"Alice", false},
+		{"-alice", false},
+		{"alice_b", false},
+		{"0xabc", false},
+		{"ardan1abc", false},
+		{"abcdefghijklmnopqrstuvwxyz0123456", false},
+	}
+
+	for _, tst := range tt {
+		err := database.ValidateName(tst.name)
+		if (err == nil) != tst.success {
+			t.Logf("got: %v", err)
+			t.Logf("exp: %v", tst.success)
+			t.Fatalf("Should validate the name %q correctly.", tst.name)
+		}
+	}
+}
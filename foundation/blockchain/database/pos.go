@@ -0,0 +1,153 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+// CORE NOTE: Under PoS there is no work to prove. The proposer for the next
+// block is picked from the bonded validators with a probability equal to
+// their share of the total stake. The hash of the previous block seeds the
+// pick so every node arrives at the same proposer without talking to each
+// other. The proposer signs the block header and peers check the signer is
+// the account they expected to propose the block.
+
+// SelectProposer picks the validator to propose the block that follows the
+// block with the specified hash.
+func SelectProposer(prevBlockHash string, stakes map[AccountID]uint64) (AccountID, error) {
+	var total uint64
+	validators := make([]AccountID, 0, len(stakes))
+	for accountID, stake := range stakes {
+		if stake == 0 {
+			continue
+		}
+		validators = append(validators, accountID)
+		total += stake
+	}
+
+	if total == 0 {
+		return "", errors.New("no validators have stake bonded")
+	}
+
+	// Map iteration is random so the validators need a fixed order.
+	sort.Slice(validators, func(i, j int) bool {
+		return validators[i] < validators[j]
+	})
+
+	// Turn the previous block hash into a number within the total stake.
+	seed := sha256.Sum256([]byte(prevBlockHash))
+	pick := new(big.Int).Mod(new(big.Int).SetBytes(seed[:]), new(big.Int).SetUint64(total)).Uint64()
+
+	// Walk the validators until the pick falls within a validator's stake.
+	for _, accountID := range validators {
+		stake := stakes[accountID]
+		if pick < stake {
+			return accountID, nil
+		}
+		pick -= stake
+	}
+
+	return validators[len(validators)-1], nil
+}
+
+// =============================================================================
+
+// Sign uses the specified private key to sign the block header so peers can
+// verify who proposed the block.
+func (b *Block) Sign(chainID uint16, privateKey *ecdsa.PrivateKey) error {
+	signedHeader, err := b.Header.Sign(chainID, privateKey)
+	if err != nil {
+		return err
+	}
+
+	b.Signature = signature.SignatureString(signedHeader.V, signedHeader.R, signedHeader.S)
+
+	return nil
+}
+
+// Signer returns the account that signed the block for the specified chain.
+func (b Block) Signer(chainID uint16) (AccountID, error) {
+	signedHeader, err := b.SignedHeader()
+	if err != nil {
+		return "", err
+	}
+
+	return signedHeader.Signer(chainID)
+}
+
+// SignedHeader returns the block header along with the signature of the
+// validator who proposed the block.
+func (b Block) SignedHeader() (SignedHeader, error) {
+	if b.Signature == "" {
+		return SignedHeader{}, errors.New("block is not signed")
+	}
+
+	// A signature is 65 bytes in hex plus the chain id carried in the V value.
+	if len(b.Signature) < 2+65*2 {
+		return SignedHeader{}, errors.New("block signature is malformed")
+	}
+
+	v, r, s, err := signature.ToVRSFromHexSignature(b.Signature)
+	if err != nil {
+		return SignedHeader{}, err
+	}
+
+	signedHeader := SignedHeader{
+		Header: b.Header,
+		V:      v,
+		R:      r,
+		S:      s,
+	}
+
+	return signedHeader, nil
+}
+
+// =============================================================================
+
+// NextProposer returns the validator selected to propose the next block.
+func (db *Database) NextProposer() (AccountID, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	// When proposing the first block, the previous block's hash will be zero.
+	prevBlockHash := signature.ZeroHash
+	if db.latestBlock.Header.Number > 0 {
+		prevBlockHash = db.latestBlock.Hash()
+	}
+
+	return SelectProposer(prevBlockHash, db.bonded())
+}
+
+// ValidateProposer checks the block is signed by the validator selected to
+// propose it. The block must pass ValidateBlock first so the previous block
+// hash is known to match the latest block.
+func (db *Database) ValidateProposer(block Block) error {
+	signer, err := block.Signer(db.genesis.ChainID)
+	if err != nil {
+		return fmt.Errorf("block signature: %w", err)
+	}
+
+	if signer != block.Header.BeneficiaryID {
+		return fmt.Errorf("block signed by %s is not for the beneficiary %s", signer, block.Header.BeneficiaryID)
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	proposer, err := SelectProposer(block.Header.PrevBlockHash, db.bonded())
+	if err != nil {
+		return err
+	}
+
+	if signer != proposer {
+		return fmt.Errorf("%s is not the selected proposer, exp %s", signer, proposer)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package database_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"fmt"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func Test_SelectProposer(t *testing.T) {
+	const (
+		small = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+		large = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	)
+
+	stakes := map[database.AccountID]uint64{small: 100, large: 300}
+
+	picks := make(map[database.AccountID]int)
+	for i := 0; i < 4000; i++ {
+		hash := hashOf(i)
+
+		proposer, err := database.SelectProposer(hash, stakes)
+		if err != nil {
+			t.Fatalf("Should be able to select a proposer: %v", err)
+		}
+
+		again, _ := database.SelectProposer(hash, stakes)
+		if again != proposer {
+			t.Logf("got: %s", again)
+			t.Logf("exp: %s", proposer)
+			t.Fatalf("Should select the same proposer for the same hash.")
+		}
+
+		picks[proposer]++
+	}
+
+	// The large validator has three quarters of the stake.
+	if picks[large] < 2800 || picks[large] > 3200 {
+		t.Logf("got: %d", picks[large])
+		t.Logf("exp: %d", 3000)
+		t.Fatalf("Should select validators in proportion to their stake.")
+	}
+
+	if _, err := database.SelectProposer(hashOf(0), map[database.AccountID]uint64{small: 0}); err == nil {
+		t.Fatalf("Should not be able to select a proposer without stake.")
+	}
+}
+
+func Test_ValidateProposer(t *testing.T) {
+	keys := map[database.AccountID]string{
+		"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959",
+		feePayerID: "4f3edf983ac636a65a842ce7c78d9aa706d3b113bce9c46f30d7d21715b23b1d",
+	}
+
+	gen := genesis.Genesis{
+		ChainID:  1,
+		Balances: map[string]uint64{},
+		Bonds:    map[string]uint64{},
+	}
+	for accountID := range keys {
+		gen.Balances[string(accountID)] = 1000
+		gen.Bonds[string(accountID)] = 500
+	}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	if bonded := db.Bonded(); len(bonded) != 2 {
+		t.Logf("got: %v", bonded)
+		t.Fatalf("Should have the genesis bonds locked.")
+	}
+
+	proposer, err := db.NextProposer()
+	if err != nil {
+		t.Fatalf("Should be able to select the next proposer: %v", err)
+	}
+
+	var other database.AccountID
+	for accountID := range keys {
+		if accountID != proposer {
+			other = accountID
+		}
+	}
+
+	// propose creates the next block for the beneficiary signed with the
+	// key of the specified account.
+	propose := func(beneficiaryID database.AccountID, signer database.AccountID) database.Block {
+		blockTx, err := sign(database.Tx{ChainID: 1, Nonce: 1, FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: feePayerID, Value: 10}, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: beneficiaryID,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         []database.BlockTx{blockTx},
+			EvHandler:     func(v string, args ...any) {},
+		})
+		if err != nil {
+			t.Fatalf("Should be able to create the block: %v", err)
+		}
+
+		if err := block.Sign(1, loadKey(t, keys[signer])); err != nil {
+			t.Fatalf("Should be able to sign the block: %v", err)
+		}
+
+		return block
+	}
+
+	block := propose(proposer, proposer)
+	if err := db.ValidateProposer(block); err != nil {
+		t.Fatalf("Should accept a block signed by the selected proposer: %v", err)
+	}
+
+	// The signature needs to survive the trip through the encoding.
+	data, err := database.EncodeBlockData(database.NewBlockData(block))
+	if err != nil {
+		t.Fatalf("Should be able to encode the block: %v", err)
+	}
+
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode the block: %v", err)
+	}
+
+	decoded, err := database.ToBlock(blockData)
+	if err != nil {
+		t.Fatalf("Should be able to convert the block: %v", err)
+	}
+
+	if err := db.ValidateProposer(decoded); err != nil {
+		t.Fatalf("Should accept the decoded block: %v", err)
+	}
+
+	if err := db.ValidateProposer(propose(other, other)); err == nil {
+		t.Fatalf("Should not accept a block signed by a validator that wasn't selected.")
+	}
+
+	if err := db.ValidateProposer(propose(proposer, other)); err == nil {
+		t.Fatalf("Should not accept a block signed by an account that isn't the beneficiary.")
+	}
+
+	block.Signature = ""
+	if err := db.ValidateProposer(block); err == nil {
+		t.Fatalf("Should not accept a block that isn't signed.")
+	}
+}
+
+func Benchmark_SelectProposer(b *testing.B) {
+	stakes := make(map[database.AccountID]uint64)
+	for i := 0; i < 100; i++ {
+		stakes[database.AccountID(fmt.Sprintf("0x%040x", i))] = uint64(100 + i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := database.SelectProposer(hashOf(i), stakes); err != nil {
+			b.Fatalf("Should be able to select a proposer: %v", err)
+		}
+	}
+}
+
+// =============================================================================
+
+func hashOf(i int) string {
+	return fmt.Sprintf("0x%064x", i)
+}
+
+func loadKey(t *testing.T, hexKey string) *ecdsa.PrivateKey {
+	pk, err := crypto.HexToECDSA(hexKey)
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	return pk
+}
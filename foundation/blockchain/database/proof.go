@@ -0,0 +1,121 @@
+package database
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// AccountProof represents a merkle proof that an account held the specified
+// balance and nonce in the state committed to by a block's state root.
+type AccountProof struct {
+	Account     Account  `json:"account"`
+	BlockNumber uint64   `json:"block_number"`
+	StateRoot   string   `json:"state_root"`
+	Proof       []string `json:"proof"`
+	ProofOrder  []int64  `json:"proof_order"`
+}
+
+// =============================================================================
+
+// AccountProof generates a merkle proof of the specified account against the
+// state root of the specified block. A block's state root commits to the
+// state of the accounts the block was built on, which is the state after all
+// the previous blocks were applied. The state is replayed from genesis so
+// the walk stops with an error if the context is cancelled.
+func (db *Database) AccountProof(ctx context.Context, accountID AccountID, blockNum uint64) (AccountProof, error) {
+	block, err := db.GetBlock(blockNum)
+	if err != nil {
+		return AccountProof{}, err
+	}
+
+	// Replay the chain up to the block into a separate database.
+	pdb, err := db.replayTo(ctx, blockNum)
+	if err != nil {
+		return AccountProof{}, err
+	}
+
+	account, exists := pdb.accounts.lookup(accountID)
+	if !exists {
+		return AccountProof{}, fmt.Errorf("account %s doesn't exist at block %d", accountID, blockNum)
+	}
+
+	tree, err := merkle.NewTree(pdb.sortedAccounts())
+	if err != nil {
+		return AccountProof{}, err
+	}
+
+	if tree.RootHex() != block.Header.StateRoot {
+		return AccountProof{}, fmt.Errorf("block %d state root is not a merkle root", blockNum)
+	}
+
+	rawProof, order, err := tree.Proof(account)
+	if err != nil {
+		return AccountProof{}, err
+	}
+
+	proof := make([]string, len(rawProof))
+	for i, rp := range rawProof {
+		proof[i] = hexutil.Encode(rp)
+	}
+
+	accountProof := AccountProof{
+		Account:     account,
+		BlockNumber: blockNum,
+		StateRoot:   block.Header.StateRoot,
+		Proof:       proof,
+		ProofOrder:  order,
+	}
+
+	return accountProof, nil
+}
+
+// VerifyAccountProof checks the account in the proof hashes up to the
+// specified state root. The state root should come from a block header the
+// caller trusts and not from the proof itself.
+func VerifyAccountProof(proof AccountProof, stateRoot string) error {
+	if len(proof.Proof) != len(proof.ProofOrder) {
+		return errors.New("proof and proof order are not the same length")
+	}
+
+	hash, err := proof.Account.Hash()
+	if err != nil {
+		return err
+	}
+
+	for i, p := range proof.Proof {
+		sibling, err := hexutil.Decode(p)
+		if err != nil {
+			return fmt.Errorf("proof[%d]: %w", i, err)
+		}
+
+		var data []byte
+		switch proof.ProofOrder[i] {
+		case 0:
+			data = append(sibling, hash...)
+		case 1:
+			data = append(hash, sibling...)
+		default:
+			return fmt.Errorf("proof order[%d]: invalid order %d", i, proof.ProofOrder[i])
+		}
+
+		sum := sha256.Sum256(data)
+		hash = sum[:]
+	}
+
+	root, err := hexutil.Decode(stateRoot)
+	if err != nil {
+		return fmt.Errorf("state root: %w", err)
+	}
+
+	if !bytes.Equal(hash, root) {
+		return errors.New("account proof does not match the state root")
+	}
+
+	return nil
+}
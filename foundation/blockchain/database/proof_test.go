@@ -0,0 +1,67 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_AccountProof(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+			"0xbEE6ACE826eC3DE1B6349888B9151B92522F7F76": 500,
+			"0x6Fe6CF3c8fF57c58d24BfC869668F48BCbDb3BD9": 250,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	accountID := database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+
+	for blockNum := uint64(1); blockNum <= 3; blockNum++ {
+		proof, err := db.AccountProof(context.Background(), accountID, blockNum)
+		if err != nil {
+			t.Fatalf("Should be able to generate a proof for block %d: %v", blockNum, err)
+		}
+
+		block, err := db.GetBlock(blockNum)
+		if err != nil {
+			t.Fatalf("Should be able to get block %d: %v", blockNum, err)
+		}
+
+		if err := database.VerifyAccountProof(proof, block.Header.StateRoot); err != nil {
+			t.Fatalf("Should be able to verify the proof for block %d: %v", blockNum, err)
+		}
+
+		// Each block applies one transaction from the account.
+		if exp := 1000 - (blockNum-1)*(10+1); proof.Account.Balance != exp {
+			t.Logf("got: %d", proof.Account.Balance)
+			t.Logf("exp: %d", exp)
+			t.Fatalf("Should have the balance at block %d.", blockNum)
+		}
+
+		proof.Account.Balance++
+		if err := database.VerifyAccountProof(proof, block.Header.StateRoot); err == nil {
+			t.Fatalf("Should not be able to verify a proof with a changed balance.")
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package database
+
+import (
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+)
+
+// CORE NOTE: A raw transaction is a signed transaction in the versioned
+// binary encoding used for blocks, without the gas details a node adds when
+// the transaction enters its mempool. Everything needed to sign it is given
+// up front, so a wallet on a machine that never touches the network can sign
+// a transaction and hand the raw bytes to a machine that submits them.
+
+// RawTxArgs represents the details for building a transaction offline. The
+// nonce and chain id can't be looked up without a node so they are required.
+// The gas price is set by the node, the tip is what the sender offers on top.
+type RawTxArgs struct {
+	ChainID    uint16
+	Nonce      uint64
+	ToID       AccountID
+	Value      uint64
+	Tip        uint64
+	Data       []byte
+	ValidUntil uint64
+	Encoding   uint8
+}
+
+// SignRawTx constructs the transaction from the arguments, signs it with the
+// private key and returns the raw encoding. No network access is required.
+func SignRawTx(args RawTxArgs, privateKey *ecdsa.PrivateKey) ([]byte, error) {
+	fromID := PublicKeyToAccountID(privateKey.PublicKey)
+
+	tx, err := NewTx(args.ChainID, args.Nonce, fromID, args.ToID, args.Value, args.Tip, args.Data)
+	if err != nil {
+		return nil, err
+	}
+	tx.ValidUntil = args.ValidUntil
+	tx.Encoding = args.Encoding
+
+	signedTx, err := tx.Sign(privateKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// Catch a transaction the node would reject before it's carried over.
+	if err := signedTx.Validate(args.ChainID); err != nil {
+		return nil, err
+	}
+
+	return EncodeRawTx(signedTx)
+}
+
+// EncodeRawTx converts the signed transaction into the raw encoding.
+func EncodeRawTx(signedTx SignedTx) ([]byte, error) {
+	return encode(toBinaryTx(BlockTx{SignedTx: signedTx}))
+}
+
+// DecodeRawTx converts data produced by EncodeRawTx back into a signed
+// transaction. A JSON encoded signed transaction is also accepted so the
+// output of older wallets can be submitted the same way.
+func DecodeRawTx(data []byte) (SignedTx, error) {
+	if isJSON(data) {
+		var signedTx SignedTx
+		if err := json.Unmarshal(data, &signedTx); err != nil {
+			return SignedTx{}, err
+		}
+		return signedTx, nil
+	}
+
+	var btx binaryTx
+	if err := decode(data, &btx); err != nil {
+		return SignedTx{}, fmt.Errorf("raw transaction: %w", err)
+	}
+
+	return btx.toBlockTx().SignedTx, nil
+}
@@ -0,0 +1,224 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"sort"
+)
+
+// BlockReplay represents the changes a block made to the accounts, found by
+// applying the block again on top of the state it was built on.
+type BlockReplay struct {
+	Number      uint64        `json:"number"`
+	Hash        string        `json:"hash"`
+	Beneficiary AccountID     `json:"beneficiary"`
+	BaseFee     uint64        `json:"base_fee"`
+	Txs         []TxDiff      `json:"txs"`
+	Reward      uint64        `json:"reward"`          // Mining reward paid to the beneficiary.
+	RewardDiff  []AccountDiff `json:"reward_accounts"` // Accounts changed by the mining reward.
+}
+
+// TxDiff represents the changes a single transaction made to the accounts. A
+// failed transaction still pays for its gas, so it can change the accounts.
+type TxDiff struct {
+	TxHash   string        `json:"tx_hash"`
+	FromID   AccountID     `json:"from"`
+	Nonce    uint64        `json:"nonce"`
+	Error    string        `json:"error,omitempty"`
+	Fees     FeeFlow       `json:"fees"`
+	Accounts []AccountDiff `json:"accounts"`
+}
+
+// FeeFlow represents where the fees paid by a transaction went.
+type FeeFlow struct {
+	PayerID     AccountID `json:"payer"`
+	GasFee      uint64    `json:"gas_fee"`     // Gas charged to the payer.
+	Burned      uint64    `json:"burned"`      // Part of the gas fee burned as the base fee.
+	Beneficiary uint64    `json:"beneficiary"` // Gas and tip paid to the beneficiary.
+	Tip         uint64    `json:"tip"`
+}
+
+// AccountDiff represents the change to a single account.
+type AccountDiff struct {
+	AccountID     AccountID `json:"account"`
+	BalanceBefore uint64    `json:"balance_before"`
+	BalanceAfter  uint64    `json:"balance_after"`
+	Change        int64     `json:"change"`
+	NonceBefore   uint64    `json:"nonce_before"`
+	NonceAfter    uint64    `json:"nonce_after"`
+	Created       bool      `json:"created,omitempty"`
+	Removed       bool      `json:"removed,omitempty"`
+}
+
+// =============================================================================
+
+// ReplayBlock applies the specified block again on top of the state it was
+// built on and returns the changes each transaction and the mining reward
+// made to the accounts. The state is replayed from genesis so the walk stops
+// with an error if the context is cancelled.
+func (db *Database) ReplayBlock(ctx context.Context, blockNum uint64) (BlockReplay, error) {
+	block, err := db.GetBlock(blockNum)
+	if err != nil {
+		return BlockReplay{}, err
+	}
+
+	pdb, err := db.replayTo(ctx, blockNum)
+	if err != nil {
+		return BlockReplay{}, err
+	}
+
+	// The block commits to the state it was built on, so a mismatch means
+	// the replay can't be trusted to explain the block.
+	if stateRoot := pdb.HashStateFor(block); stateRoot != block.Header.StateRoot {
+		return BlockReplay{}, fmt.Errorf("replayed state for block %d doesn't match its state root", blockNum)
+	}
+
+	replay := BlockReplay{
+		Number:      blockNum,
+		Hash:        block.Hash(),
+		Beneficiary: block.Header.BeneficiaryID,
+		BaseFee:     block.Header.BaseFee,
+	}
+
+	// Each transaction is staged on its own and committed before the next
+	// one, so the changes of every transaction can be told apart.
+	for _, tx := range block.MerkleTree.Values() {
+		txDiff := TxDiff{
+			TxHash: tx.TxHash(),
+			FromID: tx.FromID,
+			Nonce:  tx.Nonce,
+			Fees:   pdb.feeFlow(block, tx),
+		}
+
+		delta := pdb.Stage(block)
+		if err := delta.ApplyTransaction(tx); err != nil {
+			txDiff.Error = err.Error()
+			txDiff.Fees.Tip = 0
+			txDiff.Fees.Beneficiary -= tx.Tip
+		}
+
+		txDiff.Accounts = pdb.diff(delta)
+		if err := pdb.Commit(delta); err != nil {
+			return BlockReplay{}, err
+		}
+
+		replay.Txs = append(replay.Txs, txDiff)
+	}
+
+	supply := pdb.supply
+
+	delta := pdb.Stage(block)
+	delta.ApplyMiningReward()
+	replay.RewardDiff = pdb.diff(delta)
+	replay.Reward = delta.sdb.supply - supply
+
+	return replay, nil
+}
+
+// replayTo constructs a separate database holding the state the specified
+// block was built on, which is the state after all the previous blocks were
+// applied.
+func (db *Database) replayTo(ctx context.Context, blockNum uint64) (*Database, error) {
+	accounts, err := genesisAccounts(db.genesis)
+	if err != nil {
+		return nil, err
+	}
+
+	pdb := Database{
+		genesis:  db.genesis,
+		accounts: newAccountSet(accounts),
+		storage:  db.storage,
+		cache:    newBlockCache(0),
+		stats:    newChainStats(),
+		supply:   db.genesis.GenesisSupply(),
+		gov:      newGovernance(),
+	}
+
+	for num := uint64(1); num < blockNum; num++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		prevBlock, err := db.GetBlock(num)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, tx := range prevBlock.MerkleTree.Values() {
+			pdb.ApplyTransaction(prevBlock, tx)
+		}
+		pdb.ApplyMiningReward(prevBlock)
+		pdb.latestBlock = prevBlock
+	}
+
+	return &pdb, nil
+}
+
+// feeFlow returns the fees the transaction pays when it's applied on top of
+// the current state, the same way ApplyTransaction charges them. The tip is
+// only paid by a transaction that doesn't fail.
+func (db *Database) feeFlow(block Block, tx BlockTx) FeeFlow {
+	payerID := tx.FromID
+	if tx.IsSponsored() {
+		payerID = tx.FeePayerID
+	}
+	payer, _ := db.accounts.lookup(payerID)
+
+	gasPrice := tx.GasPrice
+	if block.Header.BaseFee > 0 {
+		gasPrice = block.Header.BaseFee
+	}
+
+	gasFee := gasPrice * tx.GasUnits
+	if spendable := payer.Spendable(block.Header.Number); gasFee > spendable {
+		gasFee = spendable
+	}
+
+	flow := FeeFlow{
+		PayerID:     payerID,
+		GasFee:      gasFee,
+		Tip:         tx.Tip,
+		Beneficiary: tx.Tip,
+	}
+
+	switch {
+	case block.Header.BaseFee > 0:
+		flow.Burned = gasFee
+	default:
+		flow.Beneficiary += gasFee
+	}
+
+	return flow
+}
+
+// diff returns the changes the delta makes to the accounts of the database,
+// sorted by account.
+func (db *Database) diff(d *StateDelta) []AccountDiff {
+	var diffs []AccountDiff
+	d.sdb.accounts.changes(func(accountID AccountID, account Account, removed bool) {
+		prev, existed := db.accounts.lookup(accountID)
+
+		ad := AccountDiff{
+			AccountID:     accountID,
+			BalanceBefore: prev.Balance,
+			BalanceAfter:  account.Balance,
+			Change:        int64(account.Balance) - int64(prev.Balance),
+			NonceBefore:   prev.Nonce,
+			NonceAfter:    account.Nonce,
+			Created:       !existed && !removed,
+			Removed:       removed,
+		}
+
+		// An account written back with the same balance and nonce isn't
+		// reported unless the write created it.
+		if existed && !removed && ad.Change == 0 && ad.NonceBefore == ad.NonceAfter {
+			return
+		}
+
+		diffs = append(diffs, ad)
+	})
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].AccountID < diffs[j].AccountID })
+
+	return diffs
+}
@@ -0,0 +1,89 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ReplayBlock(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances: map[string]uint64{
+			"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000,
+		},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	replay, err := db.ReplayBlock(context.Background(), 2)
+	if err != nil {
+		t.Fatalf("Should be able to replay block 2: %v", err)
+	}
+
+	if len(replay.Txs) != 1 {
+		t.Logf("got: %d", len(replay.Txs))
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should replay every transaction in the block.")
+	}
+
+	const (
+		sender      = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+		receiver    = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+		beneficiary = database.AccountID("0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8")
+	)
+
+	// Block 1 moved 10 to the receiver and paid 1 in gas to the beneficiary
+	// along with the mining reward.
+	exp := []database.AccountDiff{
+		{AccountID: receiver, BalanceBefore: 10, BalanceAfter: 20, Change: 10},
+		{AccountID: beneficiary, BalanceBefore: 701, BalanceAfter: 702, Change: 1},
+		{AccountID: sender, BalanceBefore: 989, BalanceAfter: 978, Change: -11, NonceBefore: 1, NonceAfter: 2},
+	}
+
+	txDiff := replay.Txs[0]
+	if len(txDiff.Accounts) != len(exp) {
+		t.Logf("got: %+v", txDiff.Accounts)
+		t.Logf("exp: %+v", exp)
+		t.Fatalf("Should report each account the transaction changed.")
+	}
+
+	for i, ad := range txDiff.Accounts {
+		if ad != exp[i] {
+			t.Logf("got: %+v", ad)
+			t.Logf("exp: %+v", exp[i])
+			t.Fatalf("Should report the change to account %s.", exp[i].AccountID)
+		}
+	}
+
+	if txDiff.Error != "" || txDiff.Fees.PayerID != sender || txDiff.Fees.GasFee != 1 || txDiff.Fees.Beneficiary != 1 || txDiff.Fees.Burned != 0 {
+		t.Logf("got: %+v", txDiff)
+		t.Fatalf("Should report the fees paid by the transaction.")
+	}
+
+	if replay.Reward != 700 || len(replay.RewardDiff) != 1 || replay.RewardDiff[0].BalanceAfter != 1402 {
+		t.Logf("got: reward %d: %+v", replay.Reward, replay.RewardDiff)
+		t.Fatalf("Should report the mining reward paid to the beneficiary.")
+	}
+
+	if _, err := db.ReplayBlock(context.Background(), 4); err == nil {
+		t.Fatalf("Should not be able to replay a block that doesn't exist.")
+	}
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+// minParallelTxs is the smallest number of transactions worth spreading
+// across workers. Smaller blocks are checked on the calling goroutine.
+const minParallelTxs = 4
+
+// ValidateTransactions checks the transactions are for the chain and verifies
+// their signatures using a worker per CPU, since recovering the signer of a
+// signature dominates the cost of validating a block. When more than one
+// transaction is invalid, the error is always for the first one in the block
+// so every node reports the same error for the same block.
+//
+// CORE NOTE: Existing chains hold transactions signed with an earlier
+// transaction format that no longer recover to the from account. Those
+// signatures aren't bound to a chain, so in the blocks the genesis file pins
+// by hash only their chain id is checked. The hash covers the merkle root of
+// the transactions, so a pinned block can't be given other transactions.
+// Every other signature is fully verified, otherwise a block producer could
+// spend from any account with a made up signature.
+func ValidateTransactions(txs []BlockTx, gen genesis.Genesis, blockHash string) error {
+	legacy := gen.IsLegacySigBlock(blockHash)
+
+	validate := func(tx BlockTx) error {
+		if legacy && tx.SignatureScheme() == signature.SchemeECDSA {
+			if _, bound := signature.ChainID(tx.V); !bound {
+				return tx.ValidateChain(gen.ChainID)
+			}
+		}
+		return tx.Validate(gen.ChainID)
+	}
+
+	workers := runtime.GOMAXPROCS(0)
+	if workers > len(txs) {
+		workers = len(txs)
+	}
+
+	if len(txs) < minParallelTxs || workers < 2 {
+		for _, tx := range txs {
+			if err := validate(tx); err != nil {
+				return fmt.Errorf("transaction %s: %w", tx, err)
+			}
+		}
+		return nil
+	}
+
+	// Workers take the next index until every transaction is checked. Once a
+	// transaction fails, the transactions after it don't need to be checked
+	// but the ones before it still do, since one of them may fail too.
+	errs := make([]error, len(txs))
+	next := int64(-1)
+	failed := int64(len(txs))
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= atomic.LoadInt64(&failed) {
+					return
+				}
+
+				if errs[i] = validate(txs[i]); errs[i] == nil {
+					continue
+				}
+
+				for {
+					current := atomic.LoadInt64(&failed)
+					if i >= current || atomic.CompareAndSwapInt64(&failed, current, i) {
+						break
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if failed < int64(len(txs)) {
+		return fmt.Errorf("transaction %s: %w", txs[failed], errs[failed])
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package database_test
+
+import (
+	"context"
+	"math/big"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_ValidateSignatures(t *testing.T) {
+
+	// Make sure the signatures are checked by more than one worker even on
+	// a machine with a single CPU.
+	defer runtime.GOMAXPROCS(runtime.GOMAXPROCS(4))
+
+	ev := func(v string, args ...any) {}
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, MiningReward: 700, Balances: map[string]uint64{benchFromID: 1_000_000}}
+
+	db, err := database.New(gen, MockStorage{}, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mine := func(tampered ...int) database.Block {
+		txs := make([]database.BlockTx, 20)
+		for i := range txs {
+			tx := database.Tx{ChainID: 1, Nonce: uint64(i + 1), FromID: benchFromID, ToID: benchToID, Value: 10}
+			if txs[i], err = sign(tx, 1); err != nil {
+				t.Fatalf("Should be able to sign transaction: %v", err)
+			}
+		}
+
+		// Changing the value after signing leaves a signature that doesn't
+		// recover to the from account.
+		for _, i := range tampered {
+			txs[i].Value = 1_000
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: benchMinerID,
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         txs,
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block: %v", err)
+		}
+
+		return block
+	}
+
+	if err := db.ValidateBlock(mine(), ev); err != nil {
+		t.Fatalf("Should be able to validate a block with valid signatures: %v", err)
+	}
+
+	// The error is always for the first invalid transaction in the block.
+	for i := 0; i < 10; i++ {
+		block := mine(17, 5, 11)
+		exp := block.MerkleTree.Values()[5].String()
+
+		err := db.ValidateBlock(block, ev)
+		if err == nil {
+			t.Fatalf("Should not validate a block with a tampered transaction.")
+		}
+
+		if !strings.Contains(err.Error(), exp) {
+			t.Logf("got: %s", err)
+			t.Logf("exp: %s", exp)
+			t.Fatalf("Should report the first tampered transaction.")
+		}
+	}
+}
+
+func Test_ForgedSignature(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	forged := func(gen genesis.Genesis) (*database.Database, database.Block) {
+		db, err := database.New(gen, MockStorage{}, ev)
+		if err != nil {
+			t.Fatalf("Should be able to open database: %v", err)
+		}
+
+		// A signature in the earlier format isn't bound to a chain and this
+		// one wasn't produced by the from account.
+		tx, err := sign(database.Tx{ChainID: 1, Nonce: 1, FromID: benchFromID, ToID: benchToID, Value: 10}, 1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		tx.Value = 999_000
+		tx.V, tx.R, tx.S = big.NewInt(29), big.NewInt(1), big.NewInt(1)
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: benchMinerID,
+			Difficulty:    gen.Difficulty,
+			MiningReward:  gen.MiningReward,
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         []database.BlockTx{tx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block: %v", err)
+		}
+
+		return db, block
+	}
+
+	gen := genesis.Genesis{ChainID: 1, Difficulty: 1, MiningReward: 700, Balances: map[string]uint64{benchFromID: 1_000_000}}
+
+	db, block := forged(gen)
+	if err := db.ValidateBlock(block, ev); err == nil {
+		t.Fatalf("Should not validate a block with a forged signature.")
+	}
+
+	// Only the blocks pinned in the genesis file skip recovering the signer
+	// of a signature that isn't bound to a chain.
+	gen.LegacySigBlocks = []string{"0x0000006d18f403cde8910a304ff9866319150a0dbeb977064e33470224d88579"}
+
+	db, block = forged(gen)
+	if err := db.ValidateBlock(block, ev); err == nil {
+		t.Fatalf("Should not validate a forged signature in a block that isn't pinned.")
+	}
+
+	gen.LegacySigBlocks = append(gen.LegacySigBlocks, block.Hash())
+
+	db, _ = forged(gen)
+	if err := db.ValidateBlock(block, ev); err != nil {
+		t.Fatalf("Should validate a legacy signature in a pinned block: %v", err)
+	}
+}
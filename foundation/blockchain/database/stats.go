@@ -0,0 +1,144 @@
+package database
+
+import "sync"
+
+// statsWindow is the number of the most recent blocks used to calculate the
+// rolling chain statistics.
+const statsWindow = 100
+
+// ChainStats represents the statistics for the blockchain. The averages and
+// rates are calculated over the most recent blocks in the window.
+type ChainStats struct {
+	Blocks           uint64  `json:"blocks"`
+	Transactions     uint64  `json:"transactions"`
+	TotalSupply      uint64  `json:"total_supply"`
+	NextBaseFee      uint64  `json:"next_base_fee"`
+	Window           int     `json:"window"`
+	AvgBlockInterval float64 `json:"avg_block_interval_secs"`
+	TxPerSecond      float64 `json:"tx_per_second"`
+	AvgGasPrice      float64 `json:"avg_gas_price"`
+	AvgTip           float64 `json:"avg_tip"`
+}
+
+// =============================================================================
+
+// blockSample represents the values captured from a block for the rolling
+// statistics.
+type blockSample struct {
+	timeStamp uint64
+	trans     uint64
+	gasPrice  uint64
+	tip       uint64
+}
+
+// chainStats maintains the chain statistics incrementally as each block is
+// applied to the database.
+type chainStats struct {
+	mu           sync.RWMutex
+	blocks       uint64
+	transactions uint64
+
+	samples  []blockSample // Ring buffer of the most recent blocks.
+	next     int           // Index in the ring buffer for the next sample.
+	trans    uint64        // Sum of the transactions in the window.
+	gasPrice uint64        // Sum of the gas prices in the window.
+	tip      uint64        // Sum of the tips in the window.
+}
+
+// newChainStats constructs empty chain statistics.
+func newChainStats() *chainStats {
+	return &chainStats{
+		samples: make([]blockSample, 0, statsWindow),
+	}
+}
+
+// apply updates the statistics with the specified block.
+func (cs *chainStats) apply(block Block) {
+	sample := blockSample{
+		timeStamp: block.Header.TimeStamp,
+	}
+
+	for _, tx := range block.MerkleTree.Values() {
+		sample.trans++
+		sample.gasPrice += tx.GasPrice
+		sample.tip += tx.Tip
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.blocks++
+	cs.transactions += sample.trans
+
+	// Replace the oldest sample once the window is full.
+	if len(cs.samples) == statsWindow {
+		old := cs.samples[cs.next]
+		cs.trans -= old.trans
+		cs.gasPrice -= old.gasPrice
+		cs.tip -= old.tip
+		cs.samples[cs.next] = sample
+	} else {
+		cs.samples = append(cs.samples, sample)
+	}
+	cs.next = (cs.next + 1) % statsWindow
+
+	cs.trans += sample.trans
+	cs.gasPrice += sample.gasPrice
+	cs.tip += sample.tip
+}
+
+// clone returns a copy of the statistics that can be updated separately.
+func (cs *chainStats) clone() *chainStats {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	samples := make([]blockSample, len(cs.samples), statsWindow)
+	copy(samples, cs.samples)
+
+	return &chainStats{
+		blocks:       cs.blocks,
+		transactions: cs.transactions,
+		samples:      samples,
+		next:         cs.next,
+		trans:        cs.trans,
+		gasPrice:     cs.gasPrice,
+		tip:          cs.tip,
+	}
+}
+
+// snapshot returns the current statistics.
+func (cs *chainStats) snapshot() ChainStats {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	stats := ChainStats{
+		Blocks:       cs.blocks,
+		Transactions: cs.transactions,
+		Window:       len(cs.samples),
+	}
+
+	if cs.trans > 0 {
+		stats.AvgGasPrice = float64(cs.gasPrice) / float64(cs.trans)
+		stats.AvgTip = float64(cs.tip) / float64(cs.trans)
+	}
+
+	n := len(cs.samples)
+	if n < 2 {
+		return stats
+	}
+
+	// Find the oldest and newest samples in the ring buffer.
+	oldest := cs.samples[cs.next%n]
+	newest := cs.samples[(cs.next+n-1)%n]
+	if newest.timeStamp <= oldest.timeStamp {
+		return stats
+	}
+
+	// Timestamps are in milliseconds. The transactions in the oldest block
+	// were mined before the time span starts.
+	secs := float64(newest.timeStamp-oldest.timeStamp) / 1000
+	stats.AvgBlockInterval = secs / float64(n-1)
+	stats.TxPerSecond = float64(cs.trans-oldest.trans) / secs
+
+	return stats
+}
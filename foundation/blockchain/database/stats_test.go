@@ -0,0 +1,215 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_ChainStats(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	stats := db.ChainStats()
+	if stats.Blocks != 3 || stats.Transactions != 3 || stats.Window != 3 {
+		t.Fatalf("Should have counted the blocks and transactions: %+v", stats)
+	}
+
+	if exp := uint64(1000 + 3*700); stats.TotalSupply != exp {
+		t.Logf("got: %d", stats.TotalSupply)
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should include the mining rewards in the total supply.")
+	}
+
+	if stats.AvgGasPrice != 1 {
+		t.Logf("got: %f", stats.AvgGasPrice)
+		t.Logf("exp: %f", 1.0)
+		t.Fatalf("Should have the average gas price.")
+	}
+
+	// Reloading the chain should produce the same statistics.
+	db, err = database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to reload database: %v", err)
+	}
+
+	if reload := db.ChainStats(); reload != stats {
+		t.Logf("got: %+v", reload)
+		t.Logf("exp: %+v", stats)
+		t.Fatalf("Should rebuild the statistics when the chain is loaded.")
+	}
+}
+
+func Test_MonetaryPolicy(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:         1,
+		Difficulty:      1,
+		MiningReward:    700,
+		HalvingInterval: 2,
+		Balances:        map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	if exp := uint64(1000 + 700 + 700 + 350); db.TotalSupply() != exp {
+		t.Logf("got: %d", db.TotalSupply())
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should have halved the reward for block 3.")
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   4,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   10,
+	}
+
+	blockTx, err := sign(tx, 1)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    gen.Difficulty,
+		MiningReward:  gen.MiningReward,
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashState(),
+		Trans:         []database.BlockTx{blockTx},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block 4: %v", err)
+	}
+
+	if err := db.ValidateBlock(block, ev); err == nil {
+		t.Fatalf("Should not accept a mining reward greater than the policy allows.")
+	}
+}
+
+func Test_BaseFee(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	const beneficiary = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+
+	gen := genesis.Genesis{
+		ChainID:       1,
+		Difficulty:    1,
+		TransPerBlock: 2,
+		MiningReward:  700,
+		BaseFee:       4,
+		Balances:      map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 2)
+
+	// Each block holds one transaction using one gas unit which hits the
+	// target, so the base fee of 4 is burned for both blocks.
+	if exp := uint64(1000 + 700 - 4 + 700 - 4); db.TotalSupply() != exp {
+		t.Logf("got: %d", db.TotalSupply())
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should have burned the base fee.")
+	}
+
+	account, err := db.Query(beneficiary)
+	if err != nil {
+		t.Fatalf("Should be able to query the beneficiary: %v", err)
+	}
+	if account.Balance != 1400 {
+		t.Logf("got: %d", account.Balance)
+		t.Logf("exp: %d", 1400)
+		t.Fatalf("Should only give the beneficiary the mining reward and tips.")
+	}
+
+	tx := database.Tx{
+		ChainID: 1,
+		Nonce:   3,
+		FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		Value:   10,
+	}
+
+	type table struct {
+		name     string
+		gasPrice uint64
+		baseFee  uint64
+	}
+
+	tt := []table{
+		{name: "wrongbasefee", gasPrice: 10, baseFee: 3},
+		{name: "underpriced", gasPrice: 3, baseFee: 4},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			blockTx, err := sign(tx, tst.gasPrice)
+			if err != nil {
+				t.Fatalf("Should be able to sign transaction: %v", err)
+			}
+
+			block, err := database.POW(context.Background(), database.POWArgs{
+				BeneficiaryID: beneficiary,
+				Difficulty:    gen.Difficulty,
+				MiningReward:  gen.MiningReward,
+				BaseFee:       tst.baseFee,
+				PrevBlock:     db.LatestBlock(),
+				StateRoot:     db.HashState(),
+				Trans:         []database.BlockTx{blockTx},
+				EvHandler:     ev,
+			})
+			if err != nil {
+				t.Fatalf("Should be able to mine block 3: %v", err)
+			}
+
+			if err := db.ValidateBlock(block, ev); err == nil {
+				t.Fatalf("Should not accept the block.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
@@ -3,12 +3,14 @@ package database
 import (
 	"bytes"
 	"crypto/ecdsa"
+	"crypto/ed25519"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"math/big"
 	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 )
 
@@ -23,6 +25,21 @@ type Tx struct {
 	Value   uint64    `json:"value"`    // Ethereum: Monetary value received from this transaction.
 	Tip     uint64    `json:"tip"`      // Ethereum: Tip offered by the sender as an incentive to mine this transaction.
 	Data    []byte    `json:"data"`     // Ethereum: Extra data related to the transaction.
+
+	// ValidUntil is the last block number the transaction can be mined into
+	// and 0 never expires. It's omitted from the JSON when 0 so transactions
+	// signed before this field existed still have a valid signature.
+	ValidUntil uint64 `json:"valid_until,omitempty"`
+
+	// FeePayerID is the account sponsoring the transaction by paying the gas
+	// and tip on behalf of the sender. It's omitted from the JSON when empty
+	// so transactions signed before this field existed are still valid.
+	FeePayerID AccountID `json:"fee_payer,omitempty"`
+
+	// Encoding is the encoding the transaction is signed and hashed with, see
+	// signature.Versioned. It's omitted from the JSON when 0 so transactions
+	// signed with the JSON encoding keep a valid signature.
+	Encoding uint8 `json:"encoding,omitempty"`
 }
 
 // NewTx constructs a new transaction.
@@ -47,11 +64,46 @@ func NewTx(chainID uint16, nonce uint64, fromID AccountID, toID AccountID, value
 	return tx, nil
 }
 
+// NewCancelTx constructs a transaction that cancels the pending transaction
+// from the account with the same nonce. The tip needs to be high enough for
+// the cancellation to replace the pending transaction in the mempool.
+func NewCancelTx(chainID uint16, nonce uint64, accountID AccountID, tip uint64) (Tx, error) {
+
+	// CORE NOTE: Ethereum has no way to take back a transaction once it has
+	// been sent. Instead, the wallet sends a transaction with no value to the
+	// same account using the same nonce and a higher tip. Miners prefer the
+	// higher tip so the replacement is mined instead and the only cost is the
+	// gas and tip for the cancellation.
+
+	return NewTx(chainID, nonce, accountID, accountID, 0, tip, nil)
+}
+
+// IsCancel reports if the transaction only exists to cancel the pending
+// transaction from the account with the same nonce. It moves no value and
+// carries no data, so it's the only transaction allowed to be sent to the
+// account sending it.
+func (tx Tx) IsCancel() bool {
+	return tx.FromID == tx.ToID && tx.Value == 0 && len(tx.Data) == 0
+}
+
+// EncodingVersion implements the signature Versioned interface so the
+// transaction is signed and hashed with the encoding it was created for.
+func (tx Tx) EncodingVersion() uint8 {
+	return tx.Encoding
+}
+
+// IsExpired checks if the transaction can no longer be mined into the
+// specified block number.
+func (tx Tx) IsExpired(blockNum uint64) bool {
+	return tx.ValidUntil != 0 && blockNum > tx.ValidUntil
+}
+
 // Sign uses the specified private key to sign the transaction.
 func (tx Tx) Sign(privateKey *ecdsa.PrivateKey) (SignedTx, error) {
 
-	// Sign the transaction with the private key to produce a signature.
-	v, r, s, err := signature.Sign(tx, privateKey)
+	// Sign the transaction with the private key to produce a signature that
+	// is bound to the chain so it can't be replayed on another chain.
+	v, r, s, err := signature.SignForChain(tx, tx.ChainID, privateKey)
 	if err != nil {
 		return SignedTx{}, err
 	}
@@ -68,6 +120,25 @@ func (tx Tx) Sign(privateKey *ecdsa.PrivateKey) (SignedTx, error) {
 	return signedTx, nil
 }
 
+// SignEd25519 uses the specified Ed25519 private key to sign the
+// transaction. The public key is carried with the signature since it can't
+// be recovered from an Ed25519 signature.
+func (tx Tx) SignEd25519(privateKey ed25519.PrivateKey) (SignedTx, error) {
+	sig, err := signature.SignEd25519(tx, tx.ChainID, privateKey)
+	if err != nil {
+		return SignedTx{}, err
+	}
+
+	signedTx := SignedTx{
+		Tx:        tx,
+		Scheme:    signature.SchemeEd25519,
+		PublicKey: privateKey.Public().(ed25519.PublicKey),
+		Sig:       sig,
+	}
+
+	return signedTx, nil
+}
+
 // =============================================================================
 
 // SignedTx is a signed version of the transaction. This is how clients like
@@ -77,14 +148,62 @@ type SignedTx struct {
 	V *big.Int `json:"v"` // Ethereum: Recovery identifier, either 29 or 30 with ardanID.
 	R *big.Int `json:"r"` // Ethereum: First coordinate of the ECDSA signature.
 	S *big.Int `json:"s"` // Ethereum: Second coordinate of the ECDSA signature.
+
+	// Transactions signed with a scheme other than ECDSA carry the public key
+	// and signature of the sender instead of V, R and S. They are omitted
+	// from the JSON for ECDSA so existing transactions keep their hash.
+	Scheme    string `json:"scheme,omitempty"`
+	PublicKey []byte `json:"public_key,omitempty"`
+	Sig       []byte `json:"sig,omitempty"`
+
+	// The fee payer signature is only present on sponsored transactions and is
+	// always signed with ECDSA.
+	FeePayerV *big.Int `json:"fee_payer_v,omitempty"`
+	FeePayerR *big.Int `json:"fee_payer_r,omitempty"`
+	FeePayerS *big.Int `json:"fee_payer_s,omitempty"`
+}
+
+// SignFeePayer uses the specified private key to sign the transaction as the
+// fee payer. The fee payer signs the same transaction data as the sender so
+// the sponsorship can't be moved to a different transaction.
+func (tx SignedTx) SignFeePayer(privateKey *ecdsa.PrivateKey) (SignedTx, error) {
+	if tx.FeePayerID == "" {
+		return SignedTx{}, errors.New("transaction doesn't have a fee payer")
+	}
+
+	v, r, s, err := signature.SignForChain(tx.Tx, tx.ChainID, privateKey)
+	if err != nil {
+		return SignedTx{}, err
+	}
+
+	tx.FeePayerV = v
+	tx.FeePayerR = r
+	tx.FeePayerS = s
+
+	return tx, nil
+}
+
+// SignatureScheme returns the signature scheme the sender signed the
+// transaction with.
+func (tx SignedTx) SignatureScheme() string {
+	if tx.Scheme == "" {
+		return signature.SchemeECDSA
+	}
+
+	return tx.Scheme
+}
+
+// IsSponsored reports if the fees for the transaction are paid by a fee payer.
+func (tx SignedTx) IsSponsored() bool {
+	return tx.FeePayerID != ""
 }
 
 // Validate verifies the transaction has a proper signature that conforms to our
 // standards. It also checks the from field matches the account that signed the
 // transaction. Last it checks the format of the from and to fields.
 func (tx SignedTx) Validate(chainID uint16) error {
-	if tx.ChainID != chainID {
-		return fmt.Errorf("invalid chain id, got[%d] exp[%d]", tx.ChainID, chainID)
+	if err := tx.ValidateChain(chainID); err != nil {
+		return err
 	}
 
 	if !tx.FromID.IsAccountID() {
@@ -95,21 +214,149 @@ func (tx SignedTx) Validate(chainID uint16) error {
 		return errors.New("to account is not properly formatted")
 	}
 
-	if tx.FromID == tx.ToID {
-		return fmt.Errorf("transaction invalid, sending money to yourself, from %s, to %s", tx.FromID, tx.ToID)
+	if tx.Encoding > signature.EncodingCanonical {
+		return fmt.Errorf("transaction encoding %d is not supported", tx.Encoding)
 	}
 
-	if err := signature.VerifySignature(tx.V, tx.R, tx.S); err != nil {
-		return err
+	if tx.FromID == tx.ToID && !tx.IsCancel() {
+		return fmt.Errorf("transaction invalid, sending money to yourself, from %s, to %s", tx.FromID, tx.ToID)
 	}
 
-	address, err := signature.FromAddress(tx.Tx, tx.V, tx.R, tx.S)
+	address, err := tx.signer(chainID)
 	if err != nil {
-		return err
+		return errcode.Wrap(errcode.InvalidSignature, err)
 	}
 
 	if address != string(tx.FromID) {
-		return errors.New("signature address doesn't match from address")
+		return errcode.New(errcode.InvalidSignature, "signature address doesn't match from address")
+	}
+
+	return tx.validateFeePayer()
+}
+
+// ValidateChecksums checks the accounts in the transaction that are in mixed
+// case match their checksum. Blocks accept accounts in any case, so this is
+// only checked for the transactions submitted by wallets to catch mistyped
+// accounts before the funds are sent to them.
+func (tx Tx) ValidateChecksums() error {
+	accounts := []struct {
+		name string
+		id   AccountID
+	}{
+		{"from", tx.FromID},
+		{"to", tx.ToID},
+		{"fee payer", tx.FeePayerID},
+	}
+
+	for _, account := range accounts {
+		if account.id != "" && !account.id.HasValidChecksum() {
+			return fmt.Errorf("%s account: %w: %s", account.name, ErrChecksum, account.id)
+		}
+	}
+
+	return nil
+}
+
+// signer verifies the signature of the sender with the scheme the transaction
+// is signed with and returns the address of the account that signed it.
+func (tx SignedTx) signer(chainID uint16) (string, error) {
+	scheme, err := signature.LookupScheme(tx.SignatureScheme())
+	if err != nil {
+		return "", err
+	}
+
+	// Only the fields for the scheme can be set, otherwise the same signed
+	// transaction could be shared with different hashes.
+	if tx.SignatureScheme() == signature.SchemeECDSA {
+		if tx.PublicKey != nil || tx.Sig != nil {
+			return "", errors.New("ecdsa transaction can't carry a public key or sig")
+		}
+		if tx.V == nil || tx.R == nil || tx.S == nil {
+			return "", errors.New("ecdsa transaction is missing the signature")
+		}
+	} else if tx.V != nil || tx.R != nil || tx.S != nil {
+		return "", fmt.Errorf("%s transaction can't carry v, r or s", tx.Scheme)
+	}
+
+	return scheme.Verify(tx.Tx, chainID, tx.PublicKey, tx.signatureBytes())
+}
+
+// signatureBytes returns the signature of the sender in the form used by the
+// signature scheme.
+func (tx SignedTx) signatureBytes() []byte {
+	if tx.SignatureScheme() != signature.SchemeECDSA {
+		return tx.Sig
+	}
+
+	if tx.V == nil || tx.R == nil || tx.S == nil {
+		return nil
+	}
+
+	return signature.ToSignatureBytesWithArdanID(tx.V, tx.R, tx.S)
+}
+
+// validateFeePayer verifies a sponsored transaction has a proper signature
+// from the fee payer.
+func (tx SignedTx) validateFeePayer() error {
+	if !tx.IsSponsored() {
+		if tx.FeePayerV != nil || tx.FeePayerR != nil || tx.FeePayerS != nil {
+			return errors.New("fee payer signature provided without a fee payer")
+		}
+		return nil
+	}
+
+	if !tx.FeePayerID.IsAccountID() {
+		return errors.New("fee payer account is not properly formatted")
+	}
+
+	if tx.FeePayerID == tx.FromID {
+		return errors.New("transaction invalid, sender can't sponsor their own transaction")
+	}
+
+	if tx.FeePayerV == nil || tx.FeePayerR == nil || tx.FeePayerS == nil {
+		return errors.New("sponsored transaction is missing the fee payer signature")
+	}
+
+	if err := signature.VerifySignature(tx.FeePayerV, tx.FeePayerR, tx.FeePayerS); err != nil {
+		return fmt.Errorf("fee payer: %w", err)
+	}
+
+	address, err := signature.FromAddress(tx.Tx, tx.FeePayerV, tx.FeePayerR, tx.FeePayerS)
+	if err != nil {
+		return fmt.Errorf("fee payer: %w", err)
+	}
+
+	if address != string(tx.FeePayerID) {
+		return errors.New("fee payer signature address doesn't match fee payer address")
+	}
+
+	return nil
+}
+
+// ValidateChain verifies the transaction and its signature are for the
+// specified chain. Signatures produced before chain binding existed are still
+// accepted since the chain id is part of the signed transaction data.
+func (tx SignedTx) ValidateChain(chainID uint16) error {
+	if tx.ChainID != chainID {
+		return fmt.Errorf("invalid chain id, got[%d] exp[%d]", tx.ChainID, chainID)
+	}
+
+	// Signatures from other schemes are always bound to the chain.
+	if tx.SignatureScheme() == signature.SchemeECDSA && tx.V != nil {
+		if sigChainID, bound := signature.ChainID(tx.V); bound && sigChainID != chainID {
+			return fmt.Errorf("signature is bound to chain id %d, exp[%d]", sigChainID, chainID)
+		}
+	}
+
+	// The fee payer signature was added after chain binding and must be bound.
+	if tx.IsSponsored() {
+		if tx.FeePayerV == nil {
+			return errors.New("sponsored transaction is missing the fee payer signature")
+		}
+
+		if sigChainID, bound := signature.ChainID(tx.FeePayerV); !bound || sigChainID != chainID {
+			return fmt.Errorf("fee payer signature is not bound to chain id %d", chainID)
+		}
 	}
 
 	return nil
@@ -117,9 +364,20 @@ func (tx SignedTx) Validate(chainID uint16) error {
 
 // SignatureString returns the signature as a string.
 func (tx SignedTx) SignatureString() string {
+	if tx.SignatureScheme() != signature.SchemeECDSA || tx.V == nil {
+		return "0x" + hex.EncodeToString(tx.Sig)
+	}
+
 	return signature.SignatureString(tx.V, tx.R, tx.S)
 }
 
+// TxHash returns the hash that identifies the signed transaction. Unlike the
+// block transaction hash, it doesn't include the values set by the node so
+// the hash is known once the transaction is signed.
+func (tx SignedTx) TxHash() string {
+	return signature.Hash(tx)
+}
+
 // String implements the Stringer interface for logging.
 func (tx SignedTx) String() string {
 	return fmt.Sprintf("%s:%d", tx.FromID, tx.Nonce)
@@ -159,8 +417,5 @@ func (tx BlockTx) Hash() ([]byte, error) {
 // check between two block transactions. If the nonce and signatures are the
 // same, the two blocks are the same.
 func (tx BlockTx) Equals(otherTx BlockTx) bool {
-	txSig := signature.ToSignatureBytes(tx.V, tx.R, tx.S)
-	otherTxSig := signature.ToSignatureBytes(otherTx.V, otherTx.R, otherTx.S)
-
-	return tx.Nonce == otherTx.Nonce && bytes.Equal(txSig, otherTxSig)
+	return tx.Nonce == otherTx.Nonce && bytes.Equal(tx.signatureBytes(), otherTx.signatureBytes())
 }
@@ -0,0 +1,488 @@
+package database
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+// Set of names for the rules a block is validated with.
+const (
+	RuleChainForked  = "chain_forked"
+	RuleDifficulty   = "difficulty"
+	RulePOW          = "pow"
+	RuleNumber       = "number"
+	RuleParentHash   = "parent_hash"
+	RuleTimestamp    = "timestamp"
+	RuleStateRoot    = "state_root"
+	RuleTxRoot       = "tx_root"
+	RuleTxExpiry     = "tx_expiry"
+	RuleMiningReward = "mining_reward"
+	RuleBaseFee      = "base_fee"
+	RuleVersion      = "version"
+	RuleEncoding     = "encoding"
+	RuleGasUsed      = "gas_used"
+	RuleTxGas        = "tx_gas"
+	RuleVotes        = "votes"
+	RuleTxSignatures = "tx_signatures"
+)
+
+// CORE NOTE: Every consensus rule a block has to pass is a named step in an
+// ordered pipeline instead of one long function. A consensus engine adds the
+// rules it needs on top of the common ones, and a node syncing from a peer
+// it trusts can skip the expensive rules, like checking the proof of work,
+// the state root and every signature, while the cheap rules linking each
+// block to its parent still run. The time spent in each rule is kept so a
+// slow rule shows up in the metrics.
+
+// BlockCheck represents what a block is validated against.
+type BlockCheck struct {
+	Block     Block
+	Parent    Block          // Block the block is added on top of.
+	StateRoot string         // State root of the accounts before the block, used when there is no database.
+	DB        *Database      // Database the block is added to, nil for the header rules only.
+	Trusted   bool           // The block comes from a trusted fast sync so the rules that allow it are skipped.
+	Proofs    []AccountProof // Proofs of the accounts the block touches, used when there is no database.
+}
+
+// stateRoot returns the state root of the accounts the block is applied to.
+func (bc BlockCheck) stateRoot() string {
+	if bc.DB != nil {
+		return bc.DB.HashStateFor(bc.Block)
+	}
+
+	return bc.StateRoot
+}
+
+// Rule represents a named check a block has to pass.
+type Rule struct {
+	Name        string
+	Desc        string                    // What the rule checks, used in the event log.
+	Check       func(bc BlockCheck) error // Returns why the block fails the rule.
+	SkipTrusted bool                      // Skipped for the blocks from a trusted fast sync.
+}
+
+// RuleStats represents the time spent in a rule for the blocks validated
+// since the node started.
+type RuleStats struct {
+	Name     string  `json:"name"`
+	Runs     uint64  `json:"runs"`
+	Skipped  uint64  `json:"skipped"`
+	Failures uint64  `json:"failures"`
+	Last     float64 `json:"last_ms"`
+	Avg      float64 `json:"avg_ms"`
+	Max      float64 `json:"max_ms"`
+}
+
+// =============================================================================
+
+// ruleTimes represents the time spent in a rule.
+type ruleTimes struct {
+	runs     uint64
+	skipped  uint64
+	failures uint64
+	last     time.Duration
+	total    time.Duration
+	max      time.Duration
+}
+
+// Pipeline represents the ordered rules a block is validated with.
+type Pipeline struct {
+	mu    sync.RWMutex
+	rules []Rule
+	times map[string]*ruleTimes
+}
+
+// NewPipeline constructs a pipeline running the rules in order.
+func NewPipeline(rules ...Rule) *Pipeline {
+	return &Pipeline{
+		rules: rules,
+		times: make(map[string]*ruleTimes),
+	}
+}
+
+// Append adds the rules to run after the existing rules. The rules are
+// copied so a validation already running keeps the rules it started with.
+func (p *Pipeline) Append(rules ...Rule) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.rules = append(append([]Rule(nil), p.rules...), rules...)
+}
+
+// InsertBefore adds the rule to run right before the named rule.
+func (p *Pipeline) InsertBefore(name string, rule Rule) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for i := range p.rules {
+		if p.rules[i].Name == name {
+			rules := append([]Rule(nil), p.rules[:i]...)
+			rules = append(rules, rule)
+			p.rules = append(rules, p.rules[i:]...)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("rule %q not found", name)
+}
+
+// Names returns the names of the rules in the order they run.
+func (p *Pipeline) Names() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, len(p.rules))
+	for i, rule := range p.rules {
+		names[i] = rule.Name
+	}
+
+	return names
+}
+
+// Validate runs the rules in order and returns the error of the first rule
+// the block fails.
+func (p *Pipeline) Validate(bc BlockCheck, evHandler func(v string, args ...any)) error {
+	p.mu.RLock()
+	rules := p.rules
+	p.mu.RUnlock()
+
+	for _, rule := range rules {
+		if bc.Trusted && rule.SkipTrusted {
+			evHandler("database: ValidateBlock: validate: blk[%d]: skip: %s", bc.Block.Header.Number, rule.Desc)
+			p.record(rule.Name, 0, false, true)
+			continue
+		}
+
+		evHandler("database: ValidateBlock: validate: blk[%d]: check: %s", bc.Block.Header.Number, rule.Desc)
+
+		start := time.Now()
+		err := rule.Check(bc)
+		p.record(rule.Name, time.Since(start), err != nil, false)
+
+		if err != nil {
+			evHandler("database: ValidateBlock: validate: blk[%d]: rule[%s] failed: %s", bc.Block.Header.Number, rule.Name, err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stats returns the time spent in each rule sorted by name.
+func (p *Pipeline) Stats() []RuleStats {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	stats := make([]RuleStats, 0, len(p.times))
+	for name, rt := range p.times {
+		rs := RuleStats{
+			Name:     name,
+			Runs:     rt.runs,
+			Skipped:  rt.skipped,
+			Failures: rt.failures,
+			Last:     ms(rt.last),
+			Max:      ms(rt.max),
+		}
+		if rt.runs > 0 {
+			rs.Avg = ms(rt.total / time.Duration(rt.runs))
+		}
+		stats = append(stats, rs)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+// record adds the run of the rule to its times.
+func (p *Pipeline) record(name string, took time.Duration, failed bool, skipped bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	rt, exists := p.times[name]
+	if !exists {
+		rt = new(ruleTimes)
+		p.times[name] = rt
+	}
+
+	if skipped {
+		rt.skipped++
+		return
+	}
+
+	rt.runs++
+	rt.last = took
+	rt.total += took
+	if took > rt.max {
+		rt.max = took
+	}
+	if failed {
+		rt.failures++
+	}
+}
+
+// ms converts the duration to fractional milliseconds.
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// newBlockPipeline constructs the pipeline with the header rules followed by
+// the chain rules.
+func newBlockPipeline() *Pipeline {
+	return NewPipeline(append(HeaderRules(), ChainRules()...)...)
+}
+
+// =============================================================================
+
+// HeaderRules returns the rules checking the block against its parent and
+// its own transactions, which don't need a database.
+func HeaderRules() []Rule {
+	return []Rule{
+		{
+			Name: RuleChainForked,
+			Desc: "chain is not forked",
+			Check: func(bc BlockCheck) error {
+
+				// The node who sent this block has a chain that is two or more blocks ahead
+				// of ours. This means there has been a fork and we are on the wrong side.
+				if bc.Block.Header.Number >= (bc.Parent.Header.Number + 1 + 2) {
+					return ErrChainForked
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleDifficulty,
+			Desc: "block difficulty is the same or greater than parent block difficulty",
+			Check: func(bc BlockCheck) error {
+				if bc.Block.Header.Difficulty < bc.Parent.Header.Difficulty {
+					return fmt.Errorf("block difficulty is less than previous block difficulty, parent %d, block %d", bc.Parent.Header.Difficulty, bc.Block.Header.Difficulty)
+				}
+				return nil
+			},
+		},
+		{
+			Name:        RulePOW,
+			Desc:        "block hash has been solved",
+			SkipTrusted: true,
+			Check: func(bc BlockCheck) error {
+				hash := bc.Block.Hash()
+				if !isHashSolved(bc.Block.Header.Difficulty, hash) {
+					return fmt.Errorf("%s invalid block hash", hash)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleNumber,
+			Desc: "block number is the next number",
+			Check: func(bc BlockCheck) error {
+				if nextNumber := bc.Parent.Header.Number + 1; bc.Block.Header.Number != nextNumber {
+					return fmt.Errorf("this block is not the next number, got %d, exp %d", bc.Block.Header.Number, nextNumber)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleParentHash,
+			Desc: "parent hash does match parent block",
+			Check: func(bc BlockCheck) error {
+				if bc.Block.Header.PrevBlockHash != bc.Parent.Hash() {
+					return fmt.Errorf("parent block hash doesn't match our known parent, got %s, exp %s", bc.Block.Header.PrevBlockHash, bc.Parent.Hash())
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleTimestamp,
+			Desc: "block's timestamp is greater than parent block's timestamp",
+			Check: func(bc BlockCheck) error {
+				if bc.Parent.Header.TimeStamp == 0 {
+					return nil
+				}
+
+				parentTime := time.Unix(int64(bc.Parent.Header.TimeStamp), 0)
+				blockTime := time.Unix(int64(bc.Block.Header.TimeStamp), 0)
+				if blockTime.Before(parentTime) {
+					return fmt.Errorf("block timestamp is before parent block, parent %s, block %s", parentTime, blockTime)
+				}
+
+				// This is a check that Ethereum does but we can't because we don't run all the time.
+
+				// dur := blockTime.Sub(parentTime)
+				// if dur.Seconds() > time.Duration(15*time.Second).Seconds() {
+				// 	return fmt.Errorf("block is older than 15 minutes, duration %v", dur)
+				// }
+
+				return nil
+			},
+		},
+		{
+			Name:        RuleStateRoot,
+			Desc:        "state root hash does match current database",
+			SkipTrusted: true,
+			Check: func(bc BlockCheck) error {
+				if stateRoot := bc.stateRoot(); bc.Block.Header.StateRoot != stateRoot {
+					return fmt.Errorf("state of the accounts are wrong, current %s, expected %s", stateRoot, bc.Block.Header.StateRoot)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleTxRoot,
+			Desc: "merkle root does match transactions",
+			Check: func(bc BlockCheck) error {
+				if bc.Block.Header.TransRoot != bc.Block.MerkleTree.RootHex() {
+					return fmt.Errorf("merkle root does not match transactions, got %s, exp %s", bc.Block.MerkleTree.RootHex(), bc.Block.Header.TransRoot)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleTxExpiry,
+			Desc: "transactions have not expired",
+			Check: func(bc BlockCheck) error {
+				for _, tx := range bc.Block.MerkleTree.Values() {
+					if tx.IsExpired(bc.Block.Header.Number) {
+						return fmt.Errorf("transaction %s expired at block %d", tx, tx.ValidUntil)
+					}
+				}
+				return nil
+			},
+		},
+	}
+}
+
+// ChainRules returns the rules checking the block against the monetary
+// policy, the fee market and the rules in effect in the database it's added
+// to, with the genesis rules and then the votes. They run after the header
+// rules.
+func ChainRules() []Rule {
+	rules := []Rule{
+		{
+			Name: RuleMiningReward,
+			Desc: "mining reward follows the monetary policy",
+			Check: func(bc BlockCheck) error {
+				if reward := bc.DB.MiningReward(bc.Block.Header.Number); bc.Block.Header.MiningReward > reward {
+					return fmt.Errorf("mining reward is greater than allowed, got %d, exp %d", bc.Block.Header.MiningReward, reward)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleBaseFee,
+			Desc: "base fee follows the parent block",
+			Check: func(bc BlockCheck) error {
+				if baseFee := bc.DB.NextBaseFee(); bc.Block.Header.BaseFee != baseFee {
+					return fmt.Errorf("base fee is wrong, got %d, exp %d", bc.Block.Header.BaseFee, baseFee)
+				}
+				return nil
+			},
+		},
+	}
+
+	genesisAt := func(bc BlockCheck) genesis.Genesis {
+		return bc.DB.GenesisAt(bc.Block.Header.Number)
+	}
+	rules = append(rules, GenesisRules(genesisAt)...)
+
+	return append(rules, Rule{
+		Name:        RuleVotes,
+		Desc:        "votes are signed by the validators for the parent block",
+		SkipTrusted: true,
+		Check: func(bc BlockCheck) error {
+			if bc.Block.Votes == nil {
+				return nil
+			}
+			return bc.DB.ValidateVotes(bc.Block)
+		},
+	})
+}
+
+// GenesisRules returns the rules checking the block against the forks, the
+// gas schedule and the chain id in the genesis, which need no accounts. The
+// function returns the genesis in effect for the block being checked, so a
+// database and a verifier without one validate with the same rules.
+func GenesisRules(genesisAt func(bc BlockCheck) genesis.Genesis) []Rule {
+	return []Rule{
+		{
+			Name: RuleVersion,
+			Desc: "version is in effect for the block",
+			Check: func(bc BlockCheck) error {
+				if version := genesisAt(bc).BlockVersionAt(bc.Block.Header.Number); bc.Block.Header.Version != version {
+					return fmt.Errorf("block version is wrong, got %d, exp %d", bc.Block.Header.Version, version)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleEncoding,
+			Desc: "encoding is in effect for the block",
+			Check: func(bc BlockCheck) error {
+				if encoding := genesisAt(bc).EncodingAt(bc.Block.Header.Number); bc.Block.Header.Encoding != encoding {
+					return fmt.Errorf("block encoding is wrong, got %d, exp %d", bc.Block.Header.Encoding, encoding)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleGasUsed,
+			Desc: "gas used is within the block gas limit",
+			Check: func(bc BlockCheck) error {
+
+				// Blocks mined before the gas used was recorded in the header carry 0,
+				// which is only accepted when the chain has no block gas limit and the
+				// rule set requiring it isn't in effect.
+				gen := genesisAt(bc)
+				used := gasUsed(bc.Block.MerkleTree.Values())
+				limit := gen.BlockGasLimit
+				strict := limit > 0 || gen.RulesAt(bc.Block.Header.Number).StrictGasUsed
+				if bc.Block.Header.GasUsed != used && (bc.Block.Header.GasUsed != 0 || strict) {
+					return fmt.Errorf("gas used is wrong, got %d, exp %d", bc.Block.Header.GasUsed, used)
+				}
+
+				if limit > 0 && used > limit {
+					return fmt.Errorf("gas used %d is over the block gas limit %d", used, limit)
+				}
+				return nil
+			},
+		},
+		{
+			Name: RuleTxGas,
+			Desc: "transactions pay the base fee and the gas they cost",
+			Check: func(bc BlockCheck) error {
+				gen := genesisAt(bc)
+				encoding := gen.EncodingAt(bc.Block.Header.Number)
+				for _, tx := range bc.Block.MerkleTree.Values() {
+					if tx.Encoding > encoding {
+						canonical, _ := gen.ForkBlock(genesis.ForkCanonicalEncoding)
+						return fmt.Errorf("transaction %s: encoding %d is not in effect until block %d", tx, tx.Encoding, canonical)
+					}
+
+					if tx.GasPrice < bc.Block.Header.BaseFee {
+						return fmt.Errorf("transaction %s: gas price %d is less than the base fee %d", tx, tx.GasPrice, bc.Block.Header.BaseFee)
+					}
+
+					if units := gen.GasUnitsAt(bc.Block.Header.Number, len(tx.Data), tx.Value > 0); tx.GasUnits != units {
+						return fmt.Errorf("transaction %s: gas units %d don't match the computed cost %d", tx, tx.GasUnits, units)
+					}
+				}
+				return nil
+			},
+		},
+		{
+			Name:        RuleTxSignatures,
+			Desc:        "transactions are for this chain and properly signed",
+			SkipTrusted: true,
+			Check: func(bc BlockCheck) error {
+				return ValidateTransactions(bc.Block.MerkleTree.Values(), genesisAt(bc), bc.Block.Hash())
+			},
+		},
+	}
+}
@@ -0,0 +1,143 @@
+package database_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_Pipeline(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	var ran []string
+	rule := func(name string, skipTrusted bool, err error) database.Rule {
+		return database.Rule{
+			Name: name,
+			Desc: name,
+			Check: func(bc database.BlockCheck) error {
+				ran = append(ran, name)
+				return err
+			},
+			SkipTrusted: skipTrusted,
+		}
+	}
+
+	p := database.NewPipeline(rule("first", false, nil), rule("expensive", true, nil))
+	p.Append(rule("last", false, nil))
+
+	if err := p.InsertBefore("expensive", rule("engine", false, nil)); err != nil {
+		t.Fatalf("Should be able to insert a rule: %v", err)
+	}
+	if err := p.InsertBefore("missing", rule("engine", false, nil)); err == nil {
+		t.Fatalf("Should not be able to insert before a missing rule.")
+	}
+
+	exp := "first,engine,expensive,last"
+	if got := strings.Join(p.Names(), ","); got != exp {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should have the rules in order.")
+	}
+
+	if err := p.Validate(database.BlockCheck{}, ev); err != nil {
+		t.Fatalf("Should be able to validate the block: %v", err)
+	}
+	if got := strings.Join(ran, ","); got != exp {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should run the rules in order.")
+	}
+
+	ran = nil
+	if err := p.Validate(database.BlockCheck{Trusted: true}, ev); err != nil {
+		t.Fatalf("Should be able to validate a trusted block: %v", err)
+	}
+	if exp := "first,engine,last"; strings.Join(ran, ",") != exp {
+		t.Logf("got: %s", strings.Join(ran, ","))
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should skip the expensive rule for a trusted block.")
+	}
+
+	// A failing rule stops the rules after it from running.
+	errEngine := errors.New("engine failed")
+	p = database.NewPipeline(rule("first", false, nil), rule("engine", false, errEngine), rule("last", false, nil))
+
+	ran = nil
+	if err := p.Validate(database.BlockCheck{}, ev); !errors.Is(err, errEngine) {
+		t.Fatalf("Should return the error of the failed rule: %v", err)
+	}
+	if exp := "first,engine"; strings.Join(ran, ",") != exp {
+		t.Logf("got: %s", strings.Join(ran, ","))
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should stop at the failed rule.")
+	}
+
+	stats := p.Stats()
+	if len(stats) != 2 {
+		t.Fatalf("Should have stats for the rules that ran: %+v", stats)
+	}
+	if stats[0].Name != "engine" || stats[0].Runs != 1 || stats[0].Failures != 1 {
+		t.Fatalf("Should have recorded the failure: %+v", stats[0])
+	}
+	if stats[1].Name != "first" || stats[1].Runs != 1 || stats[1].Failures != 0 {
+		t.Fatalf("Should have recorded the run: %+v", stats[1])
+	}
+}
+
+func Test_TrustedTxRoot(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	db, err := database.New(gen, MockStorage{}, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mine := func(value uint64) database.Block {
+		blockTx, err := sign(database.Tx{
+			ChainID: 1,
+			Nonce:   1,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   value,
+		}, 1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			MiningReward:  db.MiningReward(1),
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block 1: %v", err)
+		}
+
+		return block
+	}
+
+	block := mine(10)
+	if err := db.ValidateTrustedBlock(block, ev); err != nil {
+		t.Fatalf("Should accept a trusted block: %v", err)
+	}
+
+	// The header and its proof of work are kept, the transactions are not
+	// the ones the header commits to.
+	block.MerkleTree = mine(900).MerkleTree
+	if err := db.ValidateTrustedBlock(block, ev); err == nil {
+		t.Fatalf("Should not accept a trusted block with a tampered transaction list.")
+	}
+}
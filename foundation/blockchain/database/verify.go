@@ -0,0 +1,261 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+// Truncater interface represents the behavior required to be implemented by
+// any storage package that can remove blocks from the end of the chain.
+type Truncater interface {
+	Truncate(num uint64) error
+}
+
+// VerifyResult represents the outcome of verifying the blockchain in storage.
+type VerifyResult struct {
+	LatestValidBlock uint64 `json:"latest_valid_block"`
+	CorruptBlock     uint64 `json:"corrupt_block,omitempty"`
+	Error            string `json:"error,omitempty"`
+	Repaired         bool   `json:"repaired"`
+}
+
+// =============================================================================
+
+// Verify walks the blockchain in storage and re-validates each block hash,
+// parent link, POW solution and the account state recomputed from genesis.
+// The first corrupted block is reported. If repair is true, the storage is
+// truncated to the last valid block and the database is updated to reflect
+// the state of the chain at that block. The walk stops with an error if the
+// context is cancelled.
+func (db *Database) Verify(ctx context.Context, repair bool, evHandler func(v string, args ...any)) (VerifyResult, error) {
+	result, vdb, err := verify(ctx, db.genesis, db.storage, evHandler)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	if result.CorruptBlock == 0 || !repair {
+		return result, nil
+	}
+
+	if err := truncate(db.storage, result.LatestValidBlock, evHandler); err != nil {
+		return result, err
+	}
+	db.cache.removeAfter(result.LatestValidBlock)
+	db.replace(vdb)
+
+	result.Repaired = true
+
+	return result, nil
+}
+
+// Rollback removes the blocks after the specified block from storage so the
+// database reflects the state of the chain at that block. Recently committed
+// blocks are undone directly, otherwise the remaining chain is replayed from
+// genesis. Rolling back to block 0 is a Reset.
+func (db *Database) Rollback(ctx context.Context, num uint64, evHandler func(v string, args ...any)) error {
+	if num == 0 {
+		return db.Reset()
+	}
+
+	if err := truncate(db.storage, num, evHandler); err != nil {
+		return err
+	}
+	db.cache.removeAfter(num)
+
+	db.mu.Lock()
+	undone := db.undoTo(num)
+	db.mu.Unlock()
+
+	if undone {
+		evHandler("database: Rollback: undo committed blocks to blk[%d]", num)
+		return nil
+	}
+
+	result, vdb, err := verify(ctx, db.genesis, db.storage, evHandler)
+	if err != nil {
+		return err
+	}
+
+	if result.CorruptBlock != 0 {
+		return fmt.Errorf("replay: blk[%d]: %s", result.CorruptBlock, result.Error)
+	}
+
+	db.replace(vdb)
+
+	return nil
+}
+
+// VerifyStorage performs the same checks as Verify against storage that is
+// not loaded into a database. This allows a chain that can't be loaded to be
+// verified and repaired offline.
+func VerifyStorage(ctx context.Context, gen genesis.Genesis, storage Storage, repair bool, evHandler func(v string, args ...any)) (VerifyResult, error) {
+	result, _, err := verify(ctx, gen, storage, evHandler)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	if result.CorruptBlock == 0 || !repair {
+		return result, nil
+	}
+
+	if err := truncate(storage, result.LatestValidBlock, evHandler); err != nil {
+		return result, err
+	}
+
+	result.Repaired = true
+
+	return result, nil
+}
+
+// =============================================================================
+
+// verify replays the chain in storage against a separate database so the
+// state can be recomputed from genesis without touching the live accounts.
+func verify(ctx context.Context, gen genesis.Genesis, storage Storage, evHandler func(v string, args ...any)) (VerifyResult, *Database, error) {
+	accounts, err := genesisAccounts(gen)
+	if err != nil {
+		return VerifyResult{}, nil, err
+	}
+
+	vdb := Database{
+		genesis:  gen,
+		accounts: newAccountSet(accounts),
+		storage:  storage,
+		cache:    newBlockCache(0),
+		stats:    newChainStats(),
+		supply:   gen.GenesisSupply(),
+		gov:      newGovernance(),
+		pipeline: newBlockPipeline(),
+	}
+
+	var result VerifyResult
+
+	iter := IteratorCtx(ctx, storage.ForEach())
+	for blockData, err := iter.Next(); !iter.Done(); blockData, err = iter.Next() {
+		number := vdb.latestBlock.Header.Number + 1
+
+		// A cancelled walk says nothing about the state of the chain.
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return VerifyResult{}, nil, ctxErr
+		}
+
+		var block Block
+		if err == nil {
+			block, err = verifyBlock(blockData, &vdb, evHandler)
+		}
+
+		if err != nil {
+			evHandler("database: Verify: blk[%d]: CORRUPT: %s", number, err)
+
+			result.CorruptBlock = number
+			result.Error = err.Error()
+			break
+		}
+
+		for _, tx := range block.MerkleTree.Values() {
+			vdb.ApplyTransaction(block, tx)
+		}
+		vdb.ApplyMiningReward(block)
+
+		vdb.latestBlock = block
+		vdb.stats.apply(block)
+	}
+
+	result.LatestValidBlock = vdb.latestBlock.Header.Number
+
+	return result, &vdb, nil
+}
+
+// replace updates the database to reflect the state replayed into the
+// specified database.
+func (db *Database) replace(vdb *Database) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.accounts.replace(vdb.accounts)
+	db.latestBlock = vdb.latestBlock
+	db.stats = vdb.stats
+	db.supply = vdb.supply
+	db.gov = vdb.gov
+	db.undo = nil
+}
+
+// truncate removes the blocks after the last valid block from storage.
+func truncate(storage Storage, latestValidBlock uint64, evHandler func(v string, args ...any)) error {
+	truncater, ok := storage.(Truncater)
+	if !ok {
+		return errors.New("storage does not support truncating blocks")
+	}
+
+	evHandler("database: Verify: truncate: latest valid blk[%d]", latestValidBlock)
+
+	if err := truncater.Truncate(latestValidBlock); err != nil {
+		return fmt.Errorf("truncate: %w", err)
+	}
+
+	return nil
+}
+
+// verifyBlock converts the stored block and performs the block validation
+// against the database replayed up to the previous block plus a check the
+// stored hash matches the hash calculated from the header.
+func verifyBlock(blockData BlockData, vdb *Database, evHandler func(v string, args ...any)) (Block, error) {
+	block, err := ToBlock(blockData)
+	if err != nil {
+		return Block{}, err
+	}
+
+	if hash := block.Hash(); hash != blockData.Hash {
+		return Block{}, errcode.Errorf(errcode.StorageCorrupt, "stored block hash doesn't match, got %s, exp %s", blockData.Hash, hash)
+	}
+
+	if err := vdb.ValidateBlock(block, evHandler); err != nil {
+		return Block{}, err
+	}
+
+	return block, nil
+}
+
+// genesisAccounts constructs the set of accounts defined by genesis.
+func genesisAccounts(gen genesis.Genesis) (map[AccountID]Account, error) {
+	accounts := make(map[AccountID]Account)
+	for accountStr, balance := range gen.Balances {
+		accountID, err := ToAccountID(accountStr)
+		if err != nil {
+			return nil, err
+		}
+		accounts[accountID] = newAccount(accountID, balance)
+	}
+
+	for accountStr, vesting := range gen.Vesting {
+		account, exists := accounts[AccountID(accountStr)]
+		if !exists {
+			return nil, fmt.Errorf("vesting account %s doesn't have a genesis balance", accountStr)
+		}
+
+		if vesting.Locked > account.Balance || vesting.EndBlock < vesting.StartBlock {
+			return nil, fmt.Errorf("vesting account %s has an invalid schedule", accountStr)
+		}
+
+		vesting := vesting
+		account.Vesting = &vesting
+		accounts[account.AccountID] = account
+	}
+
+	for accountStr, bond := range gen.Bonds {
+		account, exists := accounts[AccountID(accountStr)]
+		if !exists || bond > account.Balance {
+			return nil, fmt.Errorf("bond account %s doesn't have the genesis balance to bond", accountStr)
+		}
+
+		account.Balance -= bond
+		account.Bonded = bond
+		accounts[account.AccountID] = account
+	}
+
+	return accounts, nil
+}
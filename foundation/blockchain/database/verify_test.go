@@ -0,0 +1,112 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+func Test_Verify(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4": 1000},
+	}
+
+	storage, err := disk.New(t.TempDir())
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	mineBlocks(t, db, gen, 3)
+
+	result, err := db.Verify(context.Background(), false, ev)
+	if err != nil {
+		t.Fatalf("Should be able to verify the chain: %v", err)
+	}
+	if result.CorruptBlock != 0 || result.LatestValidBlock != 3 {
+		t.Fatalf("Should have a valid chain: %+v", result)
+	}
+
+	// Tamper with the second block so the stored hash no longer matches.
+	blockData, err := storage.GetBlock(2)
+	if err != nil {
+		t.Fatalf("Should be able to read block 2: %v", err)
+	}
+	blockData.Header.MiningReward++
+	if err := storage.Write(blockData); err != nil {
+		t.Fatalf("Should be able to write block 2: %v", err)
+	}
+
+	result, err = db.Verify(context.Background(), true, ev)
+	if err != nil {
+		t.Fatalf("Should be able to verify the chain: %v", err)
+	}
+	if result.CorruptBlock != 2 || result.LatestValidBlock != 1 || !result.Repaired {
+		t.Fatalf("Should have found and repaired block 2: %+v", result)
+	}
+
+	if db.LatestBlock().Header.Number != 1 {
+		t.Logf("got: %d", db.LatestBlock().Header.Number)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should have moved the latest block back.")
+	}
+
+	if _, err := storage.GetBlock(2); err == nil {
+		t.Fatalf("Should have truncated the chain.")
+	}
+}
+
+// mineBlocks mines and applies the specified number of blocks, each with a
+// single transaction, to the database.
+func mineBlocks(t *testing.T, db *database.Database, gen genesis.Genesis, blocks uint64) {
+	ev := func(v string, args ...any) {}
+
+	start := db.LatestBlock().Header.Number + 1
+	for i := start; i < start+blocks; i++ {
+		tx := database.Tx{
+			ChainID: 1,
+			Nonce:   i,
+			FromID:  "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+			ToID:    "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+			Value:   10,
+		}
+
+		blockTx, err := sign(tx, gen.BaseFee+1)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block, err := database.POW(context.Background(), database.POWArgs{
+			BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+			Difficulty:    gen.Difficulty,
+			MiningReward:  db.MiningReward(i),
+			BaseFee:       db.NextBaseFee(),
+			PrevBlock:     db.LatestBlock(),
+			StateRoot:     db.HashState(),
+			Trans:         []database.BlockTx{blockTx},
+			EvHandler:     ev,
+		})
+		if err != nil {
+			t.Fatalf("Should be able to mine block %d: %v", i, err)
+		}
+
+		if err := db.Write(block); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+		db.ApplyTransaction(block, blockTx)
+		db.ApplyMiningReward(block)
+		db.UpdateLatestBlock(block)
+	}
+}
@@ -0,0 +1,211 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// voteTag is mixed into the message a validator signs to vote for a block.
+const voteTag = "\x19Ardan Vote:\n"
+
+// CORE NOTE: Under PoS every validator that registered a BLS key votes for
+// each block it accepts by signing the block hash. The votes are shared with
+// the other validators and the proposer of the next block adds them together
+// into a single signature carried in the block, with a bitmap recording which
+// validators voted. The size of the votes grows by one bit per validator
+// instead of a full signature each. Votes aren't part of the block hash, the
+// same as the proposer's signature.
+
+// Vote represents the BLS signature of a validator for a block.
+type Vote struct {
+	Number    uint64    `json:"number"`
+	BlockHash string    `json:"block_hash"`
+	VoterID   AccountID `json:"voter"`
+	Signature []byte    `json:"signature"`
+}
+
+// NewVote signs a vote by the validator for the block.
+func NewVote(chainID uint16, block Block, voterID AccountID, key *signature.BLSPrivateKey) Vote {
+	hash := block.Hash()
+
+	return Vote{
+		Number:    block.Header.Number,
+		BlockHash: hash,
+		VoterID:   voterID,
+		Signature: key.Sign(VoteMessage(chainID, hash)),
+	}
+}
+
+// Votes represents the votes for the parent of a block aggregated into a
+// single signature.
+type Votes struct {
+	Signers   []byte `json:"signers"`   // Bitmap of the validators who voted, in the order returned by Voters.
+	Signature []byte `json:"signature"` // Sum of the BLS signatures of the validators who voted.
+}
+
+// Count returns the number of validators who voted.
+func (v Votes) Count() int {
+	var n int
+	for _, b := range v.Signers {
+		for ; b != 0; b &= b - 1 {
+			n++
+		}
+	}
+
+	return n
+}
+
+// VoteMessage returns the message a validator signs to vote for the block
+// with the specified hash on the chain.
+func VoteMessage(chainID uint16, blockHash string) []byte {
+	var id [2]byte
+	binary.BigEndian.PutUint16(id[:], chainID)
+
+	msg := append([]byte(voteTag), id[:]...)
+	return append(msg, blockHash...)
+}
+
+// =============================================================================
+
+// Voters returns the validators that can vote for the latest block, which
+// are the bonded validators with a registered BLS key in account order.
+func (db *Database) Voters() []AccountID {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	voters, _ := db.voters()
+	return voters
+}
+
+// ValidateVote checks the vote is for the latest block and is signed by one
+// of the voters.
+func (db *Database) ValidateVote(vote Vote) error {
+	latest := db.LatestBlock()
+	if vote.Number != latest.Header.Number || vote.BlockHash != latest.Hash() {
+		return fmt.Errorf("vote is for block %d %s, latest block is %d %s", vote.Number, vote.BlockHash, latest.Header.Number, latest.Hash())
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	account := db.accounts.get(vote.VoterID)
+	if account.Bonded == 0 || account.BLSKey == "" {
+		return fmt.Errorf("%s is not a voter", vote.VoterID)
+	}
+
+	key, err := hexutil.Decode(account.BLSKey)
+	if err != nil {
+		return fmt.Errorf("bls key of %s: %w", vote.VoterID, err)
+	}
+
+	if err := signature.VerifyBLS(key, VoteMessage(db.genesis.ChainID, vote.BlockHash), vote.Signature); err != nil {
+		return fmt.Errorf("vote from %s: %w", vote.VoterID, err)
+	}
+
+	return nil
+}
+
+// AggregateVotes adds the votes for the latest block together. The votes must
+// have passed ValidateVote.
+func (db *Database) AggregateVotes(votes []Vote) (Votes, error) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	voters, _ := db.voters()
+
+	index := make(map[AccountID]int, len(voters))
+	for i, voterID := range voters {
+		index[voterID] = i
+	}
+
+	signers := make([]byte, (len(voters)+7)/8)
+	var sigs [][]byte
+	for _, vote := range votes {
+		i, exists := index[vote.VoterID]
+		if !exists || signers[i/8]&(1<<(i%8)) != 0 {
+			continue
+		}
+		signers[i/8] |= 1 << (i % 8)
+		sigs = append(sigs, vote.Signature)
+	}
+
+	sig, err := signature.AggregateBLS(sigs)
+	if err != nil {
+		return Votes{}, err
+	}
+
+	return Votes{Signers: signers, Signature: sig}, nil
+}
+
+// ValidateVotes checks the votes carried in the block are signed by the
+// validators in the bitmap for the parent of the block. The block must pass
+// ValidateBlock first so the parent is known to be the latest block.
+func (db *Database) ValidateVotes(block Block) error {
+	if block.Votes == nil {
+		return nil
+	}
+
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	voters, keys := db.voters()
+
+	if len(block.Votes.Signers) != (len(voters)+7)/8 {
+		return fmt.Errorf("votes bitmap is %d bytes for %d voters", len(block.Votes.Signers), len(voters))
+	}
+
+	var signers [][]byte
+	for i := range voters {
+		if block.Votes.Signers[i/8]&(1<<(i%8)) != 0 {
+			signers = append(signers, keys[i])
+		}
+	}
+
+	// Bits past the last voter must not be set.
+	if len(signers) != block.Votes.Count() {
+		return errors.New("votes bitmap marks unknown voters")
+	}
+
+	msg := VoteMessage(db.genesis.ChainID, block.Header.PrevBlockHash)
+	if err := signature.VerifyBLSAggregate(signers, msg, block.Votes.Signature); err != nil {
+		return fmt.Errorf("votes: %w", err)
+	}
+
+	return nil
+}
+
+// voters returns the bonded validators with a registered BLS key in account
+// order along with their keys. The caller must hold the lock.
+func (db *Database) voters() ([]AccountID, [][]byte) {
+	keys := make(map[AccountID][]byte)
+	db.accounts.forEach(func(account Account) {
+		if account.Bonded == 0 || account.BLSKey == "" {
+			return
+		}
+		if key, err := hexutil.Decode(account.BLSKey); err == nil {
+			keys[account.AccountID] = key
+		}
+	})
+
+	voters := make([]AccountID, 0, len(keys))
+	for accountID := range keys {
+		voters = append(voters, accountID)
+	}
+
+	// Map iteration is random so the voters need a fixed order.
+	sort.Slice(voters, func(i, j int) bool {
+		return voters[i] < voters[j]
+	})
+
+	ordered := make([][]byte, len(voters))
+	for i, accountID := range voters {
+		ordered[i] = keys[accountID]
+	}
+
+	return voters, ordered
+}
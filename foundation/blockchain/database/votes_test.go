@@ -0,0 +1,158 @@
+package database_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+)
+
+func Test_Votes(t *testing.T) {
+	validators := []database.AccountID{
+		"0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4",
+		"0xF01813E4B85e178A83e29B8E7bF26BD830a25f32",
+		"0xbEE6ACE826eC3DE1B6349888B9151B92522F7F76",
+	}
+	const miner = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+
+	gen := genesis.Genesis{
+		ChainID:  1,
+		Balances: map[string]uint64{},
+	}
+	for _, accountID := range validators {
+		gen.Balances[string(accountID)] = 1000
+	}
+
+	db, err := database.New(gen, MockStorage{}, nil)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	keys := make(map[database.AccountID]*signature.BLSPrivateKey)
+	for i, accountID := range validators {
+		seed := make([]byte, 32)
+		seed[0] = byte(i + 1)
+
+		key, err := signature.DeriveBLSKey(seed)
+		if err != nil {
+			t.Fatalf("Should be able to derive a bls key: %v", err)
+		}
+		keys[accountID] = key
+	}
+
+	// lock bonds the stake of the validator registering the bls key with
+	// the specified proof.
+	lock := func(accountID database.AccountID, nonce uint64, proof []byte) error {
+		data, err := database.BondOp{Op: database.BondLock, BLSKey: keys[accountID].PublicKey(), BLSProof: proof}.Data()
+		if err != nil {
+			t.Fatalf("Should be able to encode the bond operation: %v", err)
+		}
+
+		blockTx, err := sign(database.Tx{ChainID: 1, Nonce: nonce, FromID: accountID, ToID: miner, Value: 500, Data: data}, 0)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+
+		block := database.Block{Header: database.BlockHeader{Number: 1, BeneficiaryID: miner}}
+		return db.ApplyTransaction(block, blockTx)
+	}
+
+	if err := lock(validators[0], 1, keys[validators[1]].ProvePossession()); err == nil {
+		t.Fatalf("Should not register a bls key with the proof for another key.")
+	}
+
+	for _, accountID := range validators {
+		if err := lock(accountID, 1, keys[accountID].ProvePossession()); err != nil {
+			t.Fatalf("Should be able to register the bls key of %s: %v", accountID, err)
+		}
+	}
+
+	voters := db.Voters()
+	if len(voters) != len(validators) {
+		t.Logf("got: %v", voters)
+		t.Logf("exp: %v", validators)
+		t.Fatalf("Should have every validator as a voter.")
+	}
+
+	// Two of the three validators vote for the latest block.
+	latest := db.LatestBlock()
+	var votes []database.Vote
+	for _, accountID := range validators[:2] {
+		vote := database.NewVote(1, latest, accountID, keys[accountID])
+		if err := db.ValidateVote(vote); err != nil {
+			t.Fatalf("Should accept the vote from %s: %v", accountID, err)
+		}
+		votes = append(votes, vote)
+	}
+
+	forged := database.NewVote(1, latest, validators[2], keys[validators[0]])
+	if err := db.ValidateVote(forged); err == nil {
+		t.Fatalf("Should not accept a vote signed with another validator's key.")
+	}
+
+	agg, err := db.AggregateVotes(votes)
+	if err != nil {
+		t.Fatalf("Should be able to aggregate the votes: %v", err)
+	}
+
+	if agg.Count() != 2 || len(agg.Signature) != signature.BLSSignatureSize {
+		t.Logf("got: %d votes %d bytes", agg.Count(), len(agg.Signature))
+		t.Logf("exp: %d votes %d bytes", 2, signature.BLSSignatureSize)
+		t.Fatalf("Should carry both votes in a single signature.")
+	}
+
+	blockTx, err := sign(database.Tx{ChainID: 1, Nonce: 2, FromID: validators[0], ToID: miner, Value: 10}, 0)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: miner,
+		PrevBlock:     latest,
+		StateRoot:     db.HashState(),
+		Trans:         []database.BlockTx{blockTx},
+		EvHandler:     func(v string, args ...any) {},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to create the block: %v", err)
+	}
+	block.Votes = &agg
+
+	if err := db.ValidateVotes(block); err != nil {
+		t.Fatalf("Should accept the aggregated votes: %v", err)
+	}
+
+	// The votes need to survive the trip through the encoding.
+	data, err := database.EncodeBlockData(database.NewBlockData(block))
+	if err != nil {
+		t.Fatalf("Should be able to encode the block: %v", err)
+	}
+
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode the block: %v", err)
+	}
+
+	decoded, err := database.ToBlock(blockData)
+	if err != nil {
+		t.Fatalf("Should be able to convert the block: %v", err)
+	}
+
+	if err := db.ValidateVotes(decoded); err != nil {
+		t.Fatalf("Should accept the decoded votes: %v", err)
+	}
+
+	// Claiming the third validator voted breaks the aggregate signature.
+	tampered := database.Votes{Signers: []byte{agg.Signers[0] | 0x07}, Signature: agg.Signature}
+	block.Votes = &tampered
+	if err := db.ValidateVotes(block); err == nil {
+		t.Fatalf("Should not accept votes marking a validator that didn't vote.")
+	}
+
+	tampered = database.Votes{Signers: []byte{agg.Signers[0] | 0x80}, Signature: agg.Signature}
+	if err := db.ValidateVotes(block); err == nil {
+		t.Fatalf("Should not accept votes marking an unknown voter.")
+	}
+}
@@ -0,0 +1,112 @@
+// Package errcode classifies the errors returned by the blockchain packages
+// with a stable code, so callers can tell an account without the funds from
+// a transaction with the wrong nonce without matching on the message. The
+// code travels with the error through wrapping and is returned by the APIs
+// and the RPC layer.
+package errcode
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Code identifies a class of failure.
+type Code string
+
+// Set of codes for validation failures.
+const (
+	InvalidTx         Code = "invalid_tx"
+	InvalidSignature  Code = "invalid_signature"
+	BadNonce          Code = "bad_nonce"
+	InsufficientFunds Code = "insufficient_funds"
+	TxExpired         Code = "tx_expired"
+	InvalidBlock      Code = "invalid_block"
+	ChainForked       Code = "chain_forked"
+)
+
+// Set of codes for mempool failures.
+const (
+	Underpriced  Code = "underpriced"
+	PolicyDenied Code = "policy_denied"
+	NotFound     Code = "not_found"
+)
+
+// Set of codes for sync failures.
+const (
+	PeerUnreachable Code = "peer_unreachable"
+	SyncFailed      Code = "sync_failed"
+)
+
+// Set of codes for storage failures.
+const (
+	StorageFailure Code = "storage_failure"
+	StorageCorrupt Code = "storage_corrupt"
+)
+
+// Unknown is returned for an error that doesn't carry a code.
+const Unknown Code = "unknown"
+
+// =============================================================================
+
+// Error represents an error with a code.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+// New constructs an error with the code and text, used for sentinel errors
+// compared with errors.Is.
+func New(code Code, text string) error {
+	return &Error{Code: code, Err: errors.New(text)}
+}
+
+// Errorf constructs an error with the code and a formatted message. The %w
+// verb wraps another error the same as fmt.Errorf.
+func Errorf(code Code, format string, args ...any) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap gives the error the code, unless it already carries a code which is
+// more specific about what failed. A nil error is returned as nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var ce *Error
+	if errors.As(err, &ce) {
+		return err
+	}
+
+	return &Error{Code: code, Err: err}
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+// Unwrap returns the error the code was given to.
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Of returns the code carried by the error, Unknown if it has none and an
+// empty code for a nil error.
+func Of(err error) Code {
+	if err == nil {
+		return ""
+	}
+
+	var ce *Error
+	if !errors.As(err, &ce) {
+		return Unknown
+	}
+
+	return ce.Code
+}
+
+// Is reports if the error carries the code.
+func Is(err error, code Code) bool {
+	return Of(err) == code
+}
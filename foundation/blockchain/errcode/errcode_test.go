@@ -0,0 +1,53 @@
+package errcode_test
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+)
+
+func Test_Code(t *testing.T) {
+	errNonce := errcode.New(errcode.BadNonce, "wrong nonce")
+
+	err := fmt.Errorf("transaction invalid, %w, got %d, exp %d", errNonce, 3, 2)
+	if got := errcode.Of(err); got != errcode.BadNonce {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", errcode.BadNonce)
+		t.Fatalf("Should carry the code through wrapping.")
+	}
+
+	if !errors.Is(err, errNonce) {
+		t.Fatalf("Should match the sentinel error with errors.Is.")
+	}
+
+	if exp := "transaction invalid, wrong nonce, got 3, exp 2"; err.Error() != exp {
+		t.Logf("got: %s", err)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should keep the message of the error.")
+	}
+
+	if got := errcode.Of(errcode.Wrap(errcode.InvalidBlock, err)); got != errcode.BadNonce {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", errcode.BadNonce)
+		t.Fatalf("Should keep the code an error already carries.")
+	}
+
+	plain := errors.New("disk full")
+	if got := errcode.Of(errcode.Wrap(errcode.StorageFailure, plain)); got != errcode.StorageFailure {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", errcode.StorageFailure)
+		t.Fatalf("Should give the code to an error without one.")
+	}
+
+	if got := errcode.Of(plain); got != errcode.Unknown {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", errcode.Unknown)
+		t.Fatalf("Should report an unknown code for an error without one.")
+	}
+
+	if errcode.Wrap(errcode.StorageFailure, nil) != nil || errcode.Of(nil) != "" {
+		t.Fatalf("Should leave a nil error alone.")
+	}
+}
@@ -0,0 +1,368 @@
+// Package explorer provides a GraphQL schema over the blocks, transactions and
+// accounts of the blockchain so explorers can ask for exactly the fields they
+// need in a single request.
+package explorer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+)
+
+// Set of values that bound the size of a page.
+const (
+	defaultFirst = 10
+	maxFirst     = 100
+)
+
+// Explorer executes GraphQL queries against the blockchain state.
+type Explorer struct {
+	state  *state.State
+	schema *graphql.Schema
+}
+
+// New constructs an explorer for the specified state.
+func New(st *state.State) *Explorer {
+	e := Explorer{
+		state: st,
+	}
+
+	e.schema = graphql.MustNewSchema(
+		e.queryType(),
+		blockType(),
+		transactionType(),
+		accountType(e.accountTransactions),
+		pageType("BlockPage", "Block"),
+		pageType("TransactionPage", "Transaction"),
+		pageType("AccountPage", "Account"),
+	)
+
+	return &e
+}
+
+// Execute executes the GraphQL request.
+func (e *Explorer) Execute(ctx context.Context, req graphql.Request) graphql.Response {
+	return e.schema.Execute(ctx, req)
+}
+
+// =============================================================================
+
+// queryType defines the root fields that can be queried.
+func (e *Explorer) queryType() graphql.Object {
+	return graphql.Object{
+		Name: "Query",
+		Fields: map[string]graphql.Field{
+			"latestBlock":    {Type: "Block", Resolve: e.latestBlock},
+			"finalizedBlock": {Type: "Block", Resolve: e.finalizedBlock},
+			"block":          {Type: "Block", Resolve: e.block},
+			"blocks":         {Type: "BlockPage", Resolve: e.blocks},
+			"transaction":    {Type: "Transaction", Resolve: e.transaction},
+			"transactions":   {Type: "TransactionPage", Resolve: e.transactions},
+			"mempool":        {Type: "Transaction", Resolve: e.mempool},
+			"account":        {Type: "Account", Resolve: e.account},
+			"accounts":       {Type: "AccountPage", Resolve: e.accounts},
+		},
+	}
+}
+
+// latestBlock returns the latest block in the chain.
+func (e *Explorer) latestBlock(ctx context.Context, source any, args map[string]any) (any, error) {
+	block := e.state.LatestBlock()
+	if block.Header.Number == 0 {
+		return nil, nil
+	}
+
+	return block, nil
+}
+
+// finalizedBlock returns the latest block that can't be reorganized.
+func (e *Explorer) finalizedBlock(ctx context.Context, source any, args map[string]any) (any, error) {
+	block := e.state.LatestFinalizedBlock()
+	if block.Header.Number == 0 {
+		return nil, nil
+	}
+
+	return block, nil
+}
+
+// block returns the block for the specified number.
+func (e *Explorer) block(ctx context.Context, source any, args map[string]any) (any, error) {
+	number, err := graphql.Uint(args, "number", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	if number == 0 || number > e.state.LatestBlock().Header.Number {
+		return nil, nil
+	}
+
+	blocks := e.state.QueryBlocksByNumber(ctx, number, number)
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	return blocks[0], nil
+}
+
+// blocks returns a page of blocks in the range that can be filtered by the
+// beneficiary. Only the blocks for the page are read unless filtering.
+func (e *Explorer) blocks(ctx context.Context, source any, args map[string]any) (any, error) {
+	from, to, err := e.blockRange(args)
+	if err != nil {
+		return nil, err
+	}
+
+	beneficiary, err := accountArg(args, "beneficiary")
+	if err != nil {
+		return nil, err
+	}
+
+	first, offset, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if from > to {
+		return page{items: []database.Block{}}, nil
+	}
+
+	if beneficiary == "" {
+		total := to - from + 1
+		if offset >= total {
+			return page{totalCount: total, items: []database.Block{}}, nil
+		}
+
+		start := from + offset
+		end := start + first - 1
+		if end > to {
+			end = to
+		}
+
+		p := page{
+			totalCount:  total,
+			hasNextPage: end < to,
+			items:       e.state.QueryBlocksByNumber(ctx, start, end),
+		}
+
+		return p, nil
+	}
+
+	var blocks []database.Block
+	for _, block := range e.state.QueryBlocksByNumber(ctx, from, to) {
+		if block.Header.BeneficiaryID == beneficiary {
+			blocks = append(blocks, block)
+		}
+	}
+
+	return paginate(blocks, first, offset), nil
+}
+
+// transaction returns the transaction for the specified hash which can be in
+// the mempool or a block.
+func (e *Explorer) transaction(ctx context.Context, source any, args map[string]any) (any, error) {
+	hash, err := graphql.String(args, "hash", "")
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tx := range e.state.Mempool() {
+		if tx.TxHash() == hash {
+			return transaction{tx: tx}, nil
+		}
+	}
+
+	tx, block, err := e.state.QueryTransaction(ctx, hash)
+	if err != nil {
+		if errors.Is(err, state.ErrTxNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return transaction{tx: tx, block: &block}, nil
+}
+
+// transactions returns a page of mined transactions in the block range that
+// can be filtered by the account.
+func (e *Explorer) transactions(ctx context.Context, source any, args map[string]any) (any, error) {
+	accountID, err := accountArg(args, "account")
+	if err != nil {
+		return nil, err
+	}
+
+	return e.queryTransactions(ctx, accountID, args)
+}
+
+// mempool returns the transactions waiting to be mined that can be filtered
+// by the account.
+func (e *Explorer) mempool(ctx context.Context, source any, args map[string]any) (any, error) {
+	accountID, err := accountArg(args, "account")
+	if err != nil {
+		return nil, err
+	}
+
+	trans := []transaction{}
+	for _, tx := range e.state.Mempool() {
+		if accountID == "" || involves(tx, accountID) {
+			trans = append(trans, transaction{tx: tx})
+		}
+	}
+
+	return trans, nil
+}
+
+// account returns the account for the specified id.
+func (e *Explorer) account(ctx context.Context, source any, args map[string]any) (any, error) {
+	accountID, err := accountArg(args, "id")
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := e.state.QueryAccount(accountID)
+	if err != nil {
+		return nil, nil
+	}
+
+	return account, nil
+}
+
+// accounts returns a page of accounts ordered by id that can be filtered by
+// a minimum balance.
+func (e *Explorer) accounts(ctx context.Context, source any, args map[string]any) (any, error) {
+	minBalance, err := graphql.Uint(args, "minBalance", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	first, offset, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var accounts []database.Account
+	e.state.Accounts().ForEach(func(account database.Account) {
+		if account.Balance >= minBalance {
+			accounts = append(accounts, account)
+		}
+	})
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].AccountID < accounts[j].AccountID
+	})
+
+	return paginate(accounts, first, offset), nil
+}
+
+// =============================================================================
+
+// accountTransactions returns a page of mined transactions for the account.
+func (e *Explorer) accountTransactions(ctx context.Context, source any, args map[string]any) (any, error) {
+	return e.queryTransactions(ctx, source.(database.Account).AccountID, args)
+}
+
+// queryTransactions returns a page of mined transactions in the block range
+// that involve the account. An empty account matches all transactions.
+func (e *Explorer) queryTransactions(ctx context.Context, accountID database.AccountID, args map[string]any) (any, error) {
+	from, to, err := e.blockRange(args)
+	if err != nil {
+		return nil, err
+	}
+
+	first, offset, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks, err := e.state.QueryBlocksByAccount(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	var trans []transaction
+	for i := range blocks {
+		block := blocks[i]
+		if block.Header.Number < from || block.Header.Number > to {
+			continue
+		}
+
+		for _, tx := range block.MerkleTree.Values() {
+			if accountID == "" || involves(tx, accountID) {
+				trans = append(trans, transaction{tx: tx, block: &block})
+			}
+		}
+	}
+
+	return paginate(trans, first, offset), nil
+}
+
+// blockRange returns the block range from the arguments, which defaults to
+// the whole chain.
+func (e *Explorer) blockRange(args map[string]any) (uint64, uint64, error) {
+	latest := e.state.LatestBlock().Header.Number
+
+	from, err := graphql.Uint(args, "from", 1)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	to, err := graphql.Uint(args, "to", latest)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if from == 0 {
+		from = 1
+	}
+	if to > latest {
+		to = latest
+	}
+
+	return from, to, nil
+}
+
+// =============================================================================
+
+// accountArg returns the named argument as an account id or empty when the
+// argument isn't provided.
+func accountArg(args map[string]any, name string) (database.AccountID, error) {
+	value, err := graphql.String(args, name, "")
+	if err != nil || value == "" {
+		return "", err
+	}
+
+	accountID, err := database.ToAccountID(value)
+	if err != nil {
+		return "", fmt.Errorf("argument %q: %w", name, err)
+	}
+
+	return accountID, nil
+}
+
+// pageArgs returns the page size and offset from the arguments.
+func pageArgs(args map[string]any) (uint64, uint64, error) {
+	first, err := graphql.Uint(args, "first", defaultFirst)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if first > maxFirst {
+		return 0, 0, fmt.Errorf("argument \"first\" can't be more than %d", maxFirst)
+	}
+
+	offset, err := graphql.Uint(args, "offset", 0)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	return first, offset, nil
+}
+
+// involves checks if the account sent, received or paid for the transaction.
+func involves(tx database.BlockTx, accountID database.AccountID) bool {
+	return tx.FromID == accountID || tx.ToID == accountID || tx.FeePayerID == accountID
+}
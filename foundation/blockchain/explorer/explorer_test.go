@@ -0,0 +1,259 @@
+package explorer_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/explorer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	kennedyPrivateKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+	kennedyAccountID  = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	edAccountID       = "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"
+	minerAccountID    = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+)
+
+func Test_Explorer(t *testing.T) {
+	st := newState(t)
+	exp := explorer.New(st)
+
+	// Mine three blocks with a transaction each and leave one in the mempool.
+	pk, err := crypto.HexToECDSA(kennedyPrivateKey)
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	var hashes []string
+	for nonce := uint64(1); nonce <= 4; nonce++ {
+		signedTx, err := database.Tx{ChainID: 1, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: 100}.Sign(pk)
+		if err != nil {
+			t.Fatalf("Should be able to sign the transaction: %v", err)
+		}
+
+		if err := st.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+		hashes = append(hashes, signedTx.TxHash())
+
+		if nonce == 4 {
+			break
+		}
+
+		if _, err := st.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Should be able to mine a block: %v", err)
+		}
+	}
+
+	// query executes the query and decodes the data.
+	query := func(q string, vars map[string]any, data any) []graphql.Error {
+		resp := exp.Execute(context.Background(), graphql.Request{Query: q, Variables: vars})
+		if len(resp.Errors) > 0 {
+			return resp.Errors
+		}
+
+		b, err := json.Marshal(resp.Data)
+		if err != nil {
+			t.Fatalf("Should be able to encode the data: %v", err)
+		}
+		if err := json.Unmarshal(b, data); err != nil {
+			t.Fatalf("Should be able to decode the data: %v", err)
+		}
+
+		return nil
+	}
+
+	t.Run("blocks", func(t *testing.T) {
+		var data struct {
+			Blocks struct {
+				TotalCount  int
+				HasNextPage bool
+				Items       []map[string]any
+			}
+		}
+
+		if err := query(`{ blocks(first: 2, offset: 1) { totalCount hasNextPage items { number } } }`, nil, &data); err != nil {
+			t.Fatalf("Should be able to query the blocks: %v", err)
+		}
+
+		if data.Blocks.TotalCount != 3 || data.Blocks.HasNextPage || len(data.Blocks.Items) != 2 {
+			t.Fatalf("Should return the second page of blocks: %+v", data.Blocks)
+		}
+
+		if data.Blocks.Items[0]["number"] != float64(2) || len(data.Blocks.Items[0]) != 1 {
+			t.Logf("got: %v", data.Blocks.Items[0])
+			t.Logf("exp: %v", map[string]any{"number": 2})
+			t.Fatalf("Should only return the selected fields.")
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		var data struct {
+			Block struct {
+				Hash         string
+				Beneficiary  string
+				Transactions struct {
+					Items []struct{ Hash string }
+				}
+			}
+			Missing *struct{ Hash string }
+		}
+
+		q := `query Block($number: Int!) {
+			block(number: $number) { hash beneficiary transactions { items { hash } } }
+			missing: block(number: 10) { hash }
+		}`
+
+		if err := query(q, map[string]any{"number": 2}, &data); err != nil {
+			t.Fatalf("Should be able to query the block: %v", err)
+		}
+
+		if data.Block.Beneficiary != minerAccountID || len(data.Block.Transactions.Items) != 1 {
+			t.Fatalf("Should return the block: %+v", data.Block)
+		}
+
+		if data.Block.Transactions.Items[0].Hash != hashes[1] {
+			t.Logf("got: %s", data.Block.Transactions.Items[0].Hash)
+			t.Logf("exp: %s", hashes[1])
+			t.Fatalf("Should return the transactions in the block.")
+		}
+
+		if data.Missing != nil {
+			t.Fatalf("Should return null for a block that doesn't exist.")
+		}
+	})
+
+	t.Run("transactions", func(t *testing.T) {
+		var data struct {
+			Transactions struct {
+				TotalCount int
+				Items      []struct {
+					Nonce       uint64
+					BlockNumber uint64
+				}
+			}
+			Pending struct {
+				Block *struct{ Number uint64 }
+			}
+			Mined struct {
+				Block *struct{ Number uint64 }
+			}
+		}
+
+		q := `query Tx($account: String, $pending: String, $mined: String) {
+			transactions(account: $account, from: 2) { totalCount items { nonce blockNumber } }
+			pending: transaction(hash: $pending) { block { number } }
+			mined: transaction(hash: $mined) { block { number } }
+		}`
+
+		vars := map[string]any{"account": edAccountID, "pending": hashes[3], "mined": hashes[0]}
+
+		if err := query(q, vars, &data); err != nil {
+			t.Fatalf("Should be able to query the transactions: %v", err)
+		}
+
+		if data.Transactions.TotalCount != 2 || data.Transactions.Items[0].BlockNumber != 2 || data.Transactions.Items[0].Nonce != 2 {
+			t.Fatalf("Should filter the transactions by the block range: %+v", data.Transactions)
+		}
+
+		if data.Pending.Block != nil {
+			t.Fatalf("Should not have a block for a transaction in the mempool.")
+		}
+
+		if data.Mined.Block == nil || data.Mined.Block.Number != 1 {
+			t.Fatalf("Should return the block for a mined transaction: %+v", data.Mined.Block)
+		}
+	})
+
+	t.Run("account", func(t *testing.T) {
+		var data struct {
+			Account struct {
+				Balance      uint64
+				Transactions struct{ TotalCount int }
+			}
+			Accounts struct {
+				Items []struct{ ID string }
+			}
+		}
+
+		q := `{
+			account(id: "` + edAccountID + `") { balance transactions { totalCount } }
+			accounts(minBalance: 1000) { items { id } }
+		}`
+
+		if err := query(q, nil, &data); err != nil {
+			t.Fatalf("Should be able to query the account: %v", err)
+		}
+
+		if data.Account.Balance != 300 || data.Account.Transactions.TotalCount != 3 {
+			t.Fatalf("Should return the account: %+v", data.Account)
+		}
+
+		if len(data.Accounts.Items) != 2 {
+			t.Fatalf("Should filter the accounts by balance: %+v", data.Accounts.Items)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		var data any
+
+		if err := query(`{ blocks(first: 1000) { totalCount } }`, nil, &data); err == nil {
+			t.Fatalf("Should not allow a page larger than the maximum.")
+		}
+
+		if err := query(`{ account(id: "bad") { balance } }`, nil, &data); err == nil {
+			t.Fatalf("Should not allow an invalid account id.")
+		}
+	})
+}
+
+// =============================================================================
+
+// noopWorker implements the Worker interface which does nothing.
+type noopWorker struct{}
+
+func (n noopWorker) Shutdown()                              {}
+func (n noopWorker) Sync()                                  {}
+func (n noopWorker) SignalStartMining()                     {}
+func (n noopWorker) SignalCancelMining()                    {}
+func (n noopWorker) SignalShareTx(blockTx database.BlockTx) {}
+func (n noopWorker) SignalShareVote(vote database.Vote)     {}
+
+// newState constructs a node with in memory storage.
+func newState(t *testing.T) *state.State {
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID: minerAccountID,
+		Host:          "http://localhost:9080",
+		Storage:       storage,
+		Genesis: genesis.Genesis{
+			ChainID:       1,
+			TransPerBlock: 1,
+			Difficulty:    1,
+			MiningReward:  700,
+			GasPrice:      15,
+			Balances:      map[string]uint64{kennedyAccountID: 1000000},
+		},
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewPeerSet(),
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the state: %v", err)
+	}
+
+	st.Worker = noopWorker{}
+
+	return st
+}
@@ -0,0 +1,183 @@
+package explorer
+
+import (
+	"context"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// transaction represents a transaction and the block it was mined into. The
+// block is nil for a transaction in the mempool.
+type transaction struct {
+	tx    database.BlockTx
+	block *database.Block
+}
+
+// page represents a page of items and the information to request the next.
+type page struct {
+	totalCount  uint64
+	hasNextPage bool
+	items       any
+}
+
+// paginate returns the page of items starting at the offset.
+func paginate[T any](items []T, first uint64, offset uint64) page {
+	total := uint64(len(items))
+	if offset >= total {
+		return page{totalCount: total, items: []T{}}
+	}
+
+	end := offset + first
+	if end > total {
+		end = total
+	}
+
+	p := page{
+		totalCount:  total,
+		hasNextPage: end < total,
+		items:       items[offset:end],
+	}
+
+	return p
+}
+
+// =============================================================================
+
+// field constructs a scalar field that reads a value from the source.
+func field[T any](fn func(src T) any) graphql.Field {
+	return graphql.Field{
+		Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+			return fn(source.(T)), nil
+		},
+	}
+}
+
+// blockType defines the fields of a block.
+func blockType() graphql.Object {
+	return graphql.Object{
+		Name: "Block",
+		Fields: map[string]graphql.Field{
+			"number":        field(func(b database.Block) any { return b.Header.Number }),
+			"hash":          field(func(b database.Block) any { return b.Hash() }),
+			"prevBlockHash": field(func(b database.Block) any { return b.Header.PrevBlockHash }),
+			"timestamp":     field(func(b database.Block) any { return b.Header.TimeStamp }),
+			"beneficiary":   field(func(b database.Block) any { return b.Header.BeneficiaryID }),
+			"difficulty":    field(func(b database.Block) any { return b.Header.Difficulty }),
+			"miningReward":  field(func(b database.Block) any { return b.Header.MiningReward }),
+			"baseFee":       field(func(b database.Block) any { return b.Header.BaseFee }),
+			"gasUsed":       field(func(b database.Block) any { return b.Header.GasUsed }),
+			"stateRoot":     field(func(b database.Block) any { return b.Header.StateRoot }),
+			"transRoot":     field(func(b database.Block) any { return b.Header.TransRoot }),
+			"nonce":         field(func(b database.Block) any { return b.Header.Nonce }),
+			"signature":     field(func(b database.Block) any { return b.Signature }),
+			"transactionCount": field(func(b database.Block) any {
+				return len(b.MerkleTree.Values())
+			}),
+			"transactions": {
+				Type:    "TransactionPage",
+				Resolve: blockTransactions,
+			},
+		},
+	}
+}
+
+// blockTransactions returns a page of the transactions in the block that can
+// be filtered by the account.
+func blockTransactions(ctx context.Context, source any, args map[string]any) (any, error) {
+	block := source.(database.Block)
+
+	accountID, err := accountArg(args, "account")
+	if err != nil {
+		return nil, err
+	}
+
+	first, offset, err := pageArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	var trans []transaction
+	for _, tx := range block.MerkleTree.Values() {
+		if accountID == "" || involves(tx, accountID) {
+			trans = append(trans, transaction{tx: tx, block: &block})
+		}
+	}
+
+	return paginate(trans, first, offset), nil
+}
+
+// transactionType defines the fields of a transaction.
+func transactionType() graphql.Object {
+	return graphql.Object{
+		Name: "Transaction",
+		Fields: map[string]graphql.Field{
+			"hash":       field(func(t transaction) any { return t.tx.TxHash() }),
+			"chainID":    field(func(t transaction) any { return t.tx.ChainID }),
+			"nonce":      field(func(t transaction) any { return t.tx.Nonce }),
+			"from":       field(func(t transaction) any { return t.tx.FromID }),
+			"to":         field(func(t transaction) any { return t.tx.ToID }),
+			"value":      field(func(t transaction) any { return t.tx.Value }),
+			"tip":        field(func(t transaction) any { return t.tx.Tip }),
+			"data":       field(func(t transaction) any { return hexutil.Encode(t.tx.Data) }),
+			"validUntil": field(func(t transaction) any { return t.tx.ValidUntil }),
+			"feePayer":   field(func(t transaction) any { return t.tx.FeePayerID }),
+			"timestamp":  field(func(t transaction) any { return t.tx.TimeStamp }),
+			"gasPrice":   field(func(t transaction) any { return t.tx.GasPrice }),
+			"gasUnits":   field(func(t transaction) any { return t.tx.GasUnits }),
+			"blockNumber": field(func(t transaction) any {
+				if t.block == nil {
+					return nil
+				}
+				return t.block.Header.Number
+			}),
+			"block": {
+				Type: "Block",
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					t := source.(transaction)
+					if t.block == nil {
+						return nil, nil
+					}
+					return *t.block, nil
+				},
+			},
+		},
+	}
+}
+
+// accountType defines the fields of an account.
+func accountType(transactionsFn graphql.ResolveFunc) graphql.Object {
+	return graphql.Object{
+		Name: "Account",
+		Fields: map[string]graphql.Field{
+			"id":        field(func(a database.Account) any { return a.AccountID }),
+			"nonce":     field(func(a database.Account) any { return a.Nonce }),
+			"balance":   field(func(a database.Account) any { return a.Balance }),
+			"bonded":    field(func(a database.Account) any { return a.Bonded }),
+			"unbonding": field(func(a database.Account) any { return a.Unbonding }),
+			"unbondAt":  field(func(a database.Account) any { return a.UnbondAt }),
+			"transactions": {
+				Type:    "TransactionPage",
+				Resolve: transactionsFn,
+			},
+		},
+	}
+}
+
+// pageType defines the fields of a page of the specified item type.
+func pageType(name string, itemType string) graphql.Object {
+	return graphql.Object{
+		Name: name,
+		Fields: map[string]graphql.Field{
+			"totalCount":  field(func(p page) any { return p.totalCount }),
+			"hasNextPage": field(func(p page) any { return p.hasNextPage }),
+			"items": {
+				Type: itemType,
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					return source.(page).items, nil
+				},
+			},
+		},
+	}
+}
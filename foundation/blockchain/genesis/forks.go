@@ -0,0 +1,101 @@
+package genesis
+
+import (
+	"fmt"
+	"sort"
+)
+
+// Set of rule sets that can be scheduled in the genesis file to take effect
+// at a block.
+const (
+	ForkCanonicalEncoding = "canonical_encoding" // Blocks and transactions are hashed with the canonical encoding.
+	ForkGasSchedule       = "gas_schedule"       // Transactions cost the gas units in the gas schedule.
+	ForkStrictGasUsed     = "strict_gas_used"    // Blocks must record the gas used even without a block gas limit.
+)
+
+// forks is the set of rule sets this version of the node knows how to apply.
+var forks = map[string]bool{
+	ForkCanonicalEncoding: true,
+	ForkGasSchedule:       true,
+	ForkStrictGasUsed:     true,
+}
+
+// CORE NOTE: A hard fork changes the rules blocks are checked with, so every
+// node has to switch at the same block. The rule sets are scheduled by name
+// in the genesis file and a node refuses to start with a rule set it doesn't
+// know, instead of silently following different rules than its peers. The
+// canonical block and the gas schedule block predate the schedule and are
+// still honored when the rule set isn't in it.
+
+// Rules represents the rule sets in effect at a block.
+type Rules struct {
+	Block             uint64
+	CanonicalEncoding bool
+	GasSchedule       bool
+	StrictGasUsed     bool
+}
+
+// RulesAt returns the rule sets in effect at the specified block number.
+func (g Genesis) RulesAt(blockNum uint64) Rules {
+	active := func(name string) bool {
+		block, scheduled := g.ForkBlock(name)
+		return scheduled && blockNum >= block
+	}
+
+	return Rules{
+		Block:             blockNum,
+		CanonicalEncoding: active(ForkCanonicalEncoding),
+		GasSchedule:       active(ForkGasSchedule),
+		StrictGasUsed:     active(ForkStrictGasUsed),
+	}
+}
+
+// ForkBlock returns the block the rule set takes effect at and false if it
+// isn't scheduled.
+func (g Genesis) ForkBlock(name string) (uint64, bool) {
+	if block, exists := g.Forks[name]; exists {
+		return block, true
+	}
+
+	switch name {
+	case ForkCanonicalEncoding:
+		return g.CanonicalBlock, g.CanonicalBlock > 0
+	case ForkGasSchedule:
+		if g.Gas != nil {
+			return g.Gas.Block, true
+		}
+	}
+
+	return 0, false
+}
+
+// ValidateForks checks every scheduled rule set is known and agrees with the
+// settings it depends on.
+func (g Genesis) ValidateForks() error {
+	names := make([]string, 0, len(g.Forks))
+	for name := range g.Forks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if !forks[name] {
+			return fmt.Errorf("rule set %q scheduled at block %d is not supported by this node", name, g.Forks[name])
+		}
+	}
+
+	if block, exists := g.Forks[ForkCanonicalEncoding]; exists && g.CanonicalBlock > 0 && block != g.CanonicalBlock {
+		return fmt.Errorf("rule set %q at block %d doesn't match the canonical block %d", ForkCanonicalEncoding, block, g.CanonicalBlock)
+	}
+
+	if block, exists := g.Forks[ForkGasSchedule]; exists {
+		switch {
+		case g.Gas == nil:
+			return fmt.Errorf("rule set %q at block %d needs a gas schedule", ForkGasSchedule, block)
+		case g.Gas.Block > 0 && block != g.Gas.Block:
+			return fmt.Errorf("rule set %q at block %d doesn't match the gas schedule block %d", ForkGasSchedule, block, g.Gas.Block)
+		}
+	}
+
+	return nil
+}
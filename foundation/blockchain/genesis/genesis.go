@@ -5,24 +5,62 @@ import (
 	"encoding/json"
 	"os"
 	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 )
 
 // Genesis represents the genesis file.
 type Genesis struct {
-	Date          time.Time         `json:"date"`
-	ChainID       uint16            `json:"chain_id"`        // The chain id represents an unique id for this running instance.
-	TransPerBlock uint16            `json:"trans_per_block"` // The maximum number of transactions that can be in a block.
-	Difficulty    uint16            `json:"difficulty"`      // How difficult it needs to be to solve the work problem.
-	MiningReward  uint64            `json:"mining_reward"`   // Reward for mining a block.
-	GasPrice      uint64            `json:"gas_price"`       // Fee paid for each transaction mined into a block.
-	Balances      map[string]uint64 `json:"balances"`
+	Date            time.Time          `json:"date"`
+	ChainID         uint16             `json:"chain_id"`          // The chain id represents an unique id for this running instance.
+	Network         string             `json:"network,omitempty"` // Name of the network the chain id is registered to.
+	TransPerBlock   uint16             `json:"trans_per_block"`   // The maximum number of transactions that can be in a block.
+	Difficulty      uint16             `json:"difficulty"`        // How difficult it needs to be to solve the work problem.
+	MiningReward    uint64             `json:"mining_reward"`     // Reward for mining a block.
+	HalvingInterval uint64             `json:"halving_interval"`  // Number of blocks before the mining reward is cut in half, 0 never halves.
+	SupplyCap       uint64             `json:"supply_cap"`        // Maximum number of coins that can ever exist, 0 has no cap.
+	GasPrice        uint64             `json:"gas_price"`         // Fee paid for each transaction mined into a block.
+	BaseFee         uint64             `json:"base_fee"`          // Base fee per gas unit for the first block that is burned, 0 has no base fee.
+	Balances        map[string]uint64  `json:"balances"`
+	Vesting         map[string]Vesting `json:"vesting,omitempty"`           // Vesting schedules that lock part of a genesis balance.
+	Governors       []string           `json:"governors,omitempty"`         // Accounts that can propose and vote on parameter changes.
+	UnbondingPeriod uint64             `json:"unbonding_period,omitempty"`  // Number of blocks unbonded stake can still be slashed.
+	Bonds           map[string]uint64  `json:"bonds,omitempty"`             // Stake bonded from a genesis balance for the first validators.
+	CanonicalBlock  uint64             `json:"canonical_block,omitempty"`   // First block hashed with the canonical encoding, 0 never switches.
+	Upgrades        []Upgrade          `json:"upgrades,omitempty"`          // Block header versions scheduled to take effect.
+	Gas             *GasSchedule       `json:"gas,omitempty"`               // Gas cost rules for transactions, nil charges one unit each.
+	BlockGasLimit   uint64             `json:"block_gas_limit,omitempty"`   // Most gas units a block can use instead of the transaction count, 0 has no limit.
+	RewardMaturity  uint64             `json:"reward_maturity,omitempty"`   // Number of blocks before a mining reward can be spent, 0 can spend it right away.
+	Forks           map[string]uint64  `json:"forks,omitempty"`             // Rule sets by name scheduled to take effect at a block.
+	LegacySigBlocks []string           `json:"legacy_sig_blocks,omitempty"` // Hashes of the blocks that only check the chain id of signatures not bound to a chain.
+}
+
+// GasSchedule represents the rules for the number of gas units a transaction
+// costs from a block number on. Before the block every transaction costs a
+// single unit.
+type GasSchedule struct {
+	Block    uint64 `json:"block"`    // First block the schedule is enforced in.
+	Base     uint64 `json:"base"`     // Units every transaction costs.
+	PerByte  uint64 `json:"per_byte"` // Units for each byte of transaction data.
+	Transfer uint64 `json:"transfer"` // Units for a transaction that moves a value.
+}
+
+// Upgrade represents a block header version scheduled to take effect at a
+// block number. The version decides how the block header is hashed.
+type Upgrade struct {
+	Version uint8  `json:"version"`
+	Block   uint64 `json:"block"` // First block produced with the version.
 }
 
 // =============================================================================
 
 // Load opens and consumes the genesis file.
 func Load() (Genesis, error) {
-	path := "zblock/genesis.json"
+	return LoadFile("zblock/genesis.json")
+}
+
+// LoadFile opens and consumes the genesis file at the path.
+func LoadFile(path string) (Genesis, error) {
 	content, err := os.ReadFile(path)
 	if err != nil {
 		return Genesis{}, err
@@ -34,5 +72,169 @@ func Load() (Genesis, error) {
 		return Genesis{}, err
 	}
 
+	if err := genesis.ValidateNetwork(); err != nil {
+		return Genesis{}, err
+	}
+
 	return genesis, nil
 }
+
+// =============================================================================
+
+// GenesisSupply returns the number of coins created by the genesis balances.
+func (g Genesis) GenesisSupply() uint64 {
+	var supply uint64
+	for _, balance := range g.Balances {
+		supply += balance
+	}
+
+	return supply
+}
+
+// MiningRewardAt returns the maximum mining reward allowed for the specified
+// block number given the current total supply. The reward is cut in half
+// every halving interval and can't take the total supply past the cap.
+func (g Genesis) MiningRewardAt(blockNum uint64, supply uint64) uint64 {
+	reward := g.MiningReward
+
+	if g.HalvingInterval > 0 && blockNum > 0 {
+		halvings := (blockNum - 1) / g.HalvingInterval
+		if halvings >= 64 {
+			return 0
+		}
+		reward >>= halvings
+	}
+
+	if g.SupplyCap > 0 {
+		if supply >= g.SupplyCap {
+			return 0
+		}
+		if remaining := g.SupplyCap - supply; reward > remaining {
+			reward = remaining
+		}
+	}
+
+	return reward
+}
+
+// EncodingAt returns the encoding blocks are hashed with at the specified
+// block number. Transactions can use this encoding or an older one.
+func (g Genesis) EncodingAt(blockNum uint64) uint8 {
+	if g.RulesAt(blockNum).CanonicalEncoding {
+		return signature.EncodingCanonical
+	}
+
+	return signature.EncodingJSON
+}
+
+// BlockVersionAt returns the block header version in effect at the specified
+// block number. Blocks use version 0 until the first upgrade takes effect.
+func (g Genesis) BlockVersionAt(blockNum uint64) uint8 {
+	var version uint8
+	var from uint64
+
+	for _, upgrade := range g.Upgrades {
+		if upgrade.Block <= blockNum && upgrade.Block >= from {
+			version = upgrade.Version
+			from = upgrade.Block
+		}
+	}
+
+	return version
+}
+
+// IsLegacySigBlock checks if the block with the specified hash only checks
+// the chain id of the signatures that aren't bound to a chain.
+func (g Genesis) IsLegacySigBlock(hash string) bool {
+	for _, legacy := range g.LegacySigBlocks {
+		if legacy == hash {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GasUnitsAt returns the number of gas units a transaction with the
+// specified number of data bytes costs in the specified block. A transfer is
+// a transaction that moves a value.
+func (g Genesis) GasUnitsAt(blockNum uint64, dataBytes int, transfer bool) uint64 {
+	if g.Gas == nil || !g.RulesAt(blockNum).GasSchedule {
+		return 1
+	}
+
+	units := g.Gas.Base + g.Gas.PerByte*uint64(dataBytes)
+	if transfer {
+		units += g.Gas.Transfer
+	}
+
+	return units
+}
+
+// baseFeeChangeDenominator limits the amount the base fee can change from
+// one block to the next to 1/8th, the same as Ethereum.
+const baseFeeChangeDenominator = 8
+
+// NextBaseFee returns the base fee per gas unit for the block that follows
+// the specified parent block. The base fee moves up when the parent block
+// was more than half full and down when it was less than half full. How full
+// a block is comes from the gas it used when there is a block gas limit and
+// from its number of transactions otherwise.
+func (g Genesis) NextBaseFee(parentNum uint64, parentBaseFee uint64, parentTrans int, parentGasUsed uint64) uint64 {
+	if g.BaseFee == 0 {
+		return 0
+	}
+
+	if parentNum == 0 {
+		return g.BaseFee
+	}
+
+	capacity, used := uint64(g.TransPerBlock), uint64(parentTrans)
+	if g.BlockGasLimit > 0 {
+		capacity, used = g.BlockGasLimit, parentGasUsed
+	}
+
+	target := capacity / 2
+	if target == 0 {
+		target = 1
+	}
+
+	switch {
+	case used > target:
+		delta := parentBaseFee * (used - target) / target / baseFeeChangeDenominator
+		if delta == 0 {
+			delta = 1
+		}
+		return parentBaseFee + delta
+
+	case used < target:
+		delta := parentBaseFee * (target - used) / target / baseFeeChangeDenominator
+		return parentBaseFee - delta
+	}
+
+	return parentBaseFee
+}
+
+// =============================================================================
+
+// Vesting represents a schedule that locks part of an account's balance and
+// releases it evenly per block between the start and end blocks.
+type Vesting struct {
+	Locked     uint64 `json:"locked"`      // Amount of the balance that starts locked.
+	StartBlock uint64 `json:"start_block"` // Block the balance starts to be released.
+	EndBlock   uint64 `json:"end_block"`   // Block the balance is fully released.
+}
+
+// LockedAt returns the amount of the balance still locked at the specified
+// block number.
+func (v Vesting) LockedAt(blockNum uint64) uint64 {
+	switch {
+	case blockNum <= v.StartBlock:
+		return v.Locked
+	case blockNum >= v.EndBlock:
+		return 0
+	}
+
+	remaining := v.EndBlock - blockNum
+	return v.Locked * remaining / (v.EndBlock - v.StartBlock)
+}
@@ -0,0 +1,348 @@
+package genesis_test
+
+import (
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+func Test_MiningRewardAt(t *testing.T) {
+	type table struct {
+		name     string
+		gen      genesis.Genesis
+		blockNum uint64
+		supply   uint64
+		reward   uint64
+	}
+
+	tt := []table{
+		{
+			name:     "nopolicy",
+			gen:      genesis.Genesis{MiningReward: 700},
+			blockNum: 1_000_000,
+			supply:   1_000_000,
+			reward:   700,
+		},
+		{
+			name:     "beforehalving",
+			gen:      genesis.Genesis{MiningReward: 700, HalvingInterval: 10},
+			blockNum: 10,
+			reward:   700,
+		},
+		{
+			name:     "halved",
+			gen:      genesis.Genesis{MiningReward: 700, HalvingInterval: 10},
+			blockNum: 11,
+			reward:   350,
+		},
+		{
+			name:     "halvedtwice",
+			gen:      genesis.Genesis{MiningReward: 700, HalvingInterval: 10},
+			blockNum: 21,
+			reward:   175,
+		},
+		{
+			name:     "exhausted",
+			gen:      genesis.Genesis{MiningReward: 700, HalvingInterval: 1},
+			blockNum: 100,
+			reward:   0,
+		},
+		{
+			name:     "belowcap",
+			gen:      genesis.Genesis{MiningReward: 700, SupplyCap: 10_000},
+			blockNum: 5,
+			supply:   9_000,
+			reward:   700,
+		},
+		{
+			name:     "nearcap",
+			gen:      genesis.Genesis{MiningReward: 700, SupplyCap: 10_000},
+			blockNum: 5,
+			supply:   9_500,
+			reward:   500,
+		},
+		{
+			name:     "atcap",
+			gen:      genesis.Genesis{MiningReward: 700, SupplyCap: 10_000},
+			blockNum: 5,
+			supply:   10_000,
+			reward:   0,
+		},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			reward := tst.gen.MiningRewardAt(tst.blockNum, tst.supply)
+			if reward != tst.reward {
+				t.Logf("got: %d", reward)
+				t.Logf("exp: %d", tst.reward)
+				t.Fatalf("Test %s:\tShould get back the right reward.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_ValidateNetwork(t *testing.T) {
+	type table struct {
+		name    string
+		gen     genesis.Genesis
+		success bool
+	}
+
+	tt := []table{
+		{
+			name:    "nonetwork",
+			gen:     genesis.Genesis{ChainID: 1},
+			success: true,
+		},
+		{
+			name:    "registered",
+			gen:     genesis.Genesis{ChainID: 1, Network: "ardan-dev"},
+			success: true,
+		},
+		{
+			name:    "unregistered",
+			gen:     genesis.Genesis{ChainID: 500, Network: "private"},
+			success: true,
+		},
+		{
+			name:    "sharedid",
+			gen:     genesis.Genesis{ChainID: 1, Network: "private"},
+			success: false,
+		},
+		{
+			name:    "wrongid",
+			gen:     genesis.Genesis{ChainID: 500, Network: "ardan-dev"},
+			success: false,
+		},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			err := tst.gen.ValidateNetwork()
+			if (err == nil) != tst.success {
+				t.Logf("got: %v", err)
+				t.Logf("exp: success %v", tst.success)
+				t.Fatalf("Should get the expected validation result.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_NextBaseFee(t *testing.T) {
+	gen := genesis.Genesis{TransPerBlock: 10, BaseFee: 800}
+	gasGen := genesis.Genesis{TransPerBlock: 10, BaseFee: 800, BlockGasLimit: 1000}
+
+	type table struct {
+		name      string
+		gen       genesis.Genesis
+		parentNum uint64
+		baseFee   uint64
+		trans     int
+		gasUsed   uint64
+		exp       uint64
+	}
+
+	tt := []table{
+		{name: "disabled", gen: genesis.Genesis{TransPerBlock: 10}, parentNum: 5, baseFee: 800, trans: 10, exp: 0},
+		{name: "firstblock", gen: gen, parentNum: 0, exp: 800},
+		{name: "target", gen: gen, parentNum: 5, baseFee: 800, trans: 5, exp: 800},
+		{name: "full", gen: gen, parentNum: 5, baseFee: 800, trans: 10, exp: 900},
+		{name: "empty", gen: gen, parentNum: 5, baseFee: 800, trans: 0, exp: 700},
+		{name: "minincrease", gen: gen, parentNum: 5, baseFee: 1, trans: 6, exp: 2},
+		{name: "gastarget", gen: gasGen, parentNum: 5, baseFee: 800, trans: 10, gasUsed: 500, exp: 800},
+		{name: "gasfull", gen: gasGen, parentNum: 5, baseFee: 800, trans: 1, gasUsed: 1000, exp: 900},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			got := tst.gen.NextBaseFee(tst.parentNum, tst.baseFee, tst.trans, tst.gasUsed)
+			if got != tst.exp {
+				t.Logf("got: %d", got)
+				t.Logf("exp: %d", tst.exp)
+				t.Fatalf("Should get the expected base fee.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_LockedAt(t *testing.T) {
+	vesting := genesis.Vesting{Locked: 1000, StartBlock: 10, EndBlock: 20}
+
+	type table struct {
+		name     string
+		blockNum uint64
+		locked   uint64
+	}
+
+	tt := []table{
+		{name: "beforestart", blockNum: 5, locked: 1000},
+		{name: "atstart", blockNum: 10, locked: 1000},
+		{name: "halfway", blockNum: 15, locked: 500},
+		{name: "atend", blockNum: 20, locked: 0},
+		{name: "afterend", blockNum: 30, locked: 0},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			got := vesting.LockedAt(tst.blockNum)
+			if got != tst.locked {
+				t.Logf("got: %d", got)
+				t.Logf("exp: %d", tst.locked)
+				t.Fatalf("Should get the expected locked balance.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_WithParam(t *testing.T) {
+	gen := genesis.Genesis{TransPerBlock: 10, MiningReward: 700, GasPrice: 15}
+
+	type table struct {
+		name    string
+		param   string
+		value   uint64
+		success bool
+	}
+
+	tt := []table{
+		{name: "transperblock", param: genesis.ParamTransPerBlock, value: 20, success: true},
+		{name: "zerotrans", param: genesis.ParamTransPerBlock, value: 0, success: false},
+		{name: "miningreward", param: genesis.ParamMiningReward, value: 350, success: true},
+		{name: "gasprice", param: genesis.ParamGasPrice, value: 30, success: true},
+		{name: "unknown", param: "chain_id", value: 2, success: false},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			changed, err := gen.WithParam(tst.param, tst.value)
+			if (err == nil) != tst.success {
+				t.Logf("got: %v", err)
+				t.Logf("exp: success %v", tst.success)
+				t.Fatalf("Should get the expected result.")
+			}
+
+			if tst.success && changed.TransPerBlock == gen.TransPerBlock && changed.MiningReward == gen.MiningReward && changed.GasPrice == gen.GasPrice {
+				t.Fatalf("Should have changed the parameter.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_BlockVersionAt(t *testing.T) {
+	gen := genesis.Genesis{
+		Upgrades: []genesis.Upgrade{
+			{Version: 1, Block: 10},
+			{Version: 2, Block: 20},
+		},
+	}
+
+	tt := map[uint64]uint8{1: 0, 9: 0, 10: 1, 19: 1, 20: 2, 100: 2}
+
+	for blockNum, exp := range tt {
+		if version := gen.BlockVersionAt(blockNum); version != exp {
+			t.Logf("got: %d", version)
+			t.Logf("exp: %d", exp)
+			t.Fatalf("Should get back the version in effect at block %d.", blockNum)
+		}
+	}
+}
+
+func Test_GasUnitsAt(t *testing.T) {
+	gen := genesis.Genesis{
+		Gas: &genesis.GasSchedule{Block: 10, Base: 21, PerByte: 2, Transfer: 9},
+	}
+
+	tt := []struct {
+		blockNum  uint64
+		dataBytes int
+		transfer  bool
+		exp       uint64
+	}{
+		{9, 100, true, 1},
+		{10, 0, false, 21},
+		{10, 0, true, 30},
+		{10, 50, false, 121},
+		{20, 50, true, 130},
+	}
+
+	for _, tst := range tt {
+		if units := gen.GasUnitsAt(tst.blockNum, tst.dataBytes, tst.transfer); units != tst.exp {
+			t.Logf("got: %d", units)
+			t.Logf("exp: %d", tst.exp)
+			t.Fatalf("Should compute the gas units at block %d for %d bytes.", tst.blockNum, tst.dataBytes)
+		}
+	}
+
+	if units := (genesis.Genesis{}).GasUnitsAt(100, 100, true); units != 1 {
+		t.Logf("got: %d", units)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should charge one unit without a gas schedule.")
+	}
+}
+
+func Test_RulesAt(t *testing.T) {
+	gen := genesis.Genesis{
+		CanonicalBlock: 5,
+		Gas:            &genesis.GasSchedule{Block: 10, Base: 21},
+		Forks:          map[string]uint64{genesis.ForkStrictGasUsed: 20},
+	}
+
+	tt := []struct {
+		blockNum uint64
+		exp      genesis.Rules
+	}{
+		{4, genesis.Rules{Block: 4}},
+		{5, genesis.Rules{Block: 5, CanonicalEncoding: true}},
+		{10, genesis.Rules{Block: 10, CanonicalEncoding: true, GasSchedule: true}},
+		{20, genesis.Rules{Block: 20, CanonicalEncoding: true, GasSchedule: true, StrictGasUsed: true}},
+	}
+
+	for _, tst := range tt {
+		if rules := gen.RulesAt(tst.blockNum); rules != tst.exp {
+			t.Logf("got: %+v", rules)
+			t.Logf("exp: %+v", tst.exp)
+			t.Fatalf("Should apply the rule sets scheduled by block %d.", tst.blockNum)
+		}
+	}
+
+	if _, scheduled := (genesis.Genesis{}).ForkBlock(genesis.ForkCanonicalEncoding); scheduled {
+		t.Fatalf("Should not schedule the canonical encoding without a canonical block.")
+	}
+}
+
+func Test_ValidateForks(t *testing.T) {
+	tt := []struct {
+		name string
+		gen  genesis.Genesis
+		ok   bool
+	}{
+		{"none", genesis.Genesis{}, true},
+		{"scheduled", genesis.Genesis{Gas: &genesis.GasSchedule{}, Forks: map[string]uint64{genesis.ForkGasSchedule: 10, genesis.ForkStrictGasUsed: 10}}, true},
+		{"matching", genesis.Genesis{CanonicalBlock: 5, Forks: map[string]uint64{genesis.ForkCanonicalEncoding: 5}}, true},
+		{"unknown", genesis.Genesis{Forks: map[string]uint64{"future_rules": 10}}, false},
+		{"canonical", genesis.Genesis{CanonicalBlock: 5, Forks: map[string]uint64{genesis.ForkCanonicalEncoding: 6}}, false},
+		{"no gas", genesis.Genesis{Forks: map[string]uint64{genesis.ForkGasSchedule: 10}}, false},
+		{"gas block", genesis.Genesis{Gas: &genesis.GasSchedule{Block: 5}, Forks: map[string]uint64{genesis.ForkGasSchedule: 10}}, false},
+	}
+
+	for _, tst := range tt {
+		err := tst.gen.ValidateForks()
+		if tst.ok && err != nil {
+			t.Fatalf("Should accept the %s schedule: %v", tst.name, err)
+		}
+		if !tst.ok && err == nil {
+			t.Fatalf("Should reject the %s schedule.", tst.name)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package genesis
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Set of parameters that can be changed by governance.
+const (
+	ParamTransPerBlock = "trans_per_block"
+	ParamMiningReward  = "mining_reward"
+	ParamGasPrice      = "gas_price"
+	ParamBlockGasLimit = "block_gas_limit"
+)
+
+// params maps the parameters that can be changed by governance to the
+// function that applies a new value.
+var params = map[string]func(g *Genesis, value uint64) error{
+	ParamTransPerBlock: func(g *Genesis, value uint64) error {
+		if value == 0 || value > math.MaxUint16 {
+			return errors.New("trans per block must be between 1 and 65535")
+		}
+		g.TransPerBlock = uint16(value)
+		return nil
+	},
+	ParamMiningReward: func(g *Genesis, value uint64) error {
+		g.MiningReward = value
+		return nil
+	},
+	ParamGasPrice: func(g *Genesis, value uint64) error {
+		g.GasPrice = value
+		return nil
+	},
+	ParamBlockGasLimit: func(g *Genesis, value uint64) error {
+		g.BlockGasLimit = value
+		return nil
+	},
+}
+
+// WithParam returns a copy of the genesis with the specified parameter
+// changed to the new value.
+func (g Genesis) WithParam(name string, value uint64) (Genesis, error) {
+	fn, exists := params[name]
+	if !exists {
+		return Genesis{}, fmt.Errorf("parameter %q can't be changed", name)
+	}
+
+	if err := fn(&g, value); err != nil {
+		return Genesis{}, err
+	}
+
+	return g, nil
+}
+
+// IsGovernor checks if the account can propose and vote on parameter changes.
+func (g Genesis) IsGovernor(account string) bool {
+	for _, governor := range g.Governors {
+		if governor == account {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package genesis
+
+import "fmt"
+
+// registry maps the chain ids in use to the network that owns them. A chain
+// id is bound into every transaction signature, so two networks sharing an
+// id could replay each other's transactions.
+var registry = map[uint16]string{
+	1: "ardan-dev",
+}
+
+// RetrieveNetwork returns the network registered for the specified chain id.
+func RetrieveNetwork(chainID uint16) (string, bool) {
+	network, exists := registry[chainID]
+	return network, exists
+}
+
+// ValidateNetwork checks the genesis network doesn't claim a chain id that is
+// registered to a different network. A genesis file with no network is
+// accepted for backwards compatibility.
+func (g Genesis) ValidateNetwork() error {
+	if g.Network == "" {
+		return nil
+	}
+
+	network, exists := RetrieveNetwork(g.ChainID)
+	if exists && network != g.Network {
+		return fmt.Errorf("chain id %d is registered to network %q, not %q", g.ChainID, network, g.Network)
+	}
+
+	for chainID, network := range registry {
+		if network == g.Network && chainID != g.ChainID {
+			return fmt.Errorf("network %q is registered with chain id %d, not %d", g.Network, chainID, g.ChainID)
+		}
+	}
+
+	return nil
+}
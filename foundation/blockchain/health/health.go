@@ -0,0 +1,118 @@
+// Package health reports the liveness and readiness of a node based on the
+// state of its chain, so orchestrators don't route traffic to a node that is
+// down or has fallen behind the network.
+package health
+
+import (
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// defaultMaxBehind is the number of blocks a node can be behind the best
+// known peer and still be ready when the config doesn't provide one.
+const defaultMaxBehind = 2
+
+// Worker interface represents the behavior required to be implemented by
+// the worker running the operations of the node.
+type Worker interface {
+	Running() (running int, started int)
+}
+
+// Config represents the configuration required to check the health of a node.
+type Config struct {
+	State     *state.State
+	Worker    Worker // Optional, the worker isn't checked without one.
+	MaxBehind uint64 // Blocks the node can be behind the best known peer, defaults to 2.
+}
+
+// Status represents the health of a node. A node that is ready can still be
+// degraded, the reasons explain what is wrong in every case.
+type Status struct {
+	Live          bool     `json:"live"`
+	Ready         bool     `json:"ready"`
+	Degraded      bool     `json:"degraded"`
+	LatestBlock   uint64   `json:"latest_block"`
+	BestPeerBlock uint64   `json:"best_peer_block"`
+	Reasons       []string `json:"reasons,omitempty"`
+}
+
+// Checker checks the health of a node.
+type Checker struct {
+	state     *state.State
+	worker    Worker
+	maxBehind uint64
+}
+
+// New constructs a checker for the node.
+func New(cfg Config) *Checker {
+	if cfg.MaxBehind == 0 {
+		cfg.MaxBehind = defaultMaxBehind
+	}
+
+	return &Checker{
+		state:     cfg.State,
+		worker:    cfg.Worker,
+		maxBehind: cfg.MaxBehind,
+	}
+}
+
+// Check returns the current health of the node.
+//   - Live: every operation of the worker is still running.
+//   - Ready: the node is live, blocks can be written to storage and the
+//     chain is within the allowed number of blocks of the best known peer.
+//   - Degraded: the node is ready but the last sync failed, there are no
+//     peers or mining isn't allowed.
+func (c *Checker) Check() Status {
+	status := Status{
+		Live:          true,
+		Ready:         true,
+		LatestBlock:   c.state.LatestBlock().Header.Number,
+		BestPeerBlock: c.state.BestPeerBlock(),
+	}
+
+	notReady := func(format string, args ...any) {
+		status.Ready = false
+		status.Reasons = append(status.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if c.worker != nil {
+		if running, started := c.worker.Running(); running < started {
+			status.Live = false
+			notReady("worker: %d of %d operations running", running, started)
+		}
+	}
+
+	if err := c.state.CheckStorage(); err != nil {
+		notReady("storage: not writable: %s", err)
+	}
+
+	if status.BestPeerBlock > status.LatestBlock {
+		if behind := status.BestPeerBlock - status.LatestBlock; behind > c.maxBehind {
+			notReady("sync: %d blocks behind the best known peer", behind)
+		}
+	}
+
+	if !status.Ready {
+		return status
+	}
+
+	degraded := func(format string, args ...any) {
+		status.Degraded = true
+		status.Reasons = append(status.Reasons, fmt.Sprintf(format, args...))
+	}
+
+	if sync := c.state.SyncStatus(); sync.Error != "" {
+		degraded("sync: last sync with %s failed: %s", sync.Peer, sync.Error)
+	}
+
+	if len(c.state.KnownExternalPeers()) == 0 {
+		degraded("peers: no known peers")
+	}
+
+	if !c.state.IsMiningAllowed() {
+		degraded("mining: not allowed")
+	}
+
+	return status
+}
@@ -0,0 +1,128 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/health"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+func Test_Check(t *testing.T) {
+	var latest uint64 = 10
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, `{"latest_block_number":%d}`, atomic.LoadUint64(&latest))
+	}))
+	defer srv.Close()
+
+	dbPath := t.TempDir()
+	storage, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct the storage: %v", err)
+	}
+
+	pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+	peers := peer.NewPeerSet()
+	peers.Add(pr)
+
+	st, err := state.New(state.Config{
+		BeneficiaryID:  "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Host:           "localhost:9080",
+		Storage:        storage,
+		Genesis:        genesis.Genesis{ChainID: 1, TransPerBlock: 10, Difficulty: 1, MiningReward: 700, GasPrice: 15},
+		SelectStrategy: "Tip",
+		KnownPeers:     peers,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the state: %v", err)
+	}
+	st.Worker = noopWorker{}
+
+	wrk := worker{running: 3, started: 3}
+	checker := health.New(health.Config{State: st, Worker: &wrk})
+
+	if hs := checker.Check(); !hs.Live || !hs.Ready || hs.Degraded {
+		t.Logf("got: %+v", hs)
+		t.Fatalf("Should be healthy before any peer reports its status.")
+	}
+
+	// The peer is 10 blocks ahead.
+	if _, err := st.NetRequestPeerStatus(context.Background(), pr); err != nil {
+		t.Fatalf("Should be able to request the status of the peer: %v", err)
+	}
+
+	if hs := checker.Check(); !hs.Live || hs.Ready || hs.BestPeerBlock != 10 || !contains(hs.Reasons, "10 blocks behind") {
+		t.Logf("got: %+v", hs)
+		t.Fatalf("Should not be ready while behind the best known peer.")
+	}
+
+	// The peer is within the allowed number of blocks, but the last sync failed.
+	atomic.StoreUint64(&latest, 2)
+	if _, err := st.NetRequestPeerStatus(context.Background(), pr); err != nil {
+		t.Fatalf("Should be able to request the status of the peer: %v", err)
+	}
+	st.SyncError(pr.Host, errors.New("peer is down"))
+
+	if hs := checker.Check(); !hs.Ready || !hs.Degraded || !contains(hs.Reasons, "peer is down") {
+		t.Logf("got: %+v", hs)
+		t.Fatalf("Should be ready but degraded after a failed sync.")
+	}
+
+	if err := os.RemoveAll(dbPath); err != nil {
+		t.Fatalf("Should be able to remove the storage: %v", err)
+	}
+
+	if hs := checker.Check(); hs.Ready || !contains(hs.Reasons, "storage: not writable") {
+		t.Logf("got: %+v", hs)
+		t.Fatalf("Should not be ready when blocks can't be written.")
+	}
+
+	wrk.running = 2
+	if hs := checker.Check(); hs.Live || hs.Ready || !contains(hs.Reasons, "2 of 3 operations running") {
+		t.Logf("got: %+v", hs)
+		t.Fatalf("Should not be live when the worker stopped an operation.")
+	}
+}
+
+// =============================================================================
+
+// worker reports a fixed number of running operations.
+type worker struct {
+	running int
+	started int
+}
+
+func (w *worker) Running() (int, int) {
+	return w.running, w.started
+}
+
+// noopWorker implements the state.Worker interface which does nothing.
+type noopWorker struct{}
+
+func (n noopWorker) Shutdown()                              {}
+func (n noopWorker) Sync()                                  {}
+func (n noopWorker) SignalStartMining()                     {}
+func (n noopWorker) SignalCancelMining()                    {}
+func (n noopWorker) SignalShareTx(blockTx database.BlockTx) {}
+func (n noopWorker) SignalShareVote(vote database.Vote)     {}
+
+// contains reports if any of the reasons contains the text.
+func contains(reasons []string, text string) bool {
+	for _, reason := range reasons {
+		if strings.Contains(reason, text) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,495 @@
+// Package index writes the blocks, transactions and balance changes of the
+// chain into an embedded SQLite database as blocks are applied, so questions
+// like the top accounts or the fees paid per day can be answered with SQL
+// instead of scanning the chain.
+package index
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+
+	// Registers the sqlite3 driver.
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Set of values that bound the work done by the index.
+const (
+	MaxRows      = 1000             // Most rows returned by a query.
+	queryTimeout = 10 * time.Second // Longest an ad-hoc query runs for.
+	syncBatch    = 100              // Blocks read from the node at a time while catching up.
+)
+
+// Set of keys the progress of the index is kept under.
+const (
+	metaBlocks   = "blocks"   // Latest block whose transactions are indexed.
+	metaBalances = "balances" // Block the balances of the accounts are as of.
+)
+
+// schema creates the tables when the database is new. Values are stored as
+// SQLite integers, which hold any balance or fee up to 2^63-1.
+const schema = `
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS blocks (
+	number        INTEGER PRIMARY KEY,
+	hash          TEXT NOT NULL,
+	prev_hash     TEXT NOT NULL,
+	timestamp     INTEGER NOT NULL,
+	beneficiary   TEXT NOT NULL,
+	mining_reward INTEGER NOT NULL,
+	base_fee      INTEGER NOT NULL,
+	gas_used      INTEGER NOT NULL,
+	tx_count      INTEGER NOT NULL
+);
+CREATE TABLE IF NOT EXISTS transactions (
+	block     INTEGER NOT NULL,
+	position  INTEGER NOT NULL,
+	hash      TEXT NOT NULL,
+	from_id   TEXT NOT NULL,
+	to_id     TEXT NOT NULL,
+	fee_payer TEXT NOT NULL,
+	nonce     INTEGER NOT NULL,
+	value     INTEGER NOT NULL,
+	tip       INTEGER NOT NULL,
+	gas_price INTEGER NOT NULL,
+	gas_units INTEGER NOT NULL,
+	gas_fee   INTEGER NOT NULL,
+	timestamp INTEGER NOT NULL,
+	PRIMARY KEY (block, position)
+);
+CREATE INDEX IF NOT EXISTS transactions_hash ON transactions (hash);
+CREATE INDEX IF NOT EXISTS transactions_from ON transactions (from_id);
+CREATE INDEX IF NOT EXISTS transactions_to ON transactions (to_id);
+CREATE TABLE IF NOT EXISTS accounts (
+	account TEXT PRIMARY KEY,
+	balance INTEGER NOT NULL
+);
+CREATE INDEX IF NOT EXISTS accounts_balance ON accounts (balance);
+CREATE TABLE IF NOT EXISTS balance_changes (
+	block   INTEGER NOT NULL,
+	account TEXT NOT NULL,
+	before  INTEGER NOT NULL,
+	after   INTEGER NOT NULL,
+	PRIMARY KEY (block, account)
+);
+`
+
+// CORE NOTE: The index is fed by the block, balances and reorg events from
+// the node, so it never reads the accounts while a block is being applied.
+// Events are dropped when a sink falls behind, and the node may have moved
+// on while the index was closed, so a gap in the blocks or the balances is
+// filled from the node: the missing blocks are read from disk and the
+// balances are replaced with the current accounts. The balance changes are
+// only recorded for blocks applied while the index is running, since they
+// can't be worked out from a block on its own.
+
+// Source represents the node the index catches up from, which is
+// implemented by the state.
+type Source interface {
+	LatestBlock() database.Block
+	QueryBlocksByNumber(ctx context.Context, from uint64, to uint64) []database.Block
+	Accounts() database.AccountSnapshot
+}
+
+// Index maintains the SQL index of the chain.
+type Index struct {
+	mu  sync.Mutex
+	db  *sql.DB // Only used by the sink and Sync.
+	ro  *sql.DB // Opened read only for the queries.
+	src Source
+	ev  func(v string, args ...any)
+}
+
+// Open opens the index at the path, creating it when it doesn't exist. The
+// source is read to fill gaps in the index.
+func Open(path string, src Source, ev func(v string, args ...any)) (*Index, error) {
+	if ev == nil {
+		ev = func(v string, args ...any) {}
+	}
+
+	db, err := sql.Open("sqlite3", dsn(path, "_journal_mode=WAL", "_busy_timeout=5000", "_txlock=immediate"))
+	if err != nil {
+		return nil, fmt.Errorf("index: open: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("index: schema: %w", err)
+	}
+
+	// The queries can't write to the index even with several statements
+	// since the file itself is opened read only.
+	ro, err := sql.Open("sqlite3", dsn(path, "mode=ro", "_query_only=true", "_busy_timeout=5000"))
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("index: open read only: %w", err)
+	}
+
+	idx := Index{
+		db:  db,
+		ro:  ro,
+		src: src,
+		ev:  ev,
+	}
+
+	return &idx, nil
+}
+
+// Close closes the index.
+func (idx *Index) Close() error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	roErr := idx.ro.Close()
+	if err := idx.db.Close(); err != nil {
+		return err
+	}
+	return roErr
+}
+
+// Sink returns the sink to register with the node. The index is written from
+// the sink's goroutine, one event at a time in the order of the blocks.
+func (idx *Index) Sink() state.Sink {
+	return state.Sink{
+		Name:   "index",
+		Kinds:  []string{state.EventBlock, state.EventBalances, state.EventReorg},
+		Handle: idx.handle,
+	}
+}
+
+// Sync catches the index up with the node. Blocks the node no longer has, or
+// has replaced since the index was written, are removed first.
+func (idx *Index) Sync(ctx context.Context) error {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	return idx.sync(ctx)
+}
+
+// =============================================================================
+
+// handle applies an event from the node to the index.
+func (idx *Index) handle(ev state.Event) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	var err error
+	switch v := ev.Value.(type) {
+	case database.BlockData:
+		err = idx.handleBlock(v)
+	case state.BalancesEvent:
+		err = idx.handleBalances(v)
+	case state.ReorgEvent:
+		err = idx.handleReorg(v)
+	default:
+		return
+	}
+
+	if err != nil {
+		idx.ev("index: %s: ERROR: %s", ev.Kind, err)
+	}
+}
+
+// handleBlock indexes a new block, catching up first when blocks before it
+// are missing.
+func (idx *Index) handleBlock(block database.BlockData) error {
+	latest, err := getMeta(idx.db, metaBlocks)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case block.Header.Number <= latest:
+		return nil
+
+	case block.Header.Number > latest+1:
+		idx.ev("index: block[%d]: missing blocks after %d, catching up", block.Header.Number, latest)
+		return idx.sync(context.Background())
+	}
+
+	return idx.write(func(tx *sql.Tx) error {
+		if err := insertBlock(tx, block); err != nil {
+			return err
+		}
+		return setMeta(tx, metaBlocks, block.Header.Number)
+	})
+}
+
+// handleBalances records the balances changed by a block, replacing the
+// balances with the current accounts when the changes of a block before it
+// are missing.
+func (idx *Index) handleBalances(bal state.BalancesEvent) error {
+	latest, err := getMeta(idx.db, metaBalances)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case bal.Block <= latest:
+		return nil
+
+	case bal.Block > latest+1:
+		idx.ev("index: balances[%d]: missing balances after %d, reloading accounts", bal.Block, latest)
+		return idx.write(idx.reloadAccounts)
+	}
+
+	return idx.write(func(tx *sql.Tx) error {
+		for _, change := range bal.Changes {
+			if _, err := tx.Exec(`INSERT OR REPLACE INTO balance_changes (block, account, before, after) VALUES (?, ?, ?, ?)`,
+				bal.Block, change.AccountID, change.Before, change.After); err != nil {
+				return err
+			}
+
+			if err := setBalance(tx, change.AccountID, change.After); err != nil {
+				return err
+			}
+		}
+		return setMeta(tx, metaBalances, bal.Block)
+	})
+}
+
+// handleReorg removes the reverted blocks and puts back the balances before
+// them.
+func (idx *Index) handleReorg(reorg state.ReorgEvent) error {
+	return idx.write(func(tx *sql.Tx) error {
+		return idx.revert(tx, reorg.To)
+	})
+}
+
+// revert removes the blocks after the specified block. The balances are put
+// back from the recorded changes, or reloaded from the node when changes
+// for the removed blocks weren't recorded.
+func (idx *Index) revert(tx *sql.Tx, to uint64) error {
+	if _, err := tx.Exec(`DELETE FROM blocks WHERE number > ?`, to); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM transactions WHERE block > ?`, to); err != nil {
+		return err
+	}
+
+	latest, err := getMeta(tx, metaBlocks)
+	if err != nil {
+		return err
+	}
+	if latest > to {
+		if err := setMeta(tx, metaBlocks, to); err != nil {
+			return err
+		}
+	}
+
+	balances, err := getMeta(tx, metaBalances)
+	if err != nil {
+		return err
+	}
+	if balances <= to {
+		return nil
+	}
+
+	// The oldest change recorded for an account after the block holds the
+	// balance the account had at the block. A block without changes can't be
+	// told apart from a block whose changes weren't recorded.
+	var recorded uint64
+	if err := tx.QueryRow(`SELECT COUNT(DISTINCT block) FROM balance_changes WHERE block > ?`, to).Scan(&recorded); err != nil {
+		return err
+	}
+
+	if recorded != balances-to {
+		if _, err := tx.Exec(`DELETE FROM balance_changes WHERE block > ?`, to); err != nil {
+			return err
+		}
+		return idx.reloadAccounts(tx)
+	}
+
+	if _, err := tx.Exec(`
+		INSERT OR REPLACE INTO accounts (account, balance)
+		SELECT c.account, c.before FROM balance_changes c
+		WHERE c.block = (SELECT MIN(block) FROM balance_changes WHERE account = c.account AND block > ?1)`, to); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM accounts WHERE balance = 0`); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM balance_changes WHERE block > ?`, to); err != nil {
+		return err
+	}
+
+	return setMeta(tx, metaBalances, to)
+}
+
+// sync removes the blocks the node no longer has, indexes the blocks the
+// index is missing and reloads the accounts when any block was missing.
+func (idx *Index) sync(ctx context.Context) error {
+	latest, err := getMeta(idx.db, metaBlocks)
+	if err != nil {
+		return err
+	}
+
+	// Walk back to the last block the index and the node agree on.
+	fork := latest
+	for fork > 0 {
+		var hash string
+		if err := idx.db.QueryRow(`SELECT hash FROM blocks WHERE number = ?`, fork).Scan(&hash); err != nil {
+			return fmt.Errorf("block[%d]: %w", fork, err)
+		}
+
+		blocks := idx.src.QueryBlocksByNumber(ctx, fork, fork)
+		if len(blocks) == 1 && blocks[0].Hash() == hash {
+			break
+		}
+		fork--
+	}
+
+	if fork < latest {
+		idx.ev("index: sync: removing blocks %d to %d", fork+1, latest)
+		if err := idx.write(func(tx *sql.Tx) error { return idx.revert(tx, fork) }); err != nil {
+			return err
+		}
+	}
+
+	// The accounts are reloaded at the end, which puts their balances at or
+	// after the latest block read here.
+	head := idx.src.LatestBlock().Header.Number
+
+	for from := fork + 1; from <= head; from += syncBatch {
+		to := from + syncBatch - 1
+		if to > head {
+			to = head
+		}
+
+		blocks := idx.src.QueryBlocksByNumber(ctx, from, to)
+		if len(blocks) == 0 {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			return fmt.Errorf("unable to read blocks %d to %d", from, to)
+		}
+
+		err := idx.write(func(tx *sql.Tx) error {
+			for _, block := range blocks {
+				if err := insertBlock(tx, database.NewBlockData(block)); err != nil {
+					return err
+				}
+			}
+			return setMeta(tx, metaBlocks, blocks[len(blocks)-1].Header.Number)
+		})
+		if err != nil {
+			return err
+		}
+
+		idx.ev("index: sync: indexed blocks %d to %d", from, to)
+	}
+
+	return idx.write(idx.reloadAccounts)
+}
+
+// reloadAccounts replaces the balances with the current accounts of the node.
+func (idx *Index) reloadAccounts(tx *sql.Tx) error {
+	head := idx.src.LatestBlock().Header.Number
+	snapshot := idx.src.Accounts()
+
+	if _, err := tx.Exec(`DELETE FROM accounts`); err != nil {
+		return err
+	}
+
+	var err error
+	snapshot.ForEach(func(account database.Account) {
+		if err == nil {
+			err = setBalance(tx, account.AccountID, account.Balance)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	return setMeta(tx, metaBalances, head)
+}
+
+// write runs the function in a transaction against the index.
+func (idx *Index) write(fn func(tx *sql.Tx) error) error {
+	tx, err := idx.db.Begin()
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// queryer represents a connection or transaction the index is read with.
+type queryer interface {
+	QueryRow(query string, args ...any) *sql.Row
+}
+
+// getMeta returns the value kept under the key, 0 when it isn't set.
+func getMeta(q queryer, key string) (uint64, error) {
+	var value uint64
+	err := q.QueryRow(`SELECT value FROM meta WHERE key = ?`, key).Scan(&value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return value, err
+}
+
+// setMeta keeps the value under the key.
+func setMeta(tx *sql.Tx, key string, value uint64) error {
+	_, err := tx.Exec(`INSERT OR REPLACE INTO meta (key, value) VALUES (?, ?)`, key, value)
+	return err
+}
+
+// setBalance keeps the balance of the account, removing an account whose
+// balance is zero.
+func setBalance(tx *sql.Tx, accountID database.AccountID, balance uint64) error {
+	if balance == 0 {
+		_, err := tx.Exec(`DELETE FROM accounts WHERE account = ?`, accountID)
+		return err
+	}
+
+	_, err := tx.Exec(`INSERT OR REPLACE INTO accounts (account, balance) VALUES (?, ?)`, accountID, balance)
+	return err
+}
+
+// insertBlock indexes the block and its transactions.
+func insertBlock(tx *sql.Tx, block database.BlockData) error {
+	h := block.Header
+	if _, err := tx.Exec(`INSERT OR REPLACE INTO blocks (number, hash, prev_hash, timestamp, beneficiary, mining_reward, base_fee, gas_used, tx_count) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		h.Number, block.Hash, h.PrevBlockHash, h.TimeStamp, h.BeneficiaryID, h.MiningReward, h.BaseFee, h.GasUsed, len(block.Trans)); err != nil {
+		return fmt.Errorf("block[%d]: %w", h.Number, err)
+	}
+
+	for i, btx := range block.Trans {
+
+		// When the block has a base fee only the base fee is charged for
+		// each unit of gas.
+		gasPrice := btx.GasPrice
+		if h.BaseFee > 0 {
+			gasPrice = h.BaseFee
+		}
+
+		if _, err := tx.Exec(`INSERT OR REPLACE INTO transactions (block, position, hash, from_id, to_id, fee_payer, nonce, value, tip, gas_price, gas_units, gas_fee, timestamp) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			h.Number, i, btx.TxHash(), btx.FromID, btx.ToID, btx.FeePayerID, btx.Nonce, btx.Value, btx.Tip, gasPrice, btx.GasUnits, gasPrice*btx.GasUnits, h.TimeStamp); err != nil {
+			return fmt.Errorf("block[%d]: tx[%d]: %w", h.Number, i, err)
+		}
+	}
+
+	return nil
+}
+
+// dsn returns the data source name for the file with the options.
+func dsn(path string, options ...string) string {
+	return "file:" + path + "?" + strings.Join(options, "&")
+}
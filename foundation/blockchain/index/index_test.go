@@ -0,0 +1,256 @@
+package index_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/index"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	fromID  = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+	toID    = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	minerID = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+)
+
+func Test_Index(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{fromID: 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+	src := source{db: db}
+
+	path := filepath.Join(t.TempDir(), "index.db")
+	idx, err := index.Open(path, src, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open the index: %v", err)
+	}
+	defer func() { idx.Close() }()
+
+	// The blocks applied before the index is synced are read from the node.
+	mineBlock(t, db)
+	mineBlock(t, db)
+
+	if err := idx.Sync(context.Background()); err != nil {
+		t.Fatalf("Should be able to sync the index: %v", err)
+	}
+	checkIndex(t, idx, db, 2)
+
+	// A block applied while the index is running comes from the events.
+	block, changes := mineBlock(t, db)
+	sink := idx.Sink()
+	sink.Handle(state.Event{Kind: state.EventBlock, Value: database.NewBlockData(block)})
+	sink.Handle(state.Event{Kind: state.EventBalances, Value: state.BalancesEvent{Block: 3, Hash: block.Hash(), Changes: changes}})
+	checkIndex(t, idx, db, 3)
+
+	fees, err := idx.FeesPerDay(context.Background(), 7)
+	if err != nil {
+		t.Fatalf("Should be able to query the fees per day: %v", err)
+	}
+	if len(fees) != 1 || fees[0].Transactions != 3 || fees[0].GasFees != 3 || fees[0].Tips != 0 {
+		t.Logf("got: %+v", fees)
+		t.Logf("exp: one day with %d transactions and %d in gas fees", 3, 3)
+		t.Fatalf("Should have the fees of every transaction.")
+	}
+
+	if _, err := idx.Query(context.Background(), "DELETE FROM accounts"); err == nil {
+		t.Fatalf("Should not be able to change the index with a query.")
+	}
+	if _, err := idx.Query(context.Background(), "PRAGMA query_only = false; DELETE FROM accounts"); err == nil {
+		t.Fatalf("Should not be able to change the index with several statements.")
+	}
+	checkIndex(t, idx, db, 3)
+
+	// The balances reverted by a reorg are put back from the recorded changes.
+	if err := db.Rollback(context.Background(), 2, ev); err != nil {
+		t.Fatalf("Should be able to roll back to block 2: %v", err)
+	}
+	sink.Handle(state.Event{Kind: state.EventReorg, Value: state.ReorgEvent{From: 3, To: 2}})
+	checkIndex(t, idx, db, 2)
+
+	// A block after a gap catches the index up with the node.
+	mineBlock(t, db)
+	block, _ = mineBlock(t, db)
+	sink.Handle(state.Event{Kind: state.EventBlock, Value: database.NewBlockData(block)})
+	checkIndex(t, idx, db, 4)
+
+	// Blocks replaced while the index was closed are removed on the next sync.
+	idx.Close()
+
+	if err := db.Rollback(context.Background(), 2, ev); err != nil {
+		t.Fatalf("Should be able to roll back to block 2: %v", err)
+	}
+	mineBlock(t, db)
+
+	idx, err = index.Open(path, src, ev)
+	if err != nil {
+		t.Fatalf("Should be able to reopen the index: %v", err)
+	}
+	if err := idx.Sync(context.Background()); err != nil {
+		t.Fatalf("Should be able to sync the reopened index: %v", err)
+	}
+	checkIndex(t, idx, db, 3)
+
+	res, err := idx.Query(context.Background(), "SELECT hash FROM blocks WHERE number = ?", 3)
+	if err != nil {
+		t.Fatalf("Should be able to query the index: %v", err)
+	}
+	if exp := db.LatestBlock().Hash(); len(res.Rows) != 1 || res.Rows[0][0] != exp {
+		t.Logf("got: %v", res.Rows)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should have replaced block 3.")
+	}
+}
+
+// =============================================================================
+
+// source reads the blocks and accounts the index catches up from the
+// database, the way the state does.
+type source struct {
+	db *database.Database
+}
+
+func (s source) LatestBlock() database.Block {
+	return s.db.LatestBlock()
+}
+
+func (s source) QueryBlocksByNumber(ctx context.Context, from uint64, to uint64) []database.Block {
+	var blocks []database.Block
+	for i := from; i <= to; i++ {
+		block, err := s.db.GetBlock(i)
+		if err != nil {
+			return nil
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks
+}
+
+func (s source) Accounts() database.AccountSnapshot {
+	return s.db.Snapshot()
+}
+
+// mineBlock mines a block with a transaction from the funded account and
+// commits it, returning the balances it changed.
+func mineBlock(t *testing.T, db *database.Database) (database.Block, []database.BalanceChange) {
+	ev := func(v string, args ...any) {}
+
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	number := db.LatestBlock().Header.Number + 1
+
+	signedTx, err := database.Tx{
+		ChainID: 1,
+		Nonce:   number,
+		FromID:  fromID,
+		ToID:    toID,
+		Value:   10,
+	}.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+	blockTx := database.NewBlockTx(signedTx, 1, 1)
+
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: minerID,
+		Difficulty:    1,
+		MiningReward:  db.MiningReward(number),
+		BaseFee:       db.NextBaseFee(),
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashState(),
+		Trans:         []database.BlockTx{blockTx},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block %d: %v", number, err)
+	}
+
+	delta := db.Stage(block)
+	if err := delta.ApplyTransaction(blockTx); err != nil {
+		t.Fatalf("Should be able to apply the transaction in block %d: %v", number, err)
+	}
+	delta.ApplyMiningReward()
+	changes := delta.Changes()
+
+	if err := db.Write(block); err != nil {
+		t.Fatalf("Should be able to write block %d: %v", number, err)
+	}
+	if err := db.Commit(delta); err != nil {
+		t.Fatalf("Should be able to commit block %d: %v", number, err)
+	}
+
+	return block, changes
+}
+
+// checkIndex checks the index holds the blocks and transactions up to the
+// block and the balances in the database.
+func checkIndex(t *testing.T, idx *index.Index, db *database.Database, latest uint64) {
+	t.Helper()
+
+	res, err := idx.Query(context.Background(), "SELECT COUNT(*), COALESCE(MAX(number), 0) FROM blocks")
+	if err != nil {
+		t.Fatalf("Should be able to query the blocks: %v", err)
+	}
+	if res.Rows[0][0] != int64(latest) || res.Rows[0][1] != int64(latest) {
+		t.Logf("got: %v", res.Rows[0])
+		t.Logf("exp: [%d %d]", latest, latest)
+		t.Fatalf("Should have indexed the blocks up to %d.", latest)
+	}
+
+	res, err = idx.Query(context.Background(), "SELECT COUNT(*) FROM transactions")
+	if err != nil {
+		t.Fatalf("Should be able to query the transactions: %v", err)
+	}
+	if res.Rows[0][0] != int64(latest) {
+		t.Logf("got: %v", res.Rows[0][0])
+		t.Logf("exp: %d", latest)
+		t.Fatalf("Should have indexed a transaction for each block.")
+	}
+
+	accounts, err := idx.TopAccounts(context.Background(), 10)
+	if err != nil {
+		t.Fatalf("Should be able to query the top accounts: %v", err)
+	}
+
+	snapshot := db.Snapshot()
+	if len(accounts) != snapshot.Len() {
+		t.Logf("got: %+v", accounts)
+		t.Logf("exp: %d accounts", snapshot.Len())
+		t.Fatalf("Should have every account.")
+	}
+
+	for i, ab := range accounts {
+		account, _ := snapshot.Query(database.AccountID(ab.AccountID))
+		if ab.Balance != account.Balance {
+			t.Logf("got: %d", ab.Balance)
+			t.Logf("exp: %d", account.Balance)
+			t.Fatalf("Should have the balance of account %s.", ab.AccountID)
+		}
+		if i > 0 && ab.Balance > accounts[i-1].Balance {
+			t.Fatalf("Should have the largest balances first: %+v", accounts)
+		}
+	}
+}
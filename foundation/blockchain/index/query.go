@@ -0,0 +1,134 @@
+package index
+
+import (
+	"context"
+	"fmt"
+)
+
+// AccountBalance represents the balance of an account in the index.
+type AccountBalance struct {
+	AccountID string `json:"account"`
+	Balance   uint64 `json:"balance"`
+}
+
+// DayFees represents the fees paid by the transactions mined on a day, in
+// UTC. The gas fee is what the transactions were charged for their gas,
+// before any shortfall from an account that couldn't cover it.
+type DayFees struct {
+	Day          string `json:"day"`
+	Transactions uint64 `json:"transactions"`
+	GasFees      uint64 `json:"gas_fees"`
+	Tips         uint64 `json:"tips"`
+}
+
+// Result represents the rows returned by an ad-hoc query. Truncated is set
+// when the query returned more than MaxRows rows.
+type Result struct {
+	Columns   []string `json:"columns"`
+	Rows      [][]any  `json:"rows"`
+	Truncated bool     `json:"truncated,omitempty"`
+}
+
+// TopAccounts returns the accounts with the largest balances, largest first.
+func (idx *Index) TopAccounts(ctx context.Context, limit int) ([]AccountBalance, error) {
+	rows, err := idx.ro.QueryContext(ctx, `SELECT account, balance FROM accounts ORDER BY balance DESC, account LIMIT ?`, limit)
+	if err != nil {
+		return nil, fmt.Errorf("index: top accounts: %w", err)
+	}
+	defer rows.Close()
+
+	accounts := []AccountBalance{}
+	for rows.Next() {
+		var ab AccountBalance
+		if err := rows.Scan(&ab.AccountID, &ab.Balance); err != nil {
+			return nil, fmt.Errorf("index: top accounts: %w", err)
+		}
+		accounts = append(accounts, ab)
+	}
+
+	return accounts, rows.Err()
+}
+
+// FeesPerDay returns the fees paid per day for the most recent days with
+// transactions, most recent first.
+func (idx *Index) FeesPerDay(ctx context.Context, days int) ([]DayFees, error) {
+	const q = `
+	SELECT date(timestamp / 1000, 'unixepoch') AS day, COUNT(*), SUM(gas_fee), SUM(tip)
+	FROM transactions
+	GROUP BY day
+	ORDER BY day DESC
+	LIMIT ?`
+
+	rows, err := idx.ro.QueryContext(ctx, q, days)
+	if err != nil {
+		return nil, fmt.Errorf("index: fees per day: %w", err)
+	}
+	defer rows.Close()
+
+	fees := []DayFees{}
+	for rows.Next() {
+		var df DayFees
+		if err := rows.Scan(&df.Day, &df.Transactions, &df.GasFees, &df.Tips); err != nil {
+			return nil, fmt.Errorf("index: fees per day: %w", err)
+		}
+		fees = append(fees, df)
+	}
+
+	return fees, rows.Err()
+}
+
+// Query runs an ad-hoc SQL query against the index. The index is opened read
+// only for the query, so statements that change it fail. At most MaxRows
+// rows are returned.
+func (idx *Index) Query(ctx context.Context, query string, args ...any) (Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+
+	rows, err := idx.ro.QueryContext(ctx, query, args...)
+	if err != nil {
+		return Result{}, fmt.Errorf("index: query: %w", err)
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return Result{}, fmt.Errorf("index: query: %w", err)
+	}
+
+	result := Result{
+		Columns: columns,
+		Rows:    [][]any{},
+	}
+
+	for rows.Next() {
+		if len(result.Rows) == MaxRows {
+			result.Truncated = true
+			break
+		}
+
+		values := make([]any, len(columns))
+		ptrs := make([]any, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+
+		if err := rows.Scan(ptrs...); err != nil {
+			return Result{}, fmt.Errorf("index: query: %w", err)
+		}
+
+		// Text comes back as bytes, which would be encoded as base64.
+		for i, v := range values {
+			if b, ok := v.([]byte); ok {
+				values[i] = string(b)
+			}
+		}
+
+		result.Rows = append(result.Rows, values)
+	}
+
+	if err := rows.Err(); err != nil {
+		return Result{}, fmt.Errorf("index: query: %w", err)
+	}
+
+	return result, nil
+}
@@ -0,0 +1,128 @@
+// Package journal records the external inputs a node receives, one JSON entry
+// per line, so they can be replayed against a fresh node to reproduce a
+// problem deterministically.
+package journal
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// maxEntrySize is the largest entry that can be read from a journal.
+const maxEntrySize = 64 * 1024 * 1024
+
+// Entry represents a single input recorded in the journal.
+type Entry struct {
+	Seq    uint64          `json:"seq"`
+	Time   time.Time       `json:"time"`
+	Kind   string          `json:"kind"`
+	Data   json.RawMessage `json:"data,omitempty"`
+	Error  string          `json:"error,omitempty"`  // Error produced when the input was applied.
+	Latest string          `json:"latest,omitempty"` // Hash of the latest block after the input was applied.
+}
+
+// Decode unmarshals the data of the entry into the value.
+func (e Entry) Decode(v any) error {
+	if err := json.Unmarshal(e.Data, v); err != nil {
+		return fmt.Errorf("journal entry %d: decoding %s: %w", e.Seq, e.Kind, err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Journal writes entries to the underlying writer. A nil Journal can be used
+// and records nothing.
+type Journal struct {
+	mu     sync.Mutex
+	w      io.Writer
+	closer io.Closer
+	seq    uint64
+}
+
+// New constructs a journal that writes to the writer.
+func New(w io.Writer) *Journal {
+	return &Journal{w: w}
+}
+
+// Open constructs a journal that appends to the file at the path.
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Journal{w: f, closer: f}, nil
+}
+
+// Close closes the underlying file if the journal opened it.
+func (j *Journal) Close() error {
+	if j == nil || j.closer == nil {
+		return nil
+	}
+
+	return j.closer.Close()
+}
+
+// Record writes the entry with the data to the journal. The sequence number
+// and time of the entry are set by the journal.
+func (j *Journal) Record(entry Entry, data any) error {
+	if j == nil {
+		return nil
+	}
+
+	if data != nil {
+		raw, err := json.Marshal(data)
+		if err != nil {
+			return err
+		}
+		entry.Data = raw
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	j.seq++
+	entry.Seq = j.seq
+	entry.Time = time.Now().UTC()
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	_, err = j.w.Write(append(line, '\n'))
+	return err
+}
+
+// =============================================================================
+
+// Read calls the function for each entry in the journal until the end of the
+// journal is reached or the function returns an error.
+func Read(r io.Reader, fn func(entry Entry) error) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), maxEntrySize)
+
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return fmt.Errorf("journal line %d: %w", line, err)
+		}
+
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,67 @@
+package journal_test
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
+)
+
+func Test_Journal(t *testing.T) {
+	var buf bytes.Buffer
+	j := journal.New(&buf)
+
+	type tick struct {
+		Block uint64 `json:"block"`
+	}
+
+	if err := j.Record(journal.Entry{Kind: "tick"}, tick{Block: 7}); err != nil {
+		t.Fatalf("Should be able to record the entry: %v", err)
+	}
+	if err := j.Record(journal.Entry{Kind: "block", Error: "rejected", Latest: "0xabc"}, nil); err != nil {
+		t.Fatalf("Should be able to record the entry: %v", err)
+	}
+
+	var nilJournal *journal.Journal
+	if err := nilJournal.Record(journal.Entry{Kind: "tick"}, nil); err != nil {
+		t.Fatalf("Should be able to record to a nil journal: %v", err)
+	}
+
+	var entries []journal.Entry
+	err := journal.Read(strings.NewReader(buf.String()), func(entry journal.Entry) error {
+		entries = append(entries, entry)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Should be able to read the journal: %v", err)
+	}
+
+	if len(entries) != 2 {
+		t.Logf("got: %d", len(entries))
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should read every entry.")
+	}
+
+	var got tick
+	if err := entries[0].Decode(&got); err != nil || got.Block != 7 || entries[0].Seq != 1 {
+		t.Fatalf("Should decode the first entry: %+v: %v", entries[0], err)
+	}
+
+	if e := entries[1]; e.Seq != 2 || e.Kind != "block" || e.Error != "rejected" || e.Latest != "0xabc" {
+		t.Fatalf("Should read the second entry: %+v", e)
+	}
+
+	errStop := errors.New("stop")
+	err = journal.Read(strings.NewReader(buf.String()), func(entry journal.Entry) error {
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Fatalf("Should return the error from the function: %v", err)
+	}
+
+	if err := journal.Read(strings.NewReader("{bad"), func(journal.Entry) error { return nil }); err == nil {
+		t.Fatalf("Should fail to read a corrupted journal.")
+	}
+}
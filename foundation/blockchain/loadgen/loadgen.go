@@ -0,0 +1,508 @@
+// Package loadgen generates signed transaction traffic from many accounts
+// against one or more nodes so the throughput of the mempool, gossip and
+// mining can be measured. Transactions are signed by a pool of workers and
+// the nonce of every account is managed by the generator.
+package loadgen
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/client"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Set of value distributions that can be used.
+const (
+	DistUniform     = "uniform"
+	DistExponential = "exponential"
+)
+
+// Set of default values used when the config doesn't provide them.
+const (
+	defaultAccounts    = 10
+	defaultWorkers     = 4
+	defaultMaxValue    = 100
+	defaultFundAmount  = 1_000_000
+	defaultFundTimeout = 2 * time.Minute
+	fundPollInterval   = time.Second
+)
+
+// Config represents the configuration for the generator.
+type Config struct {
+	URLs        []string             // Public API of the nodes, transactions are spread across them.
+	ChainID     uint16               // Chain id the transactions are signed for.
+	Funder      *ecdsa.PrivateKey    // Optional account that funds the generated accounts before the run.
+	FundAmount  uint64               // Amount sent to each generated account by the funder.
+	FundTimeout time.Duration        // Time to wait for the funding transactions to be mined.
+	Accounts    int                  // Number of sending accounts, defaults to 10.
+	Seed        int64                // Seed for the accounts and the traffic, the same seed produces the same accounts.
+	Rate        float64              // Transactions per second, 0 sends as fast as the workers can sign.
+	Duration    time.Duration        // Time to generate traffic, 0 runs until Count or the context ends.
+	Count       int                  // Number of transactions to send, 0 has no limit.
+	Workers     int                  // Number of workers signing and submitting transactions, defaults to 4.
+	MinValue    uint64               // Smallest value sent in a transaction.
+	MaxValue    uint64               // Largest value sent in a transaction, defaults to 100.
+	ValueDist   string               // Distribution of the values, uniform or exponential.
+	Skew        float64              // Zipf skew above 1 concentrates traffic on a few accounts, 0 is uniform.
+	Tip         uint64               // Tip offered on every transaction.
+	HTTPClient  *http.Client         // Optional client to use for the requests.
+	Log         func(string, ...any) // Optional function to report progress.
+}
+
+// Stats represents the outcome of a run.
+type Stats struct {
+	Sent       int64         `json:"sent"`
+	Accepted   int64         `json:"accepted"`
+	Rejected   int64         `json:"rejected"` // Transactions the node responded to with an error.
+	Failed     int64         `json:"failed"`   // Transactions that never reached the node.
+	Elapsed    time.Duration `json:"elapsed"`
+	Rate       float64       `json:"rate"` // Accepted transactions per second.
+	SignTime   time.Duration `json:"sign_time"`
+	LatencyP50 time.Duration `json:"latency_p50"`
+	LatencyP95 time.Duration `json:"latency_p95"`
+	LatencyP99 time.Duration `json:"latency_p99"`
+}
+
+// Generator generates the transaction traffic.
+type Generator struct {
+	cfg      Config
+	clients  []*client.Client
+	accounts []*account
+	log      func(string, ...any)
+}
+
+// account represents a sending account and the next nonce it will use.
+type account struct {
+	id         database.AccountID
+	privateKey *ecdsa.PrivateKey
+
+	mu       sync.Mutex
+	next     uint64
+	released []uint64
+}
+
+// New constructs a generator for the configuration.
+func New(cfg Config) (*Generator, error) {
+	if len(cfg.URLs) == 0 {
+		return nil, errors.New("at least one node url is required")
+	}
+
+	if cfg.Accounts == 0 {
+		cfg.Accounts = defaultAccounts
+	}
+	if cfg.Accounts < 2 {
+		return nil, errors.New("at least two accounts are required")
+	}
+	if cfg.Workers == 0 {
+		cfg.Workers = defaultWorkers
+	}
+	if cfg.MaxValue == 0 {
+		cfg.MaxValue = defaultMaxValue
+	}
+	if cfg.MinValue > cfg.MaxValue {
+		return nil, fmt.Errorf("min value %d is greater than max value %d", cfg.MinValue, cfg.MaxValue)
+	}
+	if cfg.FundAmount == 0 {
+		cfg.FundAmount = defaultFundAmount
+	}
+	if cfg.FundTimeout == 0 {
+		cfg.FundTimeout = defaultFundTimeout
+	}
+
+	switch cfg.ValueDist {
+	case "":
+		cfg.ValueDist = DistUniform
+	case DistUniform, DistExponential:
+	default:
+		return nil, fmt.Errorf("unknown value distribution %q", cfg.ValueDist)
+	}
+
+	if cfg.Skew != 0 && cfg.Skew <= 1 {
+		return nil, errors.New("skew must be greater than 1")
+	}
+
+	g := Generator{
+		cfg: cfg,
+		log: cfg.Log,
+	}
+	if g.log == nil {
+		g.log = func(string, ...any) {}
+	}
+
+	for _, url := range cfg.URLs {
+		g.clients = append(g.clients, client.New(client.Config{
+			URL:        url,
+			HTTPClient: cfg.HTTPClient,
+			Retries:    -1,
+		}))
+	}
+
+	for i := 0; i < cfg.Accounts; i++ {
+		seed := sha256.Sum256([]byte(fmt.Sprintf("loadgen:%d:%d", cfg.Seed, i)))
+		privateKey, err := crypto.ToECDSA(seed[:])
+		if err != nil {
+			return nil, err
+		}
+
+		g.accounts = append(g.accounts, &account{
+			id:         database.PublicKeyToAccountID(privateKey.PublicKey),
+			privateKey: privateKey,
+		})
+	}
+
+	return &g, nil
+}
+
+// Accounts returns the ids of the accounts sending the traffic.
+func (g *Generator) Accounts() []database.AccountID {
+	ids := make([]database.AccountID, len(g.accounts))
+	for i, acc := range g.accounts {
+		ids[i] = acc.id
+	}
+
+	return ids
+}
+
+// Fund has the funder send the fund amount to every account that has less
+// than the amount and waits for the transfers to be mined.
+func (g *Generator) Fund(ctx context.Context) error {
+	if g.cfg.Funder == nil {
+		return errors.New("no funder configured")
+	}
+
+	c := g.clients[0]
+	funderID := database.PublicKeyToAccountID(g.cfg.Funder.PublicKey)
+
+	funder, err := c.GetAccount(ctx, funderID)
+	if err != nil {
+		return fmt.Errorf("funder %s: %w", funderID, err)
+	}
+	nonce := funder.Nonce
+
+	var pending []database.AccountID
+	for _, acc := range g.accounts {
+		balance, err := g.balance(ctx, acc.id)
+		if err != nil {
+			return err
+		}
+		if balance >= g.cfg.FundAmount {
+			continue
+		}
+
+		nonce++
+		tx := database.Tx{
+			ChainID: g.cfg.ChainID,
+			Nonce:   nonce,
+			FromID:  funderID,
+			ToID:    acc.id,
+			Value:   g.cfg.FundAmount,
+		}
+
+		signedTx, err := tx.Sign(g.cfg.Funder)
+		if err != nil {
+			return err
+		}
+
+		if err := c.SubmitTx(ctx, signedTx); err != nil {
+			return fmt.Errorf("funding %s: %w", acc.id, err)
+		}
+		pending = append(pending, acc.id)
+	}
+
+	g.log("loadgen: funding %d accounts", len(pending))
+
+	ctx, cancel := context.WithTimeout(ctx, g.cfg.FundTimeout)
+	defer cancel()
+
+	for len(pending) > 0 {
+		balance, err := g.balance(ctx, pending[0])
+		if err != nil {
+			return err
+		}
+
+		if balance >= g.cfg.FundAmount {
+			pending = pending[1:]
+			continue
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("waiting for %d accounts to be funded: %w", len(pending), ctx.Err())
+		case <-time.After(fundPollInterval):
+		}
+	}
+
+	return nil
+}
+
+// balance returns the balance of the account, 0 if the node doesn't know
+// the account yet.
+func (g *Generator) balance(ctx context.Context, accountID database.AccountID) (uint64, error) {
+	acc, err := g.clients[0].GetAccount(ctx, accountID)
+	switch {
+	case errors.Is(err, client.ErrNotFound):
+		return 0, nil
+	case err != nil:
+		return 0, err
+	}
+
+	return acc.Balance, nil
+}
+
+// =============================================================================
+
+// job represents a single transaction to sign and submit.
+type job struct {
+	seq   int
+	from  *account
+	to    database.AccountID
+	value uint64
+}
+
+// result represents the outcome of a job.
+type result struct {
+	sign    time.Duration
+	latency time.Duration
+	err     error
+}
+
+// Run generates the traffic until the duration or count is reached or the
+// context is cancelled.
+func (g *Generator) Run(ctx context.Context) (Stats, error) {
+	if err := g.loadNonces(ctx); err != nil {
+		return Stats{}, err
+	}
+
+	if g.cfg.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.cfg.Duration)
+		defer cancel()
+	}
+
+	jobs := make(chan job)
+	results := make(chan result, g.cfg.Workers)
+
+	var wg sync.WaitGroup
+	wg.Add(g.cfg.Workers)
+	for i := 0; i < g.cfg.Workers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				results <- g.send(ctx, j)
+			}
+		}()
+	}
+
+	// Collect the results while the jobs are being sent.
+	var stats Stats
+	var signTime time.Duration
+	var latencies []time.Duration
+	collected := make(chan struct{})
+	go func() {
+		defer close(collected)
+		for r := range results {
+			stats.Sent++
+			signTime += r.sign
+
+			var ce *client.Error
+			switch {
+			case r.err == nil:
+				stats.Accepted++
+				latencies = append(latencies, r.latency)
+			case errors.As(r.err, &ce) && ce.StatusCode < http.StatusInternalServerError:
+				stats.Rejected++
+			default:
+				stats.Failed++
+			}
+		}
+	}()
+
+	start := time.Now()
+	g.dispatch(ctx, jobs)
+	close(jobs)
+
+	wg.Wait()
+	close(results)
+	<-collected
+
+	stats.Elapsed = time.Since(start)
+	if secs := stats.Elapsed.Seconds(); secs > 0 {
+		stats.Rate = float64(stats.Accepted) / secs
+	}
+	if stats.Sent > 0 {
+		stats.SignTime = signTime / time.Duration(stats.Sent)
+	}
+
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	stats.LatencyP50 = percentile(latencies, 50)
+	stats.LatencyP95 = percentile(latencies, 95)
+	stats.LatencyP99 = percentile(latencies, 99)
+
+	return stats, nil
+}
+
+// loadNonces asks the node for the next nonce of every account.
+func (g *Generator) loadNonces(ctx context.Context) error {
+	for _, acc := range g.accounts {
+		nonce, err := g.clients[0].NextNonce(ctx, acc.id)
+		if err != nil {
+			return fmt.Errorf("account %s: %w", acc.id, err)
+		}
+		acc.next = nonce
+	}
+
+	return nil
+}
+
+// dispatch sends the jobs at the configured rate until the count is reached
+// or the context is cancelled.
+func (g *Generator) dispatch(ctx context.Context, jobs chan<- job) {
+	rnd := rand.New(rand.NewSource(g.cfg.Seed))
+
+	var zipf *rand.Zipf
+	if g.cfg.Skew > 1 {
+		zipf = rand.NewZipf(rnd, g.cfg.Skew, 1, uint64(len(g.accounts)-1))
+	}
+
+	var tick <-chan time.Time
+	if g.cfg.Rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / g.cfg.Rate))
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for seq := 0; g.cfg.Count == 0 || seq < g.cfg.Count; seq++ {
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-tick:
+			}
+		}
+
+		from := rnd.Intn(len(g.accounts))
+		if zipf != nil {
+			from = int(zipf.Uint64())
+		}
+		to := (from + 1 + rnd.Intn(len(g.accounts)-1)) % len(g.accounts)
+
+		j := job{
+			seq:   seq,
+			from:  g.accounts[from],
+			to:    g.accounts[to].id,
+			value: g.value(rnd),
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case jobs <- j:
+		}
+	}
+}
+
+// value picks the value of a transaction from the configured distribution.
+// The exponential distribution sends many small values and few large ones.
+func (g *Generator) value(rnd *rand.Rand) uint64 {
+	spread := g.cfg.MaxValue - g.cfg.MinValue
+
+	switch g.cfg.ValueDist {
+	case DistExponential:
+		v := uint64(rnd.ExpFloat64() * float64(spread) / 4)
+		if v > spread {
+			v = spread
+		}
+		return g.cfg.MinValue + v
+
+	default:
+		return g.cfg.MinValue + uint64(rnd.Int63n(int64(spread)+1))
+	}
+}
+
+// send signs the transaction for the job and submits it to one of the nodes.
+func (g *Generator) send(ctx context.Context, j job) result {
+	nonce := j.from.allocNonce()
+
+	start := time.Now()
+
+	tx := database.Tx{
+		ChainID: g.cfg.ChainID,
+		Nonce:   nonce,
+		FromID:  j.from.id,
+		ToID:    j.to,
+		Value:   j.value,
+		Tip:     g.cfg.Tip,
+	}
+
+	signedTx, err := tx.Sign(j.from.privateKey)
+	if err != nil {
+		j.from.releaseNonce(nonce)
+		return result{err: err}
+	}
+
+	signed := time.Now()
+
+	c := g.clients[j.seq%len(g.clients)]
+	if err := c.SubmitTx(ctx, signedTx); err != nil {
+		j.from.releaseNonce(nonce)
+		return result{sign: signed.Sub(start), err: err}
+	}
+
+	return result{sign: signed.Sub(start), latency: time.Since(signed)}
+}
+
+// allocNonce returns the next nonce for the account. Nonces given back by
+// failed transactions are used first so the account never has a gap.
+func (acc *account) allocNonce() uint64 {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+
+	if len(acc.released) > 0 {
+		nonce := acc.released[0]
+		acc.released = acc.released[1:]
+		return nonce
+	}
+
+	nonce := acc.next
+	acc.next++
+
+	return nonce
+}
+
+// releaseNonce gives back the nonce of a transaction that wasn't accepted.
+func (acc *account) releaseNonce(nonce uint64) {
+	acc.mu.Lock()
+	defer acc.mu.Unlock()
+
+	if acc.next == nonce+1 {
+		acc.next = nonce
+		return
+	}
+
+	acc.released = append(acc.released, nonce)
+	sort.Slice(acc.released, func(i, j int) bool { return acc.released[i] < acc.released[j] })
+}
+
+// percentile returns the percentile of the sorted durations.
+func percentile(sorted []time.Duration, p int) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+
+	i := (len(sorted)*p + 99) / 100
+	if i > 0 {
+		i--
+	}
+
+	return sorted[i]
+}
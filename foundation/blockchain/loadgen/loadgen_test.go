@@ -0,0 +1,184 @@
+package loadgen_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/loadgen"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const chainID = 1
+
+func Test_Run(t *testing.T) {
+	node := newNode()
+
+	// Reject one submission so the nonce has to be given back and reused.
+	node.reject = 5
+
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	g, err := loadgen.New(loadgen.Config{
+		URLs:      []string{srv.URL, srv.URL},
+		ChainID:   chainID,
+		Accounts:  5,
+		Count:     50,
+		Workers:   4,
+		MinValue:  1,
+		MaxValue:  10,
+		ValueDist: loadgen.DistExponential,
+		Skew:      1.5,
+		Seed:      42,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the generator: %v", err)
+	}
+
+	stats, err := g.Run(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to run the generator: %v", err)
+	}
+
+	if stats.Sent != 50 || stats.Accepted != 49 || stats.Rejected != 1 || stats.Failed != 0 {
+		t.Logf("got: %+v", stats)
+		t.Logf("exp: sent 50, accepted 49, rejected 1")
+		t.Fatalf("Should account for every transaction.")
+	}
+
+	node.mu.Lock()
+	defer node.mu.Unlock()
+
+	for id, txs := range node.txs {
+		seen := make(map[uint64]bool)
+		for _, tx := range txs {
+			if tx.Value < 1 || tx.Value > 10 {
+				t.Fatalf("Should keep the value in range, got %d.", tx.Value)
+			}
+			if seen[tx.Nonce] {
+				t.Fatalf("Should not use nonce %d twice for %s.", tx.Nonce, id)
+			}
+			seen[tx.Nonce] = true
+		}
+
+		for nonce := uint64(1); nonce <= uint64(len(txs)); nonce++ {
+			if !seen[nonce] {
+				t.Fatalf("Should not leave a gap at nonce %d for %s.", nonce, id)
+			}
+		}
+	}
+}
+
+func Test_Fund(t *testing.T) {
+	node := newNode()
+
+	funder, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("Should be able to generate a key: %v", err)
+	}
+	node.balances[database.PublicKeyToAccountID(funder.PublicKey)] = 1_000
+
+	srv := httptest.NewServer(node)
+	defer srv.Close()
+
+	g, err := loadgen.New(loadgen.Config{
+		URLs:       []string{srv.URL},
+		ChainID:    chainID,
+		Funder:     funder,
+		FundAmount: 100,
+		Accounts:   3,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the generator: %v", err)
+	}
+
+	// The first account already has enough and doesn't need to be funded.
+	accounts := g.Accounts()
+	node.balances[accounts[0]] = 100
+
+	if err := g.Fund(context.Background()); err != nil {
+		t.Fatalf("Should be able to fund the accounts: %v", err)
+	}
+
+	for _, id := range accounts {
+		if got := node.balances[id]; got != 100 {
+			t.Logf("got: %d", got)
+			t.Logf("exp: %d", 100)
+			t.Fatalf("Should fund account %s.", id)
+		}
+	}
+
+	if got := len(node.txs[database.PublicKeyToAccountID(funder.PublicKey)]); got != 2 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should only fund the accounts that need it.")
+	}
+}
+
+// =============================================================================
+
+// node is a fake node that accepts valid transactions and applies the value
+// to the balances right away.
+type node struct {
+	mu       sync.Mutex
+	balances map[database.AccountID]uint64
+	txs      map[database.AccountID][]database.Tx
+	submits  int
+	reject   int
+}
+
+func newNode() *node {
+	return &node{
+		balances: make(map[database.AccountID]uint64),
+		txs:      make(map[database.AccountID][]database.Tx),
+	}
+}
+
+func (n *node) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/tx/submit":
+		var signedTx database.SignedTx
+		if err := json.NewDecoder(r.Body).Decode(&signedTx); err != nil || signedTx.Validate(chainID) != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"invalid transaction"}`)
+			return
+		}
+
+		n.submits++
+		if n.submits == n.reject {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprint(w, `{"error":"rejected"}`)
+			return
+		}
+
+		n.txs[signedTx.FromID] = append(n.txs[signedTx.FromID], signedTx.Tx)
+		n.balances[signedTx.ToID] += signedTx.Value
+		fmt.Fprint(w, `{"status":"transactions added to mempool"}`)
+
+	case strings.HasPrefix(r.URL.Path, "/v1/accounts/list/"):
+		id := database.AccountID(strings.TrimPrefix(r.URL.Path, "/v1/accounts/list/"))
+		balance, exists := n.balances[id]
+		if !exists {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		fmt.Fprintf(w, `{"lastest_block":"0x0","uncommitted":0,"accounts":[{"account":%q,"balance":%d,"nonce":%d}]}`, id, balance, len(n.txs[id]))
+
+	case strings.HasPrefix(r.URL.Path, "/v1/tx/uncommitted/list/"):
+		fmt.Fprint(w, `[]`)
+
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -2,16 +2,20 @@
 package mempool
 
 import (
-	"errors"
 	"fmt"
 	"math"
 	"strings"
 	"sync"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/mempool/selector"
 )
 
+// ErrReplaceUnderpriced is returned when a transaction replaces a pending
+// transaction without a high enough tip.
+var ErrReplaceUnderpriced = errcode.New(errcode.Underpriced, "replacing a transaction requires a 10% bump in the tip")
+
 // Mempool represents a cache of transactions organized by account:nonce.
 type Mempool struct {
 	mu       sync.RWMutex
@@ -68,8 +72,8 @@ func (mp *Mempool) Upsert(tx database.BlockTx) error {
 	// transaction in the mempool and so do we. We want to limit users
 	// from this sort of behavior.
 	if etx, exists := mp.pool[key]; exists {
-		if tx.Tip < uint64(math.Round(float64(etx.Tip)*1.10)) {
-			return errors.New("replacing a transaction requires a 10% bump in the tip")
+		if tx.Tip < MinReplacementTip(etx.Tip) {
+			return ErrReplaceUnderpriced
 		}
 	}
 
@@ -78,6 +82,23 @@ func (mp *Mempool) Upsert(tx database.BlockTx) error {
 	return nil
 }
 
+// Lookup returns the transaction for the account and nonce if it's in the
+// mempool.
+func (mp *Mempool) Lookup(accountID database.AccountID, nonce uint64) (database.BlockTx, bool) {
+	mp.mu.RLock()
+	defer mp.mu.RUnlock()
+
+	tx := database.BlockTx{SignedTx: database.SignedTx{Tx: database.Tx{FromID: accountID, Nonce: nonce}}}
+	key, err := mapKey(tx)
+	if err != nil {
+		return database.BlockTx{}, false
+	}
+
+	tx, exists := mp.pool[key]
+
+	return tx, exists
+}
+
 // Delete removed a transaction from the mempool.
 func (mp *Mempool) Delete(tx database.BlockTx) error {
 	mp.mu.Lock()
@@ -93,6 +114,76 @@ func (mp *Mempool) Delete(tx database.BlockTx) error {
 	return nil
 }
 
+// DeleteByNonce removes the transaction for the account and nonce from the
+// mempool and reports if it was found.
+func (mp *Mempool) DeleteByNonce(accountID database.AccountID, nonce uint64) bool {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	tx := database.BlockTx{SignedTx: database.SignedTx{Tx: database.Tx{FromID: accountID, Nonce: nonce}}}
+	key, err := mapKey(tx)
+	if err != nil {
+		return false
+	}
+
+	if _, exists := mp.pool[key]; !exists {
+		return false
+	}
+	delete(mp.pool, key)
+
+	return true
+}
+
+// DeleteExpired removes the transactions that can no longer be mined into
+// the specified block number and returns the number removed.
+func (mp *Mempool) DeleteExpired(blockNum uint64) int {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var removed int
+	for key, tx := range mp.pool {
+		if tx.IsExpired(blockNum) {
+			delete(mp.pool, key)
+			removed++
+		}
+	}
+
+	return removed
+}
+
+// Reconcile removes the transactions mined into a block from the mempool. The
+// nonces hold the latest nonce of each account after the block was applied and
+// any other transaction for those accounts that uses a nonce at or below it
+// can never be mined, so it's evicted. The number of mined transactions that
+// were removed and the evicted transactions are returned.
+func (mp *Mempool) Reconcile(mined []database.BlockTx, nonces map[database.AccountID]uint64) (int, []database.BlockTx) {
+	mp.mu.Lock()
+	defer mp.mu.Unlock()
+
+	var removed int
+	for _, tx := range mined {
+		key, err := mapKey(tx)
+		if err != nil {
+			continue
+		}
+
+		if etx, exists := mp.pool[key]; exists && etx.Equals(tx) {
+			delete(mp.pool, key)
+			removed++
+		}
+	}
+
+	var evicted []database.BlockTx
+	for key, tx := range mp.pool {
+		if nonce, exists := nonces[tx.FromID]; exists && tx.Nonce <= nonce {
+			delete(mp.pool, key)
+			evicted = append(evicted, tx)
+		}
+	}
+
+	return removed, evicted
+}
+
 // Truncate clears all the transactions from the pool.
 func (mp *Mempool) Truncate() {
 	mp.mu.Lock()
@@ -111,8 +202,9 @@ func (mp *Mempool) PickBest(howMany ...uint16) []database.BlockTx {
 
 	// CORE NOTE: Most blockchains do set a max block size limit and this size
 	// will determined which transactions are selected. When picking the best
-	// transactions for the next block, the Ardan blockchain is currently not
-	// focused on block size but a max number of transactions.
+	// transactions for the next block, the Ardan blockchain picks a max number
+	// of transactions unless the genesis sets a block gas limit, in which case
+	// every transaction is returned and the block is filled by gas.
 	//
 	// When the selection algorithm does need to consider sizing, picking the
 	// right transactions that maximize profit gets really hard. On top of this,
@@ -143,6 +235,12 @@ func (mp *Mempool) PickBest(howMany ...uint16) []database.BlockTx {
 
 // =============================================================================
 
+// MinReplacementTip returns the least tip a transaction needs to replace the
+// transaction with the specified tip in the mempool.
+func MinReplacementTip(tip uint64) uint64 {
+	return uint64(math.Round(float64(tip) * 1.10))
+}
+
 // mapKey is used to generate the map key.
 func mapKey(tx database.BlockTx) (string, error) {
 	return fmt.Sprintf("%s:%d", tx.FromID, tx.Nonce), nil
@@ -105,6 +105,86 @@ func Test_CRUD(t *testing.T) {
 
 // =============================================================================
 
+func Test_DeleteExpired(t *testing.T) {
+	const hexKey = "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"
+
+	mp, err := mempool.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	for nonce, validUntil := range []uint64{0, 5, 10} {
+		tx, err := sign(hexKey, database.Tx{Nonce: uint64(nonce + 1), FromID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", ValidUntil: validUntil})
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+
+		if err := mp.Upsert(tx); err != nil {
+			t.Fatalf("Should be able to upsert transaction: %s", err)
+		}
+	}
+
+	if n := mp.DeleteExpired(5); n != 0 {
+		t.Fatalf("Should not remove a transaction that can still be mined, removed %d.", n)
+	}
+
+	if n := mp.DeleteExpired(6); n != 1 || mp.Count() != 2 {
+		t.Logf("got: %d", mp.Count())
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should remove the expired transaction.")
+	}
+}
+
+func Test_Reconcile(t *testing.T) {
+	const hexKey = "fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959"
+	const accountID = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+
+	mp, err := mempool.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct a mempool: %s", err)
+	}
+
+	var txs []database.BlockTx
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx, err := sign(hexKey, database.Tx{Nonce: nonce, FromID: accountID, ToID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"})
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %s", err)
+		}
+
+		if err := mp.Upsert(tx); err != nil {
+			t.Fatalf("Should be able to upsert transaction: %s", err)
+		}
+		txs = append(txs, tx)
+	}
+
+	// The block holds a different transaction for nonce 2, so the one in the
+	// mempool for nonce 2 conflicts with it.
+	other, err := sign(hexKey, database.Tx{Nonce: 2, FromID: accountID, ToID: "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"})
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %s", err)
+	}
+
+	mined, evicted := mp.Reconcile([]database.BlockTx{txs[0], other}, map[database.AccountID]uint64{accountID: 2})
+
+	if mined != 1 {
+		t.Logf("got: %d", mined)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should remove the mined transaction.")
+	}
+
+	if len(evicted) != 1 || !evicted[0].Equals(txs[1]) {
+		t.Logf("got: %v", evicted)
+		t.Logf("exp: %v", txs[1])
+		t.Fatalf("Should evict the transaction using the same nonce.")
+	}
+
+	if best := mp.PickBest(); len(best) != 1 || !best[0].Equals(txs[2]) {
+		t.Logf("got: %v", best)
+		t.Logf("exp: %v", txs[2])
+		t.Fatalf("Should keep the transaction with the next nonce.")
+	}
+}
+
 func sign(hexKey string, tx database.Tx) (database.BlockTx, error) {
 	pk, err := crypto.HexToECDSA(hexKey)
 	if err != nil {
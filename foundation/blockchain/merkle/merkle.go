@@ -65,10 +65,14 @@ func NewTree[T Hashable[T]](values []T, options ...func(t *Tree[T])) (*Tree[T],
 
 // Generate constructs the leafs and nodes of the tree from the specified
 // data. If the tree has been generated previously, the tree is re-generated
-// from scratch.
+// from scratch. A tree with no data has no nodes and the hash of no content
+// as the merkle root, which is how a block without transactions is stored.
 func (t *Tree[T]) Generate(values []T) error {
 	if len(values) == 0 {
-		return errors.New("cannot construct tree with no content")
+		t.Root = nil
+		t.Leafs = nil
+		t.MerkleRoot = t.hashStrategy().Sum(nil)
+		return nil
 	}
 
 	var leafs []*Node[T]
@@ -186,6 +190,13 @@ func (t *Tree[T]) Proof(data T) ([][]byte, []int64, error) {
 // Verify validates the hashes at each level of the tree and returns true
 // if the resulting hash at the root of the tree matches the resulting root hash.
 func (t *Tree[T]) Verify() error {
+	if t.Root == nil {
+		if !bytes.Equal(t.MerkleRoot, t.hashStrategy().Sum(nil)) {
+			return errors.New("root hashe invalid")
+		}
+		return nil
+	}
+
 	calculatedMerkleRoot, err := t.Root.verify()
 	if err != nil {
 		return err
@@ -247,6 +258,9 @@ func (t *Tree[T]) Values() []T {
 	}
 
 	l := len(t.Leafs)
+	if l == 0 {
+		return nil
+	}
 	if bytes.Equal(t.Leafs[l-1].Hash, t.Leafs[l-2].Hash) {
 		return values[:l-1]
 	}
@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"crypto/sha256"
 	"hash"
+	"strconv"
 	"testing"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/merkle"
@@ -120,6 +121,26 @@ func Test_VerifyTree(t *testing.T) {
 	}
 }
 
+func Test_EmptyTree(t *testing.T) {
+	tree, err := merkle.NewTree([]Data{})
+	if err != nil {
+		t.Fatalf("error: unexpected error: %v", err)
+	}
+	if exp := sha256.New().Sum(nil); !bytes.Equal(tree.MerkleRoot, exp) {
+		t.Errorf("error: expected hash equal to %v got %v", exp, tree.MerkleRoot)
+	}
+	if values := tree.Values(); len(values) != 0 {
+		t.Errorf("error: expected no values got %v", values)
+	}
+	if err := tree.Verify(); err != nil {
+		t.Errorf("error: expected tree to be valid: %v", err)
+	}
+	tree.MerkleRoot = []byte{1}
+	if err := tree.Verify(); err == nil {
+		t.Errorf("error: expected tree to be invalid")
+	}
+}
+
 func Test_VerifyData(t *testing.T) {
 	for i := 0; i < len(table); i++ {
 		tree, err := merkle.NewTree(table[i].data, merkle.WithHashStrategy[Data](table[i].hashStrategy))
@@ -206,6 +227,25 @@ func Test_MerklePath(t *testing.T) {
 
 // =============================================================================
 
+func Benchmark_NewTree(b *testing.B) {
+	for _, n := range []int{10, 100, 1000} {
+		data := make([]Data, n)
+		for i := range data {
+			data[i] = Data{x: strconv.Itoa(i)}
+		}
+
+		b.Run("leaves="+strconv.Itoa(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := merkle.NewTree(data); err != nil {
+					b.Fatalf("Should be able to create tree: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// =============================================================================
+
 func calHash(hash []byte, hashStrategy func() hash.Hash) ([]byte, error) {
 	h := hashStrategy()
 	if _, err := h.Write(hash); err != nil {
@@ -0,0 +1,285 @@
+package peer
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// EnvelopeContentType is the content type used when a message between peers
+// is wrapped in an envelope.
+const EnvelopeContentType = "application/vnd.ardan.envelope"
+
+// EnvelopeVersion is the version of the envelope protocol this node speaks.
+const EnvelopeVersion = 1
+
+// MaxPayloadSize is the largest payload a peer is allowed to send in a single
+// message.
+const MaxPayloadSize = 32 << 20
+
+// Set of payload types an envelope can carry.
+const (
+	PayloadJSON   uint8 = 1
+	PayloadBinary uint8 = 2
+)
+
+// Set of envelope header details.
+const (
+	envelopeMagic  = "ARDN"
+	envelopeHeader = 14 // Magic(4) + Version(1) + Type(1) + Length(4) + Checksum(4).
+)
+
+// Set of errors returned when an envelope can't be opened.
+var (
+	ErrEnvelopeTruncated = errors.New("envelope truncated")
+	ErrEnvelopeChecksum  = errors.New("envelope checksum mismatch")
+	ErrEnvelopeTooLarge  = errors.New("envelope payload too large")
+)
+
+// CORE NOTE: HTTP already frames each request, but nothing checks that the
+// body that arrives is the body that was sent. A proxy cutting a response
+// short or a flipped bit in a block would otherwise only surface as a decode
+// error deep in block validation, or worse as a block that decodes into
+// something else. The envelope states the payload's length and checksum up
+// front so a bad message is dropped before it's decoded, and the length is
+// checked against the limit before the payload is read at all.
+//
+// Envelopes are negotiated with the usual headers. A request carries the
+// envelope content type and asks for an enveloped response by listing the
+// envelope in the Accept header. Messages without an envelope are still
+// accepted so a node can talk with peers running an older version.
+
+// SealEnvelope wraps the payload in an envelope of the specified type.
+func SealEnvelope(payloadType uint8, payload []byte) ([]byte, error) {
+	if len(payload) > MaxPayloadSize {
+		return nil, fmt.Errorf("%w: %d bytes", ErrEnvelopeTooLarge, len(payload))
+	}
+
+	data := make([]byte, envelopeHeader+len(payload))
+	copy(data, envelopeMagic)
+	data[4] = EnvelopeVersion
+	data[5] = payloadType
+	binary.BigEndian.PutUint32(data[6:10], uint32(len(payload)))
+	copy(data[10:14], checksum(payload))
+	copy(data[envelopeHeader:], payload)
+
+	return data, nil
+}
+
+// ReadEnvelope reads an envelope from the reader and returns the payload
+// type and the payload once its length and checksum are verified.
+func ReadEnvelope(r io.Reader) (uint8, []byte, error) {
+	var header [envelopeHeader]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, ErrEnvelopeTruncated
+		}
+		return 0, nil, err
+	}
+
+	if string(header[:4]) != envelopeMagic {
+		return 0, nil, errors.New("envelope magic is invalid")
+	}
+
+	if header[4] != EnvelopeVersion {
+		return 0, nil, fmt.Errorf("envelope version %d is not supported", header[4])
+	}
+
+	payloadType := header[5]
+	if payloadType != PayloadJSON && payloadType != PayloadBinary {
+		return 0, nil, fmt.Errorf("envelope payload type %d is not supported", payloadType)
+	}
+
+	length := binary.BigEndian.Uint32(header[6:10])
+	if length > MaxPayloadSize {
+		return 0, nil, fmt.Errorf("%w: %d bytes", ErrEnvelopeTooLarge, length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			return 0, nil, ErrEnvelopeTruncated
+		}
+		return 0, nil, err
+	}
+
+	if !bytes.Equal(header[10:14], checksum(payload)) {
+		return 0, nil, ErrEnvelopeChecksum
+	}
+
+	// Anything after the payload means the length doesn't match what was sent.
+	var extra [1]byte
+	if n, _ := r.Read(extra[:]); n > 0 {
+		return 0, nil, errors.New("envelope has data after the payload")
+	}
+
+	return payloadType, payload, nil
+}
+
+// PayloadType returns the envelope payload type for the content type.
+func PayloadType(contentType string) uint8 {
+	if contentType == database.BinaryContentType {
+		return PayloadBinary
+	}
+
+	return PayloadJSON
+}
+
+// ContentType returns the content type for the envelope payload type.
+func ContentType(payloadType uint8) string {
+	if payloadType == PayloadBinary {
+		return database.BinaryContentType
+	}
+
+	return "application/json"
+}
+
+// AcceptsEnvelope reports if the Accept header lists the envelope and returns
+// the header without it.
+func AcceptsEnvelope(accept string) (bool, string) {
+	var found bool
+	var rest []string
+	for _, value := range strings.Split(accept, ",") {
+		value = strings.TrimSpace(value)
+		switch value {
+		case EnvelopeContentType:
+			found = true
+		case "":
+		default:
+			rest = append(rest, value)
+		}
+	}
+
+	return found, strings.Join(rest, ", ")
+}
+
+// =============================================================================
+
+// OpenRequest replaces the body of an enveloped request with its payload and
+// sets the content type of the payload. A request without an envelope has its
+// body limited to the maximum payload size. It also reports if the peer asked
+// for an enveloped response, removing the envelope from the Accept header so
+// handlers see the content type they are asked for.
+func OpenRequest(r *http.Request) (bool, error) {
+	enveloped, accept := AcceptsEnvelope(r.Header.Get("Accept"))
+	if enveloped {
+		r.Header.Set("Accept", accept)
+	}
+
+	if r.Header.Get("Content-Type") != EnvelopeContentType {
+		if r.Body != nil {
+			r.Body = http.MaxBytesReader(nil, r.Body, MaxPayloadSize)
+		}
+		return enveloped, nil
+	}
+
+	payloadType, payload, err := ReadEnvelope(r.Body)
+	if err != nil {
+		return enveloped, err
+	}
+
+	r.Body = io.NopCloser(bytes.NewReader(payload))
+	r.ContentLength = int64(len(payload))
+	r.Header.Set("Content-Type", ContentType(payloadType))
+
+	return enveloped, nil
+}
+
+// EnvelopeWriter holds back a successful response so it can be sent in an
+// envelope once the handler is done. Any other response is written as is.
+type EnvelopeWriter struct {
+	http.ResponseWriter
+	statusCode int
+	body       bytes.Buffer
+}
+
+// NewEnvelopeWriter constructs a writer that envelopes the response written
+// to it.
+func NewEnvelopeWriter(w http.ResponseWriter) *EnvelopeWriter {
+	return &EnvelopeWriter{
+		ResponseWriter: w,
+	}
+}
+
+// WriteHeader records the status code, sending it right away unless the
+// response is held back for the envelope.
+func (ew *EnvelopeWriter) WriteHeader(statusCode int) {
+	if ew.statusCode != 0 {
+		return
+	}
+	ew.statusCode = statusCode
+
+	if statusCode != http.StatusOK {
+		ew.ResponseWriter.WriteHeader(statusCode)
+	}
+}
+
+// Write holds back the data for a successful response.
+func (ew *EnvelopeWriter) Write(data []byte) (int, error) {
+	if ew.statusCode == 0 {
+		ew.WriteHeader(http.StatusOK)
+	}
+
+	if ew.statusCode != http.StatusOK {
+		return ew.ResponseWriter.Write(data)
+	}
+
+	return ew.body.Write(data)
+}
+
+// Seal sends the held back response in an envelope. It does nothing if the
+// response wasn't successful since it was already sent.
+func (ew *EnvelopeWriter) Seal() error {
+	if ew.statusCode != http.StatusOK {
+		return nil
+	}
+
+	data, err := SealEnvelope(PayloadType(ew.Header().Get("Content-Type")), ew.body.Bytes())
+	if err != nil {
+		return err
+	}
+
+	ew.Header().Set("Content-Type", EnvelopeContentType)
+	ew.ResponseWriter.WriteHeader(http.StatusOK)
+
+	_, err = ew.ResponseWriter.Write(data)
+	return err
+}
+
+// EnvelopeHandler wraps a handler so requests and responses between peers
+// can be sent in envelopes.
+func EnvelopeHandler(h http.Handler) http.Handler {
+	f := func(w http.ResponseWriter, r *http.Request) {
+		enveloped, err := OpenRequest(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if !enveloped {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		ew := NewEnvelopeWriter(w)
+		h.ServeHTTP(ew, r)
+		ew.Seal()
+	}
+
+	return http.HandlerFunc(f)
+}
+
+// =============================================================================
+
+// checksum returns the first 4 bytes of the sha256 hash of the payload.
+func checksum(payload []byte) []byte {
+	sum := sha256.Sum256(payload)
+	return sum[:4]
+}
@@ -0,0 +1,113 @@
+package peer_test
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+func Test_Envelope(t *testing.T) {
+	payload := []byte(`{"number":42}`)
+
+	data, err := peer.SealEnvelope(peer.PayloadJSON, payload)
+	if err != nil {
+		t.Fatalf("Should be able to seal the payload: %v", err)
+	}
+
+	payloadType, got, err := peer.ReadEnvelope(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Should be able to read the envelope: %v", err)
+	}
+
+	if payloadType != peer.PayloadJSON || !bytes.Equal(got, payload) {
+		t.Logf("got: %d %s", payloadType, got)
+		t.Logf("exp: %d %s", peer.PayloadJSON, payload)
+		t.Fatalf("Should get back the payload that was sealed.")
+	}
+
+	if _, _, err := peer.ReadEnvelope(bytes.NewReader(data[:len(data)-3])); !errors.Is(err, peer.ErrEnvelopeTruncated) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", peer.ErrEnvelopeTruncated)
+		t.Fatalf("Should detect a truncated payload.")
+	}
+
+	corrupt := make([]byte, len(data))
+	copy(corrupt, data)
+	corrupt[len(corrupt)-2] ^= 0xff
+
+	if _, _, err := peer.ReadEnvelope(bytes.NewReader(corrupt)); !errors.Is(err, peer.ErrEnvelopeChecksum) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", peer.ErrEnvelopeChecksum)
+		t.Fatalf("Should detect a corrupted payload.")
+	}
+
+	if _, _, err := peer.ReadEnvelope(bytes.NewReader(append(data, 'x'))); err == nil {
+		t.Fatalf("Should detect data after the payload.")
+	}
+
+	if _, err := peer.SealEnvelope(peer.PayloadBinary, make([]byte, peer.MaxPayloadSize+1)); !errors.Is(err, peer.ErrEnvelopeTooLarge) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", peer.ErrEnvelopeTooLarge)
+		t.Fatalf("Should not seal a payload over the size limit.")
+	}
+}
+
+func Test_EnvelopeHandler(t *testing.T) {
+	payload := []byte{0x01, 0x02, 0x03}
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Content-Type") != database.BinaryContentType || r.Header.Get("Accept") != database.BinaryContentType {
+			http.Error(w, "wrong headers", http.StatusBadRequest)
+			return
+		}
+
+		w.Header().Set("Content-Type", database.BinaryContentType)
+		w.Write(payload)
+	}
+	handler := peer.EnvelopeHandler(http.HandlerFunc(h))
+
+	data, err := peer.SealEnvelope(peer.PayloadBinary, payload)
+	if err != nil {
+		t.Fatalf("Should be able to seal the payload: %v", err)
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", peer.EnvelopeContentType)
+	r.Header.Set("Accept", database.BinaryContentType+", "+peer.EnvelopeContentType)
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusOK {
+		t.Logf("got: %d %s", w.Code, w.Body.String())
+		t.Logf("exp: %d", http.StatusOK)
+		t.Fatalf("Should see the payload and headers the peer sent.")
+	}
+
+	payloadType, got, err := peer.ReadEnvelope(w.Body)
+	if err != nil {
+		t.Fatalf("Should get an enveloped response: %v", err)
+	}
+
+	if payloadType != peer.PayloadBinary || !bytes.Equal(got, payload) {
+		t.Logf("got: %d %v", payloadType, got)
+		t.Logf("exp: %d %v", peer.PayloadBinary, payload)
+		t.Fatalf("Should get back the response payload.")
+	}
+
+	data[len(data)-1] ^= 0xff
+	r = httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(data))
+	r.Header.Set("Content-Type", peer.EnvelopeContentType)
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusBadRequest {
+		t.Logf("got: %d", w.Code)
+		t.Logf("exp: %d", http.StatusBadRequest)
+		t.Fatalf("Should reject a corrupted request before the handler sees it.")
+	}
+}
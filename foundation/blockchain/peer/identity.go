@@ -0,0 +1,75 @@
+package peer
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// CORE NOTE: A host and port only say where a node can be reached today. A
+// node that restarts behind a new IP address would look like a new peer and
+// the old entry would linger until it's dropped as unreachable. Each node
+// keeps a key on disk instead and is identified by the fingerprint of its
+// public key, so peers recognize it wherever it shows up. The key never leaves
+// the node and the fingerprint is all that is shared.
+
+// Identity represents the key a node is identified by on the network.
+type Identity struct {
+	ID        string
+	PublicKey ed25519.PublicKey
+}
+
+// LoadIdentity reads the identity kept in the file, generating and saving a
+// new one the first time the node starts.
+func LoadIdentity(path string) (Identity, error) {
+	data, err := os.ReadFile(path)
+	switch {
+	case err == nil:
+		seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return Identity{}, fmt.Errorf("identity file %s is invalid", path)
+		}
+		return newIdentity(ed25519.NewKeyFromSeed(seed)), nil
+
+	case !errors.Is(err, os.ErrNotExist):
+		return Identity{}, err
+	}
+
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return Identity{}, err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return Identity{}, err
+	}
+
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())), 0600); err != nil {
+		return Identity{}, err
+	}
+
+	return newIdentity(key), nil
+}
+
+// newIdentity constructs the identity for the key.
+func newIdentity(key ed25519.PrivateKey) Identity {
+	publicKey := key.Public().(ed25519.PublicKey)
+
+	return Identity{
+		ID:        Fingerprint(publicKey),
+		PublicKey: publicKey,
+	}
+}
+
+// Fingerprint returns the node id for the public key, the hex encoding of the
+// first 20 bytes of its sha256 hash.
+func Fingerprint(publicKey ed25519.PublicKey) string {
+	sum := sha256.Sum256(publicKey)
+	return hex.EncodeToString(sum[:20])
+}
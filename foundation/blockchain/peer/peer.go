@@ -3,24 +3,107 @@
 package peer
 
 import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
 	"sync"
+	"time"
 )
 
-// Peer represents information about a Node in the network.
+// Peer represents information about a Node in the network. The host is the
+// primary address the peer is known by, the other addresses are tried in
+// order when the primary address is unreachable. The id is the fingerprint
+// of the node's identity once it's known.
 type Peer struct {
-	Host string
+	Host  string
+	Addrs []string `json:",omitempty"`
+	ID    string   `json:",omitempty"`
 }
 
-// New contructs a new info value.
-func New(host string) Peer {
-	return Peer{
+// New contructs a new info value. Any other addresses the node can be
+// reached at are given in order of preference.
+func New(host string, addrs ...string) Peer {
+	pr := Peer{
 		Host: host,
 	}
+
+	for _, addr := range addrs {
+		pr.addAddr(addr)
+	}
+
+	return pr
+}
+
+// Parse converts a peer written as its addresses separated by a | in order of
+// preference, such as 10.0.0.1:9080|[fd00::1]:9080|node1.example.com:9080.
+func Parse(value string) (Peer, error) {
+	addrs := strings.Split(value, "|")
+	for i := range addrs {
+		addrs[i] = strings.TrimSpace(addrs[i])
+	}
+
+	pr := New(addrs[0], addrs[1:]...)
+	if err := pr.Validate(); err != nil {
+		return Peer{}, err
+	}
+
+	return pr, nil
+}
+
+// Validate checks every address of the peer is a host and port, where the
+// host is an IPv4 address, a bracketed IPv6 address or a DNS name.
+func (p Peer) Validate() error {
+	if p.Host == "" {
+		return errors.New("peer host is required")
+	}
+
+	for _, addr := range p.Addresses() {
+		host, port, err := net.SplitHostPort(addr)
+		if err != nil {
+			return fmt.Errorf("peer address %q: %w", addr, err)
+		}
+
+		if host == "" || port == "" {
+			return fmt.Errorf("peer address %q must have a host and port", addr)
+		}
+	}
+
+	return nil
 }
 
-// Match validates if the specified host matches this node.
+// Addresses returns the addresses of the peer in order of preference,
+// starting with the primary address.
+func (p Peer) Addresses() []string {
+	return append([]string{p.Host}, p.Addrs...)
+}
+
+// Match validates if the specified host matches this node at any of its
+// addresses.
 func (p Peer) Match(host string) bool {
-	return p.Host == host
+	if p.Host == host {
+		return true
+	}
+
+	for _, addr := range p.Addrs {
+		if addr == host {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addAddr adds another address for the peer if it's not already known.
+func (p *Peer) addAddr(addr string) bool {
+	if addr == "" || p.Match(addr) {
+		return false
+	}
+	p.Addrs = append(p.Addrs, addr)
+
+	return true
 }
 
 // =============================================================================
@@ -28,37 +111,118 @@ func (p Peer) Match(host string) bool {
 // PeerStatus represents information about the status
 // of any given peer.
 type PeerStatus struct {
-	LatestBlockHash   string `json:"latest_block_hash"`
-	LatestBlockNumber uint64 `json:"latest_block_number"`
-	KnownPeers        []Peer `json:"known_peers"`
+	ChainID              uint16 `json:"chain_id"`
+	LatestBlockHash      string `json:"latest_block_hash"`
+	LatestBlockNumber    uint64 `json:"latest_block_number"`
+	FinalizedBlockNumber uint64 `json:"finalized_block_number"`
+	KnownPeers           []Peer `json:"known_peers"`
+	NodeID               string `json:"node_id,omitempty"`
+	PeersToken           string `json:"peers_token,omitempty"`   // Token to ask for only the peers changed since this status.
+	PeersDelta           bool   `json:"peers_delta,omitempty"`   // Known peers only holds the peers changed since the token asked for.
+	RemovedPeers         []Peer `json:"removed_peers,omitempty"` // Peers removed since the token asked for.
 }
 
 // =============================================================================
 
-// PeerSet represents the data representation to maintain a set of known peers.
+// maxRemoved is the number of removed peers remembered to report them in
+// the changes since a token.
+const maxRemoved = 1000
+
+// CORE NOTE: A node polls the status of every peer it knows and each status
+// carries the peer list of that node. On a network with large peer tables
+// most of the bytes exchanged are the same lists over and over. Every change
+// to the set is numbered, and the status hands out a token with the latest
+// number so the next poll only gets the peers changed since then. The token
+// also carries when the set was created, so a token from before a restart
+// gets the full list back.
+
+// PeerDelta represents the peers changed in the set since a token.
+type PeerDelta struct {
+	Peers   []Peer // Peers added or changed, or all of them when full.
+	Removed []Peer // Peers removed since the token.
+	Token   string // Token to ask for the changes after these.
+	Full    bool   // The token wasn't usable so peers holds all of them.
+}
+
+// PeerSet represents the data representation to maintain a set of known
+// peers. Peers are identified by their primary address.
 type PeerSet struct {
-	mu  sync.RWMutex
-	set map[Peer]struct{}
+	mu       sync.RWMutex
+	set      map[string]Peer
+	epoch    string
+	version  uint64
+	versions map[string]uint64
+	removed  map[string]uint64
+	floor    uint64
 }
 
 // NewPeerSet constructs a new info set to manage node peer information.
 func NewPeerSet() *PeerSet {
 	return &PeerSet{
-		set: make(map[Peer]struct{}),
+		set:      make(map[string]Peer),
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		versions: make(map[string]uint64),
+		removed:  make(map[string]uint64),
 	}
 }
 
-// Add adds a new node to the set.
+// Add adds a new node to the set. The other addresses of a node already in
+// the set are added to the ones known for it. A node with a known id showing
+// up at a new host is moved to the new host, keeping its old addresses to
+// fall back on.
 func (ps *PeerSet) Add(peer Peer) bool {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	_, exists := ps.set[peer]
+	if peer.ID != "" {
+		for host, known := range ps.set {
+			if known.ID == peer.ID && host != peer.Host {
+				delete(ps.set, host)
+
+				addrs := append(append([]string(nil), peer.Addrs...), known.Addresses()...)
+				if current, exists := ps.set[peer.Host]; exists {
+					addrs = append(addrs, current.Addrs...)
+				}
+
+				moved := New(peer.Host, addrs...)
+				moved.ID = peer.ID
+				ps.set[peer.Host] = moved
+
+				ps.changed(peer.Host)
+				ps.forget(host)
+
+				return false
+			}
+		}
+	}
+
+	known, exists := ps.set[peer.Host]
 	if !exists {
-		ps.set[peer] = struct{}{}
+		pr := New(peer.Host, peer.Addrs...)
+		pr.ID = peer.ID
+		ps.set[peer.Host] = pr
+		ps.changed(peer.Host)
 		return true
 	}
 
+	// Copy the addresses so a peer handed out by Copy isn't changed.
+	var updated bool
+	known.Addrs = append([]string(nil), known.Addrs...)
+	for _, addr := range peer.Addrs {
+		if known.addAddr(addr) {
+			updated = true
+		}
+	}
+	if peer.ID != "" && peer.ID != known.ID {
+		known.ID = peer.ID
+		updated = true
+	}
+	ps.set[peer.Host] = known
+
+	if updated {
+		ps.changed(peer.Host)
+	}
+
 	return false
 }
 
@@ -67,20 +231,136 @@ func (ps *PeerSet) Remove(peer Peer) {
 	ps.mu.Lock()
 	defer ps.mu.Unlock()
 
-	delete(ps.set, peer)
+	if _, exists := ps.set[peer.Host]; !exists {
+		return
+	}
+
+	delete(ps.set, peer.Host)
+	ps.forget(peer.Host)
 }
 
-// Copy returns a list of the known peers.
+// Lookup returns the peer reached at the address.
+func (ps *PeerSet) Lookup(addr string) (Peer, bool) {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	if peer, exists := ps.set[addr]; exists {
+		return peer, true
+	}
+
+	for _, peer := range ps.set {
+		if peer.Match(addr) {
+			return peer, true
+		}
+	}
+
+	return Peer{}, false
+}
+
+// Copy returns a list of the known peers sorted by host so peers are always
+// contacted in the same order.
 func (ps *PeerSet) Copy(host string) []Peer {
 	ps.mu.RLock()
 	defer ps.mu.RUnlock()
 
 	var peers []Peer
-	for peer := range ps.set {
+	for _, peer := range ps.set {
 		if !peer.Match(host) {
 			peers = append(peers, peer)
 		}
 	}
 
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].Host < peers[j].Host
+	})
+
 	return peers
 }
+
+// Since returns the peers changed since the token was handed out, leaving
+// out the peer at the host. When the token is empty or can't be used, such
+// as a token from before this node restarted or older than the removals
+// remembered, all the peers are returned.
+func (ps *PeerSet) Since(host string, token string) PeerDelta {
+	ps.mu.RLock()
+	defer ps.mu.RUnlock()
+
+	delta := PeerDelta{
+		Token: ps.epoch + "." + strconv.FormatUint(ps.version, 10),
+	}
+
+	since, ok := ps.parseToken(token)
+	if !ok {
+		delta.Full = true
+		since = 0
+	}
+
+	for h, peer := range ps.set {
+		if ps.versions[h] > since && !peer.Match(host) {
+			delta.Peers = append(delta.Peers, peer)
+		}
+	}
+
+	if !delta.Full {
+		for h, version := range ps.removed {
+			if version > since && h != host {
+				delta.Removed = append(delta.Removed, Peer{Host: h})
+			}
+		}
+	}
+
+	sort.Slice(delta.Peers, func(i, j int) bool {
+		return delta.Peers[i].Host < delta.Peers[j].Host
+	})
+	sort.Slice(delta.Removed, func(i, j int) bool {
+		return delta.Removed[i].Host < delta.Removed[j].Host
+	})
+
+	return delta
+}
+
+// parseToken returns the change number in the token if the changes since it
+// are still known.
+func (ps *PeerSet) parseToken(token string) (uint64, bool) {
+	epoch, number, found := strings.Cut(token, ".")
+	if !found || epoch != ps.epoch {
+		return 0, false
+	}
+
+	version, err := strconv.ParseUint(number, 10, 64)
+	if err != nil || version < ps.floor || version > ps.version {
+		return 0, false
+	}
+
+	return version, true
+}
+
+// changed numbers the change to the peer at the host.
+func (ps *PeerSet) changed(host string) {
+	ps.version++
+	ps.versions[host] = ps.version
+	delete(ps.removed, host)
+}
+
+// forget numbers the removal of the peer at the host, dropping the oldest
+// removal remembered once there are too many. Tokens from before a dropped
+// removal can't be used anymore.
+func (ps *PeerSet) forget(host string) {
+	ps.version++
+	delete(ps.versions, host)
+	ps.removed[host] = ps.version
+
+	if len(ps.removed) <= maxRemoved {
+		return
+	}
+
+	var oldest string
+	for h, version := range ps.removed {
+		if oldest == "" || version < ps.removed[oldest] {
+			oldest = h
+		}
+	}
+
+	ps.floor = ps.removed[oldest]
+	delete(ps.removed, oldest)
+}
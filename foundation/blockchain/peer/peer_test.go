@@ -1,6 +1,8 @@
 package peer_test
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
@@ -45,3 +47,127 @@ func Test_CRUD(t *testing.T) {
 		t.Run(tst.name, f)
 	}
 }
+
+func Test_Addresses(t *testing.T) {
+	pr, err := peer.Parse("10.0.0.1:9080|[fd00::1]:9080|node1.example.com:9080")
+	if err != nil {
+		t.Fatalf("Should be able to parse the peer: %v", err)
+	}
+
+	exp := []string{"10.0.0.1:9080", "[fd00::1]:9080", "node1.example.com:9080"}
+	if got := pr.Addresses(); strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should keep the addresses in order of preference.")
+	}
+
+	for _, value := range []string{"", "10.0.0.1", "10.0.0.1:9080|fd00::1:9080", "10.0.0.1:9080|:9080"} {
+		if _, err := peer.Parse(value); err == nil {
+			t.Fatalf("Should reject the peer %q.", value)
+		}
+	}
+
+	ps := peer.NewPeerSet()
+	if !ps.Add(peer.New("10.0.0.1:9080")) {
+		t.Fatalf("Should add a new peer.")
+	}
+
+	if ps.Add(pr) {
+		t.Fatalf("Should not add a peer that is already known.")
+	}
+
+	known, exists := ps.Lookup("[fd00::1]:9080")
+	if !exists || known.Host != "10.0.0.1:9080" || len(known.Addrs) != 2 {
+		t.Logf("got: %v %v", exists, known)
+		t.Logf("exp: %v", pr)
+		t.Fatalf("Should find the peer at its other addresses once they are learned.")
+	}
+
+	if peers := ps.Copy("node1.example.com:9080"); len(peers) != 0 {
+		t.Logf("got: %d", len(peers))
+		t.Logf("exp: %d", 0)
+		t.Fatalf("Should match a peer at any of its addresses.")
+	}
+}
+
+func Test_Identity(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node", "miner1.node")
+
+	id1, err := peer.LoadIdentity(path)
+	if err != nil {
+		t.Fatalf("Should be able to generate the identity: %v", err)
+	}
+
+	id2, err := peer.LoadIdentity(path)
+	if err != nil {
+		t.Fatalf("Should be able to load the identity: %v", err)
+	}
+
+	if id1.ID == "" || id1.ID != id2.ID {
+		t.Logf("got: %s", id2.ID)
+		t.Logf("exp: %s", id1.ID)
+		t.Fatalf("Should keep the same id across restarts.")
+	}
+
+	if id1.ID != peer.Fingerprint(id1.PublicKey) {
+		t.Fatalf("Should use the fingerprint of the public key as the id.")
+	}
+
+	ps := peer.NewPeerSet()
+	ps.Add(peer.Peer{Host: "10.0.0.1:9080", ID: id1.ID})
+
+	if ps.Add(peer.Peer{Host: "10.0.0.2:9080", ID: id1.ID}) {
+		t.Fatalf("Should recognize the node at its new address.")
+	}
+
+	peers := ps.Copy("")
+	if len(peers) != 1 || peers[0].Host != "10.0.0.2:9080" || !peers[0].Match("10.0.0.1:9080") {
+		t.Logf("got: %v", peers)
+		t.Logf("exp: [{10.0.0.2:9080 [10.0.0.1:9080] %s}]", id1.ID)
+		t.Fatalf("Should move the node to its new address and keep the old one.")
+	}
+}
+
+func Test_Since(t *testing.T) {
+	ps := peer.NewPeerSet()
+	ps.Add(peer.New("host1"))
+	ps.Add(peer.New("host2"))
+	ps.Add(peer.New("self"))
+
+	full := ps.Since("self", "")
+	if !full.Full || len(full.Peers) != 2 || full.Token == "" {
+		t.Logf("got: %v %d %q", full.Full, len(full.Peers), full.Token)
+		t.Logf("exp: %v %d", true, 2)
+		t.Fatalf("Should return all the peers without a token.")
+	}
+
+	if delta := ps.Since("self", full.Token); delta.Full || len(delta.Peers) != 0 || len(delta.Removed) != 0 || delta.Token != full.Token {
+		t.Logf("got: %v %d %d %q", delta.Full, len(delta.Peers), len(delta.Removed), delta.Token)
+		t.Logf("exp: %v %d %d %q", false, 0, 0, full.Token)
+		t.Fatalf("Should return no changes when nothing changed.")
+	}
+
+	ps.Add(peer.New("host3"))
+	ps.Add(peer.New("host1", "10.0.0.1:9080"))
+	ps.Add(peer.New("host2"))
+	ps.Remove(peer.New("host2"))
+
+	delta := ps.Since("self", full.Token)
+	if delta.Full || len(delta.Peers) != 2 || delta.Peers[0].Host != "host1" || delta.Peers[1].Host != "host3" {
+		t.Logf("got: %v %v", delta.Full, delta.Peers)
+		t.Logf("exp: %v [host1 host3]", false)
+		t.Fatalf("Should return only the peers added or changed since the token.")
+	}
+
+	if len(delta.Removed) != 1 || delta.Removed[0].Host != "host2" {
+		t.Logf("got: %v", delta.Removed)
+		t.Logf("exp: [host2]")
+		t.Fatalf("Should return the peers removed since the token.")
+	}
+
+	for _, token := range []string{"other.1", full.Token + "0", "garbage"} {
+		if delta := ps.Since("self", token); !delta.Full {
+			t.Fatalf("Should return all the peers for the token %q.", token)
+		}
+	}
+}
@@ -0,0 +1,139 @@
+// Package policy decides which transactions a node accepts based on lists of
+// allowed and denied accounts, such as sanctioned accounts or accounts with
+// compromised keys. A policy only applies to the node it's set for, the other
+// nodes keep accepting the transactions under the consensus rules.
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+)
+
+// ErrDenied is returned for a transaction the policy doesn't accept.
+var ErrDenied = errcode.New(errcode.PolicyDenied, "transaction denied by policy")
+
+// Lists represents the accounts the policy allows and denies.
+type Lists struct {
+	Allow []database.AccountID `json:"allow,omitempty"` // Only transactions sent from these accounts are accepted, empty allows all.
+	Deny  []database.AccountID `json:"deny,omitempty"`  // Transactions sent from, sent to or paid by these accounts are rejected.
+}
+
+// AccountPolicy accepts or rejects transactions based on the accounts
+// involved. The lists can be updated while the node is running.
+type AccountPolicy struct {
+	mu    sync.RWMutex
+	lists Lists
+	allow map[string]struct{}
+	deny  map[string]struct{}
+}
+
+// New constructs a policy for the lists.
+func New(lists Lists) (*AccountPolicy, error) {
+	var p AccountPolicy
+	if err := p.Update(lists); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// Load constructs a policy from the lists in the JSON file.
+func Load(path string) (*AccountPolicy, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var lists Lists
+	if err := json.Unmarshal(content, &lists); err != nil {
+		return nil, fmt.Errorf("decoding policy %s: %w", path, err)
+	}
+
+	return New(lists)
+}
+
+// Update replaces the lists the policy checks transactions against.
+func (p *AccountPolicy) Update(lists Lists) error {
+	allow, err := accountSet(lists.Allow)
+	if err != nil {
+		return fmt.Errorf("allow list: %w", err)
+	}
+
+	deny, err := accountSet(lists.Deny)
+	if err != nil {
+		return fmt.Errorf("deny list: %w", err)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lists = lists
+	p.allow = allow
+	p.deny = deny
+
+	return nil
+}
+
+// Lists returns a copy of the lists the policy checks transactions against.
+func (p *AccountPolicy) Lists() Lists {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return Lists{
+		Allow: append([]database.AccountID(nil), p.lists.Allow...),
+		Deny:  append([]database.AccountID(nil), p.lists.Deny...),
+	}
+}
+
+// CheckTx returns ErrDenied if the transaction involves a denied account or
+// isn't sent from an allowed account.
+func (p *AccountPolicy) CheckTx(tx database.BlockTx) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	accounts := []database.AccountID{tx.FromID, tx.ToID}
+	if tx.IsSponsored() {
+		accounts = append(accounts, tx.FeePayerID)
+	}
+
+	for _, accountID := range accounts {
+		if _, denied := p.deny[key(accountID)]; denied {
+			return fmt.Errorf("%w: account %s is denied", ErrDenied, accountID)
+		}
+	}
+
+	if len(p.allow) > 0 {
+		if _, allowed := p.allow[key(tx.FromID)]; !allowed {
+			return fmt.Errorf("%w: account %s is not allowed", ErrDenied, tx.FromID)
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// accountSet validates the accounts and returns them as a set.
+func accountSet(accounts []database.AccountID) (map[string]struct{}, error) {
+	set := make(map[string]struct{}, len(accounts))
+	for _, accountID := range accounts {
+		if !accountID.IsAccountID() {
+			return nil, fmt.Errorf("invalid account %q", accountID)
+		}
+		set[key(accountID)] = struct{}{}
+	}
+
+	return set, nil
+}
+
+// key returns the account in the form used by the sets, so the same account
+// matches with or without the checksum casing.
+func key(accountID database.AccountID) string {
+	return strings.ToLower(string(accountID))
+}
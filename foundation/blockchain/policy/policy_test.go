@@ -0,0 +1,85 @@
+package policy_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/policy"
+)
+
+const (
+	kennedy = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	pavel   = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+	ed      = database.AccountID("0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0")
+)
+
+func Test_CheckTx(t *testing.T) {
+	p, err := policy.New(policy.Lists{Deny: []database.AccountID{database.AccountID(strings.ToLower(string(ed)))}})
+	if err != nil {
+		t.Fatalf("Should be able to construct the policy: %v", err)
+	}
+
+	tt := []struct {
+		name string
+		tx   database.Tx
+		exp  bool
+	}{
+		{name: "allowed", tx: database.Tx{FromID: kennedy, ToID: pavel}, exp: true},
+		{name: "from", tx: database.Tx{FromID: ed, ToID: pavel}, exp: false},
+		{name: "to", tx: database.Tx{FromID: kennedy, ToID: ed}, exp: false},
+		{name: "feepayer", tx: database.Tx{FromID: kennedy, ToID: pavel, FeePayerID: ed}, exp: false},
+	}
+
+	for _, tst := range tt {
+		tx := database.BlockTx{SignedTx: database.SignedTx{Tx: tst.tx}}
+
+		err := p.CheckTx(tx)
+		if got := err == nil; got != tst.exp {
+			t.Logf("got: %v", err)
+			t.Logf("exp: allowed %v", tst.exp)
+			t.Fatalf("Should check the %s account against the deny list.", tst.name)
+		}
+
+		if err != nil && !errors.Is(err, policy.ErrDenied) {
+			t.Fatalf("Should return ErrDenied, got %v.", err)
+		}
+	}
+
+	if err := p.Update(policy.Lists{Allow: []database.AccountID{kennedy}}); err != nil {
+		t.Fatalf("Should be able to update the policy: %v", err)
+	}
+
+	if err := p.CheckTx(database.BlockTx{SignedTx: database.SignedTx{Tx: database.Tx{FromID: pavel, ToID: ed}}}); err == nil {
+		t.Fatalf("Should only accept transactions from allowed accounts.")
+	}
+
+	if err := p.CheckTx(database.BlockTx{SignedTx: database.SignedTx{Tx: database.Tx{FromID: kennedy, ToID: ed}}}); err != nil {
+		t.Fatalf("Should accept transactions from allowed accounts: %v", err)
+	}
+
+	if err := p.Update(policy.Lists{Deny: []database.AccountID{"0x1234"}}); err == nil {
+		t.Fatalf("Should reject an invalid account.")
+	}
+}
+
+func Test_Load(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.json")
+	if err := os.WriteFile(path, []byte(`{"deny":["0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"]}`), 0600); err != nil {
+		t.Fatalf("Should be able to write the policy: %v", err)
+	}
+
+	p, err := policy.Load(path)
+	if err != nil {
+		t.Fatalf("Should be able to load the policy: %v", err)
+	}
+
+	if lists := p.Lists(); len(lists.Deny) != 1 || lists.Deny[0] != ed {
+		t.Logf("got: %v", lists)
+		t.Logf("exp: deny %s", ed)
+		t.Fatalf("Should load the lists from the file.")
+	}
+}
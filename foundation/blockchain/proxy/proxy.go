@@ -0,0 +1,155 @@
+// Package proxy routes the requests a node sends to its peers through an
+// outbound proxy, so a node in a restricted network or an operator running
+// over Tor can reach the network. Peers matching a bypass rule are reached
+// directly.
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Config represents the proxy peer traffic is sent through.
+type Config struct {
+	URL    string   // Proxy to use with a http, https or socks5 scheme, empty reaches peers directly.
+	Bypass []string // Peers reached directly as a host, host:port, .domain suffix, CIDR or * for all.
+}
+
+// Enabled reports if the configuration routes traffic through a proxy.
+func (cfg Config) Enabled() bool {
+	return cfg.URL != ""
+}
+
+// Proxy decides which proxy a request to a peer is sent through.
+type Proxy struct {
+	url    *url.URL
+	bypass []rule
+}
+
+// New constructs the proxy for the configuration.
+func New(cfg Config) (*Proxy, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, fmt.Errorf("parse proxy url: %w", err)
+	}
+
+	switch u.Scheme {
+	case "http", "https", "socks5":
+	default:
+		return nil, fmt.Errorf("proxy scheme %q is not supported, use http, https or socks5", u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("proxy url %q has no host", cfg.URL)
+	}
+
+	p := Proxy{
+		url: u,
+	}
+
+	for _, value := range cfg.Bypass {
+		r, err := parseRule(value)
+		if err != nil {
+			return nil, err
+		}
+		p.bypass = append(p.bypass, r)
+	}
+
+	return &p, nil
+}
+
+// Transport constructs a transport sending the requests through the proxy.
+func (p *Proxy) Transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = p.ProxyURL
+
+	return transport
+}
+
+// ProxyURL returns the proxy for the request, or nil when the peer is reached
+// directly. It matches the signature of http.Transport.Proxy.
+func (p *Proxy) ProxyURL(req *http.Request) (*url.URL, error) {
+	if p.Bypassed(req.URL.Host) {
+		return nil, nil
+	}
+
+	return p.url, nil
+}
+
+// Bypassed reports if the peer at the host is reached directly.
+func (p *Proxy) Bypassed(host string) bool {
+	hostname, port := host, ""
+	if h, pt, err := net.SplitHostPort(host); err == nil {
+		hostname, port = h, pt
+	}
+	hostname = strings.ToLower(hostname)
+
+	for _, r := range p.bypass {
+		if r.match(hostname, port) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// =============================================================================
+
+// rule represents a single bypass rule.
+type rule struct {
+	all     bool
+	host    string
+	port    string
+	suffix  string
+	network *net.IPNet
+}
+
+// parseRule converts the value of a bypass rule.
+func parseRule(value string) (rule, error) {
+	value = strings.ToLower(strings.TrimSpace(value))
+
+	switch {
+	case value == "":
+		return rule{}, errors.New("proxy bypass rule is empty")
+
+	case value == "*":
+		return rule{all: true}, nil
+
+	case strings.HasPrefix(value, "."):
+		return rule{suffix: value}, nil
+
+	case strings.Contains(value, "/"):
+		_, network, err := net.ParseCIDR(value)
+		if err != nil {
+			return rule{}, fmt.Errorf("proxy bypass rule %q: %w", value, err)
+		}
+		return rule{network: network}, nil
+	}
+
+	if host, port, err := net.SplitHostPort(value); err == nil {
+		return rule{host: host, port: port}, nil
+	}
+
+	return rule{host: strings.Trim(value, "[]")}, nil
+}
+
+// match reports if the rule covers the host and port.
+func (r rule) match(host string, port string) bool {
+	switch {
+	case r.all:
+		return true
+
+	case r.suffix != "":
+		return strings.HasSuffix(host, r.suffix) || host == r.suffix[1:]
+
+	case r.network != nil:
+		ip := net.ParseIP(host)
+		return ip != nil && r.network.Contains(ip)
+	}
+
+	return r.host == host && (r.port == "" || r.port == port)
+}
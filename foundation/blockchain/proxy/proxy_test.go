@@ -0,0 +1,84 @@
+package proxy_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/proxy"
+)
+
+func Test_Bypass(t *testing.T) {
+	p, err := proxy.New(proxy.Config{
+		URL:    "socks5://127.0.0.1:9050",
+		Bypass: []string{"localhost", "10.0.0.0/8", ".internal", "peer1:9080"},
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the proxy: %v", err)
+	}
+
+	tt := []struct {
+		host     string
+		bypassed bool
+	}{
+		{"localhost:9080", true},
+		{"10.1.2.3:9080", true},
+		{"node.internal:9080", true},
+		{"internal:9080", true},
+		{"peer1:9080", true},
+		{"peer1:9081", false},
+		{"11.1.2.3:9080", false},
+		{"example.com:9080", false},
+	}
+
+	for _, tst := range tt {
+		if got := p.Bypassed(tst.host); got != tst.bypassed {
+			t.Logf("got: %v", got)
+			t.Logf("exp: %v", tst.bypassed)
+			t.Fatalf("Should decide the bypass for %s correctly.", tst.host)
+		}
+	}
+}
+
+func Test_Config(t *testing.T) {
+	bad := []proxy.Config{
+		{URL: "ftp://127.0.0.1:21"},
+		{URL: "socks5://"},
+		{URL: "http://127.0.0.1:8118", Bypass: []string{"10.0.0.0/99"}},
+	}
+
+	for _, cfg := range bad {
+		if _, err := proxy.New(cfg); err == nil {
+			t.Fatalf("Should reject the configuration %+v.", cfg)
+		}
+	}
+}
+
+func Test_Transport(t *testing.T) {
+	var target string
+	h := func(w http.ResponseWriter, r *http.Request) {
+		target = r.URL.String()
+		io.WriteString(w, "proxied")
+	}
+	srv := httptest.NewServer(http.HandlerFunc(h))
+	defer srv.Close()
+
+	p, err := proxy.New(proxy.Config{URL: srv.URL})
+	if err != nil {
+		t.Fatalf("Should be able to construct the proxy: %v", err)
+	}
+
+	client := http.Client{Transport: p.Transport()}
+	resp, err := client.Get("http://peer.example:9080/v1/node/status")
+	if err != nil {
+		t.Fatalf("Should be able to send the request through the proxy: %v", err)
+	}
+	resp.Body.Close()
+
+	if exp := "http://peer.example:9080/v1/node/status"; target != exp {
+		t.Logf("got: %s", target)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should send the request for the peer to the proxy.")
+	}
+}
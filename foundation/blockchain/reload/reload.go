@@ -0,0 +1,338 @@
+// Package reload watches a configuration file and applies the settings that
+// are safe to change to a running node, so an operator can add peers, turn
+// mining on or off or change the log level without a restart. Settings that
+// can only take effect on a restart are rejected.
+package reload
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// Set of settings that can be changed while the node is running.
+const (
+	SettingPeers        = "peers"         // List of peers as host|addr|addr, the peers dropped from the list are removed.
+	SettingMining       = "mining"        // Turns mining on or off.
+	SettingMinTip       = "min_tip"       // Lowest tip accepted into the mempool.
+	SettingLogLevel     = "log_level"     // Level the node logs at, such as debug, info or warn.
+	SettingPeerInterval = "peer_interval" // How often peers are looked for and missing blocks are synced, such as 10s.
+)
+
+// restartSettings are the settings that are known but can't be changed
+// without restarting the node.
+var restartSettings = map[string]bool{
+	"beneficiary":     true,
+	"chains":          true,
+	"consensus":       true,
+	"db_path":         true,
+	"genesis":         true,
+	"identity":        true,
+	"private_host":    true,
+	"public_host":     true,
+	"select_strategy": true,
+	"storage":         true,
+}
+
+// Node represents the running node the settings are applied to.
+type Node interface {
+	AddPeer(pr peer.Peer) error
+	RemovePeer(pr peer.Peer) error
+	SetMining(on bool)
+	SetMinTip(tip uint64)
+	SetPeerInterval(d time.Duration)
+	SetLogLevel(level string) error
+	ConfigChanged(ev state.ConfigEvent)
+}
+
+// Config represents the file to watch and the node to apply it to.
+type Config struct {
+	Path     string        // JSON file with the settings.
+	Interval time.Duration // How often the file is checked for changes, 0 only reloads when asked.
+	Node     Node
+}
+
+// Watcher applies the settings in the file to the node each time the file
+// changes.
+type Watcher struct {
+	cfg  Config
+	shut chan struct{}
+	wg   sync.WaitGroup
+
+	mu      sync.Mutex
+	modTime time.Time
+	size    int64
+	applied map[string]string // Settings applied by the last reload.
+	peers   []peer.Peer       // Peers in the file at the last reload.
+}
+
+// New constructs a watcher for the file. Nothing is read until Reload is
+// called or the watcher is started.
+func New(cfg Config) (*Watcher, error) {
+	if cfg.Path == "" {
+		return nil, errors.New("reload file path is required")
+	}
+
+	if cfg.Node == nil {
+		return nil, errors.New("reload node is required")
+	}
+
+	w := Watcher{
+		cfg:     cfg,
+		shut:    make(chan struct{}),
+		applied: make(map[string]string),
+	}
+
+	return &w, nil
+}
+
+// Start checks the file on the configured interval and reloads it when its
+// modification time or size changes.
+func (w *Watcher) Start() {
+	if w.cfg.Interval <= 0 {
+		return
+	}
+
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.cfg.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				if w.changed() {
+					w.Reload()
+				}
+			case <-w.shut:
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops checking the file.
+func (w *Watcher) Shutdown() {
+	close(w.shut)
+	w.wg.Wait()
+}
+
+// Reload reads the file and applies the settings that changed since the last
+// reload. Every change applied or rejected is reported to the node as a
+// config event. An error is returned when the file can't be read.
+func (w *Watcher) Reload() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	info, err := os.Stat(w.cfg.Path)
+	if err != nil {
+		return w.fail(err)
+	}
+	w.modTime, w.size = info.ModTime(), info.Size()
+
+	content, err := os.ReadFile(w.cfg.Path)
+	if err != nil {
+		return w.fail(err)
+	}
+
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(content, &settings); err != nil {
+		return w.fail(fmt.Errorf("decoding %s: %w", w.cfg.Path, err))
+	}
+
+	// Apply the settings in a fixed order so the events are repeatable.
+	keys := make([]string, 0, len(settings))
+	for key := range settings {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	// A setting taken out of the file keeps its value on the node, but is
+	// applied again if it's put back.
+	for key := range w.applied {
+		if _, exists := settings[key]; !exists {
+			delete(w.applied, key)
+		}
+	}
+
+	for _, key := range keys {
+		value := compact(settings[key])
+		if w.applied[key] == value {
+			continue
+		}
+
+		if key == SettingPeers {
+			if err := w.applyPeers(settings[key]); err != nil {
+				w.reject(key, value, err.Error())
+				continue
+			}
+			w.applied[key] = value
+			continue
+		}
+
+		display, err := w.apply(key, settings[key])
+		if err != nil {
+			w.reject(key, value, err.Error())
+			continue
+		}
+		w.applied[key] = value
+		w.cfg.Node.ConfigChanged(state.ConfigEvent{Setting: key, Value: display, Applied: true})
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// changed reports if the file was modified since the last reload.
+func (w *Watcher) changed() bool {
+	info, err := os.Stat(w.cfg.Path)
+	if err != nil {
+		return false
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return !info.ModTime().Equal(w.modTime) || info.Size() != w.size
+}
+
+// apply changes a single setting on the node and returns the value to
+// report for it.
+func (w *Watcher) apply(key string, raw json.RawMessage) (string, error) {
+	switch key {
+	case SettingMining:
+		var on bool
+		if err := json.Unmarshal(raw, &on); err != nil {
+			return "", errors.New("mining must be true or false")
+		}
+		w.cfg.Node.SetMining(on)
+		return strconv.FormatBool(on), nil
+
+	case SettingMinTip:
+		var tip uint64
+		if err := json.Unmarshal(raw, &tip); err != nil {
+			return "", errors.New("min_tip must be a positive number")
+		}
+		w.cfg.Node.SetMinTip(tip)
+		return strconv.FormatUint(tip, 10), nil
+
+	case SettingLogLevel:
+		var level string
+		if err := json.Unmarshal(raw, &level); err != nil {
+			return "", errors.New("log_level must be a string")
+		}
+		if err := w.cfg.Node.SetLogLevel(level); err != nil {
+			return "", err
+		}
+		return level, nil
+
+	case SettingPeerInterval:
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return "", errors.New("peer_interval must be a duration such as 10s")
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", fmt.Errorf("peer_interval: %w", err)
+		}
+		if d <= 0 {
+			return "", errors.New("peer_interval must be greater than zero")
+		}
+		w.cfg.Node.SetPeerInterval(d)
+		return d.String(), nil
+	}
+
+	if restartSettings[key] {
+		return "", errors.New("setting can only be changed with a restart")
+	}
+
+	return "", errors.New("unknown setting")
+}
+
+// applyPeers adds the peers in the list that weren't in the previous list
+// and removes the ones that were dropped from it. Peers the node found on
+// its own are left alone.
+func (w *Watcher) applyPeers(raw json.RawMessage) error {
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return errors.New("peers must be a list of strings")
+	}
+
+	peers := make([]peer.Peer, 0, len(values))
+	for _, value := range values {
+		pr, err := peer.Parse(value)
+		if err != nil {
+			return fmt.Errorf("peer %q: %w", value, err)
+		}
+		peers = append(peers, pr)
+	}
+
+	listed := func(list []peer.Peer, host string) bool {
+		for _, pr := range list {
+			if pr.Host == host {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, pr := range w.peers {
+		if listed(peers, pr.Host) {
+			continue
+		}
+		if err := w.cfg.Node.RemovePeer(pr); err != nil {
+			w.reject(SettingPeers, "-"+pr.Host, err.Error())
+			continue
+		}
+		w.cfg.Node.ConfigChanged(state.ConfigEvent{Setting: SettingPeers, Value: "-" + pr.Host, Applied: true})
+	}
+
+	for _, pr := range peers {
+		if listed(w.peers, pr.Host) {
+			continue
+		}
+		if err := w.cfg.Node.AddPeer(pr); err != nil {
+			w.reject(SettingPeers, "+"+pr.Host, err.Error())
+			continue
+		}
+		w.cfg.Node.ConfigChanged(state.ConfigEvent{Setting: SettingPeers, Value: "+" + pr.Host, Applied: true})
+	}
+
+	w.peers = peers
+
+	return nil
+}
+
+// reject reports a setting that wasn't applied.
+func (w *Watcher) reject(key string, value string, reason string) {
+	w.cfg.Node.ConfigChanged(state.ConfigEvent{Setting: key, Value: value, Reason: reason})
+}
+
+// fail reports a file that couldn't be reloaded and returns the error.
+func (w *Watcher) fail(err error) error {
+	w.cfg.Node.ConfigChanged(state.ConfigEvent{Setting: "file", Value: w.cfg.Path, Reason: err.Error()})
+	return err
+}
+
+// compact returns the value with the insignificant space removed so an
+// unchanged setting compares equal however the file is formatted.
+func compact(raw json.RawMessage) string {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, raw); err != nil {
+		return string(raw)
+	}
+
+	return buf.String()
+}
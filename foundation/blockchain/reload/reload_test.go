@@ -0,0 +1,151 @@
+package reload_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/reload"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// node records the settings applied to it.
+type node struct {
+	peers    map[string]bool
+	mining   bool
+	minTip   uint64
+	interval time.Duration
+	level    string
+	events   []state.ConfigEvent
+}
+
+func (n *node) AddPeer(pr peer.Peer) error {
+	if n.peers[pr.Host] {
+		return fmt.Errorf("peer %s is already known", pr.Host)
+	}
+	n.peers[pr.Host] = true
+	return nil
+}
+
+func (n *node) RemovePeer(pr peer.Peer) error {
+	delete(n.peers, pr.Host)
+	return nil
+}
+
+func (n *node) SetMining(on bool)               { n.mining = on }
+func (n *node) SetMinTip(tip uint64)            { n.minTip = tip }
+func (n *node) SetPeerInterval(d time.Duration) { n.interval = d }
+
+func (n *node) SetLogLevel(level string) error {
+	if level != "debug" && level != "info" {
+		return errors.New("unrecognized level")
+	}
+	n.level = level
+	return nil
+}
+
+func (n *node) ConfigChanged(ev state.ConfigEvent) {
+	n.events = append(n.events, ev)
+}
+
+func Test_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node.json")
+	write := func(content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Should be able to write the file: %v", err)
+		}
+	}
+
+	n := node{peers: map[string]bool{"0.0.0.0:9080": true}, mining: true}
+	w, err := reload.New(reload.Config{Path: path, Node: &n})
+	if err != nil {
+		t.Fatalf("Should be able to construct the watcher: %v", err)
+	}
+
+	write(`{"peers": ["0.0.0.0:9180", "0.0.0.0:9280"], "mining": false, "min_tip": 5, "log_level": "debug", "peer_interval": "2s"}`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Should be able to reload the file: %v", err)
+	}
+
+	if !n.peers["0.0.0.0:9180"] || !n.peers["0.0.0.0:9280"] || n.mining || n.minTip != 5 || n.level != "debug" || n.interval != 2*time.Second {
+		t.Logf("got: %+v", n)
+		t.Fatalf("Should apply every setting in the file.")
+	}
+
+	if len(n.events) != 6 {
+		t.Logf("got: %+v", n.events)
+		t.Logf("exp: 6 events")
+		t.Fatalf("Should report an event for each applied change.")
+	}
+
+	// Only the settings that changed are applied again, and a peer taken out
+	// of the list is removed.
+	n.events = nil
+	write(`{"peers": ["0.0.0.0:9180"], "mining": false, "min_tip": 10, "log_level": "debug", "peer_interval": "2s"}`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Should be able to reload the file: %v", err)
+	}
+
+	if n.peers["0.0.0.0:9280"] || !n.peers["0.0.0.0:9180"] || !n.peers["0.0.0.0:9080"] {
+		t.Logf("got: %v", n.peers)
+		t.Fatalf("Should only remove the peer taken out of the list.")
+	}
+
+	exp := []state.ConfigEvent{
+		{Setting: "min_tip", Value: "10", Applied: true},
+		{Setting: "peers", Value: "-0.0.0.0:9280", Applied: true},
+	}
+	if fmt.Sprint(n.events) != fmt.Sprint(exp) {
+		t.Logf("got: %+v", n.events)
+		t.Logf("exp: %+v", exp)
+		t.Fatalf("Should only apply the settings that changed.")
+	}
+
+	// Unsafe, unknown and invalid settings are rejected and the rest of the
+	// file is still applied.
+	n.events = nil
+	write(`{"peers": ["0.0.0.0:9180"], "mining": true, "min_tip": 10, "log_level": "loud", "peer_interval": "0s", "consensus": "POA", "colour": "blue"}`)
+	if err := w.Reload(); err != nil {
+		t.Fatalf("Should be able to reload the file: %v", err)
+	}
+
+	if !n.mining || n.level != "debug" || n.interval != 2*time.Second {
+		t.Logf("got: %+v", n)
+		t.Fatalf("Should apply the valid settings and keep the rest.")
+	}
+
+	rejected := make(map[string]string)
+	for _, ev := range n.events {
+		if !ev.Applied {
+			rejected[ev.Setting] = ev.Reason
+		}
+	}
+
+	for _, setting := range []string{"log_level", "peer_interval", "consensus", "colour"} {
+		if rejected[setting] == "" {
+			t.Logf("got: %+v", n.events)
+			t.Fatalf("Should reject the %s setting with a reason.", setting)
+		}
+	}
+
+	if rejected["consensus"] != "setting can only be changed with a restart" {
+		t.Logf("got: %s", rejected["consensus"])
+		t.Fatalf("Should reject a setting that needs a restart.")
+	}
+
+	// A file that can't be decoded leaves the node as it is.
+	n.events = nil
+	write(`{"mining": false`)
+	if err := w.Reload(); err == nil {
+		t.Fatalf("Should fail to reload a file that isn't valid JSON.")
+	}
+
+	if !n.mining || len(n.events) != 1 || n.events[0].Applied {
+		t.Logf("got: %+v", n.events)
+		t.Fatalf("Should report the file was rejected and apply nothing.")
+	}
+}
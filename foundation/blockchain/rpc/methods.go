@@ -0,0 +1,242 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// CORE NOTE: The methods follow the Ethereum naming and encode numbers as hex
+// quantities, but they work with the Ardan data model. Nonces start at 1, so
+// eth_getTransactionCount returns the next nonce to use, which is what tooling
+// uses the count for. A raw transaction is the hex encoding of the JSON signed
+// transaction since there is no RLP transaction format. The node only keeps
+// the latest account state, so balances can't be requested for older blocks.
+
+// clientVersion returns the name of the node software.
+func clientVersion(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	return "ardan/v1", nil
+}
+
+// netVersion returns the chain id as a decimal string.
+func netVersion(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	return strconv.FormatUint(uint64(s.state.Genesis().ChainID), 10), nil
+}
+
+// chainID returns the chain id.
+func chainID(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	return hexutil.EncodeUint64(uint64(s.state.Genesis().ChainID)), nil
+}
+
+// blockNumber returns the number of the latest block.
+func blockNumber(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	return hexutil.EncodeUint64(s.state.LatestBlock().Header.Number), nil
+}
+
+// gasPrice returns the gas price for the next block.
+func gasPrice(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	nextBlock := s.state.LatestBlock().Header.Number + 1
+	return hexutil.EncodeUint64(s.state.QueryGenesisAt(nextBlock).GasPrice), nil
+}
+
+// getBalance returns the balance of the account.
+func getBalance(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	var address, tag string
+	if err := parseParams(params, 1, &address, &tag); err != nil {
+		return nil, err
+	}
+
+	account, err := s.latestAccount(address, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	return hexutil.EncodeUint64(account.Balance), nil
+}
+
+// getTransactionCount returns the next nonce for the account. The pending tag
+// includes the transactions waiting in the mempool.
+func getTransactionCount(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	var address, tag string
+	if err := parseParams(params, 1, &address, &tag); err != nil {
+		return nil, err
+	}
+
+	account, err := s.latestAccount(address, tag)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := account.Nonce
+	if tag == "pending" {
+		for _, tx := range s.state.Mempool() {
+			if tx.FromID == account.AccountID && tx.Nonce > nonce {
+				nonce = tx.Nonce
+			}
+		}
+	}
+
+	return hexutil.EncodeUint64(nonce + 1), nil
+}
+
+// getBlockByNumber returns the block for the specified number or tag. The
+// transactions are returned in full or as hashes.
+func getBlockByNumber(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	var tag string
+	var full bool
+	if err := parseParams(params, 1, &tag, &full); err != nil {
+		return nil, err
+	}
+
+	num, err := parseBlockTag(tag)
+	if err != nil {
+		return nil, err
+	}
+
+	blocks := s.state.QueryBlocksByNumber(ctx, num, num)
+	if len(blocks) == 0 {
+		return nil, nil
+	}
+
+	return toBlock(blocks[0], full), nil
+}
+
+// getTransactionByHash returns the transaction for the specified hash. A
+// transaction in the mempool has no block information.
+func getTransactionByHash(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	var hash string
+	if err := parseParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+
+	for _, tx := range s.state.Mempool() {
+		if tx.TxHash() == hash {
+			return toTx(tx, nil), nil
+		}
+	}
+
+	tx, block, err := s.state.QueryTransaction(ctx, hash)
+	if err != nil {
+		if errors.Is(err, state.ErrTxNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return toTx(tx, &block), nil
+}
+
+// getTransactionReceipt returns the receipt for a transaction that has been
+// mined into a block. A receipt for a transaction whose block was removed by
+// a reorganization is marked as not canonical.
+func getTransactionReceipt(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	var hash string
+	if err := parseParams(params, 1, &hash); err != nil {
+		return nil, err
+	}
+
+	tx, block, canonical, err := s.state.QueryReceipt(ctx, hash)
+	if err != nil {
+		if errors.Is(err, state.ErrTxNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	return toReceipt(tx, block, canonical), nil
+}
+
+// sendRawTransaction submits the hex encoded raw or JSON signed transaction
+// to the mempool and returns the transaction hash.
+func sendRawTransaction(ctx context.Context, s *Server, params json.RawMessage) (any, error) {
+	var raw string
+	if err := parseParams(params, 1, &raw); err != nil {
+		return nil, err
+	}
+
+	data, err := hexutil.Decode(raw)
+	if err != nil {
+		return nil, newError(CodeInvalidParams, "raw transaction: %s", err)
+	}
+
+	if _, err := database.DecodeRawTx(data); err != nil {
+		return nil, newError(CodeInvalidParams, "%s", err)
+	}
+
+	return s.state.SubmitRawTx(data)
+}
+
+// =============================================================================
+
+// latestAccount returns the account for the address as long as the tag asks
+// for the latest state. An account that doesn't exist has no balance.
+func (s *Server) latestAccount(address string, tag string) (database.Account, error) {
+	accountID, err := database.ToAccountID(address)
+	if err != nil {
+		return database.Account{}, newError(CodeInvalidParams, "address: %s", err)
+	}
+
+	num, err := parseBlockTag(tag)
+	if err != nil {
+		return database.Account{}, err
+	}
+
+	if num != state.QueryLastest && num != s.state.LatestBlock().Header.Number {
+		return database.Account{}, newError(CodeInvalidParams, "only the latest state is available")
+	}
+
+	account, err := s.state.QueryAccount(accountID)
+	if err != nil {
+		return database.Account{AccountID: accountID}, nil
+	}
+
+	return account, nil
+}
+
+// parseBlockTag converts the block tag into a block number. The state query
+// values are used for the latest and finalized blocks.
+func parseBlockTag(tag string) (uint64, error) {
+	switch tag {
+	case "", "latest", "pending":
+		return state.QueryLastest, nil
+	case "finalized", "safe":
+		return state.QueryFinalized, nil
+	case "earliest":
+		return 1, nil
+	}
+
+	num, err := hexutil.DecodeUint64(tag)
+	if err != nil {
+		return 0, newError(CodeInvalidParams, "block: %s", err)
+	}
+
+	return num, nil
+}
+
+// parseParams decodes the positional params into the values. Only the first
+// required params must be provided.
+func parseParams(params json.RawMessage, required int, values ...any) error {
+	var raw []json.RawMessage
+	if len(params) > 0 {
+		if err := json.Unmarshal(params, &raw); err != nil {
+			return newError(CodeInvalidParams, "params must be an array")
+		}
+	}
+
+	if len(raw) < required {
+		return newError(CodeInvalidParams, "expected at least %d params, got %d", required, len(raw))
+	}
+
+	for i := 0; i < len(values) && i < len(raw); i++ {
+		if err := json.Unmarshal(raw[i], values[i]); err != nil {
+			return newError(CodeInvalidParams, "param %d: %s", i, err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+)
+
+// Block represents a block in the Ethereum style.
+type Block struct {
+	Number           string `json:"number"`
+	Hash             string `json:"hash"`
+	ParentHash       string `json:"parentHash"`
+	Timestamp        string `json:"timestamp"`
+	Miner            string `json:"miner"`
+	Difficulty       string `json:"difficulty"`
+	Nonce            string `json:"nonce"`
+	BaseFeePerGas    string `json:"baseFeePerGas"`
+	GasUsed          string `json:"gasUsed"`
+	StateRoot        string `json:"stateRoot"`
+	TransactionsRoot string `json:"transactionsRoot"`
+	Transactions     []any  `json:"transactions"`
+}
+
+// Tx represents a transaction in the Ethereum style. The block fields are
+// nil for a transaction in the mempool.
+type Tx struct {
+	Hash        string  `json:"hash"`
+	ChainID     string  `json:"chainId"`
+	Nonce       string  `json:"nonce"`
+	From        string  `json:"from"`
+	To          string  `json:"to"`
+	Value       string  `json:"value"`
+	Tip         string  `json:"tip"`
+	Gas         string  `json:"gas"`
+	GasPrice    string  `json:"gasPrice"`
+	Input       string  `json:"input"`
+	BlockHash   *string `json:"blockHash"`
+	BlockNumber *string `json:"blockNumber"`
+	V           string  `json:"v"`
+	R           string  `json:"r"`
+	S           string  `json:"s"`
+}
+
+// Receipt represents the outcome of a mined transaction in the Ethereum style.
+type Receipt struct {
+	TransactionHash   string `json:"transactionHash"`
+	BlockHash         string `json:"blockHash"`
+	BlockNumber       string `json:"blockNumber"`
+	From              string `json:"from"`
+	To                string `json:"to"`
+	GasUsed           string `json:"gasUsed"`
+	EffectiveGasPrice string `json:"effectiveGasPrice"`
+	Status            string `json:"status"`
+	Canonical         bool   `json:"canonical"` // False once the block was removed by a reorganization.
+}
+
+// =============================================================================
+
+// toBlock converts a database block. The transactions are returned in full
+// or as hashes.
+func toBlock(block database.Block, full bool) Block {
+	values := block.MerkleTree.Values()
+
+	trans := make([]any, len(values))
+	for i, tx := range values {
+		if full {
+			trans[i] = toTx(tx, &block)
+			continue
+		}
+		trans[i] = tx.TxHash()
+	}
+
+	b := Block{
+		Number:           hexutil.EncodeUint64(block.Header.Number),
+		Hash:             block.Hash(),
+		ParentHash:       block.Header.PrevBlockHash,
+		Timestamp:        hexutil.EncodeUint64(block.Header.TimeStamp),
+		Miner:            string(block.Header.BeneficiaryID),
+		Difficulty:       hexutil.EncodeUint64(uint64(block.Header.Difficulty)),
+		Nonce:            hexutil.EncodeUint64(block.Header.Nonce),
+		BaseFeePerGas:    hexutil.EncodeUint64(block.Header.BaseFee),
+		GasUsed:          hexutil.EncodeUint64(block.Header.GasUsed),
+		StateRoot:        block.Header.StateRoot,
+		TransactionsRoot: block.Header.TransRoot,
+		Transactions:     trans,
+	}
+
+	return b
+}
+
+// toTx converts a database transaction and the block it was mined into.
+func toTx(tx database.BlockTx, block *database.Block) Tx {
+	t := Tx{
+		Hash:     tx.TxHash(),
+		ChainID:  hexutil.EncodeUint64(uint64(tx.ChainID)),
+		Nonce:    hexutil.EncodeUint64(tx.Nonce),
+		From:     string(tx.FromID),
+		To:       string(tx.ToID),
+		Value:    hexutil.EncodeUint64(tx.Value),
+		Tip:      hexutil.EncodeUint64(tx.Tip),
+		Gas:      hexutil.EncodeUint64(tx.GasUnits),
+		GasPrice: hexutil.EncodeUint64(tx.GasPrice),
+		Input:    hexutil.Encode(tx.Data),
+	}
+
+	// Transactions signed with Ed25519 don't have V, R and S.
+	if tx.V != nil && tx.R != nil && tx.S != nil {
+		t.V = hexutil.EncodeBig(tx.V)
+		t.R = hexutil.EncodeBig(tx.R)
+		t.S = hexutil.EncodeBig(tx.S)
+	}
+
+	if block != nil {
+		hash := block.Hash()
+		number := hexutil.EncodeUint64(block.Header.Number)
+		t.BlockHash = &hash
+		t.BlockNumber = &number
+	}
+
+	return t
+}
+
+// toReceipt converts a mined database transaction into a receipt. The chain
+// doesn't record if a transaction failed to apply, so the status always
+// reports success.
+func toReceipt(tx database.BlockTx, block database.Block, canonical bool) Receipt {
+	r := Receipt{
+		TransactionHash:   tx.TxHash(),
+		BlockHash:         block.Hash(),
+		BlockNumber:       hexutil.EncodeUint64(block.Header.Number),
+		From:              string(tx.FromID),
+		To:                string(tx.ToID),
+		GasUsed:           hexutil.EncodeUint64(tx.GasUnits),
+		EffectiveGasPrice: hexutil.EncodeUint64(tx.GasPrice),
+		Status:            "0x1",
+		Canonical:         canonical,
+	}
+
+	return r
+}
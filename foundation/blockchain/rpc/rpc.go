@@ -0,0 +1,223 @@
+// Package rpc provides a JSON-RPC 2.0 server with Ethereum style methods
+// mapped onto the blockchain state so existing tooling can talk to the chain
+// with minimal adaptation.
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// Version is the JSON-RPC version supported by the server.
+const Version = "2.0"
+
+// MaxBatch is the most requests a batch can hold, so a single body can't
+// hold the server for an unbounded amount of work.
+const MaxBatch = 100
+
+// Set of error codes defined by the JSON-RPC specification plus the code
+// used for errors returned by the blockchain.
+const (
+	CodeParseError     = -32700
+	CodeInvalidRequest = -32600
+	CodeMethodNotFound = -32601
+	CodeInvalidParams  = -32602
+	CodeServerError    = -32000
+)
+
+// =============================================================================
+
+// Request represents a JSON-RPC request.
+type Request struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id,omitempty"`
+	Method  string          `json:"method"`
+	Params  json.RawMessage `json:"params,omitempty"`
+}
+
+// Response represents a JSON-RPC response. Only one of result or error
+// is set.
+type Response struct {
+	Version string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  any             `json:"result,omitempty"`
+	Error   *Error          `json:"error,omitempty"`
+}
+
+// Error represents a JSON-RPC error. The data holds the code of an error
+// returned by the blockchain, such as insufficient_funds or bad_nonce.
+type Error struct {
+	Code    int          `json:"code"`
+	Message string       `json:"message"`
+	Data    errcode.Code `json:"data,omitempty"`
+}
+
+// Error implements the error interface.
+func (e *Error) Error() string {
+	return fmt.Sprintf("%d: %s", e.Code, e.Message)
+}
+
+// newError constructs an error for the specified code.
+func newError(code int, format string, args ...any) *Error {
+	return &Error{Code: code, Message: fmt.Sprintf(format, args...)}
+}
+
+// =============================================================================
+
+// method represents the function that executes an rpc method.
+type method func(ctx context.Context, s *Server, params json.RawMessage) (any, error)
+
+// methods is the set of methods supported by the server.
+var methods = map[string]method{
+	"web3_clientVersion":        clientVersion,
+	"net_version":               netVersion,
+	"eth_chainId":               chainID,
+	"eth_blockNumber":           blockNumber,
+	"eth_getBalance":            getBalance,
+	"eth_getTransactionCount":   getTransactionCount,
+	"eth_gasPrice":              gasPrice,
+	"eth_getBlockByNumber":      getBlockByNumber,
+	"eth_getTransactionByHash":  getTransactionByHash,
+	"eth_getTransactionReceipt": getTransactionReceipt,
+	"eth_sendRawTransaction":    sendRawTransaction,
+}
+
+// submitMethods is the set of methods that submit a transaction.
+var submitMethods = map[string]bool{
+	"eth_sendRawTransaction": true,
+}
+
+// Submits returns the number of requests in the encoded request or batch that
+// submit a transaction, so the caller can hold it to the node's antispam rules.
+func Submits(data []byte) int {
+	data = bytes.TrimSpace(data)
+
+	// Decode the batch the same way Process does, so a request that fails
+	// to decode here isn't executed there.
+	reqs := []json.RawMessage{data}
+	if len(data) > 0 && data[0] == '[' {
+		if err := json.Unmarshal(data, &reqs); err != nil || len(reqs) > MaxBatch {
+			return 0
+		}
+	}
+
+	var submits int
+	for _, data := range reqs {
+		var req Request
+		if err := json.Unmarshal(data, &req); err == nil && submitMethods[req.Method] {
+			submits++
+		}
+	}
+
+	return submits
+}
+
+// =============================================================================
+
+// Server executes JSON-RPC requests against the blockchain state.
+type Server struct {
+	state *state.State
+}
+
+// New constructs a server for the specified state.
+func New(st *state.State) *Server {
+	return &Server{
+		state: st,
+	}
+}
+
+// Process executes the encoded request or batch of requests and returns the
+// encoded response. A batch returns a batch of responses in the same order.
+func (s *Server) Process(ctx context.Context, data []byte) []byte {
+	data = bytes.TrimSpace(data)
+
+	if len(data) > 0 && data[0] == '[' {
+		var reqs []json.RawMessage
+		if err := json.Unmarshal(data, &reqs); err != nil {
+			return encode(Response{Version: Version, Error: newError(CodeParseError, "%s", err)})
+		}
+
+		if len(reqs) == 0 {
+			return encode(Response{Version: Version, Error: newError(CodeInvalidRequest, "empty batch")})
+		}
+
+		if len(reqs) > MaxBatch {
+			return encode(Response{Version: Version, Error: newError(CodeInvalidRequest, "batch of %d requests exceeds the limit of %d", len(reqs), MaxBatch)})
+		}
+
+		resps := make([]Response, len(reqs))
+		for i, req := range reqs {
+			resps[i] = s.process(ctx, req)
+		}
+
+		return encode(resps)
+	}
+
+	return encode(s.process(ctx, data))
+}
+
+// Execute executes a single request.
+func (s *Server) Execute(ctx context.Context, req Request) Response {
+	resp := Response{
+		Version: Version,
+		ID:      req.ID,
+	}
+
+	if req.Version != Version || req.Method == "" {
+		resp.Error = newError(CodeInvalidRequest, "invalid request")
+		return resp
+	}
+
+	fn, exists := methods[req.Method]
+	if !exists {
+		resp.Error = newError(CodeMethodNotFound, "method %q not found", req.Method)
+		return resp
+	}
+
+	result, err := fn(ctx, s, req.Params)
+	if err != nil {
+		rpcErr, ok := err.(*Error)
+		if !ok {
+			rpcErr = newError(CodeServerError, "%s", err)
+			if code := errcode.Of(err); code != errcode.Unknown {
+				rpcErr.Data = code
+			}
+		}
+		resp.Error = rpcErr
+		return resp
+	}
+
+	// A nil result is a valid response, like a receipt that doesn't exist.
+	if result == nil {
+		result = json.RawMessage("null")
+	}
+	resp.Result = result
+
+	return resp
+}
+
+// process decodes and executes a single request.
+func (s *Server) process(ctx context.Context, data []byte) Response {
+	var req Request
+	if err := json.Unmarshal(data, &req); err != nil {
+		return Response{Version: Version, Error: newError(CodeParseError, "%s", err)}
+	}
+
+	return s.Execute(ctx, req)
+}
+
+// encode marshals the response, which can't fail for the types the
+// methods return.
+func encode(v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data, _ = json.Marshal(Response{Version: Version, Error: newError(CodeServerError, "%s", err)})
+	}
+
+	return data
+}
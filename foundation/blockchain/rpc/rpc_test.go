@@ -0,0 +1,268 @@
+package rpc_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/rpc"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	kennedyPrivateKey = "9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93"
+	kennedyAccountID  = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+	edAccountID       = "0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCC0"
+	minerAccountID    = "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8"
+)
+
+func Test_RPC(t *testing.T) {
+	st := newState(t)
+	srv := rpc.New(st)
+
+	// call executes the method and decodes the result.
+	call := func(method string, result any, params ...any) *rpc.Error {
+		data, err := json.Marshal(params)
+		if err != nil {
+			t.Fatalf("Should be able to encode the params: %v", err)
+		}
+
+		resp := srv.Execute(context.Background(), rpc.Request{
+			Version: rpc.Version,
+			ID:      json.RawMessage("1"),
+			Method:  method,
+			Params:  data,
+		})
+		if resp.Error != nil {
+			return resp.Error
+		}
+
+		data, err = json.Marshal(resp.Result)
+		if err != nil {
+			t.Fatalf("Should be able to encode the result: %v", err)
+		}
+		if err := json.Unmarshal(data, result); err != nil {
+			t.Fatalf("Should be able to decode the result: %v", err)
+		}
+
+		return nil
+	}
+
+	var chainID string
+	if err := call("eth_chainId", &chainID); err != nil || chainID != "0x1" {
+		t.Fatalf("Should return the chain id, got %q: %v", chainID, err)
+	}
+
+	var nonce string
+	if err := call("eth_getTransactionCount", &nonce, kennedyAccountID, "latest"); err != nil || nonce != "0x1" {
+		t.Fatalf("Should return the next nonce, got %q: %v", nonce, err)
+	}
+
+	// Submit a transaction as a hex encoded JSON signed transaction.
+	pk, err := crypto.HexToECDSA(kennedyPrivateKey)
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	signedTx, err := database.Tx{ChainID: 1, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100}.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	raw, err := json.Marshal(signedTx)
+	if err != nil {
+		t.Fatalf("Should be able to encode the transaction: %v", err)
+	}
+
+	var txHash string
+	if err := call("eth_sendRawTransaction", &txHash, hexutil.Encode(raw)); err != nil {
+		t.Fatalf("Should be able to send the raw transaction: %v", err)
+	}
+
+	if txHash != signedTx.TxHash() {
+		t.Logf("got: %s", txHash)
+		t.Logf("exp: %s", signedTx.TxHash())
+		t.Fatalf("Should return the transaction hash.")
+	}
+
+	if err := call("eth_getTransactionCount", &nonce, kennedyAccountID, "pending"); err != nil || nonce != "0x2" {
+		t.Fatalf("Should include the mempool for pending, got %q: %v", nonce, err)
+	}
+
+	var receipt *rpc.Receipt
+	if err := call("eth_getTransactionReceipt", &receipt, txHash); err != nil || receipt != nil {
+		t.Fatalf("Should not have a receipt before the transaction is mined: %v", err)
+	}
+
+	if _, err := st.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	var number string
+	if err := call("eth_blockNumber", &number); err != nil || number != "0x1" {
+		t.Fatalf("Should return the latest block number, got %q: %v", number, err)
+	}
+
+	if err := call("eth_getTransactionReceipt", &receipt, txHash); err != nil || receipt == nil {
+		t.Fatalf("Should have a receipt once the transaction is mined: %v", err)
+	}
+	if receipt.BlockNumber != "0x1" || receipt.From != kennedyAccountID {
+		t.Fatalf("Should have the block information in the receipt: %+v", receipt)
+	}
+
+	var balance string
+	if err := call("eth_getBalance", &balance, edAccountID, "latest"); err != nil || balance != "0x64" {
+		t.Fatalf("Should return the balance, got %q: %v", balance, err)
+	}
+
+	// Sending the transaction again fails with the code of the error.
+	if err := call("eth_sendRawTransaction", &txHash, hexutil.Encode(raw)); err == nil || err.Code != rpc.CodeServerError || err.Data != errcode.BadNonce {
+		t.Fatalf("Should return the code of the blockchain error: %v", err)
+	}
+
+	var block rpc.Block
+	if err := call("eth_getBlockByNumber", &block, "0x1", false); err != nil {
+		t.Fatalf("Should be able to get the block: %v", err)
+	}
+	if len(block.Transactions) != 1 || block.Transactions[0] != txHash {
+		t.Fatalf("Should return the transaction hashes in the block: %v", block.Transactions)
+	}
+
+	if err := call("eth_unknown", &balance); err == nil || err.Code != rpc.CodeMethodNotFound {
+		t.Fatalf("Should not find an unknown method: %v", err)
+	}
+
+	if err := call("eth_getBalance", &balance); err == nil || err.Code != rpc.CodeInvalidParams {
+		t.Fatalf("Should require the params: %v", err)
+	}
+}
+
+func Test_RPCBatch(t *testing.T) {
+	srv := rpc.New(newState(t))
+
+	data := srv.Process(context.Background(), []byte(`[
+		{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"},
+		{"jsonrpc":"2.0","id":2,"method":"net_version"},
+		{"jsonrpc":"1.0","id":3,"method":"net_version"}
+	]`))
+
+	var resps []rpc.Response
+	if err := json.Unmarshal(data, &resps); err != nil {
+		t.Fatalf("Should be able to decode the batch response: %v", err)
+	}
+
+	if len(resps) != 3 {
+		t.Fatalf("Should return a response for each request, got %d", len(resps))
+	}
+
+	for i, resp := range resps {
+		if string(resp.ID) != fmt.Sprint(i+1) {
+			t.Fatalf("Should return the responses in order, got id %s", resp.ID)
+		}
+	}
+
+	if resps[1].Result != "1" {
+		t.Fatalf("Should return the network version, got %v", resps[1].Result)
+	}
+
+	if resps[2].Error == nil || resps[2].Error.Code != rpc.CodeInvalidRequest {
+		t.Fatalf("Should reject a request for another version: %v", resps[2].Error)
+	}
+
+	data = srv.Process(context.Background(), []byte(`{"jsonrpc":`))
+
+	var resp rpc.Response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Should be able to decode the response: %v", err)
+	}
+
+	if resp.Error == nil || resp.Error.Code != rpc.CodeParseError {
+		t.Fatalf("Should report a parse error: %v", resp.Error)
+	}
+
+	batch := "[" + strings.Repeat(`{"jsonrpc":"2.0","id":1,"method":"net_version"},`, rpc.MaxBatch) + `{"jsonrpc":"2.0","id":1,"method":"net_version"}]`
+	data = srv.Process(context.Background(), []byte(batch))
+
+	if err := json.Unmarshal(data, &resp); err != nil {
+		t.Fatalf("Should be able to decode the response: %v", err)
+	}
+
+	if resp.Error == nil || resp.Error.Code != rpc.CodeInvalidRequest {
+		t.Fatalf("Should reject a batch over the limit: %v", resp.Error)
+	}
+}
+
+func Test_Submits(t *testing.T) {
+	tt := []struct {
+		name string
+		data string
+		exp  int
+	}{
+		{"read", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber"}`, 0},
+		{"submit", `{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction","params":["0x01"]}`, 1},
+		{"batch with a submit", `[{"jsonrpc":"2.0","id":1,"method":"net_version"},{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction"}]`, 1},
+		{"batch with two submits", `[{"jsonrpc":"2.0","id":1,"method":"eth_sendRawTransaction"},{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction"}]`, 2},
+		{"batch with a bad request", `[5,{"jsonrpc":"2.0","id":2,"method":"eth_sendRawTransaction"}]`, 1},
+		{"parse error", `{"jsonrpc":`, 0},
+	}
+
+	for _, tst := range tt {
+		if got := rpc.Submits([]byte(tst.data)); got != tst.exp {
+			t.Logf("got: %v", got)
+			t.Logf("exp: %v", tst.exp)
+			t.Fatalf("Should report if the %s submits a transaction.", tst.name)
+		}
+	}
+}
+
+// =============================================================================
+
+// noopWorker implements the Worker interface which does nothing.
+type noopWorker struct{}
+
+func (n noopWorker) Shutdown()                              {}
+func (n noopWorker) Sync()                                  {}
+func (n noopWorker) SignalStartMining()                     {}
+func (n noopWorker) SignalCancelMining()                    {}
+func (n noopWorker) SignalShareTx(blockTx database.BlockTx) {}
+func (n noopWorker) SignalShareVote(vote database.Vote)     {}
+
+// newState constructs a node with in memory storage.
+func newState(t *testing.T) *state.State {
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	st, err := state.New(state.Config{
+		BeneficiaryID: minerAccountID,
+		Host:          "http://localhost:9080",
+		Storage:       storage,
+		Genesis: genesis.Genesis{
+			ChainID:       1,
+			TransPerBlock: 10,
+			Difficulty:    1,
+			MiningReward:  700,
+			GasPrice:      15,
+			Balances:      map[string]uint64{kennedyAccountID: 1000000},
+		},
+		SelectStrategy: "Tip",
+		KnownPeers:     peer.NewPeerSet(),
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct the state: %v", err)
+	}
+
+	st.Worker = noopWorker{}
+
+	return st
+}
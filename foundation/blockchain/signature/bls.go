@@ -0,0 +1,302 @@
+package signature
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/crypto/bls12381"
+)
+
+// Set of sizes for the BLS keys and signatures.
+const (
+	BLSPrivateKeySize = 32  // Big endian scalar.
+	BLSPublicKeySize  = 96  // Uncompressed G1 point.
+	BLSSignatureSize  = 192 // Uncompressed G2 point.
+)
+
+// Set of domain tags mixed into the hash of a message so a signature made
+// for one purpose can't be replayed as the other.
+const (
+	blsSignTag       = "ARDAN-BLS-SIG-BLS12381G2-SHA256-SSWU:"
+	blsPossessionTag = "ARDAN-BLS-POP-BLS12381G2-SHA256-SSWU:"
+)
+
+// blsFieldModulus is the modulus of the BLS12-381 base field. The hash of a
+// message is reduced by it to produce valid field elements.
+var blsFieldModulus, _ = new(big.Int).SetString("1a0111ea397fe69a4b1ba7b6434bacd764774b84f38512bf6730d2a0f6b0f6241eabfffeb153ffffb9feffffffffaaab", 16)
+
+// CORE NOTE: BLS signatures over the BLS12-381 curve can be added together.
+// When many validators sign the same message, their signatures add up to a
+// single 192 byte signature that verifies against the sum of their public
+// keys, so a block carries one signature no matter how many validators vote.
+// Adding public keys opens the door for a validator to pick a key that
+// cancels out the keys of others, so every key must come with a proof of
+// possession: a signature over the key itself that only its owner can make.
+//
+// Public keys live in G1 and signatures in G2 with points in the uncompressed
+// form. Messages are hashed to G2 by expanding them with SHA256 into two field
+// elements that are mapped to the curve with the simplified SWU map. This
+// follows the shape of the IETF hash to curve suite but isn't byte for byte
+// compatible with it, so the signatures only verify within this blockchain.
+
+// BLSPrivateKey represents a private key for BLS signatures.
+type BLSPrivateKey struct {
+	scalar *big.Int
+}
+
+// GenerateBLSKey generates a new random BLS private key.
+func GenerateBLSKey() (*BLSPrivateKey, error) {
+	order := new(big.Int).Sub(bls12381.NewG1().Q(), big.NewInt(1))
+
+	scalar, err := rand.Int(rand.Reader, order)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BLSPrivateKey{scalar: scalar.Add(scalar, big.NewInt(1))}, nil
+}
+
+// DeriveBLSKey derives a BLS private key from the seed, such as the bytes of
+// an account's private key, so the same seed always produces the same key.
+func DeriveBLSKey(seed []byte) (*BLSPrivateKey, error) {
+	if len(seed) < BLSPrivateKeySize {
+		return nil, errors.New("bls seed is too short")
+	}
+
+	// Expand the seed past the size of the group order so reducing it
+	// doesn't favor some keys over others.
+	first := sha256.Sum256(append([]byte("ARDAN-BLS-KEYGEN:\x00"), seed...))
+	second := sha256.Sum256(append([]byte("ARDAN-BLS-KEYGEN:\x01"), seed...))
+
+	order := new(big.Int).Sub(bls12381.NewG1().Q(), big.NewInt(1))
+	scalar := new(big.Int).SetBytes(append(first[:], second[:]...))
+	scalar.Mod(scalar, order)
+
+	return &BLSPrivateKey{scalar: scalar.Add(scalar, big.NewInt(1))}, nil
+}
+
+// BLSKeyFromBytes constructs a BLS private key from its bytes.
+func BLSKeyFromBytes(b []byte) (*BLSPrivateKey, error) {
+	if len(b) != BLSPrivateKeySize {
+		return nil, errors.New("invalid bls private key length")
+	}
+
+	scalar := new(big.Int).SetBytes(b)
+	if scalar.Sign() == 0 || scalar.Cmp(bls12381.NewG1().Q()) >= 0 {
+		return nil, errors.New("invalid bls private key")
+	}
+
+	return &BLSPrivateKey{scalar: scalar}, nil
+}
+
+// Bytes returns the private key as a big endian scalar.
+func (k *BLSPrivateKey) Bytes() []byte {
+	b := make([]byte, BLSPrivateKeySize)
+	return k.scalar.FillBytes(b)
+}
+
+// PublicKey returns the public key for the private key.
+func (k *BLSPrivateKey) PublicKey() []byte {
+	g1 := bls12381.NewG1()
+	pk := g1.MulScalar(g1.New(), g1.One(), k.scalar)
+
+	return g1.ToBytes(pk)
+}
+
+// Sign signs the message with the private key.
+func (k *BLSPrivateKey) Sign(msg []byte) []byte {
+	return k.sign(blsSignTag, msg)
+}
+
+// ProvePossession signs the public key to prove the private key is held by
+// whoever registers the public key.
+func (k *BLSPrivateKey) ProvePossession() []byte {
+	return k.sign(blsPossessionTag, k.PublicKey())
+}
+
+// sign signs the message hashed under the domain tag.
+func (k *BLSPrivateKey) sign(tag string, msg []byte) []byte {
+	g2 := bls12381.NewG2()
+
+	// The hash is always reduced to valid field elements so it can't fail
+	// to map to the curve.
+	h, err := hashToG2(g2, tag, msg)
+	if err != nil {
+		return nil
+	}
+
+	return g2.ToBytes(g2.MulScalar(g2.New(), h, k.scalar))
+}
+
+// =============================================================================
+
+// VerifyBLS checks the signature of the message was made by the private key
+// for the public key.
+func VerifyBLS(publicKey []byte, msg []byte, sig []byte) error {
+	return verifyBLS(blsSignTag, publicKey, msg, sig)
+}
+
+// VerifyBLSPossession checks the proof of possession for the public key.
+func VerifyBLSPossession(publicKey []byte, proof []byte) error {
+	if err := verifyBLS(blsPossessionTag, publicKey, publicKey, proof); err != nil {
+		return errors.New("invalid bls proof of possession")
+	}
+
+	return nil
+}
+
+// AggregateBLS adds the signatures together into a single signature.
+func AggregateBLS(sigs [][]byte) ([]byte, error) {
+	if len(sigs) == 0 {
+		return nil, errors.New("no bls signatures to aggregate")
+	}
+
+	g2 := bls12381.NewG2()
+	agg := g2.Zero()
+	for _, sig := range sigs {
+		p, err := blsSignature(g2, sig)
+		if err != nil {
+			return nil, err
+		}
+		g2.Add(agg, agg, p)
+	}
+
+	return g2.ToBytes(agg), nil
+}
+
+// VerifyBLSAggregate checks the aggregate signature is the sum of signatures
+// of the same message by the private keys for every public key. The public
+// keys must have had their proof of possession verified.
+func VerifyBLSAggregate(publicKeys [][]byte, msg []byte, sig []byte) error {
+	if len(publicKeys) == 0 {
+		return errors.New("no bls public keys to verify against")
+	}
+
+	g1 := bls12381.NewG1()
+	agg := g1.Zero()
+	for _, publicKey := range publicKeys {
+		p, err := blsPublicKey(g1, publicKey)
+		if err != nil {
+			return err
+		}
+		g1.Add(agg, agg, p)
+	}
+
+	return verifyBLS(blsSignTag, g1.ToBytes(agg), msg, sig)
+}
+
+// =============================================================================
+
+// verifyBLS checks the signature of the message hashed under the domain tag
+// by comparing the pairings e(pk, H(m)) and e(g1, sig).
+func verifyBLS(tag string, publicKey []byte, msg []byte, sig []byte) error {
+	g1 := bls12381.NewG1()
+	g2 := bls12381.NewG2()
+
+	pk, err := blsPublicKey(g1, publicKey)
+	if err != nil {
+		return err
+	}
+
+	s, err := blsSignature(g2, sig)
+	if err != nil {
+		return err
+	}
+
+	h, err := hashToG2(g2, tag, msg)
+	if err != nil {
+		return err
+	}
+
+	engine := bls12381.NewPairingEngine()
+	engine.AddPair(pk, h)
+	engine.AddPairInv(g1.One(), s)
+	if !engine.Check() {
+		return errors.New("invalid bls signature")
+	}
+
+	return nil
+}
+
+// blsPublicKey decodes the public key and checks it's a usable G1 point.
+func blsPublicKey(g1 *bls12381.G1, publicKey []byte) (*bls12381.PointG1, error) {
+	if len(publicKey) != BLSPublicKeySize {
+		return nil, errors.New("invalid bls public key length")
+	}
+
+	p, err := g1.FromBytes(publicKey)
+	if err != nil {
+		return nil, errors.New("invalid bls public key")
+	}
+
+	if g1.IsZero(p) || !g1.InCorrectSubgroup(p) {
+		return nil, errors.New("invalid bls public key")
+	}
+
+	return p, nil
+}
+
+// blsSignature decodes the signature and checks it's a usable G2 point.
+func blsSignature(g2 *bls12381.G2, sig []byte) (*bls12381.PointG2, error) {
+	if len(sig) != BLSSignatureSize {
+		return nil, errors.New("invalid bls signature length")
+	}
+
+	p, err := g2.FromBytes(sig)
+	if err != nil {
+		return nil, errors.New("invalid bls signature")
+	}
+
+	if !g2.InCorrectSubgroup(p) {
+		return nil, errors.New("invalid bls signature")
+	}
+
+	return p, nil
+}
+
+// hashToG2 hashes the message under the domain tag to a point in G2.
+func hashToG2(g2 *bls12381.G2, tag string, msg []byte) (*bls12381.PointG2, error) {
+	var u [2][]byte
+	for i := range u {
+		u[i] = append(hashToField(tag, msg, byte(2*i)), hashToField(tag, msg, byte(2*i+1))...)
+	}
+
+	p0, err := g2.MapToCurve(u[0])
+	if err != nil {
+		return nil, err
+	}
+
+	p1, err := g2.MapToCurve(u[1])
+	if err != nil {
+		return nil, err
+	}
+
+	return g2.Add(g2.New(), p0, p1), nil
+}
+
+// hashToField hashes the message under the domain tag and counter to a 48
+// byte element of the base field. 64 bytes are reduced by the modulus so the
+// element is close to uniform.
+func hashToField(tag string, msg []byte, counter byte) []byte {
+	var b [64]byte
+	for i := 0; i < 2; i++ {
+		h := sha256.New()
+		h.Write([]byte(tag))
+
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(msg)))
+		h.Write(n[:])
+		h.Write(msg)
+		h.Write([]byte{counter, byte(i)})
+
+		copy(b[i*32:], h.Sum(nil))
+	}
+
+	e := new(big.Int).SetBytes(b[:])
+	e.Mod(e, blsFieldModulus)
+
+	return e.FillBytes(make([]byte, 48))
+}
@@ -0,0 +1,209 @@
+package signature
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Set of encodings a value can be serialized with before it's hashed or
+// signed.
+const (
+	EncodingJSON      uint8 = 0 // Go's JSON marshaling, used by chains before the canonical encoding existed.
+	EncodingCanonical uint8 = 1 // Canonical JSON as produced by Canonical.
+)
+
+// Versioned is implemented by values that choose the encoding they are hashed
+// and signed with. Values that don't implement it use EncodingJSON.
+type Versioned interface {
+	EncodingVersion() uint8
+}
+
+// CORE NOTE: Hashes and signatures that depend on Go's JSON marshaling can
+// change with the Go version and are hard to reproduce in other languages,
+// since field order follows the struct declaration. The canonical encoding is
+// a subset of JSON (RFC 8785) with exactly one form for any value:
+//
+//   - The value is first marshaled to JSON so the field names and omitempty
+//     rules of its JSON tags apply.
+//   - Object keys are sorted by their UTF-8 bytes. All keys in use are ASCII
+//     so this is the same order RFC 8785 produces.
+//   - There is no whitespace between tokens.
+//   - Strings only escape the quote, the backslash and control characters.
+//     \b \t \n \f \r use the short form and other control characters use
+//     \u00xx in lowercase hex. Everything else is written as UTF-8.
+//   - Numbers must be integers written without a sign for zero, leading zeros,
+//     fractions or exponents. Floating point values aren't supported since
+//     nothing that is signed needs them.
+//
+// Chains switch to the canonical encoding at a block set in the genesis file
+// so blocks and transactions produced before the switch keep their hashes.
+
+// Canonical returns the canonical encoding of the value.
+func Canonical(value any) ([]byte, error) {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+
+	var v any
+	if err := d.Decode(&v); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	if err := writeCanonical(&b, v); err != nil {
+		return nil, err
+	}
+
+	return b.Bytes(), nil
+}
+
+// Marshal returns the value serialized with the encoding the value chooses.
+func Marshal(value any) ([]byte, error) {
+	encoding := EncodingJSON
+	if v, ok := value.(Versioned); ok {
+		encoding = v.EncodingVersion()
+	}
+
+	switch encoding {
+	case EncodingJSON:
+		return json.Marshal(value)
+	case EncodingCanonical:
+		return Canonical(value)
+	}
+
+	return nil, fmt.Errorf("encoding %d is not supported", encoding)
+}
+
+// =============================================================================
+
+// writeCanonical writes the canonical encoding of a value decoded from JSON.
+func writeCanonical(b *bytes.Buffer, v any) error {
+	switch v := v.(type) {
+	case nil:
+		b.WriteString("null")
+
+	case bool:
+		if v {
+			b.WriteString("true")
+			break
+		}
+		b.WriteString("false")
+
+	case json.Number:
+		if !isCanonicalInt(string(v)) {
+			return fmt.Errorf("number %s is not an integer in canonical form", v)
+		}
+		b.WriteString(string(v))
+
+	case string:
+		writeCanonicalString(b, v)
+
+	case []any:
+		b.WriteByte('[')
+		for i, elem := range v {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if err := writeCanonical(b, elem); err != nil {
+				return err
+			}
+		}
+		b.WriteByte(']')
+
+	case map[string]any:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b.WriteByte('{')
+		for i, key := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeCanonicalString(b, key)
+			b.WriteByte(':')
+			if err := writeCanonical(b, v[key]); err != nil {
+				return fmt.Errorf("%s: %w", key, err)
+			}
+		}
+		b.WriteByte('}')
+
+	default:
+		return fmt.Errorf("unsupported type %T", v)
+	}
+
+	return nil
+}
+
+// writeCanonicalString writes the string with the minimal escaping.
+func writeCanonicalString(b *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	b.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c >= utf8.RuneSelf {
+			r, size := utf8.DecodeRuneInString(s[i:])
+			b.WriteRune(r)
+			i += size
+			continue
+		}
+
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\b':
+			b.WriteString(`\b`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\f':
+			b.WriteString(`\f`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c < 0x20:
+			b.WriteString(`\u00`)
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		default:
+			b.WriteByte(c)
+		}
+		i++
+	}
+	b.WriteByte('"')
+}
+
+// isCanonicalInt checks the number is an integer without leading zeros,
+// fractions, exponents or a negative zero.
+func isCanonicalInt(n string) bool {
+	digits := n
+	if len(digits) > 0 && digits[0] == '-' {
+		digits = digits[1:]
+		if digits == "0" {
+			return false
+		}
+	}
+
+	if digits == "" || (len(digits) > 1 && digits[0] == '0') {
+		return false
+	}
+
+	for i := 0; i < len(digits); i++ {
+		if digits[i] < '0' || digits[i] > '9' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,152 @@
+package signature
+
+import (
+	"crypto/ed25519"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Set of signature schemes accounts can sign with.
+const (
+	SchemeECDSA   = "ecdsa"
+	SchemeEd25519 = "ed25519"
+)
+
+// ed25519AddressPrefix is hashed with an Ed25519 public key to derive the
+// address so it can never match the address of an ECDSA key.
+const ed25519AddressPrefix = "\x19Ardan Ed25519 Address:\n"
+
+// Scheme defines the behavior required to verify the signatures of a
+// signature scheme.
+type Scheme interface {
+
+	// Address returns the address of the account for the public key.
+	Address(publicKey []byte) (string, error)
+
+	// Verify checks the signature of the value is bound to the chain and
+	// returns the address of the account that signed it.
+	Verify(value any, chainID uint16, publicKey []byte, sig []byte) (string, error)
+}
+
+// schemes maps the names of the signature schemes to their implementation.
+var schemes = map[string]Scheme{
+	SchemeECDSA:   ecdsaScheme{},
+	SchemeEd25519: ed25519Scheme{},
+}
+
+// CORE NOTE: ECDSA signatures let the public key be recovered, so transactions
+// only carry the signature. An Ed25519 public key can't be recovered from its
+// signature, so transactions carry the public key next to the signature and
+// the address is derived from it. Ed25519 signatures are quicker to verify
+// and a byte smaller, but the public key adds 32 bytes to the transaction.
+
+// LookupScheme returns the signature scheme registered under the name.
+func LookupScheme(name string) (Scheme, error) {
+	scheme, exists := schemes[name]
+	if !exists {
+		return nil, fmt.Errorf("signature scheme %q is not supported", name)
+	}
+
+	return scheme, nil
+}
+
+// SignEd25519 uses the specified Ed25519 private key to sign the data
+// binding the signature to the specified chain.
+func SignEd25519(value any, chainID uint16, privateKey ed25519.PrivateKey) ([]byte, error) {
+	if len(privateKey) != ed25519.PrivateKeySize {
+		return nil, errors.New("invalid ed25519 private key")
+	}
+
+	data, err := stampForChain(value, chainID)
+	if err != nil {
+		return nil, err
+	}
+
+	return ed25519.Sign(privateKey, data), nil
+}
+
+// Ed25519Address returns the address of the account for the Ed25519 public
+// key.
+func Ed25519Address(publicKey ed25519.PublicKey) string {
+	hash := crypto.Keccak256([]byte(ed25519AddressPrefix), publicKey)
+	return common.BytesToAddress(hash[12:]).Hex()
+}
+
+// =============================================================================
+
+// ecdsaScheme verifies ECDSA signatures in the [R|S|V] format, where V is the
+// recovery id with the ardanID or chain id added.
+type ecdsaScheme struct{}
+
+// Address returns the address of the account for the uncompressed public key.
+func (ecdsaScheme) Address(publicKey []byte) (string, error) {
+	pk, err := crypto.UnmarshalPubkey(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	return crypto.PubkeyToAddress(*pk).String(), nil
+}
+
+// Verify recovers the address of the account that signed the value. The
+// chain the signature is bound to is taken from V.
+func (ecdsaScheme) Verify(value any, chainID uint16, _ []byte, sig []byte) (string, error) {
+	if len(sig) <= 64 {
+		return "", errors.New("invalid ecdsa signature length")
+	}
+
+	r := new(big.Int).SetBytes(sig[:32])
+	s := new(big.Int).SetBytes(sig[32:64])
+	v := new(big.Int).SetBytes(sig[64:])
+
+	if sigChainID, bound := ChainID(v); bound && sigChainID != chainID {
+		return "", fmt.Errorf("signature is bound to chain id %d, exp[%d]", sigChainID, chainID)
+	}
+
+	if err := VerifySignature(v, r, s); err != nil {
+		return "", err
+	}
+
+	return FromAddress(value, v, r, s)
+}
+
+// ed25519Scheme verifies Ed25519 signatures. Every signature is bound to a
+// chain since the scheme was added after chain binding.
+type ed25519Scheme struct{}
+
+// Address returns the address of the account for the public key.
+func (ed25519Scheme) Address(publicKey []byte) (string, error) {
+	if len(publicKey) != ed25519.PublicKeySize {
+		return "", errors.New("invalid ed25519 public key length")
+	}
+
+	return Ed25519Address(publicKey), nil
+}
+
+// Verify checks the signature of the value against the public key and
+// returns the address derived from the public key.
+func (e ed25519Scheme) Verify(value any, chainID uint16, publicKey []byte, sig []byte) (string, error) {
+	address, err := e.Address(publicKey)
+	if err != nil {
+		return "", err
+	}
+
+	if len(sig) != ed25519.SignatureSize {
+		return "", errors.New("invalid ed25519 signature length")
+	}
+
+	data, err := stampForChain(value, chainID)
+	if err != nil {
+		return "", err
+	}
+
+	if !ed25519.Verify(publicKey, data, sig) {
+		return "", errors.New("invalid ed25519 signature")
+	}
+
+	return address, nil
+}
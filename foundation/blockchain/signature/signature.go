@@ -6,13 +6,15 @@ import (
 	"crypto/ecdsa"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"hash"
+	"math"
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
+	"golang.org/x/crypto/sha3"
 )
 
 // ZeroHash represents a hash code of zeros.
@@ -23,60 +25,144 @@ const ZeroHash string = "0x00000000000000000000000000000000000000000000000000000
 // Ethereum and Bitcoin do this as well, but they use the value of 27.
 const ardanID = 29
 
+// chainIDOffset is added to the recovery id along with two times the chain id
+// for signatures that are bound to a chain. This is the same scheme Ethereum
+// uses with EIP-155 so the smallest value is larger than any ardanID value.
+const chainIDOffset = 35
+
+// Set of hash algorithms values can be hashed with.
+const (
+	SHA256 = "sha256"
+	SHA3   = "sha3-256"
+)
+
+// hashes maps the hash algorithms to the function constructing the hash.
+// Every algorithm must produce a 32 byte hash.
+var hashes = map[string]func() hash.Hash{
+	SHA256: sha256.New,
+	SHA3:   sha3.New256,
+}
+
 // =============================================================================
 
-// Hash returns a unique string for the value.
+// Hash returns a unique string for the value. The value is serialized with
+// the encoding it chooses, see Versioned.
 func Hash(value any) string {
-	data, err := json.Marshal(value)
+	return HashWith(value, SHA256)
+}
+
+// HashWith returns a unique string for the value using the hash algorithm.
+// The zero hash is returned if the algorithm isn't supported.
+func HashWith(value any, algorithm string) string {
+	newHash, exists := hashes[algorithm]
+	if !exists {
+		return ZeroHash
+	}
+
+	data, err := Marshal(value)
 	if err != nil {
 		return ZeroHash
 	}
 
-	hash := sha256.Sum256(data)
-	return hexutil.Encode(hash[:])
+	h := newHash()
+	h.Write(data)
+	return hexutil.Encode(h.Sum(nil))
+}
+
+// IsHashAlgorithm reports if the hash algorithm is supported.
+func IsHashAlgorithm(algorithm string) bool {
+	_, exists := hashes[algorithm]
+	return exists
 }
 
 // Sign uses the specified private key to sign the data.
 func Sign(value any, privateKey *ecdsa.PrivateKey) (v, r, s *big.Int, err error) {
-
-	// Prepare the data for signing.
 	data, err := stamp(value)
 	if err != nil {
 		return nil, nil, nil, err
 	}
 
+	sig, err := sign(data, privateKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Convert the 65 byte signature into the [R|S|V] format.
+	v, r, s = toSignatureValues(sig)
+
+	return v, r, s, nil
+}
+
+// SignForChain uses the specified private key to sign the data binding the
+// signature to the specified chain. The chain id is part of the signed
+// digest and is encoded into V so the signature can't be replayed on a
+// different chain.
+func SignForChain(value any, chainID uint16, privateKey *ecdsa.PrivateKey) (v, r, s *big.Int, err error) {
+	data, err := stampForChain(value, chainID)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	sig, err := sign(data, privateKey)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	// Convert the 65 byte signature into the [R|S|V] format.
+	r = big.NewInt(0).SetBytes(sig[:32])
+	s = big.NewInt(0).SetBytes(sig[32:64])
+	v = big.NewInt(int64(sig[64]) + chainIDOffset + 2*int64(chainID))
+
+	return v, r, s, nil
+}
+
+// ChainID returns the chain the signature is bound to. The second return
+// value is false for signatures that are not bound to a chain.
+func ChainID(v *big.Int) (uint16, bool) {
+	if !v.IsUint64() || v.Uint64() < chainIDOffset {
+		return 0, false
+	}
+
+	chainID := (v.Uint64() - chainIDOffset) / 2
+	if chainID > math.MaxUint16 {
+		return 0, false
+	}
+
+	return uint16(chainID), true
+}
+
+// sign produces the 65 byte signature for the hashed data.
+func sign(data []byte, privateKey *ecdsa.PrivateKey) ([]byte, error) {
+
 	// Sign the hash with the private key to produce a signature.
 	sig, err := crypto.Sign(data, privateKey)
 	if err != nil {
-		return nil, nil, nil, err
+		return nil, err
 	}
 
 	// Extract the bytes for the original public key.
 	publicKeyOrg := privateKey.Public()
 	publicKeyECDSA, ok := publicKeyOrg.(*ecdsa.PublicKey)
 	if !ok {
-		return nil, nil, nil, errors.New("error casting public key to ECDSA")
+		return nil, errors.New("error casting public key to ECDSA")
 	}
 	publicKeyBytes := crypto.FromECDSAPub(publicKeyECDSA)
 
 	// Check the public key validates the data and signature.
 	rs := sig[:crypto.RecoveryIDOffset]
 	if !crypto.VerifySignature(publicKeyBytes, data, rs) {
-		return nil, nil, nil, errors.New("invalid signature produced")
+		return nil, errors.New("invalid signature produced")
 	}
 
-	// Convert the 65 byte signature into the [R|S|V] format.
-	v, r, s = toSignatureValues(sig)
-
-	return v, r, s, nil
+	return sig, nil
 }
 
 // VerifySignature verifies the signature conforms to our standards.
 func VerifySignature(v, r, s *big.Int) error {
 
 	// Check the recovery id is either 0 or 1.
-	uintV := v.Uint64() - ardanID
-	if uintV != 0 && uintV != 1 {
+	uintV, ok := recoveryID(v)
+	if !ok {
 		return errors.New("invalid recovery id")
 	}
 
@@ -91,8 +177,12 @@ func VerifySignature(v, r, s *big.Int) error {
 // FromAddress extracts the address for the account that signed the data.
 func FromAddress(value any, v, r, s *big.Int) (string, error) {
 
-	// Prepare the data for public key extraction.
+	// Prepare the data for public key extraction. A signature bound to a
+	// chain has the chain id as part of the signed digest.
 	data, err := stamp(value)
+	if chainID, bound := ChainID(v); bound {
+		data, err = stampForChain(value, chainID)
+	}
 	if err != nil {
 		return "", err
 	}
@@ -125,13 +215,13 @@ func ToVRSFromHexSignature(sigStr string) (v, r, s *big.Int, err error) {
 
 	r = big.NewInt(0).SetBytes(sig[:32])
 	s = big.NewInt(0).SetBytes(sig[32:64])
-	v = big.NewInt(0).SetBytes([]byte{sig[64]})
+	v = big.NewInt(0).SetBytes(sig[64:])
 
 	return v, r, s, nil
 }
 
 // ToSignatureBytes converts the r, s, v values into a slice of bytes
-// with the removal of the ardanID.
+// with the removal of the ardanID or chain id.
 func ToSignatureBytes(v, r, s *big.Int) []byte {
 	sig := make([]byte, crypto.SignatureLength)
 
@@ -143,18 +233,19 @@ func ToSignatureBytes(v, r, s *big.Int) []byte {
 	s.FillBytes(sBytes)
 	copy(sig[32:], sBytes)
 
-	sig[64] = byte(v.Uint64() - ardanID)
+	recID, _ := recoveryID(v)
+	sig[64] = recID
 
 	return sig
 }
 
 // ToSignatureBytesWithArdanID converts the r, s, v values into a slice of bytes
-// keeping the Ardan id.
+// keeping the Ardan id. A signature bound to a chain with a large chain id
+// can have a V value that is more than one byte.
 func ToSignatureBytesWithArdanID(v, r, s *big.Int) []byte {
 	sig := ToSignatureBytes(v, r, s)
-	sig[64] = byte(v.Uint64())
 
-	return sig
+	return append(sig[:64], v.Bytes()...)
 }
 
 // =============================================================================
@@ -163,8 +254,8 @@ func ToSignatureBytesWithArdanID(v, r, s *big.Int) []byte {
 // the Ardan stamp embedded into the final hash.
 func stamp(value any) ([]byte, error) {
 
-	// Marshal the data.
-	v, err := json.Marshal(value)
+	// Marshal the data with the encoding the value chooses.
+	v, err := Marshal(value)
 	if err != nil {
 		return nil, err
 	}
@@ -180,6 +271,46 @@ func stamp(value any) ([]byte, error) {
 	return data, nil
 }
 
+// stampForChain returns a hash of 32 bytes that represents this data with
+// the Ardan stamp and the chain id embedded into the final hash.
+func stampForChain(value any, chainID uint16) ([]byte, error) {
+
+	// Marshal the data with the encoding the value chooses.
+	v, err := Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// The chain id is added to the stamp so the signature is only valid for
+	// the one chain.
+	stamp := []byte(fmt.Sprintf("\x19Ardan Signed Message:\nChain %d:\n%d", chainID, len(v)))
+
+	// Hash the stamp and txHash together in a final 32 byte array
+	// that represents the data.
+	data := crypto.Keccak256(stamp, v)
+
+	return data, nil
+}
+
+// recoveryID returns the recovery id from the V value for a signature that
+// uses the ardanID or is bound to a chain.
+func recoveryID(v *big.Int) (byte, bool) {
+	if !v.IsUint64() {
+		return 0, false
+	}
+
+	recID := v.Uint64() - ardanID
+	if _, bound := ChainID(v); bound {
+		recID = (v.Uint64() - chainIDOffset) % 2
+	}
+
+	if recID != 0 && recID != 1 {
+		return 0, false
+	}
+
+	return byte(recID), true
+}
+
 // toSignatureValues converts the signature into the r, s, v values.
 func toSignatureValues(sig []byte) (v, r, s *big.Int) {
 	r = big.NewInt(0).SetBytes(sig[:32])
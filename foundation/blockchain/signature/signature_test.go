@@ -1,6 +1,8 @@
 package signature_test
 
 import (
+	"crypto/ed25519"
+	"math/big"
 	"testing"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
@@ -78,6 +80,151 @@ func Test_Hash(t *testing.T) {
 	}
 }
 
+func Test_HashWith(t *testing.T) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	if h := signature.HashWith(value, signature.SHA256); h != signature.Hash(value) {
+		t.Logf("got: %s", h)
+		t.Logf("exp: %s", signature.Hash(value))
+		t.Fatalf("Should hash with SHA-256 by default.")
+	}
+
+	h := signature.HashWith(value, signature.SHA3)
+	if h == signature.Hash(value) || len(h) != len(signature.ZeroHash) || h == signature.ZeroHash {
+		t.Logf("got: %s", h)
+		t.Fatalf("Should hash with SHA3-256 to a 32 byte hash.")
+	}
+
+	if h := signature.HashWith(value, "md5"); h != signature.ZeroHash || signature.IsHashAlgorithm("md5") {
+		t.Fatalf("Should not hash with an unknown algorithm.")
+	}
+}
+
+func Test_Ed25519(t *testing.T) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	pk := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	publicKey := pk.Public().(ed25519.PublicKey)
+
+	sig, err := signature.SignEd25519(value, 1, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign data: %s", err)
+	}
+
+	scheme, err := signature.LookupScheme(signature.SchemeEd25519)
+	if err != nil {
+		t.Fatalf("Should be able to find the scheme: %s", err)
+	}
+
+	addr, err := scheme.Verify(value, 1, publicKey, sig)
+	if err != nil {
+		t.Fatalf("Should be able to verify the signature: %s", err)
+	}
+
+	if addr != signature.Ed25519Address(publicKey) || len(addr) != len(from) {
+		t.Logf("got: %s", addr)
+		t.Logf("exp: %s", signature.Ed25519Address(publicKey))
+		t.Fatalf("Should get back the address of the public key.")
+	}
+
+	if _, err := scheme.Verify(value, 2, publicKey, sig); err == nil {
+		t.Fatalf("Should not verify a signature for a different chain.")
+	}
+
+	other := struct {
+		Name string
+	}{
+		Name: "Jill",
+	}
+	if _, err := scheme.Verify(other, 1, publicKey, sig); err == nil {
+		t.Fatalf("Should not verify a signature for different data.")
+	}
+
+	if _, err := signature.LookupScheme("rsa"); err == nil {
+		t.Fatalf("Should not find an unknown scheme.")
+	}
+}
+
+func Test_BLS(t *testing.T) {
+	keys := make([]*signature.BLSPrivateKey, 3)
+	for i := range keys {
+		seed := make([]byte, 32)
+		seed[0] = byte(i + 1)
+
+		key, err := signature.DeriveBLSKey(seed)
+		if err != nil {
+			t.Fatalf("Should be able to derive a key: %s", err)
+		}
+		keys[i] = key
+	}
+
+	msg := []byte("block 0x01")
+
+	sig := keys[0].Sign(msg)
+	if err := signature.VerifyBLS(keys[0].PublicKey(), msg, sig); err != nil {
+		t.Fatalf("Should be able to verify the signature: %s", err)
+	}
+
+	if err := signature.VerifyBLS(keys[1].PublicKey(), msg, sig); err == nil {
+		t.Fatalf("Should not verify a signature against a different key.")
+	}
+
+	if err := signature.VerifyBLS(keys[0].PublicKey(), []byte("block 0x02"), sig); err == nil {
+		t.Fatalf("Should not verify a signature for a different message.")
+	}
+
+	if err := signature.VerifyBLSPossession(keys[0].PublicKey(), keys[0].ProvePossession()); err != nil {
+		t.Fatalf("Should be able to verify the proof of possession: %s", err)
+	}
+
+	if err := signature.VerifyBLSPossession(keys[0].PublicKey(), sig); err == nil {
+		t.Fatalf("Should not accept a message signature as a proof of possession.")
+	}
+
+	sigs := make([][]byte, len(keys))
+	publicKeys := make([][]byte, len(keys))
+	for i, key := range keys {
+		sigs[i] = key.Sign(msg)
+		publicKeys[i] = key.PublicKey()
+	}
+
+	agg, err := signature.AggregateBLS(sigs)
+	if err != nil {
+		t.Fatalf("Should be able to aggregate the signatures: %s", err)
+	}
+
+	if len(agg) != signature.BLSSignatureSize {
+		t.Logf("got: %d", len(agg))
+		t.Logf("exp: %d", signature.BLSSignatureSize)
+		t.Fatalf("Should get back a signature the size of one signature.")
+	}
+
+	if err := signature.VerifyBLSAggregate(publicKeys, msg, agg); err != nil {
+		t.Fatalf("Should be able to verify the aggregate signature: %s", err)
+	}
+
+	if err := signature.VerifyBLSAggregate(publicKeys[:2], msg, agg); err == nil {
+		t.Fatalf("Should not verify the aggregate signature missing a key.")
+	}
+
+	key, err := signature.BLSKeyFromBytes(keys[2].Bytes())
+	if err != nil {
+		t.Fatalf("Should be able to load the key from its bytes: %s", err)
+	}
+
+	if string(key.PublicKey()) != string(publicKeys[2]) {
+		t.Fatalf("Should get back the same public key from the loaded key.")
+	}
+}
+
 func Test_SignConsistency(t *testing.T) {
 	value1 := struct {
 		Name string
@@ -121,3 +268,215 @@ func Test_SignConsistency(t *testing.T) {
 		t.Fatalf("Should have the same address.")
 	}
 }
+
+func Test_SignForChain(t *testing.T) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	for _, chainID := range []uint16{1, 200, 65535} {
+		v, r, s, err := signature.SignForChain(value, chainID, pk)
+		if err != nil {
+			t.Fatalf("Should be able to sign data: %s", err)
+		}
+
+		if err := signature.VerifySignature(v, r, s); err != nil {
+			t.Fatalf("Should be able to verify the signature: %s", err)
+		}
+
+		got, bound := signature.ChainID(v)
+		if !bound || got != chainID {
+			t.Logf("got: %d", got)
+			t.Logf("exp: %d", chainID)
+			t.Fatalf("Should get back the chain id from the signature.")
+		}
+
+		addr, err := signature.FromAddress(value, v, r, s)
+		if err != nil {
+			t.Fatalf("Should be able to generate from address: %s", err)
+		}
+
+		if from != addr {
+			t.Logf("got: %s", addr)
+			t.Logf("exp: %s", from)
+			t.Fatalf("Should get back the right address.")
+		}
+
+		sv, sr, ss, err := signature.ToVRSFromHexSignature(signature.SignatureString(v, r, s))
+		if err != nil {
+			t.Fatalf("Should be able to parse the signature string: %s", err)
+		}
+		if sv.Cmp(v) != 0 || sr.Cmp(r) != 0 || ss.Cmp(s) != 0 {
+			t.Fatalf("Should get back the same signature values.")
+		}
+	}
+
+	// The chain id is part of the digest so the signature can't be moved to
+	// a different chain by changing V.
+	v, r, s, err := signature.SignForChain(value, 1, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign data: %s", err)
+	}
+	v.Add(v, big.NewInt(2))
+
+	addr, err := signature.FromAddress(value, v, r, s)
+	if err == nil && addr == from {
+		t.Fatalf("Should not be able to replay the signature on another chain.")
+	}
+}
+
+// =============================================================================
+
+// versioned is a value that chooses the encoding it's hashed and signed with.
+type versioned struct {
+	Name     string `json:"name"`
+	Value    uint64 `json:"value"`
+	Encoding uint8  `json:"encoding,omitempty"`
+}
+
+func (v versioned) EncodingVersion() uint8 {
+	return v.Encoding
+}
+
+func Test_Canonical(t *testing.T) {
+	value := struct {
+		Zeta  string            `json:"zeta"`
+		Alpha []int             `json:"alpha"`
+		Big   *big.Int          `json:"big"`
+		Map   map[string]string `json:"map"`
+		Empty string            `json:"empty,omitempty"`
+	}{
+		Zeta:  "<a&b> \u2028 \"q\"\n\x01 é",
+		Alpha: []int{3, -1, 0},
+		Big:   new(big.Int).Lsh(big.NewInt(1), 70),
+		Map:   map[string]string{"b": "2", "a": "1"},
+	}
+
+	exp := `{"alpha":[3,-1,0],"big":1180591620717411303424,"map":{"a":"1","b":"2"},"zeta":"<a&b> ` + "\u2028" + ` \"q\"\n\u0001 é"}`
+
+	data, err := signature.Canonical(value)
+	if err != nil {
+		t.Fatalf("Should be able to encode the value: %s", err)
+	}
+
+	if string(data) != exp {
+		t.Logf("got: %s", data)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should sort the keys, keep integers exact and only escape what's required.")
+	}
+
+	if _, err := signature.Canonical(struct{ F float64 }{F: 1.5}); err == nil {
+		t.Fatalf("Should not encode a number that isn't an integer.")
+	}
+
+	v := versioned{Name: "Bill", Value: 10}
+	legacy := signature.Hash(v)
+
+	v.Encoding = signature.EncodingCanonical
+	canonical := signature.Hash(v)
+
+	data, err = signature.Marshal(v)
+	if err != nil {
+		t.Fatalf("Should be able to marshal the value: %s", err)
+	}
+
+	if exp := `{"encoding":1,"name":"Bill","value":10}`; string(data) != exp {
+		t.Logf("got: %s", data)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should marshal with the encoding the value chooses.")
+	}
+
+	if legacy == canonical || canonical == signature.ZeroHash {
+		t.Fatalf("Should hash the value with the encoding it chooses.")
+	}
+
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		t.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	sv, r, s, err := signature.SignForChain(v, 1, pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign data: %s", err)
+	}
+
+	addr, err := signature.FromAddress(v, sv, r, s)
+	if err != nil || addr != from {
+		t.Logf("got: %s", addr)
+		t.Logf("exp: %s", from)
+		t.Fatalf("Should recover the signer of the canonical encoding.")
+	}
+
+	v.Encoding = 2
+	if _, _, _, err := signature.SignForChain(v, 1, pk); err == nil {
+		t.Fatalf("Should not sign with an unknown encoding.")
+	}
+}
+
+func Benchmark_Hash(b *testing.B) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	for i := 0; i < b.N; i++ {
+		signature.Hash(value)
+	}
+}
+
+func Benchmark_Sign(b *testing.B) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		b.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, _, _, err := signature.SignForChain(value, 1, pk); err != nil {
+			b.Fatalf("Should be able to sign data: %s", err)
+		}
+	}
+}
+
+func Benchmark_Verify(b *testing.B) {
+	value := struct {
+		Name string
+	}{
+		Name: "Bill",
+	}
+
+	pk, err := crypto.HexToECDSA(pkHexKey)
+	if err != nil {
+		b.Fatalf("Should be able to generate a private key: %s", err)
+	}
+
+	v, r, s, err := signature.SignForChain(value, 1, pk)
+	if err != nil {
+		b.Fatalf("Should be able to sign data: %s", err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := signature.VerifySignature(v, r, s); err != nil {
+			b.Fatalf("Should be able to verify the signature: %s", err)
+		}
+
+		if _, err := signature.FromAddress(value, v, r, s); err != nil {
+			b.Fatalf("Should be able to generate from address: %s", err)
+		}
+	}
+}
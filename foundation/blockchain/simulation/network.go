@@ -0,0 +1,150 @@
+package simulation
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"time"
+)
+
+// Network is a virtual network that routes the requests between the nodes
+// in the simulation without opening any sockets. The latency of each request
+// can be configured and nodes can be partitioned from each other or taken
+// down completely.
+type Network struct {
+	mu       sync.RWMutex
+	latency  time.Duration
+	handlers map[string]http.Handler
+	groups   map[string]int
+	down     map[string]bool
+}
+
+// NewNetwork constructs an empty virtual network.
+func NewNetwork() *Network {
+	return &Network{
+		handlers: make(map[string]http.Handler),
+		groups:   make(map[string]int),
+		down:     make(map[string]bool),
+	}
+}
+
+// Attach routes the requests for the host to the handler.
+func (n *Network) Attach(host string, handler http.Handler) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.handlers[host] = handler
+}
+
+// SetLatency sets the time each request takes to reach its destination.
+func (n *Network) SetLatency(latency time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.latency = latency
+}
+
+// Partition splits the network into the specified groups of hosts. Hosts can
+// only reach the hosts in the same group. Hosts that aren't listed can only
+// reach other hosts that aren't listed.
+func (n *Network) Partition(groups ...[]string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.groups = make(map[string]int)
+	for i, hosts := range groups {
+		for _, host := range hosts {
+			n.groups[host] = i + 1
+		}
+	}
+}
+
+// Heal removes all the partitions from the network.
+func (n *Network) Heal() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.groups = make(map[string]int)
+}
+
+// SetDown marks the host as down so it can't send or receive requests.
+func (n *Network) SetDown(host string, down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.down[host] = down
+}
+
+// Reachable reports if a request from one host can reach the other host.
+func (n *Network) Reachable(from string, to string) bool {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+
+	return n.reachable(from, to)
+}
+
+// Transport returns the transport the host uses to send requests over the
+// virtual network.
+func (n *Network) Transport(from string) http.RoundTripper {
+	return transport{network: n, from: from}
+}
+
+// reachable is the lock free version of Reachable.
+func (n *Network) reachable(from string, to string) bool {
+	if _, exists := n.handlers[to]; !exists {
+		return false
+	}
+
+	if n.down[from] || n.down[to] {
+		return false
+	}
+
+	return n.groups[from] == n.groups[to]
+}
+
+// =============================================================================
+
+// transport implements the http.RoundTripper interface for requests sent by
+// a host over the virtual network.
+type transport struct {
+	network *Network
+	from    string
+}
+
+// RoundTrip delivers the request to the handler of the destination host and
+// returns the response it recorded.
+func (t transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		defer req.Body.Close()
+	}
+
+	t.network.mu.RLock()
+	latency := t.network.latency
+	handler := t.network.handlers[req.URL.Host]
+	reachable := t.network.reachable(t.from, req.URL.Host)
+	t.network.mu.RUnlock()
+
+	if !reachable {
+		return nil, fmt.Errorf("simulation: %s: host unreachable from %s", req.URL.Host, t.from)
+	}
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		defer timer.Stop()
+
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	resp := rec.Result()
+	resp.Request = req
+
+	return resp, nil
+}
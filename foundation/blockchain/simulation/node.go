@@ -0,0 +1,372 @@
+package simulation
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// Node represents a single node running in the simulation. The node serves
+// the private node API over the virtual network and only performs work when
+// the simulation asks it to, so every run is repeatable.
+type Node struct {
+	Host  string
+	State *state.State
+
+	evHandler state.EventHandler
+
+	mu       sync.Mutex
+	shareTxs []database.BlockTx
+
+	resync    sync.WaitGroup
+	resyncing int32
+}
+
+// Sync asks the known peers for their status, mempool and any blocks this
+// node doesn't have, the same as the worker does for a running node.
+func (n *Node) Sync() {
+	n.evHandler("simulation: sync: started")
+	defer n.evHandler("simulation: sync: completed")
+
+	for _, pr := range n.State.KnownExternalPeers() {
+		peerStatus, err := n.State.NetRequestPeerStatus(context.Background(), pr)
+		if err != nil {
+			n.evHandler("simulation: sync: queryPeerStatus: %s: ERROR: %s", pr.Host, err)
+			continue
+		}
+
+		for _, known := range peerStatus.KnownPeers {
+			if !known.Match(n.Host) {
+				n.State.AddKnownPeer(known)
+			}
+		}
+
+		pool, err := n.State.NetRequestPeerMempool(context.Background(), pr)
+		if err != nil {
+			n.evHandler("simulation: sync: retrievePeerMempool: %s: ERROR: %s", pr.Host, err)
+		}
+		for _, tx := range pool {
+			if err := n.State.UpsertMempool(tx); err != nil {
+				n.evHandler("simulation: sync: retrievePeerMempool: %s: WARNING: %s", pr.Host, err)
+			}
+		}
+
+		if peerStatus.LatestBlockNumber > n.State.LatestBlock().Header.Number {
+			if err := n.State.NetRequestPeerBlocks(context.Background(), pr); err != nil {
+				n.evHandler("simulation: sync: retrievePeerBlocks: %s: ERROR %s", pr.Host, err)
+			}
+		}
+	}
+
+	n.State.NetSendNodeAvailableToPeers(context.Background())
+}
+
+// Gossip shares the transactions this node received from wallets since the
+// last call with the known peers.
+func (n *Node) Gossip() {
+	n.mu.Lock()
+	txs := n.shareTxs
+	n.shareTxs = nil
+	n.mu.Unlock()
+
+	for _, tx := range txs {
+		n.State.NetSendTxToPeers(context.Background(), tx)
+	}
+}
+
+// WaitResync blocks until any resync started by a chain reorganization
+// is complete.
+func (n *Node) WaitResync() {
+	n.resync.Wait()
+}
+
+// reorganize rolls back the chain after a fork is detected and tracks the
+// resync the state runs in the background.
+func (n *Node) reorganize() {
+	n.resync.Add(1)
+	atomic.StoreInt32(&n.resyncing, 1)
+
+	if err := n.State.Reorganize(); err != nil {
+		n.evHandler("simulation: reorganize: ERROR: %s", err)
+		atomic.StoreInt32(&n.resyncing, 0)
+		n.resync.Done()
+	}
+}
+
+// =============================================================================
+
+// worker implements the state.Worker interface. Mining and sharing
+// transactions are driven by the simulation instead of running in the
+// background.
+type worker struct {
+	node *Node
+}
+
+// Shutdown has nothing to stop since no goroutines are running.
+func (w worker) Shutdown() {}
+
+// Sync runs the sync for the node. This is called by the state when the
+// chain is reorganized.
+func (w worker) Sync() {
+	if atomic.CompareAndSwapInt32(&w.node.resyncing, 1, 0) {
+		defer w.node.resync.Done()
+	}
+
+	w.node.Sync()
+}
+
+// SignalStartMining does nothing since blocks are mined by the simulation.
+func (w worker) SignalStartMining() {}
+
+// SignalCancelMining does nothing since blocks are mined by the simulation.
+func (w worker) SignalCancelMining() {}
+
+// SignalShareTx queues the transaction to be shared on the next gossip.
+func (w worker) SignalShareTx(blockTx database.BlockTx) {
+	w.node.mu.Lock()
+	defer w.node.mu.Unlock()
+
+	w.node.shareTxs = append(w.node.shareTxs, blockTx)
+}
+
+// SignalShareVote does nothing since votes aren't part of the simulated gossip.
+func (w worker) SignalShareVote(vote database.Vote) {}
+
+// =============================================================================
+
+// handler constructs the handler for the private node API used between
+// peers.
+func (n *Node) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/node/status", n.status)
+	mux.HandleFunc("/v1/node/block/list/", n.blocksByNumber)
+	mux.HandleFunc("/v1/node/block/announce", n.announceBlock)
+	mux.HandleFunc("/v1/node/block/propose", n.proposeBlock)
+	mux.HandleFunc("/v1/node/block/compact", n.compactBlock)
+	mux.HandleFunc("/v1/node/tx/submit", n.submitTransaction)
+	mux.HandleFunc("/v1/node/tx/list", n.mempool)
+	mux.HandleFunc("/v1/node/peers", n.submitPeer)
+
+	return peer.EnvelopeHandler(mux)
+}
+
+// status returns the current status of the node.
+func (n *Node) status(w http.ResponseWriter, r *http.Request) {
+	latestBlock := n.State.LatestBlock()
+
+	status := peer.PeerStatus{
+		ChainID:              n.State.Genesis().ChainID,
+		LatestBlockHash:      latestBlock.Hash(),
+		LatestBlockNumber:    latestBlock.Header.Number,
+		FinalizedBlockNumber: n.State.LatestFinalizedBlock().Header.Number,
+		KnownPeers:           n.State.KnownExternalPeers(),
+	}
+
+	respond(w, status, http.StatusOK)
+}
+
+// blocksByNumber returns the blocks in the from/to range of the path.
+func (n *Node) blocksByNumber(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/v1/node/block/list/"), "/")
+	if len(parts) != 2 {
+		respondError(w, errors.New("invalid block range"), http.StatusBadRequest)
+		return
+	}
+
+	var numbers [2]uint64
+	for i, part := range parts {
+		switch part {
+		case "latest", "":
+			numbers[i] = state.QueryLastest
+		case "finalized":
+			numbers[i] = state.QueryFinalized
+		default:
+			num, err := strconv.ParseUint(part, 10, 64)
+			if err != nil {
+				respondError(w, err, http.StatusBadRequest)
+				return
+			}
+			numbers[i] = num
+		}
+	}
+
+	blocks := n.State.QueryBlocksByNumber(r.Context(), numbers[0], numbers[1])
+	if len(blocks) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	blockData := make([]database.BlockData, len(blocks))
+	for i, block := range blocks {
+		blockData[i] = database.NewBlockData(block)
+	}
+
+	if r.Header.Get("Accept") == database.BinaryContentType {
+		data, err := database.EncodeBlocksData(blockData)
+		if err != nil {
+			respondError(w, err, http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", database.BinaryContentType)
+		w.WriteHeader(http.StatusOK)
+		w.Write(data)
+		return
+	}
+
+	respond(w, blockData, http.StatusOK)
+}
+
+// announceBlock tells a peer announcing a new block if the node wants the
+// block to be sent.
+func (n *Node) announceBlock(w http.ResponseWriter, r *http.Request) {
+	var ba state.BlockAnnouncement
+	if err := json.NewDecoder(r.Body).Decode(&ba); err != nil {
+		respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	respond(w, n.State.ProcessBlockAnnouncement(ba), http.StatusOK)
+}
+
+// proposeBlock validates a block received from a peer and adds it to the
+// chain. A fork starts a reorganization of the chain.
+func (n *Node) proposeBlock(w http.ResponseWriter, r *http.Request) {
+	var blockData database.BlockData
+	switch r.Header.Get("Content-Type") {
+	case database.BinaryContentType:
+		data, err := io.ReadAll(r.Body)
+		if err != nil {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+
+		if blockData, err = database.DecodeBlockData(data); err != nil {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+
+	default:
+		if err := json.NewDecoder(r.Body).Decode(&blockData); err != nil {
+			respondError(w, err, http.StatusBadRequest)
+			return
+		}
+	}
+
+	block, err := database.ToBlock(blockData)
+	if err != nil {
+		respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	status, err := n.State.ProcessProposedBlock(block)
+	if err != nil {
+		if errors.Is(err, database.ErrChainForked) {
+			n.reorganize()
+		}
+
+		respondError(w, errors.New("block not accepted"), http.StatusNotAcceptable)
+		return
+	}
+
+	respond(w, struct {
+		Status string `json:"status"`
+	}{
+		Status: status,
+	}, http.StatusOK)
+}
+
+// compactBlock rebuilds a block received from a peer as a compact block and
+// adds it to the chain. The peer is told which transactions are missing if
+// the block can't be rebuilt.
+func (n *Node) compactBlock(w http.ResponseWriter, r *http.Request) {
+	var cb database.CompactBlock
+	if err := json.NewDecoder(r.Body).Decode(&cb); err != nil {
+		respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	status, err := n.State.ProcessCompactBlock(cb)
+	if err != nil {
+		if errors.Is(err, database.ErrChainForked) {
+			n.reorganize()
+		}
+
+		respondError(w, errors.New("block not accepted"), http.StatusNotAcceptable)
+		return
+	}
+
+	respond(w, status, http.StatusOK)
+}
+
+// submitTransaction adds a transaction received from a peer to the mempool.
+func (n *Node) submitTransaction(w http.ResponseWriter, r *http.Request) {
+	var tx database.BlockTx
+	if err := json.NewDecoder(r.Body).Decode(&tx); err != nil {
+		respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if err := n.State.UpsertNodeTransaction(tx); err != nil {
+		respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	respond(w, struct {
+		Status string `json:"status"`
+	}{
+		Status: "transactions added to mempool",
+	}, http.StatusOK)
+}
+
+// mempool returns the set of uncommitted transactions.
+func (n *Node) mempool(w http.ResponseWriter, r *http.Request) {
+	respond(w, n.State.Mempool(), http.StatusOK)
+}
+
+// submitPeer adds a peer announcing itself to the known peers.
+func (n *Node) submitPeer(w http.ResponseWriter, r *http.Request) {
+	var pr peer.Peer
+	if err := json.NewDecoder(r.Body).Decode(&pr); err != nil {
+		respondError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if !pr.Match(n.Host) {
+		n.State.AddInboundPeer(pr)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// =============================================================================
+
+// respond converts the value to JSON and writes it to the response.
+func respond(w http.ResponseWriter, data any, statusCode int) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		respondError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+	w.Write(jsonData)
+}
+
+// respondError writes the error to the response.
+func respondError(w http.ResponseWriter, err error, statusCode int) {
+	w.WriteHeader(statusCode)
+	fmt.Fprintf(w, `{"error":%q}`, err.Error())
+}
@@ -0,0 +1,327 @@
+// Package simulation runs a set of in-process nodes with in-memory storage
+// connected by a virtual network. Nodes only mine, gossip and sync when the
+// simulation asks them to, which makes it possible to write deterministic
+// integration tests of sync, gossip and fork resolution.
+package simulation
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/chaos"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// Set of default values used when the config doesn't provide them.
+const (
+	defaultNodes    = 3
+	defaultAccounts = 4
+	defaultBalance  = 1_000_000
+)
+
+// Config represents the configuration for a simulation.
+type Config struct {
+	Nodes         int                // Number of nodes to run, defaults to 3.
+	Accounts      int                // Number of funded accounts, defaults to 4.
+	Consensus     string             // Consensus protocol, defaults to POW.
+	FinalityDepth uint64             // Number of blocks before a block is final, 0 turns finality off.
+	Latency       time.Duration      // Time each request takes on the network.
+	Faults        *chaos.Faults      // Optional faults injected into the requests of every node.
+	EvHandler     state.EventHandler // Optional handler for the events of every node.
+	CompactRelay  bool               // Nodes send new blocks as the header and transaction hashes.
+}
+
+// Account represents a funded account that can submit transactions.
+type Account struct {
+	ID         database.AccountID
+	PrivateKey *ecdsa.PrivateKey
+}
+
+// Simulation manages the nodes and the network connecting them.
+type Simulation struct {
+	Network  *Network
+	Nodes    []*Node
+	Accounts []Account
+	Genesis  genesis.Genesis
+}
+
+// New constructs a simulation with every node knowing every other node.
+func New(cfg Config) (*Simulation, error) {
+	if cfg.Nodes == 0 {
+		cfg.Nodes = defaultNodes
+	}
+	if cfg.Accounts == 0 {
+		cfg.Accounts = defaultAccounts
+	}
+	if cfg.Consensus == "" {
+		cfg.Consensus = state.ConsensusPOW
+	}
+
+	sim := Simulation{
+		Network: NewNetwork(),
+		Genesis: genesis.Genesis{
+			Date:          time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC),
+			ChainID:       1,
+			TransPerBlock: 10,
+			Difficulty:    1,
+			MiningReward:  700,
+			GasPrice:      15,
+			Balances:      make(map[string]uint64),
+		},
+	}
+	sim.Network.SetLatency(cfg.Latency)
+
+	for i := 0; i < cfg.Accounts; i++ {
+		privateKey, err := newKey("account", i)
+		if err != nil {
+			return nil, err
+		}
+
+		account := Account{
+			ID:         database.PublicKeyToAccountID(privateKey.PublicKey),
+			PrivateKey: privateKey,
+		}
+		sim.Accounts = append(sim.Accounts, account)
+		sim.Genesis.Balances[string(account.ID)] = defaultBalance
+	}
+
+	hosts := make([]string, cfg.Nodes)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("node%d:9080", i)
+	}
+
+	for _, host := range hosts {
+		node, err := sim.newNode(host, hosts, cfg)
+		if err != nil {
+			sim.Shutdown()
+			return nil, err
+		}
+
+		sim.Nodes = append(sim.Nodes, node)
+		sim.Network.Attach(host, node.handler())
+	}
+
+	return &sim, nil
+}
+
+// newNode constructs a node for the host that knows the other hosts.
+func (sim *Simulation) newNode(host string, hosts []string, cfg Config) (*Node, error) {
+	privateKey, err := newKey(host, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		return nil, err
+	}
+
+	knownPeers := peer.NewPeerSet()
+	for _, h := range hosts {
+		knownPeers.Add(peer.New(h))
+	}
+
+	node := Node{
+		Host: host,
+		evHandler: func(v string, args ...any) {
+			if cfg.EvHandler != nil {
+				cfg.EvHandler(host+": "+v, args...)
+			}
+		},
+	}
+
+	node.State, err = state.New(state.Config{
+		BeneficiaryID:  database.PublicKeyToAccountID(privateKey.PublicKey),
+		Host:           host,
+		Storage:        storage,
+		Genesis:        sim.Genesis,
+		SelectStrategy: "Tip",
+		KnownPeers:     knownPeers,
+		EvHandler:      node.evHandler,
+		Consensus:      cfg.Consensus,
+		FinalityDepth:  cfg.FinalityDepth,
+		PrivateKey:     privateKey,
+		Transport:      sim.Network.Transport(host),
+		Faults:         cfg.Faults,
+		CompactRelay:   cfg.CompactRelay,
+	})
+	if err != nil {
+		return nil, err
+	}
+	node.State.Worker = worker{node: &node}
+
+	return &node, nil
+}
+
+// Shutdown brings every node down.
+func (sim *Simulation) Shutdown() {
+	for _, node := range sim.Nodes {
+		node.State.Shutdown()
+	}
+}
+
+// =============================================================================
+
+// Transfer signs a transaction moving the value between the accounts and
+// submits it to the node like a wallet would. The nonce is based on what the
+// node knows about the account.
+func (sim *Simulation) Transfer(node int, from int, to int, value uint64) (database.SignedTx, error) {
+	st := sim.Nodes[node].State
+	fromID := sim.Accounts[from].ID
+
+	nonce := uint64(1)
+	if account, err := st.QueryAccount(fromID); err == nil {
+		nonce = account.Nonce + 1
+	}
+	for _, tx := range st.Mempool() {
+		if tx.FromID == fromID {
+			nonce++
+		}
+	}
+
+	tx := database.Tx{
+		ChainID: sim.Genesis.ChainID,
+		Nonce:   nonce,
+		FromID:  fromID,
+		ToID:    sim.Accounts[to].ID,
+		Value:   value,
+	}
+
+	signedTx, err := tx.Sign(sim.Accounts[from].PrivateKey)
+	if err != nil {
+		return database.SignedTx{}, err
+	}
+
+	if err := st.UpsertWalletTransaction(signedTx); err != nil {
+		return database.SignedTx{}, err
+	}
+
+	return signedTx, nil
+}
+
+// Gossip has every node share the transactions it received from wallets
+// with its peers.
+func (sim *Simulation) Gossip() {
+	for _, node := range sim.Nodes {
+		node.Gossip()
+	}
+}
+
+// Mine has the node mine a block from its mempool and propose the block to
+// its peers. Peers that can't be reached or reject the block are logged.
+func (sim *Simulation) Mine(node int) (database.Block, error) {
+	sim.Settle()
+
+	n := sim.Nodes[node]
+
+	block, err := n.State.MineNewBlock(context.Background())
+	if err != nil {
+		return database.Block{}, err
+	}
+
+	if err := n.State.NetSendBlockToPeers(context.Background(), block); err != nil {
+		n.evHandler("simulation: mine: NetSendBlockToPeers: WARNING: %s", err)
+	}
+
+	sim.Settle()
+
+	return block, nil
+}
+
+// Sync has every node sync with its peers.
+func (sim *Simulation) Sync() {
+	sim.Settle()
+
+	for _, node := range sim.Nodes {
+		node.Sync()
+	}
+
+	sim.Settle()
+}
+
+// Settle blocks until every node has finished any resync in progress.
+func (sim *Simulation) Settle() {
+	for _, node := range sim.Nodes {
+		node.WaitResync()
+	}
+}
+
+// =============================================================================
+
+// Workload performs the activity for a single round of the simulation.
+type Workload func(sim *Simulation, round int) error
+
+// Run executes the workload for the number of rounds. The transactions
+// submitted in each round are gossiped at the end of the round.
+func (sim *Simulation) Run(rounds int, workload Workload) error {
+	for round := 0; round < rounds; round++ {
+		if err := workload(sim, round); err != nil {
+			return fmt.Errorf("round %d: %w", round, err)
+		}
+
+		sim.Gossip()
+		sim.Settle()
+	}
+
+	return nil
+}
+
+// Converge syncs the nodes until they agree on the latest block or the
+// number of rounds is reached.
+func (sim *Simulation) Converge(rounds int) error {
+	for round := 0; round < rounds; round++ {
+		if sim.Converged() == nil {
+			return nil
+		}
+
+		sim.Sync()
+	}
+
+	return sim.Converged()
+}
+
+// Converged returns an error describing the differences if the nodes don't
+// agree on the latest block.
+func (sim *Simulation) Converged() error {
+	if len(sim.Nodes) == 0 {
+		return nil
+	}
+
+	exp := sim.Nodes[0].State.LatestBlock().Hash()
+
+	converged := true
+	tips := make([]string, len(sim.Nodes))
+	for i, node := range sim.Nodes {
+		latest := node.State.LatestBlock()
+		tips[i] = fmt.Sprintf("%s[%d:%s]", node.Host, latest.Header.Number, latest.Hash())
+
+		if latest.Hash() != exp {
+			converged = false
+		}
+	}
+
+	if !converged {
+		return errors.New("nodes have not converged: " + strings.Join(tips, " "))
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// newKey derives a private key from the name and index so every run of the
+// simulation uses the same accounts.
+func newKey(name string, index int) (*ecdsa.PrivateKey, error) {
+	seed := sha256.Sum256([]byte(fmt.Sprintf("simulation:%s:%d", name, index)))
+	return crypto.ToECDSA(seed[:])
+}
@@ -0,0 +1,267 @@
+package simulation_test
+
+import (
+	"context"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/chaos"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/simulation"
+)
+
+func Test_Gossip(t *testing.T) {
+	sim := newSimulation(t, simulation.Config{Nodes: 3})
+
+	if _, err := sim.Transfer(0, 0, 1, 10); err != nil {
+		t.Fatalf("Should be able to submit the transfer: %v", err)
+	}
+
+	sim.Gossip()
+
+	for _, node := range sim.Nodes {
+		if got := node.State.MempoolLength(); got != 1 {
+			t.Logf("got: %d", got)
+			t.Logf("exp: %d", 1)
+			t.Fatalf("Should have the transaction in the mempool of %s.", node.Host)
+		}
+	}
+
+	if _, err := sim.Mine(1); err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if err := sim.Converged(); err != nil {
+		t.Fatalf("Should converge once the block is proposed: %v", err)
+	}
+
+	for _, node := range sim.Nodes {
+		if got := node.State.MempoolLength(); got != 0 {
+			t.Fatalf("Should remove the mined transaction from the mempool of %s, got %d.", node.Host, got)
+		}
+	}
+}
+
+func Test_CompactRelay(t *testing.T) {
+	var missing int32
+	ev := func(v string, args ...any) {
+		if strings.Contains(v, "is missing trans") {
+			atomic.AddInt32(&missing, 1)
+		}
+	}
+	sim := newSimulation(t, simulation.Config{Nodes: 3, CompactRelay: true, EvHandler: ev})
+
+	// The first transfer is shared before the block is mined, the second
+	// one has to be sent with the block.
+	if _, err := sim.Transfer(0, 0, 1, 10); err != nil {
+		t.Fatalf("Should be able to submit the transfer: %v", err)
+	}
+	sim.Gossip()
+
+	if _, err := sim.Transfer(0, 1, 2, 10); err != nil {
+		t.Fatalf("Should be able to submit the transfer: %v", err)
+	}
+
+	block, err := sim.Mine(0)
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if got := len(block.MerkleTree.Values()); got != 2 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should mine both transfers.")
+	}
+
+	if err := sim.Converged(); err != nil {
+		t.Fatalf("Should converge once the compact block is relayed: %v", err)
+	}
+
+	if got := atomic.LoadInt32(&missing); got != 2 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should ask for the missing transfer once per peer.")
+	}
+}
+
+func Test_SyncAfterDown(t *testing.T) {
+	sim := newSimulation(t, simulation.Config{Nodes: 3})
+
+	down := sim.Nodes[2].Host
+	sim.Network.SetDown(down, true)
+
+	for i := 0; i < 3; i++ {
+		if _, err := sim.Transfer(0, 0, 1, 10); err != nil {
+			t.Fatalf("Should be able to submit the transfer: %v", err)
+		}
+
+		if _, err := sim.Mine(0); err != nil {
+			t.Fatalf("Should be able to mine the block: %v", err)
+		}
+	}
+
+	if got := sim.Nodes[2].State.LatestBlock().Header.Number; got != 0 {
+		t.Fatalf("Should not receive blocks while down, got block %d.", got)
+	}
+
+	sim.Network.SetDown(down, false)
+
+	if err := sim.Converge(2); err != nil {
+		t.Fatalf("Should converge once the node is back: %v", err)
+	}
+
+	if got := sim.Nodes[2].State.LatestBlock().Header.Number; got != 3 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 3)
+		t.Fatalf("Should sync the missing blocks.")
+	}
+}
+
+func Test_ForkResolution(t *testing.T) {
+	sim := newSimulation(t, simulation.Config{Nodes: 3})
+
+	minority := []string{sim.Nodes[0].Host}
+	majority := []string{sim.Nodes[1].Host, sim.Nodes[2].Host}
+	sim.Network.Partition(minority, majority)
+
+	// The minority mines one block on its side of the partition.
+	if _, err := sim.Transfer(0, 0, 1, 10); err != nil {
+		t.Fatalf("Should be able to submit the transfer: %v", err)
+	}
+	orphan, err := sim.Mine(0)
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	// The majority mines a longer chain on the other side.
+	for i := 0; i < 3; i++ {
+		if _, err := sim.Transfer(1, 2, 3, 10); err != nil {
+			t.Fatalf("Should be able to submit the transfer: %v", err)
+		}
+
+		if _, err := sim.Mine(1); err != nil {
+			t.Fatalf("Should be able to mine the block: %v", err)
+		}
+	}
+
+	if err := sim.Converged(); err == nil {
+		t.Fatalf("Should not converge while partitioned.")
+	}
+
+	sim.Network.Heal()
+
+	// The next block proposed by the majority is far enough ahead for the
+	// minority to detect the fork and reorganize.
+	if _, err := sim.Transfer(1, 2, 3, 10); err != nil {
+		t.Fatalf("Should be able to submit the transfer: %v", err)
+	}
+	latest, err := sim.Mine(1)
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if err := sim.Converge(2); err != nil {
+		t.Fatalf("Should converge once the partition heals: %v", err)
+	}
+
+	st := sim.Nodes[0].State
+	if got := st.LatestBlock().Hash(); got != latest.Hash() {
+		t.Logf("got: %s", got)
+		t.Logf("exp: %s", latest.Hash())
+		t.Fatalf("Should adopt the longer chain.")
+	}
+
+	block := st.QueryBlocksByNumber(context.Background(), 1, 1)
+	if len(block) != 1 || block[0].Hash() == orphan.Hash() {
+		t.Fatalf("Should replace the orphaned block.")
+	}
+}
+
+func Test_Workload(t *testing.T) {
+	sim := newSimulation(t, simulation.Config{Nodes: 4, Accounts: 6})
+
+	if err := sim.Run(10, simulation.RandomTransfers(42, 3)); err != nil {
+		t.Fatalf("Should be able to run the workload: %v", err)
+	}
+
+	if err := sim.Converge(2); err != nil {
+		t.Fatalf("Should converge after the workload: %v", err)
+	}
+
+	if got := sim.Nodes[0].State.LatestBlock().Header.Number; got != 10 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 10)
+		t.Fatalf("Should mine a block each round.")
+	}
+
+	exp := sim.Nodes[0].State.Accounts()
+	for _, node := range sim.Nodes[1:] {
+		got := node.State.Accounts()
+		exp.ForEach(func(account database.Account) {
+			if have, _ := got.Query(account.AccountID); have != account {
+				t.Logf("got: %+v", have)
+				t.Logf("exp: %+v", account)
+				t.Fatalf("Should have the same account state on %s.", node.Host)
+			}
+		})
+	}
+}
+
+func Test_Chaos(t *testing.T) {
+	faults := chaos.New(chaos.Config{DropRate: 1, Seed: 7})
+	sim := newSimulation(t, simulation.Config{Nodes: 3, Faults: faults})
+
+	if _, err := sim.Transfer(0, 0, 1, 10); err != nil {
+		t.Fatalf("Should be able to submit the transfer: %v", err)
+	}
+	sim.Gossip()
+
+	if _, err := sim.Mine(0); err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if got := sim.Nodes[1].State.LatestBlock().Header.Number; got != 0 {
+		t.Fatalf("Should not propagate the block when every request is dropped, got block %d.", got)
+	}
+
+	// Half the requests are lost while the first node keeps mining, but
+	// syncing repeatedly still brings every node to the same chain.
+	faults.Update(chaos.Config{DropRate: 0.5})
+
+	workload := func(sim *simulation.Simulation, round int) error {
+		if _, err := sim.Transfer(0, round%len(sim.Accounts), (round+1)%len(sim.Accounts), 10); err != nil {
+			return err
+		}
+
+		_, err := sim.Mine(0)
+		return err
+	}
+
+	if err := sim.Run(5, workload); err != nil {
+		t.Fatalf("Should be able to run the workload: %v", err)
+	}
+
+	if err := sim.Converge(20); err != nil {
+		t.Fatalf("Should converge with requests being dropped: %v", err)
+	}
+
+	if got := sim.Nodes[2].State.LatestBlock().Header.Number; got != 6 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 6)
+		t.Fatalf("Should sync every block.")
+	}
+}
+
+// =============================================================================
+
+// newSimulation constructs a simulation that's shut down when the test ends.
+func newSimulation(t *testing.T, cfg simulation.Config) *simulation.Simulation {
+	sim, err := simulation.New(cfg)
+	if err != nil {
+		t.Fatalf("Should be able to construct the simulation: %v", err)
+	}
+	t.Cleanup(sim.Shutdown)
+
+	return sim
+}
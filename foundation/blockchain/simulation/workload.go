@@ -0,0 +1,37 @@
+package simulation
+
+import (
+	"errors"
+	"math/rand"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+)
+
+// RandomTransfers constructs a workload that submits the number of transfers
+// between random accounts to random nodes each round and then has a random
+// node mine a block. The same seed always produces the same activity.
+func RandomTransfers(seed int64, transfers int) Workload {
+	rnd := rand.New(rand.NewSource(seed))
+
+	return func(sim *Simulation, round int) error {
+		for i := 0; i < transfers; i++ {
+			from := rnd.Intn(len(sim.Accounts))
+			to := (from + 1 + rnd.Intn(len(sim.Accounts)-1)) % len(sim.Accounts)
+			node := rnd.Intn(len(sim.Nodes))
+
+			if _, err := sim.Transfer(node, from, to, uint64(1+rnd.Intn(100))); err != nil {
+				return err
+			}
+
+			// Share the transaction right away so the next transfer from the
+			// same account picks the next nonce on any node.
+			sim.Gossip()
+		}
+
+		if _, err := sim.Mine(rnd.Intn(len(sim.Nodes))); err != nil && !errors.Is(err, state.ErrNoTransactions) {
+			return err
+		}
+
+		return nil
+	}
+}
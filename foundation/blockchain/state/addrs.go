@@ -0,0 +1,65 @@
+package state
+
+import "sync"
+
+// CORE NOTE: A peer can be reachable at more than one address, such as an
+// IPv4 and an IPv6 address or a DNS name. Requests are built with the
+// primary address the peer is known by, and when it can't be reached the
+// other addresses are tried in the order the peer listed them. The address
+// that worked is tried first from then on, until it fails as well.
+
+// peerAddresses returns the primary address of the peer reached at the host
+// and the addresses to try in order, starting with the one that last worked.
+// A host that isn't a known peer is only tried at that address.
+func (s *State) peerAddresses(host string) (string, []string) {
+	pr, exists := s.knownPeers.Lookup(host)
+	if !exists {
+		return host, []string{host}
+	}
+
+	addrs := pr.Addresses()
+
+	preferred := s.addrs.lookup(pr.Host)
+	for i, addr := range addrs {
+		if addr == preferred && i > 0 {
+			ordered := append([]string{addr}, addrs[:i]...)
+			addrs = append(ordered, addrs[i+1:]...)
+			break
+		}
+	}
+
+	return pr.Host, addrs
+}
+
+// =============================================================================
+
+// preferredAddrs keeps the address each peer was last reached at. The zero
+// value is ready to use.
+type preferredAddrs struct {
+	mu    sync.Mutex
+	addrs map[string]string // Primary address of the peer to the address that worked.
+}
+
+// use records the address the peer was reached at.
+func (pa *preferredAddrs) use(host string, addr string) {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	if pa.addrs == nil {
+		pa.addrs = make(map[string]string)
+	}
+
+	if addr == host {
+		delete(pa.addrs, host)
+		return
+	}
+	pa.addrs[host] = addr
+}
+
+// lookup returns the address the peer was last reached at.
+func (pa *preferredAddrs) lookup(host string) string {
+	pa.mu.Lock()
+	defer pa.mu.Unlock()
+
+	return pa.addrs[host]
+}
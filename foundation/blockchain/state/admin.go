@@ -0,0 +1,128 @@
+package state
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// CORE NOTE: These methods give an operator the ability to manage a running
+// node without a restart. They are surfaced over the admin API which should
+// only be bound to a local host and is protected by a token.
+
+// AddPeer adds the peer to the known peer list. An error is returned if the
+// peer is this node or is already known.
+func (s *State) AddPeer(pr peer.Peer) error {
+	if err := pr.Validate(); err != nil {
+		return err
+	}
+
+	if pr.Match(s.host) || (pr.ID != "" && pr.ID == s.nodeID) {
+		return errors.New("peer is this node")
+	}
+
+	if !s.knownPeers.Add(pr) {
+		return fmt.Errorf("peer %s is already known", pr.Host)
+	}
+	s.slots.admit(pr.Host, false)
+
+	s.evHandler("state: AddPeer: peer[%s]", pr.Host)
+	s.peerEvent(PeerAdd, pr)
+
+	return nil
+}
+
+// RemovePeer removes the peer from the known peer list. An error is returned
+// if the peer isn't known.
+func (s *State) RemovePeer(pr peer.Peer) error {
+	for _, known := range s.KnownExternalPeers() {
+		if known.Match(pr.Host) {
+			s.knownPeers.Remove(known)
+			s.slots.forget(known.Host)
+			s.latency.forget(known.Host)
+			s.evHandler("state: RemovePeer: peer[%s]", pr.Host)
+			s.peerEvent(PeerRemove, known)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("peer %s is not known", pr.Host)
+}
+
+// ForceSync starts a sync of the blockchain with the known peers. No mining
+// is allowed to take place while the sync is running.
+func (s *State) ForceSync() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Don't allow mining to continue.
+	s.allowMining = false
+
+	s.resyncWG.Add(1)
+	go func() {
+		s.evHandler("state: ForceSync: started: *****************************")
+		defer func() {
+			s.turnMiningOn()
+			s.evHandler("state: ForceSync: completed: *****************************")
+			s.resyncWG.Done()
+		}()
+
+		s.Worker.Sync()
+	}()
+}
+
+// SetMining turns mining on or off for this node. Turning mining off cancels
+// any mining operation in progress.
+func (s *State) SetMining(on bool) {
+	s.mu.Lock()
+	s.miningDisabled = !on
+	s.mu.Unlock()
+
+	s.evHandler("state: SetMining: on[%t]", on)
+
+	if !on {
+		s.Worker.SignalCancelMining()
+		return
+	}
+
+	s.Worker.SignalStartMining()
+}
+
+// SetMinTip changes the lowest tip accepted into the mempool for transactions
+// from other accounts. Transactions already in the mempool are kept.
+func (s *State) SetMinTip(tip uint64) {
+	s.mu.Lock()
+	s.minTip = tip
+	s.mu.Unlock()
+
+	s.evHandler("state: SetMinTip: tip[%d]", tip)
+}
+
+// MinTip returns the lowest tip accepted into the mempool for transactions
+// from other accounts.
+func (s *State) MinTip() uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.minTip
+}
+
+// DropMempoolTx removes the transaction for the account and nonce from the
+// mempool. An error is returned if the transaction isn't in the mempool.
+func (s *State) DropMempoolTx(accountID database.AccountID, nonce uint64) (err error) {
+	defer func() {
+		s.record(journal.Entry{Kind: JournalDropTx}, journalDropTx{AccountID: accountID, Nonce: nonce}, err)
+	}()
+
+	if !s.mempool.DeleteByNonce(accountID, nonce) {
+		return fmt.Errorf("transaction %s:%d is not in the mempool", accountID, nonce)
+	}
+
+	s.evHandler("state: DropMempoolTx: tx[%s:%d]", accountID, nonce)
+	s.mempoolEvent(MempoolEvent{Action: MempoolDrop, FromID: accountID, Nonce: nonce})
+
+	return nil
+}
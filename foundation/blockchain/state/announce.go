@@ -0,0 +1,99 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// Set of statuses a peer responds with when a block is announced.
+const (
+	AnnounceWanted  = "wanted"  // The peer doesn't have the block and wants it.
+	AnnounceKnown   = "known"   // The peer has the block or a block at that number.
+	AnnouncePending = "pending" // The peer is already being sent the block by another peer.
+)
+
+// announceHold is how long a block a peer wants is held for the peer that
+// announced it first. Once it passes, the block is wanted from other peers.
+const announceHold = 5 * time.Second
+
+// BlockAnnouncement represents a new block being announced to a peer before
+// the block itself is sent.
+type BlockAnnouncement struct {
+	Hash   string `json:"hash"`
+	Number uint64 `json:"number"`
+}
+
+// AnnouncementStatus represents the response of a peer to a block
+// announcement.
+type AnnouncementStatus struct {
+	Status string `json:"status"`
+}
+
+// ProcessBlockAnnouncement decides if a block announced by a peer needs to be
+// sent to this node. Only the first peer announcing a block is asked for it,
+// so the block isn't received from every peer that has it.
+func (s *State) ProcessBlockAnnouncement(ba BlockAnnouncement) AnnouncementStatus {
+	if ba.Number <= s.LatestBlock().Header.Number {
+		return AnnouncementStatus{Status: AnnounceKnown}
+	}
+
+	if !s.inventory.want(ba.Hash, time.Now()) {
+		s.evHandler("state: ProcessBlockAnnouncement: blk[%d]: hash[%s]: already pending", ba.Number, ba.Hash)
+		return AnnouncementStatus{Status: AnnouncePending}
+	}
+
+	return AnnouncementStatus{Status: AnnounceWanted}
+}
+
+// announceBlock announces the block to the peer and returns the status the
+// peer responded with.
+func (s *State) announceBlock(ctx context.Context, pr peer.Peer, relay blockRelay) (string, error) {
+	url := fmt.Sprintf("%s/block/announce", s.nodeURL(pr.Host))
+
+	var status AnnouncementStatus
+	if err := s.send(ctx, http.MethodPost, url, BlockAnnouncement{Hash: relay.hash, Number: relay.number}, &status); err != nil {
+		return "", err
+	}
+
+	return status.Status, nil
+}
+
+// =============================================================================
+
+// blockInventory tracks the blocks announced to this node that were asked
+// for, so the same block isn't asked for from more than one peer at a time.
+// The zero value is ready to use.
+type blockInventory struct {
+	mu     sync.Mutex
+	wanted map[string]time.Time // When each block was asked for by hash.
+}
+
+// want reports if the block with the specified hash should be asked for. A
+// block isn't asked for again until the hold on it passes.
+func (inv *blockInventory) want(hash string, now time.Time) bool {
+	inv.mu.Lock()
+	defer inv.mu.Unlock()
+
+	if inv.wanted == nil {
+		inv.wanted = make(map[string]time.Time)
+	}
+
+	if asked, exists := inv.wanted[hash]; exists && now.Sub(asked) < announceHold {
+		return false
+	}
+
+	// Forget the blocks whose hold passed so the inventory doesn't grow.
+	for h, asked := range inv.wanted {
+		if now.Sub(asked) >= announceHold {
+			delete(inv.wanted, h)
+		}
+	}
+
+	inv.wanted[hash] = now
+	return true
+}
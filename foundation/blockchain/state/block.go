@@ -2,97 +2,387 @@ package state
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
+	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 )
 
 // ErrNoTransactions is returned when a block is requested to be created
 // and there are not enough transactions.
 var ErrNoTransactions = errors.New("no transactions in mempool")
 
+// ErrMiningTimeout is returned when a block isn't solved before the mining
+// timeout, as opposed to mining being cancelled.
+var ErrMiningTimeout = errors.New("mining timed out")
+
+// defaultMiningTimeout is the mining timeout used until the hash rate has been
+// measured and the least time a derived timeout allows.
+const defaultMiningTimeout = 2 * time.Minute
+
+// miningTimeoutFactor is the multiple of the expected time to solve a block
+// allowed before mining times out. Solving a block is random and often takes
+// longer than the average.
+const miningTimeoutFactor = 4
+
 // =============================================================================
 
 // MineNewBlock attempts to create a new block with a proper hash that can become
 // the next block in the chain.
-func (s *State) MineNewBlock(ctx context.Context) (database.Block, error) {
+func (s *State) MineNewBlock(ctx context.Context) (_ database.Block, err error) {
 	defer s.evHandler("viewer: MineNewBlock: MINING: completed")
 
+	// The time in each stage is reported once the block is sent to the peers.
+	var times stageTimes
+	selectStart := time.Now()
+
+	// Remove any transactions that can't be mined into the next block.
+	nextBlock := s.db.LatestBlock().Header.Number + 1
+	s.record(journal.Entry{Kind: JournalMiningTick}, journalTick{Block: nextBlock}, nil)
+	if n := s.mempool.DeleteExpired(nextBlock); n > 0 {
+		s.evHandler("state: MineNewBlock: MINING: removed %d expired transactions", n)
+		s.mempoolEvent(MempoolEvent{Action: MempoolExpire, Removed: n})
+	}
+
 	s.evHandler("state: MineNewBlock: MINING: check mempool count")
 
-	// Are there enough transactions in the pool.
-	if s.mempool.Count() == 0 {
+	// Are there enough transactions in the pool. An empty block is mined
+	// when one is due to keep blocks coming.
+	emptyDue := s.EmptyBlockDue()
+	if s.mempool.Count() == 0 && !emptyDue {
 		return database.Block{}, ErrNoTransactions
 	}
 
-	// Pick the best transactions from the mempool.
-	trans := s.mempool.PickBest(s.genesis.TransPerBlock)
+	// Pick the best transactions from the mempool. Transactions that won't
+	// pay the base fee are left in the mempool until the base fee drops.
+	// With a block gas limit every transaction is looked at and the block
+	// is filled by gas instead of the number of transactions.
+	gen := s.db.GenesisAt(nextBlock)
+	howMany := gen.TransPerBlock
+	if gen.BlockGasLimit > 0 {
+		howMany = 0
+	}
+
+	baseFee := s.db.NextBaseFee()
+	trans := s.removeDenied(s.mempool.PickBest(howMany))
+	if baseFee > 0 {
+		var payable []database.BlockTx
+		for _, tx := range trans {
+			if tx.GasPrice >= baseFee {
+				payable = append(payable, tx)
+			}
+		}
+		trans = payable
+	}
+
+	// The gas units are charged by the rules in effect for the block, which
+	// may have changed since the transactions entered the mempool.
+	for i := range trans {
+		trans[i].GasUnits = s.db.GasUnits(trans[i].Tx, nextBlock)
+	}
+
+	if gen.BlockGasLimit > 0 {
+		trans = fillGasLimit(trans, gen.BlockGasLimit)
+	}
+
+	if len(trans) == 0 && !emptyDue {
+		return database.Block{}, ErrNoTransactions
+	}
 
 	// If PoA is being used, drop the difficulty down to 1 to speed up
-	// the mining operation.
+	// the mining operation. PoS blocks are signed instead of solved.
 	difficulty := s.genesis.Difficulty
-	if s.Consensus() == ConsensusPOA {
+	switch s.Consensus() {
+	case ConsensusPOA:
 		difficulty = 1
+	case ConsensusPOS:
+		difficulty = 0
 	}
 
+	// Only the attempts to mine a block with transactions are traced.
+	ctx, span := s.tracer.Start(ctx, "block.mine",
+		tracing.Uint64("block", nextBlock),
+		tracing.Int("difficulty", int(difficulty)),
+		tracing.Int("txs", len(trans)),
+	)
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	times.selectTxs = time.Since(selectStart)
+
+	validateStart := time.Now()
+	stateRoot := s.db.HashState()
+	times.validate = time.Since(validateStart)
+
+	// Mining is abandoned once the timeout passes so the node can start over
+	// with the latest transactions.
+	timeout := s.MiningTimeout(difficulty)
+	powCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
 	// Attempt to create a new block by solving the POW puzzle. This can be cancelled.
-	block, err := database.POW(ctx, database.POWArgs{
+	start := time.Now()
+	block, err := database.POW(powCtx, database.POWArgs{
 		BeneficiaryID: s.beneficiaryID,
 		Difficulty:    difficulty,
-		MiningReward:  s.genesis.MiningReward,
+		MiningReward:  s.db.MiningReward(nextBlock),
+		BaseFee:       baseFee,
 		PrevBlock:     s.db.LatestBlock(),
-		StateRoot:     s.db.HashState(),
+		StateRoot:     stateRoot,
+		Encoding:      s.genesis.EncodingAt(nextBlock),
+		Version:       s.genesis.BlockVersionAt(nextBlock),
 		Trans:         trans,
 		EvHandler:     s.evHandler,
+		HashRate:      &s.hashRate,
 	})
 	if err != nil {
+		ev := MiningEvent{
+			Action:     MiningCancelled,
+			Block:      nextBlock,
+			Difficulty: difficulty,
+			Duration:   time.Since(start).Milliseconds(),
+		}
+
+		switch {
+		case ctx.Err() == nil && errors.Is(err, context.DeadlineExceeded):
+			s.evHandler("state: MineNewBlock: MINING: TIMEOUT: blk[%d]: after[%v]", nextBlock, timeout)
+			ev.Action = MiningTimedOut
+			ev.Timeout = timeout.Milliseconds()
+			s.miningEvent(ev)
+			return database.Block{}, fmt.Errorf("%w: blk[%d] not solved after %v", ErrMiningTimeout, nextBlock, timeout)
+
+		case ctx.Err() != nil:
+			s.miningEvent(ev)
+		}
+
 		return database.Block{}, err
 	}
 
+	times.nonce = time.Since(start)
+
 	// Just check one more time we were not cancelled.
 	if ctx.Err() != nil {
 		return database.Block{}, ctx.Err()
 	}
 
+	validateStart = time.Now()
+
+	// Under PoS the proposer adds the votes for the parent block and signs
+	// the block so peers can check it was proposed by the selected validator.
+	if s.Consensus() == ConsensusPOS {
+		block.Votes = s.aggregateVotes(s.db.LatestBlock())
+
+		if err := block.Sign(s.genesis.ChainID, s.privateKey); err != nil {
+			return database.Block{}, err
+		}
+	}
+
 	s.evHandler("state: MineNewBlock: MINING: validate and update database")
 
+	span.SetAttributes(tracing.String("hash", block.Hash()))
+
 	// Validate the block and then update the blockchain database.
-	if err := s.validateUpdateDatabase(block); err != nil {
+	if err := s.validateUpdateDatabase(ctx, block, JournalMinedBlock, false); err != nil {
 		return database.Block{}, err
 	}
+	s.observeBlock(block)
+
+	times.validate += time.Since(validateStart)
+	s.production.mined(block, times)
 
 	return block, nil
 }
 
 // ProcessProposedBlock takes a block received from a peer, validates it and
-// if that passes, adds the block to the local blockchain.
-func (s *State) ProcessProposedBlock(block database.Block) error {
+// if that passes, adds the block to the local blockchain. A block that is
+// already in the chain isn't processed again and the known status is
+// returned instead of an error, so a peer can send a block more than once.
+// A block that arrived right before its parent is held and the buffered
+// status is returned, the block is added once the parent is.
+func (s *State) ProcessProposedBlock(block database.Block) (string, error) {
+	return s.processBlock(block, false)
+}
+
+// processBlock processes the block from a peer like ProcessProposedBlock. A
+// block from a peer trusted for a fast sync skips the expensive rules.
+func (s *State) processBlock(block database.Block, trusted bool) (string, error) {
 	s.evHandler("state: ValidateProposedBlock: started: prevBlk[%s]: newBlk[%s]: numTrans[%d]", block.Header.PrevBlockHash, block.Hash(), len(block.MerkleTree.Values()))
 	defer s.evHandler("state: ValidateProposedBlock: completed: newBlk[%s]", block.Hash())
 
-	// Validate the block and then update the blockchain database.
-	if err := s.validateUpdateDatabase(block); err != nil {
-		return err
+	if s.KnownBlock(block) {
+		s.evHandler("state: ValidateProposedBlock: blk[%s]: already known", block.Hash())
+		return BlockKnown, nil
+	}
+
+	// Look for a second block from the same beneficiary before the block
+	// is rejected for not being the next block.
+	s.observeBlock(block)
+
+	if err := s.checkBlockPolicy(block); err != nil {
+		return "", err
+	}
+
+	// Validate the block and then update the blockchain database. The block
+	// can still become known while it's checked if another peer sent it at
+	// the same time.
+	err := s.validateUpdateDatabase(context.Background(), block, JournalBlock, trusted)
+	switch {
+	case errors.Is(err, errBlockKnown):
+		s.evHandler("state: ValidateProposedBlock: blk[%s]: already known", block.Hash())
+		return BlockKnown, nil
+
+	case errors.Is(err, errBlockFuture):
+		s.evHandler("state: ValidateProposedBlock: blk[%d]: parent[%s]: held until the parent arrives", block.Header.Number, block.Header.PrevBlockHash)
+		return BlockBuffered, nil
+
+	case err != nil:
+		return "", err
 	}
 
 	// If the runMiningOperation function is being executed it needs to stop
 	// immediately.
 	s.Worker.SignalCancelMining()
 
-	return nil
+	// Add the blocks that arrived before this block.
+	s.applyFutureBlocks(block)
+
+	return BlockAccepted, nil
+}
+
+// MiningTimeout returns how long a block at the difficulty is mined for before
+// mining is abandoned. Unless a timeout is configured, it's derived from the
+// measured hash rate so blocks at a high difficulty aren't abandoned before
+// they're likely to be solved.
+func (s *State) MiningTimeout(difficulty uint16) time.Duration {
+	if s.miningTimeout > 0 {
+		return s.miningTimeout
+	}
+
+	expected, measured := s.hashRate.Expected(difficulty)
+	if !measured {
+		return defaultMiningTimeout
+	}
+
+	// Guard against overflow at a difficulty that will practically never
+	// be solved.
+	timeout := time.Duration(math.MaxInt64)
+	if expected < timeout/miningTimeoutFactor {
+		timeout = expected * miningTimeoutFactor
+	}
+
+	if timeout < defaultMiningTimeout {
+		return defaultMiningTimeout
+	}
+
+	return timeout
+}
+
+// CORE NOTE: A node can be configured to wait for a number of transactions
+// before it mines so blocks aren't mined for every transaction that arrives.
+// Waiting on the count alone could leave a lone transaction in the mempool
+// forever, so there are two ways to mine before the count is reached. Once the
+// pending tips add up to a threshold the transactions are worth mining now,
+// and once the first waiting transaction has waited long enough a partial
+// block is mined. The worker owns the timer, the state decides the rest.
+
+// ReadyToMine reports if the transactions in the mempool should be mined now
+// instead of waiting for more transactions.
+func (s *State) ReadyToMine() bool {
+	pending := s.mempool.Count()
+	if pending == 0 {
+		return false
+	}
+
+	if pending >= s.minTrans {
+		return true
+	}
+
+	if s.minTips > 0 {
+		var tips uint64
+		for _, tx := range s.mempool.PickBest() {
+			tips += tx.Tip
+		}
+		if tips >= s.minTips {
+			return true
+		}
+	}
+
+	return false
+}
+
+// EmptyBlockDue reports if an empty block should be mined because no block
+// has been added for the configured interval.
+func (s *State) EmptyBlockDue() bool {
+	if s.emptyBlocks == 0 {
+		return false
+	}
+
+	latest := time.UnixMilli(int64(s.db.LatestBlock().Header.TimeStamp))
+	return time.Since(latest) >= s.emptyBlocks
+}
+
+// EmptyBlockInterval returns the time without a new block before an empty
+// block is mined, 0 if empty blocks are never mined.
+func (s *State) EmptyBlockInterval() time.Duration {
+	return s.emptyBlocks
+}
+
+// MiningMaxWait returns how long transactions wait for ReadyToMine before a
+// partial block is mined, 0 if they wait until it's ready.
+func (s *State) MiningMaxWait() time.Duration {
+	return s.maxWait
 }
 
 // =============================================================================
 
 // validateUpdateDatabase takes the block and validates the block against the
 // consensus rules. If the block passes, then the state of the node is updated
-// including adding the block to disk.
-func (s *State) validateUpdateDatabase(block database.Block) error {
+// including adding the block to disk. The block is recorded in the journal
+// as the specified kind while the lock is held so the journal keeps the order
+// blocks were applied in. The time the transactions waited since they were
+// received is traced so the latency to inclusion can be followed. A block
+// already in the chain returns errBlockKnown and the block after the next
+// block is held and returns errBlockFuture, neither is recorded. A trusted
+// block skips the rules a trusted fast sync doesn't need to pass.
+func (s *State) validateUpdateDatabase(ctx context.Context, block database.Block, kind string, trusted bool) (err error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	if s.knownBlock(block) {
+		return errBlockKnown
+	}
+
+	if block.Header.Number == s.db.LatestBlock().Header.Number+2 {
+		s.future.add(block, time.Now())
+		return errBlockFuture
+	}
+
+	trans := block.MerkleTree.Values()
+	avg, longest := txLatency(trans, time.Now())
+
+	_, span := s.tracer.Start(ctx, "block.apply",
+		tracing.String("hash", block.Hash()),
+		tracing.Uint64("block", block.Header.Number),
+		tracing.String("kind", kind),
+		tracing.Int("txs", len(trans)),
+		tracing.Int("tx_latency_avg_ms", int(avg.Milliseconds())),
+		tracing.Int("tx_latency_max_ms", int(longest.Milliseconds())),
+	)
+
+	defer func() {
+		s.recordBlock(kind, block, err)
+
+		span.RecordError(err)
+		span.End()
+	}()
+
 	s.evHandler("state: validateUpdateDatabase: validate block")
 
 	// CORE NOTE: I could add logic to determine if this block was mined by this
@@ -100,52 +390,138 @@ func (s *State) validateUpdateDatabase(block database.Block) error {
 	// me to this function for the same block number, I could replace the peer
 	// block with my own and attempt to have other peers accept my block instead.
 
-	if err := block.ValidateBlock(s.db.LatestBlock(), s.db.HashState(), s.evHandler); err != nil {
+	if err := s.checkCheckpoint(block); err != nil {
 		return err
 	}
 
+	validate := s.db.ValidateBlock
+	if trusted {
+		validate = s.db.ValidateTrustedBlock
+	}
+
+	if err := validate(block, s.evHandler); err != nil {
+		return errcode.Wrap(errcode.InvalidBlock, err)
+	}
+
+	s.evHandler("state: validateUpdateDatabase: stage account changes")
+
+	// Stage the balance changes for the transactions and the mining reward so
+	// the accounts only change once the whole block has been applied.
+	delta := s.db.Stage(block)
+	for _, tx := range trans {
+		s.evHandler("state: validateUpdateDatabase: tx[%s] stage", tx)
+
+		if err := delta.ApplyTransaction(tx); err != nil {
+			s.evHandler("state: validateUpdateDatabase: WARNING : %s", err)
+			continue
+		}
+	}
+	delta.ApplyMiningReward()
+	changes := delta.Changes()
+
 	s.evHandler("state: validateUpdateDatabase: write to disk")
 
 	// Write the new block to the chain on disk.
 	if err := s.db.Write(block); err != nil {
 		return err
 	}
-	s.db.UpdateLatestBlock(block)
 
-	s.evHandler("state: validateUpdateDatabase: update accounts and remove from mempool")
+	s.evHandler("state: validateUpdateDatabase: commit account changes")
+
+	if err := s.db.Commit(delta); err != nil {
+		return err
+	}
+
+	s.evHandler("state: validateUpdateDatabase: reconcile mempool")
 
-	// Process the transactions and update the accounts.
-	for _, tx := range block.MerkleTree.Values() {
-		s.evHandler("state: validateUpdateDatabase: tx[%s] update and remove", tx)
+	s.reconcileMempool(block)
 
-		// Remove this transaction from the mempool.
-		s.mempool.Delete(tx)
+	s.evHandler("state: validateUpdateDatabase: promote orphans")
 
-		// Apply the balance changes based on this transaction.
-		if err := s.db.ApplyTransaction(block, tx); err != nil {
-			s.evHandler("state: validateUpdateDatabase: WARNING : %s", err)
-			continue
-		}
+	s.promoteOrphans(block)
+
+	// Remove the transactions that can't be mined into the next block.
+	if n := s.mempool.DeleteExpired(block.Header.Number + 1); n > 0 {
+		s.evHandler("state: validateUpdateDatabase: removed %d expired transactions", n)
+		s.mempoolEvent(MempoolEvent{Action: MempoolExpire, Removed: n})
 	}
 
-	s.evHandler("state: validateUpdateDatabase: apply mining reward")
+	s.seen.record(block)
+
+	// Vote for the block so the next proposer can include the vote.
+	s.castVote(block)
 
-	// Apply the mining reward for this block.
-	s.db.ApplyMiningReward(block)
+	// Sign a checkpoint when this block makes one due.
+	s.signCheckpoint()
 
-	// Send an event about this new block.
+	// Send an event about this new block, the balances it changed and the
+	// watched accounts it changed.
 	s.blockEvent(block)
+	s.sendEvent(EventBalances, BalancesEvent{Block: block.Header.Number, Hash: block.Hash(), Changes: changes})
+	s.watchEvents(block)
 
 	return nil
 }
 
+// txLatency returns the average and longest time the transactions waited
+// since they were received by the first node. Transactions without a
+// timestamp are ignored.
+func txLatency(trans []database.BlockTx, now time.Time) (avg time.Duration, longest time.Duration) {
+	var total time.Duration
+	var n int
+
+	for _, tx := range trans {
+		if tx.TimeStamp == 0 {
+			continue
+		}
+
+		wait := now.Sub(time.UnixMilli(int64(tx.TimeStamp)))
+		if wait < 0 {
+			wait = 0
+		}
+
+		total += wait
+		n++
+		if wait > longest {
+			longest = wait
+		}
+	}
+
+	if n > 0 {
+		avg = total / time.Duration(n)
+	}
+
+	return avg, longest
+}
+
 // blockEvent provides a specific event about a new block in the chain for
 // application specific support.
 func (s *State) blockEvent(block database.Block) {
-	data, err := json.Marshal(database.NewBlockData(block))
-	if err != nil {
-		data = []byte(fmt.Sprintf("{error: %q}", err.Error()))
+	s.sendEvent(EventBlock, database.NewBlockData(block))
+}
+
+// fillGasLimit takes the transactions in order until the next one doesn't
+// fit in the gas left in the block. Smaller transactions after it can still
+// fill the block, but not ones from the same account since their nonce would
+// follow the transaction left out.
+func fillGasLimit(trans []database.BlockTx, limit uint64) []database.BlockTx {
+	var used uint64
+	skipped := make(map[database.AccountID]bool)
+
+	var fits []database.BlockTx
+	for _, tx := range trans {
+		if skipped[tx.FromID] {
+			continue
+		}
+
+		if tx.GasUnits > limit-used {
+			skipped[tx.FromID] = true
+			continue
+		}
+
+		used += tx.GasUnits
+		fits = append(fits, tx)
 	}
 
-	s.evHandler("viewer: block: %s", string(data))
+	return fits
 }
@@ -0,0 +1,217 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// Set of values used to deliver a block to the peers.
+const (
+	blockSendAttempts = 3                      // Attempts made to deliver a block to a peer.
+	blockSendBackoff  = 100 * time.Millisecond // Wait before the first retry, doubled after each one.
+	deliveredBlocks   = 64                     // Number of recent blocks the delivering peers are kept for.
+)
+
+// BlockDelivery represents the result of delivering a block to a peer.
+type BlockDelivery struct {
+	Host     string `json:"host"`
+	Attempts int    `json:"attempts"`
+	Skipped  bool   `json:"skipped,omitempty"` // The peer was known to have the block already.
+	Err      error  `json:"-"`
+}
+
+// BroadcastError is returned when a block couldn't be delivered to some of
+// the peers. The block was still delivered to the peers not listed.
+type BroadcastError struct {
+	Hash   string
+	Failed []BlockDelivery
+	Peers  int
+}
+
+// Error implements the error interface.
+func (be *BroadcastError) Error() string {
+	msgs := make([]string, len(be.Failed))
+	for i, d := range be.Failed {
+		msgs[i] = fmt.Sprintf("%s: %s", d.Host, d.Err)
+	}
+
+	return fmt.Sprintf("block %s not delivered to %d of %d peers: %s", be.Hash, len(be.Failed), be.Peers, strings.Join(msgs, ", "))
+}
+
+// NetSendBlockToPeers takes the new mined block and sends it to all known
+// peers at the same time. A failed delivery is retried with a growing wait
+// between attempts, and peers known to have the block already are skipped. A
+// BroadcastError is returned if the block didn't reach every peer.
+func (s *State) NetSendBlockToPeers(ctx context.Context, block database.Block) error {
+	s.evHandler("state: NetSendBlockToPeers: started")
+	defer s.evHandler("state: NetSendBlockToPeers: completed")
+
+	relay, err := s.newBlockRelay(block)
+	if err != nil {
+		return err
+	}
+	hash := relay.hash
+
+	peers := s.KnownExternalPeers()
+	deliveries := make([]BlockDelivery, len(peers))
+
+	var wg sync.WaitGroup
+	for i, pr := range peers {
+		if s.delivered.has(hash, pr.Host) {
+			s.evHandler("state: NetSendBlockToPeers: skip: block[%s] peer[%s] has the block", hash, pr)
+			deliveries[i] = BlockDelivery{Host: pr.Host, Skipped: true}
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, pr peer.Peer) {
+			defer wg.Done()
+			deliveries[i] = s.deliverBlock(ctx, relay, pr)
+		}(i, pr)
+	}
+	wg.Wait()
+
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	var failed []BlockDelivery
+	for _, d := range deliveries {
+		if d.Err != nil {
+			failed = append(failed, d)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &BroadcastError{Hash: hash, Failed: failed, Peers: len(peers)}
+	}
+
+	return nil
+}
+
+// BlockDeliveredTo returns the hosts of the peers known to have the block
+// with the specified hash, either because it was delivered to them or
+// because it was retrieved from them.
+func (s *State) BlockDeliveredTo(hash string) []string {
+	return s.delivered.hosts(hash)
+}
+
+// deliverBlock sends the block to the peer, retrying a failed delivery until
+// the attempts run out or the context is done. A peer that rejects the block
+// isn't retried since it would only reject it again.
+func (s *State) deliverBlock(ctx context.Context, relay blockRelay, pr peer.Peer) BlockDelivery {
+	hash := relay.hash
+	delivery := BlockDelivery{Host: pr.Host}
+
+	backoff := blockSendBackoff
+	for {
+		delivery.Attempts++
+
+		s.evHandler("state: NetSendBlockToPeers: send: block[%s] to peer[%s]: attempt[%d]", hash, pr, delivery.Attempts)
+
+		delivery.Err = s.proposeBlock(ctx, pr, relay)
+		if delivery.Err == nil {
+			s.delivered.record(hash, pr.Host)
+			return delivery
+		}
+
+		s.evHandler("state: NetSendBlockToPeers: send: block[%s] to peer[%s]: WARNING: %s", hash, pr, delivery.Err)
+
+		if delivery.Attempts >= blockSendAttempts || !retryable(delivery.Err) {
+			return delivery
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			delivery.Err = ctx.Err()
+			return delivery
+		}
+
+		backoff *= 2
+	}
+}
+
+// retryable reports if a failed request to a peer is worth trying again.
+// Requests the peer answered are only retried if the peer failed to handle
+// them, not if it refused them.
+func retryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	var se *statusError
+	if errors.As(err, &se) {
+		return se.StatusCode >= http.StatusInternalServerError
+	}
+
+	return true
+}
+
+// =============================================================================
+
+// blockDeliveries tracks which peers are known to have the recent blocks so
+// a block isn't sent to the same peer twice. The zero value is ready to use.
+type blockDeliveries struct {
+	mu     sync.Mutex
+	hashes []string // Order the blocks were recorded in, oldest first.
+	peers  map[string]map[string]struct{}
+}
+
+// record marks the peer as having the block with the specified hash.
+func (bd *blockDeliveries) record(hash string, host string) {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	if bd.peers == nil {
+		bd.peers = make(map[string]map[string]struct{})
+	}
+
+	hosts, exists := bd.peers[hash]
+	if !exists {
+		hosts = make(map[string]struct{})
+		bd.peers[hash] = hosts
+		bd.hashes = append(bd.hashes, hash)
+
+		if len(bd.hashes) > deliveredBlocks {
+			delete(bd.peers, bd.hashes[0])
+			bd.hashes = bd.hashes[1:]
+		}
+	}
+
+	hosts[host] = struct{}{}
+}
+
+// has reports if the peer is known to have the block with the specified hash.
+func (bd *blockDeliveries) has(hash string, host string) bool {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	_, exists := bd.peers[hash][host]
+	return exists
+}
+
+// hosts returns the sorted hosts known to have the block with the specified hash.
+func (bd *blockDeliveries) hosts(hash string) []string {
+	bd.mu.Lock()
+	defer bd.mu.Unlock()
+
+	hosts := make([]string, 0, len(bd.peers[hash]))
+	for host := range bd.peers[hash] {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+
+	return hosts
+}
@@ -0,0 +1,362 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// keptCheckpoints is the number of the latest checkpointed block numbers kept.
+const keptCheckpoints = 100
+
+// Set of actions reported for checkpoints.
+const (
+	CheckpointSigned   = "signed"   // This node signed a checkpoint.
+	CheckpointAdded    = "added"    // A checkpoint from a peer was accepted.
+	CheckpointConflict = "conflict" // A checkpoint contradicts another checkpoint or this node's chain.
+)
+
+// CheckpointEvent represents a checkpoint signed by this node, received from a
+// peer or found to contradict what this node already has. For a conflict, the
+// other hash is the hash of the other checkpoint or of this node's block.
+type CheckpointEvent struct {
+	Action    string             `json:"action"`
+	Signer    database.AccountID `json:"signer"`
+	Number    uint64             `json:"number"`
+	Hash      string             `json:"hash"`
+	OtherHash string             `json:"other_hash,omitempty"`
+}
+
+// CORE NOTE: A new node has no way to tell the real chain from a longer fake
+// chain built from an old point, since the validation rules alone accept
+// both. A set of keys the operators trust sign checkpoints, a block number and
+// hash, every configured number of blocks once the block is final. The
+// checkpoints are shared with the peers, and a node syncing from scratch
+// asks its peers for theirs before it downloads any block. A block that
+// contradicts a checkpoint is rejected, so the fake chain can't be followed
+// past it, and a reorganization never rolls back past a checkpoint.
+//
+// Two trusted keys signing different blocks for the same number means a key
+// is compromised, so neither checkpoint is enforced and the conflict is
+// reported. A checkpoint contradicting the chain this node already has is
+// reported as well, the node has to be resynced from a peer to correct it.
+
+// Checkpoints returns the checkpoints this node holds sorted by number.
+func (s *State) Checkpoints() []database.SignedCheckpoint {
+	return s.checkpoints.list()
+}
+
+// AddCheckpoint validates a checkpoint received from a peer and adds it to
+// the checkpoints this node enforces. A checkpoint that is new to this node
+// is shared with the peers.
+func (s *State) AddCheckpoint(sc database.SignedCheckpoint) error {
+	signer, err := sc.Signer(s.genesis.ChainID)
+	if err != nil {
+		return err
+	}
+
+	if !s.checkpoints.trusted(signer) {
+		return fmt.Errorf("checkpoint signer %s is not trusted", signer)
+	}
+
+	s.addCheckpoint(sc, signer, CheckpointAdded)
+
+	return nil
+}
+
+// NetSendCheckpointsToPeers shares the checkpoints that are new to this node
+// with the known peers.
+func (s *State) NetSendCheckpointsToPeers(ctx context.Context) {
+	checkpoints := s.checkpoints.takeUnshared()
+	if len(checkpoints) == 0 {
+		return
+	}
+
+	s.evHandler("state: NetSendCheckpointsToPeers: started")
+	defer s.evHandler("state: NetSendCheckpointsToPeers: completed")
+
+	for _, pr := range s.KnownExternalPeers() {
+		for _, sc := range checkpoints {
+			if ctx.Err() != nil {
+				return
+			}
+
+			s.evHandler("state: NetSendCheckpointsToPeers: send: blk[%d] to peer[%s]", sc.Number, pr)
+
+			url := fmt.Sprintf("%s/checkpoints", s.nodeURL(pr.Host))
+
+			if err := s.send(ctx, http.MethodPost, url, sc, nil); err != nil {
+				if notFound(err) {
+					break
+				}
+				s.evHandler("state: NetSendCheckpointsToPeers: WARNING: %s", err)
+			}
+		}
+	}
+}
+
+// NetRequestPeerCheckpoints asks the peer for its checkpoints and adds the
+// ones signed by a trusted key.
+func (s *State) NetRequestPeerCheckpoints(ctx context.Context, pr peer.Peer) error {
+	if !s.checkpoints.enabled() {
+		return nil
+	}
+
+	s.evHandler("state: NetRequestPeerCheckpoints: started: %s", pr)
+	defer s.evHandler("state: NetRequestPeerCheckpoints: completed: %s", pr)
+
+	url := fmt.Sprintf("%s/checkpoints", s.nodeURL(pr.Host))
+
+	var checkpoints []database.SignedCheckpoint
+	if err := s.send(ctx, http.MethodGet, url, nil, &checkpoints); err != nil {
+		if notFound(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, sc := range checkpoints {
+		if err := s.AddCheckpoint(sc); err != nil {
+			s.evHandler("state: NetRequestPeerCheckpoints: blk[%d]: WARNING: %s", sc.Number, err)
+		}
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// signCheckpoint signs a checkpoint for the latest final block when its
+// number is a multiple of the checkpoint interval and this node's account is
+// a trusted signer. Without finality the latest block is used. The caller
+// must hold the state lock.
+func (s *State) signCheckpoint() {
+	if s.checkpoints.interval == 0 || s.privateKey == nil || !s.checkpoints.trusted(s.beneficiaryID) {
+		return
+	}
+
+	num := s.finalizedNumber()
+	if s.finalityDepth == 0 {
+		num = s.db.LatestBlock().Header.Number
+	}
+
+	if num == 0 || num%s.checkpoints.interval != 0 {
+		return
+	}
+
+	if _, exists := s.checkpoints.hash(num); exists {
+		return
+	}
+
+	block, err := s.db.GetBlock(num)
+	if err != nil {
+		s.evHandler("state: signCheckpoint: blk[%d]: ERROR: %s", num, err)
+		return
+	}
+
+	sc, err := database.NewCheckpoint(block, uint64(time.Now().UTC().UnixMilli())).Sign(s.genesis.ChainID, s.privateKey)
+	if err != nil {
+		s.evHandler("state: signCheckpoint: blk[%d]: ERROR: %s", num, err)
+		return
+	}
+
+	s.addCheckpoint(sc, s.beneficiaryID, CheckpointSigned)
+}
+
+// addCheckpoint adds a checkpoint from a trusted signer and reports it along
+// with anything it contradicts.
+func (s *State) addCheckpoint(sc database.SignedCheckpoint, signer database.AccountID, action string) {
+	added, other, conflict := s.checkpoints.add(sc)
+
+	if conflict {
+		s.evHandler("state: addCheckpoint: CONFLICT: blk[%d]: signer[%s] hash[%s]: other checkpoint hash[%s]", sc.Number, signer, sc.Hash, other.Hash)
+		s.sendEvent(EventCheckpoint, CheckpointEvent{Action: CheckpointConflict, Signer: signer, Number: sc.Number, Hash: sc.Hash, OtherHash: other.Hash})
+		return
+	}
+
+	if !added {
+		return
+	}
+
+	s.evHandler("state: addCheckpoint: blk[%d]: signer[%s]: %s: hash[%s]", sc.Number, signer, action, sc.Hash)
+	s.sendEvent(EventCheckpoint, CheckpointEvent{Action: action, Signer: signer, Number: sc.Number, Hash: sc.Hash})
+
+	if sc.Number > s.db.LatestBlock().Header.Number {
+		return
+	}
+
+	block, err := s.db.GetBlock(sc.Number)
+	if err != nil || block.Hash() == sc.Hash {
+		return
+	}
+
+	s.evHandler("state: addCheckpoint: CONFLICT: blk[%d]: checkpoint hash[%s]: chain has hash[%s]", sc.Number, sc.Hash, block.Hash())
+	s.sendEvent(EventCheckpoint, CheckpointEvent{Action: CheckpointConflict, Signer: signer, Number: sc.Number, Hash: sc.Hash, OtherHash: block.Hash()})
+}
+
+// checkCheckpoint returns an error if there is a checkpoint for the block's
+// number with a different hash.
+func (s *State) checkCheckpoint(block database.Block) error {
+	hash, exists := s.checkpoints.hash(block.Header.Number)
+	if !exists || hash == block.Hash() {
+		return nil
+	}
+
+	return errcode.Errorf(errcode.InvalidBlock, "block %d with hash %s contradicts checkpoint hash %s", block.Header.Number, block.Hash(), hash)
+}
+
+// checkpointedNumber returns the number of the latest block in this node's
+// chain that matches a checkpoint, 0 if there isn't one.
+func (s *State) checkpointedNumber() uint64 {
+	latest := s.db.LatestBlock().Header.Number
+
+	checkpoints := s.checkpoints.list()
+	for i := len(checkpoints) - 1; i >= 0; i-- {
+		sc := checkpoints[i]
+		if sc.Number > latest {
+			continue
+		}
+
+		if hash, exists := s.checkpoints.hash(sc.Number); !exists || hash != sc.Hash {
+			continue
+		}
+
+		if block, err := s.db.GetBlock(sc.Number); err == nil && block.Hash() == sc.Hash {
+			return sc.Number
+		}
+	}
+
+	return 0
+}
+
+// =============================================================================
+
+// checkpointSet keeps the latest checkpoints by number and the keys trusted
+// to sign them.
+type checkpointSet struct {
+	mu         sync.Mutex
+	interval   uint64 // Number of blocks between the checkpoints this node signs.
+	signers    map[string]bool
+	byNumber   map[uint64]database.SignedCheckpoint
+	conflicted map[uint64]bool // Numbers with contradicting checkpoints, which aren't enforced.
+	unshared   []database.SignedCheckpoint
+}
+
+// newCheckpointSet constructs a set trusting the specified signers.
+func newCheckpointSet(signers []database.AccountID, interval uint64) *checkpointSet {
+	cs := checkpointSet{
+		interval:   interval,
+		signers:    make(map[string]bool, len(signers)),
+		byNumber:   make(map[uint64]database.SignedCheckpoint),
+		conflicted: make(map[uint64]bool),
+	}
+
+	for _, signer := range signers {
+		cs.signers[strings.ToLower(string(signer))] = true
+	}
+
+	return &cs
+}
+
+// enabled reports if any signer is trusted.
+func (cs *checkpointSet) enabled() bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return len(cs.signers) > 0
+}
+
+// trusted reports if the account is trusted to sign checkpoints.
+func (cs *checkpointSet) trusted(accountID database.AccountID) bool {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	return cs.signers[strings.ToLower(string(accountID))]
+}
+
+// add adds the checkpoint unless one is already held for the number. When
+// the one held has a different hash, it's returned and the number is no
+// longer enforced.
+func (cs *checkpointSet) add(sc database.SignedCheckpoint) (added bool, other database.SignedCheckpoint, conflict bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if existing, exists := cs.byNumber[sc.Number]; exists {
+		if existing.Hash == sc.Hash {
+			return false, database.SignedCheckpoint{}, false
+		}
+
+		if cs.conflicted[sc.Number] {
+			return false, database.SignedCheckpoint{}, false
+		}
+		cs.conflicted[sc.Number] = true
+
+		return false, existing, true
+	}
+
+	cs.byNumber[sc.Number] = sc
+	cs.unshared = append(cs.unshared, sc)
+
+	// Forget the oldest numbers once too many are kept.
+	if len(cs.byNumber) > keptCheckpoints {
+		var oldest uint64
+		first := true
+		for n := range cs.byNumber {
+			if first || n < oldest {
+				oldest = n
+				first = false
+			}
+		}
+		delete(cs.byNumber, oldest)
+		delete(cs.conflicted, oldest)
+	}
+
+	return true, database.SignedCheckpoint{}, false
+}
+
+// hash returns the hash enforced for the number.
+func (cs *checkpointSet) hash(num uint64) (string, bool) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	sc, exists := cs.byNumber[num]
+	if !exists || cs.conflicted[num] {
+		return "", false
+	}
+
+	return sc.Hash, true
+}
+
+// list returns the checkpoints sorted by number.
+func (cs *checkpointSet) list() []database.SignedCheckpoint {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	checkpoints := make([]database.SignedCheckpoint, 0, len(cs.byNumber))
+	for _, sc := range cs.byNumber {
+		checkpoints = append(checkpoints, sc)
+	}
+
+	sort.Slice(checkpoints, func(i, j int) bool { return checkpoints[i].Number < checkpoints[j].Number })
+
+	return checkpoints
+}
+
+// takeUnshared returns the checkpoints added since the last call.
+func (cs *checkpointSet) takeUnshared() []database.SignedCheckpoint {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	unshared := cs.unshared
+	cs.unshared = nil
+
+	return unshared
+}
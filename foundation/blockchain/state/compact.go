@@ -0,0 +1,171 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// Set of statuses a peer responds with when it receives a compact block.
+const (
+	CompactAccepted = "accepted"
+	CompactMissing  = "missing"
+	CompactKnown    = BlockKnown
+)
+
+// CompactBlockStatus represents the response of a peer to a compact block.
+// The hashes of the transactions the peer needs to rebuild the block are
+// provided when they are missing.
+type CompactBlockStatus struct {
+	Status  string   `json:"status"`
+	Missing []string `json:"missing,omitempty"`
+}
+
+// ProcessCompactBlock rebuilds a block received from a peer as a compact
+// block using the transactions in the mempool, then validates it and adds it
+// to the local blockchain. If transactions are missing, nothing is processed
+// and their hashes are returned so they can be asked for. A block that is
+// already in the chain isn't rebuilt.
+func (s *State) ProcessCompactBlock(cb database.CompactBlock) (CompactBlockStatus, error) {
+	if s.KnownBlock(database.Block{Header: cb.Header}) {
+		return CompactBlockStatus{Status: CompactKnown}, nil
+	}
+
+	pool := make(map[string]database.BlockTx)
+	for _, tx := range s.mempool.PickBest() {
+		pool[tx.TxHash()] = tx
+	}
+
+	lookup := func(hash string) (database.BlockTx, bool) {
+		tx, exists := pool[hash]
+		return tx, exists
+	}
+
+	if missing := cb.Missing(lookup); len(missing) > 0 {
+		s.evHandler("state: ProcessCompactBlock: blk[%d]: missing trans[%d] of [%d]", cb.Header.Number, len(missing), len(cb.TxHashes))
+		return CompactBlockStatus{Status: CompactMissing, Missing: missing}, nil
+	}
+
+	block, err := cb.ToBlock(lookup)
+	if err != nil {
+		return CompactBlockStatus{}, err
+	}
+
+	status, err := s.ProcessProposedBlock(block)
+	if err != nil {
+		return CompactBlockStatus{}, err
+	}
+
+	return CompactBlockStatus{Status: status}, nil
+}
+
+// =============================================================================
+
+// blockRelay represents a block prepared to be sent to the peers.
+type blockRelay struct {
+	hash    string
+	number  uint64
+	data    []byte                      // The full block using the binary encoding.
+	compact database.CompactBlock       // Only set when compact relay is turned on.
+	trans   map[string]database.BlockTx // Transactions in the block by hash.
+}
+
+// newBlockRelay prepares the block to be sent to the peers.
+func (s *State) newBlockRelay(block database.Block) (blockRelay, error) {
+	data, err := database.EncodeBlockData(database.NewBlockData(block))
+	if err != nil {
+		return blockRelay{}, err
+	}
+
+	relay := blockRelay{
+		hash:   block.Hash(),
+		number: block.Header.Number,
+		data:   data,
+	}
+
+	if s.compactRelay {
+		relay.compact = database.NewCompactBlock(block)
+		relay.trans = make(map[string]database.BlockTx)
+		for _, tx := range block.MerkleTree.Values() {
+			relay.trans[tx.TxHash()] = tx
+		}
+	}
+
+	return relay, nil
+}
+
+// proposeBlock announces the block to the peer and only sends it if the peer
+// wants it. The block is sent as a compact block when compact relay is turned
+// on. A peer that doesn't support announcements or compact blocks is sent the
+// full block.
+func (s *State) proposeBlock(ctx context.Context, pr peer.Peer, relay blockRelay) error {
+	announced, err := s.announceBlock(ctx, pr, relay)
+	switch {
+	case notFound(err):
+		s.evHandler("state: NetSendBlockToPeers: peer[%s] doesn't support block announcements", pr)
+
+	case err != nil:
+		return err
+
+	case announced != AnnounceWanted:
+		s.evHandler("state: NetSendBlockToPeers: peer[%s]: block[%s]: %s", pr, relay.hash, announced)
+		return nil
+	}
+
+	if s.compactRelay {
+		err := s.sendCompactBlock(ctx, pr, relay)
+		if !notFound(err) {
+			return err
+		}
+
+		s.evHandler("state: NetSendBlockToPeers: peer[%s] doesn't support compact blocks", pr)
+	}
+
+	url := fmt.Sprintf("%s/block/propose", s.nodeURL(pr.Host))
+
+	var status struct {
+		Status string `json:"status"`
+	}
+	return s.send(ctx, http.MethodPost, url, relay.data, &status)
+}
+
+// sendCompactBlock sends the compact block to the peer. If the peer is
+// missing transactions, the compact block is sent again with them included.
+func (s *State) sendCompactBlock(ctx context.Context, pr peer.Peer, relay blockRelay) error {
+	url := fmt.Sprintf("%s/block/compact", s.nodeURL(pr.Host))
+
+	var status CompactBlockStatus
+	if err := s.send(ctx, http.MethodPost, url, relay.compact, &status); err != nil {
+		return err
+	}
+
+	if status.Status != CompactMissing {
+		return nil
+	}
+
+	s.evHandler("state: NetSendBlockToPeers: peer[%s] is missing trans[%d]", pr, len(status.Missing))
+
+	cb := relay.compact
+	cb.Trans = make([]database.BlockTx, len(status.Missing))
+	for i, hash := range status.Missing {
+		tx, exists := relay.trans[hash]
+		if !exists {
+			return fmt.Errorf("peer asked for transaction %s which isn't in the block", hash)
+		}
+		cb.Trans[i] = tx
+	}
+
+	status = CompactBlockStatus{}
+	if err := s.send(ctx, http.MethodPost, url, cb, &status); err != nil {
+		return err
+	}
+
+	if status.Status == CompactMissing {
+		return fmt.Errorf("peer is still missing %d transactions", len(status.Missing))
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package state
+
+import "sync"
+
+// Set of values used to remember peer responses for conditional requests.
+const (
+	maxETags       = 256      // Number of responses remembered.
+	maxETagPayload = 64 << 10 // Size of the largest response remembered.
+)
+
+// CORE NOTE: Nodes keep polling their peers for the same status and blocks
+// and most of the time nothing changed since the last poll. The entity tag
+// of each response is remembered with its payload and sent back with the
+// next request for the same url. A peer with nothing new responds with 304
+// Not Modified and no body, and the remembered payload is used instead.
+
+// etagResponse represents a response remembered for its entity tag.
+type etagResponse struct {
+	etag    string
+	payload []byte
+}
+
+// peerETags maintains the latest response for the urls requested from peers.
+type peerETags struct {
+	mu        sync.Mutex
+	responses map[string]etagResponse
+}
+
+// get returns the response remembered for the url.
+func (pe *peerETags) get(url string) (etagResponse, bool) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	resp, exists := pe.responses[url]
+	return resp, exists
+}
+
+// set remembers the response for the url, replacing an older one. Responses
+// too large to keep aren't remembered and any space needed is made by
+// forgetting another url.
+func (pe *peerETags) set(url string, etag string, payload []byte) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if etag == "" || len(payload) > maxETagPayload {
+		delete(pe.responses, url)
+		return
+	}
+
+	if pe.responses == nil {
+		pe.responses = make(map[string]etagResponse)
+	}
+
+	if _, exists := pe.responses[url]; !exists && len(pe.responses) >= maxETags {
+		for key := range pe.responses {
+			delete(pe.responses, key)
+			break
+		}
+	}
+
+	pe.responses[url] = etagResponse{
+		etag:    etag,
+		payload: payload,
+	}
+}
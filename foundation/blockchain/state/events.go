@@ -0,0 +1,256 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+)
+
+// Set of event kinds sent to the event handler as "viewer: <kind>: <json>"
+// so applications can stream structured chain activity.
+const (
+	EventBlock      = "block"
+	EventMempool    = "mempool"
+	EventPeer       = "peer"
+	EventMining     = "mining"
+	EventSync       = "sync"
+	EventSpan       = "span"
+	EventReorg      = "reorg"
+	EventEvidence   = "evidence"
+	EventConfig     = "config"
+	EventProduction = "production"
+	EventWatch      = "watch"
+	EventCheckpoint = "checkpoint"
+	EventBalances   = "balances"
+)
+
+// Set of actions that change the mempool.
+const (
+	MempoolAdd     = "add"
+	MempoolMined   = "mined"
+	MempoolExpire  = "expire"
+	MempoolDrop    = "drop"
+	MempoolEvict   = "evict"
+	MempoolRestore = "restore"
+	MempoolCancel  = "cancel"
+	MempoolOrphan  = "orphan"
+)
+
+// Set of reasons a mining operation was abandoned.
+const (
+	MiningTimedOut  = "timeout"
+	MiningCancelled = "cancel"
+)
+
+// Set of actions reported while syncing with the peers.
+const (
+	SyncStart    = "start"
+	SyncProgress = "progress"
+	SyncComplete = "complete"
+	SyncFail     = "error"
+)
+
+// Set of actions that change the known peers.
+const (
+	PeerAdd    = "add"
+	PeerRemove = "remove"
+)
+
+// MempoolEvent represents a change to the mempool. Count is the number of
+// transactions in the mempool after the change.
+type MempoolEvent struct {
+	Action   string             `json:"action"`
+	TxHash   string             `json:"tx_hash,omitempty"`
+	FromID   database.AccountID `json:"from,omitempty"`
+	Nonce    uint64             `json:"nonce,omitempty"`
+	Removed  int                `json:"removed,omitempty"`
+	Restored int                `json:"restored,omitempty"`
+	Count    int                `json:"count"`
+}
+
+// MiningEvent represents a mining operation that was abandoned before the
+// block was solved. Duration is how long the block was mined for.
+type MiningEvent struct {
+	Action     string `json:"action"`
+	Block      uint64 `json:"block"`
+	Difficulty uint16 `json:"difficulty"`
+	Duration   int64  `json:"duration_ms"`
+	Timeout    int64  `json:"timeout_ms,omitempty"`
+}
+
+// PeerEvent represents a change to the known peers. Count is the number of
+// known peers after the change, including this node.
+type PeerEvent struct {
+	Action string `json:"action"`
+	Host   string `json:"host"`
+	Count  int    `json:"count"`
+}
+
+// SyncEvent represents the progress of syncing with the peers.
+type SyncEvent struct {
+	Action string `json:"action"`
+	SyncStatus
+}
+
+// ReorgEvent represents the blocks removed from the chain by a rollback. The
+// receipts for the transactions and the balances of the accounts reported
+// before the rollback may no longer be correct.
+type ReorgEvent struct {
+	From     uint64               `json:"from"` // Latest block before the rollback.
+	To       uint64               `json:"to"`   // Latest block after the rollback.
+	Reverted []RevertedBlock      `json:"reverted"`
+	Accounts []database.AccountID `json:"accounts"` // Accounts whose balances were changed by the reverted blocks.
+}
+
+// RevertedBlock represents a block removed from the chain by a rollback.
+type RevertedBlock struct {
+	Number   uint64   `json:"number"`
+	Hash     string   `json:"hash"`
+	TxHashes []string `json:"tx_hashes"`
+}
+
+// BalancesEvent represents the balances changed by a block added to the
+// chain. A block later reverted by a rollback is reported in a reorg event.
+type BalancesEvent struct {
+	Block   uint64                   `json:"block"`
+	Hash    string                   `json:"hash"`
+	Changes []database.BalanceChange `json:"changes"`
+}
+
+// ConfigEvent represents a change to the configuration of a running node.
+// Applied is false when the change was rejected, with the reason why.
+type ConfigEvent struct {
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+	Applied bool   `json:"applied"`
+	Reason  string `json:"reason,omitempty"`
+}
+
+// =============================================================================
+
+// ConfigChanged provides an event about a change to the configuration of the
+// running node, whether it was applied or rejected.
+func (s *State) ConfigChanged(ev ConfigEvent) {
+	s.sendEvent(EventConfig, ev)
+}
+
+// mempoolEvent provides a specific event about a change to the mempool for
+// application specific support.
+func (s *State) mempoolEvent(ev MempoolEvent) {
+	ev.Count = s.mempool.Count()
+	s.sendEvent(EventMempool, ev)
+}
+
+// mempoolTxEvent provides a mempool event for a single transaction.
+func (s *State) mempoolTxEvent(action string, tx database.BlockTx) {
+	s.mempoolEvent(MempoolEvent{
+		Action: action,
+		TxHash: tx.TxHash(),
+		FromID: tx.FromID,
+		Nonce:  tx.Nonce,
+	})
+}
+
+// mempoolAddEvent provides a specific event about a transaction added to the
+// mempool, reporting a cancellation as such.
+func (s *State) mempoolAddEvent(tx database.BlockTx) {
+	action := MempoolAdd
+	if tx.IsCancel() {
+		action = MempoolCancel
+	}
+
+	s.mempoolTxEvent(action, tx)
+}
+
+// miningEvent provides a specific event about an abandoned mining operation
+// for application specific support.
+func (s *State) miningEvent(ev MiningEvent) {
+	s.sendEvent(EventMining, ev)
+}
+
+// syncEvent provides a specific event about the progress of syncing with the
+// peers for application specific support.
+func (s *State) syncEvent(action string) {
+	s.sendEvent(EventSync, SyncEvent{Action: action, SyncStatus: s.SyncStatus()})
+}
+
+// reorgEvent provides a specific event about the blocks removed from the
+// chain by a rollback for application specific support.
+func (s *State) reorgEvent(from uint64, to uint64, blocks []database.Block) {
+	ev := ReorgEvent{
+		From:     from,
+		To:       to,
+		Reverted: make([]RevertedBlock, 0, len(blocks)),
+	}
+
+	seen := make(map[database.AccountID]bool)
+	account := func(accountID database.AccountID) {
+		if accountID != "" && !seen[accountID] {
+			seen[accountID] = true
+			ev.Accounts = append(ev.Accounts, accountID)
+		}
+	}
+
+	for _, block := range blocks {
+		rb := RevertedBlock{
+			Number:   block.Header.Number,
+			Hash:     block.Hash(),
+			TxHashes: []string{},
+		}
+
+		account(block.Header.BeneficiaryID)
+		for _, tx := range block.MerkleTree.Values() {
+			rb.TxHashes = append(rb.TxHashes, tx.TxHash())
+			account(tx.FromID)
+			account(tx.ToID)
+			account(tx.FeePayerID)
+		}
+
+		ev.Reverted = append(ev.Reverted, rb)
+	}
+
+	s.sendEvent(EventReorg, ev)
+}
+
+// peerEvent provides a specific event about a change to the known peers for
+// application specific support.
+func (s *State) peerEvent(action string, pr peer.Peer) {
+	ev := PeerEvent{
+		Action: action,
+		Host:   pr.Host,
+		Count:  len(s.knownPeers.Copy("")),
+	}
+
+	s.sendEvent(EventPeer, ev)
+}
+
+// sendEvent encodes the value and sends it to the event handler and the
+// sinks that want this kind of event.
+func (s *State) sendEvent(kind string, v any) {
+	data := sendEvent(s.evHandler, kind, v)
+	s.sinks.event(kind, v, data)
+}
+
+// SpanExporter returns an exporter that sends the completed spans to the
+// event handler as span events.
+func SpanExporter(ev EventHandler) tracing.Exporter {
+	return tracing.ExporterFunc(func(span tracing.SpanData) {
+		sendEvent(ev, EventSpan, span)
+	})
+}
+
+// sendEvent marshals the value and sends it to the event handler as an
+// event of the specified kind. The encoded value is returned.
+func sendEvent(ev EventHandler, kind string, v any) []byte {
+	data, err := json.Marshal(v)
+	if err != nil {
+		data = []byte(fmt.Sprintf("{error: %q}", err.Error()))
+	}
+
+	ev("viewer: %s: %s", kind, string(data))
+
+	return data
+}
@@ -0,0 +1,219 @@
+package state
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// Set of limits on what is kept to detect equivocation.
+const (
+	keptHeights  = 100 // Number of the latest block numbers the observed blocks are kept for.
+	keptEvidence = 100 // Number of the latest equivocations kept for the API.
+)
+
+// Equivocation represents evidence that an account produced two different
+// blocks for the same block number.
+type Equivocation struct {
+	Offender database.AccountID `json:"offender"`
+	Number   uint64             `json:"number"`
+	Hashes   []string           `json:"hashes"`
+	Evidence database.Evidence  `json:"evidence"`
+	Provable bool               `json:"provable"` // Both blocks are signed so the evidence can slash the offender's bond.
+	Observed time.Time          `json:"observed"`
+}
+
+// CORE NOTE: Every block this node mines or receives is remembered by its
+// number and beneficiary for a while, before it's validated, since a second
+// block for a number the chain already has is rejected as a fork. Only blocks
+// that prove who produced them are remembered: a PoS block must be signed by
+// its beneficiary and any other block must solve the puzzle at the chain's
+// difficulty. Otherwise anyone could frame an account by making up blocks.
+//
+// Under PoS both blocks are signed and the evidence can be carried by a bond
+// evidence operation to slash the offender. A node configured to slash
+// submits that transaction itself. Under PoW and PoA nothing is staked, so
+// the evidence is only recorded and reported.
+
+// Evidence returns the equivocations this node has observed, oldest first.
+func (s *State) Evidence() []Equivocation {
+	return s.observed.list()
+}
+
+// observeBlock remembers the block and records the evidence when the
+// beneficiary already produced a different block for the same number. This
+// is called without holding the state lock since slashing submits a
+// transaction.
+func (s *State) observeBlock(block database.Block) {
+	if !s.provesProducer(block) {
+		return
+	}
+
+	ev, found := s.observed.observe(block)
+	if !found {
+		return
+	}
+
+	s.evHandler("state: observeBlock: EQUIVOCATION: %s produced blks %v for number %d", ev.Offender, ev.Hashes, ev.Number)
+	s.sendEvent(EventEvidence, ev)
+
+	if s.slash && ev.Provable && s.privateKey != nil {
+		if err := s.submitEvidence(ev); err != nil {
+			s.evHandler("state: observeBlock: submit evidence: ERROR: %s", err)
+		}
+	}
+}
+
+// provesProducer reports if the block proves its beneficiary produced it.
+func (s *State) provesProducer(block database.Block) bool {
+	if block.Signature != "" {
+		signer, err := block.Signer(s.genesis.ChainID)
+		return err == nil && signer == block.Header.BeneficiaryID
+	}
+
+	// PoS blocks are always signed.
+	var difficulty uint16
+	switch s.Consensus() {
+	case ConsensusPOS:
+		return false
+	case ConsensusPOA:
+		difficulty = 1
+	default:
+		difficulty = s.genesis.Difficulty
+	}
+
+	return block.Header.Difficulty >= difficulty && block.IsSolved()
+}
+
+// submitEvidence sends a transaction from this node's account carrying the
+// evidence to slash the offender's bond.
+func (s *State) submitEvidence(ev Equivocation) error {
+	account, err := s.db.Query(s.beneficiaryID)
+	if err != nil {
+		return err
+	}
+
+	// Use the nonce after the transactions this node already has pending.
+	nonce := account.Nonce + 1
+	for {
+		if _, exists := s.mempool.Lookup(s.beneficiaryID, nonce); !exists {
+			break
+		}
+		nonce++
+	}
+
+	data, err := database.BondOp{Op: database.BondEvidence, Evidence: &ev.Evidence}.Data()
+	if err != nil {
+		return err
+	}
+
+	tx, err := database.NewTx(s.genesis.ChainID, nonce, s.beneficiaryID, ev.Offender, 0, 0, data)
+	if err != nil {
+		return err
+	}
+
+	signedTx, err := tx.Sign(s.privateKey)
+	if err != nil {
+		return err
+	}
+
+	if err := s.UpsertWalletTransaction(signedTx); err != nil {
+		return fmt.Errorf("slash %s: %w", ev.Offender, err)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// blockObserver remembers the recent blocks by number and beneficiary to find
+// the accounts that produced two blocks for the same number. The zero value is
+// ready to use.
+type blockObserver struct {
+	mu       sync.Mutex
+	blocks   map[uint64]map[database.AccountID]database.Block
+	reported map[uint64]map[database.AccountID]bool
+	evidence []Equivocation // Order the equivocations were found in, oldest first.
+}
+
+// observe remembers the block and returns the evidence the first time its
+// beneficiary is found to have produced a different block for the number.
+func (bo *blockObserver) observe(block database.Block) (Equivocation, bool) {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	if bo.blocks == nil {
+		bo.blocks = make(map[uint64]map[database.AccountID]database.Block)
+		bo.reported = make(map[uint64]map[database.AccountID]bool)
+	}
+
+	num := block.Header.Number
+	producer := block.Header.BeneficiaryID
+
+	if _, exists := bo.blocks[num]; !exists {
+		bo.blocks[num] = make(map[database.AccountID]database.Block)
+		bo.reported[num] = make(map[database.AccountID]bool)
+
+		// Forget the numbers that are too old to matter.
+		for n := range bo.blocks {
+			if n+keptHeights <= num {
+				delete(bo.blocks, n)
+				delete(bo.reported, n)
+			}
+		}
+	}
+
+	first, exists := bo.blocks[num][producer]
+	if !exists {
+		bo.blocks[num][producer] = block
+		return Equivocation{}, false
+	}
+
+	if first.Hash() == block.Hash() || bo.reported[num][producer] {
+		return Equivocation{}, false
+	}
+	bo.reported[num][producer] = true
+
+	ev := Equivocation{
+		Offender: producer,
+		Number:   num,
+		Hashes:   []string{first.Hash(), block.Hash()},
+		Evidence: database.Evidence{
+			First:  signedHeader(first),
+			Second: signedHeader(block),
+		},
+		Provable: first.Signature != "" && block.Signature != "",
+		Observed: time.Now().UTC(),
+	}
+
+	bo.evidence = append(bo.evidence, ev)
+	if len(bo.evidence) > keptEvidence {
+		bo.evidence = bo.evidence[len(bo.evidence)-keptEvidence:]
+	}
+
+	return ev, true
+}
+
+// list returns a copy of the evidence found.
+func (bo *blockObserver) list() []Equivocation {
+	bo.mu.Lock()
+	defer bo.mu.Unlock()
+
+	evidence := make([]Equivocation, len(bo.evidence))
+	copy(evidence, bo.evidence)
+
+	return evidence
+}
+
+// signedHeader returns the header of the block with its signature, leaving
+// the signature out when the block isn't signed.
+func signedHeader(block database.Block) database.SignedHeader {
+	sh, err := block.SignedHeader()
+	if err != nil {
+		return database.SignedHeader{Header: block.Header}
+	}
+
+	return sh
+}
@@ -0,0 +1,167 @@
+package state
+
+import (
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// feeWindow is the number of the most recent blocks looked at to estimate
+// the fees.
+const feeWindow = 20
+
+// FeeTier represents a suggested tip and how long a transaction offering it
+// is expected to wait before it's mined.
+type FeeTier struct {
+	Tip    uint64  `json:"tip"`
+	Blocks uint64  `json:"blocks"`    // Number of blocks expected before the transaction is mined.
+	Wait   float64 `json:"wait_secs"` // Expected time before the transaction is mined.
+}
+
+// FeeEstimate represents the suggested fees for a transaction submitted now.
+// The gas price and base fee are set by the chain, the tip is what decides
+// how soon a transaction is picked from the mempool.
+type FeeEstimate struct {
+	GasPrice uint64  `json:"gas_price"`
+	BaseFee  uint64  `json:"base_fee"`
+	Slow     FeeTier `json:"slow"`
+	Normal   FeeTier `json:"normal"`
+	Fast     FeeTier `json:"fast"`
+}
+
+// feeTarget represents the number of blocks a tier aims to be mined within
+// and the percentile of the recent blocks' lowest tips it needs to beat.
+type feeTarget struct {
+	blocks     uint64
+	percentile int
+}
+
+// Set of targets for the fee tiers.
+var (
+	feeTargetSlow   = feeTarget{blocks: 10, percentile: 25}
+	feeTargetNormal = feeTarget{blocks: 3, percentile: 50}
+	feeTargetFast   = feeTarget{blocks: 1, percentile: 90}
+)
+
+// CORE NOTE: Miners pick the transactions with the largest tips first, so
+// a tip only matters once there are more transactions than fit in a block.
+// What fits is measured in gas when there is a block gas limit and in the
+// number of transactions otherwise.
+//
+// The tip a tier needs is the larger of two views. The mempool view is the
+// tip needed to get ahead of the transactions already waiting for the number
+// of blocks the tier targets. The history view is the lowest tip that made
+// it into each recent full block, where a block that wasn't full counts as
+// zero since any tip would have made it in.
+
+// EstimateFee suggests the tips for slow, normal and fast inclusion based on
+// the recent blocks and the transactions waiting in the mempool.
+func (s *State) EstimateFee() FeeEstimate {
+	latest := s.db.LatestBlock()
+	nextBlock := latest.Header.Number + 1
+	gen := s.db.GenesisAt(nextBlock)
+
+	// The size of a transaction is how much of the block capacity it takes.
+	capacity := uint64(gen.TransPerBlock)
+	size := func(tx database.BlockTx) uint64 { return 1 }
+	if gen.BlockGasLimit > 0 {
+		capacity = gen.BlockGasLimit
+		size = func(tx database.BlockTx) uint64 { return s.db.GasUnits(tx.Tx, nextBlock) }
+	}
+	if capacity == 0 {
+		capacity = 1
+	}
+
+	// Collect the lowest tip mined into each of the recent blocks.
+	var floors []uint64
+	for num := latest.Header.Number; num > 0 && len(floors) < feeWindow; num-- {
+		block, err := s.db.GetBlock(num)
+		if err != nil {
+			s.evHandler("state: EstimateFee: ERROR: %s", err)
+			break
+		}
+		floors = append(floors, blockTipFloor(block, capacity, size))
+	}
+	sort.Slice(floors, func(i, j int) bool { return floors[i] < floors[j] })
+
+	// Collect the transactions waiting in the mempool from the largest tip
+	// to the smallest, the order miners pick them in.
+	pending := s.mempool.PickBest()
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Tip > pending[j].Tip })
+
+	interval := s.db.ChainStats().AvgBlockInterval
+
+	tier := func(target feeTarget) FeeTier {
+		tip := percentile(floors, target.percentile)
+
+		// Beat the transaction that fills the capacity of the blocks the
+		// tier targets.
+		var used uint64
+		for _, tx := range pending {
+			if used += size(tx); used >= target.blocks*capacity {
+				if tx.Tip+1 > tip {
+					tip = tx.Tip + 1
+				}
+				break
+			}
+		}
+
+		return FeeTier{
+			Tip:    tip,
+			Blocks: target.blocks,
+			Wait:   float64(target.blocks) * interval,
+		}
+	}
+
+	est := FeeEstimate{
+		GasPrice: gen.GasPrice,
+		BaseFee:  s.db.NextBaseFee(),
+		Slow:     tier(feeTargetSlow),
+		Normal:   tier(feeTargetNormal),
+		Fast:     tier(feeTargetFast),
+	}
+
+	// A faster tier never suggests a smaller tip than a slower one.
+	if est.Normal.Tip < est.Slow.Tip {
+		est.Normal.Tip = est.Slow.Tip
+	}
+	if est.Fast.Tip < est.Normal.Tip {
+		est.Fast.Tip = est.Normal.Tip
+	}
+
+	return est
+}
+
+// =============================================================================
+
+// blockTipFloor returns the lowest tip mined into the block when the block
+// was full and zero when it had room for more transactions.
+func blockTipFloor(block database.Block, capacity uint64, size func(tx database.BlockTx) uint64) uint64 {
+	trans := block.MerkleTree.Values()
+
+	var used uint64
+	for _, tx := range trans {
+		used += size(tx)
+	}
+	if used < capacity || len(trans) == 0 {
+		return 0
+	}
+
+	floor := trans[0].Tip
+	for _, tx := range trans[1:] {
+		if tx.Tip < floor {
+			floor = tx.Tip
+		}
+	}
+
+	return floor
+}
+
+// percentile returns the value at the percentile of the sorted values.
+func percentile(values []uint64, p int) uint64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	return values[(len(values)-1)*p/100]
+}
@@ -0,0 +1,158 @@
+package state
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// BlockBuffered is returned when a block received from a peer arrived before
+// its parent and is held until the parent is added.
+const BlockBuffered = "buffered"
+
+// Set of values used to hold blocks that arrive before their parent.
+const (
+	futureBlocksMax = 16               // Number of blocks held at once, the oldest is dropped first.
+	futureBlockTTL  = 30 * time.Second // How long a block is held waiting for its parent.
+)
+
+// errBlockFuture is returned by validateUpdateDatabase when the block is the
+// one after the next block and was held. It never leaves the package.
+var errBlockFuture = errors.New("block arrived before its parent")
+
+// =============================================================================
+
+// CORE NOTE: Blocks are sent to the peers as soon as they're mined, so block
+// N+2 can arrive before block N+1 when they were mined quickly one after the
+// other. Rejecting the early block means it has to be asked for again on the
+// next sync. Only the block right after the next block is held, a block
+// further ahead still means the chain has forked and the node resyncs.
+
+// applyFutureBlocks processes the held blocks built on top of the specified
+// block now that it has been added to the chain.
+func (s *State) applyFutureBlocks(parent database.Block) {
+	for _, block := range s.future.take(parent.Hash()) {
+		s.evHandler("state: applyFutureBlocks: blk[%d]: parent[%s]: apply held block", block.Header.Number, block.Header.PrevBlockHash)
+
+		if _, err := s.ProcessProposedBlock(block); err != nil {
+			s.evHandler("state: applyFutureBlocks: blk[%d]: WARNING: %s", block.Header.Number, err)
+		}
+	}
+}
+
+// =============================================================================
+
+// futureBlock represents a block held until its parent is added.
+type futureBlock struct {
+	block database.Block
+	added time.Time
+}
+
+// futureBlocks holds the blocks that arrived before their parent by the hash
+// of the parent. The zero value is ready to use.
+type futureBlocks struct {
+	mu     sync.Mutex
+	blocks map[string][]futureBlock
+	count  int
+}
+
+// add holds the block until its parent is added. A block already held is
+// ignored and the oldest block is dropped when the buffer is full.
+func (fb *futureBlocks) add(block database.Block, now time.Time) {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	if fb.blocks == nil {
+		fb.blocks = make(map[string][]futureBlock)
+	}
+
+	fb.expire(now)
+
+	parentHash := block.Header.PrevBlockHash
+	hash := block.Hash()
+	for _, held := range fb.blocks[parentHash] {
+		if held.block.Hash() == hash {
+			return
+		}
+	}
+
+	if fb.count >= futureBlocksMax {
+		fb.dropOldest()
+	}
+
+	fb.blocks[parentHash] = append(fb.blocks[parentHash], futureBlock{block: block, added: now})
+	fb.count++
+}
+
+// take removes and returns the blocks held for the parent with the specified
+// hash that haven't expired.
+func (fb *futureBlocks) take(parentHash string) []database.Block {
+	fb.mu.Lock()
+	defer fb.mu.Unlock()
+
+	fb.expire(time.Now())
+
+	held := fb.blocks[parentHash]
+	delete(fb.blocks, parentHash)
+	fb.count -= len(held)
+
+	blocks := make([]database.Block, len(held))
+	for i, f := range held {
+		blocks[i] = f.block
+	}
+
+	return blocks
+}
+
+// expire drops the blocks held longer than the TTL. The caller must hold
+// the lock.
+func (fb *futureBlocks) expire(now time.Time) {
+	for parentHash, held := range fb.blocks {
+		var keep []futureBlock
+		for _, f := range held {
+			if now.Sub(f.added) < futureBlockTTL {
+				keep = append(keep, f)
+			}
+		}
+
+		fb.count -= len(held) - len(keep)
+		switch len(keep) {
+		case 0:
+			delete(fb.blocks, parentHash)
+		default:
+			fb.blocks[parentHash] = keep
+		}
+	}
+}
+
+// dropOldest drops the block held the longest. The caller must hold the lock.
+func (fb *futureBlocks) dropOldest() {
+	var oldestParent string
+	var oldest int
+	var found bool
+
+	for parentHash, held := range fb.blocks {
+		for i, f := range held {
+			if !found || f.added.Before(fb.blocks[oldestParent][oldest].added) {
+				oldestParent, oldest, found = parentHash, i, true
+			}
+		}
+	}
+
+	if !found {
+		return
+	}
+
+	held := fb.blocks[oldestParent]
+	held = append(held[:oldest], held[oldest+1:]...)
+	fb.count--
+
+	switch len(held) {
+	case 0:
+		delete(fb.blocks, oldestParent)
+	default:
+		fb.blocks[oldestParent] = held
+	}
+}
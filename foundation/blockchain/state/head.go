@@ -0,0 +1,169 @@
+package state
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/mempool"
+)
+
+// CORE NOTE: The latest block is the head of the chain. Every change to the
+// head, a block mined by this node, a block from a peer or a rollback, is
+// made while holding the state lock and the mempool is reconciled before the
+// lock is released. A mined block and a block from a peer for the same height
+// can't both be applied, since the second one no longer builds on the head.
+// Transactions are only added to the mempool under the read lock, so a
+// transaction is either in the mempool when a block including it is applied
+// and is removed with the block, or it's checked against the accounts after
+// the block is applied and rejected.
+
+// ErrStaleNonce is returned when a transaction uses a nonce the account has
+// already used in a block.
+var ErrStaleNonce = errcode.New(errcode.BadNonce, "nonce already used")
+
+// ErrLowTip is returned when a transaction offers less than the minimum tip
+// this node accepts into its mempool.
+var ErrLowTip = errcode.New(errcode.Underpriced, "tip below the node's minimum")
+
+// addToMempool adds the transaction to the mempool unless the nonce has
+// already been used by the account, the tip is below the node's minimum, the
+// node's policy rejects it or it's signed with an encoding that isn't in effect yet. A transaction that was
+// already mined would fail again in the next block and charge its gas a
+// second time. A cancellation replaces the pending
+// transaction with the same nonce like any other transaction, as long as it
+// offers a high enough tip.
+func (s *State) addToMempool(tx database.BlockTx) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if err := s.admitTx(tx); err != nil {
+		return err
+	}
+
+	pending, replaces := s.mempool.Lookup(tx.FromID, tx.Nonce)
+
+	if err := s.mempool.Upsert(tx); err != nil {
+		if replaces && tx.IsCancel() {
+			return fmt.Errorf("cancel tx[%s]: %w: tip %d, need %d", pending, err, tx.Tip, mempool.MinReplacementTip(pending.Tip))
+		}
+		return err
+	}
+
+	if replaces && tx.IsCancel() && !pending.IsCancel() {
+		s.evHandler("state: addToMempool: tx[%s] cancelled: tip[%d]", pending, tx.Tip)
+	}
+
+	return nil
+}
+
+// admitTx checks the transaction can wait to be mined by this node. The
+// caller must hold the state lock.
+func (s *State) admitTx(tx database.BlockTx) error {
+	if account, err := s.db.Query(tx.FromID); err == nil && tx.Nonce <= account.Nonce {
+		return fmt.Errorf("%w: nonce %d, account nonce %d", ErrStaleNonce, tx.Nonce, account.Nonce)
+	}
+
+	// The node's own transactions, such as the evidence it submits, are
+	// accepted whatever the minimum.
+	if tx.Tip < s.minTip && tx.FromID != s.beneficiaryID {
+		return fmt.Errorf("%w: tip %d, need %d", ErrLowTip, tx.Tip, s.minTip)
+	}
+
+	if err := s.checkPolicy(tx); err != nil {
+		return err
+	}
+
+	// Peers that haven't switched to a newer encoding can't check the
+	// signature of a transaction signed with it.
+	if nextBlock := s.db.LatestBlock().Header.Number + 1; tx.Encoding > s.genesis.EncodingAt(nextBlock) {
+		canonical, _ := s.genesis.ForkBlock(genesis.ForkCanonicalEncoding)
+		return errcode.Errorf(errcode.InvalidTx, "transaction encoding %d is not in effect until block %d", tx.Encoding, canonical)
+	}
+
+	return nil
+}
+
+// reconcileMempool removes the transactions in the block from the mempool
+// along with any other transaction for the same accounts whose nonce has now
+// been used, such as a transaction replaced by the one in the block. The
+// caller must hold the state lock.
+func (s *State) reconcileMempool(block database.Block) {
+	txs := block.MerkleTree.Values()
+
+	nonces := make(map[database.AccountID]uint64)
+	for _, tx := range txs {
+		if account, err := s.db.Query(tx.FromID); err == nil {
+			nonces[tx.FromID] = account.Nonce
+		}
+	}
+
+	mined, evicted := s.mempool.Reconcile(txs, nonces)
+
+	if mined > 0 {
+		s.mempoolEvent(MempoolEvent{Action: MempoolMined, Removed: mined})
+	}
+
+	for _, tx := range evicted {
+		s.evHandler("state: reconcileMempool: evicted tx[%s]: nonce used by blk[%d]", tx, block.Header.Number)
+		s.mempoolTxEvent(MempoolEvict, tx)
+	}
+}
+
+// rollbackHead removes the blocks after the specified block and returns their
+// transactions to the mempool so they can be mined again. The caller must
+// hold the state lock.
+func (s *State) rollbackHead(num uint64) error {
+	var dropped []database.Block
+	for n := num + 1; n <= s.db.LatestBlock().Header.Number; n++ {
+		block, err := s.db.GetBlock(n)
+		if err != nil {
+			s.evHandler("state: rollbackHead: blk[%d]: ERROR: %s", n, err)
+			continue
+		}
+		dropped = append(dropped, block)
+	}
+
+	from := s.db.LatestBlock().Header.Number
+	if err := s.db.Rollback(context.Background(), num, s.evHandler); err != nil {
+		return err
+	}
+
+	// Report what was removed so applications can correct the receipts and
+	// balances they've shown, and keep the blocks so receipts for their
+	// transactions can still be looked up.
+	if len(dropped) > 0 {
+		s.reverted.add(dropped)
+		s.reorgEvent(from, num, dropped)
+	}
+
+	// Transactions that expired or whose nonce is still used by a remaining
+	// block can't be mined again. A transaction already in the mempool for
+	// the same nonce is kept unless the dropped one pays a better tip.
+	var restored int
+	for _, block := range dropped {
+		for _, tx := range block.MerkleTree.Values() {
+			if tx.IsExpired(num + 1) {
+				continue
+			}
+
+			if account, err := s.db.Query(tx.FromID); err == nil && tx.Nonce <= account.Nonce {
+				continue
+			}
+
+			if err := s.mempool.Upsert(tx); err != nil {
+				continue
+			}
+			restored++
+		}
+	}
+
+	if restored > 0 {
+		s.evHandler("state: rollbackHead: restored %d transactions", restored)
+		s.mempoolEvent(MempoolEvent{Action: MempoolRestore, Restored: restored})
+	}
+
+	return nil
+}
@@ -0,0 +1,260 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// CORE NOTE: The journal records every input that changes the state of the
+// node in the order it was applied. Replaying the journal against a fresh
+// node with the same genesis reproduces the chain, the accounts and the
+// mempool. Blocks this node mined are recorded with the solved header since
+// solving the puzzle again would produce a different block.
+
+// Set of kinds of inputs recorded in the journal.
+const (
+	JournalWalletTx   = "wallet_tx"
+	JournalNodeTx     = "node_tx"
+	JournalMempoolTx  = "mempool_tx"
+	JournalBlock      = "block"
+	JournalMinedBlock = "mined_block"
+	JournalMiningTick = "mining_tick"
+	JournalReorganize = "reorganize"
+	JournalPeerStatus = "peer_status"
+	JournalDropTx     = "drop_tx"
+)
+
+// journalTick represents the data recorded for a mining tick.
+type journalTick struct {
+	Block uint64 `json:"block"`
+}
+
+// journalReorganize represents the data recorded for a reorganization.
+type journalReorganize struct {
+	Finalized uint64 `json:"finalized"`
+}
+
+// journalPeerStatus represents the data recorded for a peer status response.
+type journalPeerStatus struct {
+	Peer   peer.Peer       `json:"peer"`
+	Status peer.PeerStatus `json:"status"`
+}
+
+// journalDropTx represents the data recorded for a transaction dropped by
+// an operator.
+type journalDropTx struct {
+	AccountID database.AccountID `json:"account"`
+	Nonce     uint64             `json:"nonce"`
+}
+
+// record writes the input to the journal if one is configured.
+func (s *State) record(entry journal.Entry, data any, err error) {
+	if s.journal == nil {
+		return
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := s.journal.Record(entry, data); err != nil {
+		s.evHandler("state: journal: %s: ERROR: %s", entry.Kind, err)
+	}
+}
+
+// recordBlock writes the block to the journal with the latest block after
+// the block was applied. The caller must hold the state lock.
+func (s *State) recordBlock(kind string, block database.Block, err error) {
+	if s.journal == nil {
+		return
+	}
+
+	s.record(journal.Entry{Kind: kind, Latest: s.db.LatestBlock().Hash()}, database.NewBlockData(block), err)
+}
+
+// =============================================================================
+
+// Divergence represents an input that produced a different result during
+// the replay than when it was recorded.
+type Divergence struct {
+	Seq  uint64 `json:"seq"`
+	Kind string `json:"kind"`
+	Exp  string `json:"exp"`
+	Got  string `json:"got"`
+}
+
+// ReplayResult represents the outcome of replaying a journal.
+type ReplayResult struct {
+	Entries     int          `json:"entries"`
+	LatestBlock uint64       `json:"latest_block"`
+	LatestHash  string       `json:"latest_hash"`
+	Divergences []Divergence `json:"divergences,omitempty"`
+}
+
+// Replay feeds the inputs recorded in the journal to the state in order and
+// reports every input that produced a different result. The state should be
+// fresh and use the same genesis as the node that recorded the journal. The
+// replay stops after the entry with the until sequence, 0 replays everything.
+func (s *State) Replay(ctx context.Context, r io.Reader, until uint64) (ReplayResult, error) {
+	s.evHandler("state: Replay: started")
+	defer s.evHandler("state: Replay: completed")
+
+	// Nothing is shared with peers or mined in the background while the
+	// inputs are replayed.
+	worker := s.Worker
+	s.Worker = replayWorker{}
+	defer func() {
+		s.Worker = worker
+	}()
+
+	errStop := errors.New("stop")
+
+	var result ReplayResult
+	err := journal.Read(r, func(entry journal.Entry) error {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+
+		if until != 0 && entry.Seq > until {
+			return errStop
+		}
+
+		result.Entries++
+
+		err := s.replayEntry(entry)
+		if errors.Is(err, errReplayDecode) {
+			return err
+		}
+
+		// Peer responses depend on the network and are not replayed.
+		if entry.Kind == JournalPeerStatus {
+			return nil
+		}
+
+		var got string
+		if err != nil {
+			got = err.Error()
+		}
+		if got != entry.Error {
+			result.Divergences = append(result.Divergences, Divergence{Seq: entry.Seq, Kind: entry.Kind, Exp: entry.Error, Got: got})
+			s.evHandler("state: Replay: seq[%d]: %s: DIVERGED: error exp[%s] got[%s]", entry.Seq, entry.Kind, entry.Error, got)
+		}
+
+		if entry.Latest != "" {
+			if latest := s.LatestBlock().Hash(); latest != entry.Latest {
+				result.Divergences = append(result.Divergences, Divergence{Seq: entry.Seq, Kind: entry.Kind, Exp: entry.Latest, Got: latest})
+				s.evHandler("state: Replay: seq[%d]: %s: DIVERGED: latest exp[%s] got[%s]", entry.Seq, entry.Kind, entry.Latest, latest)
+			}
+		}
+
+		return nil
+	})
+	if err != nil && !errors.Is(err, errStop) {
+		return ReplayResult{}, err
+	}
+
+	latest := s.LatestBlock()
+	result.LatestBlock = latest.Header.Number
+	result.LatestHash = latest.Hash()
+
+	return result, nil
+}
+
+// errReplayDecode marks an entry that can't be decoded which ends the replay.
+var errReplayDecode = errors.New("replay decode")
+
+// replayEntry applies the input recorded in the entry to the state.
+func (s *State) replayEntry(entry journal.Entry) error {
+	s.evHandler("state: Replay: seq[%d]: %s", entry.Seq, entry.Kind)
+
+	decode := func(v any) error {
+		if err := entry.Decode(v); err != nil {
+			return fmt.Errorf("%w: %s", errReplayDecode, err)
+		}
+		return nil
+	}
+
+	switch entry.Kind {
+	case JournalWalletTx:
+		var signedTx database.SignedTx
+		if err := decode(&signedTx); err != nil {
+			return err
+		}
+		return s.UpsertWalletTransaction(signedTx)
+
+	case JournalNodeTx, JournalMempoolTx:
+		var tx database.BlockTx
+		if err := decode(&tx); err != nil {
+			return err
+		}
+		if entry.Kind == JournalNodeTx {
+			return s.UpsertNodeTransaction(tx)
+		}
+		return s.UpsertMempool(tx)
+
+	case JournalBlock, JournalMinedBlock:
+		var blockData database.BlockData
+		if err := decode(&blockData); err != nil {
+			return err
+		}
+
+		block, err := database.ToBlock(blockData)
+		if err != nil {
+			return err
+		}
+
+		if entry.Kind == JournalBlock {
+			_, err := s.ProcessProposedBlock(block)
+			return err
+		}
+		return s.validateUpdateDatabase(context.Background(), block, JournalMinedBlock, false)
+
+	case JournalMiningTick:
+		var tick journalTick
+		if err := decode(&tick); err != nil {
+			return err
+		}
+		s.mempool.DeleteExpired(tick.Block)
+
+	case JournalReorganize:
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		return s.rollbackToFinalized()
+
+	case JournalDropTx:
+		var drop journalDropTx
+		if err := decode(&drop); err != nil {
+			return err
+		}
+		return s.DropMempoolTx(drop.AccountID, drop.Nonce)
+
+	case JournalPeerStatus:
+		// Peer responses are recorded for debugging. The blocks and
+		// transactions retrieved from peers are recorded as their own inputs.
+
+	default:
+		return fmt.Errorf("%w: unknown kind %q", errReplayDecode, entry.Kind)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// replayWorker implements the Worker interface and does nothing while a
+// journal is replayed.
+type replayWorker struct{}
+
+func (replayWorker) Shutdown()                              {}
+func (replayWorker) Sync()                                  {}
+func (replayWorker) SignalStartMining()                     {}
+func (replayWorker) SignalCancelMining()                    {}
+func (replayWorker) SignalShareTx(blockTx database.BlockTx) {}
+func (replayWorker) SignalShareVote(vote database.Vote)     {}
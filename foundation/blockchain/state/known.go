@@ -0,0 +1,95 @@
+package state
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// Set of statuses returned when a block received from a peer is processed.
+const (
+	BlockAccepted = "accepted"
+	BlockKnown    = "known"
+)
+
+// knownBlocks is the number of recent blocks the hashes are kept for.
+const knownBlocks = 64
+
+// errBlockKnown is returned by validateUpdateDatabase when the block is
+// already in the chain. It never leaves the package.
+var errBlockKnown = errors.New("block already known")
+
+// =============================================================================
+
+// KnownBlock reports if the block is already in the local blockchain, so a
+// block a peer sends again isn't processed twice.
+func (s *State) KnownBlock(block database.Block) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.knownBlock(block)
+}
+
+// knownBlock reports if the block is one of the recent blocks added to the
+// chain. A block seen before a reorganization may no longer be in the chain,
+// so the block at its number is checked before the block is trusted to be
+// known. The caller must hold the state lock.
+func (s *State) knownBlock(block database.Block) bool {
+	hash := block.Hash()
+
+	number, seen := s.seen.number(hash)
+	if !seen || number > s.db.LatestBlock().Header.Number {
+		return false
+	}
+
+	existing, err := s.db.GetBlock(number)
+	if err != nil {
+		return false
+	}
+
+	return existing.Hash() == hash
+}
+
+// =============================================================================
+
+// seenBlocks tracks the hashes of the recent blocks added to the chain. The
+// zero value is ready to use.
+type seenBlocks struct {
+	mu      sync.Mutex
+	hashes  []string // Order the blocks were recorded in, oldest first.
+	numbers map[string]uint64
+}
+
+// record marks the block as added to the chain.
+func (sb *seenBlocks) record(block database.Block) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	if sb.numbers == nil {
+		sb.numbers = make(map[string]uint64)
+	}
+
+	hash := block.Hash()
+	if _, exists := sb.numbers[hash]; exists {
+		return
+	}
+
+	sb.numbers[hash] = block.Header.Number
+	sb.hashes = append(sb.hashes, hash)
+
+	if len(sb.hashes) > knownBlocks {
+		delete(sb.numbers, sb.hashes[0])
+		sb.hashes = sb.hashes[1:]
+	}
+}
+
+// number returns the number of the block with the specified hash if the
+// block was seen.
+func (sb *seenBlocks) number(hash string) (uint64, bool) {
+	sb.mu.Lock()
+	defer sb.mu.Unlock()
+
+	number, exists := sb.numbers[hash]
+	return number, exists
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// Set of values used to pick the peers to sync with.
+const (
+	latencySamples = 10 // Number of the latest round trip times kept for each peer.
+	syncLagBlocks  = 2  // Number of blocks a peer can be behind the best peer and still count as up to date.
+)
+
+// PeerLatency represents the round trip times measured to a peer.
+type PeerLatency struct {
+	Avg     time.Duration
+	Min     time.Duration
+	Samples int
+}
+
+// CORE NOTE: Any peer that is ahead can serve the missing blocks, but on a
+// network spread around the world the peer on the other side of it takes far
+// longer to answer each request. The round trip time of every status request
+// is kept, and a sync downloads from the peers that are close to the best
+// reported block in order of their average latency. Peers that are further
+// behind are only used after that, highest block first.
+
+// PeerLatency returns the round trip times measured to the peer.
+func (s *State) PeerLatency(host string) PeerLatency {
+	return s.latency.stats(host)
+}
+
+// SyncOrder returns the peers in the order blocks should be downloaded from
+// them. Up to date peers come first with the nearest one first, followed by
+// the peers that are further behind. Peers that haven't reported a block are
+// left out.
+func (s *State) SyncOrder(peers []peer.Peer) []peer.Peer {
+	s.syncing.mu.Lock()
+	blocks := make(map[string]uint64, len(peers))
+	var best uint64
+	for _, pr := range peers {
+		if n, exists := s.syncing.peers[pr.Host]; exists {
+			blocks[pr.Host] = n
+			if n > best {
+				best = n
+			}
+		}
+	}
+	s.syncing.mu.Unlock()
+
+	type candidate struct {
+		pr       peer.Peer
+		block    uint64
+		upToDate bool
+		latency  PeerLatency
+	}
+
+	var candidates []candidate
+	for _, pr := range peers {
+		n, exists := blocks[pr.Host]
+		if !exists {
+			continue
+		}
+
+		candidates = append(candidates, candidate{
+			pr:       pr,
+			block:    n,
+			upToDate: n+syncLagBlocks >= best,
+			latency:  s.latency.stats(pr.Host),
+		})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		ci, cj := candidates[i], candidates[j]
+		switch {
+		case ci.upToDate != cj.upToDate:
+			return ci.upToDate
+
+		case !ci.upToDate:
+			return ci.block > cj.block
+
+		// A peer that was never measured goes after the measured ones.
+		case (ci.latency.Samples == 0) != (cj.latency.Samples == 0):
+			return ci.latency.Samples > 0
+		}
+
+		return ci.latency.Avg < cj.latency.Avg
+	})
+
+	ordered := make([]peer.Peer, len(candidates))
+	for i, c := range candidates {
+		ordered[i] = c.pr
+	}
+
+	return ordered
+}
+
+// =============================================================================
+
+// peerLatencies keeps the latest round trip times measured to each peer. The
+// zero value is ready to use.
+type peerLatencies struct {
+	mu      sync.Mutex
+	samples map[string][]time.Duration
+}
+
+// record adds the round trip time measured to the peer, dropping the oldest
+// one once the window is full.
+func (pl *peerLatencies) record(host string, rtt time.Duration) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	if pl.samples == nil {
+		pl.samples = make(map[string][]time.Duration)
+	}
+
+	samples := append(pl.samples[host], rtt)
+	if len(samples) > latencySamples {
+		samples = samples[len(samples)-latencySamples:]
+	}
+	pl.samples[host] = samples
+}
+
+// forget removes the round trip times measured to the peer.
+func (pl *peerLatencies) forget(host string) {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	delete(pl.samples, host)
+}
+
+// stats returns the average and minimum of the round trip times kept for
+// the peer.
+func (pl *peerLatencies) stats(host string) PeerLatency {
+	pl.mu.Lock()
+	defer pl.mu.Unlock()
+
+	samples := pl.samples[host]
+	if len(samples) == 0 {
+		return PeerLatency{}
+	}
+
+	var total time.Duration
+	lat := PeerLatency{Min: samples[0], Samples: len(samples)}
+	for _, rtt := range samples {
+		total += rtt
+		if rtt < lat.Min {
+			lat.Min = rtt
+		}
+	}
+	lat.Avg = total / time.Duration(len(samples))
+
+	return lat
+}
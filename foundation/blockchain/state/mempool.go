@@ -0,0 +1,229 @@
+package state
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// Set of fields the pending transactions can be sorted by.
+const (
+	MempoolSortTip   = "tip"
+	MempoolSortAge   = "age"
+	MempoolSortNonce = "nonce"
+	MempoolSortSize  = "size"
+)
+
+// Set of states explaining if a pending transaction can be mined into the
+// next block and if not, why.
+const (
+	PendingReady       = "ready"       // Can be mined into the next block.
+	PendingNonceGap    = "nonce_gap"   // Waits for a missing nonce from the same account.
+	PendingUnderpriced = "underpriced" // Gas price is below the base fee of the next block.
+	PendingExpired     = "expired"     // Can't be mined anymore and will be removed.
+)
+
+// MempoolFilter represents the filter, sort order and page used to query the
+// pending transactions.
+type MempoolFilter struct {
+	Account database.AccountID // Only transactions from, to or paid by the account.
+	Status  string             // Only transactions in this state, empty for all.
+	MinTip  uint64             // Only transactions with at least this tip.
+	SortBy  string             // Field to sort by, defaults to the tip.
+	Desc    bool               // Sort from the largest value to the smallest.
+	Offset  int                // Number of transactions to skip.
+	Cursor  string             // Next cursor from the previous page, used instead of the offset.
+	Limit   int                // Number of transactions returned, defaults to all up to 1000.
+}
+
+// PendingTx represents a transaction waiting in the mempool.
+type PendingTx struct {
+	TxHash   string             `json:"tx_hash"`
+	FromID   database.AccountID `json:"from"`
+	ToID     database.AccountID `json:"to"`
+	Nonce    uint64             `json:"nonce"`
+	Value    uint64             `json:"value"`
+	Tip      uint64             `json:"tip"`
+	GasPrice uint64             `json:"gas_price"`
+	Age      int64              `json:"age_ms"` // Time since the transaction was first received.
+	Size     int                `json:"size"`   // Size in bytes of the transaction as it's shared with peers.
+	Status   string             `json:"status"`
+}
+
+// MempoolPage represents a page of pending transactions.
+type MempoolPage struct {
+	Total   int         `json:"total"` // Number of transactions matching the filter.
+	BaseFee uint64      `json:"base_fee"`
+	Txs     []PendingTx `json:"txs"`
+	Next    string      `json:"next,omitempty"` // Cursor for the next page, empty on the last page.
+}
+
+// QueryMempool returns the pending transactions matching the filter along
+// with why each one can or can't be mined into the next block.
+func (s *State) QueryMempool(filter MempoolFilter) (MempoolPage, error) {
+	switch filter.SortBy {
+	case "":
+		filter.SortBy = MempoolSortTip
+	case MempoolSortTip, MempoolSortAge, MempoolSortNonce, MempoolSortSize:
+	default:
+		return MempoolPage{}, fmt.Errorf("unknown sort field %q", filter.SortBy)
+	}
+
+	switch filter.Status {
+	case "", PendingReady, PendingNonceGap, PendingUnderpriced, PendingExpired:
+	default:
+		return MempoolPage{}, fmt.Errorf("unknown status %q", filter.Status)
+	}
+
+	if filter.Offset < 0 {
+		return MempoolPage{}, fmt.Errorf("invalid page offset[%d]", filter.Offset)
+	}
+	if filter.Cursor == "" {
+		filter.Cursor = strconv.Itoa(filter.Offset)
+	}
+
+	nextBlock := s.db.LatestBlock().Header.Number + 1
+	baseFee := s.db.NextBaseFee()
+	now := time.Now()
+
+	// The status of a transaction depends on the other transactions from the
+	// same account, so all of them are looked at before filtering.
+	byAccount := make(map[database.AccountID][]database.BlockTx)
+	for _, tx := range s.mempool.PickBest() {
+		byAccount[tx.FromID] = append(byAccount[tx.FromID], tx)
+	}
+
+	var pending []PendingTx
+	for accountID, txs := range byAccount {
+		sort.Slice(txs, func(i, j int) bool {
+			return txs[i].Nonce < txs[j].Nonce
+		})
+
+		var nonce uint64
+		if account, err := s.db.Query(accountID); err == nil {
+			nonce = account.Nonce
+		}
+
+		// A transaction can only be mined once every earlier nonce has been.
+		gap := false
+		for _, tx := range txs {
+			if tx.Nonce != nonce+1 {
+				gap = true
+			}
+			nonce = tx.Nonce
+
+			status := PendingReady
+			switch {
+			case tx.IsExpired(nextBlock):
+				status = PendingExpired
+			case gap:
+				status = PendingNonceGap
+			case tx.GasPrice < baseFee:
+				status = PendingUnderpriced
+			}
+
+			if !matchMempool(filter, tx, status) {
+				continue
+			}
+
+			pending = append(pending, newPendingTx(tx, status, now))
+		}
+	}
+
+	sortPending(pending, filter.SortBy, filter.Desc)
+
+	txs, next, err := Paginate(pending, Page{Cursor: filter.Cursor, Limit: filter.Limit})
+	if err != nil {
+		return MempoolPage{}, err
+	}
+
+	page := MempoolPage{
+		Total:   len(pending),
+		BaseFee: baseFee,
+		Txs:     txs,
+		Next:    next,
+	}
+
+	return page, nil
+}
+
+// =============================================================================
+
+// matchMempool reports if the transaction in the specified state matches
+// the filter.
+func matchMempool(filter MempoolFilter, tx database.BlockTx, status string) bool {
+	if filter.Account != "" && filter.Account != tx.FromID && filter.Account != tx.ToID && filter.Account != tx.FeePayerID {
+		return false
+	}
+
+	if filter.Status != "" && filter.Status != status {
+		return false
+	}
+
+	return tx.Tip >= filter.MinTip
+}
+
+// newPendingTx constructs the pending view of the transaction.
+func newPendingTx(tx database.BlockTx, status string, now time.Time) PendingTx {
+	var age int64
+	if tx.TimeStamp > 0 {
+		age = now.Sub(time.UnixMilli(int64(tx.TimeStamp))).Milliseconds()
+		if age < 0 {
+			age = 0
+		}
+	}
+
+	var size int
+	if data, err := json.Marshal(tx); err == nil {
+		size = len(data)
+	}
+
+	return PendingTx{
+		TxHash:   tx.TxHash(),
+		FromID:   tx.FromID,
+		ToID:     tx.ToID,
+		Nonce:    tx.Nonce,
+		Value:    tx.Value,
+		Tip:      tx.Tip,
+		GasPrice: tx.GasPrice,
+		Age:      age,
+		Size:     size,
+		Status:   status,
+	}
+}
+
+// sortPending sorts the pending transactions by the field. Transactions with
+// the same value are kept in account and nonce order so pages are stable.
+func sortPending(pending []PendingTx, sortBy string, desc bool) {
+	value := func(tx PendingTx) int64 {
+		switch sortBy {
+		case MempoolSortAge:
+			return tx.Age
+		case MempoolSortNonce:
+			return int64(tx.Nonce)
+		case MempoolSortSize:
+			return int64(tx.Size)
+		default:
+			return int64(tx.Tip)
+		}
+	}
+
+	sort.Slice(pending, func(i, j int) bool {
+		vi, vj := value(pending[i]), value(pending[j])
+		if vi != vj {
+			if desc {
+				return vi > vj
+			}
+			return vi < vj
+		}
+
+		if pending[i].FromID != pending[j].FromID {
+			return pending[i].FromID < pending[j].FromID
+		}
+		return pending[i].Nonce < pending[j].Nonce
+	})
+}
@@ -2,41 +2,32 @@ package state
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	neturl "net/url"
+	"sync"
+	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/chaos"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 )
 
-const baseURL = "http://%s/v1/node"
-
-// NetSendBlockToPeers takes the new mined block and sends it to all know peers.
-func (s *State) NetSendBlockToPeers(block database.Block) error {
-	s.evHandler("state: NetSendBlockToPeers: started")
-	defer s.evHandler("state: NetSendBlockToPeers: completed")
-
-	for _, peer := range s.KnownExternalPeers() {
-		s.evHandler("state: NetSendBlockToPeers: send: block[%s] to peer[%s]", block.Hash(), peer)
-
-		url := fmt.Sprintf("%s/block/propose", fmt.Sprintf(baseURL, peer.Host))
-
-		var status struct {
-			Status string `json:"status"`
-		}
-		if err := send(http.MethodPost, url, database.NewBlockData(block), &status); err != nil {
-			return fmt.Errorf("%s: %s", peer.Host, err)
-		}
-	}
-
-	return nil
-}
+// Set of URLs the private node API of a peer is found at.
+const (
+	baseURL  = "http://%s/v1/node"
+	chainURL = "http://%s/v1/chains/%d/node" // Used when peers host more than one chain.
+)
 
 // NetSendTxToPeers shares a new block transaction with the known peers.
-func (s *State) NetSendTxToPeers(tx database.BlockTx) {
+func (s *State) NetSendTxToPeers(ctx context.Context, tx database.BlockTx) {
 	s.evHandler("state: NetSendTxToPeers: started")
 	defer s.evHandler("state: NetSendTxToPeers: completed")
 
@@ -48,11 +39,15 @@ func (s *State) NetSendTxToPeers(tx database.BlockTx) {
 
 	// For now, the Ardan blockchain just sends the full transaction.
 	for _, peer := range s.KnownExternalPeers() {
+		if ctx.Err() != nil {
+			return
+		}
+
 		s.evHandler("state: NetSendTxToPeers: send: tx[%s] to peer[%s]", tx, peer)
 
-		url := fmt.Sprintf("%s/tx/submit", fmt.Sprintf(baseURL, peer.Host))
+		url := fmt.Sprintf("%s/tx/submit", s.nodeURL(peer.Host))
 
-		if err := send(http.MethodPost, url, tx, nil); err != nil {
+		if err := s.send(ctx, http.MethodPost, url, tx, nil); err != nil {
 			s.evHandler("state: NetSendTxToPeers: WARNING: %s", err)
 		}
 	}
@@ -60,50 +55,79 @@ func (s *State) NetSendTxToPeers(tx database.BlockTx) {
 
 // NetSendNodeAvailableToPeers shares this node is available to
 // participate in the network with the known peers.
-func (s *State) NetSendNodeAvailableToPeers() {
+func (s *State) NetSendNodeAvailableToPeers(ctx context.Context) {
 	s.evHandler("state: NetSendNodeAvailableToPeers: started")
 	defer s.evHandler("state: NetSendNodeAvailableToPeers: completed")
 
-	host := peer.Peer{Host: s.Host()}
+	host := peer.Peer{Host: s.Host(), ID: s.nodeID}
+	if self, exists := s.knownPeers.Lookup(s.Host()); exists {
+		host.Addrs = self.Addrs
+	}
 
 	for _, peer := range s.KnownExternalPeers() {
+		if ctx.Err() != nil {
+			return
+		}
+
 		s.evHandler("state: NetSendNodeAvailableToPeers: send: host[%s] to peer[%s]", host, peer)
 
-		url := fmt.Sprintf("%s/peers", fmt.Sprintf(baseURL, peer.Host))
+		url := fmt.Sprintf("%s/peers", s.nodeURL(peer.Host))
 
-		if err := send(http.MethodPost, url, host, nil); err != nil {
+		if err := s.send(ctx, http.MethodPost, url, host, nil); err != nil {
 			s.evHandler("state: NetSendNodeAvailableToPeers: WARNING: %s", err)
 		}
 	}
 }
 
 // NetRequestPeerStatus looks for new nodes on the blockchain by asking
-// known nodes for their peer list. New nodes are added to the list.
-func (s *State) NetRequestPeerStatus(pr peer.Peer) (peer.PeerStatus, error) {
+// known nodes for their peer list. New nodes are added to the list. After
+// the first request, a peer that supports it only returns the peers changed
+// since the last one.
+func (s *State) NetRequestPeerStatus(ctx context.Context, pr peer.Peer) (peer.PeerStatus, error) {
 	s.evHandler("state: NetRequestPeerStatus: started: %s", pr)
 	defer s.evHandler("state: NetRequestPeerStatus: completed: %s", pr)
 
-	url := fmt.Sprintf("%s/status", fmt.Sprintf(baseURL, pr.Host))
+	url := fmt.Sprintf("%s/status", s.nodeURL(pr.Host))
+	if token := s.peerTokens.get(pr.Host); token != "" {
+		url += "?since=" + neturl.QueryEscape(token)
+	}
 
 	var ps peer.PeerStatus
-	if err := send(http.MethodGet, url, nil, &ps); err != nil {
+	start := time.Now()
+	err := s.send(ctx, http.MethodGet, url, nil, &ps)
+	rtt := time.Since(start)
+	s.record(journal.Entry{Kind: JournalPeerStatus}, journalPeerStatus{Peer: pr, Status: ps}, err)
+	if err != nil {
 		return peer.PeerStatus{}, err
 	}
+	s.latency.record(pr.Host, rtt)
+	s.peerTokens.set(pr.Host, ps.PeersToken)
+
+	// Nodes running an older version don't report their chain id.
+	if ps.ChainID != 0 && ps.ChainID != s.genesis.ChainID {
+		return peer.PeerStatus{}, fmt.Errorf("peer is on chain id %d, exp[%d]", ps.ChainID, s.genesis.ChainID)
+	}
+
+	// Remember who the peer is so it's recognized at other addresses.
+	if ps.NodeID != "" && ps.NodeID != pr.ID {
+		s.knownPeers.Add(peer.Peer{Host: pr.Host, ID: ps.NodeID})
+	}
 
-	s.evHandler("state: NetRequestPeerStatus: peer-node[%s]: latest-blknum[%d]: peer-list[%s]", pr, ps.LatestBlockNumber, ps.KnownPeers)
+	s.evHandler("state: NetRequestPeerStatus: peer-node[%s]: latest-blknum[%d]: rtt[%s]: peer-list[%s]", pr, ps.LatestBlockNumber, rtt, ps.KnownPeers)
+	s.peerBlock(pr.Host, ps.LatestBlockNumber)
 
 	return ps, nil
 }
 
 // NetRequestPeerMempool asks the peer for the transactions in their mempool.
-func (s *State) NetRequestPeerMempool(pr peer.Peer) ([]database.BlockTx, error) {
+func (s *State) NetRequestPeerMempool(ctx context.Context, pr peer.Peer) ([]database.BlockTx, error) {
 	s.evHandler("state: NetRequestPeerMempool: started: %s", pr)
 	defer s.evHandler("state: NetRequestPeerMempool: completed: %s", pr)
 
-	url := fmt.Sprintf("%s/tx/list", fmt.Sprintf(baseURL, pr.Host))
+	url := fmt.Sprintf("%s/tx/list", s.nodeURL(pr.Host))
 
 	var mempool []database.BlockTx
-	if err := send(http.MethodGet, url, nil, &mempool); err != nil {
+	if err := s.send(ctx, http.MethodGet, url, nil, &mempool); err != nil {
 		return nil, err
 	}
 
@@ -113,8 +137,9 @@ func (s *State) NetRequestPeerMempool(pr peer.Peer) ([]database.BlockTx, error)
 }
 
 // NetRequestPeerBlocks queries the specified node asking for blocks this node does
-// not have, then writes them to disk.
-func (s *State) NetRequestPeerBlocks(pr peer.Peer) error {
+// not have, then writes them to disk. The blocks from a peer trusted for a fast
+// sync skip the expensive block rules.
+func (s *State) NetRequestPeerBlocks(ctx context.Context, pr peer.Peer) error {
 	s.evHandler("state: NetRequestPeerBlocks: started: %s", pr)
 	defer s.evHandler("state: NetRequestPeerBlocks: completed: %s", pr)
 
@@ -130,78 +155,283 @@ func (s *State) NetRequestPeerBlocks(pr peer.Peer) error {
 	// does take place as each full block is downloaded from peers.
 
 	from := s.LatestBlock().Header.Number + 1
-	url := fmt.Sprintf("%s/block/list/%d/latest", fmt.Sprintf(baseURL, pr.Host), from)
+	url := fmt.Sprintf("%s/block/list/%d/latest", s.nodeURL(pr.Host), from)
+
+	var data []byte
+	if err := s.send(ctx, http.MethodGet, url, nil, &data); err != nil {
+		return err
+	}
+
+	// The peer has no blocks for us.
+	if len(data) == 0 {
+		return nil
+	}
 
-	var blocksData []database.BlockData
-	if err := send(http.MethodGet, url, nil, &blocksData); err != nil {
+	// Peers that don't support the binary encoding respond with json which
+	// is also handled here.
+	blocksData, err := database.DecodeBlocksData(data)
+	if err != nil {
 		return err
 	}
 
 	s.evHandler("state: NetRequestPeerBlocks: found blocks[%d]", len(blocksData))
 
 	for _, blockData := range blocksData {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
 		block, err := database.ToBlock(blockData)
 		if err != nil {
 			return err
 		}
 
-		if err := s.ProcessProposedBlock(block); err != nil {
+		if _, err := s.processBlock(block, s.trustedPeers[pr.Host]); err != nil {
 			return err
 		}
+
+		s.delivered.record(block.Hash(), pr.Host)
+		s.syncProgress()
 	}
 
 	return nil
 }
 
+// statusError is returned when a peer responds to a request with a status
+// other than success. The error message is the body of the response.
+type statusError struct {
+	StatusCode int
+	msg        string
+}
+
+// Error implements the error interface.
+func (se *statusError) Error() string {
+	return se.msg
+}
+
+// nodeURL returns the base URL of the private node API of the peer at the
+// host, scoped to this node's chain when configured.
+func (s *State) nodeURL(host string) string {
+	if s.chainScoped {
+		return fmt.Sprintf(chainURL, host, s.genesis.ChainID)
+	}
+
+	return fmt.Sprintf(baseURL, host)
+}
+
+// notFound reports if the error is a peer responding that the endpoint
+// doesn't exist, which happens with peers running an older version.
+func notFound(err error) bool {
+	var se *statusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusNotFound
+}
+
 // =============================================================================
 
-// send is a helper function to send an HTTP request to a node.
-func send(method string, url string, dataSend any, dataRecv any) error {
-	var req *http.Request
+// send is a helper function to send an HTTP request to a node using the
+// configured transport. The request is abandoned when the context is done.
+// If dataSend is a slice of bytes, it is sent using the binary encoding
+// content type. If dataRecv is a pointer to a slice of bytes,
+// the binary encoding is requested and the raw response is returned. The
+// trace context is passed to the peer so its spans join the same trace.
+// Requests are sent in an envelope and an enveloped response is requested,
+// so a truncated or corrupted message is rejected before it's decoded. When
+// the peer can't be reached, its other addresses are tried in order. A GET
+// request is made conditional on the entity tag of the last response for the
+// url, which is used again if the peer says nothing changed.
+func (s *State) send(ctx context.Context, method string, url string, dataSend any, dataRecv any) (err error) {
+	ctx, span := s.tracer.Start(ctx, "peer.send", tracing.String("method", method))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+
+	if s.faults.DropRequest() {
+		s.evHandler("state: send: CHAOS: dropped request: %s", url)
+		return chaos.ErrDropped
+	}
 
-	switch {
-	case dataSend != nil:
-		data, err := json.Marshal(dataSend)
-		if err != nil {
+	var envelope []byte
+
+	switch v := dataSend.(type) {
+	case nil:
+
+	default:
+		payloadType := peer.PayloadBinary
+		data, ok := v.([]byte)
+		if !ok {
+			payloadType = peer.PayloadJSON
+			if data, err = json.Marshal(dataSend); err != nil {
+				return err
+			}
+		}
+
+		if envelope, err = peer.SealEnvelope(payloadType, data); err != nil {
 			return err
 		}
-		req, err = http.NewRequest(method, url, bytes.NewReader(data))
+	}
+
+	accept := peer.EnvelopeContentType
+	if _, ok := dataRecv.(*[]byte); ok {
+		accept = database.BinaryContentType + ", " + accept
+	}
+
+	target, err := neturl.Parse(url)
+	if err != nil {
+		return err
+	}
+
+	span.SetAttributes(tracing.String("peer", target.Host), tracing.String("path", target.Path))
+
+	var cached etagResponse
+	var conditional bool
+	if method == http.MethodGet && dataRecv != nil {
+		cached, conditional = s.etags.get(url)
+	}
+
+	// Construct the request for the peer at one of its addresses.
+	newRequest := func(addr string) (*http.Request, error) {
+		target.Host = addr
+
+		var body io.Reader
+		if envelope != nil {
+			body = bytes.NewReader(envelope)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), body)
 		if err != nil {
+			return nil, err
+		}
+
+		if envelope != nil {
+			req.Header.Set("Content-Type", peer.EnvelopeContentType)
+		}
+		req.Header.Set("Accept", accept)
+		if conditional {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		tracing.Inject(ctx, req.Header)
+
+		return req, nil
+	}
+
+	var req *http.Request
+	var resp *http.Response
+	host, addrs := s.peerAddresses(target.Host)
+	for i, addr := range addrs {
+		if req, err = newRequest(addr); err != nil {
 			return err
 		}
 
-	default:
-		var err error
-		req, err = http.NewRequest(method, url, nil)
-		if err != nil {
+		resp, err = s.client.Do(req)
+		if err == nil {
+			s.addrs.use(host, addr)
+			s.scorePeer(host, true)
+			break
+		}
+
+		// A request abandoned by this node says nothing about the peer.
+		if ctx.Err() != nil {
 			return err
 		}
-	}
 
-	var client http.Client
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+		if i == len(addrs)-1 {
+			s.scorePeer(host, false)
+			return errcode.Wrap(errcode.PeerUnreachable, err)
+		}
+		s.evHandler("state: send: peer %s unreachable at %s, trying %s: %s", host, addr, addrs[i+1], err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNoContent {
+	span.SetAttributes(tracing.Int("status", resp.StatusCode))
+
+	var payload []byte
+
+	switch {
+	case resp.StatusCode == http.StatusNoContent:
 		return nil
-	}
 
-	if resp.StatusCode != http.StatusOK {
+	case resp.StatusCode == http.StatusNotModified && conditional:
+		payload = cached.payload
+
+	case resp.StatusCode != http.StatusOK:
 		msg, err := io.ReadAll(resp.Body)
 		if err != nil {
 			return err
 		}
-		return errors.New(string(msg))
+		return &statusError{StatusCode: resp.StatusCode, msg: string(msg)}
+
+	case dataRecv == nil:
+		return nil
+
+	// A peer running an older version doesn't send an envelope.
+	case resp.Header.Get("Content-Type") == peer.EnvelopeContentType:
+		if _, payload, err = peer.ReadEnvelope(resp.Body); err != nil {
+			return fmt.Errorf("%s: %w", req.URL.Host, err)
+		}
+
+	default:
+		if payload, err = io.ReadAll(io.LimitReader(resp.Body, peer.MaxPayloadSize)); err != nil {
+			return err
+		}
+	}
+
+	if method == http.MethodGet && resp.StatusCode == http.StatusOK {
+		s.etags.set(url, resp.Header.Get("ETag"), payload)
 	}
 
-	if dataRecv != nil {
-		if err := json.NewDecoder(resp.Body).Decode(dataRecv); err != nil {
+	switch v := dataRecv.(type) {
+	case *[]byte:
+		*v = payload
+
+	default:
+		if err := json.Unmarshal(payload, dataRecv); err != nil {
 			return err
 		}
 	}
 
 	return nil
 }
+
+// =============================================================================
+
+// peerTokens maintains the token each peer handed out with its last status
+// to ask for only the peers changed since then.
+type peerTokens struct {
+	mu     sync.Mutex
+	tokens map[string]string
+}
+
+// get returns the token handed out by the peer.
+func (pt *peerTokens) get(host string) string {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	return pt.tokens[host]
+}
+
+// set remembers the token handed out by the peer. A peer running an older
+// version doesn't hand out a token.
+func (pt *peerTokens) set(host string, token string) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if token == "" {
+		delete(pt.tokens, host)
+		return
+	}
+
+	if pt.tokens == nil {
+		pt.tokens = make(map[string]string)
+	}
+	pt.tokens[host] = token
+}
+
+// reset forgets the tokens of all the peers so the next status from each
+// peer returns all of its peers again.
+func (pt *peerTokens) reset() {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.tokens = nil
+}
@@ -0,0 +1,190 @@
+package state
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// Set of values used to hold transactions whose payer isn't known yet.
+const (
+	orphanTxsMax = 256              // Number of transactions held at once, the oldest is dropped first.
+	orphanTxTTL  = 10 * time.Minute // How long a transaction is held waiting for its payer.
+)
+
+// =============================================================================
+
+// CORE NOTE: A transaction from a peer can arrive before the block with the
+// transaction that funds its payer, which is common for a new account on a
+// busy network. Mined before the payer exists, the transaction fails without
+// paying anything and is lost. These transactions are held as orphans outside
+// the mempool and looked at again after each block. Transactions waiting on a
+// missing nonce from a known account already wait in the mempool.
+
+// Orphans returns a copy of the transactions held until their payer exists.
+func (s *State) Orphans() []database.BlockTx {
+	return s.orphans.copy()
+}
+
+// holdOrphan holds the transaction from a peer if the account paying for it
+// doesn't exist yet. The transaction must pass the same checks as one added
+// to the mempool.
+func (s *State) holdOrphan(tx database.BlockTx) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if _, err := s.db.Query(payer(tx)); err == nil {
+		return false, nil
+	}
+
+	if err := s.admitTx(tx); err != nil {
+		return false, err
+	}
+
+	s.orphans.add(tx, time.Now())
+
+	return true, nil
+}
+
+// promoteOrphans moves the orphans whose payer now exists into the mempool
+// and drops the ones that can't be mined anymore. The caller must hold the
+// state lock.
+func (s *State) promoteOrphans(block database.Block) {
+	nextBlock := block.Header.Number + 1
+
+	ready := func(tx database.BlockTx) bool {
+		_, err := s.db.Query(payer(tx))
+		return err == nil
+	}
+
+	promoted, dropped := s.orphans.take(ready, func(tx database.BlockTx) bool {
+		return tx.IsExpired(nextBlock)
+	}, time.Now())
+
+	if dropped > 0 {
+		s.evHandler("state: promoteOrphans: dropped %d orphan transactions", dropped)
+	}
+
+	for _, tx := range promoted {
+		if account, err := s.db.Query(tx.FromID); err == nil && tx.Nonce <= account.Nonce {
+			continue
+		}
+
+		if err := s.mempool.Upsert(tx); err != nil {
+			s.evHandler("state: promoteOrphans: tx[%s]: WARNING: %s", tx, err)
+			continue
+		}
+
+		s.evHandler("state: promoteOrphans: tx[%s]: payer exists after blk[%d]", tx, block.Header.Number)
+		s.mempoolAddEvent(tx)
+	}
+}
+
+// payer returns the account paying the fees for the transaction.
+func payer(tx database.BlockTx) database.AccountID {
+	if tx.IsSponsored() {
+		return tx.FeePayerID
+	}
+
+	return tx.FromID
+}
+
+// =============================================================================
+
+// orphanTx represents a transaction held until its payer exists.
+type orphanTx struct {
+	tx    database.BlockTx
+	added time.Time
+}
+
+// orphanPool holds the transactions whose payer doesn't exist yet by account
+// and nonce. The zero value is ready to use.
+type orphanPool struct {
+	mu  sync.Mutex
+	txs map[string]orphanTx
+}
+
+// add holds the transaction, replacing one held for the same account and
+// nonce. The oldest transaction is dropped when the pool is full.
+func (op *orphanPool) add(tx database.BlockTx, now time.Time) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	if op.txs == nil {
+		op.txs = make(map[string]orphanTx)
+	}
+
+	key := orphanKey(tx)
+	if _, exists := op.txs[key]; !exists && len(op.txs) >= orphanTxsMax {
+		var oldestKey string
+		var oldest time.Time
+		for k, o := range op.txs {
+			if oldestKey == "" || o.added.Before(oldest) {
+				oldestKey, oldest = k, o.added
+			}
+		}
+		delete(op.txs, oldestKey)
+	}
+
+	op.txs[key] = orphanTx{tx: tx, added: now}
+}
+
+// take removes and returns the transactions that are ready, sorted by nonce,
+// and drops the ones that are expired or held longer than the TTL. The
+// number of transactions dropped is returned.
+func (op *orphanPool) take(ready func(database.BlockTx) bool, expired func(database.BlockTx) bool, now time.Time) ([]database.BlockTx, int) {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	var txs []database.BlockTx
+	var dropped int
+
+	for key, o := range op.txs {
+		switch {
+		case now.Sub(o.added) >= orphanTxTTL || expired(o.tx):
+			delete(op.txs, key)
+			dropped++
+
+		case ready(o.tx):
+			delete(op.txs, key)
+			txs = append(txs, o.tx)
+		}
+	}
+
+	sortByNonce(txs)
+
+	return txs, dropped
+}
+
+// copy returns the transactions held, sorted by nonce.
+func (op *orphanPool) copy() []database.BlockTx {
+	op.mu.Lock()
+	defer op.mu.Unlock()
+
+	txs := make([]database.BlockTx, 0, len(op.txs))
+	for _, o := range op.txs {
+		txs = append(txs, o.tx)
+	}
+
+	sortByNonce(txs)
+
+	return txs
+}
+
+// orphanKey returns the key for the transaction's account and nonce.
+func orphanKey(tx database.BlockTx) string {
+	return string(tx.FromID) + ":" + strconv.FormatUint(tx.Nonce, 10)
+}
+
+// sortByNonce sorts the transactions by account and then nonce.
+func sortByNonce(txs []database.BlockTx) {
+	sort.Slice(txs, func(i, j int) bool {
+		if txs[i].FromID != txs[j].FromID {
+			return txs[i].FromID < txs[j].FromID
+		}
+		return txs[i].Nonce < txs[j].Nonce
+	})
+}
@@ -0,0 +1,171 @@
+package state
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// maxPageLimit is the largest page of any list returned.
+const maxPageLimit = 1000
+
+// ErrInvalidCursor is returned when a page cursor wasn't returned by a
+// previous page of the same list.
+var ErrInvalidCursor = errors.New("invalid page cursor")
+
+// Page represents the position and size of a page of a list. Every page
+// returns the cursor to fetch the page after it.
+type Page struct {
+	Cursor string // Next cursor from the previous page, empty for the first page.
+	Limit  int    // Number of items returned, defaults to all up to 1000.
+}
+
+// size returns the number of items the page holds.
+func (p Page) size() (int, error) {
+	switch {
+	case p.Limit < 0:
+		return 0, fmt.Errorf("invalid page limit[%d]", p.Limit)
+	case p.Limit == 0 || p.Limit > maxPageLimit:
+		return maxPageLimit, nil
+	}
+
+	return p.Limit, nil
+}
+
+// Paginate returns the page of the items and the cursor for the next page,
+// which is empty on the last page. The cursor is the position of the next
+// item so the items must be in the same order for every page.
+func Paginate[T any](items []T, page Page) ([]T, string, error) {
+	size, err := page.size()
+	if err != nil {
+		return nil, "", err
+	}
+
+	var start int
+	if page.Cursor != "" {
+		start, err = strconv.Atoi(page.Cursor)
+		if err != nil || start < 0 {
+			return nil, "", ErrInvalidCursor
+		}
+	}
+
+	if start >= len(items) {
+		return []T{}, "", nil
+	}
+
+	end := start + size
+	if end >= len(items) {
+		return items[start:], "", nil
+	}
+
+	return items[start:end], strconv.Itoa(end), nil
+}
+
+// =============================================================================
+
+// BlockFilter represents the filter and page used to query the blocks.
+type BlockFilter struct {
+	Account   database.AccountID // Only blocks with transactions from, to or paid by the account.
+	Finalized bool               // Only blocks that can't be reorganized away.
+	Cursor    string             // Next cursor from the previous page, empty for the first page.
+	Limit     int                // Number of blocks returned, defaults to all up to 1000.
+}
+
+// BlockPage represents a page of blocks in ascending order.
+type BlockPage struct {
+	Blocks []database.Block
+	Next   string // Cursor for the next page, empty on the last page.
+}
+
+// QueryBlocks returns the page of blocks matching the filter. The cursor is
+// the number of the next block to look at, so a page only reads the blocks
+// it needs from disk and stops if the context is cancelled.
+func (s *State) QueryBlocks(ctx context.Context, filter BlockFilter) (BlockPage, error) {
+	size, err := Page{Limit: filter.Limit}.size()
+	if err != nil {
+		return BlockPage{}, err
+	}
+
+	from := uint64(1)
+	if filter.Cursor != "" {
+		from, err = strconv.ParseUint(filter.Cursor, 10, 64)
+		if err != nil || from == 0 {
+			return BlockPage{}, ErrInvalidCursor
+		}
+	}
+
+	to := s.db.LatestBlock().Header.Number
+	if filter.Finalized {
+		to = s.finalizedNumber()
+	}
+
+	page := BlockPage{
+		Blocks: []database.Block{},
+	}
+
+	for number := from; number <= to; number++ {
+		if err := ctx.Err(); err != nil {
+			return BlockPage{}, err
+		}
+
+		if len(page.Blocks) == size {
+			page.Next = strconv.FormatUint(number, 10)
+			break
+		}
+
+		block, err := s.db.GetBlock(number)
+		if err != nil {
+			return BlockPage{}, err
+		}
+
+		if filter.Account == "" || involvesAccount(block, filter.Account) {
+			page.Blocks = append(page.Blocks, block)
+		}
+	}
+
+	return page, nil
+}
+
+// QueryAccounts returns the page of accounts ordered by their account id.
+func (s *State) QueryAccounts(page Page) ([]database.Account, string, error) {
+	var accounts []database.Account
+	s.db.Snapshot().ForEach(func(account database.Account) {
+		accounts = append(accounts, account)
+	})
+
+	sort.Slice(accounts, func(i, j int) bool {
+		return accounts[i].AccountID < accounts[j].AccountID
+	})
+
+	return Paginate(accounts, page)
+}
+
+// QueryUncommitted returns the page of transactions in the mempool, in the
+// order they would be mined, that are from, to or paid by the account. If
+// the account is empty, all transactions are returned.
+func (s *State) QueryUncommitted(accountID database.AccountID, page Page) ([]database.BlockTx, string, error) {
+	var trans []database.BlockTx
+	for _, tx := range s.mempool.PickBest() {
+		if accountID == "" || tx.FromID == accountID || tx.ToID == accountID || tx.FeePayerID == accountID {
+			trans = append(trans, tx)
+		}
+	}
+
+	return Paginate(trans, page)
+}
+
+// involvesAccount reports if any transaction in the block is from, to or
+// paid by the account.
+func involvesAccount(block database.Block, accountID database.AccountID) bool {
+	for _, tx := range block.MerkleTree.Values() {
+		if tx.FromID == accountID || tx.ToID == accountID || tx.FeePayerID == accountID {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package state
+
+import (
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// CORE NOTE: A policy lets an operator keep a node from relaying or mining
+// transactions for specific accounts, like sanctioned accounts or accounts
+// with compromised keys. The policy isn't part of consensus. The other nodes
+// still accept these transactions and blocks that include them are valid, so
+// by default a node only reports a block from a peer that breaks its policy.
+// Rejecting these blocks will fork the node from the rest of the network.
+
+// Policy defines the behavior of a node specific policy that decides which
+// transactions the node accepts.
+type Policy interface {
+	CheckTx(tx database.BlockTx) error
+}
+
+// checkPolicy returns the error from the policy if it rejects the
+// transaction.
+func (s *State) checkPolicy(tx database.BlockTx) error {
+	if s.policy == nil {
+		return nil
+	}
+
+	return s.policy.CheckTx(tx)
+}
+
+// removeDenied removes the transactions the policy rejects from the mempool
+// and returns the others. The policy can change while transactions are
+// waiting in the mempool.
+func (s *State) removeDenied(trans []database.BlockTx) []database.BlockTx {
+	if s.policy == nil {
+		return trans
+	}
+
+	allowed := make([]database.BlockTx, 0, len(trans))
+	for _, tx := range trans {
+		if err := s.policy.CheckTx(tx); err != nil {
+			s.evHandler("state: removeDenied: tx[%s]: %s", tx, err)
+			s.mempool.Delete(tx)
+			s.mempoolTxEvent(MempoolDrop, tx)
+			continue
+		}
+		allowed = append(allowed, tx)
+	}
+
+	return allowed
+}
+
+// checkBlockPolicy checks the transactions in a block from a peer against
+// the policy. The block is only rejected if the node enforces its policy on
+// blocks.
+func (s *State) checkBlockPolicy(block database.Block) error {
+	if s.policy == nil {
+		return nil
+	}
+
+	for _, tx := range block.MerkleTree.Values() {
+		err := s.policy.CheckTx(tx)
+		if err == nil {
+			continue
+		}
+
+		if s.policyBlocks {
+			return fmt.Errorf("blk[%d] tx[%s]: %w", block.Header.Number, tx, err)
+		}
+		s.evHandler("state: checkBlockPolicy: WARNING: blk[%d] tx[%s]: %s", block.Header.Number, tx, err)
+	}
+
+	return nil
+}
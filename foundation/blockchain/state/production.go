@@ -0,0 +1,186 @@
+package state
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// BlockProduction represents the time a block mined by this node spent in
+// each stage from the mempool to the peers. Select is picking the
+// transactions, Validate is hashing the state and applying the block to the
+// database, Nonce is solving the block and Broadcast is sending it to the
+// peers.
+type BlockProduction struct {
+	Block     uint64  `json:"block"`
+	Hash      string  `json:"hash"`
+	Txs       int     `json:"txs"`
+	Select    float64 `json:"select_ms"`
+	Validate  float64 `json:"validate_ms"`
+	Nonce     float64 `json:"nonce_ms"`
+	Broadcast float64 `json:"broadcast_ms"`
+	Total     float64 `json:"total_ms"`
+}
+
+// ProductionStats represents the time spent in each stage for the blocks
+// mined by this node since it started.
+type ProductionStats struct {
+	Blocks    uint64     `json:"blocks"`
+	Select    StageStats `json:"select"`
+	Validate  StageStats `json:"validate"`
+	Nonce     StageStats `json:"nonce"`
+	Broadcast StageStats `json:"broadcast"`
+}
+
+// StageStats represents the time spent in one stage of producing a block.
+type StageStats struct {
+	Last float64 `json:"last_ms"`
+	Avg  float64 `json:"avg_ms"`
+	Max  float64 `json:"max_ms"`
+}
+
+// CORE NOTE: A slow block is either slow to solve, which is bound by the CPU,
+// or slow to reach the peers, which is bound by the network. The time in each
+// stage is measured while the block is mined and finished once the block has
+// been sent to the peers, then reported as a production event and added to
+// the stats published with the other metrics.
+
+// ProductionStats returns the time spent in each stage for the blocks mined
+// by this node.
+func (s *State) ProductionStats() ProductionStats {
+	return s.production.stats()
+}
+
+// BlockProposed records the time it took to send the block mined by this node
+// to the peers and reports the time spent in each stage.
+func (s *State) BlockProposed(block database.Block, broadcast time.Duration) {
+	bp, found := s.production.finish(block.Hash(), broadcast)
+	if !found {
+		return
+	}
+
+	s.evHandler("state: BlockProposed: blk[%d]: select[%.2fms] validate[%.2fms] nonce[%.2fms] broadcast[%.2fms]", bp.Block, bp.Select, bp.Validate, bp.Nonce, bp.Broadcast)
+	s.sendEvent(EventProduction, bp)
+}
+
+// =============================================================================
+
+// stageTimes represents the time a block spent in each stage.
+type stageTimes struct {
+	selectTxs time.Duration
+	validate  time.Duration
+	nonce     time.Duration
+	broadcast time.Duration
+}
+
+// productionTracker keeps the stages of the block waiting to be sent to the
+// peers and the totals for the blocks already sent. The zero value is ready
+// to use.
+type productionTracker struct {
+	mu      sync.Mutex
+	pending BlockProduction
+	times   stageTimes
+	blocks  uint64
+	total   stageTimes
+	last    stageTimes
+	max     stageTimes
+}
+
+// mined records the stages of a block that was just mined. Only the latest
+// mined block waits to be sent to the peers.
+func (pt *productionTracker) mined(block database.Block, times stageTimes) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	pt.pending = BlockProduction{
+		Block: block.Header.Number,
+		Hash:  block.Hash(),
+		Txs:   len(block.MerkleTree.Values()),
+	}
+	pt.times = times
+}
+
+// finish adds the broadcast time to the block waiting to be sent to the peers
+// and adds its stages to the totals. False is returned if the block isn't the
+// one waiting.
+func (pt *productionTracker) finish(hash string, broadcast time.Duration) (BlockProduction, bool) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if pt.pending.Hash == "" || pt.pending.Hash != hash {
+		return BlockProduction{}, false
+	}
+
+	times := pt.times
+	times.broadcast = broadcast
+
+	bp := pt.pending
+	bp.Select = milliseconds(times.selectTxs)
+	bp.Validate = milliseconds(times.validate)
+	bp.Nonce = milliseconds(times.nonce)
+	bp.Broadcast = milliseconds(times.broadcast)
+	bp.Total = milliseconds(times.selectTxs + times.validate + times.nonce + times.broadcast)
+
+	pt.pending = BlockProduction{}
+	pt.blocks++
+	pt.last = times
+	pt.total.add(times)
+	pt.max.keepMax(times)
+
+	return bp, true
+}
+
+// stats returns the time spent in each stage.
+func (pt *productionTracker) stats() ProductionStats {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	stage := func(last, total, max time.Duration) StageStats {
+		st := StageStats{
+			Last: milliseconds(last),
+			Max:  milliseconds(max),
+		}
+		if pt.blocks > 0 {
+			st.Avg = milliseconds(total / time.Duration(pt.blocks))
+		}
+		return st
+	}
+
+	return ProductionStats{
+		Blocks:    pt.blocks,
+		Select:    stage(pt.last.selectTxs, pt.total.selectTxs, pt.max.selectTxs),
+		Validate:  stage(pt.last.validate, pt.total.validate, pt.max.validate),
+		Nonce:     stage(pt.last.nonce, pt.total.nonce, pt.max.nonce),
+		Broadcast: stage(pt.last.broadcast, pt.total.broadcast, pt.max.broadcast),
+	}
+}
+
+// add adds the times of each stage.
+func (st *stageTimes) add(times stageTimes) {
+	st.selectTxs += times.selectTxs
+	st.validate += times.validate
+	st.nonce += times.nonce
+	st.broadcast += times.broadcast
+}
+
+// keepMax keeps the longest time of each stage.
+func (st *stageTimes) keepMax(times stageTimes) {
+	if times.selectTxs > st.selectTxs {
+		st.selectTxs = times.selectTxs
+	}
+	if times.validate > st.validate {
+		st.validate = times.validate
+	}
+	if times.nonce > st.nonce {
+		st.nonce = times.nonce
+	}
+	if times.broadcast > st.broadcast {
+		st.broadcast = times.broadcast
+	}
+}
+
+// milliseconds returns the duration in milliseconds.
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -1,12 +1,24 @@
 package state
 
 import (
+	"context"
+	"errors"
+	"io"
+
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
 )
 
 // QueryLastest represents to query the latest block in the chain.
 const QueryLastest = ^uint64(0) >> 1
 
+// QueryFinalized represents to query the latest finalized block in the chain.
+const QueryFinalized = QueryLastest - 1
+
+// ErrTxNotFound is returned when a transaction isn't in any block.
+var ErrTxNotFound = errcode.New(errcode.NotFound, "transaction not found")
+
 // =============================================================================
 
 // QueryAccount returns a copy of the account from the database.
@@ -14,19 +26,145 @@ func (s *State) QueryAccount(account database.AccountID) (database.Account, erro
 	return s.db.Query(account)
 }
 
+// Resolve returns the account for the registered name. An account id is
+// returned as is, so callers can accept either a name or an account.
+func (s *State) Resolve(name string) (database.AccountID, error) {
+	if database.ValidateName(name) != nil {
+		return database.ToAccountID(name)
+	}
+
+	return s.db.Resolve(name)
+}
+
+// GenerateAccountProof returns a merkle proof of the account's balance and
+// nonce against the state root of the specified block. If the block number
+// is QueryLastest or QueryFinalized, the latest or latest finalized block
+// is used.
+func (s *State) GenerateAccountProof(ctx context.Context, accountID database.AccountID, blockNum uint64) (database.AccountProof, error) {
+	switch blockNum {
+	case QueryLastest:
+		blockNum = s.db.LatestBlock().Header.Number
+	case QueryFinalized:
+		blockNum = s.finalizedNumber()
+	}
+
+	return s.db.AccountProof(ctx, accountID, blockNum)
+}
+
+// ReplayBlock applies the specified block again on top of the state it was
+// built on and returns the balance, fee and nonce changes made by each of its
+// transactions and the mining reward, to explain how the accounts ended up
+// where they are. If the block number is QueryLastest or QueryFinalized, the
+// latest or latest finalized block is used.
+func (s *State) ReplayBlock(ctx context.Context, blockNum uint64) (database.BlockReplay, error) {
+	switch blockNum {
+	case QueryLastest:
+		blockNum = s.db.LatestBlock().Header.Number
+	case QueryFinalized:
+		blockNum = s.finalizedNumber()
+	}
+
+	return s.db.ReplayBlock(ctx, blockNum)
+}
+
+// ExportState writes a versioned JSON snapshot of the accounts after the
+// specified block was applied. If the block number is QueryLastest or
+// QueryFinalized, the latest or latest finalized block is used.
+func (s *State) ExportState(ctx context.Context, w io.Writer, blockNum uint64) error {
+	switch blockNum {
+	case QueryLastest:
+		blockNum = s.db.LatestBlock().Header.Number
+	case QueryFinalized:
+		blockNum = s.finalizedNumber()
+	}
+
+	return s.db.ExportState(ctx, w, blockNum)
+}
+
+// ExportCSV writes the block headers or transactions for the blocks from one
+// number to another as CSV. If the last block number is QueryLastest or
+// QueryFinalized, the latest or latest finalized block is used.
+func (s *State) ExportCSV(ctx context.Context, w io.Writer, table string, from uint64, to uint64) error {
+	switch to {
+	case QueryLastest:
+		to = s.db.LatestBlock().Header.Number
+	case QueryFinalized:
+		to = s.finalizedNumber()
+	}
+
+	return s.db.ExportCSV(ctx, w, table, from, to)
+}
+
+// ForkGenesis returns a genesis for a new chain starting from the accounts
+// after the specified block was applied. If the block number is QueryLastest
+// or QueryFinalized, the latest or latest finalized block is used.
+func (s *State) ForkGenesis(ctx context.Context, blockNum uint64) (genesis.Genesis, error) {
+	switch blockNum {
+	case QueryLastest:
+		blockNum = s.db.LatestBlock().Header.Number
+	case QueryFinalized:
+		blockNum = s.finalizedNumber()
+	}
+
+	return s.db.ForkGenesis(ctx, blockNum)
+}
+
+// QueryChainStats returns the rolling statistics for the blockchain such as
+// the average block interval, transaction throughput, fee averages and the
+// total supply including mining rewards.
+func (s *State) QueryChainStats() database.ChainStats {
+	return s.db.ChainStats()
+}
+
+// QueryTotalSupply returns the number of coins that exist, which is the
+// genesis balances plus all the mining rewards minus the burned base fees.
+func (s *State) QueryTotalSupply() uint64 {
+	return s.db.TotalSupply()
+}
+
+// QueryProposals returns the governance proposals submitted to the chain.
+func (s *State) QueryProposals() []database.Proposal {
+	return s.db.Proposals()
+}
+
+// QueryGenesisAt returns the genesis settings in effect for the specified
+// block number after the approved governance changes are applied.
+func (s *State) QueryGenesisAt(blockNum uint64) genesis.Genesis {
+	return s.db.GenesisAt(blockNum)
+}
+
 // QueryBlocksByNumber returns the set of blocks based on block numbers. This
-// function reads the blockchain from disk first.
-func (s *State) QueryBlocksByNumber(from uint64, to uint64) []database.Block {
-	if from == QueryLastest {
+// function reads the blockchain from disk first and returns no blocks if the
+// context is cancelled.
+func (s *State) QueryBlocksByNumber(ctx context.Context, from uint64, to uint64) []database.Block {
+	switch from {
+	case QueryLastest:
 		from = s.db.LatestBlock().Header.Number
 		to = from
+	case QueryFinalized:
+		from = s.finalizedNumber()
+		to = from
 	}
-	if to == QueryLastest {
+
+	switch to {
+	case QueryLastest:
 		to = s.db.LatestBlock().Header.Number
+	case QueryFinalized:
+		to = s.finalizedNumber()
+	}
+
+	// There is no block 0 to return.
+	if to == 0 {
+		return nil
 	}
 
 	var out []database.Block
 	for i := from; i <= to; i++ {
+		if err := ctx.Err(); err != nil {
+			s.evHandler("state: getblock: ERROR: %s", err)
+			return nil
+		}
+
 		block, err := s.db.GetBlock(i)
 		if err != nil {
 			s.evHandler("state: getblock: ERROR: %s", err)
@@ -40,18 +178,34 @@ func (s *State) QueryBlocksByNumber(from uint64, to uint64) []database.Block {
 
 // QueryBlocksByAccount returns the set of blocks by account. If the account
 // is empty, all blocks are returned. This function reads the blockchain
-// from disk first.
-func (s *State) QueryBlocksByAccount(accountID database.AccountID) ([]database.Block, error) {
+// from disk first and stops if the context is cancelled.
+func (s *State) QueryBlocksByAccount(ctx context.Context, accountID database.AccountID) ([]database.Block, error) {
+	return s.queryBlocksByAccount(ctx, accountID, QueryLastest)
+}
+
+// QueryFinalizedBlocksByAccount returns the set of finalized blocks by
+// account. If the account is empty, all finalized blocks are returned.
+func (s *State) QueryFinalizedBlocksByAccount(ctx context.Context, accountID database.AccountID) ([]database.Block, error) {
+	return s.queryBlocksByAccount(ctx, accountID, s.finalizedNumber())
+}
+
+// queryBlocksByAccount returns the set of blocks by account up to and
+// including the specified block number.
+func (s *State) queryBlocksByAccount(ctx context.Context, accountID database.AccountID, to uint64) ([]database.Block, error) {
 	var out []database.Block
 
-	iter := s.db.ForEach()
+	iter := s.db.ForEachCtx(ctx)
 	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
 		if err != nil {
 			return nil, err
 		}
 
+		if block.Header.Number > to {
+			break
+		}
+
 		for _, tx := range block.MerkleTree.Values() {
-			if accountID == "" || tx.FromID == accountID || tx.ToID == accountID {
+			if accountID == "" || tx.FromID == accountID || tx.ToID == accountID || tx.FeePayerID == accountID {
 				out = append(out, block)
 				break
 			}
@@ -60,3 +214,50 @@ func (s *State) QueryBlocksByAccount(accountID database.AccountID) ([]database.B
 
 	return out, nil
 }
+
+// QueryTransaction returns the transaction with the specified hash and the
+// block it was mined into. This function reads the blockchain from disk and
+// stops if the context is cancelled.
+func (s *State) QueryTransaction(ctx context.Context, txHash string) (database.BlockTx, database.Block, error) {
+	iter := s.db.ForEachCtx(ctx)
+	for block, err := iter.Next(); !iter.Done(); block, err = iter.Next() {
+		if err != nil {
+			return database.BlockTx{}, database.Block{}, err
+		}
+
+		for _, tx := range block.MerkleTree.Values() {
+			if tx.TxHash() == txHash {
+				return tx, block, nil
+			}
+		}
+	}
+
+	// A cancelled walk doesn't mean the transaction doesn't exist.
+	if err := ctx.Err(); err != nil {
+		return database.BlockTx{}, database.Block{}, err
+	}
+
+	return database.BlockTx{}, database.Block{}, ErrTxNotFound
+}
+
+// QueryReceipt returns the transaction with the specified hash and the block
+// it was mined into for reporting a receipt. A transaction whose block was
+// removed by a reorganization and hasn't been mined again is returned with
+// the removed block and isn't canonical.
+func (s *State) QueryReceipt(ctx context.Context, txHash string) (tx database.BlockTx, block database.Block, canonical bool, err error) {
+	tx, block, err = s.QueryTransaction(ctx, txHash)
+	if err == nil {
+		return tx, block, true, nil
+	}
+
+	if !errors.Is(err, ErrTxNotFound) {
+		return database.BlockTx{}, database.Block{}, false, err
+	}
+
+	tx, block, exists := s.reverted.lookup(txHash)
+	if exists {
+		return tx, block, false, nil
+	}
+
+	return database.BlockTx{}, database.Block{}, false, ErrTxNotFound
+}
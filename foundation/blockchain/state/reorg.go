@@ -1,17 +1,65 @@
 package state
 
+import (
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
+)
+
+// CORE NOTE: A block is final once the configured number of blocks have been
+// mined on top of it. Final blocks are never removed by a reorganization, so
+// the resync picks up from the latest finalized block. A peer whose chain
+// doesn't build on our finalized block will have its blocks rejected since the
+// parent hash won't match.
+
+// LatestFinalizedBlock returns a copy of the latest block that is final. The
+// zero block is returned if no block is final yet.
+func (s *State) LatestFinalizedBlock() database.Block {
+	num := s.finalizedNumber()
+	if num == 0 {
+		return database.Block{}
+	}
+
+	block, err := s.db.GetBlock(num)
+	if err != nil {
+		s.evHandler("state: LatestFinalizedBlock: blk[%d]: ERROR: %s", num, err)
+		return database.Block{}
+	}
+
+	return block
+}
+
+// finalizedNumber returns the number of the latest block that is final.
+func (s *State) finalizedNumber() uint64 {
+	latest := s.db.LatestBlock().Header.Number
+	if s.finalityDepth == 0 || latest <= s.finalityDepth {
+		return 0
+	}
+
+	return latest - s.finalityDepth
+}
+
+// =============================================================================
+
 // Reorganize corrects an identified fork. No mining is allowed to take place
 // while this process is running. New transactions can be placed into the mempool.
 func (s *State) Reorganize() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
+	// Roll the blockchain back to the latest finalized block. Blocks below
+	// finality can't be reorganized.
+	finalized := s.finalizedNumber()
+	err := s.rollbackToFinalized()
+	s.record(journal.Entry{Kind: JournalReorganize, Latest: s.db.LatestBlock().Hash()}, journalReorganize{Finalized: finalized}, err)
+	if err != nil {
+		return err
+	}
+
 	// Don't allow mining to continue.
 	s.allowMining = false
 
-	// Reset the state of the blockchain node.
-	s.db.Reset()
-
 	// Resync the state of the blockchain.
 	s.resyncWG.Add(1)
 	go func() {
@@ -28,6 +76,21 @@ func (s *State) Reorganize() error {
 	return nil
 }
 
+// rollbackToFinalized removes the blocks after the latest finalized block and
+// returns their transactions to the mempool. The blocks up to the latest
+// checkpoint the chain matches are kept even when they aren't final. The
+// caller must hold the state lock.
+func (s *State) rollbackToFinalized() error {
+	finalized := s.finalizedNumber()
+	if checkpointed := s.checkpointedNumber(); checkpointed > finalized {
+		s.evHandler("state: Reorganize: keeping blocks up to checkpoint blk[%d]", checkpointed)
+		finalized = checkpointed
+	}
+	s.evHandler("state: Reorganize: rollback to finalized blk[%d]", finalized)
+
+	return s.rollbackHead(finalized)
+}
+
 // turnMiningOn sets the allowMining flag back to true.
 func (s *State) turnMiningOn() {
 	s.mu.Lock()
@@ -35,3 +98,44 @@ func (s *State) turnMiningOn() {
 
 	s.allowMining = true
 }
+
+// =============================================================================
+
+// keptReverted is the number of the latest blocks removed by a rollback that
+// are kept to look up the receipts for their transactions.
+const keptReverted = 100
+
+// revertedBlocks keeps the latest blocks removed from the chain by a rollback.
+// The zero value is ready to use.
+type revertedBlocks struct {
+	mu     sync.Mutex
+	blocks []database.Block // Order the blocks were removed in, oldest first.
+}
+
+// add records the blocks removed from the chain.
+func (rb *revertedBlocks) add(blocks []database.Block) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	rb.blocks = append(rb.blocks, blocks...)
+	if len(rb.blocks) > keptReverted {
+		rb.blocks = rb.blocks[len(rb.blocks)-keptReverted:]
+	}
+}
+
+// lookup returns the transaction with the specified hash and the latest
+// removed block it was in.
+func (rb *revertedBlocks) lookup(txHash string) (database.BlockTx, database.Block, bool) {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+
+	for i := len(rb.blocks) - 1; i >= 0; i-- {
+		for _, tx := range rb.blocks[i].MerkleTree.Values() {
+			if tx.TxHash() == txHash {
+				return tx, rb.blocks[i], true
+			}
+		}
+	}
+
+	return database.BlockTx{}, database.Block{}, false
+}
@@ -0,0 +1,212 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// nodeStateVersion is the version of the node state file written on
+// shutdown. A file with a different version is ignored on startup.
+const nodeStateVersion = 1
+
+// CORE NOTE: The blockchain is kept in storage, but the pending transactions,
+// the peers this node learned about and how far behind the network it was
+// only live in memory. Without them a restarted node waits for the pending
+// transactions to be sent again, which for a wallet that only talked to this
+// node never happens, and starts over with the origin peers. They are saved
+// to a file once the node stops changing them and restored on startup. The
+// restored transactions go through the same checks as a transaction from a
+// peer, since blocks may have been added while the node was down.
+
+// nodeState represents what the node learned while it was running that isn't
+// kept in the blockchain.
+type nodeState struct {
+	Version int                `json:"version"`
+	ChainID uint16             `json:"chain_id"`
+	Saved   time.Time          `json:"saved"`
+	Mempool []database.BlockTx `json:"mempool"`
+	Orphans []database.BlockTx `json:"orphans,omitempty"`
+	Peers   []savedPeer        `json:"peers"` // Best score first.
+	Sync    syncPosition       `json:"sync"`
+}
+
+// savedPeer represents a known peer with its score.
+type savedPeer struct {
+	Peer    peer.Peer `json:"peer"`
+	Score   int       `json:"score"`
+	Inbound bool      `json:"inbound"`
+}
+
+// syncPosition represents the latest block of the node and the latest blocks
+// the peers reported when the node stopped.
+type syncPosition struct {
+	Block       uint64            `json:"block"`
+	BlockHash   string            `json:"block_hash,omitempty"`
+	TargetBlock uint64            `json:"target_block,omitempty"`
+	PeerBlocks  map[string]uint64 `json:"peer_blocks,omitempty"`
+}
+
+// =============================================================================
+
+// saveNodeState writes the mempool, the known peers with their scores and
+// the sync position to the node state file. The file is replaced in one step
+// so a crash while writing it leaves the previous file.
+func (s *State) saveNodeState() error {
+	if s.nodeStatePath == "" {
+		return nil
+	}
+
+	ns := nodeState{
+		Version: nodeStateVersion,
+		ChainID: s.genesis.ChainID,
+		Saved:   time.Now().UTC(),
+		Mempool: s.Mempool(),
+		Orphans: s.Orphans(),
+	}
+
+	for _, score := range s.PeerScores() {
+		pr, exists := s.knownPeers.Lookup(score.Host)
+		if !exists {
+			continue
+		}
+		ns.Peers = append(ns.Peers, savedPeer{Peer: pr, Score: score.Score, Inbound: score.Inbound})
+	}
+
+	latest := s.db.LatestBlock()
+	ns.Sync.Block = latest.Header.Number
+	if latest.Header.Number > 0 {
+		ns.Sync.BlockHash = latest.Hash()
+	}
+
+	s.syncing.mu.Lock()
+	ns.Sync.TargetBlock = s.syncing.status.TargetBlock
+	if len(s.syncing.peers) > 0 {
+		ns.Sync.PeerBlocks = make(map[string]uint64, len(s.syncing.peers))
+		for host, blockNum := range s.syncing.peers {
+			ns.Sync.PeerBlocks[host] = blockNum
+		}
+	}
+	s.syncing.mu.Unlock()
+
+	data, err := json.MarshalIndent(ns, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.nodeStatePath), 0755); err != nil {
+		return err
+	}
+
+	tmpPath := s.nodeStatePath + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, s.nodeStatePath); err != nil {
+		return err
+	}
+
+	s.evHandler("state: saveNodeState: mempool[%d] orphans[%d] peers[%d] blk[%d]", len(ns.Mempool), len(ns.Orphans), len(ns.Peers), ns.Sync.Block)
+
+	return nil
+}
+
+// restoreNodeState reads the node state file written on the last shutdown
+// and restores the mempool, the known peers with their scores and the sync
+// position. A node starting for the first time has no file to restore.
+func (s *State) restoreNodeState() error {
+	if s.nodeStatePath == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(s.nodeStatePath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+
+	var ns nodeState
+	if err := json.Unmarshal(data, &ns); err != nil {
+		return fmt.Errorf("decoding node state: %w", err)
+	}
+
+	if ns.Version != nodeStateVersion {
+		return fmt.Errorf("node state version %d is not supported, need %d", ns.Version, nodeStateVersion)
+	}
+
+	if ns.ChainID != s.genesis.ChainID {
+		return fmt.Errorf("node state is for chain %d, node is for chain %d", ns.ChainID, s.genesis.ChainID)
+	}
+
+	// The peers go first so the best ones get the slots.
+	var peers int
+	for _, sp := range ns.Peers {
+		if sp.Peer.Validate() != nil || sp.Peer.Match(s.host) {
+			continue
+		}
+
+		s.admitPeer(sp.Peer, sp.Inbound)
+		if _, exists := s.knownPeers.Lookup(sp.Peer.Host); !exists {
+			continue
+		}
+		s.slots.restore(PeerScore{Host: sp.Peer.Host, Score: sp.Score, Inbound: sp.Inbound})
+		peers++
+	}
+
+	s.syncing.mu.Lock()
+	s.syncing.status.TargetBlock = ns.Sync.TargetBlock
+	for host, blockNum := range ns.Sync.PeerBlocks {
+		if _, exists := s.knownPeers.Lookup(host); !exists {
+			continue
+		}
+		if s.syncing.peers == nil {
+			s.syncing.peers = make(map[string]uint64)
+		}
+		s.syncing.peers[host] = blockNum
+	}
+	s.syncing.mu.Unlock()
+
+	if latest := s.db.LatestBlock().Header.Number; latest < ns.Sync.Block {
+		s.evHandler("state: restoreNodeState: WARNING: blk[%d] is behind blk[%d] at shutdown", latest, ns.Sync.Block)
+	}
+
+	txs := append(ns.Mempool, ns.Orphans...)
+	sortByNonce(txs)
+
+	var dropped int
+	for _, tx := range txs {
+		if err := s.restoreTx(tx); err != nil {
+			s.evHandler("state: restoreNodeState: tx[%s]: dropped: %s", tx, err)
+			dropped++
+		}
+	}
+
+	s.evHandler("state: restoreNodeState: saved[%s]: mempool[%d] dropped[%d] peers[%d] blk[%d]", ns.Saved.Format(time.RFC3339), s.mempool.Count(), dropped, peers, ns.Sync.Block)
+
+	return nil
+}
+
+// restoreTx adds a transaction kept from before the node restarted back to
+// the mempool, or holds it again if its payer still doesn't exist.
+func (s *State) restoreTx(tx database.BlockTx) error {
+	if err := s.validateNodeTx(tx); err != nil {
+		return err
+	}
+
+	held, err := s.holdOrphan(tx)
+	if err != nil || held {
+		return err
+	}
+
+	return s.addToMempool(tx)
+}
@@ -0,0 +1,255 @@
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sinkBuffer is the number of events waiting to be handled by a sink before
+// new events for it are dropped.
+const sinkBuffer = 1000
+
+// Event represents an event sent to the sinks. A structured event has the
+// kind of event and its value, a log message only has the message.
+type Event struct {
+	Kind    string          `json:"kind,omitempty"`    // One of the Event kinds, empty for a log message.
+	Message string          `json:"message,omitempty"` // Set for a log message.
+	Data    json.RawMessage `json:"data,omitempty"`    // The value encoded as JSON.
+	Value   any             `json:"-"`                 // The value, such as a MiningEvent, for sinks in the same process.
+	Time    time.Time       `json:"time"`
+}
+
+// Sink represents a destination for the events from the node, such as a file,
+// a metrics collector or a webhook. Each sink has its own filter and receives
+// the events in order on its own goroutine, so a slow sink doesn't hold up
+// the node or the other sinks.
+type Sink struct {
+	Name   string
+	Kinds  []string // Kinds of structured events received, empty receives every kind.
+	Logs   bool     // Receive the log messages as well as the structured events.
+	Handle func(ev Event)
+}
+
+// SinkStats represents the activity of a sink.
+type SinkStats struct {
+	Name      string   `json:"name"`
+	Kinds     []string `json:"kinds,omitempty"`
+	Logs      bool     `json:"logs,omitempty"`
+	Delivered uint64   `json:"delivered"`
+	Dropped   uint64   `json:"dropped"` // Events dropped because the sink fell behind.
+}
+
+// CORE NOTE: The event handler gets every log message and structured event
+// as one formatted string, so an integration interested in a kind of event
+// had to wrap the handler and parse the strings back. Sinks are registered
+// with the node instead, each with the kinds of events it wants, and get the
+// event values directly. The event handler is still called for everything.
+
+// AddSink registers a sink to receive the events that pass its filter.
+func (s *State) AddSink(sink Sink) error {
+	return s.sinks.add(sink)
+}
+
+// RemoveSink stops sending events to the sink with the specified name. The
+// events already waiting are still handled.
+func (s *State) RemoveSink(name string) bool {
+	return s.sinks.remove(name)
+}
+
+// Sinks returns the activity of the registered sinks sorted by name.
+func (s *State) Sinks() []SinkStats {
+	return s.sinks.stats()
+}
+
+// =============================================================================
+
+// sink represents a registered sink with the events waiting for it.
+type sink struct {
+	Sink
+	kinds     map[string]bool
+	ch        chan Event
+	done      chan struct{}
+	delivered uint64
+	dropped   uint64
+}
+
+// run hands the events to the sink until the channel is closed.
+func (sk *sink) run(sinks *sinkSet) {
+	defer close(sk.done)
+
+	for ev := range sk.ch {
+		sk.Handle(ev)
+
+		sinks.mu.Lock()
+		sk.delivered++
+		sinks.mu.Unlock()
+	}
+}
+
+// wants reports if the sink receives events of the specified kind.
+func (sk *sink) wants(kind string) bool {
+	if kind == "" {
+		return sk.Logs
+	}
+
+	return len(sk.kinds) == 0 || sk.kinds[kind]
+}
+
+// sinkSet keeps the registered sinks. The zero value is ready to use.
+type sinkSet struct {
+	mu    sync.Mutex
+	sinks map[string]*sink
+}
+
+// add registers the sink and starts handing it events.
+func (ss *sinkSet) add(s Sink) error {
+	if s.Name == "" {
+		return errors.New("sink name is required")
+	}
+
+	if s.Handle == nil {
+		return fmt.Errorf("sink %q has no handler", s.Name)
+	}
+
+	sk := sink{
+		Sink: s,
+		ch:   make(chan Event, sinkBuffer),
+		done: make(chan struct{}),
+	}
+
+	if len(s.Kinds) > 0 {
+		sk.kinds = make(map[string]bool, len(s.Kinds))
+		for _, kind := range s.Kinds {
+			sk.kinds[kind] = true
+		}
+	}
+
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if _, exists := ss.sinks[s.Name]; exists {
+		return fmt.Errorf("sink %q is already registered", s.Name)
+	}
+
+	if ss.sinks == nil {
+		ss.sinks = make(map[string]*sink)
+	}
+	ss.sinks[s.Name] = &sk
+
+	go sk.run(ss)
+
+	return nil
+}
+
+// remove unregisters the sink and waits for the events already waiting for
+// it to be handled.
+func (ss *sinkSet) remove(name string) bool {
+	ss.mu.Lock()
+	sk, exists := ss.sinks[name]
+	if exists {
+		delete(ss.sinks, name)
+		close(sk.ch)
+	}
+	ss.mu.Unlock()
+
+	if exists {
+		<-sk.done
+	}
+
+	return exists
+}
+
+// shutdown unregisters every sink and waits for the events already waiting
+// to be handled.
+func (ss *sinkSet) shutdown() {
+	ss.mu.Lock()
+	names := make([]string, 0, len(ss.sinks))
+	for name := range ss.sinks {
+		names = append(names, name)
+	}
+	ss.mu.Unlock()
+
+	for _, name := range names {
+		ss.remove(name)
+	}
+}
+
+// event sends a structured event to the sinks that want its kind.
+func (ss *sinkSet) event(kind string, v any, data []byte) {
+	ss.send(Event{Kind: kind, Data: data, Value: v, Time: time.Now().UTC()})
+}
+
+// log sends a log message to the sinks that want log messages. The messages
+// for the structured events are left out since they are sent as events.
+func (ss *sinkSet) log(v string, args ...any) {
+	if !ss.wantsLogs() {
+		return
+	}
+
+	msg := fmt.Sprintf(v, args...)
+	if strings.HasPrefix(msg, "viewer: ") {
+		return
+	}
+
+	ss.send(Event{Message: msg, Time: time.Now().UTC()})
+}
+
+// wantsLogs reports if any sink receives the log messages, so a message is
+// only formatted when it's needed.
+func (ss *sinkSet) wantsLogs() bool {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, sk := range ss.sinks {
+		if sk.Logs {
+			return true
+		}
+	}
+
+	return false
+}
+
+// send queues the event for every sink that wants it. The event is dropped
+// for a sink that has fallen behind.
+func (ss *sinkSet) send(ev Event) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	for _, sk := range ss.sinks {
+		if !sk.wants(ev.Kind) {
+			continue
+		}
+
+		select {
+		case sk.ch <- ev:
+		default:
+			sk.dropped++
+		}
+	}
+}
+
+// stats returns the activity of the sinks sorted by name.
+func (ss *sinkSet) stats() []SinkStats {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	stats := make([]SinkStats, 0, len(ss.sinks))
+	for _, sk := range ss.sinks {
+		stats = append(stats, SinkStats{
+			Name:      sk.Name,
+			Kinds:     sk.Kinds,
+			Logs:      sk.Logs,
+			Delivered: sk.delivered,
+			Dropped:   sk.dropped,
+		})
+	}
+
+	sort.Slice(stats, func(i, j int) bool { return stats[i].Name < stats[j].Name })
+
+	return stats
+}
@@ -0,0 +1,227 @@
+package state
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+)
+
+// Set of values used to score the peers.
+const (
+	scoreSuccess = 1   // Added for a request the peer answered.
+	scoreFailure = -2  // Added for a request the peer didn't answer.
+	scoreMin     = -20 // Lowest score a peer can fall to.
+	scoreMax     = 20  // Highest score a peer can reach.
+)
+
+// PeerScore represents how well a peer has been answering requests.
+type PeerScore struct {
+	Host    string  `json:"host"`
+	Score   int     `json:"score"`
+	Inbound bool    `json:"inbound"`              // The peer announced itself instead of being found by this node.
+	Latency float64 `json:"latency_ms,omitempty"` // Average round trip time of the status requests.
+}
+
+// CORE NOTE: Every known peer is sent every transaction and block, so in a
+// large network with no limit every node ends up gossiping with every other
+// node. The peer table has a number of slots for the peers this node finds
+// itself, the outbound peers, and for the peers that announce themselves, the
+// inbound peers. Keeping them apart stops a flood of announcing nodes from
+// pushing out the peers this node chose.
+//
+// Peers earn a point for each request they answer and lose two for each one
+// they don't. Once the slots are full a new peer only gets in by taking the
+// slot of a peer with a negative score, the worst one first. Peers added by
+// an operator aren't held to the limits.
+
+// PeerScores returns the scores of the known peers, best first.
+func (s *State) PeerScores() []PeerScore {
+	peers := s.KnownExternalPeers()
+
+	scores := make([]PeerScore, len(peers))
+	for i, pr := range peers {
+		scores[i] = s.slots.score(pr.Host)
+		scores[i].Latency = float64(s.latency.stats(pr.Host).Avg) / float64(time.Millisecond)
+	}
+
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].Score > scores[j].Score })
+
+	return scores
+}
+
+// scorePeer records a request the peer did or didn't answer. Hosts that
+// aren't known peers aren't scored.
+func (s *State) scorePeer(host string, answered bool) {
+	if _, exists := s.knownPeers.Lookup(host); exists {
+		s.slots.record(host, answered)
+	}
+}
+
+// AddInboundPeer adds a peer that announced itself to the known peer list,
+// if there is a free inbound slot or a worse peer to evict.
+func (s *State) AddInboundPeer(pr peer.Peer) bool {
+	return s.admitPeer(pr, true)
+}
+
+// admitPeer adds the peer to the known peer list when it's new and there is
+// a slot for it, evicting the worst scoring peer when the slots are full.
+func (s *State) admitPeer(pr peer.Peer, inbound bool) bool {
+	if _, exists := s.knownPeers.Lookup(pr.Host); exists {
+		s.knownPeers.Add(pr)
+		return false
+	}
+
+	limit := s.maxOutbound
+	if inbound {
+		limit = s.maxInbound
+	}
+
+	if limit > 0 {
+		var used []PeerScore
+		for _, known := range s.KnownExternalPeers() {
+			if score := s.slots.score(known.Host); score.Inbound == inbound {
+				used = append(used, score)
+			}
+		}
+
+		if len(used) >= limit {
+			worst, found := worstPeer(used)
+			if !found {
+				s.evHandler("state: admitPeer: peer table full: rejected peer[%s]: inbound[%v]", pr.Host, inbound)
+				return false
+			}
+
+			s.evHandler("state: admitPeer: peer table full: evicted peer[%s]: score[%d]: for peer[%s]", worst.Host, worst.Score, pr.Host)
+			s.RemoveKnownPeer(peer.New(worst.Host))
+		}
+	}
+
+	if !s.knownPeers.Add(pr) {
+		return false
+	}
+	s.slots.admit(pr.Host, inbound)
+	s.peerEvent(PeerAdd, pr)
+
+	return true
+}
+
+// worstPeer returns the peer with the lowest negative score. Ties go to the
+// peer that sorts last by host so the choice is repeatable.
+func worstPeer(scores []PeerScore) (PeerScore, bool) {
+	var worst PeerScore
+	var found bool
+	for _, score := range scores {
+		if score.Score >= 0 {
+			continue
+		}
+
+		if !found || score.Score < worst.Score || (score.Score == worst.Score && score.Host > worst.Host) {
+			worst = score
+			found = true
+		}
+	}
+
+	return worst, found
+}
+
+// =============================================================================
+
+// peerSlots keeps the score and direction of the known peers. The zero value
+// is ready to use.
+type peerSlots struct {
+	mu      sync.Mutex
+	scores  map[string]int
+	inbound map[string]bool
+}
+
+// admit records the direction of a new peer and starts its score over.
+func (ps *peerSlots) admit(host string, inbound bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.init()
+
+	delete(ps.scores, host)
+	if inbound {
+		ps.inbound[host] = true
+		return
+	}
+	delete(ps.inbound, host)
+}
+
+// forget removes what is known about the peer.
+func (ps *peerSlots) forget(host string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.scores, host)
+	delete(ps.inbound, host)
+}
+
+// record adds to the score of the peer for a request it did or didn't answer.
+func (ps *peerSlots) record(host string, answered bool) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.init()
+
+	score := ps.scores[host] + scoreFailure
+	if answered {
+		score = ps.scores[host] + scoreSuccess
+	}
+
+	switch {
+	case score < scoreMin:
+		score = scoreMin
+	case score > scoreMax:
+		score = scoreMax
+	}
+	ps.scores[host] = score
+}
+
+// restore sets the score and direction of a peer kept from before the node
+// restarted.
+func (ps *peerSlots) restore(score PeerScore) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	ps.init()
+
+	switch {
+	case score.Score < scoreMin:
+		score.Score = scoreMin
+	case score.Score > scoreMax:
+		score.Score = scoreMax
+	}
+
+	ps.scores[score.Host] = score.Score
+	if score.Inbound {
+		ps.inbound[score.Host] = true
+		return
+	}
+	delete(ps.inbound, score.Host)
+}
+
+// score returns the score and direction of the peer. Peers the node started
+// with are outbound peers.
+func (ps *peerSlots) score(host string) PeerScore {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	return PeerScore{
+		Host:    host,
+		Score:   ps.scores[host],
+		Inbound: ps.inbound[host],
+	}
+}
+
+// init constructs the maps the first time they are needed. The caller must
+// hold the lock.
+func (ps *peerSlots) init() {
+	if ps.scores == nil {
+		ps.scores = make(map[string]int)
+		ps.inbound = make(map[string]bool)
+	}
+}
@@ -3,12 +3,21 @@
 package state
 
 import (
+	"crypto/ecdsa"
+	"errors"
+	"net/http"
 	"sync"
+	"time"
 
+	"github.com/ardanlabs/blockchain/foundation/blockchain/chaos"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/mempool"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 )
 
 /*
@@ -30,8 +39,13 @@ import (
 const (
 	ConsensusPOW = "POW"
 	ConsensusPOA = "POA"
+	ConsensusPOS = "POS"
 )
 
+// RuleProposer is the name of the block rule checking a block under PoS is
+// signed by the validator selected to propose it.
+const RuleProposer = "proposer"
+
 // =============================================================================
 
 // EventHandler defines a function that is called when events
@@ -46,6 +60,7 @@ type Worker interface {
 	SignalStartMining()
 	SignalCancelMining()
 	SignalShareTx(blockTx database.BlockTx)
+	SignalShareVote(vote database.Vote)
 }
 
 // =============================================================================
@@ -55,26 +70,96 @@ type Worker interface {
 type Config struct {
 	BeneficiaryID  database.AccountID
 	Host           string
+	NodeID         string // Fingerprint of the identity this node is known by to its peers.
 	Storage        database.Storage
 	Genesis        genesis.Genesis
 	SelectStrategy string
 	KnownPeers     *peer.PeerSet
 	EvHandler      EventHandler
 	Consensus      string
+	BlockCacheSize int
+	FinalityDepth  uint64                   // Number of blocks on top of a block before it's final, 0 turns finality off.
+	MiningTimeout  time.Duration            // Longest a block is mined for, 0 derives it from the difficulty and hash rate.
+	MiningMinTrans int                      // Number of pending transactions mining waits for, 0 mines as soon as there is one.
+	MiningMaxWait  time.Duration            // Longest pending transactions wait for the count before a partial block is mined, 0 waits for the count.
+	MiningMinTips  uint64                   // Total of the pending tips that starts mining before the count is reached, 0 turns this off.
+	EmptyBlocks    time.Duration            // Time without a new block before an empty block is mined, 0 only mines blocks with transactions.
+	PrivateKey     *ecdsa.PrivateKey        // Signs the blocks this node proposes under PoS.
+	BLSKey         *signature.BLSPrivateKey // Optional key this node votes for blocks with under PoS.
+	Transport      http.RoundTripper        // Optional transport for requests to peers, nil uses the default.
+	Journal        *journal.Journal         // Optional journal recording the inputs to the node for replay.
+	Faults         *chaos.Faults            // Optional faults injected into the requests to peers.
+	CompactRelay   bool                     // Send new blocks to peers as the header and transaction hashes.
+	Tracer         *tracing.Tracer          // Optional tracer recording spans for mining, syncing and gossip.
+	Policy         Policy                   // Optional policy deciding which transactions this node accepts.
+	PolicyBlocks   bool                     // Reject blocks from peers with transactions the policy rejects.
+	Slash          bool                     // Submit the evidence of a validator signing two blocks for the same number to slash its bond.
+	MaxInbound     int                      // Number of peers that announced themselves kept, 0 keeps them all.
+	MaxOutbound    int                      // Number of peers found by this node kept, 0 keeps them all.
+	ChainScoped    bool                     // Reach peers on the URLs for this chain's id, needed when peers host more than one chain.
+	MinTip         uint64                   // Lowest tip accepted into the mempool for transactions from other accounts, 0 accepts any tip.
+	NodeStatePath  string                   // Optional file the mempool, peers and sync position are saved to on shutdown and restored from on startup.
+	Sinks          []Sink                   // Optional sinks receiving the events, more can be added while the node runs.
+	CheckpointKeys []database.AccountID     // Accounts trusted to sign checkpoints, none turns checkpoints off.
+	CheckpointFreq uint64                   // Number of blocks between the checkpoints this node signs when it's a trusted account, 0 never signs.
+	TrustedPeers   []string                 // Hosts of the peers trusted for a fast sync, skipping the expensive block rules for their blocks.
 }
 
 // State manages the blockchain database.
 type State struct {
-	mu          sync.RWMutex
-	resyncWG    sync.WaitGroup
-	allowMining bool
+	mu             sync.RWMutex
+	resyncWG       sync.WaitGroup
+	syncing        syncTracker
+	allowMining    bool
+	miningDisabled bool
 
 	beneficiaryID database.AccountID
+	privateKey    *ecdsa.PrivateKey
+	blsKey        *signature.BLSPrivateKey
 	host          string
+	nodeID        string
 	evHandler     EventHandler
 	consensus     string
+	finalityDepth uint64
+	miningTimeout time.Duration
+	minTrans      int
+	maxWait       time.Duration
+	minTips       uint64
+	emptyBlocks   time.Duration
+	hashRate      database.HashRate
+	journal       *journal.Journal
+	faults        *chaos.Faults
+	delivered     blockDeliveries
+	seen          seenBlocks
+	future        futureBlocks
+	orphans       orphanPool
+	production    productionTracker
+	sinks         *sinkSet
+	watched       watchList
+	checkpoints   *checkpointSet
+	votes         votePool
+	inventory     blockInventory
+	reverted      revertedBlocks
+	observed      blockObserver
+	addrs         preferredAddrs
+	slots         peerSlots
+	latency       peerLatencies
+	etags         peerETags
+	peerTokens    peerTokens
+	maxInbound    int
+	maxOutbound   int
+	minTip        uint64
+	chainScoped   bool
+	slash         bool
+	compactRelay  bool
+	tracer        *tracing.Tracer
+	policy        Policy
+	policyBlocks  bool
+	nodeStatePath string
+	trustedPeers  map[string]bool
 
 	knownPeers *peer.PeerSet
+	client     http.Client
 	storage    database.Storage
 	genesis    genesis.Genesis
 	mempool    *mempool.Mempool
@@ -86,17 +171,19 @@ type State struct {
 // New constructs a new blockchain for data management.
 func New(cfg Config) (*State, error) {
 
-	// Build a safe event handler function for use.
+	// Build a safe event handler function for use. The log messages are also
+	// sent to the sinks that want them.
+	sinks := new(sinkSet)
 	ev := func(v string, args ...any) {
 		if cfg.EvHandler != nil {
 			cfg.EvHandler(v, args...)
 		}
+		sinks.log(v, args...)
 	}
 
-	// Access the storage for the blockchain.
-	db, err := database.New(cfg.Genesis, cfg.Storage, ev)
-	if err != nil {
-		return nil, err
+	// A node can't propose blocks under PoS without a key to sign them.
+	if cfg.Consensus == ConsensusPOS && cfg.PrivateKey == nil {
+		return nil, errors.New("proof of stake requires a private key to sign blocks")
 	}
 
 	// Construct a mempool with the specified sort strategy.
@@ -105,21 +192,84 @@ func New(cfg Config) (*State, error) {
 		return nil, err
 	}
 
+	// Start the sinks before the storage is opened so they see its events.
+	for _, sink := range cfg.Sinks {
+		if err := sinks.add(sink); err != nil {
+			sinks.shutdown()
+			return nil, err
+		}
+	}
+
+	// Access the storage for the blockchain.
+	db, err := database.NewWithCache(cfg.Genesis, cfg.Storage, cfg.BlockCacheSize, ev)
+	if err != nil {
+		sinks.shutdown()
+		return nil, err
+	}
+
+	// Under PoS a block must also be signed by the validator selected to
+	// propose it, which is checked once the rest of the block is valid.
+	if cfg.Consensus == ConsensusPOS {
+		db.Pipeline().Append(database.Rule{
+			Name: RuleProposer,
+			Desc: "block is signed by the selected proposer",
+			Check: func(bc database.BlockCheck) error {
+				return bc.DB.ValidateProposer(bc.Block)
+			},
+		})
+	}
+
+	trustedPeers := make(map[string]bool, len(cfg.TrustedPeers))
+	for _, host := range cfg.TrustedPeers {
+		trustedPeers[host] = true
+	}
+
 	// Create the State to provide support for managing the blockchain.
 	state := State{
 		beneficiaryID: cfg.BeneficiaryID,
+		privateKey:    cfg.PrivateKey,
+		blsKey:        cfg.BLSKey,
 		host:          cfg.Host,
+		nodeID:        cfg.NodeID,
 		storage:       cfg.Storage,
 		evHandler:     ev,
 		consensus:     cfg.Consensus,
+		finalityDepth: cfg.FinalityDepth,
+		miningTimeout: cfg.MiningTimeout,
+		minTrans:      cfg.MiningMinTrans,
+		maxWait:       cfg.MiningMaxWait,
+		minTips:       cfg.MiningMinTips,
+		emptyBlocks:   cfg.EmptyBlocks,
+		journal:       cfg.Journal,
+		faults:        cfg.Faults,
+		compactRelay:  cfg.CompactRelay,
+		tracer:        cfg.Tracer,
+		policy:        cfg.Policy,
+		policyBlocks:  cfg.PolicyBlocks,
+		slash:         cfg.Slash,
+		maxInbound:    cfg.MaxInbound,
+		maxOutbound:   cfg.MaxOutbound,
+		minTip:        cfg.MinTip,
+		chainScoped:   cfg.ChainScoped,
+		nodeStatePath: cfg.NodeStatePath,
+		trustedPeers:  trustedPeers,
+		checkpoints:   newCheckpointSet(cfg.CheckpointKeys, cfg.CheckpointFreq),
+		sinks:         sinks,
 		allowMining:   true,
 
 		knownPeers: cfg.KnownPeers,
+		client:     http.Client{Transport: cfg.Transport},
 		genesis:    cfg.Genesis,
 		mempool:    mempool,
 		db:         db,
 	}
 
+	// Pick up the pending transactions and peers from before the node was
+	// restarted. The node can still start without them.
+	if err := state.restoreNodeState(); err != nil {
+		ev("state: New: WARNING: unable to restore node state: %s", err)
+	}
+
 	// The Worker is not set here. The call to worker.Run will assign itself
 	// and start everything up and running for the node.
 
@@ -131,6 +281,9 @@ func (s *State) Shutdown() error {
 	s.evHandler("state: shutdown: started")
 	defer s.evHandler("state: shutdown: completed")
 
+	// Let the sinks handle the events already sent to them.
+	defer s.sinks.shutdown()
+
 	// Make sure the database file is properly closed.
 	defer func() {
 		s.db.Close()
@@ -142,18 +295,26 @@ func (s *State) Shutdown() error {
 	// Wait for any resync to finish.
 	s.resyncWG.Wait()
 
+	// Keep the pending transactions and peers for the next start now that
+	// nothing changes them anymore.
+	if err := s.saveNodeState(); err != nil {
+		s.evHandler("state: shutdown: WARNING: unable to save node state: %s", err)
+		return err
+	}
+
 	return nil
 }
 
 // =============================================================================
 
 // IsMiningAllowed identifies if we are allowed to mine blocks. This
-// might be turned off if the blockchain needs to be re-synced.
+// might be turned off if the blockchain needs to be re-synced or by
+// an operator.
 func (s *State) IsMiningAllowed() bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
 
-	return s.allowMining
+	return s.allowMining && !s.miningDisabled
 }
 
 // Host returns a copy of host information.
@@ -161,11 +322,37 @@ func (s *State) Host() string {
 	return s.host
 }
 
+// NodeID returns the fingerprint of the identity this node is known by.
+func (s *State) NodeID() string {
+	return s.nodeID
+}
+
 // Consensus returns a copy of consensus algorithm being used.
 func (s *State) Consensus() string {
 	return s.consensus
 }
 
+// Faults returns the faults injected into the node, nil if there are none.
+func (s *State) Faults() *chaos.Faults {
+	return s.faults
+}
+
+// Tracer returns the tracer recording spans, nil if tracing is turned off.
+func (s *State) Tracer() *tracing.Tracer {
+	return s.tracer
+}
+
+// BeneficiaryID returns the account credited for the blocks this node creates.
+func (s *State) BeneficiaryID() database.AccountID {
+	return s.beneficiaryID
+}
+
+// NextProposer returns the validator selected to propose the next block
+// under PoS.
+func (s *State) NextProposer() (database.AccountID, error) {
+	return s.db.NextProposer()
+}
+
 // Genesis returns a copy of the genesis information.
 func (s *State) Genesis() genesis.Genesis {
 	return s.genesis
@@ -176,6 +363,17 @@ func (s *State) LatestBlock() database.Block {
 	return s.db.LatestBlock()
 }
 
+// CheckStorage reports if blocks can still be written to storage. Storage
+// that can't check this is assumed to be writable.
+func (s *State) CheckStorage() error {
+	wc, ok := s.storage.(database.WriteChecker)
+	if !ok {
+		return nil
+	}
+
+	return wc.CheckWritable()
+}
+
 // MempoolLength returns the current length of the mempool.
 func (s *State) MempoolLength() int {
 	return s.mempool.Count()
@@ -186,26 +384,57 @@ func (s *State) Mempool() []database.BlockTx {
 	return s.mempool.PickBest()
 }
 
-// UpsertMempool adds a new transaction to the mempool.
-func (s *State) UpsertMempool(tx database.BlockTx) error {
-	return s.mempool.Upsert(tx)
+// UpsertMempool adds a new transaction to the mempool. The transaction must
+// have a proper signature for this chain.
+func (s *State) UpsertMempool(tx database.BlockTx) (err error) {
+	defer func() {
+		s.record(journal.Entry{Kind: JournalMempoolTx}, tx, err)
+	}()
+
+	if err := tx.Validate(s.genesis.ChainID); err != nil {
+		return errcode.Wrap(errcode.InvalidTx, err)
+	}
+
+	if err := s.addToMempool(tx); err != nil {
+		return err
+	}
+	s.mempoolAddEvent(tx)
+
+	return nil
+}
+
+// BlockCacheStats returns the current statistics for the block cache.
+func (s *State) BlockCacheStats() database.CacheStats {
+	return s.db.CacheStats()
+}
+
+// ValidationStats returns the time spent in each rule validating the blocks
+// added to the chain.
+func (s *State) ValidationStats() []database.RuleStats {
+	return s.db.Pipeline().Stats()
 }
 
-// Accounts returns a copy of the database accounts.
-func (s *State) Accounts() map[database.AccountID]database.Account {
-	return s.db.Copy()
+// Accounts returns a read-only snapshot of the database accounts.
+func (s *State) Accounts() database.AccountSnapshot {
+	return s.db.Snapshot()
 }
 
 // AddKnownPeer provides the ability to add a new peer to
-// the known peer list.
+// the known peer list, if there is a free outbound slot or a worse peer
+// to evict.
 func (s *State) AddKnownPeer(peer peer.Peer) bool {
-	return s.knownPeers.Add(peer)
+	return s.admitPeer(peer, false)
 }
 
 // RemoveKnownPeer provides the ability to remove a peer from
-// the known peer list.
+// the known peer list. The next status from every peer returns all of its
+// peers, so a removed peer another node still knows is found again.
 func (s *State) RemoveKnownPeer(peer peer.Peer) {
 	s.knownPeers.Remove(peer)
+	s.slots.forget(peer.Host)
+	s.latency.forget(peer.Host)
+	s.peerTokens.reset()
+	s.peerEvent(PeerRemove, peer)
 }
 
 // KnownExternalPeers retrieves a copy of the known peer list without
@@ -214,6 +443,12 @@ func (s *State) KnownExternalPeers() []peer.Peer {
 	return s.knownPeers.Copy(s.host)
 }
 
+// KnownExternalPeersSince retrieves the known peers, without including this
+// node, changed since the token handed out with a previous call.
+func (s *State) KnownExternalPeersSince(token string) peer.PeerDelta {
+	return s.knownPeers.Since(s.host, token)
+}
+
 // KnownPeers retrieves a copy of the full known peer list which includes
 // this node as well. Used by the PoA selection algorithm.
 func (s *State) KnownPeers() []peer.Peer {
@@ -1,16 +1,33 @@
 package state_test
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/policy"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/signature"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
 	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 	"github.com/ethereum/go-ethereum/crypto"
 )
 
@@ -65,7 +82,7 @@ func Test_MineAndSyncBlock(t *testing.T) {
 		t.Fatalf("Error mining new block: %v", err)
 	}
 
-	err = node2.ProcessProposedBlock(blk)
+	_, err = node2.ProcessProposedBlock(blk)
 	if err != nil {
 		t.Fatalf("Error proposing new block: %v", err)
 	}
@@ -105,7 +122,7 @@ func Test_ProposeBlockValidation(t *testing.T) {
 	}
 
 	t.Run("Force ErrChainRaised", proposeBlockErrChainRaised(blocks))
-	t.Run("One missing block", proposeBlockOneMissingBlock(blocks))
+	t.Run("Block before its parent", proposeBlockBeforeParent(blocks))
 }
 
 // proposeBlockErrChainRaised validates an ErrChainForked error is returned
@@ -119,7 +136,7 @@ func proposeBlockErrChainRaised(blocks []database.Block) func(t *testing.T) {
 		for i, blk := range blocks[:blocksToHave-2] {
 			switch {
 			case i < 10:
-				if err := node2.ProcessProposedBlock(blk); err != nil {
+				if _, err := node2.ProcessProposedBlock(blk); err != nil {
 					t.Fatalf("Error proposing new block %d: %v", i, err)
 				}
 
@@ -127,7 +144,7 @@ func proposeBlockErrChainRaised(blocks []database.Block) func(t *testing.T) {
 				continue
 
 			case i == 12:
-				err := node2.ProcessProposedBlock(blk)
+				_, err := node2.ProcessProposedBlock(blk)
 				if !errors.Is(err, database.ErrChainForked) {
 					t.Fatal("Error handling missing blocks: should have received ErrChainForked")
 				}
@@ -138,33 +155,2766 @@ func proposeBlockErrChainRaised(blocks []database.Block) func(t *testing.T) {
 	return f
 }
 
-// proposeBlockOneMissingBlock will validate an error occurs when blocks are out
-// of order. It does this by adding the first 10 blocks to node2, then skipping
-// block #11, and finally trying to add block #12. Remember zero indexing.
-func proposeBlockOneMissingBlock(blocks []database.Block) func(t *testing.T) {
+// proposeBlockBeforeParent will validate a block that arrives before its
+// parent is held and added once the parent arrives. It does this by adding
+// the first 10 blocks to node2, then adding block #12 before block #11.
+// Remember zero indexing.
+func proposeBlockBeforeParent(blocks []database.Block) func(t *testing.T) {
 	f := func(t *testing.T) {
 		node2 := newNode(miner2PrivateKey, t)
 
-		for i, blk := range blocks[:blocksToHave-2] {
-			switch {
-			case i < 10:
-				if err := node2.ProcessProposedBlock(blk); err != nil {
-					t.Fatalf("Error proposing new block %d: %v", i, err)
-				}
+		for i, blk := range blocks[:10] {
+			if _, err := node2.ProcessProposedBlock(blk); err != nil {
+				t.Fatalf("Error proposing new block %d: %v", i, err)
+			}
+		}
+
+		status, err := node2.ProcessProposedBlock(blocks[11])
+		if err != nil || status != state.BlockBuffered {
+			t.Logf("got: %s, %v", status, err)
+			t.Logf("exp: %s", state.BlockBuffered)
+			t.Fatal("Error handling block before its parent: should have held the block")
+		}
+
+		if got := node2.LatestBlock().Header.Number; got != 10 {
+			t.Logf("got: %d", got)
+			t.Logf("exp: %d", 10)
+			t.Fatal("Error handling block before its parent: should not add the block yet")
+		}
+
+		if _, err := node2.ProcessProposedBlock(blocks[10]); err != nil {
+			t.Fatalf("Error proposing new block %d: %v", 10, err)
+		}
+
+		if got := node2.LatestBlock().Hash(); got != blocks[11].Hash() {
+			t.Logf("got: %s", got)
+			t.Logf("exp: %s", blocks[11].Hash())
+			t.Fatal("Error handling block before its parent: should add the held block after its parent")
+		}
+	}
+
+	return f
+}
+
+// =============================================================================
+
+// Test_Finality validates blocks buried under the finality depth are final
+// and a reorganization only rolls the chain back to the finalized block.
+func Test_Finality(t *testing.T) {
+	const finalityDepth = 5
+
+	node := newNodeWithFinality(miner1PrivateKey, finalityDepth, t)
+
+	if blk := node.LatestFinalizedBlock(); blk.Header.Number != 0 {
+		t.Fatalf("Should not have a finalized block on an empty chain, got %d", blk.Header.Number)
+	}
+
+	for i := 1; i <= blocksToHave; i++ {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   uint64(i),
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+	}
+
+	const finalized = blocksToHave - finalityDepth
+
+	if blk := node.LatestFinalizedBlock(); blk.Header.Number != finalized {
+		t.Logf("got: %d", blk.Header.Number)
+		t.Logf("exp: %d", finalized)
+		t.Fatalf("Should have the block under the finality depth finalized.")
+	}
+
+	if blocks := node.QueryBlocksByNumber(context.Background(), 1, state.QueryFinalized); len(blocks) != finalized {
+		t.Logf("got: %d", len(blocks))
+		t.Logf("exp: %d", finalized)
+		t.Fatalf("Should only return the finalized blocks.")
+	}
+
+	blocks, err := node.QueryFinalizedBlocksByAccount(context.Background(), kennedyAccountID)
+	if err != nil {
+		t.Fatalf("Error querying finalized blocks: %v", err)
+	}
+	if len(blocks) != finalized {
+		t.Logf("got: %d", len(blocks))
+		t.Logf("exp: %d", finalized)
+		t.Fatalf("Should only return the finalized blocks for the account.")
+	}
+
+	if err := node.Reorganize(); err != nil {
+		t.Fatalf("Error reorganizing the chain: %v", err)
+	}
+
+	if blk := node.LatestBlock(); blk.Header.Number != finalized {
+		t.Logf("got: %d", blk.Header.Number)
+		t.Logf("exp: %d", finalized)
+		t.Fatalf("Should keep the finalized blocks on a reorganization.")
+	}
+
+	account, err := node.QueryAccount(kennedyAccountID)
+	if err != nil {
+		t.Fatalf("Error querying account: %v", err)
+	}
+	if account.Nonce != finalized {
+		t.Logf("got: %d", account.Nonce)
+		t.Logf("exp: %d", finalized)
+		t.Fatalf("Should have the account state at the finalized block.")
+	}
+}
+
+// =============================================================================
+
+// Test_ChainHead validates a transaction is applied once when a node mines it
+// while the same transaction arrives in a block from a peer, and that the
+// mempool is reconciled at each change of the latest block.
+func Test_ChainHead(t *testing.T) {
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+
+	t.Run("mine and sync", func(t *testing.T) {
+		node1 := newNode(miner1PrivateKey, t)
+		node2 := newNode(miner2PrivateKey, t)
+
+		if err := node1.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+		blk, err := node1.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		if err := node2.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		// Only one of the blocks can become block 1, the other no longer
+		// builds on the latest block once the first is applied.
+		errs := make(chan error, 2)
+		go func() {
+			_, err := node2.MineNewBlock(context.Background())
+			errs <- err
+		}()
+		go func() {
+			_, err := node2.ProcessProposedBlock(blk)
+			errs <- err
+		}()
+
+		var applied int
+		for i := 0; i < 2; i++ {
+			if err := <-errs; err == nil {
+				applied++
+			}
+		}
+
+		if applied != 1 {
+			t.Logf("got: %d", applied)
+			t.Logf("exp: %d", 1)
+			t.Fatalf("Should only apply one block at the same height.")
+		}
+
+		account, err := node2.QueryAccount(kennedyAccountID)
+		if err != nil {
+			t.Fatalf("Error querying account: %v", err)
+		}
+
+		const balance = 1000000 - 1 - 15
+		if account.Nonce != 1 || account.Balance != balance {
+			t.Logf("got: nonce %d, balance %d", account.Nonce, account.Balance)
+			t.Logf("exp: nonce %d, balance %d", 1, balance)
+			t.Fatalf("Should only apply the transaction once.")
+		}
+
+		if n := node2.MempoolLength(); n != 0 {
+			t.Logf("got: %d", n)
+			t.Logf("exp: %d", 0)
+			t.Fatalf("Should have removed the mined transaction from the mempool.")
+		}
+
+		// The transaction is shared again after it was mined.
+		if err := node2.UpsertNodeTransaction(blk.MerkleTree.Values()[0]); !errors.Is(err, state.ErrStaleNonce) {
+			t.Logf("got: %v", err)
+			t.Logf("exp: %v", state.ErrStaleNonce)
+			t.Fatalf("Should not accept a transaction that was already mined.")
+		}
+	})
+
+	t.Run("rollback", func(t *testing.T) {
+		const finalityDepth = 2
+
+		node := newNodeWithFinality(miner1PrivateKey, finalityDepth, t)
+
+		for i := 1; i <= 4; i++ {
+			tx := tx
+			tx.Nonce = uint64(i)
+
+			if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+				t.Fatalf("Error upserting wallet transaction: %v", err)
+			}
+			if _, err := node.MineNewBlock(context.Background()); err != nil {
+				t.Fatalf("Error mining new block: %v", err)
+			}
+		}
+
+		if err := node.Reorganize(); err != nil {
+			t.Fatalf("Error reorganizing the chain: %v", err)
+		}
+
+		if n := node.MempoolLength(); n != finalityDepth {
+			t.Logf("got: %d", n)
+			t.Logf("exp: %d", finalityDepth)
+			t.Fatalf("Should have restored the transactions of the removed blocks.")
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Error mining new block: %v", err)
+		}
+
+		account, err := node.QueryAccount(kennedyAccountID)
+		if err != nil {
+			t.Fatalf("Error querying account: %v", err)
+		}
+		if account.Nonce != 4 {
+			t.Logf("got: %d", account.Nonce)
+			t.Logf("exp: %d", 4)
+			t.Fatalf("Should be able to mine the restored transactions.")
+		}
+	})
+}
+
+// Test_SyncStatus validates only one sync runs at a time and its progress is
+// reported.
+func Test_SyncStatus(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	if status := node.SyncStatus(); status.State != state.SyncIdle {
+		t.Logf("got: %s", status.State)
+		t.Logf("exp: %s", state.SyncIdle)
+		t.Fatalf("Should not be syncing on a new node.")
+	}
+
+	end := node.BeginSync()
+	node.SyncTarget("0.0.0.0:9180", 10)
+	node.SyncTarget("0.0.0.0:9280", 5)
+
+	status := node.SyncStatus()
+	if status.State != state.SyncSyncing || status.Peer != "0.0.0.0:9280" || status.TargetBlock != 10 || status.Started == nil {
+		t.Logf("got: %+v", status)
+		t.Fatalf("Should report the progress of the sync.")
+	}
+
+	// A second sync waits for the first one to complete.
+	started := make(chan func())
+	go func() {
+		started <- node.BeginSync()
+	}()
+
+	for i := 0; node.SyncStatus().Queued != 1; i++ {
+		if i == 100 {
+			t.Fatalf("Should queue the second sync.")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	select {
+	case <-started:
+		t.Fatalf("Should not start a second sync while one is running.")
+	default:
+	}
+
+	end()
+	end = <-started
+
+	if status := node.SyncStatus(); status.State != state.SyncSyncing || status.Queued != 0 || status.TargetBlock != 0 {
+		t.Logf("got: %+v", status)
+		t.Fatalf("Should start the queued sync once the first one completes.")
+	}
+
+	end()
+
+	if status := node.SyncStatus(); status.State != state.SyncIdle {
+		t.Logf("got: %s", status.State)
+		t.Logf("exp: %s", state.SyncIdle)
+		t.Fatalf("Should be idle once the syncs complete.")
+	}
+}
+
+// Test_SyncProgress validates the progress of a sync is estimated and
+// reported, and a failing sync can be told apart from one that is behind.
+func Test_SyncProgress(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	var actions []string
+	node2 := newNodeWithConfig(miner2PrivateKey, t, func(cfg *state.Config) {
+		cfg.EvHandler = func(v string, args ...any) {
+			s := fmt.Sprintf(v, args...)
+			if strings.HasPrefix(s, "viewer: sync: ") {
+				var ev state.SyncEvent
+				json.Unmarshal([]byte(strings.TrimPrefix(s, "viewer: sync: ")), &ev)
+				actions = append(actions, ev.Action)
+			}
+		}
+	})
+
+	end := node2.BeginSync()
+	node2.SyncTarget("0.0.0.0:9180", 4)
+
+	time.Sleep(20 * time.Millisecond)
+	if _, err := node2.ProcessProposedBlock(block); err != nil {
+		t.Fatalf("Should be able to add the block: %v", err)
+	}
+
+	status := node2.SyncStatus()
+	if status.StartBlock != 0 || status.CurrentBlock != 1 || status.Behind != 3 || status.Remaining < 40 {
+		t.Logf("got: %+v", status)
+		t.Fatalf("Should estimate the time remaining from the blocks added so far.")
+	}
+
+	node2.SyncError("0.0.0.0:9180", errors.New("peer is down"))
+	end()
+
+	status = node2.SyncStatus()
+	if status.State != state.SyncIdle || status.Behind != 3 || status.Error != "peer is down" || status.Completed == nil || status.Remaining != 0 {
+		t.Logf("got: %+v", status)
+		t.Fatalf("Should keep the outcome of the last sync once it completes.")
+	}
+
+	exp := []string{state.SyncStart, state.SyncFail, state.SyncComplete}
+	if fmt.Sprint(actions) != fmt.Sprint(exp) {
+		t.Logf("got: %v", actions)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should report the progress of the sync as events.")
+	}
+}
+
+// Test_NetCancel validates a request to a peer is abandoned once the context
+// is cancelled instead of waiting for the peer to respond.
+func Test_NetCancel(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	defer srv.Close()
+
+	node := newNode(miner1PrivateKey, t)
+	pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	if _, err := node.NetRequestPeerStatus(ctx, pr); !errors.Is(err, context.DeadlineExceeded) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", context.DeadlineExceeded)
+		t.Fatalf("Should abandon the request when the context is done.")
+	}
+}
+
+// Test_NetConditional validates a repeated request to a peer is conditional
+// on the entity tag of the last response, which is used again when the peer
+// responds that nothing changed.
+func Test_NetConditional(t *testing.T) {
+	var notModified int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const etag = `"status-7"`
+
+		w.Header().Set("ETag", etag)
+		if r.Header.Get("If-None-Match") == etag {
+			atomic.AddInt32(&notModified, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"latest_block_number":7}`))
+	}))
+	defer srv.Close()
+
+	node := newNode(miner1PrivateKey, t)
+	pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+	for i := 0; i < 2; i++ {
+		ps, err := node.NetRequestPeerStatus(context.Background(), pr)
+		if err != nil {
+			t.Fatalf("Should be able to request the peer status: %v", err)
+		}
+		if ps.LatestBlockNumber != 7 {
+			t.Logf("got: %d", ps.LatestBlockNumber)
+			t.Logf("exp: %d", 7)
+			t.Fatalf("Should return the status of the peer.")
+		}
+	}
+
+	if n := atomic.LoadInt32(&notModified); n != 1 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should make the second request conditional on the entity tag.")
+	}
+}
+
+// Test_NetPeerDelta validates a repeated status request to a peer asks for
+// only the peers changed since the token handed out with the last status.
+func Test_NetPeerDelta(t *testing.T) {
+	var since []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		since = append(since, r.URL.Query().Get("since"))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"latest_block_number":7,"peers_token":"epoch.3"}`))
+	}))
+	defer srv.Close()
+
+	node := newNode(miner1PrivateKey, t)
+	pr := peer.New(strings.TrimPrefix(srv.URL, "http://"))
+
+	for i := 0; i < 2; i++ {
+		if _, err := node.NetRequestPeerStatus(context.Background(), pr); err != nil {
+			t.Fatalf("Should be able to request the peer status: %v", err)
+		}
+	}
+
+	if exp := []string{"", "epoch.3"}; fmt.Sprint(since) != fmt.Sprint(exp) {
+		t.Logf("got: %q", since)
+		t.Logf("exp: %q", exp)
+		t.Fatalf("Should send the token from the last status.")
+	}
+
+	node.RemoveKnownPeer(peer.New("10.0.0.9:9080"))
+
+	if _, err := node.NetRequestPeerStatus(context.Background(), pr); err != nil {
+		t.Fatalf("Should be able to request the peer status: %v", err)
+	}
+
+	if got := since[len(since)-1]; got != "" {
+		t.Logf("got: %q", got)
+		t.Logf("exp: %q", "")
+		t.Fatalf("Should ask for all the peers again after removing a peer.")
+	}
+}
+
+// Test_BroadcastBlock validates a block is delivered to every peer, failed
+// deliveries are retried and peers that have the block aren't sent it again.
+func Test_BroadcastBlock(t *testing.T) {
+	var requests [3]int32
+	handlers := [3]http.HandlerFunc{
+		func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&requests[0], 1) == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			w.Write([]byte(`{"status":"accepted"}`))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests[1], 1)
+			w.WriteHeader(http.StatusNotAcceptable)
+			w.Write([]byte("block not accepted"))
+		},
+		func(w http.ResponseWriter, r *http.Request) {
+			atomic.AddInt32(&requests[2], 1)
+			w.Write([]byte(`{"status":"accepted"}`))
+		},
+	}
+
+	peers := peer.NewPeerSet()
+	hosts := make([]string, len(handlers))
+	for i, h := range handlers {
+		mux := http.NewServeMux()
+		mux.HandleFunc("/v1/node/block/announce", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"status":"wanted"}`))
+		})
+		mux.Handle("/v1/node/block/propose", h)
+
+		srv := httptest.NewServer(mux)
+		defer srv.Close()
+
+		hosts[i] = strings.TrimPrefix(srv.URL, "http://")
+		peers.Add(peer.New(hosts[i]))
+	}
+
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.KnownPeers = peers
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	err = node.NetSendBlockToPeers(context.Background(), block)
+
+	var be *state.BroadcastError
+	if !errors.As(err, &be) {
+		t.Fatalf("Should report the peer that rejected the block, got %v.", err)
+	}
+
+	if len(be.Failed) != 1 || be.Failed[0].Host != hosts[1] || be.Failed[0].Attempts != 1 {
+		t.Logf("got: %+v", be.Failed)
+		t.Logf("exp: %s after 1 attempt", hosts[1])
+		t.Fatalf("Should only fail the peer that rejected the block without retrying.")
+	}
+
+	exp := []string{hosts[0], hosts[2]}
+	sort.Strings(exp)
+	if got := node.BlockDeliveredTo(block.Hash()); fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should record the peers the block was delivered to.")
+	}
+
+	if got := atomic.LoadInt32(&requests[0]); got != 2 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should retry the peer that failed to handle the block.")
+	}
+
+	node.NetSendBlockToPeers(context.Background(), block)
+
+	got := [3]int32{atomic.LoadInt32(&requests[0]), atomic.LoadInt32(&requests[1]), atomic.LoadInt32(&requests[2])}
+	if got != [3]int32{2, 2, 1} {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", [3]int32{2, 2, 1})
+		t.Fatalf("Should only send the block again to the peer that doesn't have it.")
+	}
+}
+
+// Test_BlockAnnouncement validates a node only asks for a block it doesn't
+// have and only from the first peer announcing it.
+func Test_BlockAnnouncement(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	tests := []struct {
+		name string
+		ba   state.BlockAnnouncement
+		exp  string
+	}{
+		{"known", state.BlockAnnouncement{Hash: "0x01", Number: 0}, state.AnnounceKnown},
+		{"wanted", state.BlockAnnouncement{Hash: "0x02", Number: 1}, state.AnnounceWanted},
+		{"pending", state.BlockAnnouncement{Hash: "0x02", Number: 1}, state.AnnouncePending},
+		{"fork", state.BlockAnnouncement{Hash: "0x03", Number: 1}, state.AnnounceWanted},
+	}
+
+	for _, tt := range tests {
+		if got := node.ProcessBlockAnnouncement(tt.ba).Status; got != tt.exp {
+			t.Logf("got: %s", got)
+			t.Logf("exp: %s", tt.exp)
+			t.Fatalf("Should respond to the %s block with the expected status.", tt.name)
+		}
+	}
+}
+
+// Test_QueryMempool validates the pending transactions are reported with
+// why they can or can't be mined and can be filtered, sorted and paged.
+func Test_QueryMempool(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	txs := []database.Tx{
+		{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Tip: 5},
+		{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: ceasarAccountID, Value: 1, Tip: 1},
+		{ChainID: chainID, Nonce: 4, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Tip: 9},
+	}
+	for _, tx := range txs {
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+	}
+
+	page, err := node.QueryMempool(state.MempoolFilter{Desc: true})
+	if err != nil {
+		t.Fatalf("Should be able to query the mempool: %v", err)
+	}
+
+	var got []string
+	for _, tx := range page.Txs {
+		got = append(got, fmt.Sprintf("%d:%s", tx.Nonce, tx.Status))
+
+		if tx.FromID != kennedyAccountID || tx.Size == 0 || tx.Age < 0 {
+			t.Fatalf("Should report the sender, size and age of the transaction: %+v", tx)
+		}
+	}
+
+	exp := []string{"4:nonce_gap", "1:ready", "2:ready"}
+	if page.Total != 3 || fmt.Sprint(got) != fmt.Sprint(exp) {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should sort the transactions by tip with their status.")
+	}
+
+	page, err = node.QueryMempool(state.MempoolFilter{SortBy: state.MempoolSortNonce, Offset: 1, Limit: 1})
+	if err != nil {
+		t.Fatalf("Should be able to query the mempool: %v", err)
+	}
+	if page.Total != 3 || len(page.Txs) != 1 || page.Txs[0].Nonce != 2 {
+		t.Logf("got: %+v", page)
+		t.Logf("exp: nonce 2 of 3")
+		t.Fatalf("Should return the requested page.")
+	}
+
+	page, err = node.QueryMempool(state.MempoolFilter{Account: ceasarAccountID})
+	if err != nil || page.Total != 1 || page.Txs[0].Nonce != 2 {
+		t.Fatalf("Should only return the transactions for the account: %+v: %v", page, err)
+	}
+
+	page, err = node.QueryMempool(state.MempoolFilter{Status: state.PendingNonceGap})
+	if err != nil || page.Total != 1 || page.Txs[0].Nonce != 4 {
+		t.Fatalf("Should only return the transactions waiting on a nonce: %+v: %v", page, err)
+	}
+
+	if _, err := node.QueryMempool(state.MempoolFilter{SortBy: "fee"}); err == nil {
+		t.Fatalf("Should reject an unknown sort field.")
+	}
+}
+
+// Test_CancelTx validates a pending transaction is replaced by the
+// cancellation built for it and only the cancellation is mined.
+func Test_CancelTx(t *testing.T) {
+	var events []string
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.EvHandler = func(v string, args ...any) {
+			if s := fmt.Sprintf(v, args...); strings.HasPrefix(s, "viewer: mempool: ") {
+				events = append(events, s)
+			}
+		}
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	if _, err := node.CancelTx(kennedyAccountID, 2); !errors.Is(err, state.ErrTxNotPending) {
+		t.Fatalf("Should not cancel a transaction that isn't pending, got %v.", err)
+	}
+
+	cancelTx, err := node.CancelTx(kennedyAccountID, 1)
+	if err != nil {
+		t.Fatalf("Should be able to build the cancellation: %v", err)
+	}
+
+	if !cancelTx.IsCancel() || cancelTx.Nonce != 1 || cancelTx.Tip != 6 {
+		t.Logf("got: %+v", cancelTx)
+		t.Logf("exp: cancellation of nonce 1 with tip 6")
+		t.Fatalf("Should build a cancellation with the least tip to replace the transaction.")
+	}
+
+	lowTip := cancelTx
+	lowTip.Tip = 5
+	if err := node.UpsertWalletTransaction(newSignedTx(lowTip, kennedyPrivateKey, t)); err == nil {
+		t.Fatalf("Should not replace the transaction without a higher tip.")
+	}
+
+	signedTx := newSignedTx(cancelTx, kennedyPrivateKey, t)
+	if err := node.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Should be able to cancel the transaction: %v", err)
+	}
+
+	exp := fmt.Sprintf(`viewer: mempool: {"action":"cancel","tx_hash":%q`, signedTx.TxHash())
+	if len(events) != 2 || !strings.HasPrefix(events[1], exp) {
+		t.Logf("got: %v", events)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should report the cancellation.")
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the cancellation: %v", err)
+	}
+
+	if trans := block.MerkleTree.Values(); len(trans) != 1 || !trans[0].IsCancel() {
+		t.Fatalf("Should only mine the cancellation.")
+	}
+
+	kennedy, err := node.QueryAccount(kennedyAccountID)
+	if err != nil {
+		t.Fatalf("Should be able to query the account: %v", err)
+	}
+
+	if _, err := node.QueryAccount(edAccountID); err == nil || kennedy.Nonce != 1 {
+		t.Logf("got: nonce %d", kennedy.Nonce)
+		t.Logf("exp: nonce %d", 1)
+		t.Fatalf("Should use the nonce without moving the value.")
+	}
+}
+
+// Test_Policy validates the node's policy is enforced on the transactions it
+// accepts and mines and only on blocks from peers when configured.
+func Test_Policy(t *testing.T) {
+	accountPolicy, err := policy.New(policy.Lists{Deny: []database.AccountID{edAccountID}})
+	if err != nil {
+		t.Fatalf("Should be able to construct the policy: %v", err)
+	}
+
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNodeWithConfig(miner2PrivateKey, t, func(cfg *state.Config) {
+		cfg.Policy = accountPolicy
+	})
+	node3 := newNodeWithConfig(miner3PrivateKey, t, func(cfg *state.Config) {
+		cfg.Policy = accountPolicy
+		cfg.PolicyBlocks = true
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5}
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+
+	if err := node2.UpsertWalletTransaction(signedTx); !errors.Is(err, policy.ErrDenied) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", policy.ErrDenied)
+		t.Fatalf("Should reject a transaction to a denied account.")
+	}
+
+	if err := node1.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Should be able to add the transaction without a policy: %v", err)
+	}
+
+	block, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if _, err := node2.ProcessProposedBlock(block); err != nil {
+		t.Fatalf("Should accept a block breaking the policy by default: %v", err)
+	}
+
+	if _, err := node3.ProcessProposedBlock(block); !errors.Is(err, policy.ErrDenied) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", policy.ErrDenied)
+		t.Fatalf("Should reject a block breaking the policy when configured.")
+	}
+
+	tx = database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: ceasarAccountID, Value: 100, Tip: 5}
+	if err := node2.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add an allowed transaction: %v", err)
+	}
+
+	if err := accountPolicy.Update(policy.Lists{Deny: []database.AccountID{ceasarAccountID}}); err != nil {
+		t.Fatalf("Should be able to update the policy: %v", err)
+	}
+
+	if _, err := node2.MineNewBlock(context.Background()); !errors.Is(err, state.ErrNoTransactions) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", state.ErrNoTransactions)
+		t.Fatalf("Should not mine a pending transaction the updated policy rejects.")
+	}
+
+	if n := node2.MempoolLength(); n != 0 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 0)
+		t.Fatalf("Should remove the rejected transaction from the mempool.")
+	}
+}
+
+// Test_CanonicalEncoding validates blocks and transactions switch to the
+// canonical encoding at the block set in the genesis file.
+func Test_CanonicalEncoding(t *testing.T) {
+	canonical := func(cfg *state.Config) {
+		cfg.Genesis.CanonicalBlock = 2
+	}
+
+	node1 := newNodeWithConfig(miner1PrivateKey, t, canonical)
+	node2 := newNodeWithConfig(miner2PrivateKey, t, canonical)
+	legacy := newNode(miner3PrivateKey, t)
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5, Encoding: signature.EncodingCanonical}
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err == nil {
+		t.Fatalf("Should not accept a canonical transaction before the switch.")
+	}
+
+	tx.Encoding = signature.EncodingJSON
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block1, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	tx = database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5, Encoding: signature.EncodingCanonical}
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should accept a canonical transaction after the switch: %v", err)
+	}
+
+	block2, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if block1.Header.Encoding != signature.EncodingJSON || block2.Header.Encoding != signature.EncodingCanonical {
+		t.Logf("got: %d %d", block1.Header.Encoding, block2.Header.Encoding)
+		t.Logf("exp: %d %d", signature.EncodingJSON, signature.EncodingCanonical)
+		t.Fatalf("Should mine blocks with the encoding in effect.")
+	}
+
+	for _, blk := range []database.Block{block1, block2} {
+		if _, err := node2.ProcessProposedBlock(blk); err != nil {
+			t.Fatalf("Should accept the blocks on both sides of the switch: %v", err)
+		}
+	}
+
+	if _, err := legacy.ProcessProposedBlock(block1); err != nil {
+		t.Fatalf("Should accept the block before the switch without it: %v", err)
+	}
+
+	if _, err := legacy.ProcessProposedBlock(block2); err == nil {
+		t.Fatalf("Should reject a canonical block without the switch.")
+	}
+}
+
+// Test_BlockVersion validates blocks switch to the hash algorithm of the
+// block version scheduled in the genesis file.
+func Test_BlockVersion(t *testing.T) {
+	upgrade := func(cfg *state.Config) {
+		cfg.Genesis.Upgrades = []genesis.Upgrade{{Version: database.BlockVersionSHA3, Block: 2}}
+	}
+
+	node1 := newNodeWithConfig(miner1PrivateKey, t, upgrade)
+	node2 := newNodeWithConfig(miner2PrivateKey, t, upgrade)
+	legacy := newNode(miner3PrivateKey, t)
+
+	var blocks []database.Block
+	for nonce := uint64(1); nonce <= 2; nonce++ {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5}
+		if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+
+		block, err := node1.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Should be able to mine the block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	if blocks[0].Header.Version != database.BlockVersionSHA256 || blocks[1].Header.Version != database.BlockVersionSHA3 {
+		t.Logf("got: %d %d", blocks[0].Header.Version, blocks[1].Header.Version)
+		t.Logf("exp: %d %d", database.BlockVersionSHA256, database.BlockVersionSHA3)
+		t.Fatalf("Should mine blocks with the version in effect.")
+	}
+
+	if hash := signature.HashWith(blocks[1].Header, signature.SHA3); blocks[1].Hash() != hash {
+		t.Logf("got: %s", blocks[1].Hash())
+		t.Logf("exp: %s", hash)
+		t.Fatalf("Should hash the upgraded block with SHA3-256.")
+	}
+
+	for _, blk := range blocks {
+		if _, err := node2.ProcessProposedBlock(blk); err != nil {
+			t.Fatalf("Should accept the blocks on both sides of the upgrade: %v", err)
+		}
+	}
+
+	if _, err := legacy.ProcessProposedBlock(blocks[0]); err != nil {
+		t.Fatalf("Should accept the block before the upgrade without it: %v", err)
+	}
+
+	if _, err := legacy.ProcessProposedBlock(blocks[1]); err == nil {
+		t.Fatalf("Should reject an upgraded block without the upgrade.")
+	}
+}
+
+// Test_Ed25519Account validates a transaction from an account signing with
+// Ed25519 is accepted, mined and validated by peers.
+func Test_Ed25519Account(t *testing.T) {
+	pk := ed25519.NewKeyFromSeed(make([]byte, ed25519.SeedSize))
+	accountID := database.Ed25519PublicKeyToAccountID(pk.Public().(ed25519.PublicKey))
+
+	fund := func(cfg *state.Config) {
+		cfg.Genesis.Balances[string(accountID)] = 1000
+	}
+
+	node1 := newNodeWithConfig(miner1PrivateKey, t, fund)
+	node2 := newNodeWithConfig(miner2PrivateKey, t, fund)
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: accountID, ToID: edAccountID, Value: 100, Tip: 5}
+	signedTx, err := tx.SignEd25519(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign the transaction: %v", err)
+	}
+
+	if err := node1.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if _, err := node2.ProcessProposedBlock(block); err != nil {
+		t.Fatalf("Should accept the block: %v", err)
+	}
+
+	account, err := node2.QueryAccount(accountID)
+	if err != nil {
+		t.Fatalf("Should be able to query the account: %v", err)
+	}
+
+	if account.Balance != 1000-100-5-15 || account.Nonce != 1 {
+		t.Logf("got: balance %d nonce %d", account.Balance, account.Nonce)
+		t.Logf("exp: balance %d nonce %d", 1000-100-5-15, 1)
+		t.Fatalf("Should apply the transaction.")
+	}
+}
+
+// Test_Votes validates a validator votes for the blocks it applies and the
+// proposer of the next block carries the aggregated votes that peers check.
+func Test_Votes(t *testing.T) {
+	blsKeys := make(map[string]*signature.BLSPrivateKey)
+	pos := func(hexKey string) func(cfg *state.Config) {
+		privateKey, err := crypto.HexToECDSA(hexKey)
+		if err != nil {
+			t.Fatalf("Error constructing private key: %v", err)
+		}
+
+		blsKey, err := signature.DeriveBLSKey(crypto.FromECDSA(privateKey))
+		if err != nil {
+			t.Fatalf("Should be able to derive the bls key: %v", err)
+		}
+		blsKeys[hexKey] = blsKey
+
+		return func(cfg *state.Config) {
+			cfg.Consensus = state.ConsensusPOS
+			cfg.PrivateKey = privateKey
+			cfg.BLSKey = blsKey
+			cfg.Genesis.Balances[string(miner1AccountID)] = 1000000
+			cfg.Genesis.Bonds = map[string]uint64{string(miner1AccountID): 1000}
+		}
+	}
+
+	node1 := newNodeWithConfig(miner1PrivateKey, t, pos(miner1PrivateKey))
+	node2 := newNodeWithConfig(miner2PrivateKey, t, pos(miner2PrivateKey))
+
+	// The validator registers its bls key in the first block.
+	blsKey := blsKeys[miner1PrivateKey]
+	data, err := database.BondOp{Op: database.BondLock, BLSKey: blsKey.PublicKey(), BLSProof: blsKey.ProvePossession()}.Data()
+	if err != nil {
+		t.Fatalf("Should be able to encode the bond operation: %v", err)
+	}
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: miner1AccountID, ToID: edAccountID, Value: 100, Tip: 5, Data: data}
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, miner1PrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block1, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to propose the block: %v", err)
+	}
+
+	if block1.Votes != nil {
+		t.Fatalf("Should not carry votes before any validator registered a bls key.")
+	}
+
+	if _, err := node2.ProcessProposedBlock(block1); err != nil {
+		t.Fatalf("Should accept the block: %v", err)
+	}
+
+	// Only the validator votes, the other node isn't bonded.
+	if votes := node2.Votes(); len(votes) != 0 {
+		t.Fatalf("Should not vote without being a validator: %v", votes)
+	}
+
+	votes := node1.Votes()
+	if len(votes) != 1 || votes[0].VoterID != miner1AccountID || votes[0].BlockHash != block1.Hash() {
+		t.Fatalf("Should vote for the applied block: %v", votes)
+	}
+
+	if err := node2.AddVote(votes[0]); err != nil {
+		t.Fatalf("Should accept the vote from the validator: %v", err)
+	}
+
+	forged := database.NewVote(chainID, block1, miner1AccountID, blsKeys[miner2PrivateKey])
+	if err := node2.AddVote(forged); err == nil {
+		t.Fatalf("Should not accept a vote signed with another key.")
+	}
+
+	tx = database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5}
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block2, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to propose the block: %v", err)
+	}
+
+	if block2.Votes == nil || block2.Votes.Count() != 1 {
+		t.Fatalf("Should carry the vote for the parent block: %+v", block2.Votes)
+	}
+
+	// Votes signed for a different block aren't accepted.
+	bad := block2
+	bad.Votes = &database.Votes{Signers: block2.Votes.Signers, Signature: blsKey.Sign(database.VoteMessage(chainID, block2.Hash()))}
+	if _, err := node2.ProcessProposedBlock(bad); err == nil {
+		t.Fatalf("Should not accept a block with votes for another block.")
+	}
+
+	if _, err := node2.ProcessProposedBlock(block2); err != nil {
+		t.Fatalf("Should accept the block with the votes: %v", err)
+	}
+}
+
+// Test_AccountChecksum validates wallet transactions sent to a mistyped
+// account are rejected while accounts without a checksum are accepted.
+func Test_AccountChecksum(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	mistyped := database.AccountID("0xa988b1866EaBF72B4c53b592c97aAD8e4b9bDCc0")
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: mistyped, Value: 100, Tip: 5}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); !errors.Is(err, database.ErrChecksum) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", database.ErrChecksum)
+		t.Fatalf("Should reject a transaction to a mistyped account.")
+	}
+
+	tx.ToID = database.AccountID(strings.ToLower(string(edAccountID)))
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should accept a transaction to an account without a checksum: %v", err)
+	}
+}
+
+// Test_Names validates a registered name resolves to its owner once the
+// registration is mined.
+func Test_Names(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	data, err := database.NameOp{Op: database.NameRegister, Name: "kennedy"}.Data()
+	if err != nil {
+		t.Fatalf("Should be able to encode the name operation: %v", err)
+	}
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: database.NameAccountID("kennedy"), Data: data}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	if _, err := node.Resolve("kennedy"); !errors.Is(err, database.ErrNameNotFound) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", database.ErrNameNotFound)
+		t.Fatalf("Should not resolve the name before the registration is mined.")
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	accountID, err := node.Resolve("kennedy")
+	if err != nil {
+		t.Fatalf("Should be able to resolve the name: %v", err)
+	}
+
+	if accountID != kennedyAccountID {
+		t.Logf("got: %s", accountID)
+		t.Logf("exp: %s", kennedyAccountID)
+		t.Fatalf("Should resolve the name to the account that registered it.")
+	}
+
+	accountID, err = node.Resolve(string(pavelAccountID))
+	if err != nil || accountID != pavelAccountID {
+		t.Logf("got: %s %v", accountID, err)
+		t.Logf("exp: %s", pavelAccountID)
+		t.Fatalf("Should resolve an account to itself.")
+	}
+}
+
+// Test_SubmitRawTx validates a transaction signed offline in the raw encoding
+// is admitted to the mempool.
+func Test_SubmitRawTx(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	privateKey, err := crypto.HexToECDSA(kennedyPrivateKey)
+	if err != nil {
+		t.Fatalf("Error constructing private key: %v", err)
+	}
+
+	raw, err := database.SignRawTx(database.RawTxArgs{ChainID: chainID, Nonce: 1, ToID: pavelAccountID, Value: 100, Tip: 5}, privateKey)
+	if err != nil {
+		t.Fatalf("Should be able to sign the raw transaction: %v", err)
+	}
+
+	txHash, err := node.SubmitRawTx(raw)
+	if err != nil {
+		t.Fatalf("Should be able to submit the raw transaction: %v", err)
+	}
+
+	mempool := node.Mempool()
+	if len(mempool) != 1 || mempool[0].TxHash() != txHash {
+		t.Logf("got: %v", mempool)
+		t.Logf("exp: %s", txHash)
+		t.Fatalf("Should have the raw transaction in the mempool.")
+	}
+
+	raw, err = database.SignRawTx(database.RawTxArgs{ChainID: chainID + 1, Nonce: 2, ToID: pavelAccountID, Value: 100}, privateKey)
+	if err != nil {
+		t.Fatalf("Should be able to sign the raw transaction: %v", err)
+	}
+
+	if _, err := node.SubmitRawTx(raw); err == nil {
+		t.Fatalf("Should not accept a raw transaction signed for another chain.")
+	}
+}
+
+// Test_EstimateFee validates the suggested tips follow the transactions
+// waiting in the mempool once there are more than fit in a block.
+func Test_EstimateFee(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	est := node.EstimateFee()
+	if est.GasPrice != 15 || est.Fast.Tip != 0 {
+		t.Logf("got: %+v", est)
+		t.Logf("exp: gas price 15 with no tip")
+		t.Fatalf("Should not suggest a tip with an empty mempool.")
+	}
+
+	// Twelve transactions are waiting and ten fit in a block.
+	for i := uint64(1); i <= 12; i++ {
+		tx := database.Tx{ChainID: chainID, Nonce: i, FromID: kennedyAccountID, ToID: pavelAccountID, Value: 1, Tip: i}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+	}
+
+	est = node.EstimateFee()
+	if est.Fast.Tip != 4 || est.Fast.Blocks != 1 {
+		t.Logf("got: %+v", est.Fast)
+		t.Logf("exp: tip 4 in 1 block")
+		t.Fatalf("Should suggest a tip that beats the tenth largest tip for fast inclusion.")
+	}
+
+	if est.Normal.Tip != 0 || est.Slow.Tip != 0 {
+		t.Logf("got: normal %d slow %d", est.Normal.Tip, est.Slow.Tip)
+		t.Logf("exp: normal 0 slow 0")
+		t.Fatalf("Should not suggest a tip when the mempool clears within the target.")
+	}
+}
+
+// Test_GasUnits validates the node computes the gas units for a transaction
+// and rejects a transaction from a peer claiming different units.
+func Test_GasUnits(t *testing.T) {
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.Gas = &genesis.GasSchedule{Block: 1, Base: 21, PerByte: 1, Transfer: 9}
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: pavelAccountID, Value: 100, Data: []byte("memo")}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	mempool := node.Mempool()
+	if len(mempool) != 1 || mempool[0].GasUnits != 34 {
+		t.Logf("got: %v", mempool)
+		t.Logf("exp: %d", 34)
+		t.Fatalf("Should compute the gas units for the transaction.")
+	}
+
+	tx.Nonce = 2
+	if err := node.UpsertNodeTransaction(database.NewBlockTx(newSignedTx(tx, kennedyPrivateKey, t), 15, 1)); err == nil {
+		t.Fatalf("Should not accept a transaction with gas units that don't match the computed cost.")
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	account, err := node.QueryAccount(kennedyAccountID)
+	if err != nil {
+		t.Fatalf("Should be able to query the account: %v", err)
+	}
+
+	if exp := uint64(1000000 - 100 - 34*15); account.Balance != exp {
+		t.Logf("got: %d", account.Balance)
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should charge the gas price for every computed gas unit.")
+	}
+}
+
+// Test_BlockGasLimit validates a mined block is filled with transactions
+// until the block gas limit is reached instead of the transaction count.
+func Test_BlockGasLimit(t *testing.T) {
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.Gas = &genesis.GasSchedule{Block: 1, Base: 10}
+		cfg.Genesis.BlockGasLimit = 25
+	})
+
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: pavelAccountID, Value: 1}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	if trans := len(block.MerkleTree.Values()); trans != 2 || block.Header.GasUsed != 20 {
+		t.Logf("got: %d txs %d gas", trans, block.Header.GasUsed)
+		t.Logf("exp: %d txs %d gas", 2, 20)
+		t.Fatalf("Should only mine the transactions that fit in the block gas limit.")
+	}
+
+	if n := len(node.Mempool()); n != 1 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should leave the transaction that didn't fit in the mempool.")
+	}
+}
+
+// Test_ReadyToMine validates mining waits for the configured number of
+// transactions unless the pending tips reach the threshold.
+func Test_ReadyToMine(t *testing.T) {
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.MiningMinTrans = 3
+		cfg.MiningMinTips = 50
+	})
+
+	if node.ReadyToMine() {
+		t.Fatalf("Should not be ready to mine an empty mempool.")
+	}
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Tip: 10}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	if node.ReadyToMine() {
+		t.Fatalf("Should wait for more transactions.")
+	}
+
+	tx = database.Tx{ChainID: chainID, Nonce: 2, FromID: kennedyAccountID, ToID: edAccountID, Value: 1, Tip: 40}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	if !node.ReadyToMine() {
+		t.Fatalf("Should be ready to mine once the tips reach the threshold.")
+	}
+
+	counted := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.MiningMinTrans = 2
+	})
+
+	for i := uint64(1); i <= 2; i++ {
+		if counted.ReadyToMine() {
+			t.Fatalf("Should wait for %d transactions.", 2)
+		}
+
+		tx := database.Tx{ChainID: chainID, Nonce: i, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+		if err := counted.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+	}
+
+	if !counted.ReadyToMine() {
+		t.Fatalf("Should be ready to mine once the count is reached.")
+	}
+}
+
+// Test_EmptyBlocks validates an empty block is mined once one is due and is
+// accepted by peers.
+func Test_EmptyBlocks(t *testing.T) {
+	node1 := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.EmptyBlocks = time.Hour
+	})
+	node2 := newNode(miner2PrivateKey, t)
+
+	// The genesis has no timestamp so the first empty block is due.
+	if !node1.EmptyBlockDue() {
+		t.Fatalf("Should have an empty block due on a new chain.")
+	}
+
+	blk, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine an empty block: %v", err)
+	}
+
+	if n := len(blk.MerkleTree.Values()); n != 0 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 0)
+		t.Fatalf("Should mine a block without transactions.")
+	}
+
+	if _, err := node2.ProcessProposedBlock(blk); err != nil {
+		t.Fatalf("Should accept the empty block: %v", err)
+	}
+
+	if _, err := node1.MineNewBlock(context.Background()); !errors.Is(err, state.ErrNoTransactions) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", state.ErrNoTransactions)
+		t.Fatalf("Should not mine another empty block before the interval passes.")
+	}
+
+	if _, err := node2.MineNewBlock(context.Background()); !errors.Is(err, state.ErrNoTransactions) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", state.ErrNoTransactions)
+		t.Fatalf("Should not mine empty blocks unless configured.")
+	}
+}
+
+// Test_ReorgEvent validates a rollback reports the removed blocks and the
+// receipts for their transactions are no longer canonical.
+func Test_ReorgEvent(t *testing.T) {
+	var events []state.ReorgEvent
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.FinalityDepth = 2
+		cfg.EvHandler = func(v string, args ...any) {
+			if s := fmt.Sprintf(v, args...); strings.HasPrefix(s, "viewer: reorg: ") {
+				var ev state.ReorgEvent
+				json.Unmarshal([]byte(strings.TrimPrefix(s, "viewer: reorg: ")), &ev)
+				events = append(events, ev)
+			}
+		}
+	})
+
+	var txHash string
+	for i := uint64(1); i <= 3; i++ {
+		tx := database.Tx{ChainID: chainID, Nonce: i, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+		signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+		if err := node.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Should be able to mine a block: %v", err)
+		}
+		txHash = signedTx.TxHash()
+	}
+
+	if _, _, canonical, err := node.QueryReceipt(context.Background(), txHash); err != nil || !canonical {
+		t.Fatalf("Should have a canonical receipt for the mined transaction: %v", err)
+	}
+
+	if err := node.Reorganize(); err != nil {
+		t.Fatalf("Should be able to reorganize the chain: %v", err)
+	}
+
+	if len(events) != 1 {
+		t.Logf("got: %d", len(events))
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should report a single reorg event.")
+	}
+
+	ev := events[0]
+	if ev.From != 3 || ev.To != 1 || len(ev.Reverted) != 2 {
+		t.Logf("got: from %d to %d reverted %d", ev.From, ev.To, len(ev.Reverted))
+		t.Logf("exp: from %d to %d reverted %d", 3, 1, 2)
+		t.Fatalf("Should report the blocks removed by the rollback.")
+	}
+
+	if last := ev.Reverted[1]; last.Number != 3 || len(last.TxHashes) != 1 || last.TxHashes[0] != txHash {
+		t.Logf("got: %+v", last)
+		t.Logf("exp: %s", txHash)
+		t.Fatalf("Should report the transactions of the removed blocks.")
+	}
+
+	var found bool
+	for _, accountID := range ev.Accounts {
+		found = found || accountID == kennedyAccountID
+	}
+	if !found {
+		t.Logf("got: %v", ev.Accounts)
+		t.Logf("exp: %s", kennedyAccountID)
+		t.Fatalf("Should report the accounts whose balances changed.")
+	}
+
+	_, block, canonical, err := node.QueryReceipt(context.Background(), txHash)
+	if err != nil || canonical || block.Header.Number != 3 {
+		t.Logf("got: blk %d canonical %v err %v", block.Header.Number, canonical, err)
+		t.Logf("exp: blk %d canonical %v", 3, false)
+		t.Fatalf("Should report the receipt from the removed block as not canonical.")
+	}
+
+	// The restored transactions are mined again.
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	if _, _, canonical, err := node.QueryReceipt(context.Background(), txHash); err != nil || !canonical {
+		t.Fatalf("Should have a canonical receipt once the transaction is mined again: %v", err)
+	}
+}
+
+// Test_Evidence validates a validator proposing two blocks for the same
+// number is recorded and the evidence to slash its bond is submitted.
+func Test_Evidence(t *testing.T) {
+	pos := func(hexKey string, slash bool) func(cfg *state.Config) {
+		privateKey, err := crypto.HexToECDSA(hexKey)
+		if err != nil {
+			t.Fatalf("Error constructing private key: %v", err)
+		}
+
+		return func(cfg *state.Config) {
+			cfg.Consensus = state.ConsensusPOS
+			cfg.PrivateKey = privateKey
+			cfg.Slash = slash
+			cfg.Genesis.Balances[string(miner1AccountID)] = 1000000
+			cfg.Genesis.Balances[string(miner2AccountID)] = 1000000
+			cfg.Genesis.Bonds = map[string]uint64{string(miner1AccountID): 1000}
+		}
+	}
+
+	// The same validator runs on two nodes and proposes a different block
+	// for the same number on each.
+	var blocks []database.Block
+	for _, value := range []uint64{1, 2} {
+		node := newNodeWithConfig(miner1PrivateKey, t, pos(miner1PrivateKey, false))
+
+		tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: value}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+
+		block, err := node.MineNewBlock(context.Background())
+		if err != nil {
+			t.Fatalf("Should be able to propose the block: %v", err)
+		}
+		blocks = append(blocks, block)
+	}
+
+	node := newNodeWithConfig(miner2PrivateKey, t, pos(miner2PrivateKey, true))
+
+	if _, err := node.ProcessProposedBlock(blocks[0]); err != nil {
+		t.Fatalf("Should accept the first block: %v", err)
+	}
+
+	if _, err := node.ProcessProposedBlock(blocks[1]); err == nil {
+		t.Fatalf("Should not accept a second block for the same number.")
+	}
+
+	// Seeing the block again doesn't report it twice.
+	node.ProcessProposedBlock(blocks[1])
+
+	evidence := node.Evidence()
+	if len(evidence) != 1 {
+		t.Logf("got: %d", len(evidence))
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should record the equivocation once.")
+	}
+
+	ev := evidence[0]
+	if ev.Offender != miner1AccountID || ev.Number != 1 || !ev.Provable {
+		t.Logf("got: %s blk %d provable %v", ev.Offender, ev.Number, ev.Provable)
+		t.Logf("exp: %s blk %d provable %v", miner1AccountID, 1, true)
+		t.Fatalf("Should record the validator that proposed both blocks.")
+	}
+
+	if offender, err := ev.Evidence.Offender(chainID); err != nil || offender != miner1AccountID {
+		t.Fatalf("Should record evidence that proves the equivocation: %v", err)
+	}
+
+	var submitted bool
+	for _, tx := range node.Mempool() {
+		if op, ok := database.ParseBondOp(tx.Data); ok && op.Op == database.BondEvidence && tx.FromID == miner2AccountID {
+			submitted = true
+		}
+	}
+	if !submitted {
+		t.Fatalf("Should submit the evidence to slash the validator's bond.")
+	}
+}
+
+// Test_PeerFailover validates a peer that can't be reached at its primary
+// address is reached at its other addresses, and the address that worked is
+// tried first from then on.
+func Test_PeerFailover(t *testing.T) {
+	var requests int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.Write([]byte(`{"chain_id":1,"latest_block_number":7}`))
+	}))
+	defer srv.Close()
+
+	// Nothing listens on the primary address once the listener is closed.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Should be able to listen: %v", err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	pr := peer.New(down, strings.TrimPrefix(srv.URL, "http://"))
+
+	var events []string
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.KnownPeers.Add(pr)
+		cfg.EvHandler = func(v string, args ...any) {
+			events = append(events, fmt.Sprintf(v, args...))
+		}
+	})
+
+	for i := 0; i < 2; i++ {
+		status, err := node.NetRequestPeerStatus(context.Background(), pr)
+		if err != nil {
+			t.Fatalf("Should be able to reach the peer at its other address: %v", err)
+		}
+
+		if status.LatestBlockNumber != 7 {
+			t.Logf("got: %d", status.LatestBlockNumber)
+			t.Logf("exp: %d", 7)
+			t.Fatalf("Should get the status from the peer.")
+		}
+	}
+
+	var failovers int
+	for _, ev := range events {
+		if strings.Contains(ev, "unreachable at "+down) {
+			failovers++
+		}
+	}
+
+	if failovers != 1 || atomic.LoadInt32(&requests) != 2 {
+		t.Logf("got: %d failovers, %d requests", failovers, requests)
+		t.Logf("exp: 1 failovers, 2 requests")
+		t.Fatalf("Should try the address that worked first after a failover.")
+	}
+}
+
+// Test_PeerSlots validates a full peer table only takes a new peer in place
+// of a peer that hasn't been answering, and inbound peers don't take the
+// outbound slots.
+func Test_PeerSlots(t *testing.T) {
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.MaxInbound = 1
+		cfg.MaxOutbound = 1
+	})
+
+	// Nothing listens on the address once the listener is closed.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Should be able to listen: %v", err)
+	}
+	down := ln.Addr().String()
+	ln.Close()
+
+	if !node.AddInboundPeer(peer.New(down)) {
+		t.Fatalf("Should add an inbound peer to a free slot.")
+	}
+
+	if node.AddInboundPeer(peer.New("10.0.0.2:9080")) {
+		t.Fatalf("Should not evict a peer that hasn't failed.")
+	}
+
+	if !node.AddKnownPeer(peer.New("10.0.0.3:9080")) {
+		t.Fatalf("Should add an outbound peer while the inbound slots are full.")
+	}
+
+	if _, err := node.NetRequestPeerStatus(context.Background(), peer.New(down)); err == nil {
+		t.Fatalf("Should not reach the peer.")
+	}
+
+	if !node.AddInboundPeer(peer.New("10.0.0.2:9080")) {
+		t.Fatalf("Should take the slot of a peer that isn't answering.")
+	}
+
+	var hosts []string
+	for _, score := range node.PeerScores() {
+		hosts = append(hosts, score.Host)
+	}
+	sort.Strings(hosts)
+
+	if exp := []string{"10.0.0.2:9080", "10.0.0.3:9080"}; strings.Join(hosts, ",") != strings.Join(exp, ",") {
+		t.Logf("got: %v", hosts)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should evict the peer that isn't answering.")
+	}
+}
+
+// Test_SyncOrder validates blocks are downloaded from the nearest up to date
+// peers first and from the peers that are further behind last.
+func Test_SyncOrder(t *testing.T) {
+	peerServer := func(block uint64, delay time.Duration) peer.Peer {
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(delay)
+			fmt.Fprintf(w, `{"chain_id":1,"latest_block_number":%d}`, block)
+		}))
+		t.Cleanup(srv.Close)
+
+		return peer.New(strings.TrimPrefix(srv.URL, "http://"))
+	}
+
+	far := peerServer(10, 40*time.Millisecond)
+	near := peerServer(10, 0)
+	lagging := peerServer(9, 15*time.Millisecond)
+	behind := peerServer(5, 0)
+	silent := peer.New("10.0.0.9:9080")
+
+	node := newNode(miner1PrivateKey, t)
+
+	peers := []peer.Peer{far, near, lagging, behind, silent}
+	for _, pr := range peers[:4] {
+		if _, err := node.NetRequestPeerStatus(context.Background(), pr); err != nil {
+			t.Fatalf("Should be able to get the status of the peer: %v", err)
+		}
+	}
+
+	if lat := node.PeerLatency(far.Host); lat.Samples != 1 || lat.Avg < 40*time.Millisecond {
+		t.Logf("got: %+v", lat)
+		t.Logf("exp: 1 sample of at least %s", 40*time.Millisecond)
+		t.Fatalf("Should measure the round trip time of the status request.")
+	}
+
+	var got []string
+	for _, pr := range node.SyncOrder(peers) {
+		got = append(got, pr.Host)
+	}
+
+	exp := []string{near.Host, lagging.Host, far.Host, behind.Host}
+	if strings.Join(got, ",") != strings.Join(exp, ",") {
+		t.Logf("got: %v", got)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should order the peers by how up to date and near they are.")
+	}
+}
+
+// Test_ChainScoped validates a node hosting more than one chain reaches its
+// peers on the URLs for its chain id.
+func Test_ChainScoped(t *testing.T) {
+	var path string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		w.Write([]byte(`{"chain_id":1}`))
+	}))
+	defer srv.Close()
+
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.ChainScoped = true
+	})
+
+	if _, err := node.NetRequestPeerStatus(context.Background(), peer.New(strings.TrimPrefix(srv.URL, "http://"))); err != nil {
+		t.Fatalf("Should be able to get the status of the peer: %v", err)
+	}
+
+	if exp := "/v1/chains/1/node/status"; path != exp {
+		t.Logf("got: %s", path)
+		t.Logf("exp: %s", exp)
+		t.Fatalf("Should send the request to the URL for the chain.")
+	}
+}
+
+// Test_MinTip validates transactions offering less than the node's minimum
+// tip are kept out of the mempool, and that the minimum can be changed while
+// the node is running.
+func Test_MinTip(t *testing.T) {
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.MinTip = 10
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); !errors.Is(err, state.ErrLowTip) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", state.ErrLowTip)
+		t.Fatalf("Should reject a transaction below the minimum tip.")
+	}
+
+	node.SetMinTip(5)
+	if got := node.MinTip(); got != 5 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 5)
+		t.Fatalf("Should change the minimum tip.")
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should accept the transaction once the minimum is lowered: %v", err)
+	}
+}
+
+// Test_ErrorCodes validates the errors returned when a transaction isn't
+// accepted carry a code callers can act on.
+func Test_ErrorCodes(t *testing.T) {
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.MinTip = 5
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 100, Tip: 5}
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+
+	tampered := signedTx
+	tampered.Value = 1000
+
+	lowTip := tx
+	lowTip.Nonce = 2
+	lowTip.Tip = 1
+
+	expired := tx
+	expired.Nonce = 2
+	expired.ValidUntil = 1
+
+	if err := node.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	_, notPending := node.CancelTx(kennedyAccountID, 5)
+
+	tt := []struct {
+		name string
+		err  error
+		exp  errcode.Code
+	}{
+		{name: "signature", err: node.UpsertWalletTransaction(tampered), exp: errcode.InvalidSignature},
+		{name: "nonce", err: node.UpsertWalletTransaction(signedTx), exp: errcode.BadNonce},
+		{name: "tip", err: node.UpsertWalletTransaction(newSignedTx(lowTip, kennedyPrivateKey, t)), exp: errcode.Underpriced},
+		{name: "expired", err: node.UpsertWalletTransaction(newSignedTx(expired, kennedyPrivateKey, t)), exp: errcode.TxExpired},
+		{name: "pending", err: notPending, exp: errcode.NotFound},
+	}
+
+	for _, tst := range tt {
+		if got := errcode.Of(tst.err); got != tst.exp {
+			t.Logf("got: %s: %v", got, tst.err)
+			t.Logf("exp: %s", tst.exp)
+			t.Fatalf("Should return the %s error with its code.", tst.name)
+		}
+	}
+}
+
+// Test_KnownBlock validates a block sent again by a peer is reported as
+// already known instead of failing or being applied twice.
+func Test_KnownBlock(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if node2.KnownBlock(block) {
+		t.Fatalf("Should not know the block before it's processed.")
+	}
+
+	// The same block arriving from two peers at once is applied once.
+	type result struct {
+		status string
+		err    error
+	}
+	results := make(chan result, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			status, err := node2.ProcessProposedBlock(block)
+			results <- result{status, err}
+		}()
+	}
+
+	statuses := make(map[string]int)
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatalf("Should not fail to process the block again: %v", r.err)
+		}
+		statuses[r.status]++
+	}
+
+	if statuses[state.BlockAccepted] != 1 || statuses[state.BlockKnown] != 1 {
+		t.Logf("got: %v", statuses)
+		t.Fatalf("Should accept the block once and report it as known once.")
+	}
+
+	if got := node2.LatestBlock().Header.Number; got != 1 {
+		t.Logf("got: %d", got)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should only add the block once.")
+	}
+
+	// The miner knows its own block.
+	if status, err := node1.ProcessProposedBlock(block); err != nil || status != state.BlockKnown {
+		t.Logf("got: %s, %v", status, err)
+		t.Logf("exp: %s", state.BlockKnown)
+		t.Fatalf("Should report the mined block as known.")
+	}
+
+	// The transactions left the mempool with the block, so a compact block
+	// can only be answered because the block is known.
+	status, err := node2.ProcessCompactBlock(database.NewCompactBlock(block))
+	if err != nil || status.Status != state.CompactKnown {
+		t.Logf("got: %+v, %v", status, err)
+		t.Logf("exp: %s", state.CompactKnown)
+		t.Fatalf("Should report the compact block as known.")
+	}
+}
+
+// Test_OrphanTx validates a transaction from a peer that arrives before its
+// account is funded is held and added to the mempool by the funding block.
+func Test_OrphanTx(t *testing.T) {
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNode(miner2PrivateKey, t)
+	node3 := newNode(miner3PrivateKey, t)
+
+	// The account for ed doesn't exist until kennedy funds it.
+	edTx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  edAccountID,
+		ToID:    kennedyAccountID,
+		Value:   1,
+	}
+
+	if err := node3.UpsertWalletTransaction(newSignedTx(edTx, edPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+	orphan := node3.Mempool()[0]
+
+	if err := node2.UpsertNodeTransaction(orphan); err != nil {
+		t.Fatalf("Should be able to hold the transaction: %v", err)
+	}
+
+	if n, orphans := node2.MempoolLength(), node2.Orphans(); n != 0 || len(orphans) != 1 || orphans[0].TxHash() != orphan.TxHash() {
+		t.Logf("got: mempool %d, orphans %d", n, len(orphans))
+		t.Logf("exp: mempool 0, orphans 1")
+		t.Fatalf("Should hold the transaction outside the mempool.")
+	}
+
+	fundTx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1000,
+	}
+
+	if err := node1.UpsertWalletTransaction(newSignedTx(fundTx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	block, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if _, err := node2.ProcessProposedBlock(block); err != nil {
+		t.Fatalf("Should be able to process the block: %v", err)
+	}
+
+	mempool := node2.Mempool()
+	if len(mempool) != 1 || mempool[0].TxHash() != orphan.TxHash() || len(node2.Orphans()) != 0 {
+		t.Logf("got: mempool %d, orphans %d", len(mempool), len(node2.Orphans()))
+		t.Logf("exp: mempool 1, orphans 0")
+		t.Fatalf("Should move the transaction to the mempool once the account exists.")
+	}
+}
+
+// Test_NodeStateRestart validates the mempool and the known peers are kept
+// across a restart of the node.
+func Test_NodeStateRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node-state.json")
+	withPath := func(cfg *state.Config) {
+		cfg.NodeStatePath = path
+	}
+
+	node1 := newNodeWithConfig(miner1PrivateKey, t, withPath)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   10,
+	}
+
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	// The account for ed doesn't exist, so its transaction is held.
+	edTx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  edAccountID,
+		ToID:    kennedyAccountID,
+		Value:   1,
+	}
+
+	node2 := newNode(miner2PrivateKey, t)
+	if err := node2.UpsertWalletTransaction(newSignedTx(edTx, edPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	if err := node1.UpsertNodeTransaction(node2.Mempool()[0]); err != nil {
+		t.Fatalf("Should be able to hold the transaction: %v", err)
+	}
+
+	node1.AddKnownPeer(peer.New("10.0.0.1:9080"))
+	node1.AddInboundPeer(peer.New("10.0.0.2:9080"))
+
+	if err := node1.Shutdown(); err != nil {
+		t.Fatalf("Should be able to shut down the node: %v", err)
+	}
+
+	restarted := newNodeWithConfig(miner1PrivateKey, t, withPath)
+
+	if n, orphans := restarted.MempoolLength(), restarted.Orphans(); n != 1 || len(orphans) != 1 {
+		t.Logf("got: mempool %d, orphans %d", n, len(orphans))
+		t.Logf("exp: mempool 1, orphans 1")
+		t.Fatalf("Should restore the pending transactions.")
+	}
+
+	scores := restarted.PeerScores()
+	if len(scores) != 2 {
+		t.Logf("got: %+v", scores)
+		t.Fatalf("Should restore the known peers.")
+	}
+
+	for _, score := range scores {
+		if exp := score.Host == "10.0.0.2:9080"; score.Inbound != exp {
+			t.Logf("got: %+v", score)
+			t.Fatalf("Should restore the direction of the peer.")
+		}
+	}
+}
+
+// Test_BlockProduction validates the time spent in each stage of producing
+// a block is reported once the block is sent to the peers.
+func Test_BlockProduction(t *testing.T) {
+	var events []state.BlockProduction
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.EvHandler = func(v string, args ...any) {
+			s := fmt.Sprintf(v, args...)
+			if strings.HasPrefix(s, "viewer: production: ") {
+				var ev state.BlockProduction
+				json.Unmarshal([]byte(strings.TrimPrefix(s, "viewer: production: ")), &ev)
+				events = append(events, ev)
+			}
+		}
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	block, err := node.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if len(events) != 0 {
+		t.Fatalf("Should not report the block before it's sent to the peers.")
+	}
+
+	node.BlockProposed(block, 5*time.Millisecond)
+	node.BlockProposed(block, 5*time.Millisecond)
+
+	if len(events) != 1 || events[0].Block != 1 || events[0].Txs != 1 || events[0].Broadcast != 5 || events[0].Total < 5 {
+		t.Logf("got: %+v", events)
+		t.Fatalf("Should report the stages of the block once.")
+	}
+
+	stats := node.ProductionStats()
+	if stats.Blocks != 1 || stats.Broadcast.Last != 5 || stats.Broadcast.Avg != 5 || stats.Nonce.Last != events[0].Nonce {
+		t.Logf("got: %+v", stats)
+		t.Fatalf("Should add the stages of the block to the stats.")
+	}
+}
+
+// Test_Sinks validates each sink gets the events that pass its filter.
+func Test_Sinks(t *testing.T) {
+	var blocks, logs []state.Event
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Sinks = []state.Sink{
+			{Name: "blocks", Kinds: []string{state.EventBlock}, Handle: func(ev state.Event) { blocks = append(blocks, ev) }},
+			{Name: "logs", Logs: true, Kinds: []string{state.EventMining}, Handle: func(ev state.Event) { logs = append(logs, ev) }},
+		}
+	})
+
+	if err := node.AddSink(state.Sink{Name: "blocks", Handle: func(state.Event) {}}); err == nil {
+		t.Fatalf("Should not register two sinks with the same name.")
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	// Shutting down waits for the sinks to handle their events.
+	stats := node.Sinks()
+	if err := node.Shutdown(); err != nil {
+		t.Fatalf("Should be able to shut down the node: %v", err)
+	}
+
+	if len(stats) != 2 || stats[0].Name != "blocks" || stats[1].Name != "logs" {
+		t.Logf("got: %+v", stats)
+		t.Fatalf("Should report the registered sinks.")
+	}
+
+	if len(blocks) != 1 {
+		t.Logf("got: %d", len(blocks))
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should only send the block events to the sink.")
+	}
+
+	if block, ok := blocks[0].Value.(database.BlockData); !ok || block.Header.Number != 1 || len(blocks[0].Data) == 0 {
+		t.Logf("got: %+v", blocks)
+		t.Fatalf("Should send the block event with its value.")
+	}
+
+	for _, ev := range logs {
+		if ev.Kind != "" || ev.Message == "" || strings.HasPrefix(ev.Message, "viewer: ") {
+			t.Logf("got: %+v", ev)
+			t.Fatalf("Should only send the log messages to the sink.")
+		}
+	}
+
+	if len(logs) == 0 {
+		t.Fatalf("Should send the log messages to the sink that wants them.")
+	}
+}
+
+// Test_WatchAccount validates a block sends a watch event for each watched
+// account it changes.
+func Test_WatchAccount(t *testing.T) {
+	var events []state.WatchEvent
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.EvHandler = func(v string, args ...any) {
+			s := fmt.Sprintf(v, args...)
+			if strings.HasPrefix(s, "viewer: watch: ") {
+				var ev state.WatchEvent
+				json.Unmarshal([]byte(strings.TrimPrefix(s, "viewer: watch: ")), &ev)
+				events = append(events, ev)
+			}
+		}
+	})
+
+	node.WatchAccount(database.AccountID(strings.ToLower(string(edAccountID))))
+	node.WatchAccount(miner1AccountID)
+	node.WatchAccount(pavelAccountID)
+
+	if !node.UnwatchAccount(pavelAccountID) || node.UnwatchAccount(pavelAccountID) {
+		t.Fatalf("Should remove the account from the watch list once.")
+	}
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   10,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Should be able to mine the block: %v", err)
+	}
+
+	if len(events) != 2 {
+		t.Logf("got: %+v", events)
+		t.Fatalf("Should send an event for each watched account the block changed.")
+	}
+
+	received := events[0]
+	if received.Action != state.WatchReceived || received.Counterparty != kennedyAccountID || received.Value != 10 || received.Balance != 10 || received.Previous != 0 {
+		t.Logf("got: %+v", received)
+		t.Fatalf("Should report the value received with the new balance.")
+	}
+
+	reward := events[1]
+	if reward.Account != miner1AccountID || reward.Action != state.WatchBalance || reward.Balance <= reward.Previous {
+		t.Logf("got: %+v", reward)
+		t.Fatalf("Should report the mining reward as a balance change.")
+	}
+}
+
+// Test_Checkpoints validates a trusted key signs a checkpoint when one is due,
+// a peer trusting the key accepts it and rejects a block contradicting it.
+func Test_Checkpoints(t *testing.T) {
+	trust := func(hexKey string, freq uint64) func(cfg *state.Config) {
+		privateKey, err := crypto.HexToECDSA(hexKey)
+		if err != nil {
+			t.Fatalf("Error constructing private key: %v", err)
+		}
+
+		return func(cfg *state.Config) {
+			cfg.PrivateKey = privateKey
+			cfg.CheckpointKeys = []database.AccountID{miner1AccountID}
+			cfg.CheckpointFreq = freq
+		}
+	}
+
+	mine := func(node *state.State, value uint64) []database.Block {
+		var blocks []database.Block
+		for nonce := uint64(1); nonce <= 2; nonce++ {
+			tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: value}
+			if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+				t.Fatalf("Should be able to add the transaction: %v", err)
+			}
+
+			block, err := node.MineNewBlock(context.Background())
+			if err != nil {
+				t.Fatalf("Should be able to mine the block: %v", err)
+			}
+			blocks = append(blocks, block)
+		}
+		return blocks
+	}
+
+	signer := newNodeWithConfig(miner1PrivateKey, t, trust(miner1PrivateKey, 2))
+	blocks := mine(signer, 10)
+
+	checkpoints := signer.Checkpoints()
+	if len(checkpoints) != 1 {
+		t.Logf("got: %d", len(checkpoints))
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should sign a checkpoint for the second block.")
+	}
+
+	sc := checkpoints[0]
+	if sc.Number != 2 || sc.Hash != blocks[1].Hash() {
+		t.Logf("got: %d %s", sc.Number, sc.Hash)
+		t.Logf("exp: %d %s", 2, blocks[1].Hash())
+		t.Fatalf("Should sign the checkpoint for the latest block.")
+	}
+
+	node := newNodeWithConfig(miner2PrivateKey, t, trust(miner2PrivateKey, 0))
+
+	if err := node.AddCheckpoint(sc); err != nil {
+		t.Fatalf("Should accept the checkpoint from a trusted key: %v", err)
+	}
+
+	privateKey, err := crypto.HexToECDSA(miner2PrivateKey)
+	if err != nil {
+		t.Fatalf("Error constructing private key: %v", err)
+	}
+
+	untrusted, err := sc.Checkpoint.Sign(chainID, privateKey)
+	if err != nil {
+		t.Fatalf("Should be able to sign the checkpoint: %v", err)
+	}
+
+	if err := node.AddCheckpoint(untrusted); err == nil {
+		t.Fatalf("Should reject the checkpoint from a key that isn't trusted.")
+	}
+
+	// A chain built by another miner has a different block at the
+	// checkpointed number.
+	fake := mine(newNode(miner3PrivateKey, t), 20)
+
+	if _, err := node.ProcessProposedBlock(fake[0]); err != nil {
+		t.Fatalf("Should accept the block before the checkpoint: %v", err)
+	}
 
-			case i == 10:
-				continue
+	if _, err := node.ProcessProposedBlock(fake[1]); !errcode.Is(err, errcode.InvalidBlock) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %s", errcode.InvalidBlock)
+		t.Fatalf("Should reject the block contradicting the checkpoint.")
+	}
+}
 
-			case i == 11:
-				err := node2.ProcessProposedBlock(blk)
-				if err == nil {
-					t.Fatal("Error handling missing block: should have received error about block number")
-				}
+// Test_Pagination validates the lists are returned a page at a time with the
+// cursor for the next page.
+func Test_Pagination(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	for nonce := uint64(1); nonce <= 3; nonce++ {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: 10}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+
+		if _, err := node.MineNewBlock(context.Background()); err != nil {
+			t.Fatalf("Should be able to mine the block: %v", err)
+		}
+	}
+
+	page, err := node.QueryBlocks(context.Background(), state.BlockFilter{Account: edAccountID, Limit: 2})
+	if err != nil {
+		t.Fatalf("Should be able to query the blocks: %v", err)
+	}
+	if len(page.Blocks) != 2 || page.Blocks[0].Header.Number != 1 || page.Next != "3" {
+		t.Logf("got: %d %q", len(page.Blocks), page.Next)
+		t.Logf("exp: %d %q", 2, "3")
+		t.Fatalf("Should return the first page with the cursor for the next one.")
+	}
+
+	page, err = node.QueryBlocks(context.Background(), state.BlockFilter{Account: edAccountID, Cursor: page.Next, Limit: 2})
+	if err != nil {
+		t.Fatalf("Should be able to query the blocks: %v", err)
+	}
+	if len(page.Blocks) != 1 || page.Blocks[0].Header.Number != 3 || page.Next != "" {
+		t.Logf("got: %d %q", len(page.Blocks), page.Next)
+		t.Logf("exp: %d %q", 1, "")
+		t.Fatalf("Should return the last page without a cursor.")
+	}
+
+	page, err = node.QueryBlocks(context.Background(), state.BlockFilter{Account: miner2AccountID})
+	if err != nil {
+		t.Fatalf("Should be able to query the blocks: %v", err)
+	}
+	if len(page.Blocks) != 0 {
+		t.Logf("got: %d", len(page.Blocks))
+		t.Logf("exp: %d", 0)
+		t.Fatalf("Should only return the blocks for the account.")
+	}
+
+	if _, err := node.QueryBlocks(context.Background(), state.BlockFilter{Cursor: "next"}); !errors.Is(err, state.ErrInvalidCursor) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", state.ErrInvalidCursor)
+		t.Fatalf("Should reject a cursor the node didn't return.")
+	}
+
+	accounts, next, err := node.QueryAccounts(state.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("Should be able to query the accounts: %v", err)
+	}
+
+	seen := len(accounts)
+	for next != "" {
+		if accounts, next, err = node.QueryAccounts(state.Page{Cursor: next, Limit: 1}); err != nil {
+			t.Fatalf("Should be able to query the accounts: %v", err)
+		}
+		seen += len(accounts)
+	}
+
+	if exp := node.Accounts().Len(); seen != exp {
+		t.Logf("got: %d", seen)
+		t.Logf("exp: %d", exp)
+		t.Fatalf("Should page through all the accounts.")
+	}
+
+	for nonce := uint64(4); nonce <= 5; nonce++ {
+		tx := database.Tx{ChainID: chainID, Nonce: nonce, FromID: kennedyAccountID, ToID: edAccountID, Value: 10}
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Should be able to add the transaction: %v", err)
+		}
+	}
+
+	trans, next, err := node.QueryUncommitted(kennedyAccountID, state.Page{Limit: 1})
+	if err != nil {
+		t.Fatalf("Should be able to query the mempool: %v", err)
+	}
+	if len(trans) != 1 || trans[0].Nonce != 4 || next != "1" {
+		t.Logf("got: %d %q", len(trans), next)
+		t.Logf("exp: %d %q", 1, "1")
+		t.Fatalf("Should return the first transaction with the cursor for the next one.")
+	}
+
+	mp, err := node.QueryMempool(state.MempoolFilter{SortBy: state.MempoolSortNonce, Cursor: next, Limit: 1})
+	if err != nil {
+		t.Fatalf("Should be able to query the mempool: %v", err)
+	}
+	if len(mp.Txs) != 1 || mp.Txs[0].Nonce != 5 || mp.Next != "" {
+		t.Logf("got: %d %q", len(mp.Txs), mp.Next)
+		t.Logf("exp: %d %q", 1, "")
+		t.Fatalf("Should return the last pending transaction without a cursor.")
+	}
+}
+
+// Test_Tracing validates the spans for mining a block and sending it to a
+// peer are recorded in one trace that is passed on to the peer.
+func Test_Tracing(t *testing.T) {
+	var mu sync.Mutex
+	var spans []tracing.SpanData
+	tracer := tracing.New("node1", tracing.ExporterFunc(func(span tracing.SpanData) {
+		mu.Lock()
+		defer mu.Unlock()
+		spans = append(spans, span)
+	}))
+
+	var traceparent atomic.Value
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/node/block/announce", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"status":"wanted"}`))
+	})
+	mux.HandleFunc("/v1/node/block/propose", func(w http.ResponseWriter, r *http.Request) {
+		traceparent.Store(r.Header.Get(tracing.TraceparentHeader))
+		w.Write([]byte(`{"status":"accepted"}`))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	peers := peer.NewPeerSet()
+	peers.Add(peer.New(strings.TrimPrefix(srv.URL, "http://")))
+
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.KnownPeers = peers
+		cfg.Tracer = tracer
+	})
+
+	tx := database.Tx{ChainID: chainID, Nonce: 1, FromID: kennedyAccountID, ToID: edAccountID, Value: 1}
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Should be able to add the transaction: %v", err)
+	}
+
+	ctx, root := tracer.Start(context.Background(), "worker.mine")
+
+	block, err := node.MineNewBlock(ctx)
+	if err != nil {
+		t.Fatalf("Should be able to mine a block: %v", err)
+	}
+
+	if err := node.NetSendBlockToPeers(ctx, block); err != nil {
+		t.Fatalf("Should be able to send the block: %v", err)
+	}
+	root.End()
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	byName := make(map[string]tracing.SpanData)
+	for _, span := range spans {
+		if span.TraceID != spans[len(spans)-1].TraceID {
+			t.Fatalf("Should record all the spans in one trace, got %s.", span.Name)
+		}
+		byName[span.Name] = span
+	}
+
+	mine, apply, send := byName["block.mine"], byName["block.apply"], byName["peer.send"]
+	if mine.Attributes["hash"] != block.Hash() || mine.Attributes["txs"] != 1 {
+		t.Logf("got: %v", mine.Attributes)
+		t.Logf("exp: hash %s with 1 tx", block.Hash())
+		t.Fatalf("Should record the mined block on the span.")
+	}
+
+	if apply.ParentID != mine.SpanID || apply.Attributes["block"] != block.Header.Number {
+		t.Logf("got: %+v", apply)
+		t.Logf("exp: parent %s", mine.SpanID)
+		t.Fatalf("Should record applying the block as part of mining it.")
+	}
+
+	if _, ok := apply.Attributes["tx_latency_max_ms"]; !ok {
+		t.Fatalf("Should record the time the transactions waited to be included.")
+	}
+
+	if send.Attributes["peer"] != strings.TrimPrefix(srv.URL, "http://") {
+		t.Logf("got: %v", send.Attributes["peer"])
+		t.Logf("exp: %v", strings.TrimPrefix(srv.URL, "http://"))
+		t.Fatalf("Should record the peer the request was sent to.")
+	}
+
+	if got, _ := traceparent.Load().(string); !strings.Contains(got, mine.TraceID) {
+		t.Logf("got: %s", got)
+		t.Logf("exp: trace %s", mine.TraceID)
+		t.Fatalf("Should pass the trace context to the peer.")
+	}
+}
+
+// Test_MiningTimeout validates mining is abandoned once the timeout passes
+// and is reported differently from mining being cancelled.
+func Test_MiningTimeout(t *testing.T) {
+	var events []string
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Genesis.Difficulty = 12
+		cfg.MiningTimeout = 50 * time.Millisecond
+		cfg.EvHandler = func(v string, args ...any) {
+			s := fmt.Sprintf(v, args...)
+			if strings.HasPrefix(s, "viewer: mining: ") {
+				events = append(events, s)
 			}
 		}
+	})
+
+	if timeout := node.MiningTimeout(12); timeout != 50*time.Millisecond {
+		t.Logf("got: %v", timeout)
+		t.Logf("exp: %v", 50*time.Millisecond)
+		t.Fatalf("Should use the configured timeout.")
 	}
 
-	return f
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); !errors.Is(err, state.ErrMiningTimeout) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", state.ErrMiningTimeout)
+		t.Fatalf("Should time out mining a block that can't be solved in time.")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if _, err := node.MineNewBlock(ctx); errors.Is(err, state.ErrMiningTimeout) || !errors.Is(err, context.Canceled) {
+		t.Logf("got: %v", err)
+		t.Logf("exp: %v", context.Canceled)
+		t.Fatalf("Should report a cancelled mining operation as cancelled.")
+	}
+
+	if len(events) != 2 || !strings.Contains(events[0], `"action":"timeout"`) || !strings.Contains(events[1], `"action":"cancel"`) {
+		t.Logf("got: %v", events)
+		t.Fatalf("Should report the timeout and the cancel as different events.")
+	}
+
+	// Without a configured timeout, the timeout is derived from the measured
+	// hash rate and a difficulty that takes longer to solve gets more time.
+	derived := newNode(miner2PrivateKey, t)
+	if timeout := derived.MiningTimeout(1); timeout != 2*time.Minute {
+		t.Logf("got: %v", timeout)
+		t.Logf("exp: %v", 2*time.Minute)
+		t.Fatalf("Should use the default timeout before the hash rate is measured.")
+	}
+
+	if err := derived.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+	if _, err := derived.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	if timeout := derived.MiningTimeout(20); timeout <= 2*time.Minute {
+		t.Logf("got: %v", timeout)
+		t.Fatalf("Should derive a longer timeout for a high difficulty.")
+	}
+}
+
+// =============================================================================
+
+// Test_Admin validates an operator can manage the peers, mining and mempool
+// of a running node.
+func Test_Admin(t *testing.T) {
+	node := newNode(miner1PrivateKey, t)
+
+	t.Run("peers", func(t *testing.T) {
+		pr := peer.New("0.0.0.0:9180")
+
+		if err := node.AddPeer(pr); err != nil {
+			t.Fatalf("Should be able to add a peer: %v", err)
+		}
+		if err := node.AddPeer(pr); err == nil {
+			t.Fatalf("Should not be able to add a known peer.")
+		}
+		if err := node.AddPeer(peer.New(node.Host())); err == nil {
+			t.Fatalf("Should not be able to add this node as a peer.")
+		}
+
+		if err := node.RemovePeer(pr); err != nil {
+			t.Fatalf("Should be able to remove a peer: %v", err)
+		}
+		if err := node.RemovePeer(pr); err == nil {
+			t.Fatalf("Should not be able to remove an unknown peer.")
+		}
+	})
+
+	t.Run("mining", func(t *testing.T) {
+		node.SetMining(false)
+		if node.IsMiningAllowed() {
+			t.Fatalf("Should not allow mining once turned off.")
+		}
+
+		node.SetMining(true)
+		if !node.IsMiningAllowed() {
+			t.Fatalf("Should allow mining once turned on.")
+		}
+	})
+
+	t.Run("mempool", func(t *testing.T) {
+		tx := database.Tx{
+			ChainID: chainID,
+			Nonce:   1,
+			FromID:  kennedyAccountID,
+			ToID:    edAccountID,
+			Value:   1,
+		}
+
+		if err := node.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+
+		if err := node.DropMempoolTx(kennedyAccountID, 1); err != nil {
+			t.Fatalf("Should be able to drop the transaction: %v", err)
+		}
+
+		if n := node.MempoolLength(); n != 0 {
+			t.Logf("got: %d", n)
+			t.Logf("exp: %d", 0)
+			t.Fatalf("Should have removed the transaction from the mempool.")
+		}
+
+		if err := node.DropMempoolTx(kennedyAccountID, 1); err == nil {
+			t.Fatalf("Should not be able to drop a transaction that isn't in the mempool.")
+		}
+	})
+}
+
+// Test_Events validates the state reports blocks, mempool changes and peer
+// changes as structured events.
+func Test_Events(t *testing.T) {
+	var events []string
+	node := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.EvHandler = func(v string, args ...any) {
+			s := fmt.Sprintf(v, args...)
+			if strings.HasPrefix(s, "viewer: ") && strings.Contains(s, ": {") {
+				events = append(events, s)
+			}
+		}
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	signedTx := newSignedTx(tx, kennedyPrivateKey, t)
+	if err := node.UpsertWalletTransaction(signedTx); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	if _, err := node.MineNewBlock(context.Background()); err != nil {
+		t.Fatalf("Error mining block: %v", err)
+	}
+
+	pr := peer.New("0.0.0.0:9180")
+	node.AddKnownPeer(pr)
+	node.RemoveKnownPeer(pr)
+
+	exp := []string{
+		fmt.Sprintf(`viewer: mempool: {"action":"add","tx_hash":%q,"from":%q,"nonce":1,"count":1}`, signedTx.TxHash(), kennedyAccountID),
+		`viewer: mempool: {"action":"mined","removed":1,"count":0}`,
+		"viewer: block: ",
+		`viewer: balances: {"block":1,`,
+		`viewer: peer: {"action":"add","host":"0.0.0.0:9180","count":1}`,
+		`viewer: peer: {"action":"remove","host":"0.0.0.0:9180","count":0}`,
+	}
+
+	if len(events) != len(exp) {
+		t.Logf("got: %v", events)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should get the expected number of events.")
+	}
+
+	for i := range exp {
+		if !strings.HasPrefix(events[i], exp[i]) {
+			t.Logf("got: %s", events[i])
+			t.Logf("exp: %s", exp[i])
+			t.Fatalf("Should get the expected event.")
+		}
+	}
+}
+
+// Test_ReconcileMempool validates a block from a peer removes its
+// transactions from the mempool and evicts the transactions whose nonce it
+// used.
+func Test_ReconcileMempool(t *testing.T) {
+	var events []string
+	node1 := newNode(miner1PrivateKey, t)
+	node2 := newNodeWithConfig(miner2PrivateKey, t, func(cfg *state.Config) {
+		cfg.EvHandler = func(v string, args ...any) {
+			s := fmt.Sprintf(v, args...)
+			if strings.HasPrefix(s, "viewer: mempool: ") {
+				events = append(events, s)
+			}
+		}
+	})
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+	blk, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining new block: %v", err)
+	}
+
+	// The second node holds a different transaction for the nonce the block
+	// used along with the next transaction for the account.
+	conflict := tx
+	conflict.Value = 2
+	conflictTx := newSignedTx(conflict, kennedyPrivateKey, t)
+
+	next := tx
+	next.Nonce = 2
+
+	for _, signedTx := range []database.SignedTx{conflictTx, newSignedTx(next, kennedyPrivateKey, t)} {
+		if err := node2.UpsertWalletTransaction(signedTx); err != nil {
+			t.Fatalf("Error upserting wallet transaction: %v", err)
+		}
+	}
+
+	events = nil
+	if _, err := node2.ProcessProposedBlock(blk); err != nil {
+		t.Fatalf("Error processing proposed block: %v", err)
+	}
+
+	if n := node2.MempoolLength(); n != 1 {
+		t.Logf("got: %d", n)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should only keep the transaction with the next nonce.")
+	}
+
+	exp := fmt.Sprintf(`viewer: mempool: {"action":"evict","tx_hash":%q,"from":%q,"nonce":1,"count":1}`, conflictTx.TxHash(), kennedyAccountID)
+	if len(events) != 1 || events[0] != exp {
+		t.Logf("got: %v", events)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should report the evicted transaction.")
+	}
+}
+
+func Test_Replay(t *testing.T) {
+	var buf bytes.Buffer
+	node1 := newNodeWithConfig(miner1PrivateKey, t, func(cfg *state.Config) {
+		cfg.Journal = journal.New(&buf)
+	})
+	node2 := newNode(miner2PrivateKey, t)
+
+	tx := database.Tx{
+		ChainID: chainID,
+		Nonce:   1,
+		FromID:  kennedyAccountID,
+		ToID:    edAccountID,
+		Value:   1,
+	}
+
+	if err := node1.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blk1, err := node1.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining block: %v", err)
+	}
+
+	if _, err := node2.ProcessProposedBlock(blk1); err != nil {
+		t.Fatalf("Error proposing block: %v", err)
+	}
+
+	tx.Nonce = 2
+	if err := node2.UpsertWalletTransaction(newSignedTx(tx, kennedyPrivateKey, t)); err != nil {
+		t.Fatalf("Error upserting wallet transaction: %v", err)
+	}
+
+	blk2, err := node2.MineNewBlock(context.Background())
+	if err != nil {
+		t.Fatalf("Error mining block: %v", err)
+	}
+
+	if _, err := node1.ProcessProposedBlock(blk2); err != nil {
+		t.Fatalf("Error proposing block: %v", err)
+	}
+
+	// The same block again is already known and isn't recorded.
+	if status, err := node1.ProcessProposedBlock(blk2); err != nil || status != state.BlockKnown {
+		t.Logf("got: %s, %v", status, err)
+		t.Logf("exp: %s", state.BlockKnown)
+		t.Fatalf("Should report the block as already known.")
+	}
+
+	recorded := buf.String()
+
+	node3 := newNode(miner3PrivateKey, t)
+	result, err := node3.Replay(context.Background(), strings.NewReader(recorded), 0)
+	if err != nil {
+		t.Fatalf("Should be able to replay the journal: %v", err)
+	}
+
+	if len(result.Divergences) != 0 {
+		t.Fatalf("Should replay without divergences: %+v", result.Divergences)
+	}
+
+	if result.LatestHash != node1.LatestBlock().Hash() {
+		t.Logf("got: %s", result.LatestHash)
+		t.Logf("exp: %s", node1.LatestBlock().Hash())
+		t.Fatalf("Should reproduce the chain.")
+	}
+
+	exp := node1.Accounts()
+	node3.Accounts().ForEach(func(account database.Account) {
+		if want, _ := exp.Query(account.AccountID); want != account {
+			t.Logf("got: %+v", account)
+			t.Logf("exp: %+v", want)
+			t.Fatalf("Should reproduce the accounts.")
+		}
+	})
+
+	// Removing the mined block from the journal makes the block from the
+	// peer fail to apply.
+	var tampered []string
+	for _, line := range strings.Split(recorded, "\n") {
+		if !strings.Contains(line, `"kind":"mined_block"`) {
+			tampered = append(tampered, line)
+		}
+	}
+
+	node4 := newNode(miner3PrivateKey, t)
+	result, err = node4.Replay(context.Background(), strings.NewReader(strings.Join(tampered, "\n")), 0)
+	if err != nil {
+		t.Fatalf("Should be able to replay the journal: %v", err)
+	}
+
+	if len(result.Divergences) == 0 || result.Divergences[0].Kind != state.JournalBlock {
+		t.Fatalf("Should report the block that diverged: %+v", result.Divergences)
+	}
 }
 
 // =============================================================================
@@ -181,6 +2931,7 @@ func (n noopWorker) SignalStartMining() {}
 func (n noopWorker) SignalCancelMining() {}
 
 func (n noopWorker) SignalShareTx(blockTx database.BlockTx) {}
+func (n noopWorker) SignalShareVote(vote database.Vote)     {}
 
 // =============================================================================
 
@@ -219,6 +2970,20 @@ func newSignedTx(tx database.Tx, hexKey string, t *testing.T) database.SignedTx
 
 // newNode will create an in memory miner.
 func newNode(hexKey string, t *testing.T) *state.State {
+	return newNodeWithFinality(hexKey, 0, t)
+}
+
+// newNodeWithFinality will create an in memory miner with the specified
+// finality depth.
+func newNodeWithFinality(hexKey string, finalityDepth uint64, t *testing.T) *state.State {
+	return newNodeWithConfig(hexKey, t, func(cfg *state.Config) {
+		cfg.FinalityDepth = finalityDepth
+	})
+}
+
+// newNodeWithConfig will create an in memory miner and allows the config to
+// be changed before the state is constructed.
+func newNodeWithConfig(hexKey string, t *testing.T, change func(cfg *state.Config)) *state.State {
 	if hexKey == "" {
 		t.Fatalf("Error with hexKey being empty.")
 	}
@@ -233,7 +2998,7 @@ func newNode(hexKey string, t *testing.T) *state.State {
 		t.Fatalf("Error setting up memory storage: %v", err)
 	}
 
-	state, err := state.New(state.Config{
+	cfg := state.Config{
 		BeneficiaryID:  database.PublicKeyToAccountID(privateKey.PublicKey),
 		Host:           "http://localhost:9080",
 		Genesis:        newGenesis(),
@@ -241,7 +3006,10 @@ func newNode(hexKey string, t *testing.T) *state.State {
 		SelectStrategy: "Tip",
 		KnownPeers:     peer.NewPeerSet(),
 		EvHandler:      func(v string, args ...any) {},
-	})
+	}
+	change(&cfg)
+
+	state, err := state.New(cfg)
 	if err != nil {
 		t.Fatalf("Error constructing node state: %v", err)
 	}
@@ -0,0 +1,169 @@
+package state
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+)
+
+// Set of states the sync with the peers can be in.
+const (
+	SyncIdle    = "idle"
+	SyncSyncing = "syncing"
+)
+
+// SyncStatus represents the progress of syncing the blockchain with the peers.
+// The target is the highest block a peer reported during the current sync.
+// Once the sync completes, the status of the last sync is kept so a node that
+// is behind can be told apart from a node whose sync is failing.
+type SyncStatus struct {
+	State        string       `json:"state"`
+	Peer         string       `json:"peer,omitempty"`
+	StartBlock   uint64       `json:"start_block"`
+	TargetBlock  uint64       `json:"target_block,omitempty"`
+	CurrentBlock uint64       `json:"current_block"`
+	Behind       uint64       `json:"behind"`                 // Number of blocks the node is behind the target.
+	Remaining    int64        `json:"remaining_ms,omitempty"` // Estimated time to reach the target.
+	Started      *time.Time   `json:"started,omitempty"`
+	Completed    *time.Time   `json:"completed,omitempty"`
+	Error        string       `json:"error,omitempty"`      // Latest error syncing with a peer.
+	ErrorCode    errcode.Code `json:"error_code,omitempty"` // Code of the latest error syncing with a peer.
+	Queued       int          `json:"queued"`               // Number of syncs waiting for this one to complete.
+}
+
+// syncTracker makes sure only one sync runs at a time and tracks its progress.
+type syncTracker struct {
+	run    sync.Mutex // Held for as long as a sync is running.
+	mu     sync.Mutex
+	status SyncStatus
+	peers  map[string]uint64 // Latest block each peer reported by host.
+}
+
+// BeginSync marks the start of a sync with the peers and returns the function
+// to call once the sync completes. Only one sync runs at a time, so a call
+// made while a sync is running waits for it to complete first. Each sync
+// still runs in full since the chain may have changed while it waited.
+func (s *State) BeginSync() func() {
+	s.syncing.mu.Lock()
+	s.syncing.status.Queued++
+	s.syncing.mu.Unlock()
+
+	s.syncing.run.Lock()
+
+	started := time.Now().UTC()
+
+	s.syncing.mu.Lock()
+	s.syncing.status = SyncStatus{
+		State:      SyncSyncing,
+		StartBlock: s.LatestBlock().Header.Number,
+		Started:    &started,
+		Queued:     s.syncing.status.Queued - 1,
+	}
+	s.syncing.mu.Unlock()
+
+	s.syncEvent(SyncStart)
+
+	return func() {
+		completed := time.Now().UTC()
+
+		s.syncing.mu.Lock()
+		s.syncing.status.State = SyncIdle
+		s.syncing.status.Completed = &completed
+		s.syncing.mu.Unlock()
+
+		s.syncEvent(SyncComplete)
+
+		s.syncing.run.Unlock()
+	}
+}
+
+// SyncTarget records the peer being synced with and the latest block it
+// reported. The target only moves up during a sync.
+func (s *State) SyncTarget(host string, blockNumber uint64) {
+	s.syncing.mu.Lock()
+	defer s.syncing.mu.Unlock()
+
+	s.syncing.status.Peer = host
+	if blockNumber > s.syncing.status.TargetBlock {
+		s.syncing.status.TargetBlock = blockNumber
+	}
+}
+
+// SyncError records an error syncing with the peer. The sync carries on with
+// the other peers.
+func (s *State) SyncError(host string, err error) {
+	s.syncing.mu.Lock()
+	s.syncing.status.Peer = host
+	s.syncing.status.Error = err.Error()
+	s.syncing.status.ErrorCode = errcode.Of(errcode.Wrap(errcode.SyncFailed, err))
+	s.syncing.mu.Unlock()
+
+	s.syncEvent(SyncFail)
+}
+
+// SyncStatus returns the progress of the sync with the peers.
+func (s *State) SyncStatus() SyncStatus {
+	s.syncing.mu.Lock()
+	status := s.syncing.status
+	s.syncing.mu.Unlock()
+
+	if status.State == "" {
+		status.State = SyncIdle
+	}
+	status.CurrentBlock = s.db.LatestBlock().Header.Number
+
+	if status.TargetBlock > status.CurrentBlock {
+		status.Behind = status.TargetBlock - status.CurrentBlock
+	}
+
+	// The time remaining is estimated from the rate blocks were added since
+	// the sync started.
+	if status.State == SyncSyncing && status.Behind > 0 && status.CurrentBlock > status.StartBlock {
+		elapsed := time.Since(*status.Started)
+		perBlock := elapsed / time.Duration(status.CurrentBlock-status.StartBlock)
+		status.Remaining = (perBlock * time.Duration(status.Behind)).Milliseconds()
+	}
+
+	return status
+}
+
+// BestPeerBlock returns the highest latest block reported by the known peers,
+// 0 if no peer has reported its status.
+func (s *State) BestPeerBlock() uint64 {
+	peers := s.KnownExternalPeers()
+
+	s.syncing.mu.Lock()
+	defer s.syncing.mu.Unlock()
+
+	var best uint64
+	for _, pr := range peers {
+		if n := s.syncing.peers[pr.Host]; n > best {
+			best = n
+		}
+	}
+
+	return best
+}
+
+// peerBlock records the latest block reported by the peer.
+func (s *State) peerBlock(host string, blockNumber uint64) {
+	s.syncing.mu.Lock()
+	defer s.syncing.mu.Unlock()
+
+	if s.syncing.peers == nil {
+		s.syncing.peers = make(map[string]uint64)
+	}
+	s.syncing.peers[host] = blockNumber
+}
+
+// syncProgress reports a block being added while the node is syncing.
+func (s *State) syncProgress() {
+	s.syncing.mu.Lock()
+	syncing := s.syncing.status.State == SyncSyncing
+	s.syncing.mu.Unlock()
+
+	if syncing {
+		s.syncEvent(SyncProgress)
+	}
+}
@@ -1,11 +1,23 @@
 package state
 
 import (
+	"fmt"
+
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/errcode"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/journal"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/mempool"
 )
 
+// ErrTxNotPending is returned when there is no transaction in the mempool for
+// the account and nonce.
+var ErrTxNotPending = errcode.New(errcode.NotFound, "transaction not pending")
+
 // UpsertWalletTransaction accepts a transaction from a wallet for inclusion.
-func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
+func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) (err error) {
+	defer func() {
+		s.record(journal.Entry{Kind: JournalWalletTx}, signedTx, err)
+	}()
 
 	// CORE NOTE: It's up to the wallet to make sure the account has a proper
 	// balance and this transaction has a proper nonce. Fees will be taken if
@@ -15,14 +27,30 @@ func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 	// Check the signed transaction has a proper signature, the from matches the
 	// signature, and the from and to fields are properly formatted.
 	if err := signedTx.Validate(s.genesis.ChainID); err != nil {
+		return errcode.Wrap(errcode.InvalidTx, err)
+	}
+
+	// Reject accounts with a broken checksum since they were likely mistyped.
+	if err := signedTx.ValidateChecksums(); err != nil {
 		return err
 	}
 
-	const oneUnitOfGas = 1
-	tx := database.NewBlockTx(signedTx, s.genesis.GasPrice, oneUnitOfGas)
-	if err := s.mempool.Upsert(tx); err != nil {
+	// Don't accept a transaction that can't be mined into the next block.
+	nextBlock := s.db.LatestBlock().Header.Number + 1
+	if signedTx.IsExpired(nextBlock) {
+		return errcode.Errorf(errcode.TxExpired, "transaction expired at block %d", signedTx.ValidUntil)
+	}
+
+	// The gas price can be changed by governance and the gas units are
+	// computed from the rules for the transaction's data and value.
+	gasPrice := s.db.GenesisAt(nextBlock).GasPrice
+	gasUnits := s.db.GasUnits(signedTx.Tx, nextBlock)
+
+	tx := database.NewBlockTx(signedTx, gasPrice, gasUnits)
+	if err := s.addToMempool(tx); err != nil {
 		return err
 	}
+	s.mempoolAddEvent(tx)
 
 	s.Worker.SignalShareTx(tx)
 	s.Worker.SignalStartMining()
@@ -30,20 +58,94 @@ func (s *State) UpsertWalletTransaction(signedTx database.SignedTx) error {
 	return nil
 }
 
+// SubmitRawTx decodes a transaction in the raw encoding, such as one signed
+// offline, and accepts it the same as a transaction from a wallet. The hash of
+// the transaction is returned.
+func (s *State) SubmitRawTx(raw []byte) (string, error) {
+	signedTx, err := database.DecodeRawTx(raw)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.UpsertWalletTransaction(signedTx); err != nil {
+		return "", err
+	}
+
+	return signedTx.TxHash(), nil
+}
+
 // UpsertNodeTransaction accepts a transaction from a node for inclusion.
-func (s *State) UpsertNodeTransaction(tx database.BlockTx) error {
+func (s *State) UpsertNodeTransaction(tx database.BlockTx) (err error) {
+	defer func() {
+		s.record(journal.Entry{Kind: JournalNodeTx}, tx, err)
+	}()
 
-	// Check the signed transaction has a proper signature, the from matches the
-	// signature, and the from and to fields are properly formatted.
-	if err := tx.Validate(s.genesis.ChainID); err != nil {
+	if err := s.validateNodeTx(tx); err != nil {
 		return err
 	}
 
-	if err := s.mempool.Upsert(tx); err != nil {
+	// A transaction that arrived before the account paying for it was funded
+	// is held until a block creates the account.
+	held, err := s.holdOrphan(tx)
+	if err != nil {
+		return err
+	}
+	if held {
+		s.evHandler("state: UpsertNodeTransaction: tx[%s]: held until the payer exists", tx)
+		s.mempoolTxEvent(MempoolOrphan, tx)
+		return nil
+	}
+
+	if err := s.addToMempool(tx); err != nil {
 		return err
 	}
+	s.mempoolAddEvent(tx)
 
 	s.Worker.SignalStartMining()
 
 	return nil
 }
+
+// validateNodeTx checks a transaction from a node can be mined into the next
+// block before it's accepted.
+func (s *State) validateNodeTx(tx database.BlockTx) error {
+
+	// Check the signed transaction has a proper signature, the from matches the
+	// signature, and the from and to fields are properly formatted.
+	if err := tx.Validate(s.genesis.ChainID); err != nil {
+		return errcode.Wrap(errcode.InvalidTx, err)
+	}
+
+	// Don't accept a transaction that can't be mined into the next block.
+	nextBlock := s.db.LatestBlock().Header.Number + 1
+	if tx.IsExpired(nextBlock) {
+		return errcode.Errorf(errcode.TxExpired, "transaction expired at block %d", tx.ValidUntil)
+	}
+
+	// The gas units are set by the node that accepted the transaction from
+	// the wallet and must follow the rules for the transaction.
+	if units := s.db.GasUnits(tx.Tx, nextBlock); tx.GasUnits != units {
+		return errcode.Errorf(errcode.InvalidTx, "transaction gas units %d don't match the computed cost %d", tx.GasUnits, units)
+	}
+
+	return nil
+}
+
+// CancelTx returns the unsigned transaction that cancels the pending
+// transaction from the account with the specified nonce. The wallet signs
+// and submits it like any other transaction. The tip is the least needed to
+// replace the pending transaction and always higher than its tip, so miners
+// prefer the cancellation.
+func (s *State) CancelTx(accountID database.AccountID, nonce uint64) (database.Tx, error) {
+	pending, exists := s.mempool.Lookup(accountID, nonce)
+	if !exists {
+		return database.Tx{}, fmt.Errorf("%w: account %s nonce %d", ErrTxNotPending, accountID, nonce)
+	}
+
+	tip := mempool.MinReplacementTip(pending.Tip)
+	if tip <= pending.Tip {
+		tip = pending.Tip + 1
+	}
+
+	return database.NewCancelTx(s.genesis.ChainID, nonce, accountID, tip)
+}
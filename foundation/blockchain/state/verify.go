@@ -0,0 +1,39 @@
+package state
+
+import (
+	"context"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// VerifyStorage walks the blockchain in storage and re-validates every block
+// and the account state. If repair is true and a corrupted block is found,
+// the chain is truncated to the last valid block and the node will sync the
+// missing blocks from its peers.
+func (s *State) VerifyStorage(ctx context.Context, repair bool) (database.VerifyResult, error) {
+	s.evHandler("state: VerifyStorage: started: repair[%v]", repair)
+	defer s.evHandler("state: VerifyStorage: completed")
+
+	// Hold the lock so blocks can't be written while the chain is verified.
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result, err := s.db.Verify(ctx, repair, s.evHandler)
+	if err != nil {
+		return result, err
+	}
+
+	// If the chain was truncated, stop any mining against the old latest
+	// block and catch up with the network in the background.
+	if result.Repaired {
+		s.Worker.SignalCancelMining()
+
+		s.resyncWG.Add(1)
+		go func() {
+			defer s.resyncWG.Done()
+			s.Worker.Sync()
+		}()
+	}
+
+	return result, nil
+}
@@ -0,0 +1,139 @@
+package state
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// votePool holds the votes for the latest block until the next block is
+// proposed with them.
+type votePool struct {
+	mu    sync.Mutex
+	hash  string
+	votes map[database.AccountID]database.Vote
+}
+
+// add adds the vote to the pool, dropping the votes for an earlier block. It
+// returns false if the pool already had a vote from the voter.
+func (vp *votePool) add(vote database.Vote) bool {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+
+	if vote.BlockHash != vp.hash {
+		vp.hash = vote.BlockHash
+		vp.votes = make(map[database.AccountID]database.Vote)
+	}
+
+	if _, exists := vp.votes[vote.VoterID]; exists {
+		return false
+	}
+	vp.votes[vote.VoterID] = vote
+
+	return true
+}
+
+// forBlock returns the votes held for the block with the specified hash.
+func (vp *votePool) forBlock(hash string) []database.Vote {
+	vp.mu.Lock()
+	defer vp.mu.Unlock()
+
+	if hash != vp.hash {
+		return nil
+	}
+
+	votes := make([]database.Vote, 0, len(vp.votes))
+	for _, vote := range vp.votes {
+		votes = append(votes, vote)
+	}
+
+	return votes
+}
+
+// =============================================================================
+
+// AddVote validates a vote received from a peer and adds it to the votes for
+// the latest block. A vote that is new to this node is shared with the peers.
+func (s *State) AddVote(vote database.Vote) error {
+	if s.Consensus() != ConsensusPOS {
+		return fmt.Errorf("votes are only accepted under %s", ConsensusPOS)
+	}
+
+	if err := s.db.ValidateVote(vote); err != nil {
+		return err
+	}
+
+	if s.votes.add(vote) {
+		s.evHandler("state: AddVote: blk[%d]: voter[%s]", vote.Number, vote.VoterID)
+		s.Worker.SignalShareVote(vote)
+	}
+
+	return nil
+}
+
+// Votes returns the votes held for the latest block.
+func (s *State) Votes() []database.Vote {
+	return s.votes.forBlock(s.db.LatestBlock().Hash())
+}
+
+// NetSendVoteToPeers shares a vote with the known peers.
+func (s *State) NetSendVoteToPeers(ctx context.Context, vote database.Vote) {
+	s.evHandler("state: NetSendVoteToPeers: started")
+	defer s.evHandler("state: NetSendVoteToPeers: completed")
+
+	for _, peer := range s.KnownExternalPeers() {
+		if ctx.Err() != nil {
+			return
+		}
+
+		s.evHandler("state: NetSendVoteToPeers: send: blk[%d] voter[%s] to peer[%s]", vote.Number, vote.VoterID, peer)
+
+		url := fmt.Sprintf("%s/vote", s.nodeURL(peer.Host))
+
+		if err := s.send(ctx, http.MethodPost, url, vote, nil); err != nil {
+			s.evHandler("state: NetSendVoteToPeers: WARNING: %s", err)
+		}
+	}
+}
+
+// =============================================================================
+
+// castVote signs a vote for the block this node just applied when its
+// beneficiary is one of the voters. The vote is shared with the peers so the
+// proposer of the next block can aggregate it.
+func (s *State) castVote(block database.Block) {
+	if s.Consensus() != ConsensusPOS || s.blsKey == nil {
+		return
+	}
+
+	vote := database.NewVote(s.genesis.ChainID, block, s.beneficiaryID, s.blsKey)
+	if err := s.db.ValidateVote(vote); err != nil {
+		s.evHandler("state: castVote: blk[%d]: not voting: %s", block.Header.Number, err)
+		return
+	}
+
+	if s.votes.add(vote) {
+		s.evHandler("state: castVote: blk[%d]: voted", block.Header.Number)
+		s.Worker.SignalShareVote(vote)
+	}
+}
+
+// aggregateVotes adds together the votes held for the parent of the block
+// being proposed. Nil is returned when there are no votes.
+func (s *State) aggregateVotes(prevBlock database.Block) *database.Votes {
+	votes := s.votes.forBlock(prevBlock.Hash())
+	if len(votes) == 0 {
+		return nil
+	}
+
+	agg, err := s.db.AggregateVotes(votes)
+	if err != nil {
+		s.evHandler("state: aggregateVotes: WARNING: %s", err)
+		return nil
+	}
+
+	return &agg
+}
@@ -0,0 +1,237 @@
+package state
+
+import (
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// Set of ways a block changed a watched account.
+const (
+	WatchSent     = "sent"     // The account sent value.
+	WatchReceived = "received" // The account received value.
+	WatchFee      = "fee"      // The account paid the fees for a transaction.
+	WatchBalance  = "balance"  // The balance changed without a transaction, such as a mining reward or a rollback.
+)
+
+// WatchEvent represents a change to a watched account made by a block. There
+// is an event for each transaction the account is part of. The balance is the
+// balance after the block was applied.
+type WatchEvent struct {
+	Account      database.AccountID `json:"account"`
+	Action       string             `json:"action"`
+	Block        uint64             `json:"block"`
+	BlockHash    string             `json:"block_hash"`
+	TxHash       string             `json:"tx_hash,omitempty"`
+	Counterparty database.AccountID `json:"counterparty,omitempty"`
+	Value        uint64             `json:"value,omitempty"`
+	Nonce        uint64             `json:"nonce,omitempty"`
+	Balance      uint64             `json:"balance"`
+	Previous     uint64             `json:"previous_balance"`
+}
+
+// CORE NOTE: A wallet backend only cares about a handful of accounts, and
+// indexing the whole chain to find their transactions is a lot of work for
+// that. The accounts are registered on a watch list instead, and each block
+// that changes one of them sends a watch event for it, which the sinks and
+// webhooks pass on. A balance that changed without a transaction, such as a
+// mining reward, is reported on its own.
+
+// WatchAccount adds the account to the watch list.
+func (s *State) WatchAccount(accountID database.AccountID) {
+	if accountID.IsAccountID() {
+		accountID = accountID.Checksum()
+	}
+
+	var balance uint64
+	if account, err := s.db.Query(accountID); err == nil {
+		balance = account.Balance
+	}
+
+	s.watched.add(accountID, balance)
+}
+
+// UnwatchAccount removes the account from the watch list.
+func (s *State) UnwatchAccount(accountID database.AccountID) bool {
+	return s.watched.remove(accountID)
+}
+
+// WatchedAccounts returns the accounts on the watch list sorted by account.
+func (s *State) WatchedAccounts() []database.AccountID {
+	return s.watched.accounts()
+}
+
+// watchEvents sends the watch events for the watched accounts the block
+// changed. The caller must hold the state lock so the balances are the ones
+// right after the block.
+func (s *State) watchEvents(block database.Block) {
+	if s.watched.empty() {
+		return
+	}
+
+	hash := block.Hash()
+	number := block.Header.Number
+
+	var events []WatchEvent
+	changed := make(map[string]bool)
+
+	event := func(accountID database.AccountID, action string, tx database.BlockTx, counterparty database.AccountID) {
+		if !s.watched.has(accountID) {
+			return
+		}
+
+		events = append(events, WatchEvent{
+			Account:      accountID,
+			Action:       action,
+			Block:        number,
+			BlockHash:    hash,
+			TxHash:       tx.TxHash(),
+			Counterparty: counterparty,
+			Value:        tx.Value,
+			Nonce:        tx.Nonce,
+		})
+		changed[watchKey(accountID)] = true
+	}
+
+	for _, tx := range block.MerkleTree.Values() {
+		event(tx.FromID, WatchSent, tx, tx.ToID)
+		if tx.ToID != tx.FromID {
+			event(tx.ToID, WatchReceived, tx, tx.FromID)
+		}
+		if tx.IsSponsored() && tx.FeePayerID != tx.FromID {
+			event(tx.FeePayerID, WatchFee, tx, tx.FromID)
+		}
+	}
+
+	// Record the new balances and report the ones that changed without a
+	// transaction.
+	for _, accountID := range s.watched.accounts() {
+		var balance uint64
+		if account, err := s.db.Query(accountID); err == nil {
+			balance = account.Balance
+		}
+
+		previous, moved := s.watched.update(accountID, balance)
+
+		for i := range events {
+			if watchKey(events[i].Account) == watchKey(accountID) {
+				events[i].Balance = balance
+				events[i].Previous = previous
+			}
+		}
+
+		if moved && !changed[watchKey(accountID)] {
+			events = append(events, WatchEvent{
+				Account:   accountID,
+				Action:    WatchBalance,
+				Block:     number,
+				BlockHash: hash,
+				Balance:   balance,
+				Previous:  previous,
+			})
+		}
+	}
+
+	for _, ev := range events {
+		s.sendEvent(EventWatch, ev)
+	}
+}
+
+// =============================================================================
+
+// watchList keeps the watched accounts with their latest known balance. The
+// zero value is ready to use.
+type watchList struct {
+	mu       sync.Mutex
+	balances map[string]uint64
+	ids      map[string]database.AccountID
+}
+
+// add puts the account on the list with its current balance.
+func (wl *watchList) add(accountID database.AccountID, balance uint64) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	if wl.balances == nil {
+		wl.balances = make(map[string]uint64)
+		wl.ids = make(map[string]database.AccountID)
+	}
+
+	key := watchKey(accountID)
+	if _, exists := wl.ids[key]; exists {
+		return
+	}
+	wl.balances[key] = balance
+	wl.ids[key] = accountID
+}
+
+// remove takes the account off the list.
+func (wl *watchList) remove(accountID database.AccountID) bool {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	key := watchKey(accountID)
+	if _, exists := wl.ids[key]; !exists {
+		return false
+	}
+	delete(wl.balances, key)
+	delete(wl.ids, key)
+
+	return true
+}
+
+// has reports if the account is on the list.
+func (wl *watchList) has(accountID database.AccountID) bool {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	_, exists := wl.ids[watchKey(accountID)]
+	return exists
+}
+
+// empty reports if no account is watched.
+func (wl *watchList) empty() bool {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	return len(wl.ids) == 0
+}
+
+// update records the balance of the account and returns the balance before
+// and if it changed.
+func (wl *watchList) update(accountID database.AccountID, balance uint64) (uint64, bool) {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	key := watchKey(accountID)
+	previous, exists := wl.balances[key]
+	if !exists {
+		return 0, false
+	}
+	wl.balances[key] = balance
+
+	return previous, previous != balance
+}
+
+// accounts returns the watched accounts sorted by account.
+func (wl *watchList) accounts() []database.AccountID {
+	wl.mu.Lock()
+	defer wl.mu.Unlock()
+
+	accounts := make([]database.AccountID, 0, len(wl.ids))
+	for _, accountID := range wl.ids {
+		accounts = append(accounts, accountID)
+	}
+
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+
+	return accounts
+}
+
+// watchKey returns the key for the account, which is the same whatever the
+// case it's written in.
+func watchKey(accountID database.AccountID) string {
+	return strings.ToLower(string(accountID))
+}
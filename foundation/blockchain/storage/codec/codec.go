@@ -0,0 +1,158 @@
+// Package codec provides the compression support storage implementations
+// use when writing block records.
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// List of different codecs that can be used to store records.
+const (
+	None = "none"
+	Gzip = "gzip"
+	Zlib = "zlib"
+)
+
+// Set of codec ids written into the header of each record.
+const (
+	idNone byte = 0
+	idGzip byte = 1
+	idZlib byte = 2
+)
+
+// magic marks the start of a record that carries a codec header. Records
+// written before codecs existed are raw JSON and will not have this header.
+var magic = []byte{'A', 'R', 'D', 'C'}
+
+// headerLength is the length of the magic value plus the codec id.
+const headerLength = 5
+
+// Codec represents a compression algorithm that can be applied to records.
+type Codec struct {
+	ID       byte
+	Name     string
+	compress func(data []byte) ([]byte, error)
+	expand   func(data []byte) ([]byte, error)
+}
+
+// Map of different codecs by name.
+var codecs = map[string]Codec{
+	None: {ID: idNone, Name: None, compress: noneCompress, expand: noneExpand},
+	Gzip: {ID: idGzip, Name: Gzip, compress: gzipCompress, expand: gzipExpand},
+	Zlib: {ID: idZlib, Name: Zlib, compress: zlibCompress, expand: zlibExpand},
+}
+
+// Retrieve returns the specified codec.
+func Retrieve(name string) (Codec, error) {
+	c, exists := codecs[strings.ToLower(name)]
+	if !exists {
+		return Codec{}, fmt.Errorf("codec %q does not exist", name)
+	}
+	return c, nil
+}
+
+// Encode compresses the data and returns a record that includes a header
+// identifying the codec that was used.
+func (c Codec) Encode(data []byte) ([]byte, error) {
+	compressed, err := c.compress(data)
+	if err != nil {
+		return nil, err
+	}
+
+	record := make([]byte, 0, headerLength+len(compressed))
+	record = append(record, magic...)
+	record = append(record, c.ID)
+	record = append(record, compressed...)
+
+	return record, nil
+}
+
+// Decode inspects the record header to identify the codec that was used and
+// returns the expanded data. Records without a header are returned as is to
+// support chains that were written before codecs existed.
+func Decode(record []byte) ([]byte, error) {
+	if !bytes.HasPrefix(record, magic) {
+		return record, nil
+	}
+
+	if len(record) < headerLength {
+		return nil, errors.New("record header is truncated")
+	}
+
+	id := record[len(magic)]
+	for _, c := range codecs {
+		if c.ID == id {
+			return c.expand(record[headerLength:])
+		}
+	}
+
+	return nil, fmt.Errorf("codec id %d does not exist", id)
+}
+
+// =============================================================================
+
+// noneCompress returns the data as is.
+func noneCompress(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// noneExpand returns the data as is.
+func noneExpand(data []byte) ([]byte, error) {
+	return data, nil
+}
+
+// gzipCompress compresses the data using gzip.
+func gzipCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := gzip.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gzipExpand expands data compressed using gzip.
+func gzipExpand(data []byte) ([]byte, error) {
+	r, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
+
+// zlibCompress compresses the data using zlib.
+func zlibCompress(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// zlibExpand expands data compressed using zlib.
+func zlibExpand(data []byte) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return io.ReadAll(r)
+}
@@ -0,0 +1,78 @@
+package codec_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/codec"
+)
+
+func Test_RoundTrip(t *testing.T) {
+	type table struct {
+		name  string
+		codec string
+		data  []byte
+	}
+
+	data := bytes.Repeat([]byte(`{"hash":"0x00","block":{"number":1}}`), 100)
+
+	tt := []table{
+		{name: "none", codec: codec.None, data: data},
+		{name: "gzip", codec: codec.Gzip, data: data},
+		{name: "zlib", codec: codec.Zlib, data: data},
+	}
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			cdc, err := codec.Retrieve(tst.codec)
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to retrieve the codec: %v", tst.name, err)
+			}
+
+			record, err := cdc.Encode(tst.data)
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to encode the data: %v", tst.name, err)
+			}
+
+			if tst.codec != codec.None && len(record) >= len(tst.data) {
+				t.Logf("Test %s:\tgot: %d", tst.name, len(record))
+				t.Logf("Test %s:\texp: < %d", tst.name, len(tst.data))
+				t.Errorf("Test %s:\tShould compress the data.", tst.name)
+			}
+
+			got, err := codec.Decode(record)
+			if err != nil {
+				t.Fatalf("Test %s:\tShould be able to decode the record: %v", tst.name, err)
+			}
+
+			if !bytes.Equal(got, tst.data) {
+				t.Fatalf("Test %s:\tShould get back the original data.", tst.name)
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Legacy(t *testing.T) {
+	data := []byte(`{"hash":"0x00","block":{"number":1}}`)
+
+	got, err := codec.Decode(data)
+	if err != nil {
+		t.Fatalf("Should be able to decode a record without a header: %v", err)
+	}
+
+	if !bytes.Equal(got, data) {
+		t.Fatalf("Should get back the original data.")
+	}
+}
+
+func Test_Unknown(t *testing.T) {
+	if _, err := codec.Retrieve("snappy"); err == nil {
+		t.Fatalf("Should not be able to retrieve an unknown codec.")
+	}
+
+	if _, err := codec.Decode([]byte{'A', 'R', 'D', 'C', 99}); err == nil {
+		t.Fatalf("Should not be able to decode an unknown codec id.")
+	}
+}
@@ -3,31 +3,58 @@
 package disk
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path"
 	"strconv"
+	"strings"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/codec"
 )
 
+// tmpExtension is added to the block file name while the block is written.
+const tmpExtension = ".tmp"
+
 // Disk represents the serialization implementation for reading and storing
 // blocks in their own separate files on disk. This implements the database.Storage
 // interface.
 type Disk struct {
 	dbPath string
+	codec  codec.Codec
 }
 
-// New constructs an Disk value for use.
+// New constructs an Disk value for use that writes uncompressed blocks.
 func New(dbPath string) (*Disk, error) {
+	return NewWithCodec(dbPath, codec.None)
+}
+
+// NewWithCodec constructs an Disk value for use that compresses blocks with
+// the specified codec. Blocks written with any other codec, or before codecs
+// existed, can still be read.
+func NewWithCodec(dbPath string, codecName string) (*Disk, error) {
+	cdc, err := codec.Retrieve(codecName)
+	if err != nil {
+		return nil, err
+	}
+
 	if err := os.MkdirAll(dbPath, 0755); err != nil {
 		return nil, err
 	}
 
-	return &Disk{dbPath: dbPath}, nil
+	d := Disk{
+		dbPath: dbPath,
+		codec:  cdc,
+	}
+
+	// Clean up anything left behind if the process died during a write.
+	if err := d.repair(); err != nil {
+		return nil, fmt.Errorf("repair: %w", err)
+	}
+
+	return &d, nil
 }
 
 // Close in this implementation has nothing to do since a new file is
@@ -40,45 +67,84 @@ func (d *Disk) Close() error {
 // file labeled with the block number.
 func (d *Disk) Write(blockData database.BlockData) error {
 
-	// Marshal the block for writing to disk in a more human readable format.
-	data, err := json.MarshalIndent(blockData, "", "  ")
+	// Encode the block using the binary encoding.
+	data, err := database.EncodeBlockData(blockData)
 	if err != nil {
 		return err
 	}
 
-	// Create a new file for this block and name it based on the block number.
-	f, err := os.OpenFile(d.getPath(blockData.Header.Number), os.O_CREATE|os.O_RDWR, 0600)
+	// Compress the block using the configured codec.
+	record, err := d.codec.Encode(data)
 	if err != nil {
 		return err
 	}
-	defer f.Close()
 
-	// Write the new block to disk.
-	if _, err := f.Write(data); err != nil {
+	// CORE NOTE: The block is written to a temporary file first and then
+	// renamed to the final block file. The rename is atomic so a process that
+	// dies mid-write can never leave a torn block in the chain. Any temporary
+	// files left behind are removed by the repair pass on startup.
+
+	blockPath := d.getPath(blockData.Header.Number)
+	tmpPath := blockPath + tmpExtension
+
+	// Create a temporary file for this block.
+	f, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	// Write the new block to disk and make sure it's flushed.
+	if _, err := f.Write(record); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Move the block into place, replacing any previous version.
+	if err := os.Rename(tmpPath, blockPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	// Flush the directory entry so the rename survives a crash.
+	return syncDir(d.dbPath)
 }
 
 // GetBlock searches the blockchain on disk to locate and return the
 // contents of the specified block by number.
 func (d *Disk) GetBlock(num uint64) (database.BlockData, error) {
 
-	// Open the block file for the specified number.
-	f, err := os.OpenFile(d.getPath(num), os.O_RDONLY, 0600)
+	// Read the block file for the specified number. Blocks written before
+	// the binary encoding existed are stored in a json file.
+	record, err := os.ReadFile(d.getPath(num))
+	if errors.Is(err, fs.ErrNotExist) {
+		record, err = os.ReadFile(d.getLegacyPath(num))
+	}
 	if err != nil {
 		return database.BlockData{}, err
 	}
-	defer f.Close()
+
+	// Expand the block based on the codec recorded in the file.
+	data, err := codec.Decode(record)
+	if err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
+	}
 
 	// Decode the contents of the block.
-	var blockData database.BlockData
-	if err := json.NewDecoder(f).Decode(&blockData); err != nil {
-		return database.BlockData{}, err
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
 	}
 
-	// Return the block as a database block.
 	return blockData, nil
 }
 
@@ -97,14 +163,117 @@ func (d *Disk) Reset() error {
 	return os.MkdirAll(d.dbPath, 0755)
 }
 
+// Truncate removes all the blocks after the specified block number.
+func (d *Disk) Truncate(num uint64) error {
+	for blockNum := num + 1; d.exists(blockNum); blockNum++ {
+		for _, p := range []string{d.getPath(blockNum), d.getLegacyPath(blockNum)} {
+			if err := os.Remove(p); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	return syncDir(d.dbPath)
+}
+
+// CheckWritable reports if blocks can still be written by creating and
+// removing a temporary file in the database directory. A file left behind is
+// removed on the next start.
+func (d *Disk) CheckWritable() error {
+	f, err := os.CreateTemp(d.dbPath, "check-*"+tmpExtension)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(f.Name())
+}
+
+// repair removes temporary files left behind by an interrupted write and
+// truncates the last block if it can't be decoded. Only the tail of the chain
+// an interrupted write can touch is checked, so starting a node doesn't read
+// every block. The rest of the chain is left for the database verification
+// to report and repair.
+func (d *Disk) repair() error {
+	entries, err := os.ReadDir(d.dbPath)
+	if err != nil {
+		return err
+	}
+
+	var last uint64
+	for _, entry := range entries {
+		name := entry.Name()
+
+		if strings.HasSuffix(name, tmpExtension) {
+			if err := os.Remove(path.Join(d.dbPath, name)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		ext := path.Ext(name)
+		if ext != ".blk" && ext != ".json" {
+			continue
+		}
+
+		if num, err := strconv.ParseUint(strings.TrimSuffix(name, ext), 10, 64); err == nil && num > last {
+			last = num
+		}
+	}
+
+	if last == 0 {
+		return nil
+	}
+
+	if _, err := d.GetBlock(last); err == nil {
+		return nil
+	}
+
+	return d.Truncate(last - 1)
+}
+
+// exists checks if a file exists for the specified block.
+func (d *Disk) exists(blockNum uint64) bool {
+	for _, p := range []string{d.getPath(blockNum), d.getLegacyPath(blockNum)} {
+		if _, err := os.Stat(p); err == nil {
+			return true
+		}
+	}
+
+	return false
+}
+
 // getPath forms the path to the specified block.
 func (d *Disk) getPath(blockNum uint64) string {
+	name := strconv.FormatUint(blockNum, 10)
+	return path.Join(d.dbPath, fmt.Sprintf("%s.blk", name))
+}
+
+// getLegacyPath forms the path to the specified block when the block was
+// written as json.
+func (d *Disk) getLegacyPath(blockNum uint64) string {
 	name := strconv.FormatUint(blockNum, 10)
 	return path.Join(d.dbPath, fmt.Sprintf("%s.json", name))
 }
 
 // =============================================================================
 
+// syncDir flushes the directory entries to disk.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// =============================================================================
+
 // diskIterator represents the iteration implementation for walking
 // through and reading blocks on disk. This implements the database
 // Iterator interface.
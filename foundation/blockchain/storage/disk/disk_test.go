@@ -0,0 +1,89 @@
+package disk_test
+
+import (
+	"os"
+	"path"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/disk"
+)
+
+func Test_Repair(t *testing.T) {
+	dbPath := t.TempDir()
+
+	d, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if err := d.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	// Simulate a torn write of the last block and a leftover temporary file.
+	if err := os.WriteFile(path.Join(dbPath, "3.blk"), []byte{1, 0xf8}, 0600); err != nil {
+		t.Fatalf("Should be able to tear block 3: %v", err)
+	}
+	if err := os.WriteFile(path.Join(dbPath, "4.blk.tmp"), []byte{1}, 0600); err != nil {
+		t.Fatalf("Should be able to write a temporary file: %v", err)
+	}
+
+	d, err = disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to repair disk storage: %v", err)
+	}
+
+	var count int
+	iter := d.ForEach()
+	for _, err := iter.Next(); !iter.Done(); _, err = iter.Next() {
+		if err != nil {
+			t.Fatalf("Should be able to read the chain: %v", err)
+		}
+		count++
+	}
+
+	if count != 2 {
+		t.Logf("got: %d", count)
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should have truncated the torn block.")
+	}
+
+	if _, err := os.Stat(path.Join(dbPath, "4.blk.tmp")); err == nil {
+		t.Fatalf("Should have removed the temporary file.")
+	}
+}
+
+func Test_RepairCorrupt(t *testing.T) {
+	dbPath := t.TempDir()
+
+	d, err := disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 3; i++ {
+		if err := d.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	if err := os.WriteFile(path.Join(dbPath, "2.blk"), []byte{1, 0xf8}, 0600); err != nil {
+		t.Fatalf("Should be able to corrupt block 2: %v", err)
+	}
+
+	d, err = disk.New(dbPath)
+	if err != nil {
+		t.Fatalf("Should be able to construct disk storage: %v", err)
+	}
+
+	if _, err := d.GetBlock(2); err == nil {
+		t.Fatalf("Should not repair a block in the middle of the chain.")
+	}
+
+	if _, err := d.GetBlock(3); err != nil {
+		t.Fatalf("Should not truncate the chain after a block in the middle of the chain: %v", err)
+	}
+}
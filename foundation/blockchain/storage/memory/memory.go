@@ -1,5 +1,6 @@
 // Package memory implements the ability to read and write blocks to memory
-// using a slice.
+// using a slice. This allows tests, benchmarks and multi-node simulations to
+// run without touching the filesystem.
 package memory
 
 import (
@@ -33,13 +34,18 @@ func (m *Memory) Write(blockData database.BlockData) error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
-	l := len(m.blocks)
-	if l+1 != int(blockData.Header.Number) {
+	// A block that already exists is replaced, otherwise the block
+	// must be the next block in the chain.
+	l := uint64(len(m.blocks))
+	switch {
+	case blockData.Header.Number >= 1 && blockData.Header.Number <= l:
+		m.blocks[blockData.Header.Number-1] = blockData
+	case blockData.Header.Number == l+1:
+		m.blocks = append(m.blocks, blockData)
+	default:
 		return errors.New("block is out of order")
 	}
 
-	m.blocks = append(m.blocks, blockData)
-
 	return nil
 }
 
@@ -49,12 +55,12 @@ func (m *Memory) GetBlock(num uint64) (database.BlockData, error) {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
-	l := uint64(len(m.blocks))
-	if l == 0 || num >= l {
+	// Block numbers start at 1 and are stored at index 0.
+	if num == 0 || num > uint64(len(m.blocks)) {
 		return database.BlockData{}, errors.New("block does not exist")
 	}
 
-	return m.blocks[num], nil
+	return m.blocks[num-1], nil
 }
 
 // ForEach returns an iterator to walk through all the blocks
@@ -63,7 +69,7 @@ func (m *Memory) ForEach() database.Iterator {
 	return &memoryIterator{storage: m}
 }
 
-// Reset will clear out the blockchain on disk.
+// Reset will clear out the blockchain in memory.
 func (m *Memory) Reset() error {
 	m.mu.Lock()
 	defer m.mu.Unlock()
@@ -72,10 +78,22 @@ func (m *Memory) Reset() error {
 	return nil
 }
 
+// Truncate removes all the blocks after the specified block number.
+func (m *Memory) Truncate(num uint64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if num < uint64(len(m.blocks)) {
+		m.blocks = m.blocks[:num]
+	}
+
+	return nil
+}
+
 // =============================================================================
 
 // memoryIterator represents the iteration implementation for walking
-// through and reading blocks on disk. This implements the database
+// through and reading blocks in memory. This implements the database
 // Iterator interface.
 type memoryIterator struct {
 	storage *Memory // Access to the storage API.
@@ -83,19 +101,18 @@ type memoryIterator struct {
 	eoc     bool    // Represents the iterator is at the end of the chain.
 }
 
-// Next retrieves the next block from disk.
+// Next retrieves the next block from memory.
 func (mi *memoryIterator) Next() (database.BlockData, error) {
 	if mi.eoc {
 		return database.BlockData{}, errors.New("end of chain")
 	}
 
+	mi.current++
 	blockData, err := mi.storage.GetBlock(mi.current)
 	if err != nil {
 		mi.eoc = true
 	}
 
-	mi.current++
-
 	return blockData, err
 }
 
@@ -0,0 +1,93 @@
+package memory_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+)
+
+func Test_Storage(t *testing.T) {
+	const blocks = 5000
+
+	m, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	// Read the chain while it's being written to validate thread safety.
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			iter := m.ForEach()
+			for _, err := iter.Next(); !iter.Done(); _, err = iter.Next() {
+				if err != nil {
+					t.Errorf("Should be able to iterate while writing: %v", err)
+					return
+				}
+			}
+		}
+	}()
+
+	for i := uint64(1); i <= blocks; i++ {
+		if err := m.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+	wg.Wait()
+
+	if err := m.Write(database.BlockData{Header: database.BlockHeader{Number: blocks + 2}}); err == nil {
+		t.Fatalf("Should not be able to write a block out of order.")
+	}
+
+	for _, num := range []uint64{1, 2500, blocks} {
+		blockData, err := m.GetBlock(num)
+		if err != nil {
+			t.Fatalf("Should be able to get block %d: %v", num, err)
+		}
+		if blockData.Header.Number != num {
+			t.Logf("got: %d", blockData.Header.Number)
+			t.Logf("exp: %d", num)
+			t.Fatalf("Should get back the right block.")
+		}
+	}
+
+	if _, err := m.GetBlock(0); err == nil {
+		t.Fatalf("Should not be able to get block 0.")
+	}
+	if _, err := m.GetBlock(blocks + 1); err == nil {
+		t.Fatalf("Should not be able to get a block that doesn't exist.")
+	}
+
+	var next uint64 = 1
+	iter := m.ForEach()
+	for blockData, err := iter.Next(); !iter.Done(); blockData, err = iter.Next() {
+		if err != nil {
+			t.Fatalf("Should be able to iterate: %v", err)
+		}
+		if blockData.Header.Number != next {
+			t.Fatalf("Should iterate in order, got %d, exp %d", blockData.Header.Number, next)
+		}
+		next++
+	}
+	if next != blocks+1 {
+		t.Fatalf("Should iterate over every block, got %d, exp %d", next-1, blocks)
+	}
+
+	if err := m.Truncate(10); err != nil {
+		t.Fatalf("Should be able to truncate: %v", err)
+	}
+	if _, err := m.GetBlock(11); err == nil {
+		t.Fatalf("Should have truncated the chain.")
+	}
+
+	if err := m.Reset(); err != nil {
+		t.Fatalf("Should be able to reset: %v", err)
+	}
+	if _, err := m.GetBlock(1); err == nil {
+		t.Fatalf("Should have reset the chain.")
+	}
+}
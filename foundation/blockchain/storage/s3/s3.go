@@ -0,0 +1,453 @@
+// Package s3 implements the ability to read and write blocks to an S3
+// compatible object store writing each block to a separate object. This
+// allows archive nodes to offload cold chain data to cheap storage.
+package s3
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/codec"
+)
+
+// Config represents the configuration required to access the object store.
+type Config struct {
+	Endpoint  string // Base URL for the object store, ex. https://s3.us-east-1.amazonaws.com
+	Region    string
+	Bucket    string
+	Prefix    string // Prefix added to each object key, ex. miner1/
+	AccessKey string
+	SecretKey string
+	Codec     string // Codec used to compress blocks, defaults to none.
+	CacheSize int    // Number of the most recent blocks kept in memory.
+	Client    *http.Client
+}
+
+// S3 represents the serialization implementation for reading and storing
+// blocks in their own separate objects in an S3 compatible object store.
+// This implements the database.Storage interface.
+type S3 struct {
+	cfg   Config
+	codec codec.Codec
+
+	mu     sync.RWMutex
+	cache  map[uint64]database.BlockData
+	latest uint64
+}
+
+// New constructs an S3 value for use.
+func New(cfg Config) (*S3, error) {
+	if cfg.Endpoint == "" || cfg.Bucket == "" {
+		return nil, errors.New("endpoint and bucket are required")
+	}
+
+	if cfg.Codec == "" {
+		cfg.Codec = codec.None
+	}
+
+	cdc, err := codec.Retrieve(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	if cfg.Client == nil {
+		cfg.Client = &http.Client{Timeout: 30 * time.Second}
+	}
+
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+
+	s := S3{
+		cfg:   cfg,
+		codec: cdc,
+		cache: make(map[uint64]database.BlockData),
+	}
+
+	return &s, nil
+}
+
+// Close in this implementation has nothing to do since each request to the
+// object store is independent.
+func (s *S3) Close() error {
+	return nil
+}
+
+// Write takes the specified database block and stores it in the object
+// store in an object labeled with the block number.
+func (s *S3) Write(blockData database.BlockData) error {
+
+	// Encode the block using the binary encoding.
+	data, err := database.EncodeBlockData(blockData)
+	if err != nil {
+		return err
+	}
+
+	// Compress the block using the configured codec.
+	record, err := s.codec.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	// Object store writes are atomic so a partial block can't be seen.
+	resp, err := s.do(http.MethodPut, s.key(blockData.Header.Number), nil, record)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	s.addCache(blockData)
+
+	return nil
+}
+
+// GetBlock searches the object store to locate and return the contents of
+// the specified block by number. An error that matches fs.ErrNotExist is
+// returned when the block doesn't exist.
+func (s *S3) GetBlock(num uint64) (database.BlockData, error) {
+	s.mu.RLock()
+	blockData, exists := s.cache[num]
+	s.mu.RUnlock()
+
+	if exists {
+		return blockData, nil
+	}
+
+	resp, err := s.do(http.MethodGet, s.key(num), nil, nil)
+	if err != nil {
+		return database.BlockData{}, err
+	}
+	defer resp.Body.Close()
+
+	record, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return database.BlockData{}, err
+	}
+
+	// Expand the block based on the codec recorded in the object.
+	data, err := codec.Decode(record)
+	if err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
+	}
+
+	blockData, err = database.DecodeBlockData(data)
+	if err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
+	}
+
+	s.addCache(blockData)
+
+	return blockData, nil
+}
+
+// ForEach returns an iterator to walk through all the blocks
+// starting with block number 1.
+func (s *S3) ForEach() database.Iterator {
+	return &s3Iterator{storage: s}
+}
+
+// Reset will clear out the blockchain in the object store.
+func (s *S3) Reset() error {
+	keys, err := s.list()
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		resp, err := s.do(http.MethodDelete, key, nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cache = make(map[uint64]database.BlockData)
+	s.latest = 0
+
+	return nil
+}
+
+// Truncate removes all the blocks after the specified block number.
+func (s *S3) Truncate(num uint64) error {
+	for blockNum := num + 1; ; blockNum++ {
+		resp, err := s.do(http.MethodHead, s.key(blockNum), nil, nil)
+		if errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		resp, err = s.do(http.MethodDelete, s.key(blockNum), nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for blockNum := range s.cache {
+		if blockNum > num {
+			delete(s.cache, blockNum)
+		}
+	}
+	if s.latest > num {
+		s.latest = num
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// addCache keeps the most recent blocks in memory so the blocks peers and
+// clients ask for the most don't require a request to the object store.
+func (s *S3) addCache(blockData database.BlockData) {
+	if s.cfg.CacheSize <= 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	num := blockData.Header.Number
+	if num+uint64(s.cfg.CacheSize) <= s.latest {
+		return
+	}
+
+	s.cache[num] = blockData
+	if num > s.latest {
+		s.latest = num
+	}
+
+	for blockNum := range s.cache {
+		if blockNum+uint64(s.cfg.CacheSize) <= s.latest {
+			delete(s.cache, blockNum)
+		}
+	}
+}
+
+// key forms the object key for the specified block. The number is padded so
+// the objects are listed in block order.
+func (s *S3) key(blockNum uint64) string {
+	return fmt.Sprintf("%s%020d.blk", s.cfg.Prefix, blockNum)
+}
+
+// list returns the keys for all the objects under the configured prefix.
+func (s *S3) list() ([]string, error) {
+	var keys []string
+	var token string
+
+	for {
+		query := url.Values{}
+		query.Set("list-type", "2")
+		query.Set("prefix", s.cfg.Prefix)
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := s.do(http.MethodGet, "", query, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		var result struct {
+			Contents []struct {
+				Key string `xml:"Key"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		for _, c := range result.Contents {
+			keys = append(keys, c.Key)
+		}
+
+		if !result.IsTruncated {
+			return keys, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// do performs a signed request against the object store using the path
+// style addressing. A 404 response is returned as fs.ErrNotExist.
+func (s *S3) do(method string, key string, query url.Values, body []byte) (*http.Response, error) {
+	u, err := url.Parse(fmt.Sprintf("%s/%s/%s", s.cfg.Endpoint, s.cfg.Bucket, key))
+	if err != nil {
+		return nil, err
+	}
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = int64(len(body))
+
+	s.sign(req, body, time.Now().UTC())
+
+	resp, err := s.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s: %w", key, fs.ErrNotExist)
+
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		msg, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		return nil, fmt.Errorf("%s %s: status %d: %s", method, key, resp.StatusCode, msg)
+	}
+
+	return resp, nil
+}
+
+// =============================================================================
+
+// sign adds the AWS signature version 4 headers to the request.
+func (s *S3) sign(req *http.Request, body []byte, now time.Time) {
+	const algorithm = "AWS4-HMAC-SHA256"
+	const service = "s3"
+
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+
+	payloadHash := sha256.Sum256(body)
+	payloadHex := hex.EncodeToString(payloadHash[:])
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHex)
+
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+	canonicalHeaders := fmt.Sprintf("host:%s\nx-amz-content-sha256:%s\nx-amz-date:%s\n", req.URL.Host, payloadHex, amzDate)
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		uriEncode(req.URL.Path, false),
+		req.URL.RawQuery,
+		canonicalHeaders,
+		signedHeaders,
+		payloadHex,
+	}, "\n")
+
+	scope := fmt.Sprintf("%s/%s/%s/aws4_request", date, s.cfg.Region, service)
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := strings.Join([]string{
+		algorithm,
+		amzDate,
+		scope,
+		hex.EncodeToString(requestHash[:]),
+	}, "\n")
+
+	key := hmacSHA256([]byte("AWS4"+s.cfg.SecretKey), date)
+	key = hmacSHA256(key, s.cfg.Region)
+	key = hmacSHA256(key, service)
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+
+	auth := fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s", algorithm, s.cfg.AccessKey, scope, signedHeaders, signature)
+	req.Header.Set("Authorization", auth)
+}
+
+// hmacSHA256 returns the HMAC-SHA256 of the data using the key.
+func hmacSHA256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// canonicalQuery returns the query string sorted by key with the values
+// encoded the way the signature requires.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for k := range query {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, k := range keys {
+		for _, v := range query[k] {
+			pairs = append(pairs, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode encodes every byte except the unreserved characters. The slash
+// is only encoded when encodeSlash is true.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+
+	return b.String()
+}
+
+// =============================================================================
+
+// s3Iterator represents the iteration implementation for walking
+// through and reading blocks in the object store. This implements the
+// database Iterator interface.
+type s3Iterator struct {
+	storage *S3    // Access to the storage API.
+	current uint64 // Currenet block number being iterated over.
+	eoc     bool   // Represents the iterator is at the end of the chain.
+}
+
+// Next retrieves the next block from the object store.
+func (si *s3Iterator) Next() (database.BlockData, error) {
+	if si.eoc {
+		return database.BlockData{}, errors.New("end of chain")
+	}
+
+	si.current++
+	blockData, err := si.storage.GetBlock(si.current)
+	if errors.Is(err, fs.ErrNotExist) {
+		si.eoc = true
+	}
+
+	return blockData, err
+}
+
+// Done returns the end of chain value.
+func (si *s3Iterator) Done() bool {
+	return si.eoc
+}
@@ -0,0 +1,140 @@
+package s3_test
+
+import (
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/codec"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/s3"
+)
+
+func Test_Storage(t *testing.T) {
+	store := newObjectStore(t)
+	defer store.Close()
+
+	s, err := s3.New(s3.Config{
+		Endpoint:  store.URL,
+		Region:    "us-east-1",
+		Bucket:    "chain",
+		Prefix:    "miner1/",
+		AccessKey: "access",
+		SecretKey: "secret",
+		Codec:     codec.Gzip,
+		CacheSize: 2,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to construct s3 storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 5; i++ {
+		if err := s.Write(database.BlockData{Hash: "0x01", Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	var count uint64
+	iter := s.ForEach()
+	for blockData, err := iter.Next(); !iter.Done(); blockData, err = iter.Next() {
+		if err != nil {
+			t.Fatalf("Should be able to iterate: %v", err)
+		}
+		count++
+		if blockData.Header.Number != count {
+			t.Fatalf("Should iterate in order, got %d, exp %d", blockData.Header.Number, count)
+		}
+	}
+	if count != 5 {
+		t.Fatalf("Should iterate over every block, got %d, exp %d", count, 5)
+	}
+
+	if err := s.Truncate(3); err != nil {
+		t.Fatalf("Should be able to truncate: %v", err)
+	}
+	if _, err := s.GetBlock(4); err == nil {
+		t.Fatalf("Should have truncated the chain.")
+	}
+	if _, err := s.GetBlock(1); err != nil {
+		t.Fatalf("Should be able to get block 1: %v", err)
+	}
+
+	if err := s.Reset(); err != nil {
+		t.Fatalf("Should be able to reset: %v", err)
+	}
+	if _, err := s.GetBlock(1); err == nil {
+		t.Fatalf("Should have reset the chain.")
+	}
+}
+
+// =============================================================================
+
+// newObjectStore constructs a minimal S3 compatible server that keeps the
+// objects in memory.
+func newObjectStore(t *testing.T) *httptest.Server {
+	var mu sync.Mutex
+	objects := make(map[string][]byte)
+
+	h := func(w http.ResponseWriter, r *http.Request) {
+		if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=access/") {
+			t.Errorf("Should sign every request: %s", r.Header.Get("Authorization"))
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		key := strings.TrimPrefix(r.URL.Path, "/chain/")
+
+		switch r.Method {
+		case http.MethodPut:
+			data, _ := io.ReadAll(r.Body)
+			objects[key] = data
+
+		case http.MethodGet, http.MethodHead:
+			if key == "" {
+				var result struct {
+					XMLName  xml.Name `xml:"ListBucketResult"`
+					Contents []struct {
+						Key string `xml:"Key"`
+					} `xml:"Contents"`
+				}
+				var keys []string
+				for k := range objects {
+					if strings.HasPrefix(k, r.URL.Query().Get("prefix")) {
+						keys = append(keys, k)
+					}
+				}
+				sort.Strings(keys)
+				for _, k := range keys {
+					result.Contents = append(result.Contents, struct {
+						Key string `xml:"Key"`
+					}{k})
+				}
+				xml.NewEncoder(w).Encode(result)
+				return
+			}
+
+			data, exists := objects[key]
+			if !exists {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			if r.Method == http.MethodGet {
+				w.Write(data)
+			}
+
+		case http.MethodDelete:
+			delete(objects, key)
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}
+
+	return httptest.NewServer(http.HandlerFunc(h))
+}
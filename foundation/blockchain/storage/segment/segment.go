@@ -0,0 +1,572 @@
+// Package segment implements the ability to read and write blocks to disk
+// grouping a fixed range of blocks into each segment file. This keeps the
+// number of files bounded and allows whole segments to be pruned, backed up
+// and read in parallel.
+package segment
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/codec"
+)
+
+// DefaultSegmentSize is the number of blocks stored in each segment file
+// when a size is not configured.
+const DefaultSegmentSize = 100_000
+
+// Set of values used to name and lay out the segment files.
+const (
+	segExtension = ".seg"
+	tmpExtension = ".tmp"
+	headerSize   = 16 // number(8) + length(4) + crc(4)
+)
+
+// Config represents the configuration for the segmented storage.
+type Config struct {
+	DBPath      string
+	SegmentSize int    // Number of blocks per segment file, defaults to 100k.
+	Codec       string // Codec used to compress blocks, defaults to none.
+}
+
+// location represents where a block record lives inside a segment file.
+type location struct {
+	segment uint64
+	offset  int64
+	length  uint32
+}
+
+// Segment represents the serialization implementation for reading and
+// storing blocks in segment files on disk. This implements the
+// database.Storage interface.
+type Segment struct {
+	dbPath      string
+	segmentSize uint64
+	codec       codec.Codec
+
+	mu    sync.RWMutex
+	files map[uint64]*os.File // Open segment files by segment number.
+	sizes map[uint64]int64    // Current size of each segment file.
+	index map[uint64]location // Location of each block by number.
+}
+
+// New constructs a Segment value for use. The segment files are scanned
+// to build the index of block offsets and any torn record left behind by
+// an interrupted write is removed.
+func New(cfg Config) (*Segment, error) {
+	if cfg.SegmentSize <= 0 {
+		cfg.SegmentSize = DefaultSegmentSize
+	}
+
+	if cfg.Codec == "" {
+		cfg.Codec = codec.None
+	}
+
+	cdc, err := codec.Retrieve(cfg.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(cfg.DBPath, 0755); err != nil {
+		return nil, err
+	}
+
+	s := Segment{
+		dbPath:      cfg.DBPath,
+		segmentSize: uint64(cfg.SegmentSize),
+		codec:       cdc,
+		files:       make(map[uint64]*os.File),
+		sizes:       make(map[uint64]int64),
+		index:       make(map[uint64]location),
+	}
+
+	if err := s.load(); err != nil {
+		s.Close()
+		return nil, fmt.Errorf("load: %w", err)
+	}
+
+	return &s, nil
+}
+
+// Close closes all the open segment files.
+func (s *Segment) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.closeFiles()
+}
+
+// Write takes the specified database block and appends it to the segment
+// file that holds the block's range. Writing a block that already exists
+// replaces it.
+func (s *Segment) Write(blockData database.BlockData) error {
+	num := blockData.Header.Number
+	if num == 0 {
+		return errors.New("block number 0 can't be stored")
+	}
+
+	// Encode the block using the binary encoding.
+	data, err := database.EncodeBlockData(blockData)
+	if err != nil {
+		return err
+	}
+
+	// Compress the block using the configured codec.
+	record, err := s.codec.Encode(data)
+	if err != nil {
+		return err
+	}
+
+	// CORE NOTE: Records are only ever appended to a segment file. A record
+	// that replaces an existing block is appended as well and the index is
+	// pointed at the new copy. Each record carries a checksum so a record
+	// torn by a process that dies mid-write is found and removed when the
+	// segments are loaded on startup.
+
+	buf := make([]byte, headerSize+len(record))
+	binary.BigEndian.PutUint64(buf[0:8], num)
+	binary.BigEndian.PutUint32(buf[8:12], uint32(len(record)))
+	binary.BigEndian.PutUint32(buf[12:16], crc32.ChecksumIEEE(record))
+	copy(buf[headerSize:], record)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	seg := s.segmentFor(num)
+	f, err := s.openFile(seg)
+	if err != nil {
+		return err
+	}
+
+	offset := s.sizes[seg]
+	if _, err := f.WriteAt(buf, offset); err != nil {
+		f.Truncate(offset)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+
+	s.sizes[seg] = offset + int64(len(buf))
+	s.index[num] = location{
+		segment: seg,
+		offset:  offset + headerSize,
+		length:  uint32(len(record)),
+	}
+
+	return nil
+}
+
+// GetBlock uses the index to locate and return the contents of the
+// specified block by number. An error that matches fs.ErrNotExist is
+// returned when the block doesn't exist.
+func (s *Segment) GetBlock(num uint64) (database.BlockData, error) {
+	s.mu.RLock()
+	loc, exists := s.index[num]
+	f := s.files[loc.segment]
+	s.mu.RUnlock()
+
+	if !exists {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, fs.ErrNotExist)
+	}
+
+	// ReadAt is safe to call concurrently so blocks can be read in parallel.
+	record := make([]byte, loc.length)
+	if _, err := f.ReadAt(record, loc.offset); err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
+	}
+
+	// Expand the block based on the codec recorded in the record.
+	data, err := codec.Decode(record)
+	if err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
+	}
+
+	// Decode the contents of the block.
+	blockData, err := database.DecodeBlockData(data)
+	if err != nil {
+		return database.BlockData{}, fmt.Errorf("block %d: %w", num, err)
+	}
+
+	return blockData, nil
+}
+
+// ForEach returns an iterator to walk through all the blocks
+// starting with block number 1.
+func (s *Segment) ForEach() database.Iterator {
+	return &segmentIterator{storage: s}
+}
+
+// Reset will clear out the blockchain on disk.
+func (s *Segment) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.closeFiles(); err != nil {
+		return err
+	}
+
+	s.files = make(map[uint64]*os.File)
+	s.sizes = make(map[uint64]int64)
+	s.index = make(map[uint64]location)
+
+	if err := os.RemoveAll(s.dbPath); err != nil {
+		return err
+	}
+
+	return os.MkdirAll(s.dbPath, 0755)
+}
+
+// Truncate removes all the blocks after the specified block number. Segment
+// files past the block are removed and the segment holding the block is
+// rewritten with only the blocks that are kept.
+func (s *Segment) Truncate(num uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	keep := uint64(0)
+	if num > 0 {
+		keep = s.segmentFor(num)
+	}
+
+	for seg, f := range s.files {
+		if num > 0 && seg < keep {
+			continue
+		}
+
+		f.Close()
+		delete(s.files, seg)
+		delete(s.sizes, seg)
+
+		if num == 0 || seg > keep {
+			if err := os.Remove(s.getPath(seg)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return err
+			}
+		}
+	}
+
+	for blockNum := range s.index {
+		if blockNum > num {
+			delete(s.index, blockNum)
+		}
+	}
+
+	if num > 0 {
+		if err := s.compact(keep); err != nil {
+			return fmt.Errorf("compact: %w", err)
+		}
+	}
+
+	return syncDir(s.dbPath)
+}
+
+// CheckWritable reports if blocks can still be written by creating and
+// removing a temporary file in the database directory. A file left behind is
+// removed on the next start.
+func (s *Segment) CheckWritable() error {
+	f, err := os.CreateTemp(s.dbPath, "check-*"+tmpExtension)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	return os.Remove(f.Name())
+}
+
+// Segments returns the paths of the segment files in block order. This can
+// be used to back up or copy the chain one segment at a time.
+func (s *Segment) Segments() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	segs := make([]uint64, 0, len(s.files))
+	for seg := range s.files {
+		segs = append(segs, seg)
+	}
+	sort.Slice(segs, func(i, j int) bool { return segs[i] < segs[j] })
+
+	paths := make([]string, len(segs))
+	for i, seg := range segs {
+		paths[i] = s.getPath(seg)
+	}
+
+	return paths
+}
+
+// =============================================================================
+
+// load scans the segment files on disk to build the index of block offsets.
+func (s *Segment) load() error {
+	entries, err := os.ReadDir(s.dbPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		name := entry.Name()
+
+		// Remove anything left behind by an interrupted compaction.
+		if strings.HasSuffix(name, tmpExtension) {
+			if err := os.Remove(path.Join(s.dbPath, name)); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !strings.HasSuffix(name, segExtension) {
+			continue
+		}
+
+		var seg uint64
+		if _, err := fmt.Sscanf(name, "%d"+segExtension, &seg); err != nil {
+			continue
+		}
+
+		if err := s.scan(seg); err != nil {
+			return fmt.Errorf("segment %d: %w", seg, err)
+		}
+	}
+
+	return nil
+}
+
+// scan reads the record headers of the specified segment file and adds
+// each record to the index. The file is truncated at the first record that
+// is torn or fails its checksum since nothing after it can be trusted.
+func (s *Segment) scan(seg uint64) error {
+	f, err := s.openFile(seg)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	size := info.Size()
+
+	var offset int64
+	header := make([]byte, headerSize)
+	for offset < size {
+		if _, err := f.ReadAt(header, offset); err != nil {
+			break
+		}
+
+		num := binary.BigEndian.Uint64(header[0:8])
+		length := binary.BigEndian.Uint32(header[8:12])
+		crc := binary.BigEndian.Uint32(header[12:16])
+
+		end := offset + headerSize + int64(length)
+		if num == 0 || s.segmentFor(num) != seg || end > size {
+			break
+		}
+
+		record := make([]byte, length)
+		if _, err := f.ReadAt(record, offset+headerSize); err != nil {
+			break
+		}
+		if crc32.ChecksumIEEE(record) != crc {
+			break
+		}
+
+		s.index[num] = location{
+			segment: seg,
+			offset:  offset + headerSize,
+			length:  length,
+		}
+
+		offset = end
+	}
+
+	if offset < size {
+		if err := f.Truncate(offset); err != nil {
+			return err
+		}
+		if err := f.Sync(); err != nil {
+			return err
+		}
+	}
+
+	s.sizes[seg] = offset
+
+	return nil
+}
+
+// compact rewrites the specified segment file with only the indexed
+// records, dropping replaced and truncated blocks.
+func (s *Segment) compact(seg uint64) error {
+	segPath := s.getPath(seg)
+	tmpPath := segPath + tmpExtension
+
+	src, err := os.Open(segPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	nums := make([]uint64, 0, s.segmentSize)
+	for num, loc := range s.index {
+		if loc.segment == seg {
+			nums = append(nums, num)
+		}
+	}
+	sort.Slice(nums, func(i, j int) bool { return nums[i] < nums[j] })
+
+	locs := make(map[uint64]location, len(nums))
+	var offset int64
+	for _, num := range nums {
+		loc := s.index[num]
+
+		buf := make([]byte, headerSize+int64(loc.length))
+		if _, err := src.ReadAt(buf, loc.offset-headerSize); err != nil && !errors.Is(err, io.EOF) {
+			dst.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+
+		if _, err := dst.Write(buf); err != nil {
+			dst.Close()
+			os.Remove(tmpPath)
+			return err
+		}
+
+		locs[num] = location{
+			segment: seg,
+			offset:  offset + headerSize,
+			length:  loc.length,
+		}
+		offset += int64(len(buf))
+	}
+
+	if err := dst.Sync(); err != nil {
+		dst.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	if err := dst.Close(); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	if err := os.Rename(tmpPath, segPath); err != nil {
+		os.Remove(tmpPath)
+		return err
+	}
+
+	for num, loc := range locs {
+		s.index[num] = loc
+	}
+
+	if _, err := s.openFile(seg); err != nil {
+		return err
+	}
+	s.sizes[seg] = offset
+
+	return nil
+}
+
+// openFile returns the open segment file, opening or creating it if needed.
+// The caller must hold the write lock.
+func (s *Segment) openFile(seg uint64) (*os.File, error) {
+	if f, exists := s.files[seg]; exists {
+		return f, nil
+	}
+
+	f, err := os.OpenFile(s.getPath(seg), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	s.files[seg] = f
+
+	return f, nil
+}
+
+// closeFiles closes all the open segment files. The caller must hold the
+// write lock.
+func (s *Segment) closeFiles() error {
+	var firstErr error
+	for seg, f := range s.files {
+		if err := f.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+		delete(s.files, seg)
+	}
+
+	return firstErr
+}
+
+// segmentFor returns the segment number that holds the specified block.
+func (s *Segment) segmentFor(blockNum uint64) uint64 {
+	return (blockNum - 1) / s.segmentSize
+}
+
+// getPath forms the path to the specified segment file.
+func (s *Segment) getPath(seg uint64) string {
+	return path.Join(s.dbPath, fmt.Sprintf("%010d%s", seg, segExtension))
+}
+
+// =============================================================================
+
+// syncDir flushes the directory entries to disk.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return f.Sync()
+}
+
+// =============================================================================
+
+// segmentIterator represents the iteration implementation for walking
+// through and reading blocks from the segment files. This implements the
+// database Iterator interface.
+type segmentIterator struct {
+	storage *Segment // Access to the storage API.
+	current uint64   // Current block number being iterated over.
+	eoc     bool     // Represents the iterator is at the end of the chain.
+}
+
+// Next retrieves the next block from the segment files.
+func (si *segmentIterator) Next() (database.BlockData, error) {
+	if si.eoc {
+		return database.BlockData{}, errors.New("end of chain")
+	}
+
+	si.current++
+	blockData, err := si.storage.GetBlock(si.current)
+	if errors.Is(err, fs.ErrNotExist) {
+		si.eoc = true
+	}
+
+	return blockData, err
+}
+
+// Done returns the end of chain value.
+func (si *segmentIterator) Done() bool {
+	return si.eoc
+}
@@ -0,0 +1,104 @@
+package segment_test
+
+import (
+	"os"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/segment"
+)
+
+func Test_Segments(t *testing.T) {
+	cfg := segment.Config{
+		DBPath:      t.TempDir(),
+		SegmentSize: 10,
+	}
+
+	s, err := segment.New(cfg)
+	if err != nil {
+		t.Fatalf("Should be able to construct segment storage: %v", err)
+	}
+
+	for i := uint64(1); i <= 25; i++ {
+		if err := s.Write(database.BlockData{Header: database.BlockHeader{Number: i}}); err != nil {
+			t.Fatalf("Should be able to write block %d: %v", i, err)
+		}
+	}
+
+	// Replace a block so the segment holds a stale copy.
+	if err := s.Write(database.BlockData{Header: database.BlockHeader{Number: 5, Nonce: 99}}); err != nil {
+		t.Fatalf("Should be able to replace block 5: %v", err)
+	}
+
+	if segs := s.Segments(); len(segs) != 3 {
+		t.Logf("got: %d", len(segs))
+		t.Logf("exp: %d", 3)
+		t.Fatalf("Should have 3 segment files.")
+	}
+
+	// Simulate a torn write at the end of the last segment.
+	segs := s.Segments()
+	s.Close()
+
+	f, err := os.OpenFile(segs[2], os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		t.Fatalf("Should be able to open the last segment: %v", err)
+	}
+	f.Write([]byte{0, 0, 0, 0, 0, 0, 0, 26, 0, 0})
+	f.Close()
+
+	s, err = segment.New(cfg)
+	if err != nil {
+		t.Fatalf("Should be able to reload segment storage: %v", err)
+	}
+	defer s.Close()
+
+	if count := count(t, s); count != 25 {
+		t.Logf("got: %d", count)
+		t.Logf("exp: %d", 25)
+		t.Fatalf("Should have loaded all the blocks.")
+	}
+
+	blockData, err := s.GetBlock(5)
+	if err != nil {
+		t.Fatalf("Should be able to get block 5: %v", err)
+	}
+	if blockData.Header.Nonce != 99 {
+		t.Fatalf("Should get back the replaced block.")
+	}
+
+	if err := s.Truncate(12); err != nil {
+		t.Fatalf("Should be able to truncate: %v", err)
+	}
+
+	if count := count(t, s); count != 12 {
+		t.Logf("got: %d", count)
+		t.Logf("exp: %d", 12)
+		t.Fatalf("Should have truncated the chain.")
+	}
+
+	if segs := s.Segments(); len(segs) != 2 {
+		t.Fatalf("Should have removed the last segment file: %v", segs)
+	}
+
+	if err := s.Write(database.BlockData{Header: database.BlockHeader{Number: 13}}); err != nil {
+		t.Fatalf("Should be able to write after truncating: %v", err)
+	}
+
+	if count := count(t, s); count != 13 {
+		t.Fatalf("Should be able to read the new block.")
+	}
+}
+
+func count(t *testing.T, s *segment.Segment) int {
+	var count int
+	iter := s.ForEach()
+	for _, err := iter.Next(); !iter.Done(); _, err = iter.Next() {
+		if err != nil {
+			t.Fatalf("Should be able to read the chain: %v", err)
+		}
+		count++
+	}
+
+	return count
+}
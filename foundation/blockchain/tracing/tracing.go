@@ -0,0 +1,283 @@
+// Package tracing records spans for the operations of a node so the latency of
+// mining, syncing and gossip can be followed from one node to the next. Spans
+// follow the OpenTelemetry model and the trace context is passed to peers in
+// the W3C traceparent header. A nil Tracer records nothing, so nodes only pay
+// for tracing when it's turned on.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is the header the trace context is passed to peers in.
+const TraceparentHeader = "traceparent"
+
+// =============================================================================
+
+// Attribute represents a key/value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value any
+}
+
+// String constructs a string attribute.
+func String(key string, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int constructs an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Uint64 constructs an unsigned integer attribute.
+func Uint64(key string, value uint64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// =============================================================================
+
+// SpanContext identifies a span within a trace.
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+}
+
+// IsValid reports if the span context identifies a span.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// SpanData represents a completed span as it's exported.
+type SpanData struct {
+	Service    string         `json:"service,omitempty"`
+	Name       string         `json:"name"`
+	TraceID    string         `json:"trace_id"`
+	SpanID     string         `json:"span_id"`
+	ParentID   string         `json:"parent_id,omitempty"`
+	Remote     bool           `json:"remote,omitempty"` // The parent span was started by a peer.
+	Start      time.Time      `json:"start"`
+	Duration   int64          `json:"duration_us"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+	Error      string         `json:"error,omitempty"`
+}
+
+// Exporter defines the behavior required to receive the completed spans.
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// ExporterFunc allows a function to be used as an exporter.
+type ExporterFunc func(span SpanData)
+
+// Export calls the function with the completed span.
+func (f ExporterFunc) Export(span SpanData) {
+	f(span)
+}
+
+// =============================================================================
+
+// Tracer starts spans and hands them to the exporter once they end.
+type Tracer struct {
+	service  string
+	exporter Exporter
+}
+
+// New constructs a tracer for the named service, usually the host of the node.
+func New(service string, exporter Exporter) *Tracer {
+	return &Tracer{
+		service:  service,
+		exporter: exporter,
+	}
+}
+
+// Start starts a span as a child of the span in the context, or a new trace
+// if there is none. The returned context carries the new span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+
+	parent, remote := spanContext(ctx)
+
+	sc := SpanContext{TraceID: parent.TraceID}
+	if !parent.IsValid() {
+		rand.Read(sc.TraceID[:])
+	}
+	rand.Read(sc.SpanID[:])
+
+	span := Span{
+		tracer: t,
+		sc:     sc,
+		data: SpanData{
+			Service: t.service,
+			Name:    name,
+			TraceID: hex.EncodeToString(sc.TraceID[:]),
+			SpanID:  hex.EncodeToString(sc.SpanID[:]),
+			Start:   time.Now().UTC(),
+		},
+	}
+
+	if parent.IsValid() {
+		span.data.ParentID = hex.EncodeToString(parent.SpanID[:])
+		span.data.Remote = remote
+	}
+
+	span.SetAttributes(attrs...)
+
+	return context.WithValue(ctx, ctxKey, spanValue{sc: sc}), &span
+}
+
+// =============================================================================
+
+// Span represents a single operation within a trace. A nil Span ignores all
+// calls so callers don't need to check if tracing is turned on.
+type Span struct {
+	tracer *Tracer
+	sc     SpanContext
+
+	mu    sync.Mutex
+	data  SpanData
+	ended bool
+}
+
+// SpanContext returns the identity of the span.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+
+	return s.sc
+}
+
+// SetAttributes adds the attributes to the span, replacing any attribute
+// with the same key.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil || len(attrs) == 0 {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]any, len(attrs))
+	}
+	for _, attr := range attrs {
+		s.data.Attributes[attr.Key] = attr.Value
+	}
+}
+
+// RecordError marks the span as failed with the error. A nil error is
+// ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.data.Error = err.Error()
+}
+
+// End completes the span and exports it. Only the first call has any effect.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.Duration = time.Since(s.data.Start).Microseconds()
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// =============================================================================
+
+// Inject adds the trace context of the span in the context to the headers
+// of a request to a peer.
+func Inject(ctx context.Context, h http.Header) {
+	sc, _ := spanContext(ctx)
+	if !sc.IsValid() {
+		return
+	}
+
+	h.Set(TraceparentHeader, fmt.Sprintf("00-%s-%s-01", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:])))
+}
+
+// Extract returns a context carrying the trace context a peer sent in the
+// headers of a request. Spans started from the context continue the peer's
+// trace. The context is returned unchanged if the header is missing or
+// malformed.
+func Extract(ctx context.Context, h http.Header) context.Context {
+	sc, err := parseTraceparent(h.Get(TraceparentHeader))
+	if err != nil {
+		return ctx
+	}
+
+	return context.WithValue(ctx, ctxKey, spanValue{sc: sc, remote: true})
+}
+
+// =============================================================================
+
+// ctxKey is how the span context is stored in and retrieved from a context.
+const ctxKey key = 1
+
+type key int
+
+// spanValue is the span context stored in a context and if it came from a peer.
+type spanValue struct {
+	sc     SpanContext
+	remote bool
+}
+
+// spanContext returns the span context stored in the context and if it came
+// from a peer.
+func spanContext(ctx context.Context) (SpanContext, bool) {
+	v, ok := ctx.Value(ctxKey).(spanValue)
+	if !ok {
+		return SpanContext{}, false
+	}
+
+	return v.sc, v.remote
+}
+
+// parseTraceparent parses a traceparent header of the form
+// "<version>-<trace id>-<span id>-<flags>".
+func parseTraceparent(value string) (SpanContext, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	var sc SpanContext
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid trace id: %w", err)
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return SpanContext{}, fmt.Errorf("invalid span id: %w", err)
+	}
+
+	if !sc.IsValid() {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	return sc, nil
+}
@@ -0,0 +1,90 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+)
+
+func Test_Span(t *testing.T) {
+	var none *tracing.Tracer
+	ctx, span := none.Start(context.Background(), "none")
+	span.SetAttributes(tracing.Int("count", 1))
+	span.RecordError(errors.New("failed"))
+	span.End()
+
+	h := make(http.Header)
+	tracing.Inject(ctx, h)
+	if h.Get(tracing.TraceparentHeader) != "" {
+		t.Fatalf("Should not inject a trace context without a tracer.")
+	}
+
+	var spans []tracing.SpanData
+	tracer := tracing.New("node1", tracing.ExporterFunc(func(span tracing.SpanData) {
+		spans = append(spans, span)
+	}))
+
+	ctx, parent := tracer.Start(context.Background(), "parent", tracing.String("block", "0x01"))
+	_, child := tracer.Start(ctx, "child")
+	child.RecordError(errors.New("failed"))
+	child.End()
+	child.End()
+	parent.End()
+
+	if len(spans) != 2 {
+		t.Logf("got: %d", len(spans))
+		t.Logf("exp: %d", 2)
+		t.Fatalf("Should export each span once.")
+	}
+
+	if spans[0].TraceID != spans[1].TraceID {
+		t.Fatalf("Should start the child span in the same trace.")
+	}
+
+	if spans[0].ParentID != spans[1].SpanID || spans[1].ParentID != "" {
+		t.Logf("got: %s", spans[0].ParentID)
+		t.Logf("exp: %s", spans[1].SpanID)
+		t.Fatalf("Should link the child span to its parent.")
+	}
+
+	if spans[0].Error != "failed" || spans[1].Attributes["block"] != "0x01" || spans[1].Service != "node1" {
+		t.Fatalf("Should record the error, attributes and service.")
+	}
+}
+
+func Test_Propagation(t *testing.T) {
+	var spans []tracing.SpanData
+	node1 := tracing.New("node1", tracing.ExporterFunc(func(span tracing.SpanData) {
+		spans = append(spans, span)
+	}))
+	node2 := tracing.New("node2", tracing.ExporterFunc(func(span tracing.SpanData) {
+		spans = append(spans, span)
+	}))
+
+	ctx, send := node1.Start(context.Background(), "send")
+
+	h := make(http.Header)
+	tracing.Inject(ctx, h)
+
+	_, recv := node2.Start(tracing.Extract(context.Background(), h), "receive")
+	recv.End()
+	send.End()
+
+	if spans[0].TraceID != spans[1].TraceID || spans[0].ParentID != spans[1].SpanID || !spans[0].Remote {
+		t.Logf("got: %+v", spans[0])
+		t.Logf("exp: parent %s", spans[1].SpanID)
+		t.Fatalf("Should continue the trace of the peer.")
+	}
+
+	bad := make(http.Header)
+	bad.Set(tracing.TraceparentHeader, "00-zz-01")
+	_, span := node2.Start(tracing.Extract(context.Background(), bad), "bad")
+	span.End()
+
+	if spans[2].ParentID != "" {
+		t.Fatalf("Should start a new trace for a malformed header.")
+	}
+}
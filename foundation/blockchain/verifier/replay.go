@@ -0,0 +1,174 @@
+package verifier
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// ledger represents the proven accounts as the transactions in the block are
+// applied. An account without a proof isn't known and stays unknown.
+type ledger map[database.AccountID]database.Account
+
+// get returns the account and reports if it's known.
+func (l ledger) get(accountID database.AccountID) (database.Account, bool) {
+	account, known := l[accountID]
+	return account, known
+}
+
+// set updates a known account. An unknown account stays unknown since its
+// balance before the change isn't known.
+func (l ledger) set(account database.Account, known bool) {
+	if known {
+		l[account.AccountID] = account
+	}
+}
+
+// forget marks the accounts as unknown once a change to them can't be
+// worked out.
+func (l ledger) forget(accountIDs ...database.AccountID) {
+	for _, accountID := range accountIDs {
+		delete(l, accountID)
+	}
+}
+
+// =============================================================================
+
+// replay applies the transactions in the block to the proven accounts the
+// same way a database does and reports the transactions that fail the
+// accounting checks. A transaction sent or paid by an unknown account can't
+// be checked, and neither can the operations carried in the transaction
+// data since they depend on state outside the accounts, so the accounts
+// those transactions change are unknown from then on.
+func replay(block database.Block, accounts map[database.AccountID]database.Account) Report {
+	l := ledger(accounts)
+	number := block.Header.Number
+	bnfcID := block.Header.BeneficiaryID
+
+	var report Report
+	for _, tx := range block.MerkleTree.Values() {
+		from, fromKnown := l.get(tx.FromID)
+		to, toKnown := l.get(tx.ToID)
+		bnfc, bnfcKnown := l.get(bnfcID)
+
+		payer, payerKnown := from, fromKnown
+		if tx.IsSponsored() {
+			payer, payerKnown = l.get(tx.FeePayerID)
+		}
+
+		if !fromKnown || !payerKnown {
+			report.Unchecked = append(report.Unchecked, tx)
+			l.forget(tx.FromID, tx.FeePayerID, tx.ToID, bnfcID)
+			continue
+		}
+
+		// The gas fee is charged the same way whether the transaction is
+		// applied or not.
+		gasPrice := tx.GasPrice
+		if block.Header.BaseFee > 0 {
+			gasPrice = block.Header.BaseFee
+		}
+
+		gasFee := gasPrice * tx.GasUnits
+		if spendable := payer.Spendable(number); gasFee > spendable {
+			gasFee = spendable
+		}
+		payer.Balance -= gasFee
+
+		if block.Header.BaseFee == 0 {
+			bnfc.Balance += gasFee
+		}
+
+		if tx.IsSponsored() {
+			l.set(payer, payerKnown)
+		} else {
+			from = payer
+		}
+		l.set(from, fromKnown)
+		l.set(bnfc, bnfcKnown)
+
+		if err := check(tx, from, payer, number); err != nil {
+			report.Failed = append(report.Failed, TxFailure{Tx: tx, Err: err})
+			continue
+		}
+
+		_, isEscrow := database.ParseEscrowOp(tx.Data)
+		_, isGov := database.ParseGovOp(tx.Data)
+		_, isBond := database.ParseBondOp(tx.Data)
+		_, isName := database.ParseNameOp(tx.Data)
+
+		var ops int
+		for _, is := range []bool{isEscrow, isGov, isBond, isName} {
+			if is {
+				ops++
+			}
+		}
+
+		switch {
+		case ops > 1:
+			report.Failed = append(report.Failed, TxFailure{Tx: tx, Err: errors.New("transaction invalid, data holds more than one operation")})
+			continue
+
+		case ops == 1:
+			report.Unchecked = append(report.Unchecked, tx)
+			l.forget(tx.FromID, tx.FeePayerID, tx.ToID, bnfcID)
+			continue
+		}
+
+		movesValue := !tx.IsCancel()
+		if movesValue {
+			from.Balance -= tx.Value
+			to.Balance += tx.Value
+		}
+
+		switch {
+		case tx.IsSponsored():
+			payer.Balance -= tx.Tip
+		default:
+			from.Balance -= tx.Tip
+		}
+		bnfc.Balance += tx.Tip
+
+		from.Nonce = tx.Nonce
+
+		if tx.IsSponsored() {
+			l.set(payer, payerKnown)
+		}
+		l.set(from, fromKnown)
+		if movesValue {
+			l.set(to, toKnown)
+		}
+		l.set(bnfc, bnfcKnown)
+	}
+
+	return report
+}
+
+// check performs the accounting checks a database runs before a transaction
+// is applied.
+func check(tx database.BlockTx, from database.Account, payer database.Account, number uint64) error {
+	if tx.Nonce != (from.Nonce + 1) {
+		return fmt.Errorf("transaction invalid, %w, got %d, exp %d", database.ErrWrongNonce, tx.Nonce, from.Nonce+1)
+	}
+
+	spendable := from.Spendable(number)
+
+	switch {
+	case tx.IsSponsored():
+		if spendable < tx.Value {
+			return fmt.Errorf("transaction invalid, %w, bal %d, needed %d", database.ErrInsufficientFunds, spendable, tx.Value)
+		}
+
+		if payerSpendable := payer.Spendable(number); payerSpendable < tx.Tip {
+			return fmt.Errorf("transaction invalid, fee payer has %w, bal %d, needed %d", database.ErrInsufficientFunds, payerSpendable, tx.Tip)
+		}
+
+	default:
+		if spendable == 0 || spendable < (tx.Value+tx.Tip) {
+			return fmt.Errorf("transaction invalid, %w, bal %d, needed %d", database.ErrInsufficientFunds, spendable, (tx.Value + tx.Tip))
+		}
+	}
+
+	return nil
+}
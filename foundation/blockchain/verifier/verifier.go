@@ -0,0 +1,191 @@
+// Package verifier validates a block without a database, using only the
+// block, the header of its parent and the proofs of the accounts the block
+// touches. It's meant for audit tools and light clients embedded in other
+// programs that don't keep the state of every account.
+package verifier
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+)
+
+// RuleAccountProofs is the name of the rule checking the account proofs
+// against the state root of the block.
+const RuleAccountProofs = "account_proofs"
+
+// CORE NOTE: A full node checks the state root of a block against the state
+// of every account. Without that state, the verifier checks the proof of
+// each account the block touches hashes up to the state root in the block
+// header, which also proves what those accounts held before the block. The
+// rules that need the whole state can't be checked: the state root itself,
+// the votes that need every validator, the mining reward when the supply is
+// capped and the base fee when it follows the number of transactions in the
+// parent block. Rules added by a consensus engine, like the block proposer,
+// are added to the pipeline by the caller.
+//
+// A transaction that fails its nonce or funds check doesn't make the block
+// invalid, it's only charged the gas fee. The proven accounts are replayed
+// through the block so these transactions are reported instead.
+
+// Report represents the outcome of the transactions in a valid block for the
+// proven accounts.
+type Report struct {
+	Failed    []TxFailure        // Transactions only charged the gas fee.
+	Unchecked []database.BlockTx // Transactions touching an account without a proof.
+}
+
+// TxFailure represents a transaction in the block that wasn't applied.
+type TxFailure struct {
+	Tx  database.BlockTx
+	Err error
+}
+
+// Verifier validates the blocks of a chain without a database.
+type Verifier struct {
+	pipeline  *database.Pipeline
+	evHandler func(v string, args ...any)
+}
+
+// New constructs a verifier for the chain with the genesis. The genesis must
+// be the one in effect for the blocks, with any approved governance changes
+// applied.
+func New(gen genesis.Genesis, evHandler func(v string, args ...any)) *Verifier {
+	if evHandler == nil {
+		evHandler = func(v string, args ...any) {}
+	}
+
+	var rules []database.Rule
+	for _, rule := range database.HeaderRules() {
+		if rule.Name == database.RuleStateRoot {
+			rules = append(rules, accountProofsRule())
+			continue
+		}
+		rules = append(rules, rule)
+	}
+
+	return &Verifier{
+		pipeline:  database.NewPipeline(append(rules, chainRules(gen)...)...),
+		evHandler: evHandler,
+	}
+}
+
+// Pipeline returns the rules blocks are validated with so more rules can be
+// added and the time spent in each rule can be read.
+func (v *Verifier) Pipeline() *database.Pipeline {
+	return v.pipeline
+}
+
+// Verify validates the block on top of the parent with the proofs of the
+// accounts before the block. The proofs of the senders and fee payers in
+// the block, as returned by RequiredAccounts, are needed to check their
+// transactions and a proof for any other account is optional.
+func (v *Verifier) Verify(block database.Block, parent database.BlockHeader, proofs []database.AccountProof) (Report, error) {
+	bc := database.BlockCheck{
+		Block:  block,
+		Parent: database.Block{Header: parent},
+		Proofs: proofs,
+	}
+
+	if err := v.pipeline.Validate(bc, v.evHandler); err != nil {
+		return Report{}, err
+	}
+
+	accounts := make(map[database.AccountID]database.Account, len(proofs))
+	for _, proof := range proofs {
+		accounts[proof.Account.AccountID] = proof.Account
+	}
+
+	return replay(block, accounts), nil
+}
+
+// RequiredAccounts returns the senders and fee payers of the transactions in
+// the block sorted by account id, which are the accounts a proof is needed
+// for to check every transaction.
+func RequiredAccounts(block database.Block) []database.AccountID {
+	unique := make(map[database.AccountID]struct{})
+	for _, tx := range block.MerkleTree.Values() {
+		unique[tx.FromID] = struct{}{}
+		if tx.IsSponsored() {
+			unique[tx.FeePayerID] = struct{}{}
+		}
+	}
+
+	accountIDs := make([]database.AccountID, 0, len(unique))
+	for accountID := range unique {
+		accountIDs = append(accountIDs, accountID)
+	}
+
+	sort.Slice(accountIDs, func(i, j int) bool {
+		return accountIDs[i] < accountIDs[j]
+	})
+
+	return accountIDs
+}
+
+// =============================================================================
+
+// accountProofsRule returns the rule checking every proof is for an account
+// in the state the block was built on.
+func accountProofsRule() database.Rule {
+	return database.Rule{
+		Name: RuleAccountProofs,
+		Desc: "account proofs do match the state root",
+		Check: func(bc database.BlockCheck) error {
+			for _, proof := range bc.Proofs {
+				if err := database.VerifyAccountProof(proof, bc.Block.Header.StateRoot); err != nil {
+					return fmt.Errorf("account %s: %w", proof.Account.AccountID, err)
+				}
+			}
+			return nil
+		},
+	}
+}
+
+// chainRules returns the rules checking the block against the genesis, which
+// are the rules a database runs that don't need the state of the accounts.
+// Only the mining reward and the base fee are checked differently, since a
+// database checks them against the supply and the parent block it holds.
+func chainRules(gen genesis.Genesis) []database.Rule {
+	rules := []database.Rule{
+		{
+			Name: database.RuleMiningReward,
+			Desc: "mining reward follows the monetary policy",
+			Check: func(bc database.BlockCheck) error {
+
+				// Without the supply the reward is checked against the most the policy
+				// allows for the block, which is the reward before any supply cap.
+				if reward := gen.MiningRewardAt(bc.Block.Header.Number, 0); bc.Block.Header.MiningReward > reward {
+					return fmt.Errorf("mining reward is greater than allowed, got %d, exp %d", bc.Block.Header.MiningReward, reward)
+				}
+				return nil
+			},
+		},
+		{
+			Name: database.RuleBaseFee,
+			Desc: "base fee follows the parent block",
+			Check: func(bc database.BlockCheck) error {
+
+				// Without a block gas limit the base fee follows the number of
+				// transactions in the parent block, which isn't in its header.
+				parent := bc.Parent.Header
+				if gen.BaseFee > 0 && gen.BlockGasLimit == 0 && parent.Number > 0 {
+					return nil
+				}
+
+				if baseFee := gen.NextBaseFee(parent.Number, parent.BaseFee, 0, parent.GasUsed); bc.Block.Header.BaseFee != baseFee {
+					return fmt.Errorf("base fee is wrong, got %d, exp %d", bc.Block.Header.BaseFee, baseFee)
+				}
+				return nil
+			},
+		},
+	}
+
+	genesisAt := func(bc database.BlockCheck) genesis.Genesis {
+		return gen
+	}
+
+	return append(rules, database.GenesisRules(genesisAt)...)
+}
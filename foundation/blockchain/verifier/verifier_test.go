@@ -0,0 +1,175 @@
+package verifier_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/genesis"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/storage/memory"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/verifier"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	fromID = "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4"
+	toID   = "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32"
+)
+
+func Test_Verify(t *testing.T) {
+	ev := func(v string, args ...any) {}
+
+	gen := genesis.Genesis{
+		ChainID:      1,
+		Difficulty:   1,
+		MiningReward: 700,
+		Balances:     map[string]uint64{fromID: 1000},
+	}
+
+	storage, err := memory.New()
+	if err != nil {
+		t.Fatalf("Should be able to construct memory storage: %v", err)
+	}
+
+	db, err := database.New(gen, storage, ev)
+	if err != nil {
+		t.Fatalf("Should be able to open database: %v", err)
+	}
+
+	// The third block sends a transaction with a nonce already used, which
+	// is only charged the gas fee.
+	for _, nonce := range []uint64{1, 2, 2} {
+		mineBlock(t, db, nonce)
+	}
+
+	v := verifier.New(gen, ev)
+
+	for number := uint64(2); number <= 3; number++ {
+		block, parent, proofs := blockProofs(t, db, number)
+
+		report, err := v.Verify(block, parent.Header, proofs)
+		if err != nil {
+			t.Fatalf("Should be able to verify block %d: %v", number, err)
+		}
+		if len(report.Unchecked) != 0 {
+			t.Fatalf("Should have checked every transaction in block %d: %+v", number, report.Unchecked)
+		}
+
+		switch number {
+		case 2:
+			if len(report.Failed) != 0 {
+				t.Fatalf("Should have applied every transaction in block 2: %+v", report.Failed)
+			}
+		case 3:
+			if len(report.Failed) != 1 || !errors.Is(report.Failed[0].Err, database.ErrWrongNonce) {
+				t.Fatalf("Should have reported the transaction with the used nonce: %+v", report.Failed)
+			}
+		}
+	}
+
+	block, parent, proofs := blockProofs(t, db, 2)
+
+	// Without the proof of the sender the transaction can't be checked.
+	report, err := v.Verify(block, parent.Header, nil)
+	if err != nil {
+		t.Fatalf("Should be able to verify the block without proofs: %v", err)
+	}
+	if len(report.Unchecked) != 1 {
+		t.Fatalf("Should have left the transaction unchecked: %+v", report)
+	}
+
+	// A proof for an account that doesn't match the state root.
+	proofs[0].Account.Balance++
+	if _, err := v.Verify(block, parent.Header, proofs); err == nil {
+		t.Fatalf("Should not be able to verify the block with a changed proof.")
+	}
+	proofs[0].Account.Balance--
+
+	// A parent that isn't the block's parent.
+	other, err := db.GetBlock(3)
+	if err != nil {
+		t.Fatalf("Should be able to get block 3: %v", err)
+	}
+	if _, err := v.Verify(block, other.Header, proofs); err == nil {
+		t.Fatalf("Should not be able to verify the block on top of another parent.")
+	}
+
+	// A block with a mining reward over the monetary policy.
+	block.Header.MiningReward++
+	if _, err := v.Verify(block, parent.Header, proofs); err == nil {
+		t.Fatalf("Should not be able to verify a changed block.")
+	}
+}
+
+// =============================================================================
+
+// mineBlock mines a block with a transaction from the funded account with the
+// nonce and applies it to the database.
+func mineBlock(t *testing.T, db *database.Database, nonce uint64) {
+	ev := func(v string, args ...any) {}
+
+	pk, err := crypto.HexToECDSA("fae85851bdf5c9f49923722ce38f3c1defcfd3619ef5453230a58ad805499959")
+	if err != nil {
+		t.Fatalf("Should be able to load the private key: %v", err)
+	}
+
+	signedTx, err := database.Tx{
+		ChainID: 1,
+		Nonce:   nonce,
+		FromID:  fromID,
+		ToID:    toID,
+		Value:   10,
+	}.Sign(pk)
+	if err != nil {
+		t.Fatalf("Should be able to sign transaction: %v", err)
+	}
+	blockTx := database.NewBlockTx(signedTx, 1, 1)
+
+	number := db.LatestBlock().Header.Number + 1
+	block, err := database.POW(context.Background(), database.POWArgs{
+		BeneficiaryID: "0xFef311483Cc040e1A89fb9bb469eeB8A70935EF8",
+		Difficulty:    1,
+		MiningReward:  db.MiningReward(number),
+		BaseFee:       db.NextBaseFee(),
+		PrevBlock:     db.LatestBlock(),
+		StateRoot:     db.HashState(),
+		Trans:         []database.BlockTx{blockTx},
+		EvHandler:     ev,
+	})
+	if err != nil {
+		t.Fatalf("Should be able to mine block %d: %v", number, err)
+	}
+
+	if err := db.Write(block); err != nil {
+		t.Fatalf("Should be able to write block %d: %v", number, err)
+	}
+	db.ApplyTransaction(block, blockTx)
+	db.ApplyMiningReward(block)
+	db.UpdateLatestBlock(block)
+}
+
+// blockProofs returns the block, its parent and the proofs of the accounts
+// needed to verify it.
+func blockProofs(t *testing.T, db *database.Database, number uint64) (database.Block, database.Block, []database.AccountProof) {
+	block, err := db.GetBlock(number)
+	if err != nil {
+		t.Fatalf("Should be able to get block %d: %v", number, err)
+	}
+
+	parent, err := db.GetBlock(number - 1)
+	if err != nil {
+		t.Fatalf("Should be able to get block %d: %v", number-1, err)
+	}
+
+	var proofs []database.AccountProof
+	for _, accountID := range verifier.RequiredAccounts(block) {
+		proof, err := db.AccountProof(context.Background(), accountID, number)
+		if err != nil {
+			t.Fatalf("Should be able to generate a proof for %s: %v", accountID, err)
+		}
+		proofs = append(proofs, proof)
+	}
+
+	return block, parent, proofs
+}
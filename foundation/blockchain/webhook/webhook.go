@@ -0,0 +1,344 @@
+// Package webhook notifies external systems, such as exchanges and alerting,
+// of chain events by posting them to a URL. Each webhook has the events it
+// fires on and can sign the notifications so the receiver can check they
+// came from the node.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/google/uuid"
+)
+
+// Set of events a webhook can fire on.
+const (
+	EventBlock       = "block"        // A block was added to the chain.
+	EventTransfer    = "transfer"     // A transaction in a new block moved at least the minimum value.
+	EventReorg       = "reorg"        // Blocks were removed from the chain by a rollback.
+	EventPeerRemoved = "peer_removed" // A peer was removed from the peer table, by an operator or for a bad score.
+	EventWatch       = "watch"        // A block changed an account on the node's watch list.
+)
+
+// events is the set of events a webhook can fire on.
+var events = map[string]bool{
+	EventBlock:       true,
+	EventTransfer:    true,
+	EventReorg:       true,
+	EventPeerRemoved: true,
+	EventWatch:       true,
+}
+
+// Set of headers sent with a notification.
+const (
+	HeaderEvent     = "X-Blockchain-Event"
+	HeaderDelivery  = "X-Blockchain-Delivery"
+	HeaderSignature = "X-Blockchain-Signature" // sha256=<hex HMAC-SHA256 of the body>
+)
+
+// Set of values used to deliver the notifications.
+const (
+	deliveryAttempts = 3                      // Attempts made to deliver a notification.
+	deliveryBackoff  = 500 * time.Millisecond // Wait before the first retry, doubled after each one.
+	deliveryTimeout  = 10 * time.Second       // Longest a receiver is waited on for each attempt.
+)
+
+// Config represents a URL to notify and the events it's notified of.
+type Config struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Events   []string `json:"events,omitempty"`    // Events the webhook fires on, empty fires on all of them.
+	Secret   string   `json:"secret,omitempty"`    // Key the notifications are signed with, empty sends them unsigned.
+	MinValue uint64   `json:"min_value,omitempty"` // Lowest value of a transfer that is notified, 0 notifies every transfer.
+}
+
+// Validate checks the webhook has a name, an http or https URL and only
+// fires on known events.
+func (cfg Config) Validate() error {
+	if cfg.Name == "" {
+		return errors.New("webhook name is required")
+	}
+
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return fmt.Errorf("webhook %s: %w", cfg.Name, err)
+	}
+
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("webhook %s: url %q must be an http or https URL", cfg.Name, cfg.URL)
+	}
+
+	for _, event := range cfg.Events {
+		if !events[event] {
+			return fmt.Errorf("webhook %s: unknown event %q", cfg.Name, event)
+		}
+	}
+
+	return nil
+}
+
+// Load reads the webhooks from a JSON file with a list of webhooks.
+func Load(path string) ([]Config, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfgs []Config
+	if err := json.Unmarshal(content, &cfgs); err != nil {
+		return nil, fmt.Errorf("decoding webhooks %s: %w", path, err)
+	}
+
+	names := make(map[string]bool)
+	for _, cfg := range cfgs {
+		if err := cfg.Validate(); err != nil {
+			return nil, err
+		}
+
+		if names[cfg.Name] {
+			return nil, fmt.Errorf("webhook %s is configured more than once", cfg.Name)
+		}
+		names[cfg.Name] = true
+	}
+
+	return cfgs, nil
+}
+
+// =============================================================================
+
+// Notification represents the body posted to the webhook URL.
+type Notification struct {
+	ID    string    `json:"id"`
+	Event string    `json:"event"`
+	Time  time.Time `json:"time"`
+	Data  any       `json:"data"`
+}
+
+// Transfer represents a transaction in a new block that moved at least the
+// minimum value.
+type Transfer struct {
+	Block     uint64             `json:"block"`
+	BlockHash string             `json:"block_hash"`
+	TxHash    string             `json:"tx_hash"`
+	FromID    database.AccountID `json:"from"`
+	ToID      database.AccountID `json:"to"`
+	Value     uint64             `json:"value"`
+	Nonce     uint64             `json:"nonce"`
+}
+
+// Webhook turns the events from the node into notifications and posts them
+// to the URL.
+type Webhook struct {
+	cfg    Config
+	events map[string]bool
+	client *http.Client
+	ev     func(v string, args ...any)
+	ctx    context.Context // Cancelled on shutdown to stop the waits between retries.
+	cancel context.CancelFunc
+}
+
+// New constructs a webhook for the configuration. The client is used to post
+// the notifications, nil uses the default client.
+func New(cfg Config, client *http.Client, ev func(v string, args ...any)) (*Webhook, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	if ev == nil {
+		ev = func(v string, args ...any) {}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wh := Webhook{
+		cfg:    cfg,
+		client: client,
+		ev:     ev,
+		ctx:    ctx,
+		cancel: cancel,
+	}
+
+	if len(cfg.Events) > 0 {
+		wh.events = make(map[string]bool, len(cfg.Events))
+		for _, event := range cfg.Events {
+			wh.events[event] = true
+		}
+	}
+
+	return &wh, nil
+}
+
+// Stop cancels the waits between retries, so each notification still waiting
+// is only tried once more before it's dropped. It's called before the node
+// shuts down so a receiver that is down doesn't hold up the shutdown.
+func (wh *Webhook) Stop() {
+	wh.cancel()
+}
+
+// Sink returns the sink to register with the node. The notifications are
+// posted from the sink's goroutine, one at a time in the order of the events.
+func (wh *Webhook) Sink() state.Sink {
+	return state.Sink{
+		Name:   "webhook:" + wh.cfg.Name,
+		Kinds:  []string{state.EventBlock, state.EventReorg, state.EventPeer, state.EventWatch},
+		Handle: wh.handle,
+	}
+}
+
+// handle turns an event from the node into the notifications the webhook
+// fires on.
+func (wh *Webhook) handle(ev state.Event) {
+	switch v := ev.Value.(type) {
+	case database.BlockData:
+		if wh.firesOn(EventBlock) {
+			wh.notify(EventBlock, ev.Time, v)
+		}
+
+		if wh.firesOn(EventTransfer) {
+			for _, tx := range v.Trans {
+				if tx.Value == 0 || tx.Value < wh.cfg.MinValue {
+					continue
+				}
+
+				wh.notify(EventTransfer, ev.Time, Transfer{
+					Block:     v.Header.Number,
+					BlockHash: v.Hash,
+					TxHash:    tx.TxHash(),
+					FromID:    tx.FromID,
+					ToID:      tx.ToID,
+					Value:     tx.Value,
+					Nonce:     tx.Nonce,
+				})
+			}
+		}
+
+	case state.ReorgEvent:
+		if wh.firesOn(EventReorg) {
+			wh.notify(EventReorg, ev.Time, v)
+		}
+
+	case state.PeerEvent:
+		if v.Action == state.PeerRemove && wh.firesOn(EventPeerRemoved) {
+			wh.notify(EventPeerRemoved, ev.Time, v)
+		}
+
+	case state.WatchEvent:
+		if wh.firesOn(EventWatch) {
+			wh.notify(EventWatch, ev.Time, v)
+		}
+	}
+}
+
+// firesOn reports if the webhook fires on the event.
+func (wh *Webhook) firesOn(event string) bool {
+	return len(wh.events) == 0 || wh.events[event]
+}
+
+// notify posts the notification, retrying a failed delivery with a growing
+// wait between attempts. A notification that can't be delivered is dropped.
+func (wh *Webhook) notify(event string, t time.Time, data any) {
+	n := Notification{
+		ID:    uuid.NewString(),
+		Event: event,
+		Time:  t,
+		Data:  data,
+	}
+
+	body, err := json.Marshal(n)
+	if err != nil {
+		wh.ev("webhook: notify: %s: %s: ERROR: %s", wh.cfg.Name, event, err)
+		return
+	}
+
+	backoff := deliveryBackoff
+	for attempt := 1; ; attempt++ {
+		err := wh.deliver(n, body)
+		if err == nil {
+			wh.ev("webhook: notify: %s: %s: delivered[%s]: attempt[%d]", wh.cfg.Name, event, n.ID, attempt)
+			return
+		}
+
+		wh.ev("webhook: notify: %s: %s: delivery[%s]: attempt[%d]: WARNING: %s", wh.cfg.Name, event, n.ID, attempt, err)
+
+		if attempt >= deliveryAttempts {
+			wh.ev("webhook: notify: %s: %s: dropped[%s]", wh.cfg.Name, event, n.ID)
+			return
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-wh.ctx.Done():
+			timer.Stop()
+			wh.ev("webhook: notify: %s: %s: dropped[%s], shutting down", wh.cfg.Name, event, n.ID)
+			return
+		}
+
+		backoff *= 2
+	}
+}
+
+// deliver posts the notification to the URL once. Any 2xx status is
+// accepted as delivered.
+func (wh *Webhook) deliver(n Notification, body []byte) error {
+	ctx, cancel := context.WithTimeout(context.Background(), deliveryTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.cfg.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(HeaderEvent, n.Event)
+	req.Header.Set(HeaderDelivery, n.ID)
+	if wh.cfg.Secret != "" {
+		req.Header.Set(HeaderSignature, Sign(wh.cfg.Secret, body))
+	}
+
+	resp, err := wh.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// =============================================================================
+
+// Sign returns the signature of the body sent in the signature header.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature from the signature header matches the body.
+// Receivers use it to check a notification came from the node.
+func Verify(secret string, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
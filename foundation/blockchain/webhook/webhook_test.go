@@ -0,0 +1,186 @@
+package webhook_test
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/webhook"
+)
+
+const (
+	kennedy = database.AccountID("0xF01813E4B85e178A83e29B8E7bF26BD830a25f32")
+	pavel   = database.AccountID("0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4")
+)
+
+func Test_Notify(t *testing.T) {
+	const secret = "hush"
+
+	var mu sync.Mutex
+	var received []webhook.Notification
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify(secret, body, r.Header.Get(webhook.HeaderSignature)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var n webhook.Notification
+		json.Unmarshal(body, &n)
+
+		if r.Header.Get(webhook.HeaderEvent) != n.Event || r.Header.Get(webhook.HeaderDelivery) != n.ID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		mu.Lock()
+		received = append(received, n)
+		mu.Unlock()
+	}))
+	defer srv.Close()
+
+	wh, err := webhook.New(webhook.Config{
+		Name:     "exchange",
+		URL:      srv.URL,
+		Events:   []string{webhook.EventTransfer, webhook.EventPeerRemoved},
+		Secret:   secret,
+		MinValue: 100,
+	}, srv.Client(), nil)
+	if err != nil {
+		t.Fatalf("Should be able to construct the webhook: %v", err)
+	}
+
+	tx := func(value uint64) database.BlockTx {
+		return database.BlockTx{SignedTx: database.SignedTx{Tx: database.Tx{FromID: kennedy, ToID: pavel, Value: value}}}
+	}
+
+	block := database.BlockData{
+		Hash:   "0x01",
+		Header: database.BlockHeader{Number: 1},
+		Trans:  []database.BlockTx{tx(50), tx(100), tx(500)},
+	}
+
+	sink := wh.Sink()
+	sink.Handle(state.Event{Kind: state.EventBlock, Value: block, Time: time.Now()})
+	sink.Handle(state.Event{Kind: state.EventPeer, Value: state.PeerEvent{Action: state.PeerAdd, Host: "10.0.0.1:9080"}, Time: time.Now()})
+	sink.Handle(state.Event{Kind: state.EventPeer, Value: state.PeerEvent{Action: state.PeerRemove, Host: "10.0.0.1:9080"}, Time: time.Now()})
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	var events []string
+	for _, n := range received {
+		events = append(events, n.Event)
+	}
+
+	exp := []string{webhook.EventTransfer, webhook.EventTransfer, webhook.EventPeerRemoved}
+	if len(events) != len(exp) {
+		t.Logf("got: %v", events)
+		t.Logf("exp: %v", exp)
+		t.Fatalf("Should only notify the transfers over the minimum and the removed peer.")
+	}
+
+	for i := range exp {
+		if events[i] != exp[i] {
+			t.Logf("got: %v", events)
+			t.Logf("exp: %v", exp)
+			t.Fatalf("Should notify the events in order.")
+		}
+	}
+
+	if transfer, ok := received[0].Data.(map[string]any); !ok || transfer["value"] != float64(100) {
+		t.Logf("got: %+v", received[0].Data)
+		t.Fatalf("Should send the transfer details.")
+	}
+}
+
+func Test_Stop(t *testing.T) {
+	var mu sync.Mutex
+	var attempts int
+	failed := make(chan struct{}, 1)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+
+		w.WriteHeader(http.StatusServiceUnavailable)
+
+		select {
+		case failed <- struct{}{}:
+		default:
+		}
+	}))
+	defer srv.Close()
+
+	wh, err := webhook.New(webhook.Config{Name: "exchange", URL: srv.URL, Events: []string{webhook.EventPeerRemoved}}, srv.Client(), nil)
+	if err != nil {
+		t.Fatalf("Should be able to construct the webhook: %v", err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wh.Sink().Handle(state.Event{Kind: state.EventPeer, Value: state.PeerEvent{Action: state.PeerRemove, Host: "10.0.0.1:9080"}, Time: time.Now()})
+		close(done)
+	}()
+
+	// Stopping the webhook while it waits to retry drops the notification.
+	<-failed
+	wh.Stop()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Should stop waiting between retries once stopped.")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if attempts != 1 {
+		t.Logf("got: %d", attempts)
+		t.Logf("exp: %d", 1)
+		t.Fatalf("Should not retry the notification after the webhook is stopped.")
+	}
+}
+
+func Test_Load(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "webhooks.json")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("Should be able to write the webhooks: %v", err)
+		}
+		return path
+	}
+
+	cfgs, err := webhook.Load(write(`[{"name":"alerts","url":"https://example.com/hook","events":["reorg"]}]`))
+	if err != nil || len(cfgs) != 1 || cfgs[0].Events[0] != webhook.EventReorg {
+		t.Logf("got: %+v", cfgs)
+		t.Fatalf("Should be able to load the webhooks: %v", err)
+	}
+
+	tt := []struct {
+		name    string
+		content string
+	}{
+		{"unknown event", `[{"name":"alerts","url":"https://example.com/hook","events":["mempool"]}]`},
+		{"bad url", `[{"name":"alerts","url":"ftp://example.com/hook"}]`},
+		{"no name", `[{"url":"https://example.com/hook"}]`},
+		{"duplicate", `[{"name":"alerts","url":"https://example.com/a"},{"name":"alerts","url":"https://example.com/b"}]`},
+	}
+
+	for _, tst := range tt {
+		if _, err := webhook.Load(write(tst.content)); err == nil {
+			t.Fatalf("Should reject the webhooks with %s.", tst.name)
+		}
+	}
+}
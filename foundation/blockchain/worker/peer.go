@@ -2,6 +2,7 @@ package worker
 
 import (
 	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 )
 
 // CORE NOTE: The p2p network is managed by this goroutine. There is
@@ -42,10 +43,18 @@ func (w *Worker) runPeersOperation() {
 	w.evHandler("worker: runPeersOperation: started")
 	defer w.evHandler("worker: runPeersOperation: completed")
 
-	for _, peer := range w.state.KnownExternalPeers() {
+	peers := w.state.KnownExternalPeers()
+
+	ctx, span := w.state.Tracer().Start(w.ctx, "worker.peers", tracing.Int("peers", len(peers)))
+	defer span.End()
+
+	for _, peer := range peers {
+		if ctx.Err() != nil {
+			return
+		}
 
 		// Retrieve the status of this peer.
-		peerStatus, err := w.state.NetRequestPeerStatus(peer)
+		peerStatus, err := w.state.NetRequestPeerStatus(ctx, peer)
 		if err != nil {
 			w.evHandler("worker: runPeersOperation: requestPeerStatus: %s: ERROR: %s", peer.Host, err)
 
@@ -60,7 +69,10 @@ func (w *Worker) runPeersOperation() {
 	}
 
 	// Share with peers this node is available to participate in the network.
-	w.state.NetSendNodeAvailableToPeers()
+	w.state.NetSendNodeAvailableToPeers(ctx)
+
+	// Share the checkpoints that are new to this node.
+	w.state.NetSendCheckpointsToPeers(ctx)
 }
 
 // addNewPeers takes the list of known peers and makes sure they are included
@@ -71,8 +83,9 @@ func (w *Worker) addNewPeers(knownPeers []peer.Peer) error {
 
 	for _, peer := range knownPeers {
 
-		// Don't add this running node to the known peer list.
-		if peer.Match(w.state.Host()) {
+		// Don't add this running node to the known peer list, even when a
+		// peer knows it by another address.
+		if peer.Match(w.state.Host()) || (peer.ID != "" && peer.ID == w.state.NodeID()) {
 			continue
 		}
 
@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 )
 
 // CORE NOTE: The POA mining operation is managed by this function which runs on
@@ -68,9 +69,10 @@ func (w *Worker) runPoaOperation() {
 		return
 	}
 
-	// Make sure there are transactions in the mempool.
+	// Make sure there are transactions in the mempool unless an empty
+	// block is due.
 	length := w.state.MempoolLength()
-	if length == 0 {
+	if length == 0 && !w.state.EmptyBlockDue() {
 		w.evHandler("worker: runMiningOperation: MINING: no transactions to mine: Txs[%d]", length)
 		return
 	}
@@ -82,8 +84,12 @@ func (w *Worker) runPoaOperation() {
 	default:
 	}
 
+	// Trace the mining operation through to proposing the block to peers.
+	traceCtx, span := w.state.Tracer().Start(w.ctx, "worker.mine", tracing.String("consensus", w.state.Consensus()))
+	defer span.End()
+
 	// Create a context so mining can be cancelled.
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(traceCtx)
 	defer cancel()
 
 	// Can't return from this function until these G's are complete.
@@ -121,6 +127,8 @@ func (w *Worker) runPoaOperation() {
 			switch {
 			case errors.Is(err, state.ErrNoTransactions):
 				w.evHandler("worker: runMiningOperation: MINING: WARNING: no transactions in mempool")
+			case errors.Is(err, state.ErrMiningTimeout):
+				w.evHandler("worker: runMiningOperation: MINING: TIMEOUT: %s", err)
 			case ctx.Err() != nil:
 				w.evHandler("worker: runMiningOperation: MINING: CANCEL: complete")
 			default:
@@ -131,7 +139,7 @@ func (w *Worker) runPoaOperation() {
 
 		// The block is mined. Propose the new block to the network.
 		// Log the error, but that's it.
-		if err := w.state.NetSendBlockToPeers(block); err != nil {
+		if err := w.proposeBlock(traceCtx, block); err != nil {
 			w.evHandler("worker: runMiningOperation: MINING: proposeBlockToPeers: WARNING %s", err)
 		}
 	}()
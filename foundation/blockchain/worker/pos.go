@@ -0,0 +1,96 @@
+package worker
+
+import (
+	"errors"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+)
+
+// CORE NOTE: The POS operation runs on the same 12 second cycle as POA. At the
+// beginning of each cycle the proposer for the next block is selected from the
+// bonded validators weighted by their stake. If this node's beneficiary is
+// selected, it creates and signs the next block. There is no work to cancel
+// since a signed block is created straight away.
+
+// posOperations handles proposing blocks.
+func (w *Worker) posOperations() {
+	w.evHandler("worker: posOperations: G started")
+	defer w.evHandler("worker: posOperations: G completed")
+
+	ticker := time.NewTicker(cycleDuration)
+
+	// Start this on a secondsPerCycle mark: ex. MM.00, MM.12, MM.24, MM.36.
+	resetTicker(ticker, secondsPerCycle*time.Second)
+
+	for {
+		select {
+		case <-ticker.C:
+			if !w.isShutdown() {
+				w.runPosOperation()
+			}
+		case <-w.shut:
+			w.evHandler("worker: posOperations: received shut signal")
+			return
+		}
+
+		// Reset the ticker for the next cycle.
+		resetTicker(ticker, 0)
+	}
+}
+
+// runPosOperation proposes a new block with the transactions from the
+// mempool when this node is the selected validator.
+func (w *Worker) runPosOperation() {
+	w.evHandler("worker: runPosOperation: started")
+	defer w.evHandler("worker: runPosOperation: completed")
+
+	// Run the selection algorithm.
+	proposer, err := w.state.NextProposer()
+	if err != nil {
+		w.evHandler("worker: runPosOperation: SELECTION: ERROR: %s", err)
+		return
+	}
+	w.evHandler("worker: runPosOperation: SELECTED: %s", proposer)
+
+	// If we are not selected, return and wait for the new block.
+	if proposer != w.state.BeneficiaryID() {
+		return
+	}
+
+	// Validate we are allowed to propose and we are not in a resync.
+	if !w.state.IsMiningAllowed() {
+		w.evHandler("worker: runPosOperation: PROPOSING: turned off")
+		return
+	}
+
+	// Make sure there are transactions in the mempool unless an empty
+	// block is due.
+	length := w.state.MempoolLength()
+	if length == 0 && !w.state.EmptyBlockDue() {
+		w.evHandler("worker: runPosOperation: PROPOSING: no transactions to propose: Txs[%d]", length)
+		return
+	}
+
+	// Trace the proposing operation through to sending the block to peers.
+	ctx, span := w.state.Tracer().Start(w.ctx, "worker.mine", tracing.String("consensus", w.state.Consensus()))
+	defer span.End()
+
+	block, err := w.state.MineNewBlock(ctx)
+	if err != nil {
+		switch {
+		case errors.Is(err, state.ErrNoTransactions):
+			w.evHandler("worker: runPosOperation: PROPOSING: WARNING: no transactions in mempool")
+		default:
+			w.evHandler("worker: runPosOperation: PROPOSING: ERROR: %s", err)
+		}
+		return
+	}
+
+	// The block is signed. Propose the new block to the network.
+	// Log the error, but that's it.
+	if err := w.proposeBlock(ctx, block); err != nil {
+		w.evHandler("worker: runPosOperation: PROPOSING: proposeBlockToPeers: WARNING %s", err)
+	}
+}
@@ -7,25 +7,80 @@ import (
 	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/state"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
 )
 
 // CORE NOTE: The POW mining operation is managed by this function which runs on
 // it's own goroutine. When a startMining signal is received (mainly because a
 // wallet transaction was received) a block is created and then the POW operation
 // starts. This operation can be cancelled if a proposed block is received and
-// is validated.
+// is validated. When the node is configured to wait for more transactions, a
+// timer is started for the first signal that isn't mined and a partial block
+// is mined when it fires. When the node is configured to keep blocks coming,
+// an empty block is mined once no block has been added for the interval.
+
+// emptyBlockChecks is the number of times per empty block interval the worker
+// checks if an empty block is due.
+const emptyBlockChecks = 4
 
 // powOperations handles mining.
 func (w *Worker) powOperations() {
 	w.evHandler("worker: powOperations: G started")
 	defer w.evHandler("worker: powOperations: G completed")
 
+	// The timer for the transactions waiting on the mining triggers. A nil
+	// channel blocks forever while no timer is running.
+	var timer *time.Timer
+	var maxWait <-chan time.Time
+	stopTimer := func() {
+		if timer != nil {
+			timer.Stop()
+			timer, maxWait = nil, nil
+		}
+	}
+	defer stopTimer()
+
+	// The ticker checking if an empty block is due. A nil channel blocks
+	// forever when empty blocks are turned off.
+	var emptyTick <-chan time.Time
+	if interval := w.state.EmptyBlockInterval(); interval > 0 {
+		ticker := time.NewTicker(interval / emptyBlockChecks)
+		defer ticker.Stop()
+		emptyTick = ticker.C
+	}
+
 	for {
 		select {
 		case <-w.startMining:
+			if w.isShutdown() {
+				continue
+			}
+
+			if !w.state.ReadyToMine() {
+				if wait := w.state.MiningMaxWait(); wait > 0 && timer == nil {
+					w.evHandler("worker: powOperations: MINING: waiting up to %v for more transactions", wait)
+					timer = time.NewTimer(wait)
+					maxWait = timer.C
+				}
+				continue
+			}
+
+			stopTimer()
+			w.runPowOperation()
+
+		case <-maxWait:
+			timer, maxWait = nil, nil
 			if !w.isShutdown() {
+				w.evHandler("worker: powOperations: MINING: max wait reached, mining a partial block")
 				w.runPowOperation()
 			}
+
+		case <-emptyTick:
+			if !w.isShutdown() && w.state.EmptyBlockDue() {
+				w.evHandler("worker: powOperations: MINING: empty block due")
+				w.runPowOperation()
+			}
+
 		case <-w.shut:
 			w.evHandler("worker: powOperations: received shut signal")
 			return
@@ -45,9 +100,10 @@ func (w *Worker) runPowOperation() {
 		return
 	}
 
-	// Make sure there are transactions in the mempool.
+	// Make sure there are transactions in the mempool unless an empty
+	// block is due.
 	length := w.state.MempoolLength()
-	if length == 0 {
+	if length == 0 && !w.state.EmptyBlockDue() {
 		w.evHandler("worker: runMiningOperation: MINING: no transactions to mine: Txs[%d]", length)
 		return
 	}
@@ -69,8 +125,12 @@ func (w *Worker) runPowOperation() {
 	default:
 	}
 
+	// Trace the mining operation through to proposing the block to peers.
+	traceCtx, span := w.state.Tracer().Start(w.ctx, "worker.mine", tracing.String("consensus", w.state.Consensus()))
+	defer span.End()
+
 	// Create a context so mining can be cancelled.
-	ctx, cancel := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(traceCtx)
 	defer cancel()
 
 	// Can't return from this function until these G's are complete.
@@ -108,6 +168,8 @@ func (w *Worker) runPowOperation() {
 			switch {
 			case errors.Is(err, state.ErrNoTransactions):
 				w.evHandler("worker: runMiningOperation: MINING: WARNING: no transactions in mempool")
+			case errors.Is(err, state.ErrMiningTimeout):
+				w.evHandler("worker: runMiningOperation: MINING: TIMEOUT: %s", err)
 			case ctx.Err() != nil:
 				w.evHandler("worker: runMiningOperation: MINING: CANCEL: complete")
 			default:
@@ -118,7 +180,7 @@ func (w *Worker) runPowOperation() {
 
 		// WOW, we mined a block. Propose the new block to the network.
 		// Log the error, but that's it.
-		if err := w.state.NetSendBlockToPeers(block); err != nil {
+		if err := w.proposeBlock(traceCtx, block); err != nil {
 			w.evHandler("worker: runMiningOperation: MINING: proposeBlockToPeers: WARNING %s", err)
 		}
 	}()
@@ -0,0 +1,133 @@
+package worker
+
+import (
+	"sync"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+)
+
+// ShareStats represents the activity of the queue of transactions waiting to
+// be shared with the peers.
+type ShareStats struct {
+	Pending   int    `json:"pending"`   // Transactions waiting to be shared.
+	Queued    uint64 `json:"queued"`    // Transactions added to the queue.
+	Coalesced uint64 `json:"coalesced"` // Transactions already waiting when they were queued again.
+	Batches   uint64 `json:"batches"`   // Times the waiting transactions were taken to be shared.
+	Dropped   uint64 `json:"dropped"`   // Transactions that couldn't be queued because the queue stayed full.
+}
+
+// ShareQueue holds the transactions waiting to be shared with the peers. The
+// transactions queued while a batch is being shared are merged into the next
+// batch, and a transaction that is already waiting isn't queued twice. When
+// the queue is full, the submitter waits for the queue to be drained before
+// the transaction is dropped.
+type ShareQueue struct {
+	capacity int
+	ready    chan struct{}
+
+	mu      sync.Mutex
+	txs     []database.BlockTx
+	hashes  map[string]struct{}
+	drained chan struct{} // Closed and replaced each time the queue is taken.
+	stats   ShareStats
+}
+
+// NewShareQueue constructs a queue that holds up to capacity transactions.
+func NewShareQueue(capacity int) *ShareQueue {
+	return &ShareQueue{
+		capacity: capacity,
+		ready:    make(chan struct{}, 1),
+		hashes:   make(map[string]struct{}),
+		drained:  make(chan struct{}),
+	}
+}
+
+// Push adds the transaction to the queue. If the queue is full, Push waits up
+// to the specified time for room or until shut is closed. False is returned
+// if the transaction was dropped.
+func (q *ShareQueue) Push(tx database.BlockTx, wait time.Duration, shut <-chan struct{}) bool {
+	hash := tx.TxHash()
+
+	var timer *time.Timer
+	for {
+		q.mu.Lock()
+
+		if _, exists := q.hashes[hash]; exists {
+			q.stats.Coalesced++
+			q.mu.Unlock()
+			return true
+		}
+
+		if len(q.txs) < q.capacity {
+			q.txs = append(q.txs, tx)
+			q.hashes[hash] = struct{}{}
+			q.stats.Queued++
+			q.mu.Unlock()
+
+			select {
+			case q.ready <- struct{}{}:
+			default:
+			}
+			return true
+		}
+
+		drained := q.drained
+		q.mu.Unlock()
+
+		if timer == nil {
+			timer = time.NewTimer(wait)
+			defer timer.Stop()
+		}
+
+		select {
+		case <-drained:
+			continue
+		case <-timer.C:
+		case <-shut:
+		}
+
+		q.mu.Lock()
+		q.stats.Dropped++
+		q.mu.Unlock()
+
+		return false
+	}
+}
+
+// Ready returns a channel that receives a value when transactions are queued.
+func (q *ShareQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Take removes and returns the transactions waiting to be shared in the order
+// they were queued.
+func (q *ShareQueue) Take() []database.BlockTx {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	txs := q.txs
+	if len(txs) == 0 {
+		return nil
+	}
+
+	q.txs = nil
+	q.hashes = make(map[string]struct{})
+	q.stats.Batches++
+
+	close(q.drained)
+	q.drained = make(chan struct{})
+
+	return txs
+}
+
+// Stats returns the activity of the queue.
+func (q *ShareQueue) Stats() ShareStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := q.stats
+	stats.Pending = len(q.txs)
+
+	return stats
+}
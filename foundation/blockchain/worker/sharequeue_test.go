@@ -0,0 +1,78 @@
+package worker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/worker"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+func Test_ShareQueue(t *testing.T) {
+	pk, err := crypto.HexToECDSA("9f332e3700d8fc2446eaf6d15034cf96e0c2745e40353deef032a5dbf1dfed93")
+	if err != nil {
+		t.Fatalf("Should be able to construct private key: %v", err)
+	}
+
+	txs := make([]database.BlockTx, 3)
+	for i := range txs {
+		tx := database.Tx{ChainID: 1, Nonce: uint64(i + 1), FromID: "0xF01813E4B85e178A83e29B8E7bF26BD830a25f32", ToID: "0xdd6B972ffcc631a62CAE1BB9d80b7ff429c8ebA4", Value: 1}
+
+		signedTx, err := tx.Sign(pk)
+		if err != nil {
+			t.Fatalf("Should be able to sign transaction: %v", err)
+		}
+		txs[i] = database.NewBlockTx(signedTx, 1, 1)
+	}
+
+	shut := make(chan struct{})
+	q := worker.NewShareQueue(2)
+
+	for _, tx := range []database.BlockTx{txs[0], txs[1], txs[0]} {
+		if !q.Push(tx, time.Millisecond, shut) {
+			t.Fatalf("Should be able to queue transaction %s.", tx)
+		}
+	}
+
+	select {
+	case <-q.Ready():
+	default:
+		t.Fatalf("Should signal transactions are ready to be shared.")
+	}
+
+	// The queue is full and nothing drains it, so the transaction is dropped.
+	if q.Push(txs[2], 10*time.Millisecond, shut) {
+		t.Fatalf("Should drop a transaction when the queue stays full.")
+	}
+
+	// A submitter waiting on a full queue gets in once the queue is drained.
+	pushed := make(chan bool)
+	go func() {
+		pushed <- q.Push(txs[2], time.Minute, shut)
+	}()
+
+	batch := q.Take()
+	if len(batch) != 2 || !batch[0].Equals(txs[0]) || !batch[1].Equals(txs[1]) {
+		t.Logf("got: %v", batch)
+		t.Fatalf("Should take the queued transactions once and in order.")
+	}
+
+	if !<-pushed {
+		t.Fatalf("Should queue the transaction once the queue is drained.")
+	}
+
+	exp := worker.ShareStats{Pending: 1, Queued: 3, Coalesced: 1, Batches: 1, Dropped: 1}
+	if stats := q.Stats(); stats != exp {
+		t.Logf("got: %+v", stats)
+		t.Logf("exp: %+v", exp)
+		t.Fatalf("Should report the activity of the queue.")
+	}
+
+	// A submitter waiting on a full queue is released on shutdown.
+	q.Push(txs[0], time.Millisecond, shut)
+	close(shut)
+	if q.Push(txs[1], time.Minute, shut) {
+		t.Fatalf("Should drop the transaction on shutdown.")
+	}
+}
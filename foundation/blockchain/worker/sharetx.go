@@ -1,18 +1,27 @@
 package worker
 
+import (
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+)
+
 // CORE NOTE: Sharing new transactions received directly by a wallet is
 // performed by this goroutine. When a wallet transaction is received,
-// the request goroutine shares it with this goroutine to send it over the
-// p2p network. Up to 100 transactions can be pending to be sent before new
-// transactions are dropped and not sent.
-
-// maxTxShareRequests represents the max number of pending tx network share
-// requests that can be outstanding before share requests are dropped. To keep
-// this simple, a buffered channel of this arbitrary number is being used. If
-// the channel does become full, requests for new transactions to be shared
-// will not be accepted.
+// the request goroutine queues it for this goroutine to send over the
+// p2p network. The transactions queued while a batch is being sent are
+// sent together in the next batch. Up to 100 transactions can be pending
+// before the request is held waiting for room, and the transaction is
+// dropped if no room is made in time.
+
+// maxTxShareRequests represents the max number of transactions that can be
+// waiting to be shared with the peers.
 const maxTxShareRequests = 100
 
+// shareTxWait represents how long a request waits for room in a full queue
+// before the transaction is dropped and not shared.
+const shareTxWait = 250 * time.Millisecond
+
 // =============================================================================
 
 // shareTxOperations handles sharing new block transactions.
@@ -22,10 +31,26 @@ func (w *Worker) shareTxOperations() {
 
 	for {
 		select {
-		case tx := <-w.txSharing:
-			if !w.isShutdown() {
-				w.state.NetSendTxToPeers(tx)
+		case <-w.txShare.Ready():
+			if w.isShutdown() {
+				continue
+			}
+
+			txs := w.txShare.Take()
+			w.evHandler("worker: shareTxOperations: sharing batch: txs[%d]", len(txs))
+
+			ctx, span := w.state.Tracer().Start(w.ctx, "tx.share", tracing.Int("txs", len(txs)))
+
+			for _, tx := range txs {
+				w.state.NetSendTxToPeers(ctx, tx)
+
+				if w.state.Faults().DuplicateTx() {
+					w.evHandler("worker: shareTxOperations: CHAOS: duplicate tx[%s]", tx)
+					w.state.NetSendTxToPeers(ctx, tx)
+				}
 			}
+
+			span.End()
 		case <-w.shut:
 			w.evHandler("worker: shareTxOperations: received shut signal")
 			return
@@ -0,0 +1,39 @@
+package worker
+
+import (
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+)
+
+// CORE NOTE: Votes are signed while the state lock is held for the block
+// being applied, so they are queued for this goroutine to send over the p2p
+// network without holding up the block. A vote only matters until the next
+// block is proposed, so a vote that doesn't fit in the queue is dropped.
+
+// maxVoteShareRequests represents the max number of votes that can be waiting
+// to be shared with the peers.
+const maxVoteShareRequests = 100
+
+// =============================================================================
+
+// shareVoteOperations handles sharing votes for blocks.
+func (w *Worker) shareVoteOperations() {
+	w.evHandler("worker: shareVoteOperations: G started")
+	defer w.evHandler("worker: shareVoteOperations: G completed")
+
+	for {
+		select {
+		case vote := <-w.voteShare:
+			if w.isShutdown() {
+				continue
+			}
+
+			ctx, span := w.state.Tracer().Start(w.ctx, "vote.share", tracing.Uint64("block", vote.Number))
+			w.state.NetSendVoteToPeers(ctx, vote)
+			span.End()
+
+		case <-w.shut:
+			w.evHandler("worker: shareVoteOperations: received shut signal")
+			return
+		}
+	}
+}
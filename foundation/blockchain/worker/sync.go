@@ -1,5 +1,10 @@
 package worker
 
+import (
+	"github.com/ardanlabs/blockchain/foundation/blockchain/peer"
+	"github.com/ardanlabs/blockchain/foundation/blockchain/tracing"
+)
+
 // CORE NOTE: On startup or when reorganizing the chain, the node needs to be
 // in sync with the rest of the network. This includes the mempool and
 // blockchain database. This operation needs to finish before the node can
@@ -10,37 +15,85 @@ func (w *Worker) Sync() {
 	w.evHandler("worker: sync: started")
 	defer w.evHandler("worker: sync: completed")
 
-	for _, peer := range w.state.KnownExternalPeers() {
+	// Only one sync runs at a time. Wait for any sync that is running.
+	end := w.state.BeginSync()
+	defer end()
+
+	peers := w.state.KnownExternalPeers()
+
+	ctx, span := w.state.Tracer().Start(w.ctx, "worker.sync",
+		tracing.Int("peers", len(peers)),
+		tracing.Uint64("start_block", w.state.LatestBlock().Header.Number),
+	)
+	defer func() {
+		span.SetAttributes(tracing.Uint64("end_block", w.state.LatestBlock().Header.Number))
+		span.End()
+	}()
+
+	statuses := make(map[string]peer.PeerStatus)
+	for _, peer := range peers {
+		if ctx.Err() != nil {
+			w.evHandler("worker: sync: shutdown: %s", ctx.Err())
+			return
+		}
 
 		// Retrieve the status of this peer.
-		peerStatus, err := w.state.NetRequestPeerStatus(peer)
+		peerStatus, err := w.state.NetRequestPeerStatus(ctx, peer)
 		if err != nil {
 			w.evHandler("worker: sync: queryPeerStatus: %s: ERROR: %s", peer.Host, err)
+			w.state.SyncError(peer.Host, err)
+			continue
 		}
+		statuses[peer.Host] = peerStatus
 
 		// Add new peers to this nodes list.
 		w.addNewPeers(peerStatus.KnownPeers)
 
+		// Pick up the checkpoints before any block is downloaded so a
+		// chain contradicting them isn't followed.
+		if err := w.state.NetRequestPeerCheckpoints(ctx, peer); err != nil {
+			w.evHandler("worker: sync: retrievePeerCheckpoints: %s: ERROR: %s", peer.Host, err)
+		}
+
 		// Retrieve the mempool from the peer.
-		pool, err := w.state.NetRequestPeerMempool(peer)
+		pool, err := w.state.NetRequestPeerMempool(ctx, peer)
 		if err != nil {
 			w.evHandler("worker: sync: retrievePeerMempool: %s: ERROR: %s", peer.Host, err)
 		}
 		for _, tx := range pool {
 			w.evHandler("worker: sync: retrievePeerMempool: %s: Add Tx: %s", peer.Host, tx.SignatureString()[:16])
-			w.state.UpsertMempool(tx)
+			if err := w.state.UpsertMempool(tx); err != nil {
+				w.evHandler("worker: sync: retrievePeerMempool: %s: WARNING: %s", peer.Host, err)
+			}
+		}
+	}
+
+	// Download the blocks from the nearest peers that are up to date first.
+	// Once the node caught up, the peers that are further behind have
+	// nothing more to give.
+	for _, peer := range w.state.SyncOrder(peers) {
+		if ctx.Err() != nil {
+			w.evHandler("worker: sync: shutdown: %s", ctx.Err())
+			return
+		}
+
+		peerStatus, exists := statuses[peer.Host]
+		if !exists {
+			continue
 		}
 
 		// If this peer has blocks we don't have, we need to add them.
 		if peerStatus.LatestBlockNumber > w.state.LatestBlock().Header.Number {
+			w.state.SyncTarget(peer.Host, peerStatus.LatestBlockNumber)
 			w.evHandler("worker: sync: retrievePeerBlocks: %s: latestBlockNumber[%d]", peer.Host, peerStatus.LatestBlockNumber)
 
-			if err := w.state.NetRequestPeerBlocks(peer); err != nil {
+			if err := w.state.NetRequestPeerBlocks(ctx, peer); err != nil {
 				w.evHandler("worker: sync: retrievePeerBlocks: %s: ERROR %s", peer.Host, err)
+				w.state.SyncError(peer.Host, err)
 			}
 		}
 	}
 
 	// Share with peers this node is available to participate in the network.
-	w.state.NetSendNodeAvailableToPeers()
+	w.state.NetSendNodeAvailableToPeers(ctx)
 }
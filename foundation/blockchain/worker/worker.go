@@ -3,7 +3,10 @@
 package worker
 
 import (
+	"context"
+	"errors"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ardanlabs/blockchain/foundation/blockchain/database"
@@ -19,25 +22,35 @@ const peerUpdateInterval = time.Second * 10
 // Worker manages the POW workflows for the blockchain.
 type Worker struct {
 	state        *state.State
+	ctx          context.Context // Cancelled on shutdown to stop requests in flight.
+	cancel       context.CancelFunc
 	wg           sync.WaitGroup
+	running      int32 // Number of operational G's running.
+	operations   int   // Number of operational G's started.
 	ticker       time.Ticker
 	shut         chan struct{}
 	startMining  chan bool
 	cancelMining chan bool
-	txSharing    chan database.BlockTx
+	txShare      *ShareQueue
+	voteShare    chan database.Vote
 	evHandler    state.EventHandler
 }
 
 // Run creates a worker, registers the worker with the state package, and
 // starts up all the background processes.
-func Run(st *state.State, evHandler state.EventHandler) {
+func Run(st *state.State, evHandler state.EventHandler) *Worker {
+	ctx, cancel := context.WithCancel(context.Background())
+
 	w := Worker{
 		state:        st,
+		ctx:          ctx,
+		cancel:       cancel,
 		ticker:       *time.NewTicker(peerUpdateInterval),
 		shut:         make(chan struct{}),
 		startMining:  make(chan bool, 1),
 		cancelMining: make(chan bool, 1),
-		txSharing:    make(chan database.BlockTx, maxTxShareRequests),
+		txShare:      NewShareQueue(maxTxShareRequests),
+		voteShare:    make(chan database.Vote, maxVoteShareRequests),
 		evHandler:    evHandler,
 	}
 
@@ -49,8 +62,11 @@ func Run(st *state.State, evHandler state.EventHandler) {
 
 	// Select the consensus operation to run.
 	consensusOperation := w.powOperations
-	if st.Consensus() == state.ConsensusPOA {
+	switch st.Consensus() {
+	case state.ConsensusPOA:
 		consensusOperation = w.poaOperations
+	case state.ConsensusPOS:
+		consensusOperation = w.posOperations
 	}
 
 	// Load the set of operations we need to run.
@@ -60,10 +76,16 @@ func Run(st *state.State, evHandler state.EventHandler) {
 		consensusOperation,
 	}
 
+	// Only PoS validators vote for blocks.
+	if st.Consensus() == state.ConsensusPOS {
+		operations = append(operations, w.shareVoteOperations)
+	}
+
 	// Set waitgroup to match the number of G's we need for the set
 	// of operations we have.
 	g := len(operations)
 	w.wg.Add(g)
+	w.operations = g
 
 	// We don't want to return until we know all the G's are up and running.
 	hasStarted := make(chan bool)
@@ -72,6 +94,8 @@ func Run(st *state.State, evHandler state.EventHandler) {
 	for _, op := range operations {
 		go func(op func()) {
 			defer w.wg.Done()
+			atomic.AddInt32(&w.running, 1)
+			defer atomic.AddInt32(&w.running, -1)
 			hasStarted <- true
 			op()
 		}(op)
@@ -81,6 +105,15 @@ func Run(st *state.State, evHandler state.EventHandler) {
 	for i := 0; i < g; i++ {
 		<-hasStarted
 	}
+
+	return &w
+}
+
+// Running returns the number of operational G's still running and the number
+// that were started. A G that stops before shutdown means the node can no
+// longer do its work.
+func (w *Worker) Running() (running int, started int) {
+	return int(atomic.LoadInt32(&w.running)), w.operations
 }
 
 // =============================================================================
@@ -97,6 +130,9 @@ func (w *Worker) Shutdown() {
 	w.evHandler("worker: shutdown: signal cancel mining")
 	w.SignalCancelMining()
 
+	w.evHandler("worker: shutdown: cancel requests to peers")
+	w.cancel()
+
 	w.evHandler("worker: shutdown: terminate goroutines")
 	close(w.shut)
 	w.wg.Wait()
@@ -138,17 +174,41 @@ func (w *Worker) SignalCancelMining() {
 	w.evHandler("worker: SignalCancelMining: MINING: CANCEL: signaled")
 }
 
-// SignalShareTx signals a share transaction operation. If
-// maxTxShareRequests signals exist in the channel, we won't send these.
+// SignalShareTx queues the transaction to be shared with the peers. If the
+// queue is full, the caller is held until there is room or the transaction
+// is dropped.
 func (w *Worker) SignalShareTx(blockTx database.BlockTx) {
+	if !w.txShare.Push(blockTx, shareTxWait, w.shut) {
+		w.evHandler("worker: SignalShareTx: WARNING: queue full, tx[%s] dropped", blockTx)
+		return
+	}
+	w.evHandler("worker: SignalShareTx: share Tx signaled")
+}
+
+// SignalShareVote queues the vote to be shared with the peers. The vote is
+// dropped if the queue is full since the caller can't be held.
+func (w *Worker) SignalShareVote(vote database.Vote) {
 	select {
-	case w.txSharing <- blockTx:
-		w.evHandler("worker: SignalShareTx: share Tx signaled")
+	case w.voteShare <- vote:
+		w.evHandler("worker: SignalShareVote: share vote signaled")
 	default:
-		w.evHandler("worker: SignalShareTx: queue full, transactions won't be shared.")
+		w.evHandler("worker: SignalShareVote: WARNING: queue full, vote blk[%d] voter[%s] dropped", vote.Number, vote.VoterID)
 	}
 }
 
+// SetPeerInterval changes how often the worker looks for new peers and
+// missing blocks. The next update happens one interval from now.
+func (w *Worker) SetPeerInterval(d time.Duration) {
+	w.ticker.Reset(d)
+	w.evHandler("worker: SetPeerInterval: interval[%v]", d)
+}
+
+// ShareStats returns the activity of the queue of transactions waiting to be
+// shared with the peers.
+func (w *Worker) ShareStats() ShareStats {
+	return w.txShare.Stats()
+}
+
 // =============================================================================
 
 // isShutdown is used to test if a shutdown has been signaled.
@@ -160,3 +220,26 @@ func (w *Worker) isShutdown() bool {
 		return false
 	}
 }
+
+// proposeBlock sends the new block to the known peers. The block is held
+// first when the injected faults delay block propagation. The context
+// carries the trace of the mining operation and is not cancelled when
+// mining is. The time spent sending the block is reported with the time
+// spent mining it.
+func (w *Worker) proposeBlock(ctx context.Context, block database.Block) error {
+	if delay := w.state.Faults().BlockDelay(); delay > 0 {
+		w.evHandler("worker: proposeBlock: CHAOS: delay block[%d] by %v", block.Header.Number, delay)
+
+		select {
+		case <-time.After(delay):
+		case <-w.ctx.Done():
+			return errors.New("shutdown before the block was proposed")
+		}
+	}
+
+	start := time.Now()
+	err := w.state.NetSendBlockToPeers(ctx, block)
+	w.state.BlockProposed(block, time.Since(start))
+
+	return err
+}
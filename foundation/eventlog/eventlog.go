@@ -0,0 +1,244 @@
+// Package eventlog records the events of a node as JSON lines in files that
+// are rotated by size and age, and keeps the latest events in memory so they
+// can be queried.
+package eventlog
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Set of default values used when the config doesn't provide them.
+const (
+	defaultMaxSize  = 10 << 20
+	defaultMaxFiles = 5
+	defaultBuffer   = 1000
+)
+
+// viewerPrefix marks the structured events sent as "viewer: <kind>: <json>".
+const viewerPrefix = "viewer: "
+
+// Config represents the configuration of the event log.
+type Config struct {
+	Path     string        // File the events are written to, empty only keeps them in memory.
+	MaxSize  int64         // Size in bytes a file grows to before it's rotated, defaults to 10MB.
+	MaxAge   time.Duration // Age of a file before it's rotated, 0 doesn't rotate on age.
+	MaxFiles int           // Number of rotated files kept, defaults to 5.
+	Buffer   int           // Number of latest events kept in memory, defaults to 1000.
+}
+
+// Event represents a single recorded event. Structured events have their
+// kind and data, any other message is kept as is with the name of the
+// package that sent it as the kind.
+type Event struct {
+	Seq     uint64          `json:"seq"`
+	Time    time.Time       `json:"time"`
+	Kind    string          `json:"kind,omitempty"`
+	Data    json.RawMessage `json:"data,omitempty"`
+	Message string          `json:"message,omitempty"`
+}
+
+// Query represents the filter for the events kept in memory.
+type Query struct {
+	Since uint64 // Only events with a greater sequence number.
+	Kind  string // Only events of this kind, empty for all.
+	Limit int    // Maximum number of events returned, the latest ones are kept.
+}
+
+// Log records events to files and keeps the latest in memory.
+type Log struct {
+	cfg Config
+
+	mu      sync.Mutex
+	seq     uint64
+	ring    []Event
+	next    int // Position in the ring the next event is written to.
+	file    *os.File
+	size    int64
+	created time.Time
+}
+
+// New constructs an event log. If a path is configured, the file is opened
+// for appending and any existing content counts towards its size.
+func New(cfg Config) (*Log, error) {
+	if cfg.MaxSize <= 0 {
+		cfg.MaxSize = defaultMaxSize
+	}
+	if cfg.MaxFiles <= 0 {
+		cfg.MaxFiles = defaultMaxFiles
+	}
+	if cfg.Buffer <= 0 {
+		cfg.Buffer = defaultBuffer
+	}
+
+	l := Log{
+		cfg:  cfg,
+		ring: make([]Event, 0, cfg.Buffer),
+	}
+
+	if cfg.Path != "" {
+		if err := l.open(); err != nil {
+			return nil, err
+		}
+	}
+
+	return &l, nil
+}
+
+// Record adds the message sent to the event handler to the log. An error
+// writing the file is returned, the event is still kept in memory.
+func (l *Log) Record(msg string) error {
+	ev := parse(msg)
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.seq++
+	ev.Seq = l.seq
+	ev.Time = time.Now().UTC()
+
+	if len(l.ring) < cap(l.ring) {
+		l.ring = append(l.ring, ev)
+	} else {
+		l.ring[l.next] = ev
+	}
+	l.next = (l.next + 1) % cap(l.ring)
+
+	if l.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+
+	if l.size+int64(len(data)) > l.cfg.MaxSize || (l.cfg.MaxAge > 0 && time.Since(l.created) >= l.cfg.MaxAge) {
+		if err := l.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := l.file.Write(data)
+	l.size += int64(n)
+
+	return err
+}
+
+// Query returns the events kept in memory that match the query, oldest first.
+func (l *Log) Query(q Query) []Event {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	// The oldest event is where the next one will be written once the ring
+	// is full.
+	start := 0
+	if len(l.ring) == cap(l.ring) {
+		start = l.next
+	}
+
+	var events []Event
+	for i := 0; i < len(l.ring); i++ {
+		ev := l.ring[(start+i)%len(l.ring)]
+
+		if ev.Seq <= q.Since || (q.Kind != "" && ev.Kind != q.Kind) {
+			continue
+		}
+
+		events = append(events, ev)
+	}
+
+	if q.Limit > 0 && len(events) > q.Limit {
+		events = events[len(events)-q.Limit:]
+	}
+
+	return events
+}
+
+// Close closes the file the events are written to.
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+
+	err := l.file.Close()
+	l.file = nil
+
+	return err
+}
+
+// =============================================================================
+
+// open opens the file for appending.
+func (l *Log) open() error {
+	f, err := os.OpenFile(l.cfg.Path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	l.file = f
+	l.size = info.Size()
+	l.created = time.Now()
+
+	return nil
+}
+
+// rotate moves the current file to <path>.1, shifting older files up by one
+// and removing the oldest, then opens a new file.
+func (l *Log) rotate() error {
+	if err := l.file.Close(); err != nil {
+		return err
+	}
+	l.file = nil
+
+	os.Remove(rotated(l.cfg.Path, l.cfg.MaxFiles))
+	for i := l.cfg.MaxFiles - 1; i >= 1; i-- {
+		if err := os.Rename(rotated(l.cfg.Path, i), rotated(l.cfg.Path, i+1)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	if err := os.Rename(l.cfg.Path, rotated(l.cfg.Path, 1)); err != nil {
+		return err
+	}
+
+	return l.open()
+}
+
+// rotated returns the path of the rotated file with the specified number.
+func rotated(path string, n int) string {
+	return fmt.Sprintf("%s.%d", path, n)
+}
+
+// parse converts the message into an event. A structured event is sent as
+// "viewer: <kind>: <json>", any other message starts with the name of the
+// package that sent it.
+func parse(msg string) Event {
+	if strings.HasPrefix(msg, viewerPrefix) {
+		rest := strings.TrimPrefix(msg, viewerPrefix)
+		if kind, data, found := strings.Cut(rest, ": "); found && json.Valid([]byte(data)) {
+			return Event{Kind: kind, Data: json.RawMessage(data)}
+		}
+	}
+
+	kind, _, found := strings.Cut(msg, ":")
+	if !found || strings.Contains(kind, " ") {
+		kind = ""
+	}
+
+	return Event{Kind: kind, Message: msg}
+}
@@ -0,0 +1,96 @@
+package eventlog_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ardanlabs/blockchain/foundation/eventlog"
+)
+
+func Test_Query(t *testing.T) {
+	l, err := eventlog.New(eventlog.Config{Buffer: 3})
+	if err != nil {
+		t.Fatalf("Should be able to construct the event log: %v", err)
+	}
+
+	l.Record(`viewer: block: {"number":1}`)
+	l.Record("state: MineNewBlock: started")
+	l.Record(`viewer: block: {"number":2}`)
+	l.Record(`viewer: peer: {"action":"add"}`)
+
+	events := l.Query(eventlog.Query{})
+	if len(events) != 3 || events[0].Seq != 2 || events[2].Seq != 4 {
+		t.Logf("got: %+v", events)
+		t.Fatalf("Should only keep the latest events, oldest first.")
+	}
+
+	if events[0].Kind != "state" || events[0].Message == "" {
+		t.Logf("got: %+v", events[0])
+		t.Fatalf("Should keep a message with the package that sent it as the kind.")
+	}
+
+	events = l.Query(eventlog.Query{Kind: "block"})
+	if len(events) != 1 || string(events[0].Data) != `{"number":2}` {
+		t.Logf("got: %+v", events)
+		t.Fatalf("Should filter the structured events by kind.")
+	}
+
+	if events := l.Query(eventlog.Query{Since: 3}); len(events) != 1 || events[0].Seq != 4 {
+		t.Logf("got: %+v", events)
+		t.Fatalf("Should only return the events after the sequence number.")
+	}
+
+	if events := l.Query(eventlog.Query{Limit: 2}); len(events) != 2 || events[1].Seq != 4 {
+		t.Logf("got: %+v", events)
+		t.Fatalf("Should return the latest events up to the limit.")
+	}
+}
+
+func Test_Rotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.log")
+
+	l, err := eventlog.New(eventlog.Config{Path: path, MaxSize: 200, MaxFiles: 2})
+	if err != nil {
+		t.Fatalf("Should be able to construct the event log: %v", err)
+	}
+	defer l.Close()
+
+	msg := "state: " + strings.Repeat("x", 50)
+	for i := 0; i < 10; i++ {
+		if err := l.Record(msg); err != nil {
+			t.Fatalf("Should be able to record the event: %v", err)
+		}
+	}
+
+	for _, name := range []string{path, path + ".1", path + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Fatalf("Should have the file %s: %v", name, err)
+		}
+		if info.Size() > 200 {
+			t.Fatalf("Should rotate %s before it's larger than the max size, got %d.", name, info.Size())
+		}
+	}
+
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Fatalf("Should only keep the configured number of rotated files.")
+	}
+
+	// Rotating on age moves the file even though it's small.
+	aged, err := eventlog.New(eventlog.Config{Path: path + "-aged", MaxAge: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatalf("Should be able to construct the event log: %v", err)
+	}
+	defer aged.Close()
+
+	aged.Record(msg)
+	time.Sleep(20 * time.Millisecond)
+	aged.Record(msg)
+
+	if _, err := os.Stat(path + "-aged.1"); err != nil {
+		t.Fatalf("Should rotate the file once it's older than the max age: %v", err)
+	}
+}
@@ -0,0 +1,66 @@
+package graphql
+
+import (
+	"fmt"
+	"math"
+)
+
+// Uint returns the named argument as an unsigned integer or the default when
+// the argument isn't provided. Variables decoded from JSON are float64.
+func Uint(args map[string]any, name string, def uint64) (uint64, error) {
+	value, exists := args[name]
+	if !exists || value == nil {
+		return def, nil
+	}
+
+	switch v := value.(type) {
+	case int:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+
+	case int64:
+		if v >= 0 {
+			return uint64(v), nil
+		}
+
+	case float64:
+		if v >= 0 && v == math.Trunc(v) && v <= math.MaxUint64 {
+			return uint64(v), nil
+		}
+	}
+
+	return 0, fmt.Errorf("argument %q must be a non-negative integer", name)
+}
+
+// String returns the named argument as a string or the default when the
+// argument isn't provided.
+func String(args map[string]any, name string, def string) (string, error) {
+	value, exists := args[name]
+	if !exists || value == nil {
+		return def, nil
+	}
+
+	s, ok := value.(string)
+	if !ok {
+		return "", fmt.Errorf("argument %q must be a string", name)
+	}
+
+	return s, nil
+}
+
+// Bool returns the named argument as a boolean or the default when the
+// argument isn't provided.
+func Bool(args map[string]any, name string, def bool) (bool, error) {
+	value, exists := args[name]
+	if !exists || value == nil {
+		return def, nil
+	}
+
+	b, ok := value.(bool)
+	if !ok {
+		return false, fmt.Errorf("argument %q must be a boolean", name)
+	}
+
+	return b, nil
+}
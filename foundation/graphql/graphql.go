@@ -0,0 +1,325 @@
+// Package graphql provides a small GraphQL query engine. It supports query
+// operations with arguments, variables, aliases and nested selections over a
+// schema of object types built in code. Fragments, directives, mutations and
+// introspection are not supported.
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// MaxRequestSize is the largest request body a handler executing queries
+// should read.
+const MaxRequestSize = 1 << 20
+
+// ResolveFunc resolves the value of a field for the source value of the
+// parent object.
+type ResolveFunc func(ctx context.Context, source any, args map[string]any) (any, error)
+
+// Field represents a field of an object type. Type is the name of the object
+// type the resolved value is, or empty for a scalar. A resolved slice is
+// returned as a list.
+type Field struct {
+	Type    string
+	Resolve ResolveFunc
+}
+
+// Object represents an object type and its fields.
+type Object struct {
+	Name   string
+	Fields map[string]Field
+}
+
+// =============================================================================
+
+// Request represents a GraphQL request. Extensions are accepted so clients
+// that send them can be decoded, but they are ignored.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName,omitempty"`
+	Variables     map[string]any `json:"variables,omitempty"`
+	Extensions    map[string]any `json:"extensions,omitempty"`
+}
+
+// Response represents a GraphQL response.
+type Response struct {
+	Data   *Result `json:"data"`
+	Errors []Error `json:"errors,omitempty"`
+}
+
+// Error represents an error that occurred parsing or executing the query.
+type Error struct {
+	Message string `json:"message"`
+	Path    []any  `json:"path,omitempty"`
+}
+
+// Result represents the fields of an object in the order they were selected.
+type Result struct {
+	keys   []string
+	values map[string]any
+}
+
+// set adds the field to the result.
+func (r *Result) set(key string, value any) {
+	if r.values == nil {
+		r.values = make(map[string]any)
+	}
+
+	if _, exists := r.values[key]; !exists {
+		r.keys = append(r.keys, key)
+	}
+	r.values[key] = value
+}
+
+// Get returns the value of the field.
+func (r *Result) Get(key string) any {
+	return r.values[key]
+}
+
+// MarshalJSON implements the json.Marshaler interface and keeps the order of
+// the fields.
+func (r *Result) MarshalJSON() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	for i, key := range r.keys {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+
+		v, err := json.Marshal(r.values[key])
+		if err != nil {
+			return nil, err
+		}
+
+		buf.Write(k)
+		buf.WriteByte(':')
+		buf.Write(v)
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// =============================================================================
+
+// Schema represents the object types that can be queried.
+type Schema struct {
+	query string
+	types map[string]Object
+}
+
+// NewSchema constructs a schema with the query root type and the other object
+// types it references.
+func NewSchema(query Object, types ...Object) (*Schema, error) {
+	s := Schema{
+		query: query.Name,
+		types: map[string]Object{query.Name: query},
+	}
+
+	for _, obj := range types {
+		if _, exists := s.types[obj.Name]; exists {
+			return nil, fmt.Errorf("type %q is defined more than once", obj.Name)
+		}
+		s.types[obj.Name] = obj
+	}
+
+	for _, obj := range s.types {
+		for name, field := range obj.Fields {
+			if field.Resolve == nil {
+				return nil, fmt.Errorf("field %s.%s has no resolver", obj.Name, name)
+			}
+			if _, exists := s.types[field.Type]; field.Type != "" && !exists {
+				return nil, fmt.Errorf("field %s.%s has unknown type %q", obj.Name, name, field.Type)
+			}
+		}
+	}
+
+	return &s, nil
+}
+
+// MustNewSchema constructs a schema and panics if the types are invalid. It's
+// used for schemas defined in code where an error is a programming mistake.
+func MustNewSchema(query Object, types ...Object) *Schema {
+	s, err := NewSchema(query, types...)
+	if err != nil {
+		panic(err)
+	}
+
+	return s
+}
+
+// Execute parses and executes the query. Errors from resolvers are reported
+// with the path of the field, which is returned as null.
+func (s *Schema) Execute(ctx context.Context, req Request) Response {
+	doc, err := parse(req.Query, req.OperationName)
+	if err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	if doc.operation != "query" {
+		return Response{Errors: []Error{{Message: fmt.Sprintf("%s operations are not supported", doc.operation)}}}
+	}
+
+	vars := make(map[string]any)
+	for _, def := range doc.variables {
+		value, exists := req.Variables[def.name]
+		switch {
+		case exists:
+			vars[def.name] = value
+		case def.hasDef:
+			vars[def.name] = def.defValue
+		}
+	}
+
+	ex := executor{
+		schema: s,
+		vars:   vars,
+	}
+
+	root := s.types[s.query]
+	if err := ex.validate(root, doc.selection); err != nil {
+		return Response{Errors: []Error{{Message: err.Error()}}}
+	}
+
+	data := ex.executeObject(ctx, root, nil, doc.selection, nil)
+
+	return Response{Data: data, Errors: ex.errors}
+}
+
+// =============================================================================
+
+// executor executes a single query and collects the errors.
+type executor struct {
+	schema *Schema
+	vars   map[string]any
+	errors []Error
+}
+
+// validate checks the selected fields exist on the types before any resolver
+// is executed.
+func (ex *executor) validate(obj Object, set []selection) error {
+	for _, sel := range set {
+		if sel.name == "__typename" {
+			continue
+		}
+
+		field, exists := obj.Fields[sel.name]
+		if !exists {
+			return fmt.Errorf("cannot query field %q on type %q", sel.name, obj.Name)
+		}
+
+		switch {
+		case field.Type == "" && len(sel.selection) > 0:
+			return fmt.Errorf("field %q of type %q must not have a selection", sel.name, obj.Name)
+
+		case field.Type != "" && len(sel.selection) == 0:
+			return fmt.Errorf("field %q of type %q must have a selection", sel.name, obj.Name)
+
+		case field.Type != "":
+			if err := ex.validate(ex.schema.types[field.Type], sel.selection); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// executeObject resolves the selected fields for the source value.
+func (ex *executor) executeObject(ctx context.Context, obj Object, source any, set []selection, path []any) *Result {
+	var result Result
+
+	for _, sel := range set {
+		fieldPath := append(append([]any{}, path...), sel.alias)
+
+		if sel.name == "__typename" {
+			result.set(sel.alias, obj.Name)
+			continue
+		}
+
+		field := obj.Fields[sel.name]
+
+		value, err := field.Resolve(ctx, source, ex.arguments(sel.args))
+		if err != nil {
+			ex.errors = append(ex.errors, Error{Message: err.Error(), Path: fieldPath})
+			result.set(sel.alias, nil)
+			continue
+		}
+
+		result.set(sel.alias, ex.complete(ctx, field, value, sel.selection, fieldPath))
+	}
+
+	return &result
+}
+
+// complete shapes the resolved value into the selected fields.
+func (ex *executor) complete(ctx context.Context, field Field, value any, set []selection, path []any) any {
+	if value == nil {
+		return nil
+	}
+
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface:
+		if rv.IsNil() {
+			return nil
+		}
+	}
+
+	if field.Type == "" {
+		return value
+	}
+
+	obj := ex.schema.types[field.Type]
+
+	if rv.Kind() == reflect.Slice {
+		list := make([]any, rv.Len())
+		for i := 0; i < rv.Len(); i++ {
+			itemPath := append(append([]any{}, path...), i)
+			list[i] = ex.executeObject(ctx, obj, rv.Index(i).Interface(), set, itemPath)
+		}
+		return list
+	}
+
+	return ex.executeObject(ctx, obj, value, set, path)
+}
+
+// arguments replaces the variables in the arguments with their values.
+func (ex *executor) arguments(args map[string]any) map[string]any {
+	values := make(map[string]any, len(args))
+	for name, value := range args {
+		values[name] = ex.resolveValue(value)
+	}
+
+	return values
+}
+
+// resolveValue replaces the variables in the value with their values.
+func (ex *executor) resolveValue(value any) any {
+	switch v := value.(type) {
+	case variable:
+		return ex.vars[string(v)]
+
+	case []any:
+		list := make([]any, len(v))
+		for i := range v {
+			list[i] = ex.resolveValue(v[i])
+		}
+		return list
+
+	case map[string]any:
+		return ex.arguments(v)
+	}
+
+	return value
+}
@@ -0,0 +1,205 @@
+package graphql_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/ardanlabs/blockchain/foundation/graphql"
+)
+
+type user struct {
+	Name    string
+	Age     uint64
+	Friends []user
+}
+
+func newSchema(t *testing.T) *graphql.Schema {
+	users := map[string]user{
+		"bill": {Name: "bill", Age: 50, Friends: []user{{Name: "ed", Age: 40}}},
+	}
+
+	query := graphql.Object{
+		Name: "Query",
+		Fields: map[string]graphql.Field{
+			"user": {
+				Type: "User",
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					name, err := graphql.String(args, "name", "")
+					if err != nil {
+						return nil, err
+					}
+
+					u, exists := users[name]
+					if !exists {
+						return nil, nil
+					}
+					return u, nil
+				},
+			},
+			"fail": {
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					return nil, errors.New("failed")
+				},
+			},
+		},
+	}
+
+	userType := graphql.Object{
+		Name: "User",
+		Fields: map[string]graphql.Field{
+			"name": {
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					return source.(user).Name, nil
+				},
+			},
+			"age": {
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					return source.(user).Age, nil
+				},
+			},
+			"friends": {
+				Type: "User",
+				Resolve: func(ctx context.Context, source any, args map[string]any) (any, error) {
+					return source.(user).Friends, nil
+				},
+			},
+		},
+	}
+
+	schema, err := graphql.NewSchema(query, userType)
+	if err != nil {
+		t.Fatalf("Should be able to construct the schema: %v", err)
+	}
+
+	return schema
+}
+
+func encode(t *testing.T, resp graphql.Response) string {
+	data, err := json.Marshal(resp)
+	if err != nil {
+		t.Fatalf("Should be able to encode the response: %v", err)
+	}
+
+	return string(data)
+}
+
+func Test_Execute(t *testing.T) {
+	type table struct {
+		name  string
+		query string
+		vars  map[string]any
+		exp   string
+	}
+
+	tt := []table{
+		{
+			name:  "shorthand",
+			query: `{ user(name: "bill") { name age } }`,
+			exp:   `{"data":{"user":{"name":"bill","age":50}}}`,
+		},
+		{
+			name:  "aliases",
+			query: `query { a: user(name: "bill") { n: name } b: user(name: "jill") { name } }`,
+			exp:   `{"data":{"a":{"n":"bill"},"b":null}}`,
+		},
+		{
+			name:  "variables",
+			query: `query Get($name: String! = "jill") { user(name: $name) { __typename friends { name } } }`,
+			vars:  map[string]any{"name": "bill"},
+			exp:   `{"data":{"user":{"__typename":"User","friends":[{"name":"ed"}]}}}`,
+		},
+		{
+			name:  "resolver error",
+			query: `{ fail user(name: "bill") { name } }`,
+			exp:   `{"data":{"fail":null,"user":{"name":"bill"}},"errors":[{"message":"failed","path":["fail"]}]}`,
+		},
+		{
+			name:  "unknown field",
+			query: `{ user(name: "bill") { email } }`,
+			exp:   `{"data":null,"errors":[{"message":"cannot query field \"email\" on type \"User\""}]}`,
+		},
+		{
+			name:  "missing selection",
+			query: `{ user(name: "bill") }`,
+			exp:   `{"data":null,"errors":[{"message":"field \"user\" of type \"Query\" must have a selection"}]}`,
+		},
+		{
+			name:  "mutation",
+			query: `mutation { user(name: "bill") { name } }`,
+			exp:   `{"data":null,"errors":[{"message":"mutation operations are not supported"}]}`,
+		},
+		{
+			name:  "syntax error",
+			query: `{ user(name: "bill") { name }`,
+			exp:   `{"data":null,"errors":[{"message":"syntax error at 29: expected name, got \"\""}]}`,
+		},
+	}
+
+	schema := newSchema(t)
+
+	for _, tst := range tt {
+		f := func(t *testing.T) {
+			resp := schema.Execute(context.Background(), graphql.Request{Query: tst.query, Variables: tst.vars})
+
+			got := encode(t, resp)
+			if got != tst.exp {
+				t.Logf("got: %s", got)
+				t.Logf("exp: %s", tst.exp)
+				t.Fatalf("Should get the expected response.")
+			}
+		}
+
+		t.Run(tst.name, f)
+	}
+}
+
+func Test_Uint(t *testing.T) {
+	args := map[string]any{"literal": int64(5), "variable": float64(7), "negative": int64(-1), "fraction": 1.5}
+
+	if n, err := graphql.Uint(args, "literal", 0); err != nil || n != 5 {
+		t.Fatalf("Should read an int literal, got %d: %v", n, err)
+	}
+
+	if n, err := graphql.Uint(args, "variable", 0); err != nil || n != 7 {
+		t.Fatalf("Should read a JSON variable, got %d: %v", n, err)
+	}
+
+	if n, err := graphql.Uint(args, "missing", 10); err != nil || n != 10 {
+		t.Fatalf("Should return the default, got %d: %v", n, err)
+	}
+
+	if _, err := graphql.Uint(args, "negative", 0); err == nil {
+		t.Fatalf("Should not accept a negative number.")
+	}
+
+	if _, err := graphql.Uint(args, "fraction", 0); err == nil {
+		t.Fatalf("Should not accept a fraction.")
+	}
+}
+
+func Test_Depth(t *testing.T) {
+	schema := newSchema(t)
+
+	tt := map[string]string{
+		"list":      `{ user(name: ` + strings.Repeat("[", 3_000_000) + `) { name } }`,
+		"object":    `{ user(name: ` + strings.Repeat("{a: ", 1_000) + `) { name } }`,
+		"selection": `{ user(name: "bill") ` + strings.Repeat("{ friends ", 1_000) + `} }`,
+		"type":      `query Get($name: ` + strings.Repeat("[", 1_000) + `) { user(name: $name) { name } }`,
+	}
+
+	for name, query := range tt {
+		resp := schema.Execute(context.Background(), graphql.Request{Query: query})
+		if len(resp.Errors) != 1 || !strings.Contains(resp.Errors[0].Message, "nested deeper") {
+			t.Logf("got: %+v", resp.Errors)
+			t.Fatalf("Should reject the %s nested too deep.", name)
+		}
+	}
+
+	resp := schema.Execute(context.Background(), graphql.Request{Query: `{ user(name: "bill") { friends { friends { name } } } }`})
+	if len(resp.Errors) != 0 {
+		t.Fatalf("Should execute a query nested within the limit: %+v", resp.Errors)
+	}
+}
@@ -0,0 +1,568 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// document represents a parsed query document with a single operation.
+type document struct {
+	operation string
+	name      string
+	variables []variableDef
+	selection []selection
+}
+
+// variableDef represents a variable declared by the operation.
+type variableDef struct {
+	name     string
+	defValue any
+	hasDef   bool
+}
+
+// selection represents a field being selected.
+type selection struct {
+	alias     string
+	name      string
+	args      map[string]any
+	selection []selection
+}
+
+// variable represents a reference to a variable inside an argument value.
+type variable string
+
+// =============================================================================
+
+// Set of token kinds produced by the lexer.
+const (
+	tokEOF = iota
+	tokPunct
+	tokName
+	tokInt
+	tokFloat
+	tokString
+)
+
+// token represents a lexical token in the query.
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// maxDepth is the deepest selection sets, values and types can be nested,
+// which keeps a query from exhausting the stack of the parser.
+const maxDepth = 64
+
+// parser parses a query document.
+type parser struct {
+	src   string
+	pos   int
+	tok   token
+	depth int
+}
+
+// parse parses the query document selecting the named operation. If no name
+// is provided the document must have a single operation.
+func parse(src string, operationName string) (document, error) {
+	p := parser{src: src}
+	if err := p.next(); err != nil {
+		return document{}, err
+	}
+
+	var docs []document
+	for p.tok.kind != tokEOF {
+		doc, err := p.parseOperation()
+		if err != nil {
+			return document{}, err
+		}
+		docs = append(docs, doc)
+	}
+
+	switch {
+	case len(docs) == 0:
+		return document{}, fmt.Errorf("document has no operations")
+
+	case operationName == "" && len(docs) > 1:
+		return document{}, fmt.Errorf("operation name is required when the document has multiple operations")
+
+	case operationName == "":
+		return docs[0], nil
+	}
+
+	for _, doc := range docs {
+		if doc.name == operationName {
+			return doc, nil
+		}
+	}
+
+	return document{}, fmt.Errorf("unknown operation %q", operationName)
+}
+
+// parseOperation parses a single operation which can be the shorthand query.
+func (p *parser) parseOperation() (document, error) {
+	doc := document{operation: "query"}
+
+	if p.tok.kind == tokName {
+		switch p.tok.value {
+		case "query", "mutation", "subscription":
+			doc.operation = p.tok.value
+		case "fragment":
+			return document{}, p.errorf("fragments are not supported")
+		default:
+			return document{}, p.errorf("unexpected %q", p.tok.value)
+		}
+
+		if err := p.next(); err != nil {
+			return document{}, err
+		}
+
+		if p.tok.kind == tokName {
+			doc.name = p.tok.value
+			if err := p.next(); err != nil {
+				return document{}, err
+			}
+		}
+
+		if p.isPunct("(") {
+			vars, err := p.parseVariableDefs()
+			if err != nil {
+				return document{}, err
+			}
+			doc.variables = vars
+		}
+	}
+
+	sel, err := p.parseSelectionSet()
+	if err != nil {
+		return document{}, err
+	}
+	doc.selection = sel
+
+	return doc, nil
+}
+
+// parseVariableDefs parses the variables declared by an operation.
+func (p *parser) parseVariableDefs() ([]variableDef, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	var vars []variableDef
+	for !p.isPunct(")") {
+		if err := p.expect("$"); err != nil {
+			return nil, err
+		}
+
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		if err := p.parseType(); err != nil {
+			return nil, err
+		}
+
+		def := variableDef{name: name}
+		if p.isPunct("=") {
+			if err := p.next(); err != nil {
+				return nil, err
+			}
+
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			def.defValue = value
+			def.hasDef = true
+		}
+
+		vars = append(vars, def)
+	}
+
+	return vars, p.next()
+}
+
+// parseType parses a variable type. The type isn't checked so it's skipped.
+func (p *parser) parseType() error {
+	if err := p.enter(); err != nil {
+		return err
+	}
+	defer p.leave()
+
+	if p.isPunct("[") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if err := p.parseType(); err != nil {
+			return err
+		}
+		if err := p.expect("]"); err != nil {
+			return err
+		}
+	} else if _, err := p.parseName(); err != nil {
+		return err
+	}
+
+	if p.isPunct("!") {
+		return p.next()
+	}
+
+	return nil
+}
+
+// parseSelectionSet parses the fields between braces.
+func (p *parser) parseSelectionSet() ([]selection, error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+
+	var set []selection
+	for !p.isPunct("}") {
+		if p.isPunct("...") {
+			return nil, p.errorf("fragments are not supported")
+		}
+
+		sel, err := p.parseField()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, sel)
+	}
+
+	if len(set) == 0 {
+		return nil, p.errorf("selection set is empty")
+	}
+
+	return set, p.next()
+}
+
+// parseField parses a field with its alias, arguments and selection set.
+func (p *parser) parseField() (selection, error) {
+	name, err := p.parseName()
+	if err != nil {
+		return selection{}, err
+	}
+
+	sel := selection{alias: name, name: name}
+	if p.isPunct(":") {
+		if err := p.next(); err != nil {
+			return selection{}, err
+		}
+
+		if sel.name, err = p.parseName(); err != nil {
+			return selection{}, err
+		}
+	}
+
+	if p.isPunct("(") {
+		if sel.args, err = p.parseArguments(); err != nil {
+			return selection{}, err
+		}
+	}
+
+	if p.isPunct("@") {
+		return selection{}, p.errorf("directives are not supported")
+	}
+
+	if p.isPunct("{") {
+		if sel.selection, err = p.parseSelectionSet(); err != nil {
+			return selection{}, err
+		}
+	}
+
+	return sel, nil
+}
+
+// parseArguments parses the arguments for a field.
+func (p *parser) parseArguments() (map[string]any, error) {
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+
+	args := make(map[string]any)
+	for !p.isPunct(")") {
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+
+		if err := p.expect(":"); err != nil {
+			return nil, err
+		}
+
+		value, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		args[name] = value
+	}
+
+	return args, p.next()
+}
+
+// parseValue parses an argument value.
+func (p *parser) parseValue() (any, error) {
+	tok := p.tok
+
+	switch tok.kind {
+	case tokInt:
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			return nil, p.errorf("invalid int %q", tok.value)
+		}
+		return n, p.next()
+
+	case tokFloat:
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			return nil, p.errorf("invalid float %q", tok.value)
+		}
+		return f, p.next()
+
+	case tokString:
+		return tok.value, p.next()
+
+	case tokName:
+		var value any
+		switch tok.value {
+		case "true":
+			value = true
+		case "false":
+			value = false
+		case "null":
+			value = nil
+		default:
+			value = tok.value
+		}
+		return value, p.next()
+	}
+
+	switch {
+	case p.isPunct("$"):
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+
+		name, err := p.parseName()
+		if err != nil {
+			return nil, err
+		}
+		return variable(name), nil
+
+	case p.isPunct("["):
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+
+		list := []any{}
+		for !p.isPunct("]") {
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		return list, p.next()
+
+	case p.isPunct("{"):
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+
+		if err := p.next(); err != nil {
+			return nil, err
+		}
+
+		obj := make(map[string]any)
+		for !p.isPunct("}") {
+			name, err := p.parseName()
+			if err != nil {
+				return nil, err
+			}
+
+			if err := p.expect(":"); err != nil {
+				return nil, err
+			}
+
+			value, err := p.parseValue()
+			if err != nil {
+				return nil, err
+			}
+			obj[name] = value
+		}
+		return obj, p.next()
+	}
+
+	return nil, p.errorf("unexpected %q", tok.value)
+}
+
+// enter moves one level deeper into the document and fails once the
+// document is nested deeper than allowed.
+func (p *parser) enter() error {
+	if p.depth >= maxDepth {
+		return p.errorf("document is nested deeper than %d levels", maxDepth)
+	}
+	p.depth++
+
+	return nil
+}
+
+// leave moves back out of a level entered.
+func (p *parser) leave() {
+	p.depth--
+}
+
+// parseName parses a name token.
+func (p *parser) parseName() (string, error) {
+	if p.tok.kind != tokName {
+		return "", p.errorf("expected name, got %q", p.tok.value)
+	}
+
+	name := p.tok.value
+	return name, p.next()
+}
+
+// expect consumes the specified punctuator.
+func (p *parser) expect(punct string) error {
+	if !p.isPunct(punct) {
+		return p.errorf("expected %q, got %q", punct, p.tok.value)
+	}
+
+	return p.next()
+}
+
+// isPunct checks if the current token is the specified punctuator.
+func (p *parser) isPunct(punct string) bool {
+	return p.tok.kind == tokPunct && p.tok.value == punct
+}
+
+// errorf constructs an error for the position of the current token.
+func (p *parser) errorf(format string, args ...any) error {
+	return fmt.Errorf("syntax error at %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// =============================================================================
+
+// next reads the next token from the source. Whitespace, commas and comments
+// are ignored.
+func (p *parser) next() error {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			p.pos++
+			continue
+
+		case c == '#':
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+
+		break
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokEOF, pos: start}
+		return nil
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokPunct, value: "...", pos: start}
+
+	case strings.IndexByte("{}()[]:!$=@", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokPunct, value: string(c), pos: start}
+
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokName, value: p.src[start:p.pos], pos: start}
+
+	case c == '-' || isDigit(c):
+		kind := tokInt
+		p.pos++
+		for p.pos < len(p.src) {
+			c := p.src[p.pos]
+			if c == '.' || c == 'e' || c == 'E' || c == '+' || (c == '-' && kind == tokFloat) {
+				kind = tokFloat
+			} else if !isDigit(c) {
+				break
+			}
+			p.pos++
+		}
+		p.tok = token{kind: kind, value: p.src[start:p.pos], pos: start}
+
+	case c == '"':
+		p.pos++
+		var sb strings.Builder
+		for {
+			if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+				return fmt.Errorf("syntax error at %d: unterminated string", start)
+			}
+
+			c := p.src[p.pos]
+			if c == '"' {
+				p.pos++
+				break
+			}
+
+			if c == '\\' && p.pos+1 < len(p.src) {
+				p.pos++
+				switch e := p.src[p.pos]; e {
+				case 'n':
+					sb.WriteByte('\n')
+				case 't':
+					sb.WriteByte('\t')
+				case 'r':
+					sb.WriteByte('\r')
+				default:
+					sb.WriteByte(e)
+				}
+				p.pos++
+				continue
+			}
+
+			sb.WriteByte(c)
+			p.pos++
+		}
+		p.tok = token{kind: tokString, value: sb.String(), pos: start}
+
+	default:
+		return fmt.Errorf("syntax error at %d: unexpected character %q", start, c)
+	}
+
+	return nil
+}
+
+func isLetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -10,7 +10,14 @@ import (
 // New constructs a Sugared Logger that writes to stdout and
 // provides human-readable timestamps.
 func New(service string) (*zap.SugaredLogger, error) {
+	return NewWithLevel(service, zap.NewAtomicLevelAt(zap.InfoLevel))
+}
+
+// NewWithLevel constructs a Sugared Logger like New that logs at the level,
+// which can be changed while the logger is in use.
+func NewWithLevel(service string, level zap.AtomicLevel) (*zap.SugaredLogger, error) {
 	config := zap.NewProductionConfig()
+	config.Level = level
 	config.OutputPaths = []string{"stdout"}
 	config.EncoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	config.DisableStacktrace = true
@@ -37,3 +37,24 @@ func Respond(ctx context.Context, w http.ResponseWriter, data any, statusCode in
 
 	return nil
 }
+
+// RespondBytes sends the data as is to the client using the specified
+// content type.
+func RespondBytes(ctx context.Context, w http.ResponseWriter, data []byte, contentType string, statusCode int) error {
+
+	// Set the status code for the request logger middleware.
+	SetStatusCode(ctx, statusCode)
+
+	// Set the content type for the data being sent.
+	w.Header().Set("Content-Type", contentType)
+
+	// Write the status code to the response.
+	w.WriteHeader(statusCode)
+
+	// Send the result back to the client.
+	if _, err := w.Write(data); err != nil {
+		return err
+	}
+
+	return nil
+}
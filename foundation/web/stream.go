@@ -0,0 +1,97 @@
+package web
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// EventStream writes Server-Sent Events to a client. The connection is
+// hijacked from the server, like a websocket, so the stream isn't cut off by
+// the server write timeout. The stream ends when the connection is closed.
+type EventStream struct {
+	conn         net.Conn
+	rw           *bufio.ReadWriter
+	writeTimeout time.Duration
+}
+
+// NewEventStream hijacks the connection and writes the response headers for
+// an event stream. Each write must complete within the write timeout.
+func NewEventStream(ctx context.Context, w http.ResponseWriter, writeTimeout time.Duration) (*EventStream, error) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, errors.New("connection doesn't support event streams")
+	}
+
+	conn, rw, err := hj.Hijack()
+	if err != nil {
+		return nil, err
+	}
+
+	// Set the status code for the request logger middleware.
+	SetStatusCode(ctx, http.StatusOK)
+
+	es := EventStream{
+		conn:         conn,
+		rw:           rw,
+		writeTimeout: writeTimeout,
+	}
+
+	// The response has no length so it's delimited by closing the connection.
+	const header = "HTTP/1.1 200 OK\r\n" +
+		"Content-Type: text/event-stream\r\n" +
+		"Cache-Control: no-cache\r\n" +
+		"Connection: close\r\n" +
+		"Access-Control-Allow-Origin: *\r\n" +
+		"\r\n"
+
+	if err := es.write(header); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &es, nil
+}
+
+// Send writes an event with the specified name and data. Data that spans
+// multiple lines is written as multiple data fields.
+func (es *EventStream) Send(event string, data string) error {
+	var b strings.Builder
+
+	fmt.Fprintf(&b, "event: %s\n", event)
+	for _, line := range strings.Split(data, "\n") {
+		fmt.Fprintf(&b, "data: %s\n", line)
+	}
+	b.WriteString("\n")
+
+	return es.write(b.String())
+}
+
+// Ping writes a comment to keep the connection alive and detect a client
+// that has gone away.
+func (es *EventStream) Ping() error {
+	return es.write(": ping\n\n")
+}
+
+// Close closes the connection which ends the stream.
+func (es *EventStream) Close() error {
+	return es.conn.Close()
+}
+
+// write writes and flushes the data to the connection.
+func (es *EventStream) write(s string) error {
+	if err := es.conn.SetWriteDeadline(time.Now().Add(es.writeTimeout)); err != nil {
+		return err
+	}
+
+	if _, err := es.rw.WriteString(s); err != nil {
+		return err
+	}
+
+	return es.rw.Flush()
+}